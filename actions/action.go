@@ -0,0 +1,173 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Action types
+const (
+	TypeScene    = "scene"    // recall a library scene
+	TypeDevices  = "devices"  // set devices to a (partial) state
+	TypeEffect   = "effect"   // start an effect on a device
+	TypeSequence = "sequence" // play a sequence
+	TypeOff      = "off"      // switch every light off
+)
+
+// Types lists the action types in the order they are documented
+var Types = []string{TypeScene, TypeDevices, TypeEffect, TypeSequence, TypeOff}
+
+// Action is something done to the lights by a schedule or rule
+//
+// Example:
+//
+//	{"type": "scene", "scene": "Evening", "transition": {"duration": 5000}}
+//	{"type": "devices", "devices": {"ledStrip": {"r": 255, "g": 80, "b": 0}}}
+//	{"type": "effect", "effect": "candle", "device": "ledBar"}
+//	{"type": "sequence", "sequence": "Wind Down"}
+//	{"type": "off", "transition": {"duration": 60000}}
+type Action struct {
+	Type       string                 `json:"type"`
+	Scene      string                 `json:"scene,omitempty"`
+	Devices    *storage.SceneData     `json:"devices,omitempty"`
+	Transition *lights.TransitionSpec `json:"transition,omitempty"`
+	Effect     string                 `json:"effect,omitempty"`
+	Device     string                 `json:"device,omitempty"`
+	Params     effects.Params         `json:"params,omitempty"`
+	Sequence   string                 `json:"sequence,omitempty"`
+	Loop       *bool                  `json:"loop,omitempty"`
+}
+
+// Parse decodes and validates a JSON action
+func Parse(data []byte) (Action, error) {
+	var a Action
+	if err := json.Unmarshal(data, &a); err != nil {
+		return Action{}, fmt.Errorf("invalid action: %w", err)
+	}
+	if err := a.Validate(); err != nil {
+		return Action{}, err
+	}
+	return a, nil
+}
+
+// Validate checks that an action has what its type needs
+// Scenes and sequences are looked up by name when the action runs, as they may be
+// renamed or created later.
+func (a Action) Validate() error {
+	if a.Transition != nil {
+		if _, err := a.Transition.Transition(); err != nil {
+			return err
+		}
+	}
+
+	switch a.Type {
+	case TypeScene:
+		if a.Scene == "" {
+			return fmt.Errorf("scene action needs a scene name")
+		}
+	case TypeDevices:
+		if a.Devices == nil || a.Devices.IsEmpty() {
+			return fmt.Errorf("devices action needs at least one device")
+		}
+	case TypeEffect:
+		def, err := effects.Lookup(a.Effect)
+		if err != nil {
+			return err
+		}
+		device, err := effects.ParseDevice(a.Device)
+		if err != nil {
+			return err
+		}
+		if !def.Supports(device) {
+			return fmt.Errorf("effect %s does not support %s", def.Name, device)
+		}
+		if _, err := def.ResolveParams(a.Params); err != nil {
+			return err
+		}
+	case TypeSequence:
+		if a.Sequence == "" {
+			return fmt.Errorf("sequence action needs a sequence name")
+		}
+	case TypeOff:
+	default:
+		return fmt.Errorf("unknown action type %q (want one of %v)", a.Type, Types)
+	}
+	return nil
+}
+
+// String describes the action for logs
+func (a Action) String() string {
+	switch a.Type {
+	case TypeScene:
+		return fmt.Sprintf("recall scene %q", a.Scene)
+	case TypeEffect:
+		return fmt.Sprintf("start %s on %s", a.Effect, a.Device)
+	case TypeSequence:
+		return fmt.Sprintf("play sequence %q", a.Sequence)
+	case TypeOff:
+		return "switch off"
+	default:
+		return "set " + a.Type
+	}
+}
+
+// Runner carries out actions
+type Runner struct {
+	engine    *lights.TransitionEngine
+	commands  *lights.CommandHandler
+	effects   *effects.Engine
+	player    *sequences.Player
+	sequences storage.SequenceStore
+}
+
+// NewRunner creates an action runner
+func NewRunner(
+	engine *lights.TransitionEngine,
+	scenes storage.SceneStore,
+	effectsEngine *effects.Engine,
+	player *sequences.Player,
+	sequenceStore storage.SequenceStore,
+) *Runner {
+	return &Runner{
+		engine:    engine,
+		commands:  lights.NewCommandHandler(engine, scenes),
+		effects:   effectsEngine,
+		player:    player,
+		sequences: sequenceStore,
+	}
+}
+
+// Run carries out an action
+func (r *Runner) Run(a Action) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	switch a.Type {
+	case TypeScene:
+		return r.commands.Apply(lights.Command{Scene: a.Scene, Transition: a.Transition})
+	case TypeDevices:
+		return r.commands.Apply(lights.Command{Devices: a.Devices, Transition: a.Transition})
+	case TypeEffect:
+		device, _ := effects.ParseDevice(a.Device)
+		return r.effects.Start(a.Effect, device, a.Params)
+	case TypeSequence:
+		seq, err := sequences.Find(r.sequences, a.Sequence)
+		if err != nil {
+			return err
+		}
+		loop := seq.Loop
+		if a.Loop != nil {
+			loop = *a.Loop
+		}
+		return r.player.Play(seq, loop)
+	case TypeOff:
+		return r.commands.Apply(lights.Command{Devices: r.engine.Rig().Off(lights.SelectAll()), Transition: a.Transition})
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package actions
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"scene", `{"type":"scene","scene":"Evening","transition":{"duration":5000}}`, false},
+		{"devices", `{"type":"devices","devices":{"videoLights":[{"id":0,"on":true,"brightness":40}]}}`, false},
+		{"effect", `{"type":"effect","effect":"candle","device":"ledBar","params":{"intensity":120}}`, false},
+		{"sequence", `{"type":"sequence","sequence":"Wind Down","loop":false}`, false},
+		{"off", `{"type":"off"}`, false},
+		{"unknown type", `{"type":"party"}`, true},
+		{"scene without name", `{"type":"scene"}`, true},
+		{"empty devices", `{"type":"devices","devices":{}}`, true},
+		{"unknown effect", `{"type":"effect","effect":"lava","device":"ledBar"}`, true},
+		{"unsupported device", `{"type":"effect","effect":"rainbow","device":"ledBar"}`, true},
+		{"param out of range", `{"type":"effect","effect":"candle","device":"ledBar","params":{"intensity":999}}`, true},
+		{"sequence without name", `{"type":"sequence"}`, true},
+		{"bad easing", `{"type":"off","transition":{"duration":100,"easing":"wobbly"}}`, true},
+		{"invalid JSON", `{"type":`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
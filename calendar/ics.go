@@ -0,0 +1,363 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a VEVENT read from an iCalendar file
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Categories  []string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool // DTSTART is a date, not a time
+	Cancelled   bool // STATUS:CANCELLED
+	Free        bool // TRANSP:TRANSPARENT, shown as free time
+
+	// Recurrence: the raw RRULE, the excluded starts and, for an occurrence that
+	// was moved or edited, the start it replaces
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceID time.Time
+}
+
+// Occurrence is one time an event happens
+type Occurrence struct {
+	UID      string    `json:"uid"`
+	Summary  string    `json:"summary"`
+	Location string    `json:"location,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// property is an unfolded content line
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the events of an iCalendar document
+// Times without a zone (and zones that can't be loaded, such as Windows zone
+// names) are read in loc.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	var duration time.Duration
+	depth := 0 // nesting inside the current VEVENT (VALARM and the like)
+
+	for n, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT") && current == nil:
+			current = &Event{}
+			duration = 0
+			continue
+		case prop.name == "BEGIN" && current != nil:
+			depth++
+			continue
+		case prop.name == "END" && current != nil && depth > 0:
+			depth--
+			continue
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT") && current != nil:
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", n+1, current.Summary)
+			}
+			if current.End.IsZero() {
+				current.End = current.Start.Add(duration)
+				if current.AllDay && duration == 0 {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *current)
+			current = nil
+			continue
+		}
+		if current == nil || depth > 0 {
+			continue
+		}
+
+		switch prop.name {
+		case "UID":
+			current.UID = prop.value
+		case "SUMMARY":
+			current.Summary = unescape(prop.value)
+		case "DESCRIPTION":
+			current.Description = unescape(prop.value)
+		case "LOCATION":
+			current.Location = unescape(prop.value)
+		case "CATEGORIES":
+			for _, c := range splitEscaped(prop.value) {
+				current.Categories = append(current.Categories, unescape(c))
+			}
+		case "STATUS":
+			current.Cancelled = strings.EqualFold(prop.value, "CANCELLED")
+		case "TRANSP":
+			current.Free = strings.EqualFold(prop.value, "TRANSPARENT")
+		case "DTSTART":
+			t, allDay, err := parseTime(prop, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			current.Start, current.AllDay = t, allDay
+		case "DTEND":
+			t, _, err := parseTime(prop, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			current.End = t
+		case "DURATION":
+			d, err := parseDuration(prop.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			duration = d
+		case "RRULE":
+			current.RRule = prop.value
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				t, _, err := parseTime(property{name: prop.name, params: prop.params, value: value}, loc)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+				current.ExDates = append(current.ExDates, t)
+			}
+		case "RECURRENCE-ID":
+			t, _, err := parseTime(prop, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			current.RecurrenceID = t
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("event %q is not closed with END:VEVENT", current.Summary)
+	}
+	return events, nil
+}
+
+// unfold joins continuation lines (those starting with a space or tab) onto the line before
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+// parseProperty splits a content line into its name, parameters and value
+func parseProperty(line string) (property, error) {
+	// The value starts at the first colon outside a quoted parameter value
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := property{name: strings.ToUpper(parts[0]), params: make(map[string]string), value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// parseTime reads a DATE or DATE-TIME value, reporting whether it is a date
+func parseTime(prop property, loc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.value)
+
+	if prop.params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s date %q", prop.name, value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s time %q", prop.name, value)
+		}
+		return t, false, nil
+	}
+
+	zone := loc
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			zone = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, zone)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s time %q", prop.name, value)
+	}
+	return t, false, nil
+}
+
+// parseDuration reads an iCalendar duration such as "PT1H30M" or "P1D"
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(value), "+")
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var total time.Duration
+	inTime := false
+	number := ""
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			number += string(c)
+		default:
+			unit, ok := units[c]
+			if !ok || number == "" || (c == 'M' && !inTime) {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			n, _ := strconv.Atoi(number)
+			total += time.Duration(n) * unit
+			number = ""
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * total, nil
+}
+
+// unescape decodes an iCalendar TEXT value
+func unescape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(value[i])
+			}
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// splitEscaped splits a TEXT list on commas that aren't escaped
+func splitEscaped(value string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' {
+			i++
+			continue
+		}
+		if value[i] == ',' {
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// Occurrences returns the times the events happen that overlap [from, to), in start order
+// Recurring events are expanded, leaving out excluded dates and occurrences that
+// were moved or edited (those are events of their own with a RecurrenceID).
+func Occurrences(events []Event, from, to time.Time) []Occurrence {
+	// Occurrences replaced by an edited copy, by UID and original start
+	replaced := make(map[string]map[int64]bool)
+	for _, e := range events {
+		if !e.RecurrenceID.IsZero() {
+			if replaced[e.UID] == nil {
+				replaced[e.UID] = make(map[int64]bool)
+			}
+			replaced[e.UID][e.RecurrenceID.Unix()] = true
+		}
+	}
+
+	var result []Occurrence
+	for _, e := range events {
+		length := e.End.Sub(e.Start)
+		add := func(start time.Time) {
+			end := start.Add(length)
+			if end.After(from) && start.Before(to) {
+				result = append(result, Occurrence{UID: e.UID, Summary: e.Summary, Location: e.Location, Start: start, End: end})
+			}
+		}
+
+		if e.RRule == "" || !e.RecurrenceID.IsZero() {
+			add(e.Start)
+			continue
+		}
+
+		rule, err := parseRRule(e.RRule, e.Start.Location())
+		if err != nil {
+			// Better to catch the first meeting than none
+			add(e.Start)
+			continue
+		}
+		excluded := make(map[int64]bool)
+		for _, t := range e.ExDates {
+			excluded[t.Unix()] = true
+		}
+		rule.each(e.Start, to, func(start time.Time) {
+			if !excluded[start.Unix()] && !replaced[e.UID][start.Unix()] {
+				add(start)
+			}
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result
+}
@@ -0,0 +1,228 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Test//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@example.com\r\n" +
+	"SUMMARY:Team standup\r\n" +
+	"DTSTART;TZID=Europe/London:20260302T093000\r\n" +
+	"DTEND;TZID=Europe/London:20260302T094500\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=6\r\n" +
+	"EXDATE;TZID=Europe/London:20260304T093000\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"DESCRIPTION:Not the event description\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@example.com\r\n" +
+	"RECURRENCE-ID;TZID=Europe/London:20260306T093000\r\n" +
+	"SUMMARY:Team standup (moved)\r\n" +
+	"DTSTART;TZID=Europe/London:20260306T110000\r\n" +
+	"DURATION:PT30M\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:review@example.com\r\n" +
+	"SUMMARY:Design review\\, round 2\r\n" +
+	"DESCRIPTION:Agenda:\\nslides\r\n" +
+	"LOCATION:Room 4\r\n" +
+	"CATEGORIES:Work,Video\r\n" +
+	"DTSTART:20260303T140000Z\r\n" +
+	"DTEND:20260303T150000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday@example.com\r\n" +
+	"SUMMARY:Bank holiday\r\n" +
+	"DTSTART;VALUE=DATE:20260305\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:long@example.com\r\n" +
+	"SUMMARY:A very long summary that the exporter has folded over more than one\r\n" +
+	"  line\r\n" +
+	"DTSTART:20260304T120000\r\n" +
+	"DTEND:20260304T130000\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"TRANSP:TRANSPARENT\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(sampleICS), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events, got %d", len(events))
+	}
+
+	london, _ := time.LoadLocation("Europe/London")
+	standup := events[0]
+	if standup.Summary != "Team standup" || standup.Description != "" || standup.RRule == "" || len(standup.ExDates) != 1 {
+		t.Errorf("Unexpected standup: %+v", standup)
+	}
+	if !standup.Start.Equal(time.Date(2026, 3, 2, 9, 30, 0, 0, london)) || standup.End.Sub(standup.Start) != 15*time.Minute {
+		t.Errorf("Standup times %v - %v", standup.Start, standup.End)
+	}
+
+	moved := events[1]
+	if moved.RecurrenceID.IsZero() || moved.End.Sub(moved.Start) != 30*time.Minute {
+		t.Errorf("Unexpected moved occurrence: %+v", moved)
+	}
+
+	review := events[2]
+	if review.Summary != "Design review, round 2" || review.Description != "Agenda:\nslides" || review.Location != "Room 4" ||
+		len(review.Categories) != 2 || review.Categories[1] != "Video" {
+		t.Errorf("Text not decoded: %+v", review)
+	}
+
+	holiday := events[3]
+	if !holiday.AllDay || holiday.End.Sub(holiday.Start) != 24*time.Hour {
+		t.Errorf("Unexpected all-day event: %+v", holiday)
+	}
+
+	long := events[4]
+	if !strings.HasSuffix(long.Summary, "more than one line") || !long.Cancelled || !long.Free {
+		t.Errorf("Unexpected folded event: %+v", long)
+	}
+	if long.Start.Location() != time.UTC || long.Start.Hour() != 12 {
+		t.Errorf("Floating time not read in the given location: %v", long.Start)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ics  string
+	}{
+		{"no start", "BEGIN:VEVENT\nSUMMARY:x\nEND:VEVENT\n"},
+		{"bad time", "BEGIN:VEVENT\nDTSTART:2026-03-02\nEND:VEVENT\n"},
+		{"bad duration", "BEGIN:VEVENT\nDTSTART:20260302T090000Z\nDURATION:1 hour\nEND:VEVENT\n"},
+		{"not closed", "BEGIN:VEVENT\nDTSTART:20260302T090000Z\n"},
+		{"no colon", "BEGIN:VEVENT\nDTSTART\nEND:VEVENT\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.ics), time.UTC); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"PT15M", 15 * time.Minute},
+		{"PT1H30M", 90 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"P1DT2H", 26 * time.Hour},
+		{"-PT5M", -5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	events, err := Parse(strings.NewReader(sampleICS), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	london, _ := time.LoadLocation("Europe/London")
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	got := Occurrences(events, from, from.AddDate(0, 1, 0))
+
+	// Six standups (Mon, Wed, Fri from 2 March; COUNT includes the excluded
+	// Wednesday) with Friday's moved to 11:00, the review, the holiday and the
+	// cancelled event: filtering those is the watcher's job
+	want := []struct {
+		summary string
+		start   time.Time
+	}{
+		{"Team standup", time.Date(2026, 3, 2, 9, 30, 0, 0, london)},
+		{"Design review, round 2", time.Date(2026, 3, 3, 14, 0, 0, 0, time.UTC)},
+		{"Bank holiday", time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"A very long summary that the exporter has folded over more than one line", time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)},
+		{"Team standup (moved)", time.Date(2026, 3, 6, 11, 0, 0, 0, london)},
+		{"Team standup", time.Date(2026, 3, 9, 9, 30, 0, 0, london)},
+		{"Team standup", time.Date(2026, 3, 11, 9, 30, 0, 0, london)},
+		{"Team standup", time.Date(2026, 3, 13, 9, 30, 0, 0, london)},
+	}
+
+	// Sort the expectation the way Occurrences does
+	for i := 1; i < len(want); i++ {
+		for j := i; j > 0 && want[j].start.Before(want[j-1].start); j-- {
+			want[j], want[j-1] = want[j-1], want[j]
+		}
+	}
+
+	if len(got) != len(want) {
+		for _, o := range got {
+			t.Logf("%s %v", o.Summary, o.Start)
+		}
+		t.Fatalf("Expected %d occurrences, got %d", len(want), len(got))
+	}
+	for i, o := range got {
+		if o.Summary != want[i].summary || !o.Start.Equal(want[i].start) {
+			t.Errorf("Occurrence %d = %q at %v, want %q at %v", i, o.Summary, o.Start, want[i].summary, want[i].start)
+		}
+	}
+}
+
+func TestRecurrenceAcrossDST(t *testing.T) {
+	london, _ := time.LoadLocation("Europe/London")
+	event := Event{
+		UID:     "daily",
+		Summary: "Daily sync",
+		Start:   time.Date(2026, 3, 27, 9, 0, 0, 0, london),
+		End:     time.Date(2026, 3, 27, 9, 15, 0, 0, london),
+		RRule:   "FREQ=DAILY;UNTIL=20260331T235959Z",
+	}
+
+	got := Occurrences([]Event{event}, event.Start, event.Start.AddDate(0, 0, 10))
+	if len(got) != 5 {
+		t.Fatalf("Expected 5 occurrences up to UNTIL, got %d", len(got))
+	}
+	for _, o := range got {
+		local := o.Start.In(london)
+		if local.Hour() != 9 || local.Minute() != 0 {
+			t.Errorf("Occurrence moved off 09:00 local time: %v", local)
+		}
+	}
+}
+
+func TestMonthlyRecurrenceSkipsMissingDays(t *testing.T) {
+	event := Event{
+		UID:   "monthly",
+		Start: time.Date(2026, 1, 31, 16, 0, 0, 0, time.UTC),
+		End:   time.Date(2026, 1, 31, 17, 0, 0, 0, time.UTC),
+		RRule: "FREQ=MONTHLY;COUNT=3",
+	}
+
+	got := Occurrences([]Event{event}, event.Start, event.Start.AddDate(1, 0, 0))
+	wantMonths := []time.Month{time.January, time.March, time.May}
+	if len(got) != len(wantMonths) {
+		t.Fatalf("Expected %d occurrences, got %d", len(wantMonths), len(got))
+	}
+	for i, o := range got {
+		if o.Start.Month() != wantMonths[i] || o.Start.Day() != 31 {
+			t.Errorf("Occurrence %d at %v", i, o.Start)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package calendar
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxOccurrences bounds the expansion of a recurrence rule
+const maxOccurrences = 10000
+
+// rrule is the supported part of an RRULE: FREQ (DAILY, WEEKLY, MONTHLY or
+// YEARLY), INTERVAL, COUNT, UNTIL and, for weekly rules, BYDAY
+type rrule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+// icalDays maps two-letter day codes to time.Weekday
+var icalDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRRule reads a recurrence rule; a floating UNTIL is read in loc
+func parseRRule(value string, loc *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			r.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", val)
+			}
+			r.count = n
+		case "UNTIL":
+			t, _, err := parseTime(property{name: "UNTIL", value: val}, loc)
+			if err != nil {
+				return nil, err
+			}
+			r.until = t
+		case "BYDAY":
+			for _, code := range strings.Split(val, ",") {
+				day, ok := icalDays[strings.ToUpper(code)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q", code)
+				}
+				r.byDay = append(r.byDay, day)
+			}
+		case "WKST":
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %q", key)
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "MONTHLY", "YEARLY":
+		if len(r.byDay) > 0 {
+			return nil, fmt.Errorf("BYDAY is only supported for weekly rules")
+		}
+	case "WEEKLY":
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", r.freq)
+	}
+	return r, nil
+}
+
+// each calls fn with every start of the rule from start (the first) until one
+// is at or after to, keeping the wall-clock time of start across DST changes
+func (r *rrule) each(start, to time.Time, fn func(time.Time)) {
+	emitted := 0
+	emit := func(t time.Time) bool {
+		if !t.Before(to) || (!r.until.IsZero() && t.After(r.until)) || (r.count > 0 && emitted >= r.count) {
+			return false
+		}
+		emitted++
+		fn(t)
+		return true
+	}
+
+	for period := 0; period < maxOccurrences; period++ {
+		switch r.freq {
+		case "DAILY":
+			if !emit(start.AddDate(0, 0, period*r.interval)) {
+				return
+			}
+		case "WEEKLY":
+			if len(r.byDay) == 0 {
+				if !emit(start.AddDate(0, 0, 7*period*r.interval)) {
+					return
+				}
+				continue
+			}
+			// Weeks start on Monday
+			monday := start.AddDate(0, 0, -((int(start.Weekday())+6)%7)+7*period*r.interval)
+			for offset := 0; offset < 7; offset++ {
+				day := monday.AddDate(0, 0, offset)
+				if !slices.Contains(r.byDay, day.Weekday()) || day.Before(start) {
+					continue
+				}
+				if !emit(day) {
+					return
+				}
+			}
+		case "MONTHLY", "YEARLY":
+			months, years := period*r.interval, 0
+			if r.freq == "YEARLY" {
+				months, years = 0, period*r.interval
+			}
+			t := start.AddDate(years, months, 0)
+			if t.Day() != start.Day() {
+				// The 31st (or 29 February) doesn't exist that month
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,518 @@
+// Package calendar sets meeting lighting from local iCalendar (.ics) files
+//
+// The watcher reads an .ics file, or every .ics file in a directory, and shortly
+// before a matching event starts recalls a meeting scene with the video lights
+// on. When the meeting (or a run of back-to-back meetings) is over, the lights
+// that were changed are put back as they were.
+package calendar
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// DefaultScene is the scene recalled for meetings
+const DefaultScene = "Meeting"
+
+// DefaultLead is how long before a meeting starts the lights change
+const DefaultLead = 2 * time.Minute
+
+// DefaultVideoBrightness is used for a video light the meeting scene doesn't
+// set and that has no brightness of its own
+const DefaultVideoBrightness = 80
+
+// PollInterval is how often the calendar files are checked for changes
+const PollInterval = time.Minute
+
+// lookBehind is how far back events are expanded to find meetings under way
+const lookBehind = 24 * time.Hour
+
+// lookAhead is how far ahead upcoming meetings are listed
+const lookAhead = 7 * 24 * time.Hour
+
+// maxUpcoming is how many upcoming meetings Status lists
+const maxUpcoming = 10
+
+// Config says which calendar to watch and what counts as a meeting
+type Config struct {
+	Path     string        // an .ics file or a directory of them; empty disables the watcher
+	Scene    string        // the scene recalled for meetings
+	Lead     time.Duration // how long before a meeting starts the lights change
+	Keywords []string      // only events mentioning one of these count; none means every event
+	Exclude  []string      // events mentioning any of these don't count
+}
+
+// Status describes the calendar and the meeting lighting
+type Status struct {
+	Path     string       `json:"path"`
+	Scene    string       `json:"scene"`
+	Lead     int          `json:"lead"` // milliseconds
+	Keywords []string     `json:"keywords"`
+	Exclude  []string     `json:"exclude"`
+	Error    string       `json:"error,omitempty"`   // why the calendar couldn't be read
+	Meeting  *Occurrence  `json:"meeting,omitempty"` // the meeting the lights are set for
+	Until    *time.Time   `json:"until,omitempty"`   // when the lights are put back
+	Upcoming []Occurrence `json:"upcoming"`
+}
+
+// Watcher sets the lights for meetings in a calendar
+//
+// Events match when their summary, description, location or categories contain
+// one of the keywords (ignoring case) and none of the excluded words. All-day,
+// cancelled and free events never match. Meetings that overlap, or start within
+// the lead time of the previous one ending, are treated as one.
+type Watcher struct {
+	engine *lights.TransitionEngine
+	scenes storage.SceneStore
+	clock  clock.Clock
+	loc    *time.Location
+	config Config
+
+	mu       sync.Mutex
+	events   []Event
+	modTimes map[string]time.Time
+	loadErr  error
+	meeting  *Occurrence
+	until    time.Time
+	before   *storage.SceneData // the lights the meeting changed, as they were
+	applying *storage.SceneData
+
+	reload chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewWatcher creates a watcher reading times without a zone in loc
+func NewWatcher(engine *lights.TransitionEngine, scenes storage.SceneStore, clk clock.Clock, loc *time.Location, config Config) *Watcher {
+	return &Watcher{
+		engine: engine,
+		scenes: scenes,
+		clock:  clk,
+		loc:    loc,
+		config: config,
+		reload: make(chan struct{}, 1),
+	}
+}
+
+// Start reads the calendar and starts watching it
+// Without a path it does nothing. A calendar that can't be read is retried at
+// every poll, so it may appear later.
+func (w *Watcher) Start() error {
+	if w.config.Path == "" {
+		return nil
+	}
+	if w.config.Lead < 0 {
+		return fmt.Errorf("meeting lead time must not be negative, got %v", w.config.Lead)
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.loop()
+	return nil
+}
+
+// Stop stops watching and, if a meeting is under way, puts the lights back at once
+// After a restart during the meeting, the meeting lighting is set again.
+func (w *Watcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+
+	if w.meeting != nil {
+		w.endMeeting(lights.Transition{})
+	}
+}
+
+// Reload re-reads the calendar files straight away
+// The files are read before it returns, so Status reports any error; the
+// lights follow on the watcher's own goroutine.
+func (w *Watcher) Reload() {
+	if w.config.Path == "" {
+		return
+	}
+
+	w.mu.Lock()
+	w.modTimes = nil
+	w.mu.Unlock()
+	w.refresh()
+
+	select {
+	case w.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Owns reports whether the watcher is applying the given scene data, so the
+// caller can tell the meeting lighting from other changes
+func (w *Watcher) Owns(data *storage.SceneData) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return data != nil && w.applying == data
+}
+
+// Status returns the calendar settings, the meeting under way and the upcoming meetings
+func (w *Watcher) Status() Status {
+	now := w.clock.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := Status{
+		Path:     w.config.Path,
+		Scene:    w.config.Scene,
+		Lead:     int(w.config.Lead / time.Millisecond),
+		Keywords: nonNil(w.config.Keywords),
+		Exclude:  nonNil(w.config.Exclude),
+		Upcoming: make([]Occurrence, 0),
+	}
+	if w.loadErr != nil {
+		status.Error = w.loadErr.Error()
+	}
+	if w.meeting != nil {
+		meeting, until := *w.meeting, w.until
+		status.Meeting = &meeting
+		status.Until = &until
+	}
+	for _, o := range w.occurrences(now) {
+		if o.End.After(now) && len(status.Upcoming) < maxUpcoming {
+			status.Upcoming = append(status.Upcoming, o)
+		}
+	}
+	return status
+}
+
+// loop checks the calendar until stopped
+func (w *Watcher) loop() {
+	defer close(w.done)
+
+	for {
+		wait := w.check()
+		select {
+		case <-w.clock.After(wait):
+		case <-w.reload:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// check re-reads changed calendar files, starts or ends the meeting lighting and
+// returns how long to wait before checking again
+func (w *Watcher) check() time.Duration {
+	w.refresh()
+
+	now := w.clock.Now()
+	w.mu.Lock()
+	meeting, until, next := w.plan(now)
+	inMeeting := w.meeting != nil
+	if meeting != nil && inMeeting {
+		w.meeting, w.until = meeting, until
+	}
+	w.mu.Unlock()
+
+	switch {
+	case meeting != nil && !inMeeting:
+		w.startMeeting(meeting, until)
+	case meeting == nil && inMeeting:
+		log.Println("Calendar: Meeting over, putting the lights back")
+		w.endMeeting(w.engine.Default())
+	}
+
+	wait := PollInterval
+	if meeting != nil {
+		wait = min(wait, until.Sub(now))
+	}
+	if !next.IsZero() {
+		wait = min(wait, next.Sub(now))
+	}
+	return wait
+}
+
+// refresh re-reads the calendar files if any has been added, removed or changed
+func (w *Watcher) refresh() {
+	files, err := calendarFiles(w.config.Path)
+	if err != nil {
+		w.setLoadError(err)
+		return
+	}
+
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			w.setLoadError(fmt.Errorf("failed to read calendar: %w", err))
+			return
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	w.mu.Lock()
+	unchanged := w.modTimes != nil && sameModTimes(w.modTimes, modTimes)
+	w.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	var events []Event
+	for _, file := range files {
+		parsed, err := readFile(file, w.loc)
+		if err != nil {
+			w.setLoadError(err)
+			return
+		}
+		events = append(events, parsed...)
+	}
+
+	w.mu.Lock()
+	w.events = events
+	w.modTimes = modTimes
+	w.loadErr = nil
+	w.mu.Unlock()
+	log.Printf("Calendar: Read %d events from %d files", len(events), len(files))
+}
+
+// setLoadError records why the calendar couldn't be read, keeping the events read before
+func (w *Watcher) setLoadError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.loadErr == nil || w.loadErr.Error() != err.Error() {
+		log.Printf("Calendar: %v", err)
+	}
+	w.loadErr = err
+}
+
+// occurrences returns the matching meetings around now, in start order
+// w.mu must be held.
+func (w *Watcher) occurrences(now time.Time) []Occurrence {
+	var matching []Event
+	for _, e := range w.events {
+		if w.config.matches(e) {
+			matching = append(matching, e)
+		}
+	}
+	return Occurrences(matching, now.Add(-lookBehind), now.Add(lookAhead))
+}
+
+// plan works out the meeting whose lighting should be on at now and when it
+// goes back, or else when the next meeting lighting begins
+// w.mu must be held.
+func (w *Watcher) plan(now time.Time) (meeting *Occurrence, until, next time.Time) {
+	occurrences := w.occurrences(now)
+
+	for i := 0; i < len(occurrences); {
+		// Merge the meetings whose lighting periods overlap
+		from := occurrences[i].Start.Add(-w.config.Lead)
+		to := occurrences[i].End
+		current := occurrences[i]
+		j := i + 1
+		for ; j < len(occurrences) && !occurrences[j].Start.Add(-w.config.Lead).After(to); j++ {
+			if occurrences[j].End.After(to) {
+				to = occurrences[j].End
+			}
+			if !occurrences[j].Start.Add(-w.config.Lead).After(now) {
+				current = occurrences[j]
+			}
+		}
+
+		switch {
+		case !now.Before(from) && now.Before(to):
+			return &current, to, time.Time{}
+		case from.After(now):
+			return nil, time.Time{}, from
+		}
+		i = j
+	}
+	return nil, time.Time{}, time.Time{}
+}
+
+// startMeeting recalls the meeting scene, noting the lights it changes
+func (w *Watcher) startMeeting(meeting *Occurrence, until time.Time) {
+	log.Printf("Calendar: Meeting %q at %s, setting the lights", meeting.Summary, meeting.Start.In(w.loc).Format("15:04"))
+
+	data := w.meetingScene()
+	before := w.engine.Rig().Capture(lights.SelectionOf(data))
+
+	w.mu.Lock()
+	w.meeting, w.until, w.before = meeting, until, before
+	w.mu.Unlock()
+
+	if err := w.apply(data, w.engine.Default()); err != nil {
+		log.Printf("Calendar: Failed to set the meeting lights: %v", err)
+	}
+}
+
+// endMeeting puts the lights the meeting changed back as they were
+func (w *Watcher) endMeeting(t lights.Transition) {
+	w.mu.Lock()
+	before := w.before
+	w.meeting, w.until, w.before = nil, time.Time{}, nil
+	w.mu.Unlock()
+
+	if before == nil || before.IsEmpty() {
+		return
+	}
+	if err := w.apply(before, t); err != nil {
+		log.Printf("Calendar: Failed to put the lights back: %v", err)
+	}
+}
+
+// apply applies scene data through the transition engine, marking it as ours
+func (w *Watcher) apply(data *storage.SceneData, t lights.Transition) error {
+	w.mu.Lock()
+	w.applying = data
+	w.mu.Unlock()
+
+	err := w.engine.Apply(data, t)
+
+	w.mu.Lock()
+	w.applying = nil
+	w.mu.Unlock()
+	return err
+}
+
+// meetingScene returns the meeting scene with both video lights switched on
+func (w *Watcher) meetingScene() *storage.SceneData {
+	data := &storage.SceneData{}
+	if w.config.Scene != "" {
+		if loaded, err := w.loadScene(w.config.Scene); err != nil {
+			log.Printf("Calendar: %v; only switching the video lights on", err)
+		} else {
+			data = loaded
+		}
+	}
+
+	// The video lights keep the scene's brightness, or else their own
+	rig := w.engine.Rig()
+	for id, vl := range []*videolight.VideoLight{rig.VideoLight1, rig.VideoLight2} {
+		index := -1
+		for i := range data.VideoLights {
+			if data.VideoLights[i].ID == id {
+				index = i
+			}
+		}
+		if index < 0 {
+			_, brightness := vl.GetState()
+			data.VideoLights = append(data.VideoLights, storage.VideoLightState{ID: id, Brightness: brightness})
+			index = len(data.VideoLights) - 1
+		}
+		data.VideoLights[index].On = true
+		if data.VideoLights[index].Brightness == 0 {
+			data.VideoLights[index].Brightness = DefaultVideoBrightness
+		}
+	}
+	return data
+}
+
+// loadScene loads a library scene by name
+func (w *Watcher) loadScene(name string) (*storage.SceneData, error) {
+	info, err := w.scenes.FindSceneByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("%w: %q", storage.ErrSceneNotFound, name)
+	}
+	data, err := w.scenes.LoadScene(info.ID)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("scene %q has nothing saved", name)
+	}
+	return data, nil
+}
+
+// matches reports whether an event counts as a meeting
+func (c Config) matches(e Event) bool {
+	if e.AllDay || e.Cancelled || e.Free || !e.End.After(e.Start) {
+		return false
+	}
+
+	text := strings.ToLower(strings.Join(append([]string{e.Summary, e.Description, e.Location}, e.Categories...), "\n"))
+	for _, word := range c.Exclude {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" && strings.Contains(text, word) {
+			return false
+		}
+	}
+	if len(c.Keywords) == 0 {
+		return true
+	}
+	for _, word := range c.Keywords {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" && strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarFiles returns path if it is a file, or the .ics files in it if it is a directory
+func calendarFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".ics") {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// readFile parses one calendar file
+func readFile(path string, loc *time.Location) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	defer f.Close()
+
+	events, err := Parse(f, loc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return events, nil
+}
+
+// sameModTimes reports whether two sets of file modification times are the same
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, t := range a {
+		if other, ok := b[file]; !ok || !other.Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonNil returns an empty list in place of nil, for JSON
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,294 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+var start = time.Date(2026, 3, 2, 9, 50, 0, 0, time.UTC)
+
+// vevent returns a VEVENT from start to end (both "15:04" on the test day)
+func vevent(uid, summary, from, to string) string {
+	day := start.Format("20060102")
+	return "BEGIN:VEVENT\nUID:" + uid + "\nSUMMARY:" + summary +
+		"\nDTSTART:" + day + "T" + strings.ReplaceAll(from, ":", "") + "00Z" +
+		"\nDTEND:" + day + "T" + strings.ReplaceAll(to, ":", "") + "00Z\nEND:VEVENT\n"
+}
+
+// writeCalendar writes the events to path as a calendar, moving its modification
+// time on so the watcher notices
+func writeCalendar(t *testing.T, path string, events ...string) {
+	t.Helper()
+	ics := "BEGIN:VCALENDAR\nVERSION:2.0\n" + strings.Join(events, "") + "END:VCALENDAR\n"
+	if err := os.WriteFile(path, []byte(ics), 0o644); err != nil {
+		t.Fatalf("Failed to write calendar: %v", err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		modTime := info.ModTime().Add(time.Second)
+		_ = os.Chtimes(path, modTime, modTime)
+	}
+}
+
+// newTestWatcher creates a watcher on a fake clock with mock lights, the LED strip and
+// first video light switched on, and a "Meeting" scene setting the strip and video light 1
+func newTestWatcher(t *testing.T, config Config) (*Watcher, *lights.Rig, *clock.Fake) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, mock, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, mock, "test/vl2")
+	strip.SetColor(200, 100, 50)
+	vl1.TurnOn(40)
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+	id, err := db.CreateScene(storage.SceneInfo{Name: DefaultScene})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+	err = db.SaveScene(id, &storage.SceneData{
+		LEDStrip:    &storage.LEDStripState{Red: 10, Green: 20, Blue: 30},
+		VideoLights: []storage.VideoLightState{{ID: 0, On: true, Brightness: 60}},
+	})
+	if err != nil {
+		t.Fatalf("SaveScene failed: %v", err)
+	}
+
+	if config.Path == "" {
+		config.Path = filepath.Join(t.TempDir(), "calendar.ics")
+		writeCalendar(t, config.Path)
+	}
+	if config.Scene == "" {
+		config.Scene = DefaultScene
+	}
+
+	fake := clock.NewFake(start)
+	rig := lights.NewRig(strip, bar, vl1, vl2)
+	engine := lights.NewTransitionEngine(rig, fake)
+	t.Cleanup(engine.Stop)
+	w := NewWatcher(engine, db, fake, time.UTC, config)
+	t.Cleanup(w.Stop)
+	return w, rig, fake
+}
+
+// checkMeetingLights fails the test unless the meeting scene is on
+func checkMeetingLights(t *testing.T, rig *lights.Rig) {
+	t.Helper()
+	if r, g, b := rig.Strip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("LED strip = %d,%d,%d; want the meeting scene's 10,20,30", r, g, b)
+	}
+	if on, brightness := rig.VideoLight1.GetState(); !on || brightness != 60 {
+		t.Errorf("Video light 1 = %v at %d; want on at 60", on, brightness)
+	}
+	if on, brightness := rig.VideoLight2.GetState(); !on || brightness != DefaultVideoBrightness {
+		t.Errorf("Video light 2 = %v at %d; want on at %d", on, brightness, DefaultVideoBrightness)
+	}
+}
+
+// checkRestoredLights fails the test unless the lights are as newTestWatcher left them
+func checkRestoredLights(t *testing.T, rig *lights.Rig) {
+	t.Helper()
+	if r, g, b := rig.Strip.GetColor(); r != 200 || g != 100 || b != 50 {
+		t.Errorf("LED strip = %d,%d,%d; want it put back to 200,100,50", r, g, b)
+	}
+	if on, brightness := rig.VideoLight1.GetState(); !on || brightness != 40 {
+		t.Errorf("Video light 1 = %v at %d; want it put back on at 40", on, brightness)
+	}
+	if on, _ := rig.VideoLight2.GetState(); on {
+		t.Error("Video light 2 should be off again")
+	}
+}
+
+func TestMeetingLighting(t *testing.T) {
+	w, rig, fake := newTestWatcher(t, Config{Lead: 2 * time.Minute})
+	writeCalendar(t, w.config.Path,
+		vevent("a", "Sprint planning", "10:00", "10:30"),
+		vevent("b", "Design review", "10:30", "11:00"),
+		vevent("c", "Retro", "14:00", "15:00"),
+	)
+
+	if wait := w.check(); wait != time.Minute {
+		t.Errorf("Expected to poll again in a minute, got %v", wait)
+	}
+	if w.Status().Meeting != nil {
+		t.Fatal("No meeting should be under way at 09:50")
+	}
+
+	fake.Set(time.Date(2026, 3, 2, 9, 58, 0, 0, time.UTC))
+	w.check()
+	checkMeetingLights(t, rig)
+	status := w.Status()
+	if status.Meeting == nil || status.Meeting.Summary != "Sprint planning" {
+		t.Fatalf("Expected the sprint planning lighting, got %+v", status.Meeting)
+	}
+	if want := time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC); !status.Until.Equal(want) {
+		t.Errorf("Back-to-back meetings should run the lighting until %v, got %v", want, status.Until)
+	}
+
+	// The second meeting carries straight on
+	fake.Set(time.Date(2026, 3, 2, 10, 45, 0, 0, time.UTC))
+	if wait := w.check(); wait != time.Minute {
+		t.Errorf("Expected to poll again in a minute, got %v", wait)
+	}
+	checkMeetingLights(t, rig)
+	if status := w.Status(); status.Meeting == nil || status.Meeting.Summary != "Design review" {
+		t.Errorf("Expected the design review lighting, got %+v", status.Meeting)
+	}
+
+	fake.Set(time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC))
+	w.check()
+	checkRestoredLights(t, rig)
+	status = w.Status()
+	if status.Meeting != nil {
+		t.Errorf("The meeting lighting should be over, got %+v", status.Meeting)
+	}
+	if len(status.Upcoming) != 1 || status.Upcoming[0].Summary != "Retro" {
+		t.Errorf("Expected the retro to be upcoming, got %+v", status.Upcoming)
+	}
+}
+
+func TestMeetingLightingLeavesOtherChanges(t *testing.T) {
+	w, rig, fake := newTestWatcher(t, Config{})
+	writeCalendar(t, w.config.Path, vevent("a", "1:1", "09:50", "10:00"))
+
+	w.check()
+	checkMeetingLights(t, rig)
+
+	// The LED bar isn't in the meeting scene, so a change to it stays
+	rig.Bar.SetRGBW(1, 0, 255, 0, 0, 0)
+	fake.Set(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	w.check()
+	checkRestoredLights(t, rig)
+	if r, _, _, _, _ := rig.Bar.GetRGBW(1, 0); r != 255 {
+		t.Errorf("The LED bar change should be kept, got red %d", r)
+	}
+}
+
+func TestCalendarChangesArePickedUp(t *testing.T) {
+	dir := t.TempDir()
+	w, rig, fake := newTestWatcher(t, Config{Path: dir, Lead: time.Minute, Keywords: []string{"standup"}})
+
+	work := filepath.Join(dir, "work.ics")
+	writeCalendar(t, work, vevent("a", "Lunch", "09:50", "11:00"))
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a calendar"), 0o644); err != nil {
+		t.Fatalf("Failed to write notes: %v", err)
+	}
+	w.check()
+	if w.Status().Meeting != nil {
+		t.Fatal("Lunch doesn't mention the keyword")
+	}
+
+	team := filepath.Join(dir, "team.ics")
+	writeCalendar(t, team, vevent("b", "Daily Standup", "09:51", "10:05"))
+	fake.Advance(time.Second)
+	w.check()
+	checkMeetingLights(t, rig)
+
+	// The standup is cancelled
+	writeCalendar(t, team)
+	w.check()
+	checkRestoredLights(t, rig)
+
+	// A calendar that stops parsing keeps the events read before
+	writeCalendar(t, work, "BEGIN:VEVENT\nSUMMARY:broken\n")
+	w.check()
+	if status := w.Status(); status.Error == "" || len(w.events) != 1 {
+		t.Errorf("Expected a parse error and the lunch kept, got %+v with %d events", status, len(w.events))
+	}
+}
+
+func TestStopPutsLightsBack(t *testing.T) {
+	w, rig, _ := newTestWatcher(t, Config{})
+	writeCalendar(t, w.config.Path, vevent("a", "Interview", "09:45", "10:45"))
+
+	if err := w.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for w.Status().Meeting == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the meeting lighting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	checkMeetingLights(t, rig)
+
+	w.Stop()
+	checkRestoredLights(t, rig)
+}
+
+func TestStartValidation(t *testing.T) {
+	w, _, _ := newTestWatcher(t, Config{Lead: -time.Minute})
+	if err := w.Start(); err == nil {
+		t.Error("Expected an error for a negative lead time")
+	}
+
+	disabled := NewWatcher(nil, nil, clock.NewFake(start), time.UTC, Config{})
+	if err := disabled.Start(); err != nil {
+		t.Errorf("A watcher without a path should do nothing, got %v", err)
+	}
+	disabled.Stop()
+}
+
+func TestConfigMatches(t *testing.T) {
+	meeting := Event{
+		Summary:    "Quarterly planning",
+		Location:   "Zoom",
+		Categories: []string{"Work"},
+		Start:      start,
+		End:        start.Add(time.Hour),
+	}
+	allDay := meeting
+	allDay.AllDay = true
+	cancelled := meeting
+	cancelled.Cancelled = true
+	free := meeting
+	free.Free = true
+
+	tests := []struct {
+		name   string
+		config Config
+		event  Event
+		want   bool
+	}{
+		{"every event", Config{}, meeting, true},
+		{"keyword in summary", Config{Keywords: []string{"PLANNING"}}, meeting, true},
+		{"keyword in location", Config{Keywords: []string{"standup", "zoom"}}, meeting, true},
+		{"keyword in categories", Config{Keywords: []string{"work"}}, meeting, true},
+		{"no keyword", Config{Keywords: []string{"standup"}}, meeting, false},
+		{"excluded", Config{Keywords: []string{"planning"}, Exclude: []string{"quarterly"}}, meeting, false},
+		{"all day", Config{}, allDay, false},
+		{"cancelled", Config{}, cancelled, false},
+		{"free", Config{}, free, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.matches(tt.event); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
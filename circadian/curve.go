@@ -0,0 +1,229 @@
+package circadian
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Colour temperature limits accepted in a curve
+const (
+	MinKelvin = 1000
+	MaxKelvin = 10000
+)
+
+// DefaultCurve is used until a curve has been saved: warm and dim at the ends
+// of the day, cool and bright around midday
+func DefaultCurve() []storage.CurvePoint {
+	return []storage.CurvePoint{
+		{Time: "06:00", Kelvin: 2200, Brightness: 10},
+		{Time: "08:00", Kelvin: 3500, Brightness: 60},
+		{Time: "12:00", Kelvin: 5500, Brightness: 100},
+		{Time: "16:00", Kelvin: 5000, Brightness: 90},
+		{Time: "19:00", Kelvin: 3000, Brightness: 60},
+		{Time: "22:00", Kelvin: 2200, Brightness: 20},
+	}
+}
+
+// Setting is a colour temperature and brightness
+type Setting struct {
+	Kelvin     int `json:"kelvin"`
+	Brightness int `json:"brightness"` // percent
+}
+
+// Curve gives the setting for any time of day by interpolating between points,
+// wrapping from the last point of the day round to the first
+type Curve struct {
+	points []curvePoint
+}
+
+// curvePoint is a parsed CurvePoint
+type curvePoint struct {
+	minute     int // minutes after midnight
+	kelvin     int
+	brightness int
+}
+
+// ParseCurve checks and sorts curve points
+func ParseCurve(points []storage.CurvePoint) (*Curve, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("the curve needs at least one point")
+	}
+
+	c := &Curve{}
+	seen := make(map[int]bool)
+	for _, p := range points {
+		minute, err := parseMinute(p.Time)
+		if err != nil {
+			return nil, err
+		}
+		if seen[minute] {
+			return nil, fmt.Errorf("the curve has two points at %s", p.Time)
+		}
+		seen[minute] = true
+		if p.Kelvin < MinKelvin || p.Kelvin > MaxKelvin {
+			return nil, fmt.Errorf("colour temperature at %s must be between %dK and %dK, got %d", p.Time, MinKelvin, MaxKelvin, p.Kelvin)
+		}
+		if p.Brightness < 0 || p.Brightness > 100 {
+			return nil, fmt.Errorf("brightness at %s must be between 0 and 100, got %d", p.Time, p.Brightness)
+		}
+		c.points = append(c.points, curvePoint{minute: minute, kelvin: p.Kelvin, brightness: p.Brightness})
+	}
+
+	sort.Slice(c.points, func(i, j int) bool { return c.points[i].minute < c.points[j].minute })
+	return c, nil
+}
+
+// parseMinute parses "HH:MM" into minutes after midnight
+func parseMinute(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid minute in %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// At returns the setting for the wall-clock time of t
+func (c *Curve) At(t time.Time) Setting {
+	now := float64(t.Hour()*60+t.Minute()) + float64(t.Second())/60
+
+	// The points either side of now, wrapping round midnight
+	prev, next := c.points[len(c.points)-1], c.points[0]
+	prevMinute, nextMinute := float64(prev.minute-1440), float64(next.minute)
+	for i, p := range c.points {
+		if float64(p.minute) > now {
+			next, nextMinute = p, float64(p.minute)
+			if i > 0 {
+				prev, prevMinute = c.points[i-1], float64(c.points[i-1].minute)
+			}
+			break
+		}
+		prev, prevMinute = p, float64(p.minute)
+		next, nextMinute = c.points[0], float64(c.points[0].minute+1440)
+	}
+
+	progress := 0.0
+	if span := nextMinute - prevMinute; span > 0 {
+		progress = (now - prevMinute) / span
+	}
+	return Setting{
+		Kelvin:     lerp(prev.kelvin, next.kelvin, progress),
+		Brightness: lerp(prev.brightness, next.brightness, progress),
+	}
+}
+
+// lerp interpolates between two values and rounds to the nearest integer
+func lerp(from, to int, progress float64) int {
+	return from + int(math.Round(float64(to-from)*progress))
+}
+
+// Sample is one point of a curve preview
+type Sample struct {
+	Time string `json:"time"`
+	Setting
+	Color string `json:"color"` // the colour at full brightness, as #rrggbb
+}
+
+// Preview samples the curve across a day
+func (c *Curve) Preview(step time.Duration) []Sample {
+	var samples []Sample
+	day := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for at := day; at.Before(day.Add(24 * time.Hour)); at = at.Add(step) {
+		setting := c.At(at)
+		rgb := KelvinToRGB(setting.Kelvin)
+		samples = append(samples, Sample{
+			Time:    at.Format("15:04"),
+			Setting: setting,
+			Color:   fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]),
+		})
+	}
+	return samples
+}
+
+// KelvinToRGB approximates the colour of a black body at a temperature
+// This is Tanner Helland's fit, good from 1000K to 40000K.
+func KelvinToRGB(kelvin int) [3]int {
+	temp := float64(kelvin) / 100
+
+	var r, g, b float64
+	if temp <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(temp) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(temp-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(temp-60, -0.0755148492)
+	}
+	switch {
+	case temp >= 66:
+		b = 255
+	case temp <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(temp-10) - 305.0447927307
+	}
+
+	return [3]int{clampByte(r), clampByte(g), clampByte(b)}
+}
+
+// clampByte rounds and limits a value to 0-255
+func clampByte(v float64) int {
+	return int(math.Round(math.Max(0, math.Min(255, v))))
+}
+
+// scale applies the brightness to a 0-255 value
+func (s Setting) scale(v int) int {
+	return int(math.Round(float64(v) * float64(s.Brightness) / 100))
+}
+
+// StripColor returns the LED strip colour for the setting
+func (s Setting) StripColor() [3]int {
+	rgb := KelvinToRGB(s.Kelvin)
+	return [3]int{s.scale(rgb[0]), s.scale(rgb[1]), s.scale(rgb[2])}
+}
+
+// RGBW returns the value of an RGBW LED for the setting
+// The part of the colour the three channels share is moved to the white channel.
+func (s Setting) RGBW() [4]int {
+	rgb := KelvinToRGB(s.Kelvin)
+	w := min(rgb[0], rgb[1], rgb[2])
+	return [4]int{s.scale(rgb[0] - w), s.scale(rgb[1] - w), s.scale(rgb[2] - w), s.scale(w)}
+}
+
+// White returns the level of the LED bar's white LEDs for the setting
+// They can't change colour, so they fade out as the temperature warms, in step
+// with the white channel of the RGBW LEDs.
+func (s Setting) White() int {
+	return s.RGBW()[3]
+}
+
+// BarChannels returns the LED bar channels for the setting
+// Channels that aren't LEDs are copied from current.
+func (s Setting) BarChannels(current []int) []int {
+	channels := append([]int(nil), current...)
+	rgbw := s.RGBW()
+	white := s.White()
+
+	for section := 1; section <= 2; section++ {
+		for i, ch := range ledbar.RGBWChannels(section) {
+			channels[ch] = rgbw[i%4]
+		}
+		for _, ch := range ledbar.WhiteChannels(section) {
+			channels[ch] = white
+		}
+	}
+	return channels
+}
@@ -0,0 +1,159 @@
+package circadian
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/storage"
+)
+
+func TestParseCurve(t *testing.T) {
+	tests := []struct {
+		name    string
+		points  []storage.CurvePoint
+		wantErr bool
+	}{
+		{"default", DefaultCurve(), false},
+		{"single point", []storage.CurvePoint{{Time: "12:00", Kelvin: 4000, Brightness: 50}}, false},
+		{"empty", nil, true},
+		{"bad time", []storage.CurvePoint{{Time: "noon", Kelvin: 4000, Brightness: 50}}, true},
+		{"duplicate time", []storage.CurvePoint{{Time: "12:00", Kelvin: 4000}, {Time: "12:00", Kelvin: 5000}}, true},
+		{"too warm", []storage.CurvePoint{{Time: "12:00", Kelvin: 500, Brightness: 50}}, true},
+		{"too bright", []storage.CurvePoint{{Time: "12:00", Kelvin: 4000, Brightness: 101}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCurve(tt.points)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCurve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCurveAt(t *testing.T) {
+	// Points out of order to check they are sorted
+	curve, err := ParseCurve([]storage.CurvePoint{
+		{Time: "18:00", Kelvin: 3000, Brightness: 40},
+		{Time: "06:00", Kelvin: 3000, Brightness: 40},
+		{Time: "12:00", Kelvin: 6000, Brightness: 100},
+	})
+	if err != nil {
+		t.Fatalf("ParseCurve failed: %v", err)
+	}
+
+	tests := []struct {
+		at   string
+		want Setting
+	}{
+		{"06:00", Setting{3000, 40}},
+		{"09:00", Setting{4500, 70}},
+		{"12:00", Setting{6000, 100}},
+		{"15:00", Setting{4500, 70}},
+		{"00:00", Setting{3000, 40}}, // wraps from 18:00 round to 06:00
+		{"23:59", Setting{3000, 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.at, func(t *testing.T) {
+			at, _ := time.Parse("15:04", tt.at)
+			if got := curve.At(at); got != tt.want {
+				t.Errorf("At(%s) = %+v, want %+v", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	// Across midnight the values are interpolated too
+	wrap, _ := ParseCurve([]storage.CurvePoint{
+		{Time: "22:00", Kelvin: 2000, Brightness: 0},
+		{Time: "02:00", Kelvin: 4000, Brightness: 100},
+	})
+	midnight, _ := time.Parse("15:04", "00:00")
+	if got := wrap.At(midnight); got != (Setting{3000, 50}) {
+		t.Errorf("At(00:00) = %+v, want halfway", got)
+	}
+}
+
+func TestColours(t *testing.T) {
+	// Around 6600K the black body is close to white
+	if rgb := KelvinToRGB(6600); rgb[0] < 250 || rgb[1] < 240 || rgb[2] < 240 {
+		t.Errorf("KelvinToRGB(6600) = %v, want close to white", rgb)
+	}
+	// Warm light has no blue
+	if rgb := KelvinToRGB(1800); rgb[0] != 255 || rgb[2] != 0 {
+		t.Errorf("KelvinToRGB(1800) = %v, want red without blue", rgb)
+	}
+
+	warm := Setting{Kelvin: 2700, Brightness: 100}
+	cool := Setting{Kelvin: 6500, Brightness: 100}
+	if warm.White() >= cool.White() {
+		t.Errorf("Expected the white LEDs to dim as it warms: %d at 2700K, %d at 6500K", warm.White(), cool.White())
+	}
+
+	rgbw := warm.RGBW()
+	if rgbw[0] == 0 || rgbw[2] != 0 {
+		t.Errorf("RGBW() = %v, want the shared part moved to white", rgbw)
+	}
+
+	half := Setting{Kelvin: 2700, Brightness: 50}.StripColor()
+	full := warm.StripColor()
+	if half[0] != (full[0]+1)/2 && half[0] != full[0]/2 {
+		t.Errorf("StripColor() at 50%% = %v, want half of %v", half, full)
+	}
+}
+
+func TestBarChannels(t *testing.T) {
+	current := make([]int, 77)
+	for i := range current {
+		current[i] = 7
+	}
+
+	setting := Setting{Kelvin: 4000, Brightness: 80}
+	channels := setting.BarChannels(current)
+	if current[0] != 7 {
+		t.Fatal("BarChannels must not modify its argument")
+	}
+
+	rgbw := setting.RGBW()
+	for section := 1; section <= 2; section++ {
+		for i, ch := range ledbar.RGBWChannels(section) {
+			if channels[ch] != rgbw[i%4] {
+				t.Errorf("Channel %d = %d, want %d", ch, channels[ch], rgbw[i%4])
+			}
+		}
+		for _, ch := range ledbar.WhiteChannels(section) {
+			if channels[ch] != setting.White() {
+				t.Errorf("White channel %d = %d, want %d", ch, channels[ch], setting.White())
+			}
+		}
+	}
+
+	// The unused channels between the sections are left alone
+	used := make(map[int]bool)
+	for section := 1; section <= 2; section++ {
+		for _, ch := range append(ledbar.RGBWChannels(section), ledbar.WhiteChannels(section)...) {
+			used[ch] = true
+		}
+	}
+	for ch, v := range channels {
+		if !used[ch] && v != 7 {
+			t.Errorf("Unused channel %d changed to %d", ch, v)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	curve, _ := ParseCurve(DefaultCurve())
+	samples := curve.Preview(time.Hour)
+	if len(samples) != 24 {
+		t.Fatalf("Expected 24 samples, got %d", len(samples))
+	}
+	if samples[12].Time != "12:00" || samples[12].Kelvin != 5500 || samples[12].Brightness != 100 {
+		t.Errorf("Unexpected midday sample: %+v", samples[12])
+	}
+	if len(samples[0].Color) != 7 || samples[0].Color[0] != '#' {
+		t.Errorf("Unexpected colour %q", samples[0].Color)
+	}
+}
@@ -0,0 +1,310 @@
+package circadian
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// UpdateInterval is how often the lights are moved along the curve
+const UpdateInterval = 30 * time.Second
+
+// Device is a light the circadian mode can drive
+type Device string
+
+const (
+	DeviceLEDStrip Device = "ledStrip"
+	DeviceLEDBar   Device = "ledBar"
+)
+
+// Devices lists the devices in display order
+var Devices = []Device{DeviceLEDBar, DeviceLEDStrip}
+
+// DeviceStatus reports whether a device follows the curve
+type DeviceStatus struct {
+	Device  Device `json:"device"`
+	Enabled bool   `json:"enabled"`
+	Paused  bool   `json:"paused"` // changed by hand since the last scene recall
+}
+
+// Status is the current point on the curve and the state of each device
+type Status struct {
+	Setting
+	Devices []DeviceStatus `json:"devices"`
+}
+
+// Mode keeps opted-in lights on a colour temperature and brightness curve
+//
+// Every UpdateInterval the enabled devices are set to the curve's value for
+// the time of day. A device that is changed by anything else (a slider, an
+// effect, a sequence) is paused, so manual changes stick, until the next scene
+// recall that includes it.
+type Mode struct {
+	rig   *lights.Rig
+	store storage.CircadianStore
+	clock clock.Clock
+	loc   *time.Location
+
+	mu       sync.Mutex
+	settings storage.CircadianSettings
+	curve    *Curve
+	devices  map[Device]*deviceState
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// deviceState tracks what the mode last wrote to a device
+type deviceState struct {
+	paused bool
+	last   []int // nil until the mode has written to the device
+}
+
+// NewMode creates a circadian mode evaluating the curve in loc
+func NewMode(rig *lights.Rig, store storage.CircadianStore, clk clock.Clock, loc *time.Location) *Mode {
+	curve, _ := ParseCurve(DefaultCurve())
+	return &Mode{
+		rig:      rig,
+		store:    store,
+		clock:    clk,
+		loc:      loc,
+		settings: storage.CircadianSettings{Curve: DefaultCurve()},
+		curve:    curve,
+		devices: map[Device]*deviceState{
+			DeviceLEDStrip: {},
+			DeviceLEDBar:   {},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Start loads the saved settings and starts following the curve
+func (m *Mode) Start() error {
+	saved, err := m.store.LoadCircadian()
+	if err != nil {
+		return err
+	}
+	if saved != nil {
+		curve, err := ParseCurve(saved.Curve)
+		if err != nil {
+			return fmt.Errorf("saved circadian curve is invalid: %w", err)
+		}
+		m.mu.Lock()
+		m.settings = *saved
+		m.curve = curve
+		m.mu.Unlock()
+	}
+
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.loop()
+	return nil
+}
+
+// Stop stops following the curve, leaving the lights where they are
+func (m *Mode) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+// Settings returns the current settings
+func (m *Mode) Settings() storage.CircadianSettings {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings := m.settings
+	settings.Curve = append([]storage.CurvePoint(nil), m.settings.Curve...)
+	return settings
+}
+
+// Configure checks, saves and applies new settings
+// Devices that are newly enabled start following the curve straight away.
+func (m *Mode) Configure(settings storage.CircadianSettings) error {
+	curve, err := ParseCurve(settings.Curve)
+	if err != nil {
+		return err
+	}
+	if err := m.store.SaveCircadian(settings); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	for device, d := range m.devices {
+		if !enabled(m.settings, device) && enabled(settings, device) {
+			d.paused = false
+			d.last = nil
+		}
+	}
+	m.settings = settings
+	m.curve = curve
+	m.mu.Unlock()
+
+	log.Printf("Circadian: Settings updated (strip=%v, bar=%v)", settings.LEDStrip, settings.LEDBar)
+	m.signal()
+	return nil
+}
+
+// Resume puts paused devices back on the curve
+func (m *Mode) Resume() {
+	m.mu.Lock()
+	for _, d := range m.devices {
+		d.paused = false
+		d.last = nil
+	}
+	m.mu.Unlock()
+
+	m.signal()
+}
+
+// SceneRecalled puts the paused devices a scene includes back on the curve from
+// the next update, leaving the scene's transition to run first
+// Pass it to TransitionEngine.OnApply.
+func (m *Mode) SceneRecalled(data *storage.SceneData) {
+	var devices []Device
+	if data.LEDStrip != nil {
+		devices = append(devices, DeviceLEDStrip)
+	}
+	if len(data.LEDBarLEDs) > 0 {
+		devices = append(devices, DeviceLEDBar)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, device := range devices {
+		d := m.devices[device]
+		if d.paused {
+			log.Printf("Circadian: Resuming %s after a scene recall", device)
+		}
+		d.paused = false
+		d.last = nil
+	}
+}
+
+// Status returns the current point on the curve and the state of each device
+func (m *Mode) Status() Status {
+	now := m.clock.Now().In(m.loc)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := Status{Setting: m.curve.At(now)}
+	for _, device := range Devices {
+		status.Devices = append(status.Devices, DeviceStatus{
+			Device:  device,
+			Enabled: enabled(m.settings, device),
+			Paused:  m.devices[device].paused,
+		})
+	}
+	return status
+}
+
+// enabled reports whether settings opt a device in
+func enabled(settings storage.CircadianSettings, device Device) bool {
+	if device == DeviceLEDStrip {
+		return settings.LEDStrip
+	}
+	return settings.LEDBar
+}
+
+// signal asks the loop to update now without blocking
+func (m *Mode) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop updates the lights at every interval and whenever the settings change
+func (m *Mode) loop() {
+	defer close(m.done)
+
+	m.update()
+	for {
+		select {
+		case <-m.clock.After(UpdateInterval):
+		case <-m.wake:
+		case <-m.stop:
+			return
+		}
+		m.update()
+	}
+}
+
+// update moves the enabled devices to the curve's current setting
+func (m *Mode) update() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	setting := m.curve.At(m.clock.Now().In(m.loc))
+	for _, device := range Devices {
+		d := m.devices[device]
+		if !enabled(m.settings, device) || d.paused {
+			continue
+		}
+
+		current := m.read(device)
+		if d.last != nil && !equal(current, d.last) {
+			log.Printf("Circadian: %s changed elsewhere, pausing until the next scene recall", device)
+			d.paused = true
+			continue
+		}
+
+		target := m.target(device, setting, current)
+		if !equal(target, current) {
+			if err := m.write(device, target); err != nil {
+				log.Printf("Circadian: Failed to update %s: %v", device, err)
+				continue
+			}
+		}
+		// Read back so values the driver adjusts don't look like changes
+		d.last = m.read(device)
+	}
+}
+
+// read returns a device's current values
+func (m *Mode) read(device Device) []int {
+	if device == DeviceLEDStrip {
+		r, g, b := m.rig.Strip.GetColor()
+		return []int{r, g, b}
+	}
+	return m.rig.Bar.GetChannels()
+}
+
+// target returns a device's values for a setting
+func (m *Mode) target(device Device, setting Setting, current []int) []int {
+	if device == DeviceLEDStrip {
+		rgb := setting.StripColor()
+		return rgb[:]
+	}
+	return setting.BarChannels(current)
+}
+
+// write sets and saves a device's values
+func (m *Mode) write(device Device, values []int) error {
+	if device == DeviceLEDStrip {
+		return m.rig.Strip.SetColor(values[0], values[1], values[2])
+	}
+	return m.rig.Bar.SetChannels(values)
+}
+
+// equal reports whether two value arrays are the same
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
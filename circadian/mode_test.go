@@ -0,0 +1,147 @@
+package circadian
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// newTestMode creates a circadian mode on a fake clock at noon with mock lights
+func newTestMode(t *testing.T) (*Mode, *lights.Rig, *clock.Fake, *storage.Database) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, mock, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, mock, "test/vl2")
+	rig := lights.NewRig(strip, bar, vl1, vl2)
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	fake := clock.NewFake(time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	return NewMode(rig, db, fake, time.UTC), rig, fake, db
+}
+
+// flatCurve holds one setting all day
+func flatCurve(kelvin, brightness int) []storage.CurvePoint {
+	return []storage.CurvePoint{{Time: "00:00", Kelvin: kelvin, Brightness: brightness}}
+}
+
+func TestModeFollowsCurve(t *testing.T) {
+	mode, rig, fake, db := newTestMode(t)
+
+	if err := mode.Configure(storage.CircadianSettings{LEDBar: true, Curve: DefaultCurve()}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	mode.update()
+
+	noon := Setting{Kelvin: 5500, Brightness: 100}
+	if got := rig.Bar.GetChannels(); !equal(got, noon.BarChannels(got)) {
+		t.Errorf("LED bar not on the curve: %v", got)
+	}
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("LED strip isn't opted in but changed to %d,%d,%d", r, g, b)
+	}
+
+	// Later in the day the bar moves along the curve
+	fake.Advance(10 * time.Hour)
+	mode.update()
+	evening := Setting{Kelvin: 2200, Brightness: 20}
+	if got := rig.Bar.GetChannels(); !equal(got, evening.BarChannels(got)) {
+		t.Errorf("LED bar not moved along the curve: %v", got)
+	}
+
+	// Settings are saved
+	saved, err := db.LoadCircadian()
+	if err != nil || saved == nil || !saved.LEDBar || saved.LEDStrip {
+		t.Errorf("Settings not saved: %+v, %v", saved, err)
+	}
+
+	if err := mode.Configure(storage.CircadianSettings{LEDBar: true}); err == nil {
+		t.Error("Expected an error for an empty curve")
+	}
+}
+
+func TestManualChangePausesUntilSceneRecall(t *testing.T) {
+	mode, rig, _, _ := newTestMode(t)
+
+	mode.Configure(storage.CircadianSettings{LEDStrip: true, LEDBar: true, Curve: flatCurve(4000, 50)})
+	mode.update()
+	want := Setting{Kelvin: 4000, Brightness: 50}.StripColor()
+
+	// Someone drags the strip's red slider
+	rig.Strip.SetColor(10, 20, 30)
+	mode.update()
+
+	if r, g, b := rig.Strip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Manual change overridden: %d,%d,%d", r, g, b)
+	}
+	status := mode.Status()
+	if !status.Devices[1].Paused || status.Devices[0].Paused {
+		t.Errorf("Expected only the strip to be paused: %+v", status.Devices)
+	}
+
+	// A scene that doesn't include the strip leaves it paused
+	mode.SceneRecalled(&storage.SceneData{VideoLights: []storage.VideoLightState{{ID: 0, On: true}}})
+	mode.update()
+	if r, _, _ := rig.Strip.GetColor(); r != 10 {
+		t.Error("Strip resumed by a scene that doesn't include it")
+	}
+
+	// One that does puts it back on the curve
+	mode.SceneRecalled(&storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 255}})
+	rig.Strip.SetColor(255, 0, 0)
+	mode.update()
+	if r, g, b := rig.Strip.GetColor(); [3]int{r, g, b} != want {
+		t.Errorf("Strip = %d,%d,%d after the scene recall, want %v", r, g, b, want)
+	}
+	if mode.Status().Devices[1].Paused {
+		t.Error("Expected the strip to be resumed")
+	}
+}
+
+func TestModeLoop(t *testing.T) {
+	mode, rig, fake, db := newTestMode(t)
+
+	if err := db.SaveCircadian(storage.CircadianSettings{LEDStrip: true, Curve: []storage.CurvePoint{
+		{Time: "12:00", Kelvin: 6500, Brightness: 100},
+		{Time: "12:10", Kelvin: 6500, Brightness: 0},
+	}}); err != nil {
+		t.Fatalf("SaveCircadian failed: %v", err)
+	}
+	if err := mode.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer mode.Stop()
+
+	// Applied as soon as it starts, then again every interval
+	fake.BlockUntil(1)
+	if r, _, _ := rig.Strip.GetColor(); r != 255 {
+		t.Errorf("Expected full brightness at start, got red %d", r)
+	}
+
+	fake.Advance(5 * time.Minute)
+	fake.BlockUntil(1)
+	if r, _, _ := rig.Strip.GetColor(); r < 120 || r > 135 {
+		t.Errorf("Expected half brightness after 5 minutes, got red %d", r)
+	}
+}
@@ -0,0 +1,177 @@
+// Package client talks to a running office lights web server
+//
+// It covers the endpoints described by the server's OpenAPI document at
+// /api/openapi.json: the whole state at /api, each light on its own, the
+// scene library and the undo history. Light state uses the web package's
+// types, so a script can read, change and write back a web.State without
+// building JSON by hand.
+//
+//	c := client.New("http://lights.local:8080", os.Getenv("LIGHTS_TOKEN"))
+//	state, err := c.State(ctx)
+//	state.LEDStrip = web.LEDStripState{R: 255}
+//	_, err = c.SetState(ctx, state)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kevin/office_lights/history"
+	"github.com/kevin/office_lights/web"
+)
+
+// DefaultTimeout is how long a request may take with the default HTTP client
+const DefaultTimeout = 30 * time.Second
+
+// ErrStateChanged reports an update refused because the state changed since
+// the revision given with IfMatch
+var ErrStateChanged = errors.New("state changed since the given revision")
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int
+	Message    string // the server's "error" message, or the status text
+}
+
+// Error returns the status and message
+func (e *Error) Error() string {
+	return fmt.Sprintf("office lights: %d %s", e.StatusCode, e.Message)
+}
+
+// Is lets errors.Is match a 412 response with ErrStateChanged, and a refused
+// undo or redo with history.ErrNothingToUndo or history.ErrNothingToRedo
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrStateChanged:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case history.ErrNothingToUndo, history.ErrNothingToRedo:
+		return e.StatusCode == http.StatusConflict && e.Message == target.Error()
+	}
+	return false
+}
+
+// Client calls the web API of one office lights server
+type Client struct {
+	baseURL string
+	token   string
+	ifMatch string
+
+	// HTTPClient sends the requests; it can be replaced, for example to trust a self-signed certificate
+	HTTPClient *http.Client
+}
+
+// New creates a client for the server at baseURL ("http://host:8080"),
+// authenticating with an API token unless token is empty
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// IfMatch returns a copy of the client whose updates only apply if the state
+// is still at revision, as returned by StateRevision; otherwise they fail with
+// ErrStateChanged
+func (c *Client) IfMatch(revision string) *Client {
+	conditional := *c
+	conditional.ifMatch = revision
+	return &conditional
+}
+
+// State returns every light
+func (c *Client) State(ctx context.Context) (*web.State, error) {
+	var state web.State
+	if _, err := c.do(ctx, "GET", "/api", nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// StateRevision returns every light and the state's revision, for IfMatch
+func (c *Client) StateRevision(ctx context.Context) (*web.State, string, error) {
+	var state web.State
+	revision, err := c.do(ctx, "GET", "/api", nil, &state)
+	if err != nil {
+		return nil, "", err
+	}
+	return &state, revision, nil
+}
+
+// SetState sets every light, crossfading if the state has a Transition, and
+// returns the state once applied
+func (c *Client) SetState(ctx context.Context, state *web.State) (*web.State, error) {
+	var updated web.State
+	if _, err := c.do(ctx, "POST", "/api", state, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// do sends a request with an optional JSON body, decodes a JSON response into
+// out unless it is nil, and returns the response's ETag
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) (string, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.ifMatch != "" && method != "GET" {
+		req.Header.Set("If-Match", c.ifMatch)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", responseError(resp, data)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return "", fmt.Errorf("office lights: invalid response to %s %s: %w", method, path, err)
+		}
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// responseError reads the server's {"error": ...} body, falling back on the status
+func responseError(resp *http.Response, data []byte) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	message := http.StatusText(resp.StatusCode)
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		message = body.Error
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: message}
+}
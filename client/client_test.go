@@ -0,0 +1,331 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/history"
+	"github.com/kevin/office_lights/lights"
+	officemqtt "github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+	"github.com/kevin/office_lights/web"
+)
+
+const token = "t0ken"
+
+// request is a method and path the test server was sent
+type request struct {
+	method string
+	path   string
+}
+
+// server is a real web server with mock lights, recording the requests it gets
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []request
+}
+
+func newServer(t *testing.T) (*server, *Client) {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	hub := events.NewHub(officemqtt.NewMockPublisher())
+	strip := ledstrip.NewLEDStrip(hub, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, hub, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, hub, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, hub, "test/vl2")
+	transitions := lights.NewTransitionEngine(lights.NewRig(strip, bar, vl1, vl2), clock.Real{})
+	t.Cleanup(transitions.Stop)
+	undoHistory := history.NewHistory(transitions, db, clock.Real{}, history.DefaultLimit)
+	if err := undoHistory.Start(hub); err != nil {
+		t.Fatalf("Failed to start history: %v", err)
+	}
+	t.Cleanup(undoHistory.Stop)
+
+	auth := web.AuthConfig{Tokens: []web.Credential{{Name: "test", Secret: token, Role: web.RoleAdmin}}}
+	handler := web.NewServer(web.Dependencies{
+		LEDStrip:    strip,
+		LEDBar:      bar,
+		VideoLight1: vl1,
+		VideoLight2: vl2,
+		Scenes:      db,
+		Database:    db,
+		Transitions: transitions,
+		History:     undoHistory,
+		Hub:         hub,
+		Auth:        auth,
+	}).Handler()
+
+	s := &server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, request{r.Method, r.URL.Path})
+		s.mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s, New(s.URL+"/", token)
+}
+
+func TestState(t *testing.T) {
+	s, c := newServer(t)
+	ctx := context.Background()
+
+	state, revision, err := c.StateRevision(ctx)
+	if err != nil {
+		t.Fatalf("StateRevision failed: %v", err)
+	}
+	if revision == "" || len(state.LEDBar.Section1.RGBW) != 6 || len(state.LEDBar.Section2.White) != 13 {
+		t.Fatalf("Unexpected state %+v (revision %q)", state, revision)
+	}
+
+	state.LEDStrip = web.LEDStripState{R: 255, G: 128}
+	state.VideoLight2 = web.VideoLightState{On: true, Brightness: 40}
+	updated, err := c.SetState(ctx, state)
+	if err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	if updated.LEDStrip != state.LEDStrip || updated.VideoLight2 != state.VideoLight2 {
+		t.Errorf("SetState returned %+v", updated)
+	}
+
+	// The revision read before the change is out of date now
+	_, err = c.IfMatch(revision).SetState(ctx, state)
+	if !errors.Is(err, ErrStateChanged) {
+		t.Errorf("Expected ErrStateChanged, got %v", err)
+	}
+
+	state.VideoLight1.Brightness = 101
+	var apiErr *Error
+	if _, err := c.SetState(ctx, state); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || !strings.Contains(apiErr.Message, "brightness") {
+		t.Errorf("Expected a 400 about brightness, got %v", err)
+	}
+
+	checkSpec(t, s)
+}
+
+func TestDevices(t *testing.T) {
+	s, c := newServer(t)
+	ctx := context.Background()
+
+	if strip, err := c.SetLEDStrip(ctx, 0, web.LEDStripState{B: 200}); err != nil || strip.B != 200 {
+		t.Errorf("SetLEDStrip = %+v, %v", strip, err)
+	}
+	if strip, err := c.LEDStrip(ctx, 0); err != nil || strip.B != 200 {
+		t.Errorf("LEDStrip = %+v, %v", strip, err)
+	}
+
+	if led, err := c.SetLEDBarRGBW(ctx, 0, 2, 5, web.RGBW{R: 1, G: 2, B: 3, W: 4}); err != nil || *led != (web.RGBW{R: 1, G: 2, B: 3, W: 4}) {
+		t.Errorf("SetLEDBarRGBW = %+v, %v", led, err)
+	}
+	if value, err := c.SetLEDBarWhite(ctx, 0, 1, 12, 77); err != nil || value != 77 {
+		t.Errorf("SetLEDBarWhite = %d, %v", value, err)
+	}
+	section, err := c.LEDBarSection(ctx, 0, 2)
+	if err != nil || section.RGBW[5].W != 4 {
+		t.Fatalf("LEDBarSection = %+v, %v", section, err)
+	}
+	section.White[0] = 9
+	if section, err = c.SetLEDBarSection(ctx, 0, 2, *section); err != nil || section.White[0] != 9 {
+		t.Errorf("SetLEDBarSection = %+v, %v", section, err)
+	}
+	bar, err := c.LEDBar(ctx, 0)
+	if err != nil || bar.Section1.White[12] != 77 || bar.Section2.White[0] != 9 {
+		t.Fatalf("LEDBar = %+v, %v", bar, err)
+	}
+	if _, err := c.SetLEDBar(ctx, 0, web.LEDBarState{}); err == nil {
+		t.Error("Expected an LED bar without LEDs to be refused")
+	}
+
+	if light, err := c.SetVideoLight(ctx, 2, web.VideoLightState{On: true, Brightness: 60}); err != nil || !light.On || light.Brightness != 60 {
+		t.Errorf("SetVideoLight = %+v, %v", light, err)
+	}
+	if light, err := c.VideoLight(ctx, 2); err != nil || light.Brightness != 60 {
+		t.Errorf("VideoLight = %+v, %v", light, err)
+	}
+
+	var apiErr *Error
+	if _, err := c.VideoLight(ctx, 3); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for video light 3, got %v", err)
+	}
+
+	checkSpec(t, s)
+}
+
+func TestScenes(t *testing.T) {
+	s, c := newServer(t)
+	ctx := context.Background()
+
+	if _, err := c.SetLEDStrip(ctx, 0, web.LEDStripState{R: 10, G: 20, B: 30}); err != nil {
+		t.Fatalf("SetLEDStrip failed: %v", err)
+	}
+	scene, err := c.CreateScene(ctx, NewScene{Name: "Strip", BgColor: "#ff8800", Lights: []string{"ledStrip"}})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+	if scene.BgColor != "#FF8800" || scene.Devices == nil || *scene.Devices.LEDStrip != (storage.LEDStripState{Red: 10, Green: 20, Blue: 30}) {
+		t.Errorf("Unexpected scene %+v", scene)
+	}
+
+	name := "Warm Strip"
+	tags := []string{"evening"}
+	if scene, err = c.UpdateScene(ctx, scene.ID, SceneUpdate{Name: &name, Tags: &tags}); err != nil || scene.Name != name || scene.BgColor != "#FF8800" {
+		t.Errorf("UpdateScene = %+v, %v", scene, err)
+	}
+
+	if _, err := c.SetLEDStrip(ctx, 0, web.LEDStripState{}); err != nil {
+		t.Fatalf("SetLEDStrip failed: %v", err)
+	}
+	if _, err := c.RecallScene(ctx, scene.ID, &lights.TransitionSpec{Duration: 0}); err != nil {
+		t.Fatalf("RecallScene failed: %v", err)
+	}
+	if strip, err := c.LEDStrip(ctx, 0); err != nil || *strip != (web.LEDStripState{R: 10, G: 20, B: 30}) {
+		t.Errorf("After recall the strip is %+v, %v", strip, err)
+	}
+
+	id, err := c.CaptureScene(ctx, "Everything")
+	if err != nil {
+		t.Fatalf("CaptureScene failed: %v", err)
+	}
+	if again, err := c.CaptureScene(ctx, "Everything", "videoLight1"); err != nil || again != id {
+		t.Errorf("Capturing again gave scene %d (%v), want %d", again, err, id)
+	}
+
+	scenes, err := c.Scenes(ctx)
+	if err != nil || len(scenes) != 2 {
+		t.Fatalf("Scenes = %+v, %v", scenes, err)
+	}
+	if err := c.SetShortcut(ctx, 2, id); err != nil {
+		t.Fatalf("SetShortcut failed: %v", err)
+	}
+	if shortcuts, err := c.Shortcuts(ctx); err != nil || len(shortcuts) != 4 || shortcuts[1].SceneID == nil || *shortcuts[1].SceneID != id {
+		t.Errorf("Shortcuts = %+v, %v", shortcuts, err)
+	}
+	if err := c.ClearShortcut(ctx, 2); err != nil {
+		t.Errorf("ClearShortcut failed: %v", err)
+	}
+	if err := c.DeleteScene(ctx, id); err != nil {
+		t.Fatalf("DeleteScene failed: %v", err)
+	}
+	if _, err := c.Scene(ctx, id); err == nil {
+		t.Error("Expected the deleted scene to be gone")
+	}
+
+	checkSpec(t, s)
+}
+
+func TestUndoRedo(t *testing.T) {
+	s, c := newServer(t)
+	ctx := context.Background()
+
+	if _, err := c.Undo(ctx); !errors.Is(err, history.ErrNothingToUndo) {
+		t.Errorf("Expected ErrNothingToUndo, got %v", err)
+	}
+
+	// The change hasn't settled into the history yet, but undo still takes it back
+	if _, err := c.SetVideoLight(ctx, 1, web.VideoLightState{On: true, Brightness: 70}); err != nil {
+		t.Fatalf("SetVideoLight failed: %v", err)
+	}
+	status, err := c.Undo(ctx)
+	if err != nil || status.Undo != 0 || status.Redo != 1 {
+		t.Fatalf("Undo = %+v, %v", status, err)
+	}
+	if light, err := c.VideoLight(ctx, 1); err != nil || light.On {
+		t.Errorf("After undo the video light is %+v, %v", light, err)
+	}
+
+	if status, err := c.History(ctx); err != nil || status.Redo != 1 {
+		t.Errorf("History = %+v, %v", status, err)
+	}
+	if _, err := c.Redo(ctx); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	if light, err := c.VideoLight(ctx, 1); err != nil || light.Brightness != 70 {
+		t.Errorf("After redo the video light is %+v, %v", light, err)
+	}
+	if _, err := c.Redo(ctx); !errors.Is(err, history.ErrNothingToRedo) {
+		t.Errorf("Expected ErrNothingToRedo, got %v", err)
+	}
+
+	checkSpec(t, s)
+}
+
+func TestAuthentication(t *testing.T) {
+	s, _ := newServer(t)
+
+	var apiErr *Error
+	if _, err := New(s.URL, "wrong").State(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with the wrong token, got %v", err)
+	}
+}
+
+// checkSpec checks every request the client made is described by the server's OpenAPI document
+func checkSpec(t *testing.T, s *server) {
+	t.Helper()
+
+	// The document is public
+	resp, err := http.Get(s.URL + "/api/openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to fetch the OpenAPI document: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("OpenAPI document status %d", resp.StatusCode)
+	}
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatalf("Invalid OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("OpenAPI version %q", spec.OpenAPI)
+	}
+
+	param := regexp.MustCompile(`\{[^/]+\}`)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range s.requests {
+		found := false
+		for template, operations := range spec.Paths {
+			parts := param.Split(template, -1)
+			for i := range parts {
+				parts[i] = regexp.QuoteMeta(parts[i])
+			}
+			pattern := "^" + strings.Join(parts, `[^/]+`) + "$"
+			if _, ok := operations[strings.ToLower(req.method)]; ok && regexp.MustCompile(pattern).MatchString(req.path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%s %s isn't in the OpenAPI document", req.method, req.path)
+		}
+	}
+}
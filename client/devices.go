@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kevin/office_lights/web"
+)
+
+// LEDStrip returns the LED strip
+func (c *Client) LEDStrip(ctx context.Context, id int) (*web.LEDStripState, error) {
+	var state web.LEDStripState
+	if _, err := c.do(ctx, "GET", fmt.Sprintf("/api/ledstrip/%d", id), nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetLEDStrip sets the LED strip and returns it as it now is
+func (c *Client) SetLEDStrip(ctx context.Context, id int, state web.LEDStripState) (*web.LEDStripState, error) {
+	var updated web.LEDStripState
+	if _, err := c.do(ctx, "PUT", fmt.Sprintf("/api/ledstrip/%d", id), state, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// LEDBar returns the whole LED bar
+func (c *Client) LEDBar(ctx context.Context, id int) (*web.LEDBarState, error) {
+	var state web.LEDBarState
+	if _, err := c.do(ctx, "GET", fmt.Sprintf("/api/ledbar/%d", id), nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetLEDBar sets the whole LED bar and returns it as it now is
+func (c *Client) SetLEDBar(ctx context.Context, id int, state web.LEDBarState) (*web.LEDBarState, error) {
+	var updated web.LEDBarState
+	if _, err := c.do(ctx, "PUT", fmt.Sprintf("/api/ledbar/%d", id), state, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// LEDBarSection returns one section (1 or 2) of the LED bar
+func (c *Client) LEDBarSection(ctx context.Context, id, section int) (*web.LEDBarSection, error) {
+	var state web.LEDBarSection
+	if _, err := c.do(ctx, "GET", fmt.Sprintf("/api/ledbar/%d/section/%d", id, section), nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetLEDBarSection sets one section (1 or 2) of the LED bar and returns it as it now is
+func (c *Client) SetLEDBarSection(ctx context.Context, id, section int, state web.LEDBarSection) (*web.LEDBarSection, error) {
+	var updated web.LEDBarSection
+	if _, err := c.do(ctx, "PUT", fmt.Sprintf("/api/ledbar/%d/section/%d", id, section), state, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// SetLEDBarRGBW sets one RGBW LED (0-5) of an LED bar section and returns it as it now is
+func (c *Client) SetLEDBarRGBW(ctx context.Context, id, section, led int, state web.RGBW) (*web.RGBW, error) {
+	var updated web.RGBW
+	if _, err := c.do(ctx, "PUT", fmt.Sprintf("/api/ledbar/%d/section/%d/rgbw/%d", id, section, led), state, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// SetLEDBarWhite sets one white LED (0-12) of an LED bar section and returns its value as it now is
+func (c *Client) SetLEDBarWhite(ctx context.Context, id, section, led, value int) (int, error) {
+	var updated int
+	if _, err := c.do(ctx, "PUT", fmt.Sprintf("/api/ledbar/%d/section/%d/white/%d", id, section, led), value, &updated); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// VideoLight returns a video light (1 or 2)
+func (c *Client) VideoLight(ctx context.Context, id int) (*web.VideoLightState, error) {
+	var state web.VideoLightState
+	if _, err := c.do(ctx, "GET", fmt.Sprintf("/api/videolights/%d", id), nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetVideoLight sets a video light (1 or 2) and returns it as it now is
+func (c *Client) SetVideoLight(ctx context.Context, id int, state web.VideoLightState) (*web.VideoLightState, error) {
+	var updated web.VideoLightState
+	if _, err := c.do(ctx, "PUT", fmt.Sprintf("/api/videolights/%d", id), state, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
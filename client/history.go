@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+
+	"github.com/kevin/office_lights/history"
+)
+
+// History returns how many edits to the lights can be undone and redone
+func (c *Client) History(ctx context.Context) (*history.Status, error) {
+	var status history.Status
+	if _, err := c.do(ctx, "GET", "/api/history", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Undo puts the lights back as they were before the last edit, failing with
+// history.ErrNothingToUndo if there is none
+func (c *Client) Undo(ctx context.Context) (*history.Status, error) {
+	var status history.Status
+	if _, err := c.do(ctx, "POST", "/api/history/undo", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Redo makes the last undone edit again, failing with history.ErrNothingToRedo
+// if there is none
+func (c *Client) Redo(ctx context.Context) (*history.Status, error) {
+	var status history.Status
+	if _, err := c.do(ctx, "POST", "/api/history/redo", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Scene is a scene in the library
+type Scene struct {
+	ID          int                `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	BgColor     string             `json:"bgColor,omitempty"` // "#RRGGBB"
+	Tags        []string           `json:"tags,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+	Devices     *storage.SceneData `json:"devices,omitempty"` // nil if nothing has been saved
+}
+
+// Shortcut is one of the Stream Deck's scene shortcut buttons
+type Shortcut struct {
+	Button  int    `json:"button"`  // 1 to 4, left to right
+	SceneID *int   `json:"sceneId"` // nil if unassigned
+	Name    string `json:"name,omitempty"`
+}
+
+// NewScene describes a scene to save from the current state
+type NewScene struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	BgColor     string   `json:"bgColor,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Lights      []string `json:"lights,omitempty"` // light names as for partial scenes; every light if empty
+}
+
+// SceneUpdate changes a scene's details; nil fields are left as they are
+type SceneUpdate struct {
+	Name        *string   `json:"name,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	BgColor     *string   `json:"bgColor,omitempty"` // "" removes the colour
+	Tags        *[]string `json:"tags,omitempty"`
+}
+
+// Scenes returns every scene in the library, by name
+func (c *Client) Scenes(ctx context.Context) ([]Scene, error) {
+	var list struct {
+		Scenes []Scene `json:"scenes"`
+	}
+	if _, err := c.do(ctx, "GET", "/api/scenes", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Scenes, nil
+}
+
+// Scene returns a scene
+func (c *Client) Scene(ctx context.Context, id int) (*Scene, error) {
+	var scene Scene
+	if _, err := c.do(ctx, "GET", fmt.Sprintf("/api/scenes/%d", id), nil, &scene); err != nil {
+		return nil, err
+	}
+	return &scene, nil
+}
+
+// CreateScene saves the current state of the lights as a new scene
+func (c *Client) CreateScene(ctx context.Context, scene NewScene) (*Scene, error) {
+	var created Scene
+	if _, err := c.do(ctx, "POST", "/api/scenes", scene, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// CaptureScene saves the current state of the lights into the scene with the
+// given name, creating it if there isn't one, and returns its ID
+func (c *Client) CaptureScene(ctx context.Context, name string, lightNames ...string) (int, error) {
+	request := struct {
+		Name   string   `json:"name"`
+		Lights []string `json:"lights,omitempty"`
+	}{name, lightNames}
+	var scene Scene
+	if _, err := c.do(ctx, "POST", "/api/scenes/capture", request, &scene); err != nil {
+		return 0, err
+	}
+	return scene.ID, nil
+}
+
+// UpdateScene changes a scene's name, colour, description or tags
+func (c *Client) UpdateScene(ctx context.Context, id int, update SceneUpdate) (*Scene, error) {
+	var scene Scene
+	if _, err := c.do(ctx, "PATCH", fmt.Sprintf("/api/scenes/%d", id), update, &scene); err != nil {
+		return nil, err
+	}
+	return &scene, nil
+}
+
+// DeleteScene deletes a scene
+func (c *Client) DeleteScene(ctx context.Context, id int) error {
+	_, err := c.do(ctx, "DELETE", fmt.Sprintf("/api/scenes/%d", id), nil, nil)
+	return err
+}
+
+// RecallScene recalls a scene, crossfading over transition, or the server's
+// default transition if it is nil
+func (c *Client) RecallScene(ctx context.Context, id int, transition *lights.TransitionSpec) (*Scene, error) {
+	request := struct {
+		Transition *lights.TransitionSpec `json:"transition,omitempty"`
+	}{transition}
+	var scene Scene
+	if _, err := c.do(ctx, "POST", fmt.Sprintf("/api/scenes/%d/recall", id), request, &scene); err != nil {
+		return nil, err
+	}
+	return &scene, nil
+}
+
+// Shortcuts returns the Stream Deck's scene shortcut buttons and their scenes
+func (c *Client) Shortcuts(ctx context.Context) ([]Shortcut, error) {
+	var list struct {
+		Shortcuts []Shortcut `json:"shortcuts"`
+	}
+	if _, err := c.do(ctx, "GET", "/api/shortcuts", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Shortcuts, nil
+}
+
+// SetShortcut assigns a scene to a Stream Deck shortcut button
+func (c *Client) SetShortcut(ctx context.Context, button, sceneID int) error {
+	request := struct {
+		SceneID int `json:"sceneId"`
+	}{sceneID}
+	_, err := c.do(ctx, "PUT", fmt.Sprintf("/api/shortcuts/%d", button), request, nil)
+	return err
+}
+
+// ClearShortcut unassigns a Stream Deck shortcut button
+func (c *Client) ClearShortcut(ctx context.Context, button int) error {
+	_, err := c.do(ctx, "DELETE", fmt.Sprintf("/api/shortcuts/%d", button), nil, nil)
+	return err
+}
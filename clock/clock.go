@@ -0,0 +1,22 @@
+package clock
+
+import "time"
+
+// Clock provides the current time and timers so time-based code can be tested
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is a Clock backed by the system time
+type Real struct{}
+
+// Now returns the current system time
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse and then sends the current time
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
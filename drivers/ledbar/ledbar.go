@@ -3,8 +3,11 @@ package ledbar
 import (
 	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // Publisher defines the interface for publishing MQTT messages
@@ -23,7 +26,12 @@ type StateStore interface {
 // - 13 white LEDs in section 1
 // - 6 RGBW LEDs in section 2
 // - 13 white LEDs in section 2
+//
+// It is safe for concurrent use: mu guards the LED values and overrides, and is
+// held while publishing so messages go out in the order the values changed.
 type LEDBar struct {
+	mu sync.Mutex
+
 	rgbw1     [6][4]int // First set of 6 RGBW LEDs (R, G, B, W)
 	white1    [13]int   // First set of 13 white LEDs
 	rgbw2     [6][4]int // Second set of 6 RGBW LEDs (R, G, B, W)
@@ -32,6 +40,10 @@ type LEDBar struct {
 	publisher Publisher
 	topic     string
 	store     StateStore
+
+	// overrides map channels to values published in place of the bar's own until
+	// cleared, by layer; higher layers win where they share channels
+	overrides map[int]map[int]int
 }
 
 // NewLEDBar creates a new LED bar controller with default state (all off)
@@ -66,10 +78,13 @@ func NewLEDBarWithState(barID int, publisher Publisher, topic string, store Stat
 // index: 0-5 (which RGBW LED)
 // r, g, b, w: 0-255
 func (l *LEDBar) SetRGBW(section int, index int, r, g, b, w int) error {
-	if err := l.SetRGBWNoPublish(section, index, r, g, b, w); err != nil {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.setRGBW(section, index, r, g, b, w); err != nil {
 		return err
 	}
-	return l.Publish()
+	return l.publish()
 }
 
 // SetRGBWNoPublish sets the RGBW values for a specific LED in a section without publishing
@@ -78,6 +93,13 @@ func (l *LEDBar) SetRGBW(section int, index int, r, g, b, w int) error {
 // index: 0-5 (which RGBW LED)
 // r, g, b, w: 0-255
 func (l *LEDBar) SetRGBWNoPublish(section int, index int, r, g, b, w int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.setRGBW(section, index, r, g, b, w)
+}
+
+// setRGBW sets the RGBW values for a specific LED in a section; mu must be held
+func (l *LEDBar) setRGBW(section int, index int, r, g, b, w int) error {
 	if section != 1 && section != 2 {
 		return fmt.Errorf("section must be 1 or 2, got %d", section)
 	}
@@ -117,10 +139,13 @@ func (l *LEDBar) SetRGBWNoPublish(section int, index int, r, g, b, w int) error
 // index: 0-12 (which white LED)
 // value: 0-255
 func (l *LEDBar) SetWhite(section int, index int, value int) error {
-	if err := l.SetWhiteNoPublish(section, index, value); err != nil {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.setWhite(section, index, value); err != nil {
 		return err
 	}
-	return l.Publish()
+	return l.publish()
 }
 
 // SetWhiteNoPublish sets the white LED value for a specific LED in a section without publishing
@@ -129,6 +154,13 @@ func (l *LEDBar) SetWhite(section int, index int, value int) error {
 // index: 0-12 (which white LED)
 // value: 0-255
 func (l *LEDBar) SetWhiteNoPublish(section int, index int, value int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.setWhite(section, index, value)
+}
+
+// setWhite sets the white LED value for a specific LED in a section; mu must be held
+func (l *LEDBar) setWhite(section int, index int, value int) error {
 	if section != 1 && section != 2 {
 		return fmt.Errorf("section must be 1 or 2, got %d", section)
 	}
@@ -157,6 +189,9 @@ func (l *LEDBar) GetRGBW(section int, index int) (int, int, int, int, error) {
 		return 0, 0, 0, 0, fmt.Errorf("index must be between 0 and 5, got %d", index)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if section == 1 {
 		return l.rgbw1[index][0], l.rgbw1[index][1], l.rgbw1[index][2], l.rgbw1[index][3], nil
 	}
@@ -172,6 +207,9 @@ func (l *LEDBar) GetWhite(section int, index int) (int, error) {
 		return 0, fmt.Errorf("index must be between 0 and 12, got %d", index)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if section == 1 {
 		return l.white1[index], nil
 	}
@@ -184,6 +222,9 @@ func (l *LEDBar) TurnOffSection(section int) error {
 		return fmt.Errorf("section must be 1 or 2, got %d", section)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if section == 1 {
 		for i := range l.rgbw1 {
 			for j := range l.rgbw1[i] {
@@ -204,11 +245,14 @@ func (l *LEDBar) TurnOffSection(section int) error {
 		}
 	}
 
-	return l.Publish()
+	return l.publish()
 }
 
 // TurnOffAll turns off all LEDs on the bar
 func (l *LEDBar) TurnOffAll() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	for i := range l.rgbw1 {
 		for j := range l.rgbw1[i] {
 			l.rgbw1[i][j] = 0
@@ -226,7 +270,7 @@ func (l *LEDBar) TurnOffAll() error {
 		l.white2[i] = 0
 	}
 
-	return l.Publish()
+	return l.publish()
 }
 
 // SetAllRGBW sets all RGBW LEDs to the same color
@@ -244,6 +288,9 @@ func (l *LEDBar) SetAllRGBW(r, g, b, w int) error {
 		return fmt.Errorf("white: %w", err)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	for i := range l.rgbw1 {
 		l.rgbw1[i][0] = r
 		l.rgbw1[i][1] = g
@@ -257,7 +304,7 @@ func (l *LEDBar) SetAllRGBW(r, g, b, w int) error {
 		l.rgbw2[i][3] = w
 	}
 
-	return l.Publish()
+	return l.publish()
 }
 
 // SetAllWhite sets all white LEDs in a specific section to the same value
@@ -272,6 +319,9 @@ func (l *LEDBar) SetAllWhite(section int, value int) error {
 		return fmt.Errorf("value: %w", err)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if section == 1 {
 		for i := range l.white1 {
 			l.white1[i] = value
@@ -282,7 +332,7 @@ func (l *LEDBar) SetAllWhite(section int, value int) error {
 		}
 	}
 
-	return l.Publish()
+	return l.publish()
 }
 
 // GetAverageWhite returns the average value of all white LEDs in a specific section
@@ -293,6 +343,9 @@ func (l *LEDBar) GetAverageWhite(section int) int {
 		return 0
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	var sum int
 	var count int
 
@@ -317,10 +370,15 @@ func (l *LEDBar) GetAverageWhite(section int) int {
 
 // Publish formats and publishes the current state to MQTT
 func (l *LEDBar) Publish() error {
-	payload := l.formatMessage()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.publish()
+}
 
-	if err := l.publisher.Publish(l.topic, payload); err != nil {
-		return fmt.Errorf("failed to publish: %w", err)
+// publish publishes and saves the current state; mu must be held
+func (l *LEDBar) publish() error {
+	if err := l.publishFrame(); err != nil {
+		return err
 	}
 
 	// Save state to storage after successful publish
@@ -335,6 +393,88 @@ func (l *LEDBar) Publish() error {
 	return nil
 }
 
+// PublishFrame publishes the current state to MQTT without saving it to storage
+func (l *LEDBar) PublishFrame() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.publishFrame()
+}
+
+// publishFrame publishes the current state without saving it; mu must be held
+func (l *LEDBar) publishFrame() error {
+	payload := l.formatMessage()
+
+	if err := l.publisher.Publish(l.topic, payload); err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	return nil
+}
+
+// SetOverride publishes values for some channels in place of the bar's own until ClearOverride
+// The override replaces any set before on the same layer. The bar's channels can
+// still be set and saved underneath, and the getters keep returning them, but
+// nothing else reaches the overridden channels while an override is set. Where
+// layers share channels, the highest layer is shown.
+func (l *LEDBar) SetOverride(layer int, channels map[int]int) error {
+	override := make(map[int]int, len(channels))
+	for channel, value := range channels {
+		if channel < 0 || channel >= ChannelCount {
+			return fmt.Errorf("channel must be between 0 and %d, got %d", ChannelCount-1, channel)
+		}
+		if err := validateValue(value); err != nil {
+			return err
+		}
+		override[channel] = value
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.overrides == nil {
+		l.overrides = make(map[int]map[int]int)
+	}
+	l.overrides[layer] = override
+	return l.publishFrame()
+}
+
+// ClearOverride removes the override on a layer and publishes what shows without it
+func (l *LEDBar) ClearOverride(layer int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.overrides[layer]; !ok {
+		return nil
+	}
+
+	delete(l.overrides, layer)
+	return l.publishFrame()
+}
+
+// Overridden reports whether an override is set on any layer
+func (l *LEDBar) Overridden() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.overrides) > 0
+}
+
+// shown returns the bar as published: a copy with the overrides applied, lowest layer first
+// mu must be held.
+func (l *LEDBar) shown() *LEDBar {
+	channels := l.getChannels()
+	for _, layer := range slices.Sorted(maps.Keys(l.overrides)) {
+		for channel, value := range l.overrides[layer] {
+			channels[channel] = value
+		}
+	}
+
+	shown := &LEDBar{}
+	if err := shown.loadFromChannels(channels); err != nil {
+		return l
+	}
+	return shown
+}
+
 // formatMessage creates the comma-separated message for the LED bar
 // Message structure (77 values total):
 // - Values 0-23: 6 RGBW LEDs (4 values each: R,G,B,W)
@@ -342,7 +482,12 @@ func (l *LEDBar) Publish() error {
 // - Values 37-38: 2 ignored values (set to 0)
 // - Values 39-62: 6 RGBW LEDs (4 values each: R,G,B,W)
 // - Values 63-75: 13 white LEDs (1 value each)
+// mu must be held.
 func (l *LEDBar) formatMessage() string {
+	if len(l.overrides) > 0 {
+		return l.shown().formatMessage()
+	}
+
 	values := make([]string, 0, 77)
 
 	// First section: 6 RGBW LEDs (24 values)
@@ -383,6 +528,50 @@ func validateValue(value int) error {
 	return nil
 }
 
+// Channel layout of the 77-value channel array (see formatMessage)
+const (
+	ChannelCount           = 77
+	section1RGBWStart      = 0
+	section1WhiteStart     = 24
+	section2RGBWStart      = 40
+	section2WhiteStart     = 64
+	rgbwChannelsPerSection = 24
+	whiteLEDsPerSection    = 13
+)
+
+// RGBWChannels returns the channel indices of a section's RGBW LEDs (4 per LED, in R,G,B,W order)
+// section: 1 or 2
+func RGBWChannels(section int) []int {
+	start := section1RGBWStart
+	if section == 2 {
+		start = section2RGBWStart
+	} else if section != 1 {
+		return nil
+	}
+	return channelRange(start, rgbwChannelsPerSection)
+}
+
+// WhiteChannels returns the channel indices of a section's white LEDs
+// section: 1 or 2
+func WhiteChannels(section int) []int {
+	start := section1WhiteStart
+	if section == 2 {
+		start = section2WhiteStart
+	} else if section != 1 {
+		return nil
+	}
+	return channelRange(start, whiteLEDsPerSection)
+}
+
+// channelRange returns count consecutive channel indices starting at start
+func channelRange(start, count int) []int {
+	channels := make([]int, count)
+	for i := range channels {
+		channels[i] = start + i
+	}
+	return channels
+}
+
 // GetBarID returns the bar ID
 func (l *LEDBar) GetBarID() int {
 	return l.barID
@@ -390,18 +579,35 @@ func (l *LEDBar) GetBarID() int {
 
 // GetChannels returns the current state as a 77-value array
 func (l *LEDBar) GetChannels() []int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.getChannels()
 }
 
 // SetChannels sets all channel values from a 77-value array and publishes
 func (l *LEDBar) SetChannels(channels []int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.loadFromChannels(channels); err != nil {
+		return err
+	}
+	return l.publish()
+}
+
+// SetChannelsFrame sets all channel values from a 77-value array and publishes them without saving to storage
+// Use this for intermediate animation frames, then SetChannels for the final value
+func (l *LEDBar) SetChannelsFrame(channels []int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if err := l.loadFromChannels(channels); err != nil {
 		return err
 	}
-	return l.Publish()
+	return l.publishFrame()
 }
 
-// loadFromChannels populates LED states from 77-value channel array
+// loadFromChannels populates LED states from 77-value channel array; mu must be held
 func (l *LEDBar) loadFromChannels(channels []int) error {
 	if len(channels) != 77 {
 		return fmt.Errorf("expected 77 channels, got %d", len(channels))
@@ -443,7 +649,7 @@ func (l *LEDBar) loadFromChannels(channels []int) error {
 	return nil
 }
 
-// getChannels returns current state as 77-value array
+// getChannels returns current state as 77-value array; mu must be held
 func (l *LEDBar) getChannels() []int {
 	channels := make([]int, 77)
 	idx := 0
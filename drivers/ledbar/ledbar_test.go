@@ -446,3 +446,117 @@ func TestGetWhiteErrors(t *testing.T) {
 		})
 	}
 }
+
+// countingStore records how many times LED bar state is saved
+type countingStore struct {
+	saves int
+}
+
+func (c *countingStore) SaveLEDBarChannels(barID int, channels []int) error {
+	c.saves++
+	return nil
+}
+
+func TestSetChannelsFrame(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	store := &countingStore{}
+	bar, _ := NewLEDBarWithState(0, mock, "test/topic", store, make([]int, ChannelCount))
+
+	channels := make([]int, ChannelCount)
+	channels[64] = 128
+	if err := bar.SetChannelsFrame(channels); err != nil {
+		t.Fatalf("SetChannelsFrame failed: %v", err)
+	}
+
+	if mock.MessageCount() != 1 {
+		t.Errorf("Expected 1 message, got %d", mock.MessageCount())
+	}
+	if store.saves != 0 {
+		t.Errorf("Frames should not be saved, got %d saves", store.saves)
+	}
+	if value, _ := bar.GetWhite(2, 0); value != 128 {
+		t.Errorf("Expected section 2 white 0 = 128, got %d", value)
+	}
+
+	// Publishing normally saves the state
+	if err := bar.Publish(); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if store.saves != 1 {
+		t.Errorf("Expected 1 save, got %d", store.saves)
+	}
+
+	if err := bar.SetChannelsFrame(make([]int, 10)); err == nil {
+		t.Error("Expected error for wrong channel count")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	bar, _ := NewLEDBar(0, mock, "test/topic")
+	bar.SetRGBW(1, 0, 10, 20, 30, 40)
+	bar.SetWhite(2, 0, 50)
+
+	// Override the first RGBW LED of section 1 only
+	if err := bar.SetOverride(1, map[int]int{0: 255, 1: 0, 2: 0, 3: 0}); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+	if !bar.Overridden() {
+		t.Error("Expected the bar to be overridden")
+	}
+	values := strings.Split(mock.GetLastMessage().Payload.(string), ",")
+	if values[0] != "255" || values[1] != "0" || values[63] != "50" {
+		t.Errorf("Expected the override on the first LED and the rest as set, got %s,%s ... %s", values[0], values[1], values[63])
+	}
+
+	// Changes underneath are kept but only shown outside the override
+	bar.SetRGBW(1, 0, 1, 2, 3, 4)
+	bar.SetWhite(2, 0, 60)
+	values = strings.Split(mock.GetLastMessage().Payload.(string), ",")
+	if values[0] != "255" || values[63] != "60" {
+		t.Errorf("Expected the override kept and the white LED changed, got %s ... %s", values[0], values[63])
+	}
+	if r, g, b, w, _ := bar.GetRGBW(1, 0); r != 1 || g != 2 || b != 3 || w != 4 {
+		t.Errorf("Expected 1,2,3,4 underneath, got %d,%d,%d,%d", r, g, b, w)
+	}
+
+	if err := bar.ClearOverride(1); err != nil {
+		t.Fatalf("ClearOverride failed: %v", err)
+	}
+	values = strings.Split(mock.GetLastMessage().Payload.(string), ",")
+	if values[0] != "1" || values[3] != "4" {
+		t.Errorf("Expected the LED underneath to be published again, got %s,%s", values[0], values[3])
+	}
+
+	if err := bar.SetOverride(1, map[int]int{ChannelCount: 0}); err == nil {
+		t.Error("Expected error for channel out of range")
+	}
+	if err := bar.SetOverride(1, map[int]int{0: 256}); err == nil {
+		t.Error("Expected error for value out of range")
+	}
+}
+
+func TestOverrideLayers(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	bar, _ := NewLEDBar(0, mock, "test/topic")
+	bar.SetWhite(1, 0, 5)
+
+	// Layers combine where they cover different channels; the higher wins where they share
+	bar.SetOverride(2, map[int]int{0: 200})
+	bar.SetOverride(1, map[int]int{0: 100, 1: 100})
+	values := strings.Split(mock.GetLastMessage().Payload.(string), ",")
+	if values[0] != "200" || values[1] != "100" || values[24] != "5" {
+		t.Errorf("Expected 200,100 from the layers and 5 underneath, got %s,%s ... %s", values[0], values[1], values[24])
+	}
+
+	bar.ClearOverride(2)
+	values = strings.Split(mock.GetLastMessage().Payload.(string), ",")
+	if values[0] != "100" || values[1] != "100" {
+		t.Errorf("Expected the lower layer once the higher is cleared, got %s,%s", values[0], values[1])
+	}
+
+	bar.ClearOverride(1)
+	if bar.Overridden() {
+		t.Error("Expected no overrides left")
+	}
+}
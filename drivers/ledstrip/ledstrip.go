@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
+	"slices"
+	"sync"
 )
 
 // Publisher defines the interface for publishing MQTT messages
@@ -17,7 +20,11 @@ type StateStore interface {
 }
 
 // LEDStrip represents an RGB LED strip controller
+// It is safe for concurrent use: mu guards the colour and overrides, and is held
+// while publishing so messages go out in the order the colour changed.
 type LEDStrip struct {
+	mu sync.Mutex
+
 	r         int
 	g         int
 	b         int
@@ -25,6 +32,10 @@ type LEDStrip struct {
 	topic     string
 	store     StateStore
 	id        int
+
+	// overrides are colours published in place of the strip's own until cleared,
+	// by layer; the highest layer set is shown
+	overrides map[int][3]int
 }
 
 // sequenceMessage represents the JSON structure for LED strip commands
@@ -64,30 +75,41 @@ func (l *LEDStrip) SetColor(r, g, b int) error {
 		return err
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.r = r
 	l.g = g
 	l.b = b
 
-	return l.Publish()
+	return l.publish()
 }
 
 // GetColor returns the current RGB color values
 func (l *LEDStrip) GetColor() (int, int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.r, l.g, l.b
 }
 
 // R returns the current red value
 func (l *LEDStrip) R() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.r
 }
 
 // G returns the current green value
 func (l *LEDStrip) G() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.g
 }
 
 // B returns the current blue value
 func (l *LEDStrip) B() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	return l.b
 }
 
@@ -102,23 +124,84 @@ func (l *LEDStrip) SetBrightness(percentage int) error {
 		return fmt.Errorf("brightness must be between 0 and 100, got %d", percentage)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	scale := float64(percentage) / 100.0
-	r := int(float64(l.r) * scale)
-	g := int(float64(l.g) * scale)
-	b := int(float64(l.b) * scale)
+	l.r = int(float64(l.r) * scale)
+	l.g = int(float64(l.g) * scale)
+	l.b = int(float64(l.b) * scale)
 
-	return l.SetColor(r, g, b)
+	return l.publish()
+}
+
+// SetColorFrame sets the RGB color values and publishes them without saving to storage
+// Use this for intermediate animation frames, then SetColor for the final value
+func (l *LEDStrip) SetColorFrame(r, g, b int) error {
+	if err := validateRGB(r, g, b); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.r = r
+	l.g = g
+	l.b = b
+
+	return l.publishFrame()
+}
+
+// SetOverride publishes a colour that takes the place of the strip's own until ClearOverride
+// The strip's colour can still be set and saved underneath, and GetColor keeps
+// returning it, but nothing else reaches the lights while an override is set.
+// Each layer holds one override, and only the highest layer set is shown.
+func (l *LEDStrip) SetOverride(layer int, r, g, b int) error {
+	if err := validateRGB(r, g, b); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.overrides == nil {
+		l.overrides = make(map[int][3]int)
+	}
+	l.overrides[layer] = [3]int{r, g, b}
+	return l.publishFrame()
+}
+
+// ClearOverride removes the override on a layer and publishes what shows without it
+func (l *LEDStrip) ClearOverride(layer int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.overrides[layer]; !ok {
+		return nil
+	}
+
+	delete(l.overrides, layer)
+	return l.publishFrame()
+}
+
+// Overridden reports whether an override is set on any layer
+func (l *LEDStrip) Overridden() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.overrides) > 0
 }
 
 // Publish formats and publishes the current state to MQTT
 func (l *LEDStrip) Publish() error {
-	payload, err := l.formatMessage()
-	if err != nil {
-		return fmt.Errorf("failed to format message: %w", err)
-	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.publish()
+}
 
-	if err := l.publisher.Publish(l.topic, payload); err != nil {
-		return fmt.Errorf("failed to publish: %w", err)
+// publish publishes and saves the current state; mu must be held
+func (l *LEDStrip) publish() error {
+	if err := l.publishFrame(); err != nil {
+		return err
 	}
 
 	// Save state to storage after successful publish
@@ -133,7 +216,28 @@ func (l *LEDStrip) Publish() error {
 	return nil
 }
 
-// formatMessage creates the JSON message for the LED strip
+// PublishFrame publishes the current state to MQTT without saving it to storage
+func (l *LEDStrip) PublishFrame() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.publishFrame()
+}
+
+// publishFrame publishes the current state without saving it; mu must be held
+func (l *LEDStrip) publishFrame() error {
+	payload, err := l.formatMessage()
+	if err != nil {
+		return fmt.Errorf("failed to format message: %w", err)
+	}
+
+	if err := l.publisher.Publish(l.topic, payload); err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	return nil
+}
+
+// formatMessage creates the JSON message for the LED strip; mu must be held
 func (l *LEDStrip) formatMessage() ([]byte, error) {
 	msg := sequenceMessage{
 		Sequence: "fill",
@@ -143,6 +247,10 @@ func (l *LEDStrip) formatMessage() ([]byte, error) {
 			B: l.b,
 		},
 	}
+	if len(l.overrides) > 0 {
+		top := l.overrides[slices.Max(slices.Collect(maps.Keys(l.overrides)))]
+		msg.Data = sequenceData{R: top[0], G: top[1], B: top[2]}
+	}
 
 	return json.Marshal(msg)
 }
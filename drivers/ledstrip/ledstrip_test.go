@@ -195,3 +195,130 @@ func TestPresetColors(t *testing.T) {
 		})
 	}
 }
+
+// countingStore records how many times LED strip state is saved
+type countingStore struct {
+	saves int
+}
+
+func (c *countingStore) SaveLEDStripState(id int, r, g, b int) error {
+	c.saves++
+	return nil
+}
+
+func TestSetColorFrame(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	store := &countingStore{}
+	strip := NewLEDStripWithState(mock, "test/topic", store, 0, 0, 0, 0)
+
+	if err := strip.SetColorFrame(10, 20, 30); err != nil {
+		t.Fatalf("SetColorFrame failed: %v", err)
+	}
+	if mock.MessageCount() != 1 {
+		t.Errorf("Expected 1 message, got %d", mock.MessageCount())
+	}
+	if store.saves != 0 {
+		t.Errorf("Frames should not be saved, got %d saves", store.saves)
+	}
+	if r, g, b := strip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Expected 10,20,30, got %d,%d,%d", r, g, b)
+	}
+
+	if err := strip.SetColor(40, 50, 60); err != nil {
+		t.Fatalf("SetColor failed: %v", err)
+	}
+	if store.saves != 1 {
+		t.Errorf("Expected 1 save, got %d", store.saves)
+	}
+
+	if err := strip.SetColorFrame(256, 0, 0); err == nil {
+		t.Error("Expected error for value out of range")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	store := &countingStore{}
+	strip := NewLEDStripWithState(mock, "test/topic", store, 0, 10, 20, 30)
+
+	published := func() sequenceData {
+		t.Helper()
+		var result sequenceMessage
+		if err := json.Unmarshal(mock.GetLastMessage().Payload.([]byte), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return result.Data
+	}
+
+	if err := strip.SetOverride(1, 255, 0, 0); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+	if !strip.Overridden() {
+		t.Error("Expected the strip to be overridden")
+	}
+	if got := published(); got != (sequenceData{R: 255}) {
+		t.Errorf("Expected the override to be published, got %+v", got)
+	}
+
+	// Changes underneath are kept and saved but not shown
+	if err := strip.SetColor(40, 50, 60); err != nil {
+		t.Fatalf("SetColor failed: %v", err)
+	}
+	if got := published(); got != (sequenceData{R: 255}) {
+		t.Errorf("Expected the override to stay published, got %+v", got)
+	}
+	if r, g, b := strip.GetColor(); r != 40 || g != 50 || b != 60 {
+		t.Errorf("Expected the colour underneath to be 40,50,60, got %d,%d,%d", r, g, b)
+	}
+	if store.saves != 1 {
+		t.Errorf("Expected the colour underneath to be saved, got %d saves", store.saves)
+	}
+
+	if err := strip.ClearOverride(1); err != nil {
+		t.Fatalf("ClearOverride failed: %v", err)
+	}
+	if got := published(); got != (sequenceData{R: 40, G: 50, B: 60}) {
+		t.Errorf("Expected the colour underneath to be published again, got %+v", got)
+	}
+	count := mock.MessageCount()
+	if err := strip.ClearOverride(1); err != nil || mock.MessageCount() != count {
+		t.Errorf("Clearing again should do nothing, got %v and %d messages", err, mock.MessageCount()-count)
+	}
+
+	if err := strip.SetOverride(1, 0, 0, 256); err == nil {
+		t.Error("Expected error for value out of range")
+	}
+}
+
+func TestOverrideLayers(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	strip := NewLEDStripWithState(mock, "test/topic", nil, 0, 10, 20, 30)
+
+	published := func() sequenceData {
+		t.Helper()
+		var result sequenceMessage
+		if err := json.Unmarshal(mock.GetLastMessage().Payload.([]byte), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return result.Data
+	}
+
+	strip.SetOverride(2, 255, 0, 0)
+	strip.SetOverride(1, 0, 255, 0)
+	if got := published(); got != (sequenceData{R: 255}) {
+		t.Errorf("Expected the higher layer to show, got %+v", got)
+	}
+
+	strip.ClearOverride(2)
+	if got := published(); got != (sequenceData{G: 255}) {
+		t.Errorf("Expected the lower layer to show once the higher is cleared, got %+v", got)
+	}
+
+	strip.ClearOverride(1)
+	if got := published(); got != (sequenceData{R: 10, G: 20, B: 30}) {
+		t.Errorf("Expected the strip's own colour with no layers, got %+v", got)
+	}
+	if strip.Overridden() {
+		t.Error("Expected no overrides left")
+	}
+}
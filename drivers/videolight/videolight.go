@@ -3,7 +3,10 @@ package videolight
 import (
 	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 )
 
 // Publisher defines the interface for publishing MQTT messages
@@ -17,13 +20,27 @@ type StateStore interface {
 }
 
 // VideoLight represents a video light controller
+// It is safe for concurrent use: mu guards the state and overrides, and is held
+// while publishing so messages go out in the order the state changed.
 type VideoLight struct {
+	mu sync.Mutex
+
 	on         bool
 	brightness int
 	lightID    int
 	publisher  Publisher
 	topic      string
 	store      StateStore
+
+	// overrides are states published in place of the light's own until cleared,
+	// by layer; the highest layer set is shown
+	overrides map[int]videoState
+}
+
+// videoState is an on/off state and brightness
+type videoState struct {
+	on         bool
+	brightness int
 }
 
 // NewVideoLight creates a new video light controller with default state (off)
@@ -59,10 +76,29 @@ func (v *VideoLight) SetState(on bool, brightness int) error {
 		return err
 	}
 
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
 	v.on = on
 	v.brightness = brightness
 
-	return v.Publish()
+	return v.publish()
+}
+
+// SetStateFrame sets the on/off state and brightness and publishes them without saving to storage
+// Use this for intermediate animation frames, then SetState for the final value
+func (v *VideoLight) SetStateFrame(on bool, brightness int) error {
+	if err := validateBrightness(brightness); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.on = on
+	v.brightness = brightness
+
+	return v.publishFrame()
 }
 
 // TurnOn turns on the light at the specified brightness
@@ -72,26 +108,44 @@ func (v *VideoLight) TurnOn(brightness int) error {
 
 // TurnOff turns off the light, preserving the brightness value
 func (v *VideoLight) TurnOff() error {
-	return v.SetState(false, v.brightness)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.on = false
+	return v.publish()
 }
 
 // SetBrightness sets the brightness while maintaining the current on/off state
 func (v *VideoLight) SetBrightness(brightness int) error {
-	return v.SetState(v.on, brightness)
+	if err := validateBrightness(brightness); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.brightness = brightness
+	return v.publish()
 }
 
 // GetState returns the current on/off state and brightness
 func (v *VideoLight) GetState() (bool, int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return v.on, v.brightness
 }
 
 // IsOn returns whether the light is currently on
 func (v *VideoLight) IsOn() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return v.on
 }
 
 // Brightness returns the current brightness value
 func (v *VideoLight) Brightness() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return v.brightness
 }
 
@@ -100,12 +154,56 @@ func (v *VideoLight) GetLightID() int {
 	return v.lightID
 }
 
+// SetOverride publishes a state that takes the place of the light's own until ClearOverride
+// The light's state can still be set and saved underneath, and GetState keeps
+// returning it, but nothing else reaches the light while an override is set.
+// Each layer holds one override, and only the highest layer set is shown.
+func (v *VideoLight) SetOverride(layer int, on bool, brightness int) error {
+	if err := validateBrightness(brightness); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.overrides == nil {
+		v.overrides = make(map[int]videoState)
+	}
+	v.overrides[layer] = videoState{on: on, brightness: brightness}
+	return v.publishFrame()
+}
+
+// ClearOverride removes the override on a layer and publishes what shows without it
+func (v *VideoLight) ClearOverride(layer int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.overrides[layer]; !ok {
+		return nil
+	}
+
+	delete(v.overrides, layer)
+	return v.publishFrame()
+}
+
+// Overridden reports whether an override is set on any layer
+func (v *VideoLight) Overridden() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.overrides) > 0
+}
+
 // Publish formats and publishes the current state to MQTT
 func (v *VideoLight) Publish() error {
-	payload := v.formatMessage()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.publish()
+}
 
-	if err := v.publisher.Publish(v.topic, payload); err != nil {
-		return fmt.Errorf("failed to publish: %w", err)
+// publish publishes and saves the current state; mu must be held
+func (v *VideoLight) publish() error {
+	if err := v.publishFrame(); err != nil {
+		return err
 	}
 
 	// Save state to storage after successful publish
@@ -121,21 +219,45 @@ func (v *VideoLight) Publish() error {
 	return nil
 }
 
-// formatMessage creates the message string for the video light
+// PublishFrame publishes the current state to MQTT without saving it to storage
+func (v *VideoLight) PublishFrame() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.publishFrame()
+}
+
+// publishFrame publishes the current state without saving it; mu must be held
+func (v *VideoLight) publishFrame() error {
+	payload := v.formatMessage()
+
+	if err := v.publisher.Publish(v.topic, payload); err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	return nil
+}
+
+// formatMessage creates the message string for the video light; mu must be held
 // Format: set,<on>,<brightness>
 // Example: set,true,50
 func (v *VideoLight) formatMessage() string {
+	on, brightness := v.on, v.brightness
+	if len(v.overrides) > 0 {
+		top := v.overrides[slices.Max(slices.Collect(maps.Keys(v.overrides)))]
+		on, brightness = top.on, top.brightness
+	}
+
 	var builder strings.Builder
 	builder.WriteString("set,")
 
-	if v.on {
+	if on {
 		builder.WriteString("true")
 	} else {
 		builder.WriteString("false")
 	}
 
 	builder.WriteString(",")
-	builder.WriteString(fmt.Sprintf("%d", v.brightness))
+	builder.WriteString(fmt.Sprintf("%d", brightness))
 
 	return builder.String()
 }
@@ -249,3 +249,106 @@ func TestMultipleLights(t *testing.T) {
 		t.Errorf("Expected 2 messages, got %d", mock.MessageCount())
 	}
 }
+
+// countingStore records how many times video light state is saved
+type countingStore struct {
+	saves int
+}
+
+func (c *countingStore) SaveVideoLightState(id int, on bool, brightness int) error {
+	c.saves++
+	return nil
+}
+
+func TestSetStateFrame(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	store := &countingStore{}
+	light, _ := NewVideoLightWithState(1, mock, "test/topic", store, false, 0)
+
+	if err := light.SetStateFrame(true, 40); err != nil {
+		t.Fatalf("SetStateFrame failed: %v", err)
+	}
+	if mock.MessageCount() != 1 {
+		t.Errorf("Expected 1 message, got %d", mock.MessageCount())
+	}
+	if store.saves != 0 {
+		t.Errorf("Frames should not be saved, got %d saves", store.saves)
+	}
+	if on, brightness := light.GetState(); !on || brightness != 40 {
+		t.Errorf("Expected on/40, got %v/%d", on, brightness)
+	}
+
+	if err := light.SetState(true, 50); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	if store.saves != 1 {
+		t.Errorf("Expected 1 save, got %d", store.saves)
+	}
+
+	if err := light.SetStateFrame(true, 101); err == nil {
+		t.Error("Expected error for brightness out of range")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	store := &countingStore{}
+	light, _ := NewVideoLightWithState(1, mock, "test/topic", store, false, 30)
+
+	if err := light.SetOverride(1, true, 100); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+	if !light.Overridden() {
+		t.Error("Expected the light to be overridden")
+	}
+	if got := mock.GetLastMessage().Payload; got != "set,true,100" {
+		t.Errorf("Expected the override to be published, got %v", got)
+	}
+
+	// Changes underneath are kept and saved but not shown
+	if err := light.SetState(true, 60); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	if got := mock.GetLastMessage().Payload; got != "set,true,100" {
+		t.Errorf("Expected the override to stay published, got %v", got)
+	}
+	if on, brightness := light.GetState(); !on || brightness != 60 {
+		t.Errorf("Expected on/60 underneath, got %v/%d", on, brightness)
+	}
+	if store.saves != 1 {
+		t.Errorf("Expected the state underneath to be saved, got %d saves", store.saves)
+	}
+
+	if err := light.ClearOverride(1); err != nil {
+		t.Fatalf("ClearOverride failed: %v", err)
+	}
+	if got := mock.GetLastMessage().Payload; got != "set,true,60" {
+		t.Errorf("Expected the state underneath to be published again, got %v", got)
+	}
+
+	if err := light.SetOverride(1, true, 101); err == nil {
+		t.Error("Expected error for brightness out of range")
+	}
+}
+
+func TestOverrideLayers(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	light, _ := NewVideoLightWithState(1, mock, "test/topic", nil, true, 30)
+
+	light.SetOverride(1, true, 100)
+	light.SetOverride(2, false, 0)
+	if got := mock.GetLastMessage().Payload; got != "set,false,0" {
+		t.Errorf("Expected the higher layer to show, got %v", got)
+	}
+
+	// Clearing a lower layer changes nothing shown
+	light.ClearOverride(1)
+	if got := mock.GetLastMessage().Payload; got != "set,false,0" {
+		t.Errorf("Expected the higher layer to stay, got %v", got)
+	}
+
+	light.ClearOverride(2)
+	if got := mock.GetLastMessage().Payload; got != "set,true,30" {
+		t.Errorf("Expected the light's own state with no layers, got %v", got)
+	}
+}
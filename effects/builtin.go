@@ -0,0 +1,286 @@
+package effects
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+)
+
+// Safety limits for the strobe effect
+// Flashing faster than 3 Hz can trigger photosensitive seizures, and a strobe
+// that is left running is never wanted, so it always stops on its own.
+const (
+	MaxStrobeFrequency = 3.0 // Hz
+	MaxStrobeDuration  = 60  // seconds
+)
+
+// rgbwLEDsPerSection is the number of RGBW LEDs in each LED bar section
+const rgbwLEDsPerSection = 6
+
+func init() {
+	Register(&Definition{
+		Name:        "breathing",
+		Description: "Slowly pulses the brightness of the current colour",
+		Devices:     Devices,
+		Params: []ParamSpec{
+			{Name: "period", Description: "Seconds per breath", Default: 4, Min: 0.5, Max: 60},
+			{Name: "min", Description: "Dimmest point as a fraction of full brightness", Default: 0.1, Min: 0, Max: 1},
+		},
+		Blend: true,
+		New: func(p Params) Effect {
+			return &breathing{period: seconds(p["period"]), min: p["min"]}
+		},
+	})
+
+	Register(&Definition{
+		Name:        "rainbow",
+		Description: "Cycles the LED strip through the colour wheel",
+		Devices:     []Device{DeviceLEDStrip},
+		Params: []ParamSpec{
+			{Name: "period", Description: "Seconds per full cycle", Default: 10, Min: 1, Max: 300},
+			{Name: "brightness", Description: "Brightness in percent", Default: 100, Min: 1, Max: 100},
+		},
+		New: func(p Params) Effect {
+			return &rainbow{period: seconds(p["period"]), brightness: p["brightness"] / 100}
+		},
+	})
+
+	Register(&Definition{
+		Name:        "chase",
+		Description: "Runs a single lit LED along the 6 RGBW LEDs of each LED bar section",
+		Devices:     []Device{DeviceLEDBar},
+		Params: []ParamSpec{
+			{Name: "step", Description: "Milliseconds per LED", Default: 150, Min: 50, Max: 2000},
+			{Name: "r", Description: "Red", Default: 255, Min: 0, Max: 255},
+			{Name: "g", Description: "Green", Default: 0, Min: 0, Max: 255},
+			{Name: "b", Description: "Blue", Default: 0, Min: 0, Max: 255},
+			{Name: "w", Description: "White", Default: 0, Min: 0, Max: 255},
+		},
+		New: func(p Params) Effect {
+			return &chase{
+				step: time.Duration(p["step"]) * time.Millisecond,
+				rgbw: [4]int{int(p["r"]), int(p["g"]), int(p["b"]), int(p["w"])},
+			}
+		},
+	})
+
+	Register(&Definition{
+		Name:        "candle",
+		Description: "Flickers the LED bar's white LEDs like candlelight",
+		Devices:     []Device{DeviceLEDBar},
+		Params: []ParamSpec{
+			{Name: "intensity", Description: "Average white level", Default: 180, Min: 1, Max: 255},
+			{Name: "flicker", Description: "How far the flame dips, as a fraction of the intensity", Default: 0.3, Min: 0, Max: 1},
+		},
+		Blend: true,
+		New: func(p Params) Effect {
+			return &candle{
+				intensity: p["intensity"],
+				flicker:   p["flicker"],
+				rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+			}
+		},
+	})
+
+	Register(&Definition{
+		Name:        "strobe",
+		Description: "Flashes the light on and off (limited to 3 Hz and 60 seconds)",
+		Devices:     Devices,
+		Params: []ParamSpec{
+			{Name: "frequency", Description: "Flashes per second", Default: 2, Min: 0.5, Max: MaxStrobeFrequency},
+			{Name: "duty", Description: "Fraction of each flash the light is on", Default: 0.2, Min: 0.05, Max: 0.5},
+			{Name: "duration", Description: "Seconds before the strobe stops by itself", Default: 10, Min: 1, Max: MaxStrobeDuration},
+		},
+		New: func(p Params) Effect {
+			return &strobe{
+				period:   seconds(1 / p["frequency"]),
+				duty:     p["duty"],
+				duration: seconds(p["duration"]),
+			}
+		},
+	})
+}
+
+// seconds converts fractional seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// phase returns how far t is through a repeating period (0-1)
+func phase(t, period time.Duration) float64 {
+	return float64(t%period) / float64(period)
+}
+
+// scale multiplies every output of a state by a factor (0-1)
+func scale(device Device, base State, factor float64) State {
+	out := base.Clone()
+	switch device {
+	case DeviceLEDStrip:
+		for i, v := range base.RGB {
+			out.RGB[i] = int(math.Round(float64(v) * factor))
+		}
+	case DeviceLEDBar:
+		for i, v := range base.Channels {
+			out.Channels[i] = int(math.Round(float64(v) * factor))
+		}
+	default:
+		out.Brightness = int(math.Round(float64(base.Brightness) * factor))
+		out.On = base.On && out.Brightness > 0
+	}
+	return out
+}
+
+// breathing fades the base state between a minimum and full brightness
+type breathing struct {
+	period time.Duration
+	min    float64
+}
+
+func (e *breathing) Render(device Device, base State, t time.Duration) (State, bool) {
+	// Start at full brightness so the effect begins without a jump
+	wave := 0.5 + 0.5*math.Cos(2*math.Pi*phase(t, e.period))
+	return scale(device, base, e.min+(1-e.min)*wave), false
+}
+
+// rainbow cycles the hue of the LED strip
+type rainbow struct {
+	period     time.Duration
+	brightness float64
+}
+
+func (e *rainbow) Render(device Device, base State, t time.Duration) (State, bool) {
+	out := base.Clone()
+	out.RGB = hueToRGB(phase(t, e.period), e.brightness)
+	return out, false
+}
+
+// hueToRGB converts a hue (0-1) at full saturation to RGB values scaled by brightness (0-1)
+func hueToRGB(hue, brightness float64) [3]int {
+	h := hue * 6
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+
+	var r, g, b float64
+	switch int(h) % 6 {
+	case 0:
+		r, g, b = 1, x, 0
+	case 1:
+		r, g, b = x, 1, 0
+	case 2:
+		r, g, b = 0, 1, x
+	case 3:
+		r, g, b = 0, x, 1
+	case 4:
+		r, g, b = x, 0, 1
+	default:
+		r, g, b = 1, 0, x
+	}
+
+	return [3]int{
+		int(math.Round(r * 255 * brightness)),
+		int(math.Round(g * 255 * brightness)),
+		int(math.Round(b * 255 * brightness)),
+	}
+}
+
+// chase lights one RGBW LED per section at a time, leaving the white LEDs alone
+type chase struct {
+	step time.Duration
+	rgbw [4]int
+}
+
+func (e *chase) Render(device Device, base State, t time.Duration) (State, bool) {
+	out := base.Clone()
+	lit := int(t/e.step) % rgbwLEDsPerSection
+
+	for section := 1; section <= 2; section++ {
+		channels := ledbar.RGBWChannels(section)
+		for led := 0; led < rgbwLEDsPerSection; led++ {
+			for c := 0; c < 4; c++ {
+				value := 0
+				if led == lit {
+					value = e.rgbw[c]
+				}
+				out.Channels[channels[led*4+c]] = value
+			}
+		}
+	}
+	return out, false
+}
+
+// candle flickers the white LEDs around an intensity, leaving the RGBW LEDs alone
+// Each LED follows its own smoothed random walk so the flame doesn't pulse in unison.
+type candle struct {
+	intensity float64
+	flicker   float64
+	rand      *rand.Rand
+	levels    map[int]float64 // current dip per channel (0-1)
+}
+
+func (e *candle) Render(device Device, base State, t time.Duration) (State, bool) {
+	if e.levels == nil {
+		e.levels = make(map[int]float64)
+	}
+
+	out := base.Clone()
+	for section := 1; section <= 2; section++ {
+		for _, ch := range ledbar.WhiteChannels(section) {
+			// Move part way towards a new random target each frame
+			target := e.rand.Float64()
+			e.levels[ch] += (target - e.levels[ch]) * 0.3
+			value := e.intensity * (1 - e.flicker*e.levels[ch])
+			out.Channels[ch] = int(math.Round(math.Max(0, math.Min(255, value))))
+		}
+	}
+	return out, false
+}
+
+// strobe flashes the base state on and off, ending after its duration
+// A light that is off (or black) when the strobe starts flashes at full white.
+type strobe struct {
+	period   time.Duration
+	duty     float64
+	duration time.Duration
+}
+
+func (e *strobe) Render(device Device, base State, t time.Duration) (State, bool) {
+	if t >= e.duration {
+		return base, true
+	}
+
+	on := base.Clone()
+	switch device {
+	case DeviceLEDStrip:
+		if on.RGB == [3]int{} {
+			on.RGB = [3]int{255, 255, 255}
+		}
+	case DeviceLEDBar:
+		if isDark(on.Channels) {
+			for section := 1; section <= 2; section++ {
+				for _, ch := range append(ledbar.RGBWChannels(section), ledbar.WhiteChannels(section)...) {
+					on.Channels[ch] = 255
+				}
+			}
+		}
+	default:
+		if !on.On || on.Brightness == 0 {
+			on.On, on.Brightness = true, 100
+		}
+	}
+
+	if phase(t, e.period) < e.duty {
+		return on, false
+	}
+	return scale(device, on, 0), false
+}
+
+// isDark reports whether every channel is off
+func isDark(channels []int) bool {
+	for _, v := range channels {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
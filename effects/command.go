@@ -0,0 +1,65 @@
+package effects
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Command starts or stops an effect, received over MQTT
+//
+// Example:
+//
+//	{"effect": "rainbow", "device": "ledStrip", "params": {"period": 5}}
+//	{"stop": "ledStrip"}
+//	{"stop": "all"}
+type Command struct {
+	Effect string `json:"effect,omitempty"`
+	Device string `json:"device,omitempty"`
+	Params Params `json:"params,omitempty"`
+	Stop   string `json:"stop,omitempty"`
+}
+
+// CommandHandler applies effect commands to an engine
+type CommandHandler struct {
+	engine *Engine
+}
+
+// NewCommandHandler creates an effect command handler
+func NewCommandHandler(engine *Engine) *CommandHandler {
+	return &CommandHandler{engine: engine}
+}
+
+// Handle decodes and applies a JSON effect command
+func (h *CommandHandler) Handle(payload []byte) error {
+	var cmd Command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return fmt.Errorf("invalid effect command: %w", err)
+	}
+	return h.Apply(cmd)
+}
+
+// Apply applies an effect command
+func (h *CommandHandler) Apply(cmd Command) error {
+	switch {
+	case cmd.Stop != "" && cmd.Effect != "":
+		return fmt.Errorf("effect command must either start or stop, not both")
+	case cmd.Stop == "all":
+		h.engine.StopAll()
+		return nil
+	case cmd.Stop != "":
+		device, err := ParseDevice(cmd.Stop)
+		if err != nil {
+			return err
+		}
+		h.engine.Stop(device)
+		return nil
+	case cmd.Effect != "":
+		device, err := ParseDevice(cmd.Device)
+		if err != nil {
+			return err
+		}
+		return h.engine.Start(cmd.Effect, device, cmd.Params)
+	default:
+		return fmt.Errorf("effect command must give an effect or stop")
+	}
+}
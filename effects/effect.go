@@ -0,0 +1,187 @@
+package effects
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device identifies a light an effect can run on
+type Device string
+
+const (
+	DeviceLEDStrip    Device = "ledStrip"
+	DeviceLEDBar      Device = "ledBar"
+	DeviceVideoLight1 Device = "videoLight1"
+	DeviceVideoLight2 Device = "videoLight2"
+)
+
+// Devices lists every device in display order
+var Devices = []Device{DeviceLEDStrip, DeviceLEDBar, DeviceVideoLight1, DeviceVideoLight2}
+
+// ParseDevice validates a device name
+func ParseDevice(name string) (Device, error) {
+	for _, d := range Devices {
+		if string(d) == name {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("unknown device %q (use ledStrip, ledBar, videoLight1 or videoLight2)", name)
+}
+
+// State is the output of one device
+// Only the fields for the device's type are used.
+type State struct {
+	RGB        [3]int // LED strip
+	Channels   []int  // LED bar, 77 channels
+	On         bool   // video light
+	Brightness int    // video light, 0-100
+}
+
+// Clone returns a copy that doesn't share the channel slice
+func (s State) Clone() State {
+	s.Channels = append([]int(nil), s.Channels...)
+	return s
+}
+
+// Equal reports whether two states produce the same output
+func (s State) Equal(other State) bool {
+	if s.RGB != other.RGB || s.On != other.On || s.Brightness != other.Brightness {
+		return false
+	}
+	if len(s.Channels) != len(other.Channels) {
+		return false
+	}
+	for i := range s.Channels {
+		if s.Channels[i] != other.Channels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Effect renders an animation for one device
+//
+// An effect instance is created per device each time it is started, so it
+// may keep state between frames.
+type Effect interface {
+	// Render returns the device output at time t since the effect started.
+	// base is the state the effect runs over: the state when it was started,
+	// or the latest manual change for effects that blend. done ends the effect.
+	Render(device Device, base State, t time.Duration) (out State, done bool)
+}
+
+// Params holds effect parameters by name
+type Params map[string]float64
+
+// ParamSpec describes one effect parameter
+type ParamSpec struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Default     float64 `json:"default"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+}
+
+// Definition describes an effect and how to create it
+type Definition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Devices     []Device    `json:"devices"`
+	Params      []ParamSpec `json:"params"`
+
+	// Blend keeps the effect running over manual changes (they become the new base).
+	// Otherwise a manual change stops the effect.
+	Blend bool `json:"blend"`
+
+	// New creates an effect instance from validated parameters
+	New func(params Params) Effect `json:"-"`
+}
+
+// Supports reports whether the effect can run on a device
+func (d *Definition) Supports(device Device) bool {
+	for _, supported := range d.Devices {
+		if supported == device {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveParams fills in defaults and checks values against the parameter limits
+func (d *Definition) ResolveParams(params Params) (Params, error) {
+	resolved := make(Params, len(d.Params))
+	known := make(map[string]bool, len(d.Params))
+	for _, spec := range d.Params {
+		known[spec.Name] = true
+		value, ok := params[spec.Name]
+		if !ok {
+			value = spec.Default
+		}
+		if value < spec.Min || value > spec.Max {
+			return nil, fmt.Errorf("%s: %s must be between %g and %g, got %g", d.Name, spec.Name, spec.Min, spec.Max, value)
+		}
+		resolved[spec.Name] = value
+	}
+	for name := range params {
+		if !known[name] {
+			return nil, fmt.Errorf("%s: unknown parameter %q", d.Name, name)
+		}
+	}
+	return resolved, nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]*Definition)
+)
+
+// Register adds an effect so it can be started by name
+func Register(def *Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[def.Name] = def
+}
+
+// Lookup returns a registered effect by name
+func Lookup(name string) (*Definition, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	def, ok := registry[name]
+	if !ok {
+		names := make([]string, 0, len(registry))
+		for n := range registry {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown effect %q (use one of: %s)", name, strings.Join(names, ", "))
+	}
+	return def, nil
+}
+
+// List returns all registered effects sorted by name
+func List() []*Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	defs := make([]*Definition, 0, len(registry))
+	for _, def := range registry {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// ForDevice returns the registered effects that support a device, sorted by name
+func ForDevice(device Device) []*Definition {
+	var defs []*Definition
+	for _, def := range List() {
+		if def.Supports(device) {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
@@ -0,0 +1,370 @@
+package effects
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// newTestEngine creates an effects engine on a fake clock with mock lights
+func newTestEngine(t *testing.T) (*Engine, *clock.Fake, *mqtt.MockPublisher) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, err := videolight.NewVideoLight(1, mock, "test/vl1")
+	if err != nil {
+		t.Fatalf("NewVideoLight failed: %v", err)
+	}
+	vl2, err := videolight.NewVideoLight(2, mock, "test/vl2")
+	if err != nil {
+		t.Fatalf("NewVideoLight failed: %v", err)
+	}
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngine(lights.NewRig(strip, bar, vl1, vl2), fake)
+	t.Cleanup(engine.StopAll)
+	return engine, fake, mock
+}
+
+// step advances the fake clock by one frame once the effect is waiting for it,
+// then waits for the frame to be published
+func step(fake *clock.Fake) {
+	fake.BlockUntil(1)
+	fake.Advance(50 * time.Millisecond)
+	fake.BlockUntil(1)
+}
+
+// waitIdle waits for every effect to end by itself
+func waitIdle(t *testing.T, engine *Engine) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(engine.Running()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Effects still running: %v", engine.Running())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestResolveParams(t *testing.T) {
+	strobe, err := Lookup("strobe")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		params    Params
+		wantError bool
+	}{
+		{"defaults", nil, false},
+		{"within limits", Params{"frequency": 3, "duration": 60}, false},
+		{"too fast", Params{"frequency": 10}, true},
+		{"too long", Params{"duration": 600}, true},
+		{"unknown parameter", Params{"speed": 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := strobe.ResolveParams(tt.params)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ResolveParams() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err == nil && resolved["duty"] != 0.2 {
+				t.Errorf("Expected default duty 0.2, got %v", resolved["duty"])
+			}
+		})
+	}
+}
+
+func TestSupportedDevices(t *testing.T) {
+	tests := []struct {
+		device Device
+		want   []string
+	}{
+		{DeviceLEDStrip, []string{"breathing", "rainbow", "strobe"}},
+		{DeviceLEDBar, []string{"breathing", "candle", "chase", "strobe"}},
+		{DeviceVideoLight1, []string{"breathing", "strobe"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, def := range ForDevice(tt.device) {
+			got = append(got, def.Name)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.device, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: expected %v, got %v", tt.device, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestBreathingRender(t *testing.T) {
+	def, _ := Lookup("breathing")
+	effect := def.New(Params{"period": 4, "min": 0.5})
+	base := State{RGB: [3]int{200, 100, 0}}
+
+	out, _ := effect.Render(DeviceLEDStrip, base, 0)
+	if out.RGB != base.RGB {
+		t.Errorf("Expected full brightness at start, got %v", out.RGB)
+	}
+	out, _ = effect.Render(DeviceLEDStrip, base, 2*time.Second)
+	if out.RGB != [3]int{100, 50, 0} {
+		t.Errorf("Expected minimum brightness half way through, got %v", out.RGB)
+	}
+}
+
+func TestChaseRender(t *testing.T) {
+	def, _ := Lookup("chase")
+	effect := def.New(Params{"step": 100, "r": 255, "g": 0, "b": 0, "w": 0})
+	base := State{Channels: make([]int, ledbar.ChannelCount)}
+	base.Channels[ledbar.WhiteChannels(1)[0]] = 42
+
+	for led := 0; led < 8; led++ {
+		out, _ := effect.Render(DeviceLEDBar, base, time.Duration(led)*100*time.Millisecond)
+		lit := led % 6
+		for section := 1; section <= 2; section++ {
+			red := out.Channels[ledbar.RGBWChannels(section)[lit*4]]
+			if red != 255 {
+				t.Errorf("Step %d: expected LED %d of section %d lit, got %d", led, lit, section, red)
+			}
+		}
+		if out.Channels[ledbar.WhiteChannels(1)[0]] != 42 {
+			t.Errorf("Step %d: chase changed the white LEDs", led)
+		}
+	}
+}
+
+func TestCandleOnlyTouchesWhite(t *testing.T) {
+	def, _ := Lookup("candle")
+	effect := def.New(Params{"intensity": 200, "flicker": 0.5})
+	base := State{Channels: make([]int, ledbar.ChannelCount)}
+	rgbw := ledbar.RGBWChannels(2)
+	base.Channels[rgbw[0]] = 77
+
+	for i := 0; i < 20; i++ {
+		out, _ := effect.Render(DeviceLEDBar, base, time.Duration(i)*50*time.Millisecond)
+		if out.Channels[rgbw[0]] != 77 {
+			t.Fatalf("Candle changed an RGBW LED")
+		}
+		for _, ch := range ledbar.WhiteChannels(1) {
+			if out.Channels[ch] < 100 || out.Channels[ch] > 200 {
+				t.Fatalf("White LED %d out of flicker range: %d", ch, out.Channels[ch])
+			}
+		}
+	}
+}
+
+func TestEngineStopRestores(t *testing.T) {
+	engine, fake, mock := newTestEngine(t)
+	strip := engine.rig.Strip
+	strip.SetColor(100, 50, 0)
+	mock.Clear()
+
+	if err := engine.Start("breathing", DeviceLEDStrip, Params{"period": 1, "min": 0}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+	if mock.MessageCount() == 0 {
+		t.Fatal("Expected effect frames to be published")
+	}
+	if r, g, _ := strip.GetColor(); r == 100 && g == 50 {
+		t.Error("Expected the strip to be dimmed mid breath")
+	}
+
+	engine.Stop(DeviceLEDStrip)
+	if r, g, b := strip.GetColor(); r != 100 || g != 50 || b != 0 {
+		t.Errorf("Expected strip restored to 100,50,0, got %d,%d,%d", r, g, b)
+	}
+	if len(engine.Running()) != 0 {
+		t.Errorf("Expected no running effects, got %v", engine.Running())
+	}
+}
+
+func TestEngineConcurrentStart(t *testing.T) {
+	engine, fake, mock := newTestEngine(t)
+	strip := engine.rig.Strip
+	strip.SetColor(100, 50, 0)
+
+	// Every Start replaces the effect before it, so one is left to stop
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := engine.Start("breathing", DeviceLEDStrip, Params{"period": 1, "min": 0}); err != nil {
+				t.Errorf("Start failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	engine.Stop(DeviceLEDStrip)
+
+	// An orphaned effect would keep publishing frames
+	mock.Clear()
+	for i := 0; i < 10; i++ {
+		fake.Advance(50 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	if mock.MessageCount() != 0 {
+		t.Errorf("Frames published after Stop: %d", mock.MessageCount())
+	}
+	if r, g, b := strip.GetColor(); r != 100 || g != 50 || b != 0 {
+		t.Errorf("Expected strip restored to 100,50,0, got %d,%d,%d", r, g, b)
+	}
+}
+
+func TestEngineStopsOnManualChange(t *testing.T) {
+	engine, fake, _ := newTestEngine(t)
+	strip := engine.rig.Strip
+
+	if err := engine.Start("rainbow", DeviceLEDStrip, nil); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	step(fake)
+
+	strip.SetColor(1, 2, 3)
+	fake.Advance(50 * time.Millisecond)
+	waitIdle(t, engine)
+
+	if r, g, b := strip.GetColor(); r != 1 || g != 2 || b != 3 {
+		t.Errorf("Expected manual colour to stick, got %d,%d,%d", r, g, b)
+	}
+}
+
+func TestEngineBlendsManualChange(t *testing.T) {
+	engine, fake, _ := newTestEngine(t)
+	light := engine.rig.VideoLight1
+	light.SetState(true, 80)
+
+	if err := engine.Start("breathing", DeviceVideoLight1, Params{"period": 2, "min": 0.5}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	step(fake)
+
+	light.SetState(true, 40)
+	for i := 0; i < 10; i++ {
+		step(fake)
+		if _, brightness := light.GetState(); brightness > 40 || brightness < 20 {
+			t.Fatalf("Expected breathing over the new brightness 40, got %d", brightness)
+		}
+	}
+	if _, ok := engine.RunningOn(DeviceVideoLight1); !ok {
+		t.Fatal("Expected breathing to keep running")
+	}
+
+	engine.Stop(DeviceVideoLight1)
+	if on, brightness := light.GetState(); !on || brightness != 40 {
+		t.Errorf("Expected restore to the manual state, got on=%v brightness=%d", on, brightness)
+	}
+}
+
+func TestStrobeStopsByItself(t *testing.T) {
+	engine, fake, _ := newTestEngine(t)
+	light := engine.rig.VideoLight2
+
+	if err := engine.Start("strobe", DeviceVideoLight2, Params{"duration": 1}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	sawOn := false
+	for i := 0; i < 19; i++ {
+		step(fake)
+		if on, _ := light.GetState(); on {
+			sawOn = true
+		}
+	}
+	if !sawOn {
+		t.Error("Expected the strobe to flash the light on")
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(50 * time.Millisecond)
+	waitIdle(t, engine)
+
+	if on, brightness := light.GetState(); on || brightness != 0 {
+		t.Errorf("Expected the light back off, got on=%v brightness=%d", on, brightness)
+	}
+}
+
+func TestSceneRecallInterruptsEffect(t *testing.T) {
+	engine, fake, _ := newTestEngine(t)
+	transitions := lights.NewTransitionEngine(engine.rig, fake)
+	transitions.OnApply(engine.Interrupt)
+
+	if err := engine.Start("rainbow", DeviceLEDStrip, nil); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := engine.Start("chase", DeviceLEDBar, nil); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	fake.BlockUntil(2)
+
+	scene := &storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 10, Green: 20, Blue: 30}}
+	if err := transitions.Apply(scene, lights.Transition{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if r, g, b := engine.rig.Strip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Expected the scene colour, got %d,%d,%d", r, g, b)
+	}
+	running := engine.Running()
+	if len(running) != 1 || running[0].Device != DeviceLEDBar {
+		t.Errorf("Expected only the LED bar effect to keep running, got %v", running)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	handler := NewCommandHandler(engine)
+
+	tests := []struct {
+		name      string
+		payload   string
+		wantError bool
+		wantCount int
+	}{
+		{"start", `{"effect":"rainbow","device":"ledStrip","params":{"period":5}}`, false, 1},
+		{"start another", `{"effect":"breathing","device":"videoLight1"}`, false, 2},
+		{"unsupported device", `{"effect":"rainbow","device":"ledBar"}`, true, 2},
+		{"unknown effect", `{"effect":"disco","device":"ledStrip"}`, true, 2},
+		{"unsafe strobe", `{"effect":"strobe","device":"ledStrip","params":{"frequency":20}}`, true, 2},
+		{"stop one", `{"stop":"ledStrip"}`, false, 1},
+		{"stop all", `{"stop":"all"}`, false, 0},
+		{"empty", `{}`, true, 0},
+		{"invalid json", `{`, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handler.Handle([]byte(tt.payload))
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Handle() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got := len(engine.Running()); got != tt.wantCount {
+				t.Errorf("Expected %d running effects, got %d", tt.wantCount, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package effects
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Status describes an effect running on a device
+type Status struct {
+	Device  Device    `json:"device"`
+	Effect  string    `json:"effect"`
+	Params  Params    `json:"params"`
+	Started time.Time `json:"started"`
+}
+
+// Engine runs effects on the lights of a rig, one goroutine per device
+//
+// Frames are published without being saved. Stopping an effect puts the
+// device back to the state it had underneath the effect and saves that.
+// When something else changes a device while an effect runs, blending effects
+// carry on over the new state and the others stop, leaving the change alone.
+type Engine struct {
+	rig           *lights.Rig
+	clock         clock.Clock
+	frameInterval time.Duration
+
+	mu      sync.Mutex
+	running map[Device]*run
+}
+
+// run is one effect running on one device
+type run struct {
+	def     *Definition
+	effect  Effect
+	params  Params
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+
+	// keep leaves the device at its last frame when stopped, instead of restoring it
+	keep bool
+}
+
+// NewEngine creates an effects engine for a rig
+func NewEngine(rig *lights.Rig, clk clock.Clock) *Engine {
+	return &Engine{
+		rig:           rig,
+		clock:         clk,
+		frameInterval: time.Second / lights.DefaultFrameRate,
+		running:       make(map[Device]*run),
+	}
+}
+
+// Start runs an effect on a device, replacing any effect already running there
+// Missing parameters take their defaults.
+func (e *Engine) Start(name string, device Device, params Params) error {
+	def, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	if !def.Supports(device) {
+		return fmt.Errorf("effect %q doesn't support %s", name, device)
+	}
+	resolved, err := def.ResolveParams(params)
+	if err != nil {
+		return err
+	}
+
+	r := &run{
+		def:     def,
+		effect:  def.New(resolved),
+		params:  resolved,
+		started: e.clock.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	// Swap the runs in one go, so a concurrent Start can't leave an effect running unseen
+	e.mu.Lock()
+	old := e.running[device]
+	e.running[device] = r
+	if old != nil {
+		old.keep = false
+	}
+	e.mu.Unlock()
+
+	// The new effect starts from the state the old one restores
+	if old != nil {
+		close(old.stop)
+		<-old.done
+	}
+
+	log.Printf("Effects: Starting %s on %s", name, device)
+	go e.run(device, r)
+	return nil
+}
+
+// Stop ends the effect on a device and restores the state underneath it
+func (e *Engine) Stop(device Device) {
+	e.end(device, false)
+}
+
+// end stops the effect on a device and waits for it, optionally leaving the last frame in place
+func (e *Engine) end(device Device, keep bool) {
+	e.mu.Lock()
+	r := e.running[device]
+	delete(e.running, device)
+	if r != nil {
+		r.keep = keep
+	}
+	e.mu.Unlock()
+
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
+
+// StopAll ends every running effect
+func (e *Engine) StopAll() {
+	for _, device := range Devices {
+		e.Stop(device)
+	}
+}
+
+// Interrupt ends the effects on the lights a scene is about to change, without restoring them
+// Pass it to TransitionEngine.OnApply so scene recalls take over from effects.
+func (e *Engine) Interrupt(data *storage.SceneData) {
+	var devices []Device
+	if data.LEDStrip != nil {
+		devices = append(devices, DeviceLEDStrip)
+	}
+	if len(data.LEDBarLEDs) > 0 {
+		devices = append(devices, DeviceLEDBar)
+	}
+	for _, vl := range data.VideoLights {
+		switch vl.ID {
+		case 0:
+			devices = append(devices, DeviceVideoLight1)
+		case 1:
+			devices = append(devices, DeviceVideoLight2)
+		}
+	}
+
+	for _, device := range devices {
+		e.end(device, true)
+	}
+}
+
+// Running returns the effects currently running, in device order
+func (e *Engine) Running() []Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var statuses []Status
+	for _, device := range Devices {
+		if r, ok := e.running[device]; ok {
+			statuses = append(statuses, Status{
+				Device:  device,
+				Effect:  r.def.Name,
+				Params:  r.params,
+				Started: r.started,
+			})
+		}
+	}
+	return statuses
+}
+
+// RunningOn returns the effect running on a device, if any
+func (e *Engine) RunningOn(device Device) (Status, bool) {
+	for _, status := range e.Running() {
+		if status.Device == device {
+			return status, true
+		}
+	}
+	return Status{}, false
+}
+
+// run publishes frames until the effect ends, is stopped or yields to a manual change
+func (e *Engine) run(device Device, r *run) {
+	defer close(r.done)
+	defer e.finished(device, r)
+
+	base := e.read(device)
+	last := base
+
+	for {
+		select {
+		case <-r.stop:
+			e.mu.Lock()
+			keep := r.keep
+			e.mu.Unlock()
+			if !keep {
+				if err := e.restore(device, base); err != nil {
+					log.Printf("Effects: Failed to restore %s: %v", device, err)
+				}
+			}
+			return
+		case <-e.clock.After(e.frameInterval):
+		}
+
+		if current := e.read(device); !current.Equal(last) {
+			if !r.def.Blend {
+				log.Printf("Effects: %s changed elsewhere, stopping %s", device, r.def.Name)
+				return
+			}
+			base = current
+		}
+
+		out, done := r.effect.Render(device, base, e.clock.Now().Sub(r.started))
+		if done {
+			log.Printf("Effects: %s finished on %s", r.def.Name, device)
+			if err := e.restore(device, base); err != nil {
+				log.Printf("Effects: Failed to restore %s: %v", device, err)
+			}
+			return
+		}
+		if !out.Equal(last) {
+			if err := e.writeFrame(device, out); err != nil {
+				log.Printf("Effects: %s frame failed on %s: %v", r.def.Name, device, err)
+			}
+			// Read back rather than keeping out, so values the driver ignores don't look like changes
+			last = e.read(device)
+		}
+	}
+}
+
+// finished removes a run that ended by itself from the running effects
+func (e *Engine) finished(device Device, r *run) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running[device] == r {
+		delete(e.running, device)
+	}
+}
+
+// read returns the current output of a device
+func (e *Engine) read(device Device) State {
+	switch device {
+	case DeviceLEDStrip:
+		r, g, b := e.rig.Strip.GetColor()
+		return State{RGB: [3]int{r, g, b}}
+	case DeviceLEDBar:
+		return State{Channels: e.rig.Bar.GetChannels()}
+	case DeviceVideoLight1:
+		on, brightness := e.rig.VideoLight1.GetState()
+		return State{On: on, Brightness: brightness}
+	default:
+		on, brightness := e.rig.VideoLight2.GetState()
+		return State{On: on, Brightness: brightness}
+	}
+}
+
+// writeFrame publishes a device state without saving it
+func (e *Engine) writeFrame(device Device, s State) error {
+	switch device {
+	case DeviceLEDStrip:
+		return e.rig.Strip.SetColorFrame(s.RGB[0], s.RGB[1], s.RGB[2])
+	case DeviceLEDBar:
+		return e.rig.Bar.SetChannelsFrame(s.Channels)
+	case DeviceVideoLight1:
+		return e.rig.VideoLight1.SetStateFrame(s.On, s.Brightness)
+	default:
+		return e.rig.VideoLight2.SetStateFrame(s.On, s.Brightness)
+	}
+}
+
+// restore sets and saves a device state
+func (e *Engine) restore(device Device, s State) error {
+	switch device {
+	case DeviceLEDStrip:
+		return e.rig.Strip.SetColor(s.RGB[0], s.RGB[1], s.RGB[2])
+	case DeviceLEDBar:
+		return e.rig.Bar.SetChannels(s.Channels)
+	case DeviceVideoLight1:
+		return e.rig.VideoLight1.SetState(s.On, s.Brightness)
+	default:
+		return e.rig.VideoLight2.SetState(s.On, s.Brightness)
+	}
+}
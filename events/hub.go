@@ -0,0 +1,77 @@
+// Package events tells listeners, such as the web interface's event stream, when the lights change
+//
+// Wrapping the publisher the light drivers send through in a Hub means every
+// change reaches the listeners, whichever interface or automation made it.
+package events
+
+import "sync"
+
+// Publisher defines the interface for publishing MQTT messages, as the light drivers use it
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
+
+// Hub signals its subscribers whenever something is published through it
+//
+// Signals are coalesced: a subscriber that hasn't caught up yet is signalled
+// once however many changes it missed, so a slow listener never holds up the
+// lights.
+type Hub struct {
+	publisher Publisher
+
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// NewHub creates a hub publishing through publisher
+func NewHub(publisher Publisher) *Hub {
+	return &Hub{
+		publisher:   publisher,
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Publish publishes a message and signals the subscribers once it has gone
+func (h *Hub) Publish(topic string, payload interface{}) error {
+	if err := h.publisher.Publish(topic, payload); err != nil {
+		return err
+	}
+	h.Changed()
+	return nil
+}
+
+// Changed signals every subscriber
+func (h *Hub) Changed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// Already signalled and not yet caught up
+		}
+	}
+}
+
+// Subscribe returns a channel signalled after changes and a function to unsubscribe
+func (h *Hub) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Subscribers returns the number of subscribers
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kevin/office_lights/mqtt"
+)
+
+// failingPublisher fails every publish
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(topic string, payload interface{}) error {
+	return errors.New("not connected")
+}
+
+func TestPublishSignalsSubscribers(t *testing.T) {
+	mock := mqtt.NewMockPublisher()
+	hub := NewHub(mock)
+
+	first, unsubscribe := hub.Subscribe()
+	second, _ := hub.Subscribe()
+
+	if err := hub.Publish("test/strip", "payload"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if mock.MessageCount() != 1 {
+		t.Errorf("Expected the message to be passed on, got %d messages", mock.MessageCount())
+	}
+
+	for i, ch := range []<-chan struct{}{first, second} {
+		select {
+		case <-ch:
+		default:
+			t.Errorf("Expected subscriber %d to be signalled", i)
+		}
+	}
+
+	unsubscribe()
+	if hub.Subscribers() != 1 {
+		t.Errorf("Expected 1 subscriber after unsubscribing, got %d", hub.Subscribers())
+	}
+	hub.Changed()
+	select {
+	case <-first:
+		t.Error("Expected no signal after unsubscribing")
+	default:
+	}
+}
+
+func TestSignalsCoalesce(t *testing.T) {
+	hub := NewHub(mqtt.NewMockPublisher())
+	ch, _ := hub.Subscribe()
+
+	// A subscriber that hasn't caught up is signalled once, and publishing never blocks
+	for i := 0; i < 10; i++ {
+		hub.Publish("test/strip", i)
+	}
+
+	<-ch
+	select {
+	case <-ch:
+		t.Error("Expected the signals to be coalesced into one")
+	default:
+	}
+}
+
+func TestFailedPublishDoesNotSignal(t *testing.T) {
+	hub := NewHub(failingPublisher{})
+	ch, _ := hub.Subscribe()
+
+	if err := hub.Publish("test/strip", "payload"); err == nil {
+		t.Fatal("Expected the publish error to be returned")
+	}
+	select {
+	case <-ch:
+		t.Error("Expected no signal for a failed publish")
+	default:
+	}
+}
@@ -0,0 +1,11 @@
+package history
+
+import "errors"
+
+var (
+	// ErrNothingToUndo is returned by Undo when the lights are at the oldest saved state
+	ErrNothingToUndo = errors.New("nothing to undo")
+
+	// ErrNothingToRedo is returned by Redo when no undone edit is left to redo
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
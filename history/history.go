@@ -0,0 +1,270 @@
+// Package history keeps an undo history of the lights
+//
+// The history watches the lights through the events hub and records the state
+// of every light once they have been still for Settle, or for at most MaxWait,
+// so a dial spin, a fade or a burst of web requests counts as one edit. Undo and Redo step back and
+// forth through the recorded states; a new edit after an undo drops the states
+// that could have been redone. The history is saved in the store and picked up
+// again by Start after a restart.
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Settle is how long the lights must stay still before a change is recorded as an edit
+const Settle = time.Second
+
+// MaxWait is the longest a change is held back while the lights keep changing,
+// so an effect or sequence that keeps them moving is recorded this often
+const MaxWait = 10 * time.Second
+
+// DefaultLimit is how many states are kept
+const DefaultLimit = 100
+
+// Status says how far the history can be undone and redone
+type Status struct {
+	Undo int `json:"undo"` // edits that can be undone
+	Redo int `json:"redo"` // undone edits that can be redone
+}
+
+// History records the lights after each edit and puts them back on Undo and Redo
+type History struct {
+	engine *lights.TransitionEngine
+	store  storage.HistoryStore
+	clock  clock.Clock
+	limit  int
+
+	mu        sync.Mutex
+	onRestore []func()
+	entries   []storage.HistoryEntry // oldest first; the undone ones at the end
+	current   int                    // index of the entry the lights are at, or -1 if there are none
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewHistory creates an undo history for the lights of a transition engine,
+// keeping the last limit states
+func NewHistory(engine *lights.TransitionEngine, store storage.HistoryStore, clk clock.Clock, limit int) *History {
+	return &History{
+		engine:  engine,
+		store:   store,
+		clock:   clk,
+		limit:   limit,
+		current: -1,
+	}
+}
+
+// Start loads the saved history, records the lights as they are now if they
+// differ from it, and records an edit whenever the hub shows a change, until Stop
+func (h *History) Start(hub *events.Hub) error {
+	entries, err := h.store.ListHistory()
+	if err != nil {
+		return fmt.Errorf("failed to load history: %w", err)
+	}
+
+	h.mu.Lock()
+	h.entries = entries
+	h.current = len(entries) - 1
+	for h.current >= 0 && entries[h.current].Undone {
+		h.current--
+	}
+	err = h.commit()
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+	changed, unsubscribe := hub.Subscribe()
+	go func() {
+		defer close(h.done)
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-changed:
+			case <-h.stop:
+				return
+			}
+			if !h.settle(changed) {
+				return
+			}
+
+			h.mu.Lock()
+			if err := h.commit(); err != nil {
+				log.Printf("History: %v", err)
+			}
+			h.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Stop stops recording edits
+func (h *History) Stop() {
+	if h.stop == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+	h.stop = nil
+}
+
+// Status returns how many edits can be undone and redone
+func (h *History) Status() Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status()
+}
+
+// OnRestore registers a function called before Undo and Redo change the lights,
+// so effects and sequences can stop first rather than being recorded as an edit
+// or drawing over the restored lights
+func (h *History) OnRestore(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onRestore = append(h.onRestore, fn)
+}
+
+// Undo puts the lights back as they were before the last edit
+// A change that hasn't settled yet counts as the last edit.
+func (h *History) Undo() (Status, error) {
+	h.restoring()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.commit(); err != nil {
+		return h.status(), err
+	}
+	if h.current < 1 {
+		return h.status(), ErrNothingToUndo
+	}
+
+	if err := h.store.SetHistoryUndone(h.entries[h.current].ID, true); err != nil {
+		return h.status(), fmt.Errorf("failed to save history: %w", err)
+	}
+	h.entries[h.current].Undone = true
+	h.current--
+
+	log.Printf("History: Undone (%d more to undo)", h.current)
+	return h.status(), h.apply()
+}
+
+// Redo makes the last undone edit again
+func (h *History) Redo() (Status, error) {
+	h.restoring()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Changing the lights since the undo drops what could be redone
+	if err := h.commit(); err != nil {
+		return h.status(), err
+	}
+	if h.current+1 >= len(h.entries) {
+		return h.status(), ErrNothingToRedo
+	}
+
+	if err := h.store.SetHistoryUndone(h.entries[h.current+1].ID, false); err != nil {
+		return h.status(), fmt.Errorf("failed to save history: %w", err)
+	}
+	h.current++
+	h.entries[h.current].Undone = false
+
+	log.Printf("History: Redone (%d more to redo)", len(h.entries)-h.current-1)
+	return h.status(), h.apply()
+}
+
+// restoring calls the OnRestore functions
+func (h *History) restoring() {
+	h.mu.Lock()
+	hooks := h.onRestore
+	h.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// settle waits until no change has come for Settle, or MaxWait has passed,
+// returning false if the history is stopped meanwhile
+func (h *History) settle(changed <-chan struct{}) bool {
+	deadline := h.clock.After(MaxWait)
+	for {
+		select {
+		case <-changed:
+		case <-h.clock.After(Settle):
+			return true
+		case <-deadline:
+			return true
+		case <-h.stop:
+			return false
+		}
+	}
+}
+
+// commit records the lights as a new edit if they differ from the current entry
+// It must be called with h.mu held.
+func (h *History) commit() error {
+	data := h.engine.Rig().Capture(lights.SelectAll())
+	if h.current >= 0 {
+		same, err := equal(data, h.entries[h.current].Data)
+		if err != nil || same {
+			return err
+		}
+	}
+
+	entry, err := h.store.AddHistory(data, h.limit)
+	if err != nil {
+		return fmt.Errorf("failed to save history: %w", err)
+	}
+
+	entries := append(h.entries[:h.current+1], *entry)
+	if len(entries) > h.limit {
+		entries = entries[len(entries)-h.limit:]
+	}
+	h.entries = entries
+	h.current = len(entries) - 1
+	return nil
+}
+
+// apply sets the lights to the current entry straight away
+// It must be called with h.mu held.
+func (h *History) apply() error {
+	if err := h.engine.Apply(h.entries[h.current].Data, lights.Transition{}); err != nil {
+		return fmt.Errorf("failed to apply history: %w", err)
+	}
+	return nil
+}
+
+// status returns how many edits can be undone and redone
+// It must be called with h.mu held.
+func (h *History) status() Status {
+	return Status{Undo: max(h.current, 0), Redo: len(h.entries) - h.current - 1}
+}
+
+// equal reports whether two light states encode the same
+func equal(a, b *storage.SceneData) (bool, error) {
+	encodedA, err := json.Marshal(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode lights: %w", err)
+	}
+	encodedB, err := json.Marshal(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode lights: %w", err)
+	}
+	return bytes.Equal(encodedA, encodedB), nil
+}
@@ -0,0 +1,279 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+var start = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// newTestHistory creates a started history on a fake clock with mock lights publishing through a hub
+func newTestHistory(t *testing.T, limit int) (*History, *lights.Rig, *clock.Fake, *storage.Database, *events.Hub) {
+	t.Helper()
+
+	hub := events.NewHub(mqtt.NewMockPublisher())
+	bar, err := ledbar.NewLEDBar(0, hub, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, hub, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, hub, "test/vl2")
+	rig := lights.NewRig(ledstrip.NewLEDStrip(hub, "test/strip"), bar, vl1, vl2)
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	fake := clock.NewFake(start)
+	engine := lights.NewTransitionEngine(rig, fake)
+	h := NewHistory(engine, db, fake, limit)
+	if err := h.Start(hub); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(h.Stop)
+	return h, rig, fake, db, hub
+}
+
+// settleTo lets the clock run until the history reaches the wanted status,
+// failing the test after a second
+func settleTo(t *testing.T, h *History, clk *clock.Fake, want Status) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for h.Status() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for status %+v, have %+v", want, h.Status())
+		}
+		clk.Advance(Settle)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	h, rig, clk, _, _ := newTestHistory(t, DefaultLimit)
+
+	if status := h.Status(); status != (Status{}) {
+		t.Fatalf("Status() of a new history = %+v", status)
+	}
+	if _, err := h.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected ErrNothingToUndo, got %v", err)
+	}
+
+	// A dial spin is one edit
+	for level := 10; level <= 50; level += 10 {
+		rig.Strip.SetColor(level, 0, 0)
+	}
+	settleTo(t, h, clk, Status{Undo: 1})
+
+	rig.VideoLight1.TurnOn(60)
+	settleTo(t, h, clk, Status{Undo: 2})
+
+	status, err := h.Undo()
+	if err != nil || status != (Status{Undo: 1, Redo: 1}) {
+		t.Fatalf("Undo() = %+v, %v", status, err)
+	}
+	if on, _ := rig.VideoLight1.GetState(); on {
+		t.Error("Expected the video light off again")
+	}
+	if r, _, _ := rig.Strip.GetColor(); r != 50 {
+		t.Errorf("Expected the strip to keep its colour, got red %d", r)
+	}
+
+	// Putting the lights back isn't an edit of its own
+	for i := 0; i < 3; i++ {
+		clk.Advance(Settle)
+		time.Sleep(time.Millisecond)
+	}
+	if status := h.Status(); status != (Status{Undo: 1, Redo: 1}) {
+		t.Errorf("Undo recorded as an edit: %+v", status)
+	}
+
+	if _, err := h.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if r, _, _ := rig.Strip.GetColor(); r != 0 {
+		t.Errorf("Expected the strip off, got red %d", r)
+	}
+
+	status, err = h.Redo()
+	if err != nil || status != (Status{Undo: 1, Redo: 1}) {
+		t.Fatalf("Redo() = %+v, %v", status, err)
+	}
+	if r, _, _ := rig.Strip.GetColor(); r != 50 {
+		t.Errorf("Expected the strip back at red 50, got %d", r)
+	}
+
+	// A new edit, even one that hasn't settled, drops what could be redone
+	rig.VideoLight2.TurnOn(30)
+	if _, err := h.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Expected ErrNothingToRedo, got %v", err)
+	}
+	if status := h.Status(); status != (Status{Undo: 2}) {
+		t.Errorf("Status() after a new edit = %+v", status)
+	}
+}
+
+func TestUndoUnsettledChange(t *testing.T) {
+	h, rig, _, _, _ := newTestHistory(t, DefaultLimit)
+
+	rig.Strip.SetColor(0, 0, 200)
+	status, err := h.Undo()
+	if err != nil || status != (Status{Redo: 1}) {
+		t.Fatalf("Undo() = %+v, %v", status, err)
+	}
+	if _, _, b := rig.Strip.GetColor(); b != 0 {
+		t.Errorf("Expected the change undone, got blue %d", b)
+	}
+}
+
+func TestUndoStopsEffects(t *testing.T) {
+	h, rig, clk, _, _ := newTestHistory(t, DefaultLimit)
+	engine := effects.NewEngine(rig, clk)
+	t.Cleanup(engine.StopAll)
+	h.OnRestore(engine.StopAll)
+
+	rig.Strip.SetColor(100, 0, 0)
+	settleTo(t, h, clk, Status{Undo: 1})
+
+	if err := engine.Start("rainbow", effects.DeviceLEDStrip, effects.Params{"period": 1}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		clk.Advance(50 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+
+	// The effect's frames aren't an edit, so undo goes back past the red
+	status, err := h.Undo()
+	if err != nil || status != (Status{Redo: 1}) {
+		t.Fatalf("Undo() = %+v, %v", status, err)
+	}
+	if running := engine.Running(); len(running) != 0 {
+		t.Errorf("Expected the effect stopped, got %v", running)
+	}
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("Expected the strip off, got %d,%d,%d", r, g, b)
+	}
+}
+
+func TestHistoryRestart(t *testing.T) {
+	h, rig, clk, db, hub := newTestHistory(t, DefaultLimit)
+
+	rig.Strip.SetColor(100, 0, 0)
+	settleTo(t, h, clk, Status{Undo: 1})
+	rig.Strip.SetColor(200, 0, 0)
+	settleTo(t, h, clk, Status{Undo: 2})
+	if _, err := h.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	h.Stop()
+
+	restarted := NewHistory(lights.NewTransitionEngine(rig, clk), db, clk, DefaultLimit)
+	if err := restarted.Start(hub); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer restarted.Stop()
+
+	if status := restarted.Status(); status != (Status{Undo: 1, Redo: 1}) {
+		t.Fatalf("Status() after a restart = %+v", status)
+	}
+	if _, err := restarted.Redo(); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	if r, _, _ := rig.Strip.GetColor(); r != 200 {
+		t.Errorf("Expected red 200 redone, got %d", r)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	h, rig, clk, db, _ := newTestHistory(t, 3)
+
+	for red := 1; red <= 5; red++ {
+		rig.Strip.SetColor(red, 0, 0)
+		deadline := time.Now().Add(time.Second)
+		for {
+			entries, err := db.ListHistory()
+			if err != nil {
+				t.Fatalf("ListHistory failed: %v", err)
+			}
+			if last := entries[len(entries)-1]; last.Data.LEDStrip.Red == red {
+				if len(entries) != min(red+1, 3) {
+					t.Fatalf("Saved %d entries after %d edits", len(entries), red)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for edit %d", red)
+			}
+			clk.Advance(Settle)
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if status := h.Status(); status != (Status{Undo: 2}) {
+		t.Errorf("Status() = %+v, want 2 to undo", status)
+	}
+
+	// The oldest state kept is after the third edit
+	for {
+		if _, err := h.Undo(); errors.Is(err, ErrNothingToUndo) {
+			break
+		} else if err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+	}
+	if r, _, _ := rig.Strip.GetColor(); r != 3 {
+		t.Errorf("Expected red 3 after undoing everything, got %d", r)
+	}
+}
+
+func TestMaxWait(t *testing.T) {
+	_, rig, clk, db, _ := newTestHistory(t, DefaultLimit)
+	saved := func() int {
+		entries, err := db.ListHistory()
+		if err != nil {
+			t.Fatalf("ListHistory failed: %v", err)
+		}
+		return len(entries)
+	}
+
+	// Lights that never keep still for Settle are recorded once MaxWait has passed.
+	// The first change starts the MaxWait and Settle timers, and each later one
+	// adds a Settle timer as the last one's comes due.
+	steps := int(2 * MaxWait / Settle)
+	for step := 1; step <= steps; step++ {
+		rig.Strip.SetColor(step, 0, 0)
+		if step == 1 {
+			clk.BlockUntil(2)
+		} else {
+			clk.BlockUntil(3)
+		}
+		if n := saved(); n != 1 {
+			t.Fatalf("Expected nothing recorded before MaxWait, have %d entries", n)
+		}
+		clk.Advance(Settle / 2)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for saved() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the change to be recorded, have %d entries", saved())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
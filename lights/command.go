@@ -0,0 +1,107 @@
+package lights
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// TransitionSpec is the JSON form of a Transition
+type TransitionSpec struct {
+	Duration int    `json:"duration"` // milliseconds
+	Easing   string `json:"easing,omitempty"`
+}
+
+// Transition validates the spec and converts it to a Transition
+func (s TransitionSpec) Transition() (Transition, error) {
+	if s.Duration < 0 {
+		return Transition{}, fmt.Errorf("transition duration must not be negative, got %d", s.Duration)
+	}
+	if _, err := ParseEasing(s.Easing); err != nil {
+		return Transition{}, err
+	}
+	return Transition{
+		Duration: time.Duration(s.Duration) * time.Millisecond,
+		Easing:   s.Easing,
+	}, nil
+}
+
+// Command is a request to change the lights, received over MQTT
+//
+// Either Scene names a library scene to recall, or Devices gives the target
+// state in the scene export format (any device may be left out). Transition
+// overrides the engine's default crossfade.
+//
+// Example:
+//
+//	{"scene": "Video Call", "transition": {"duration": 2000, "easing": "ease-in-out"}}
+//	{"devices": {"ledStrip": {"r": 255, "g": 0, "b": 0}}, "transition": {"duration": 500}}
+type Command struct {
+	Scene      string             `json:"scene,omitempty"`
+	Devices    *storage.SceneData `json:"devices,omitempty"`
+	Transition *TransitionSpec    `json:"transition,omitempty"`
+}
+
+// CommandHandler applies commands through a transition engine
+type CommandHandler struct {
+	engine *TransitionEngine
+	scenes storage.SceneStore
+}
+
+// NewCommandHandler creates a command handler
+func NewCommandHandler(engine *TransitionEngine, scenes storage.SceneStore) *CommandHandler {
+	return &CommandHandler{
+		engine: engine,
+		scenes: scenes,
+	}
+}
+
+// Handle decodes and applies a JSON command
+func (h *CommandHandler) Handle(payload []byte) error {
+	var cmd Command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return fmt.Errorf("invalid command: %w", err)
+	}
+	return h.Apply(cmd)
+}
+
+// Apply applies a command
+func (h *CommandHandler) Apply(cmd Command) error {
+	transition := h.engine.Default()
+	if cmd.Transition != nil {
+		t, err := cmd.Transition.Transition()
+		if err != nil {
+			return err
+		}
+		transition = t
+	}
+
+	switch {
+	case cmd.Scene != "" && cmd.Devices != nil:
+		return fmt.Errorf("command must give either a scene or devices, not both")
+	case cmd.Scene != "":
+		info, err := h.scenes.FindSceneByName(cmd.Scene)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			return fmt.Errorf("%w: %q", storage.ErrSceneNotFound, cmd.Scene)
+		}
+		data, err := h.scenes.LoadScene(info.ID)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			return fmt.Errorf("scene %q has nothing saved", cmd.Scene)
+		}
+		log.Printf("Command: Recalling scene %q", cmd.Scene)
+		return h.engine.Recall(info.ID, info.Name, data, transition)
+	case cmd.Devices != nil:
+		return h.engine.Apply(cmd.Devices, transition)
+	default:
+		return fmt.Errorf("command must give a scene or devices")
+	}
+}
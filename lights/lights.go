@@ -0,0 +1,258 @@
+package lights
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Rig groups the light drivers so scenes can be captured from and applied to them together
+type Rig struct {
+	Strip       *ledstrip.LEDStrip
+	Bar         *ledbar.LEDBar
+	VideoLight1 *videolight.VideoLight
+	VideoLight2 *videolight.VideoLight
+}
+
+// NewRig creates a rig from the light drivers
+func NewRig(strip *ledstrip.LEDStrip, bar *ledbar.LEDBar, vl1, vl2 *videolight.VideoLight) *Rig {
+	return &Rig{
+		Strip:       strip,
+		Bar:         bar,
+		VideoLight1: vl1,
+		VideoLight2: vl2,
+	}
+}
+
+// Selection picks which lights a scene captures
+type Selection struct {
+	LEDStrip       bool
+	LEDBarChannels []int // LED bar channel numbers (0-76)
+	VideoLights    []int // database IDs (0 for video light 1, 1 for video light 2)
+}
+
+// SelectAll returns a selection covering every light
+func SelectAll() Selection {
+	sel := Selection{LEDStrip: true, VideoLights: []int{0, 1}}
+	for section := 1; section <= 2; section++ {
+		sel.LEDBarChannels = append(sel.LEDBarChannels, ledbar.RGBWChannels(section)...)
+		sel.LEDBarChannels = append(sel.LEDBarChannels, ledbar.WhiteChannels(section)...)
+	}
+	return sel
+}
+
+// SelectionNames lists the names accepted by ParseSelection
+var SelectionNames = []string{
+	"ledStrip",
+	"ledBar",
+	"ledBar.section1",
+	"ledBar.section1.rgbw",
+	"ledBar.section1.white",
+	"ledBar.section2",
+	"ledBar.section2.rgbw",
+	"ledBar.section2.white",
+	"videoLight1",
+	"videoLight2",
+}
+
+// ParseSelection builds a selection from light names such as "ledStrip" or "ledBar.section2.white"
+func ParseSelection(names []string) (Selection, error) {
+	var sel Selection
+	channels := make(map[int]bool)
+	videoLights := make(map[int]bool)
+
+	for _, name := range names {
+		switch name {
+		case "ledStrip":
+			sel.LEDStrip = true
+		case "videoLight1":
+			videoLights[0] = true
+		case "videoLight2":
+			videoLights[1] = true
+		default:
+			selected, err := parseLEDBarSelection(name)
+			if err != nil {
+				return Selection{}, err
+			}
+			for _, ch := range selected {
+				channels[ch] = true
+			}
+		}
+	}
+
+	sel.LEDBarChannels = sortedKeys(channels)
+	sel.VideoLights = sortedKeys(videoLights)
+	return sel, nil
+}
+
+// parseLEDBarSelection returns the LED bar channels named by "ledBar[.sectionN[.rgbw|.white]]"
+func parseLEDBarSelection(name string) ([]int, error) {
+	parts := strings.Split(name, ".")
+	if parts[0] != "ledBar" || len(parts) > 3 {
+		return nil, fmt.Errorf("unknown light %q (use one of: %s)", name, strings.Join(SelectionNames, ", "))
+	}
+
+	sections := []int{1, 2}
+	if len(parts) >= 2 {
+		switch parts[1] {
+		case "section1":
+			sections = []int{1}
+		case "section2":
+			sections = []int{2}
+		default:
+			return nil, fmt.Errorf("unknown LED bar section in %q", name)
+		}
+	}
+
+	var channels []int
+	for _, section := range sections {
+		part := ""
+		if len(parts) == 3 {
+			part = parts[2]
+		}
+		switch part {
+		case "":
+			channels = append(channels, ledbar.RGBWChannels(section)...)
+			channels = append(channels, ledbar.WhiteChannels(section)...)
+		case "rgbw":
+			channels = append(channels, ledbar.RGBWChannels(section)...)
+		case "white":
+			channels = append(channels, ledbar.WhiteChannels(section)...)
+		default:
+			return nil, fmt.Errorf("unknown LED bar part in %q (use rgbw or white)", name)
+		}
+	}
+	return channels, nil
+}
+
+// SelectionOf returns a selection covering the lights a scene sets, so they can
+// be captured before the scene is applied and put back afterwards
+func SelectionOf(data *storage.SceneData) Selection {
+	sel := Selection{LEDStrip: data.LEDStrip != nil}
+	channels := make(map[int]bool)
+	for _, led := range data.LEDBarLEDs {
+		channels[led.ChannelNum] = true
+	}
+	videoLights := make(map[int]bool)
+	for _, vl := range data.VideoLights {
+		videoLights[vl.ID] = true
+	}
+	sel.LEDBarChannels = sortedKeys(channels)
+	sel.VideoLights = sortedKeys(videoLights)
+	return sel
+}
+
+// sortedKeys returns the keys of a set in ascending order
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// Capture returns the current state of the selected lights as scene data
+func (r *Rig) Capture(sel Selection) *storage.SceneData {
+	data := &storage.SceneData{}
+
+	if sel.LEDStrip {
+		red, green, blue := r.Strip.GetColor()
+		data.LEDStrip = &storage.LEDStripState{Red: red, Green: green, Blue: blue}
+	}
+
+	channels := r.Bar.GetChannels()
+	for _, ch := range sel.LEDBarChannels {
+		if ch < 0 || ch >= len(channels) {
+			continue
+		}
+		data.LEDBarLEDs = append(data.LEDBarLEDs, storage.LEDBarLEDState{
+			LEDBarID:   r.Bar.GetBarID(),
+			ChannelNum: ch,
+			Value:      channels[ch],
+		})
+	}
+
+	for _, id := range sel.VideoLights {
+		vl := r.videoLight(id)
+		if vl == nil {
+			continue
+		}
+		on, brightness := vl.GetState()
+		data.VideoLights = append(data.VideoLights, storage.VideoLightState{ID: id, On: on, Brightness: brightness})
+	}
+
+	return data
+}
+
+// Off returns scene data that switches off the selected lights
+// Video lights keep their brightness, so switching them back on restores it.
+func (r *Rig) Off(sel Selection) *storage.SceneData {
+	data := r.Capture(sel)
+	if data.LEDStrip != nil {
+		data.LEDStrip = &storage.LEDStripState{}
+	}
+	for i := range data.LEDBarLEDs {
+		data.LEDBarLEDs[i].Value = 0
+	}
+	for i := range data.VideoLights {
+		data.VideoLights[i].On = false
+	}
+	return data
+}
+
+// Apply sets the lights stored in a scene, leaving lights that aren't part of it untouched
+func (r *Rig) Apply(data *storage.SceneData) error {
+	var errs []string
+
+	if data.LEDStrip != nil {
+		if err := r.Strip.SetColor(data.LEDStrip.Red, data.LEDStrip.Green, data.LEDStrip.Blue); err != nil {
+			errs = append(errs, fmt.Sprintf("LED strip: %v", err))
+		}
+	}
+
+	// Overlay the scene's channels on the bar's current state so it's published once
+	if len(data.LEDBarLEDs) > 0 {
+		channels := r.Bar.GetChannels()
+		for _, led := range data.LEDBarLEDs {
+			if led.LEDBarID != r.Bar.GetBarID() || led.ChannelNum < 0 || led.ChannelNum >= len(channels) {
+				continue
+			}
+			channels[led.ChannelNum] = led.Value
+		}
+		if err := r.Bar.SetChannels(channels); err != nil {
+			errs = append(errs, fmt.Sprintf("LED bar: %v", err))
+		}
+	}
+
+	for _, state := range data.VideoLights {
+		vl := r.videoLight(state.ID)
+		if vl == nil {
+			continue
+		}
+		if err := vl.SetState(state.On, state.Brightness); err != nil {
+			errs = append(errs, fmt.Sprintf("video light %d: %v", state.ID+1, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to apply scene: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// videoLight returns the video light with the given database ID, or nil
+func (r *Rig) videoLight(id int) *videolight.VideoLight {
+	switch id {
+	case 0:
+		return r.VideoLight1
+	case 1:
+		return r.VideoLight2
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package lights
+
+import (
+	"testing"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// newTestRig creates a rig whose drivers publish to a mock
+func newTestRig(t *testing.T) (*Rig, *mqtt.MockPublisher) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, err := videolight.NewVideoLight(1, mock, "test/vl1")
+	if err != nil {
+		t.Fatalf("NewVideoLight failed: %v", err)
+	}
+	vl2, err := videolight.NewVideoLight(2, mock, "test/vl2")
+	if err != nil {
+		t.Fatalf("NewVideoLight failed: %v", err)
+	}
+	return NewRig(strip, bar, vl1, vl2), mock
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		name         string
+		lights       []string
+		wantStrip    bool
+		wantChannels int
+		wantVideo    int
+		wantError    bool
+	}{
+		{"strip only", []string{"ledStrip"}, true, 0, 0, false},
+		{"whole bar", []string{"ledBar"}, false, 74, 0, false},
+		{"section 2 white", []string{"ledBar.section2.white"}, false, 13, 0, false},
+		{"section 1 rgbw", []string{"ledBar.section1.rgbw"}, false, 24, 0, false},
+		{"overlapping", []string{"ledBar.section1", "ledBar.section1.white"}, false, 37, 0, false},
+		{"video lights", []string{"videoLight1", "videoLight2"}, false, 0, 2, false},
+		{"unknown light", []string{"lamp"}, false, 0, 0, true},
+		{"unknown section", []string{"ledBar.section3"}, false, 0, 0, true},
+		{"unknown part", []string{"ledBar.section1.red"}, false, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := ParseSelection(tt.lights)
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if sel.LEDStrip != tt.wantStrip {
+				t.Errorf("LEDStrip = %v, want %v", sel.LEDStrip, tt.wantStrip)
+			}
+			if len(sel.LEDBarChannels) != tt.wantChannels {
+				t.Errorf("Got %d LED bar channels, want %d", len(sel.LEDBarChannels), tt.wantChannels)
+			}
+			if len(sel.VideoLights) != tt.wantVideo {
+				t.Errorf("Got %d video lights, want %d", len(sel.VideoLights), tt.wantVideo)
+			}
+		})
+	}
+}
+
+func TestCaptureSection2White(t *testing.T) {
+	rig, _ := newTestRig(t)
+	rig.Bar.SetAllWhite(2, 200)
+	rig.Bar.SetAllRGBW(10, 20, 30, 40)
+	rig.Strip.SetColor(255, 0, 0)
+
+	sel, _ := ParseSelection([]string{"ledBar.section2.white"})
+	data := rig.Capture(sel)
+
+	if data.LEDStrip != nil || len(data.VideoLights) != 0 {
+		t.Errorf("Unselected lights were captured: %+v", data)
+	}
+	if len(data.LEDBarLEDs) != 13 {
+		t.Fatalf("Expected 13 LED bar channels, got %d", len(data.LEDBarLEDs))
+	}
+	for _, led := range data.LEDBarLEDs {
+		if led.ChannelNum < 64 || led.ChannelNum > 76 || led.Value != 200 {
+			t.Errorf("Unexpected channel captured: %+v", led)
+		}
+	}
+}
+
+func TestSelectionOf(t *testing.T) {
+	rig, _ := newTestRig(t)
+	rig.Bar.SetAllWhite(1, 50)
+
+	want, _ := ParseSelection([]string{"ledBar.section1.white", "videoLight2"})
+	got := SelectionOf(rig.Capture(want))
+
+	if got.LEDStrip || len(got.LEDBarChannels) != len(want.LEDBarChannels) || len(got.VideoLights) != 1 || got.VideoLights[0] != 1 {
+		t.Errorf("SelectionOf() = %+v, want %+v", got, want)
+	}
+	for i, ch := range got.LEDBarChannels {
+		if ch != want.LEDBarChannels[i] {
+			t.Errorf("Channel %d = %d, want %d", i, ch, want.LEDBarChannels[i])
+		}
+	}
+}
+
+func TestApplyPartialScene(t *testing.T) {
+	rig, mock := newTestRig(t)
+	rig.Strip.SetColor(0, 0, 255)
+	rig.Bar.SetAllRGBW(10, 20, 30, 40)
+	rig.VideoLight2.TurnOn(30)
+	mock.Clear()
+
+	data := &storage.SceneData{
+		VideoLights: []storage.VideoLightState{{ID: 0, On: true, Brightness: 80}},
+	}
+	for _, ch := range ledbar.WhiteChannels(2) {
+		data.LEDBarLEDs = append(data.LEDBarLEDs, storage.LEDBarLEDState{LEDBarID: 0, ChannelNum: ch, Value: 255})
+	}
+
+	if err := rig.Apply(data); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Only the bar and video light 1 are published
+	topics := make(map[string]int)
+	for _, msg := range mock.GetMessages() {
+		topics[msg.Topic]++
+	}
+	if topics["test/strip"] != 0 || topics["test/vl2"] != 0 {
+		t.Errorf("Lights outside the scene were published: %v", topics)
+	}
+	if topics["test/bar"] != 1 || topics["test/vl1"] != 1 {
+		t.Errorf("Expected one message each for bar and video light 1, got %v", topics)
+	}
+
+	// Lights outside the scene keep their state
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 255 {
+		t.Errorf("LED strip changed to %d,%d,%d", r, g, b)
+	}
+	if on, brightness := rig.VideoLight2.GetState(); !on || brightness != 30 {
+		t.Errorf("Video light 2 changed to %v/%d", on, brightness)
+	}
+	if r, g, b, w, _ := rig.Bar.GetRGBW(2, 0); r != 10 || g != 20 || b != 30 || w != 40 {
+		t.Errorf("Section 2 RGBW changed to %d,%d,%d,%d", r, g, b, w)
+	}
+	if value, _ := rig.Bar.GetWhite(2, 5); value != 255 {
+		t.Errorf("Section 2 white = %d, want 255", value)
+	}
+	if on, brightness := rig.VideoLight1.GetState(); !on || brightness != 80 {
+		t.Errorf("Video light 1 = %v/%d, want on/80", on, brightness)
+	}
+}
+
+func TestCaptureApplyRoundTrip(t *testing.T) {
+	source, _ := newTestRig(t)
+	source.Strip.SetColor(1, 2, 3)
+	source.Bar.SetRGBW(1, 2, 50, 60, 70, 80)
+	source.VideoLight1.TurnOn(45)
+
+	data := source.Capture(SelectAll())
+
+	target, _ := newTestRig(t)
+	if err := target.Apply(data); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if r, g, b := target.Strip.GetColor(); r != 1 || g != 2 || b != 3 {
+		t.Errorf("LED strip = %d,%d,%d", r, g, b)
+	}
+	if r, _, _, w, _ := target.Bar.GetRGBW(1, 2); r != 50 || w != 80 {
+		t.Errorf("LED bar RGBW not applied: r=%d w=%d", r, w)
+	}
+	if on, brightness := target.VideoLight1.GetState(); !on || brightness != 45 {
+		t.Errorf("Video light 1 = %v/%d", on, brightness)
+	}
+}
+
+func TestOffKeepsVideoBrightness(t *testing.T) {
+	rig, _ := newTestRig(t)
+	rig.Strip.SetColor(255, 100, 0)
+	rig.Bar.SetAllWhite(1, 120)
+	rig.VideoLight1.TurnOn(65)
+
+	if err := rig.Apply(rig.Off(SelectAll())); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("Expected strip off, got %d,%d,%d", r, g, b)
+	}
+	for i, value := range rig.Bar.GetChannels() {
+		if value != 0 {
+			t.Errorf("Expected channel %d off, got %d", i, value)
+		}
+	}
+	on, brightness := rig.VideoLight1.GetState()
+	if on || brightness != 65 {
+		t.Errorf("Expected video light 1 off at brightness 65, got on=%v brightness=%d", on, brightness)
+	}
+}
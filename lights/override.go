@@ -0,0 +1,100 @@
+package lights
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+)
+
+// Override layers, lowest first
+// The drivers show the highest layer set on a light, so the on-air indicator
+// hides notifications on its lights rather than being interrupted by them.
+const (
+	LayerNotification = iota + 1
+	LayerOnAir
+)
+
+// ShowColor overrides the selected lights on a layer with a colour at a level (0-1)
+// RGBW LEDs take the colour, white LEDs and video lights its brightest channel.
+func (r *Rig) ShowColor(layer int, sel Selection, color [3]int, level float64) error {
+	scaled := [3]int{}
+	for c, v := range color {
+		scaled[c] = int(math.Round(float64(v) * level))
+	}
+	brightest := max(scaled[0], scaled[1], scaled[2])
+
+	if sel.LEDStrip {
+		if err := r.Strip.SetOverride(layer, scaled[0], scaled[1], scaled[2]); err != nil {
+			return err
+		}
+	}
+
+	if len(sel.LEDBarChannels) > 0 {
+		rgbw := make(map[int]int)
+		for section := 1; section <= 2; section++ {
+			for n, ch := range ledbar.RGBWChannels(section) {
+				rgbw[ch] = n % 4
+			}
+		}
+		channels := make(map[int]int, len(sel.LEDBarChannels))
+		for _, ch := range sel.LEDBarChannels {
+			component, ok := rgbw[ch]
+			switch {
+			case !ok:
+				channels[ch] = brightest
+			case component < 3:
+				channels[ch] = scaled[component]
+			default:
+				channels[ch] = 0
+			}
+		}
+		if err := r.Bar.SetOverride(layer, channels); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range sel.VideoLights {
+		brightness := int(math.Round(float64(brightest) * 100 / 255))
+		if err := r.videoLight(id).SetOverride(layer, brightness > 0, brightness); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearOverride removes the overrides on a layer from the selected lights
+// Every light is cleared even if one fails to publish.
+func (r *Rig) ClearOverride(layer int, sel Selection) error {
+	var errs []error
+	if sel.LEDStrip {
+		errs = append(errs, r.Strip.ClearOverride(layer))
+	}
+	if len(sel.LEDBarChannels) > 0 {
+		errs = append(errs, r.Bar.ClearOverride(layer))
+	}
+	for _, id := range sel.VideoLights {
+		errs = append(errs, r.videoLight(id).ClearOverride(layer))
+	}
+	return errors.Join(errs...)
+}
+
+// ParseColor reads a "#rrggbb" colour
+func ParseColor(s string) ([3]int, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return [3]int{}, fmt.Errorf("invalid colour %q (use #rrggbb)", s)
+	}
+	var color [3]int
+	for c := range color {
+		v, err := strconv.ParseUint(hex[2*c:2*c+2], 16, 8)
+		if err != nil {
+			return [3]int{}, fmt.Errorf("invalid colour %q (use #rrggbb)", s)
+		}
+		color[c] = int(v)
+	}
+	return color, nil
+}
@@ -0,0 +1,69 @@
+package lights
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShowColor(t *testing.T) {
+	rig, mock := newTestRig(t)
+	rig.VideoLight1.TurnOn(30)
+
+	sel, err := ParseSelection([]string{"ledStrip", "ledBar.section1", "videoLight1"})
+	if err != nil {
+		t.Fatalf("ParseSelection failed: %v", err)
+	}
+	if err := rig.ShowColor(LayerNotification, sel, [3]int{255, 128, 0}, 0.5); err != nil {
+		t.Fatalf("ShowColor failed: %v", err)
+	}
+
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("Expected the strip's own colour untouched, got %d,%d,%d", r, g, b)
+	}
+	if !rig.Strip.Overridden() || !rig.Bar.Overridden() || !rig.VideoLight1.Overridden() {
+		t.Error("Expected the selected lights to be overridden")
+	}
+	if rig.VideoLight2.Overridden() {
+		t.Error("Expected video light 2 to be left alone")
+	}
+
+	var bar string
+	for _, msg := range mock.GetMessages() {
+		if msg.Topic == "test/bar" {
+			bar = msg.Payload.(string)
+		}
+	}
+	values := strings.Split(bar, ",")
+	if got := strings.Join(values[0:4], ","); got != "128,64,0,0" {
+		t.Errorf("Expected the first RGBW LED at half the colour, got %s", got)
+	}
+	if values[24] != "128" {
+		t.Errorf("Expected the first white LED at the brightest channel, got %s", values[24])
+	}
+
+	if err := rig.ClearOverride(LayerNotification, sel); err != nil {
+		t.Fatalf("ClearOverride failed: %v", err)
+	}
+	if rig.Strip.Overridden() || rig.Bar.Overridden() || rig.VideoLight1.Overridden() {
+		t.Error("Expected the overrides to be cleared")
+	}
+	if got := mock.GetLastMessage().Payload; got != "set,true,30" {
+		t.Errorf("Expected video light 1 back at 30, got %v", got)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	got, err := ParseColor("#FF8000")
+	if err != nil {
+		t.Fatalf("ParseColor failed: %v", err)
+	}
+	if got != [3]int{255, 128, 0} {
+		t.Errorf("Expected 255,128,0, got %v", got)
+	}
+
+	for _, s := range []string{"", "#fff", "#gg0000", "ff00000"} {
+		if _, err := ParseColor(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
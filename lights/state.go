@@ -0,0 +1,95 @@
+package lights
+
+import "github.com/kevin/office_lights/drivers/ledbar"
+
+// RGBW represents a single RGBW LED
+type RGBW struct {
+	R int `json:"r"`
+	G int `json:"g"`
+	B int `json:"b"`
+	W int `json:"w"`
+}
+
+// LEDBarSection represents one section of the LED bar
+type LEDBarSection struct {
+	RGBW  []RGBW `json:"rgbw"`
+	White []int  `json:"white"`
+}
+
+// LEDBarState represents the complete LED bar state
+type LEDBarState struct {
+	Section1 LEDBarSection `json:"section1"`
+	Section2 LEDBarSection `json:"section2"`
+}
+
+// LEDStripState represents the LED strip state
+type LEDStripState struct {
+	R int `json:"r"`
+	G int `json:"g"`
+	B int `json:"b"`
+}
+
+// VideoLightState represents a video light state
+type VideoLightState struct {
+	On         bool `json:"on"`
+	Brightness int  `json:"brightness"`
+}
+
+// DeviceStates holds the state of every light, encoding to JSON as the web API
+// and webhooks show it
+type DeviceStates struct {
+	LEDStrip    LEDStripState   `json:"ledStrip"`
+	LEDBar      LEDBarState     `json:"ledBar"`
+	VideoLight1 VideoLightState `json:"videoLight1"`
+	VideoLight2 VideoLightState `json:"videoLight2"`
+}
+
+// ReadStates reads the state of every light in the rig
+func (r *Rig) ReadStates() (*DeviceStates, error) {
+	states := &DeviceStates{}
+
+	red, green, blue := r.Strip.GetColor()
+	states.LEDStrip = LEDStripState{R: red, G: green, B: blue}
+
+	var err error
+	if states.LEDBar.Section1, err = ReadBarSection(r.Bar, 1); err != nil {
+		return nil, err
+	}
+	if states.LEDBar.Section2, err = ReadBarSection(r.Bar, 2); err != nil {
+		return nil, err
+	}
+
+	on1, brightness1 := r.VideoLight1.GetState()
+	states.VideoLight1 = VideoLightState{On: on1, Brightness: brightness1}
+
+	on2, brightness2 := r.VideoLight2.GetState()
+	states.VideoLight2 = VideoLightState{On: on2, Brightness: brightness2}
+
+	return states, nil
+}
+
+// ReadBarSection reads the LEDs of one LED bar section
+func ReadBarSection(bar *ledbar.LEDBar, section int) (LEDBarSection, error) {
+	state := LEDBarSection{
+		RGBW:  make([]RGBW, 6),
+		White: make([]int, 13),
+	}
+
+	for i := range state.RGBW {
+		r, g, b, w, err := bar.GetRGBW(section, i)
+		if err != nil {
+			return state, err
+		}
+		state.RGBW[i] = RGBW{R: r, G: g, B: b, W: w}
+	}
+
+	for i := range state.White {
+		val, err := bar.GetWhite(section, i)
+		if err != nil {
+			return state, err
+		}
+		state.White[i] = val
+	}
+
+	return state, nil
+}
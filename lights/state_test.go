@@ -0,0 +1,36 @@
+package lights
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReadStates(t *testing.T) {
+	rig, _ := newTestRig(t)
+	rig.Strip.SetColor(255, 128, 0)
+	rig.Bar.SetRGBW(2, 5, 1, 2, 3, 4)
+	rig.Bar.SetWhite(1, 12, 200)
+	rig.VideoLight2.TurnOn(60)
+
+	states, err := rig.ReadStates()
+	if err != nil {
+		t.Fatalf("ReadStates failed: %v", err)
+	}
+	if states.LEDStrip != (LEDStripState{R: 255, G: 128}) {
+		t.Errorf("Unexpected LED strip %+v", states.LEDStrip)
+	}
+	if states.LEDBar.Section2.RGBW[5] != (RGBW{R: 1, G: 2, B: 3, W: 4}) || states.LEDBar.Section1.White[12] != 200 {
+		t.Errorf("Unexpected LED bar %+v", states.LEDBar)
+	}
+	if states.VideoLight1.On || states.VideoLight2 != (VideoLightState{On: true, Brightness: 60}) {
+		t.Errorf("Unexpected video lights %+v %+v", states.VideoLight1, states.VideoLight2)
+	}
+
+	// The JSON is the web API's
+	data, _ := json.Marshal(states)
+	var sections map[string]json.RawMessage
+	json.Unmarshal(data, &sections)
+	if string(sections["ledStrip"]) != `{"r":255,"g":128,"b":0}` || string(sections["videoLight2"]) != `{"on":true,"brightness":60}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
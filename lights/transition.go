@@ -0,0 +1,511 @@
+package lights
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/storage"
+)
+
+// DefaultFrameRate is the maximum number of frames per second published during a transition
+const DefaultFrameRate = 20
+
+// Easing maps linear progress (0-1) to eased progress (0-1)
+type Easing func(t float64) float64
+
+// Easings lists the available easing curves by name
+var Easings = map[string]Easing{
+	"linear": func(t float64) float64 { return t },
+	"ease-in": func(t float64) float64 {
+		return t * t
+	},
+	"ease-out": func(t float64) float64 {
+		return 1 - (1-t)*(1-t)
+	},
+	"ease-in-out": func(t float64) float64 {
+		if t < 0.5 {
+			return 2 * t * t
+		}
+		return 1 - 2*(1-t)*(1-t)
+	},
+}
+
+// ParseEasing looks up an easing curve by name, defaulting to linear when empty
+func ParseEasing(name string) (Easing, error) {
+	if name == "" {
+		return Easings["linear"], nil
+	}
+	easing, ok := Easings[name]
+	if !ok {
+		names := make([]string, 0, len(Easings))
+		for n := range Easings {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown easing %q (use one of: %s)", name, strings.Join(names, ", "))
+	}
+	return easing, nil
+}
+
+// Transition describes how to move from the current state to a target state
+type Transition struct {
+	Duration time.Duration // zero applies the target immediately
+	Easing   string
+}
+
+// TransitionEngine crossfades the lights of a rig to a target state
+//
+// Only one transition runs at a time: starting another one, or calling Stop,
+// cancels the running transition where it is and saves the frame it stopped
+// on. Lights that are changed by
+// something else while a transition runs are dropped from it, so manual
+// changes always win.
+type TransitionEngine struct {
+	rig           *Rig
+	clock         clock.Clock
+	frameInterval time.Duration
+	defaultTrans  Transition
+	onApply       []func(data *storage.SceneData)
+	onRecall      []func(sceneID int, name string)
+
+	// applyMu serializes Apply, so the transition it stops and the one it
+	// starts can't interleave with another Apply
+	applyMu sync.Mutex
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTransitionEngine creates a transition engine for a rig
+func NewTransitionEngine(rig *Rig, clk clock.Clock) *TransitionEngine {
+	return &TransitionEngine{
+		rig:           rig,
+		clock:         clk,
+		frameInterval: time.Second / DefaultFrameRate,
+	}
+}
+
+// Rig returns the lights controlled by the engine
+func (e *TransitionEngine) Rig() *Rig {
+	return e.rig
+}
+
+// SetFrameRate sets the maximum number of frames published per second
+func (e *TransitionEngine) SetFrameRate(fps int) error {
+	if fps < 1 || fps > 100 {
+		return fmt.Errorf("frame rate must be between 1 and 100, got %d", fps)
+	}
+	e.frameInterval = time.Second / time.Duration(fps)
+	return nil
+}
+
+// SetDefault sets the transition used for scene recalls that don't specify one
+func (e *TransitionEngine) SetDefault(t Transition) error {
+	if _, err := ParseEasing(t.Easing); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.defaultTrans = t
+	return nil
+}
+
+// Default returns the transition used for scene recalls that don't specify one
+func (e *TransitionEngine) Default() Transition {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.defaultTrans
+}
+
+// OnApply registers a function called with the target state before every Apply,
+// so other animations can let go of the lights the scene changes
+func (e *TransitionEngine) OnApply(fn func(data *storage.SceneData)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onApply = append(e.onApply, fn)
+}
+
+// OnRecall registers a function called after a library scene is recalled with Recall
+func (e *TransitionEngine) OnRecall(fn func(sceneID int, name string)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onRecall = append(e.onRecall, fn)
+}
+
+// Recall starts a transition to a library scene, as Apply does, and then tells
+// the OnRecall functions which scene it was
+func (e *TransitionEngine) Recall(sceneID int, name string, data *storage.SceneData, t Transition) error {
+	if err := e.Apply(data, t); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	hooks := e.onRecall
+	e.mu.Unlock()
+	for _, fn := range hooks {
+		fn(sceneID, name)
+	}
+	return nil
+}
+
+// Apply starts a transition to the lights stored in a scene, leaving the rest untouched
+// It returns once the transition has started; use Wait to block until it finishes.
+func (e *TransitionEngine) Apply(data *storage.SceneData, t Transition) error {
+	easing, err := ParseEasing(t.Easing)
+	if err != nil {
+		return err
+	}
+
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	e.Stop()
+
+	e.mu.Lock()
+	hooks := e.onApply
+	e.mu.Unlock()
+	for _, fn := range hooks {
+		fn(data)
+	}
+
+	if t.Duration <= 0 {
+		return e.rig.Apply(data)
+	}
+
+	f, err := e.newFade(data)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	e.mu.Lock()
+	e.stop = stop
+	e.done = done
+	e.mu.Unlock()
+
+	go e.run(f, t.Duration, easing, stop, done)
+	return nil
+}
+
+// Stop cancels the running transition, leaving the lights at the last frame and saving it
+func (e *TransitionEngine) Stop() {
+	e.mu.Lock()
+	stop, done := e.stop, e.done
+	e.stop = nil
+	e.done = nil
+	e.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// Wait blocks until the running transition finishes or is cancelled
+func (e *TransitionEngine) Wait() {
+	e.mu.Lock()
+	done := e.done
+	e.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Done returns a channel that is closed when the running transition finishes or is cancelled
+// The channel is already closed when no transition is running.
+func (e *TransitionEngine) Done() <-chan struct{} {
+	e.mu.Lock()
+	done := e.done
+	e.mu.Unlock()
+
+	if done == nil {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return done
+}
+
+// Active reports whether a transition is running
+func (e *TransitionEngine) Active() bool {
+	e.mu.Lock()
+	done := e.done
+	e.mu.Unlock()
+
+	if done == nil {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+// run publishes frames until the transition completes or is stopped
+func (e *TransitionEngine) run(f *fade, duration time.Duration, easing Easing, stop, done chan struct{}) {
+	defer close(done)
+
+	start := e.clock.Now()
+	for {
+		select {
+		case <-stop:
+			f.settle()
+			return
+		case <-e.clock.After(e.frameInterval):
+		}
+
+		progress := float64(e.clock.Now().Sub(start)) / float64(duration)
+		if progress >= 1 {
+			f.finish()
+			return
+		}
+		f.frame(easing(progress))
+	}
+}
+
+// fade holds the start and target values of every light in a transition
+// A nil or missing entry means the light isn't part of the transition (any more).
+type fade struct {
+	rig   *Rig
+	strip *stripFade
+	bar   *barFade
+	video []*videoLightFade
+}
+
+type stripFade struct {
+	from, to, last [3]int
+}
+
+type barFade struct {
+	from, to, last []int
+}
+
+type videoLightFade struct {
+	light *videolight.VideoLight
+	id    int
+	from  videoLightLevel
+	to    videoLightLevel
+	last  videoLightLevel
+}
+
+// videoLightLevel is a video light's on/off state and brightness
+type videoLightLevel struct {
+	on         bool
+	brightness int
+}
+
+// level returns the effective output, treating an off light as brightness 0
+func (v videoLightLevel) level() int {
+	if !v.on {
+		return 0
+	}
+	return v.brightness
+}
+
+// newFade captures the current state of the lights in the scene as the start of a transition
+func (e *TransitionEngine) newFade(data *storage.SceneData) (*fade, error) {
+	f := &fade{rig: e.rig}
+
+	if data.LEDStrip != nil {
+		to := [3]int{data.LEDStrip.Red, data.LEDStrip.Green, data.LEDStrip.Blue}
+		for _, v := range to {
+			if v < 0 || v > 255 {
+				return nil, fmt.Errorf("LED strip value out of range: %d", v)
+			}
+		}
+		r, g, b := e.rig.Strip.GetColor()
+		from := [3]int{r, g, b}
+		f.strip = &stripFade{from: from, to: to, last: from}
+	}
+
+	if len(data.LEDBarLEDs) > 0 {
+		from := e.rig.Bar.GetChannels()
+		to := append([]int(nil), from...)
+		for _, led := range data.LEDBarLEDs {
+			if led.LEDBarID != e.rig.Bar.GetBarID() || led.ChannelNum < 0 || led.ChannelNum >= len(to) {
+				continue
+			}
+			if led.Value < 0 || led.Value > 255 {
+				return nil, fmt.Errorf("LED bar channel %d out of range: %d", led.ChannelNum, led.Value)
+			}
+			to[led.ChannelNum] = led.Value
+		}
+		f.bar = &barFade{from: from, to: to, last: append([]int(nil), from...)}
+	}
+
+	for _, state := range data.VideoLights {
+		vl := e.rig.videoLight(state.ID)
+		if vl == nil {
+			continue
+		}
+		if state.Brightness < 0 || state.Brightness > 100 {
+			return nil, fmt.Errorf("video light %d brightness out of range: %d", state.ID+1, state.Brightness)
+		}
+		on, brightness := vl.GetState()
+		from := videoLightLevel{on: on, brightness: brightness}
+		f.video = append(f.video, &videoLightFade{
+			light: vl,
+			id:    state.ID,
+			from:  from,
+			to:    videoLightLevel{on: state.On, brightness: state.Brightness},
+			last:  from,
+		})
+	}
+
+	return f, nil
+}
+
+// lerp interpolates between two values and rounds to the nearest integer
+func lerp(from, to int, progress float64) int {
+	return from + int(math.Round(float64(to-from)*progress))
+}
+
+// dropChanged removes lights whose state no longer matches the last frame,
+// because something else has changed them since
+func (f *fade) dropChanged() {
+	if f.strip != nil {
+		r, g, b := f.rig.Strip.GetColor()
+		if [3]int{r, g, b} != f.strip.last {
+			log.Println("Transition: LED strip changed elsewhere, leaving it alone")
+			f.strip = nil
+		}
+	}
+
+	if f.bar != nil && !equalChannels(f.rig.Bar.GetChannels(), f.bar.last) {
+		log.Println("Transition: LED bar changed elsewhere, leaving it alone")
+		f.bar = nil
+	}
+
+	for i, v := range f.video {
+		if v == nil {
+			continue
+		}
+		on, brightness := v.light.GetState()
+		if (videoLightLevel{on: on, brightness: brightness}) != v.last {
+			log.Printf("Transition: Video light %d changed elsewhere, leaving it alone", v.id+1)
+			f.video[i] = nil
+		}
+	}
+}
+
+// frame publishes the intermediate state at the given eased progress
+// Only lights whose value changed since the previous frame are published.
+func (f *fade) frame(progress float64) {
+	f.dropChanged()
+
+	if f.strip != nil {
+		var next [3]int
+		for i := range next {
+			next[i] = lerp(f.strip.from[i], f.strip.to[i], progress)
+		}
+		if next != f.strip.last {
+			if err := f.rig.Strip.SetColorFrame(next[0], next[1], next[2]); err != nil {
+				log.Printf("Transition: LED strip frame failed: %v", err)
+			}
+			f.strip.last = next
+		}
+	}
+
+	if f.bar != nil {
+		next := make([]int, len(f.bar.from))
+		for i := range next {
+			next[i] = lerp(f.bar.from[i], f.bar.to[i], progress)
+		}
+		if !equalChannels(next, f.bar.last) {
+			if err := f.rig.Bar.SetChannelsFrame(next); err != nil {
+				log.Printf("Transition: LED bar frame failed: %v", err)
+			}
+			f.bar.last = next
+		}
+	}
+
+	for _, v := range f.video {
+		if v == nil {
+			continue
+		}
+		level := lerp(v.from.level(), v.to.level(), progress)
+		next := videoLightLevel{on: level > 0, brightness: level}
+		if next != v.last {
+			if err := v.light.SetStateFrame(next.on, next.brightness); err != nil {
+				log.Printf("Transition: Video light %d frame failed: %v", v.id+1, err)
+			}
+			v.last = next
+		}
+	}
+}
+
+// finish sets the exact target state of the lights still in the transition and saves it
+func (f *fade) finish() {
+	f.dropChanged()
+
+	if f.strip != nil {
+		if err := f.rig.Strip.SetColor(f.strip.to[0], f.strip.to[1], f.strip.to[2]); err != nil {
+			log.Printf("Transition: LED strip failed: %v", err)
+		}
+	}
+	if f.bar != nil {
+		if err := f.rig.Bar.SetChannels(f.bar.to); err != nil {
+			log.Printf("Transition: LED bar failed: %v", err)
+		}
+	}
+	for _, v := range f.video {
+		if v == nil {
+			continue
+		}
+		if err := v.light.SetState(v.to.on, v.to.brightness); err != nil {
+			log.Printf("Transition: Video light %d failed: %v", v.id+1, err)
+		}
+	}
+}
+
+// settle saves the last frame of the lights still in a cancelled transition,
+// so the state stored matches what the lights show
+func (f *fade) settle() {
+	f.dropChanged()
+
+	if f.strip != nil {
+		if err := f.rig.Strip.SetColor(f.strip.last[0], f.strip.last[1], f.strip.last[2]); err != nil {
+			log.Printf("Transition: LED strip failed: %v", err)
+		}
+	}
+	if f.bar != nil {
+		if err := f.rig.Bar.SetChannels(f.bar.last); err != nil {
+			log.Printf("Transition: LED bar failed: %v", err)
+		}
+	}
+	for _, v := range f.video {
+		if v == nil {
+			continue
+		}
+		if err := v.light.SetState(v.last.on, v.last.brightness); err != nil {
+			log.Printf("Transition: Video light %d failed: %v", v.id+1, err)
+		}
+	}
+}
+
+// equalChannels reports whether two channel arrays hold the same values
+func equalChannels(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,368 @@
+package lights
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// newTestEngine creates a transition engine on a fake clock publishing 10 frames per second
+func newTestEngine(t *testing.T) (*TransitionEngine, *clock.Fake, *mqtt.MockPublisher) {
+	t.Helper()
+
+	rig, mock := newTestRig(t)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewTransitionEngine(rig, fake)
+	if err := engine.SetFrameRate(10); err != nil {
+		t.Fatalf("SetFrameRate failed: %v", err)
+	}
+	return engine, fake, mock
+}
+
+// newTestDatabase creates an initialized database in a temporary directory
+func newTestDatabase(t *testing.T) *storage.Database {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+	return db
+}
+
+// step advances the fake clock by one frame once the engine is waiting for it
+func step(fake *clock.Fake) {
+	fake.BlockUntil(1)
+	fake.Advance(100 * time.Millisecond)
+}
+
+// settle waits until the engine has published the current frame and is waiting for the next
+func settle(fake *clock.Fake) {
+	fake.BlockUntil(1)
+}
+
+// stripValues returns the red value of every LED strip message
+func stripValues(t *testing.T, messages []mqtt.Message) []int {
+	t.Helper()
+
+	var reds []int
+	for _, msg := range messages {
+		if msg.Topic != "test/strip" {
+			continue
+		}
+		var decoded struct {
+			Data struct {
+				R int `json:"r"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(msg.Payload.([]byte), &decoded); err != nil {
+			t.Fatalf("Invalid strip payload: %v", err)
+		}
+		reds = append(reds, decoded.Data.R)
+	}
+	return reds
+}
+
+func TestEasings(t *testing.T) {
+	for name, easing := range Easings {
+		if easing(0) != 0 || easing(1) != 1 {
+			t.Errorf("%s: expected 0->0 and 1->1, got %v and %v", name, easing(0), easing(1))
+		}
+		if v := easing(0.5); v <= 0 || v >= 1 {
+			t.Errorf("%s: midpoint %v out of range", name, v)
+		}
+	}
+
+	if _, err := ParseEasing("bounce"); err == nil {
+		t.Error("Expected error for unknown easing")
+	}
+	if easing, err := ParseEasing(""); err != nil || easing(0.25) != 0.25 {
+		t.Error("Expected empty easing to default to linear")
+	}
+}
+
+func TestTransitionPublishesFrames(t *testing.T) {
+	engine, fake, publisher := newTestEngine(t)
+
+	data := &storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 200}}
+	if err := engine.Apply(data, Transition{Duration: time.Second, Easing: "linear"}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !engine.Active() {
+		t.Error("Transition should be active")
+	}
+
+	for i := 0; i < 10; i++ {
+		step(fake)
+	}
+	engine.Wait()
+
+	if engine.Active() {
+		t.Error("Transition should have finished")
+	}
+
+	reds := stripValues(t, publisher.GetMessages())
+	want := []int{20, 40, 60, 80, 100, 120, 140, 160, 180, 200}
+	if len(reds) != len(want) {
+		t.Fatalf("Expected %d frames, got %v", len(want), reds)
+	}
+	for i := range want {
+		if reds[i] != want[i] {
+			t.Errorf("Frame %d: red = %d, want %d", i, reds[i], want[i])
+		}
+	}
+
+	// Lights outside the scene aren't published
+	for _, msg := range publisher.GetMessages() {
+		if msg.Topic != "test/strip" {
+			t.Errorf("Unexpected message on %s", msg.Topic)
+		}
+	}
+}
+
+func TestTransitionZeroDurationIsImmediate(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+
+	data := &storage.SceneData{VideoLights: []storage.VideoLightState{{ID: 1, On: true, Brightness: 70}}}
+	if err := engine.Apply(data, Transition{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if engine.Active() {
+		t.Error("Zero-duration transition should not run in the background")
+	}
+	if on, brightness := engine.Rig().VideoLight2.GetState(); !on || brightness != 70 {
+		t.Errorf("Video light 2 = %v/%d, want on/70", on, brightness)
+	}
+}
+
+func TestTransitionCancelledByNewTransition(t *testing.T) {
+	engine, fake, _ := newTestEngine(t)
+	rig := engine.Rig()
+
+	first := &storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 200}}
+	engine.Apply(first, Transition{Duration: time.Second})
+	for i := 0; i < 3; i++ {
+		step(fake)
+	}
+	settle(fake)
+
+	// The second transition starts from wherever the first one got to
+	second := &storage.SceneData{LEDStrip: &storage.LEDStripState{Blue: 100}}
+	if err := engine.Apply(second, Transition{Duration: 500 * time.Millisecond}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if r := rig.Strip.R(); r != 60 {
+		t.Errorf("Expected second transition to start from red 60, got %d", r)
+	}
+
+	// The cancelled transition's timer is still pending, so wait for both
+	fake.BlockUntil(2)
+
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+	engine.Wait()
+
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 100 {
+		t.Errorf("Expected final colour 0,0,100, got %d,%d,%d", r, g, b)
+	}
+}
+
+func TestTransitionStop(t *testing.T) {
+	engine, fake, publisher := newTestEngine(t)
+	rig := engine.Rig()
+
+	engine.Apply(&storage.SceneData{LEDStrip: &storage.LEDStripState{Green: 100}}, Transition{Duration: time.Second})
+	step(fake)
+	step(fake)
+	settle(fake)
+	engine.Stop()
+
+	if engine.Active() {
+		t.Error("Transition should be stopped")
+	}
+	count := publisher.MessageCount()
+	fake.Advance(time.Second)
+	if publisher.MessageCount() != count {
+		t.Error("Frames published after Stop")
+	}
+	if g := rig.Strip.G(); g != 20 {
+		t.Errorf("Expected strip to stay at the last frame (20), got %d", g)
+	}
+}
+
+func TestTransitionStopSavesLastFrame(t *testing.T) {
+	rig, publisher := newTestRig(t)
+	store := storage.NewMockStore()
+	rig.Strip = ledstrip.NewLEDStripWithState(publisher, "test/strip", store, 0, 0, 0, 0)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewTransitionEngine(rig, fake)
+	engine.SetFrameRate(10)
+
+	engine.Apply(&storage.SceneData{LEDStrip: &storage.LEDStripState{Green: 100}}, Transition{Duration: time.Second})
+	step(fake)
+	step(fake)
+	settle(fake)
+	if calls := store.GetLEDStripCalls(); len(calls) != 0 {
+		t.Fatalf("Frames saved during the transition: %+v", calls)
+	}
+	engine.Stop()
+
+	calls := store.GetLEDStripCalls()
+	if len(calls) != 1 || calls[0].G != 20 {
+		t.Errorf("Expected the stopped frame (green 20) saved once, got %+v", calls)
+	}
+}
+
+func TestTransitionConcurrentApply(t *testing.T) {
+	engine, fake, publisher := newTestEngine(t)
+
+	// Widen the gap between stopping the old transition and starting the new one
+	engine.OnApply(func(data *storage.SceneData) { time.Sleep(time.Millisecond) })
+
+	// Every Apply cancels the transition before it, so at most one is left running
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(red int) {
+			defer wg.Done()
+			engine.Apply(&storage.SceneData{LEDStrip: &storage.LEDStripState{Red: red}}, Transition{Duration: time.Second})
+		}(i)
+	}
+	wg.Wait()
+
+	engine.Stop()
+	if engine.Active() {
+		t.Error("Transition still running after Stop")
+	}
+
+	// An orphaned transition would keep publishing frames
+	count := publisher.MessageCount()
+	for i := 0; i < 10; i++ {
+		fake.Advance(100 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	if publisher.MessageCount() != count {
+		t.Error("Frames published after Stop")
+	}
+}
+
+func TestTransitionYieldsToManualChange(t *testing.T) {
+	engine, fake, _ := newTestEngine(t)
+	rig := engine.Rig()
+
+	data := &storage.SceneData{
+		LEDStrip:    &storage.LEDStripState{Red: 200},
+		VideoLights: []storage.VideoLightState{{ID: 0, On: true, Brightness: 100}},
+	}
+	engine.Apply(data, Transition{Duration: time.Second})
+	step(fake)
+	step(fake)
+
+	// Someone turns the strip blue mid-transition
+	settle(fake)
+	rig.Strip.SetColor(0, 0, 255)
+
+	for i := 0; i < 8; i++ {
+		step(fake)
+	}
+	engine.Wait()
+
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 255 {
+		t.Errorf("Manual change was overwritten: %d,%d,%d", r, g, b)
+	}
+	if on, brightness := rig.VideoLight1.GetState(); !on || brightness != 100 {
+		t.Errorf("Video light 1 should still finish its transition, got %v/%d", on, brightness)
+	}
+}
+
+func TestTransitionVideoLightFadeOff(t *testing.T) {
+	engine, fake, _ := newTestEngine(t)
+	rig := engine.Rig()
+	rig.VideoLight1.TurnOn(50)
+
+	data := &storage.SceneData{VideoLights: []storage.VideoLightState{{ID: 0, On: false, Brightness: 50}}}
+	engine.Apply(data, Transition{Duration: time.Second})
+
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+	settle(fake)
+	if on, brightness := rig.VideoLight1.GetState(); !on || brightness != 25 {
+		t.Errorf("Halfway: expected on/25, got %v/%d", on, brightness)
+	}
+
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+	engine.Wait()
+
+	// Brightness is kept for the next time the light is turned on
+	if on, brightness := rig.VideoLight1.GetState(); on || brightness != 50 {
+		t.Errorf("Expected off/50, got %v/%d", on, brightness)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	db := newTestDatabase(t)
+
+	id, _ := db.CreateScene(storage.SceneInfo{Name: "Red"})
+	db.SaveScene(id, &storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 255}})
+
+	handler := NewCommandHandler(engine, db)
+
+	var recalled []string
+	engine.OnRecall(func(sceneID int, name string) {
+		recalled = append(recalled, name)
+		if sceneID != id {
+			t.Errorf("Expected scene %d to be reported, got %d", id, sceneID)
+		}
+	})
+
+	if err := handler.Handle([]byte(`{"scene":"Red"}`)); err != nil {
+		t.Fatalf("Scene command failed: %v", err)
+	}
+	if r := engine.Rig().Strip.R(); r != 255 {
+		t.Errorf("Expected scene to be applied, red = %d", r)
+	}
+	if len(recalled) != 1 || recalled[0] != "Red" {
+		t.Errorf("Expected the recall of Red to be reported, got %v", recalled)
+	}
+
+	if err := handler.Handle([]byte(`{"devices":{"videoLights":[{"id":1,"on":true,"brightness":10}]}}`)); err != nil {
+		t.Fatalf("Devices command failed: %v", err)
+	}
+	if on, _ := engine.Rig().VideoLight2.GetState(); !on {
+		t.Error("Expected video light 2 to be on")
+	}
+
+	errorCases := []string{
+		`not json`,
+		`{}`,
+		`{"scene":"Missing"}`,
+		`{"scene":"Red","devices":{}}`,
+		`{"scene":"Red","transition":{"duration":-1}}`,
+		`{"scene":"Red","transition":{"duration":100,"easing":"bounce"}}`,
+	}
+	for _, payload := range errorCases {
+		if err := handler.Handle([]byte(payload)); err == nil {
+			t.Errorf("Expected error for %s", payload)
+		}
+	}
+	if len(recalled) != 1 {
+		t.Errorf("Expected only the scene recall to be reported, got %v", recalled)
+	}
+}
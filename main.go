@@ -1,23 +1,60 @@
 package main
 
 import (
+	"context"
 	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/kevin/office_lights/actions"
+	"github.com/kevin/office_lights/calendar"
+	"github.com/kevin/office_lights/circadian"
+	"github.com/kevin/office_lights/clock"
 	"github.com/kevin/office_lights/drivers/ledbar"
 	"github.com/kevin/office_lights/drivers/ledstrip"
 	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/history"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/metrics"
 	officemqtt "github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/notify"
+	"github.com/kevin/office_lights/onair"
+	"github.com/kevin/office_lights/rules"
+	"github.com/kevin/office_lights/schedule"
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/sleeptimer"
 	"github.com/kevin/office_lights/storage"
 	"github.com/kevin/office_lights/streamdeck"
 	"github.com/kevin/office_lights/tui"
 	"github.com/kevin/office_lights/web"
+	"github.com/kevin/office_lights/webhooks"
 )
 
 func main() {
+	// Scene export/import runs against the database only and exits
+	if len(os.Args) > 1 && os.Args[1] == "scenes" {
+		if err := runScenesCommand(os.Args[2:]); err != nil {
+			log.Fatalf("scenes: %v", err)
+		}
+		return
+	}
+
+	// On-air switching publishes a command to a running instance and exits
+	if len(os.Args) > 1 && os.Args[1] == "onair" {
+		if err := runOnAirCommand(os.Args[2:]); err != nil {
+			log.Fatalf("onair: %v", err)
+		}
+		return
+	}
+
 	// Check which UIs are requested from command line arguments
 	useTUI := false
 	useWeb := false
@@ -51,28 +88,8 @@ func main() {
 
 	log.Println("Office Lights Control System Starting...")
 
-	// Get MQTT broker address from environment variable or use default
-	broker := os.Getenv("MQTT_BROKER")
-	if broker == "" {
-		broker = "tcp://10.1.0.1:1883"
-	}
-
-	// Get MQTT client ID from environment variable or use default
-	clientID := os.Getenv("MQTT_CLIENT_ID")
-	if clientID == "" {
-		clientID = "office_lights_controller"
-	}
-
-	// Create MQTT client configuration
-	config := officemqtt.Config{
-		Broker:   broker,
-		ClientID: clientID,
-		Username: os.Getenv("MQTT_USERNAME"),
-		Password: os.Getenv("MQTT_PASSWORD"),
-	}
-
 	// Create and connect MQTT client
-	mqttClient, err := officemqtt.NewClient(config)
+	mqttClient, err := officemqtt.NewClient(mqttConfig())
 	if err != nil {
 		log.Fatalf("Failed to create MQTT client: %v", err)
 	}
@@ -84,6 +101,13 @@ func main() {
 
 	log.Println("MQTT client connected successfully")
 
+	// Publishes and saves are counted for /metrics
+	collector := metrics.New()
+	collector.WatchConnection(mqttClient)
+
+	// The drivers publish through the hub so the web event stream hears of every change
+	hub := events.NewHub(collector.Publisher(mqttClient))
+
 	// Get database path from environment variable or use default
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
@@ -157,25 +181,28 @@ func main() {
 	// Instantiate light drivers with loaded state
 	log.Println("Initializing light drivers with stored state...")
 
+	// The drivers save their state through the metrics, so save latency and failures are counted
+	stateStore := collector.StateStore(db)
+
 	// LED Strip
-	ledStrip := ledstrip.NewLEDStripWithState(mqttClient, officemqtt.TopicLEDStrip, db, 0, stripR, stripG, stripB)
+	ledStrip := ledstrip.NewLEDStripWithState(hub, officemqtt.TopicLEDStrip, stateStore, 0, stripR, stripG, stripB)
 	log.Println("LED Strip driver initialized")
 
 	// LED Bar
-	ledBar, err := ledbar.NewLEDBarWithState(0, mqttClient, officemqtt.TopicLEDBar, db, ledBarChannels)
+	ledBar, err := ledbar.NewLEDBarWithState(0, hub, officemqtt.TopicLEDBar, stateStore, ledBarChannels)
 	if err != nil {
 		log.Fatalf("Failed to create LED bar: %v", err)
 	}
 	log.Println("LED Bar driver initialized")
 
 	// Video Lights
-	videoLight1, err := videolight.NewVideoLightWithState(1, mqttClient, officemqtt.TopicVideoLight1, db, vl1On, vl1Brightness)
+	videoLight1, err := videolight.NewVideoLightWithState(1, hub, officemqtt.TopicVideoLight1, stateStore, vl1On, vl1Brightness)
 	if err != nil {
 		log.Fatalf("Failed to create video light 1: %v", err)
 	}
 	log.Println("Video Light 1 driver initialized")
 
-	videoLight2, err := videolight.NewVideoLightWithState(2, mqttClient, officemqtt.TopicVideoLight2, db, vl2On, vl2Brightness)
+	videoLight2, err := videolight.NewVideoLightWithState(2, hub, officemqtt.TopicVideoLight2, stateStore, vl2On, vl2Brightness)
 	if err != nil {
 		log.Fatalf("Failed to create video light 2: %v", err)
 	}
@@ -197,13 +224,168 @@ func main() {
 	}
 	log.Println("Initial state published")
 
+	// Set up the transition engine shared by all interfaces
+	transitions := lights.NewTransitionEngine(lights.NewRig(ledStrip, ledBar, videoLight1, videoLight2), clock.Real{})
+	configureTransitions(transitions)
+
+	// Listen for commands (scene recalls and transitions) over MQTT
+	commands := lights.NewCommandHandler(transitions, db)
+	err = mqttClient.Subscribe(officemqtt.TopicCommand, func(topic string, payload []byte) {
+		if err := commands.Handle(payload); err != nil {
+			log.Printf("MQTT: Command failed: %v", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to %s: %v", officemqtt.TopicCommand, err)
+	}
+
+	// Set up the effects engine; scene recalls take over the lights they change
+	effectsEngine := effects.NewEngine(transitions.Rig(), clock.Real{})
+	transitions.OnApply(effectsEngine.Interrupt)
+
+	effectCommands := effects.NewCommandHandler(effectsEngine)
+	err = mqttClient.Subscribe(officemqtt.TopicEffect, func(topic string, payload []byte) {
+		if err := effectCommands.Handle(payload); err != nil {
+			log.Printf("MQTT: Effect command failed: %v", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to %s: %v", officemqtt.TopicEffect, err)
+	}
+
+	// Set up the sequence player; like effects, a scene recall stops it
+	player := sequences.NewPlayer(transitions, clock.Real{})
+	transitions.OnApply(player.Interrupt)
+
+	sequenceCommands := sequences.NewCommandHandler(player, db)
+	err = mqttClient.Subscribe(officemqtt.TopicSequence, func(topic string, payload []byte) {
+		if err := sequenceCommands.Handle(payload); err != nil {
+			log.Printf("MQTT: Sequence command failed: %v", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to %s: %v", officemqtt.TopicSequence, err)
+	}
+
+	// Sleep timers switch lights off through the transition engine, so a fade
+	// stops effects and sequences on the lights it covers
+	sleepTimers := sleeptimer.NewTimers(transitions, db, clock.Real{})
+
+	// Meeting lighting recalls a scene through the transition engine before calendar
+	// events and puts the lights back afterwards
+	calendarWatcher := calendar.NewWatcher(transitions, db, clock.Real{}, time.Local, calendarConfig())
+
+	// Start circadian mode; a scene recall puts the lights it sets back on the curve,
+	// but the sequence player's keyframes, sleep timers switching lights off and
+	// meeting lighting don't
+	circadianMode := circadian.NewMode(transitions.Rig(), db, clock.Real{}, time.Local)
+	transitions.OnApply(func(data *storage.SceneData) {
+		if !player.Owns(data) && !sleepTimers.Owns(data) && !calendarWatcher.Owns(data) {
+			circadianMode.SceneRecalled(data)
+		}
+	})
+	if err := circadianMode.Start(); err != nil {
+		log.Printf("Warning: Failed to start circadian mode: %v", err)
+	}
+	if err := sleepTimers.Start(); err != nil {
+		log.Printf("Warning: Failed to resume sleep timers: %v", err)
+	}
+	if err := calendarWatcher.Start(); err != nil {
+		log.Printf("Warning: Failed to start meeting lighting: %v", err)
+	}
+
+	// Start the on-air indicator; it overrides its lights at the drivers, so
+	// nothing above reaches them while it is on
+	onAir := onair.NewIndicator(transitions.Rig(), db, clock.Real{})
+	onAir.OnChange(func(active bool) {
+		state := "off"
+		if active {
+			state = "on"
+		}
+		if err := mqttClient.Publish(officemqtt.TopicOnAirState, state); err != nil {
+			log.Printf("MQTT: Failed to publish on-air state: %v", err)
+		}
+	})
+	if err := onAir.Start(); err != nil {
+		log.Printf("Warning: Failed to start on-air indicator: %v", err)
+	}
+
+	onAirCommands := onair.NewCommandHandler(onAir)
+	err = mqttClient.Subscribe(officemqtt.TopicOnAir, func(topic string, payload []byte) {
+		if err := onAirCommands.Handle(payload); err != nil {
+			log.Printf("MQTT: On-air command failed: %v", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to %s: %v", officemqtt.TopicOnAir, err)
+	}
+
+	// Flash notifications over the top of everything but the on-air indicator
+	notifier := notify.NewNotifier(transitions.Rig(), clock.Real{})
+	notifyCommands := notify.NewCommandHandler(notifier)
+	err = mqttClient.Subscribe(officemqtt.TopicNotify, func(topic string, payload []byte) {
+		if err := notifyCommands.Handle(payload); err != nil {
+			log.Printf("MQTT: Notification failed: %v", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to %s: %v", officemqtt.TopicNotify, err)
+	}
+
+	// Tell the registered webhooks about device changes, scene recalls and the broker connection
+	dispatcher := webhooks.NewDispatcher(db, clock.Real{})
+	dispatcher.WatchDevices(hub, transitions.Rig())
+	transitions.OnRecall(dispatcher.SceneRecalled)
+	mqttClient.OnConnectionChange(dispatcher.ConnectionChanged)
+
+	// Record each edit to the lights so every interface can undo and redo it;
+	// undoing first stops sequences and effects, which would draw over the lights
+	undoHistory := history.NewHistory(transitions, db, clock.Real{}, historyLimit())
+	undoHistory.OnRestore(player.Stop)
+	undoHistory.OnRestore(effectsEngine.StopAll)
+	if err := undoHistory.Start(hub); err != nil {
+		log.Printf("Warning: Failed to start undo history: %v", err)
+	}
+
+	// Start the scheduler, catching up on anything missed while stopped
+	runner := actions.NewRunner(transitions, db, effectsEngine, player, db)
+	scheduler := schedule.NewScheduler(db, runner, clock.Real{}, time.Local)
+	configureScheduler(scheduler)
+	if err := scheduler.Start(); err != nil {
+		log.Printf("Warning: Failed to start scheduler: %v", err)
+	}
+
+	// Start the rule engine; rules run the same actions as schedules, share their
+	// site for sun triggers and subscribe to the topics their MQTT triggers watch
+	rulesEngine := rules.NewEngine(db, runner, transitions.Rig(), clock.Real{}, time.Local)
+	rulesEngine.SetSubscriber(mqttClient)
+	if site := scheduler.Site(); site != nil {
+		rulesEngine.SetSite(*site)
+	}
+	if err := rulesEngine.Start(); err != nil {
+		log.Printf("Warning: Failed to start rule engine: %v", err)
+	}
+
 	log.Println("Office Lights Control System Ready")
 
 	// Start TUI in a goroutine if requested
 	if useTUI {
 		go func() {
 			log.Println("Starting TUI mode...")
-			if err := tui.Run(ledStrip, ledBar, videoLight1, videoLight2); err != nil {
+			collector.SetClients("tui", 1)
+			defer collector.SetClients("tui", 0)
+			if err := tui.Run(tui.Dependencies{
+				LEDStrip:      ledStrip,
+				LEDBar:        ledBar,
+				VideoLight1:   videoLight1,
+				VideoLight2:   videoLight2,
+				Effects:       effectsEngine,
+				Player:        player,
+				SequenceStore: db,
+				Scheduler:     scheduler,
+				SleepTimers:   sleepTimers,
+				History:       undoHistory,
+			}); err != nil {
 				log.Fatalf("TUI error: %v", err)
 			}
 			log.Println("TUI exited")
@@ -211,38 +393,83 @@ func main() {
 	}
 
 	// Start web server in a goroutine if requested
+	var webServer *web.Server
+	shutdownTimeout := web.DefaultShutdownTimeout
 	if useWeb {
-		// Get web server port from environment variable or use default
-		port := os.Getenv("WEB_PORT")
-		if port == "" {
-			port = "8080"
-		}
+		listen := webListenConfig()
+		shutdownTimeout = durationEnv("WEB_SHUTDOWN_TIMEOUT", web.DefaultShutdownTimeout)
 
 		// Create and start web server
-		webServer := web.NewServer(ledStrip, ledBar, videoLight1, videoLight2)
+		webServer = web.NewServer(web.Dependencies{
+			LEDStrip:      ledStrip,
+			LEDBar:        ledBar,
+			VideoLight1:   videoLight1,
+			VideoLight2:   videoLight2,
+			Scenes:        db,
+			SequenceStore: db,
+			ScheduleStore: db,
+			RuleStore:     db,
+			WebhookStore:  db,
+			Database:      db,
+			Transitions:   transitions,
+			Effects:       effectsEngine,
+			Player:        player,
+			Scheduler:     scheduler,
+			Circadian:     circadianMode,
+			SleepTimers:   sleepTimers,
+			Rules:         rulesEngine,
+			Calendar:      calendarWatcher,
+			OnAir:         onAir,
+			Notifier:      notifier,
+			Webhooks:      dispatcher,
+			History:       undoHistory,
+			Hub:           hub,
+			Metrics:       collector,
+			Auth:          webAuthConfig(),
+		})
 
 		// Start web server in a goroutine so it doesn't block
 		go func() {
-			log.Printf("Starting web interface on port %s...", port)
-			if err := webServer.Start(port); err != nil {
+			log.Printf("Starting web interface on %s...", listen.Addr)
+			if err := webServer.Start(listen); err != nil {
 				log.Fatalf("Web server error: %v", err)
 			}
 		}()
-
-		log.Printf("Web interface available at http://localhost:%s", port)
 	}
 
 	// Start Stream Deck interface in a goroutine if requested
 	if useStreamDeck {
 		// Create Stream Deck UI
-		streamDeckUI, err := streamdeck.NewStreamDeckUI(ledStrip, ledBar, videoLight1, videoLight2, db)
+		streamDeckUI, err := streamdeck.NewStreamDeckUI(streamdeck.Dependencies{
+			LEDStrip:      ledStrip,
+			LEDBar:        ledBar,
+			VideoLight1:   videoLight1,
+			VideoLight2:   videoLight2,
+			Scenes:        db,
+			SequenceStore: db,
+			Transitions:   transitions,
+			Effects:       effectsEngine,
+			Player:        player,
+			SleepTimers:   sleepTimers,
+			OnAir:         onAir,
+			History:       undoHistory,
+		})
 		if err != nil {
 			log.Printf("Warning: Failed to initialize Stream Deck: %v", err)
 			log.Println("Continuing without Stream Deck interface...")
+			if webServer != nil {
+				webServer.SetStreamDeck(nil)
+			}
 		} else {
+			if webServer != nil {
+				webServer.SetStreamDeck(streamDeckUI)
+			}
+
 			// Start Stream Deck in a goroutine
 			go func() {
 				log.Println("Starting Stream Deck interface...")
+				collector.SetClients("streamdeck", 1)
+				defer collector.SetClients("streamdeck", 0)
 				if err := streamDeckUI.Run(); err != nil {
 					log.Printf("Stream Deck error: %v", err)
 				}
@@ -269,6 +496,246 @@ func main() {
 	sig := <-sigChan
 	log.Printf("Received signal %v, shutting down gracefully...", sig)
 
+	// Let requests in flight finish publishing and saving before anything else stops
+	if webServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := webServer.Shutdown(ctx); err != nil {
+			log.Printf("Warning: Web server did not drain within %v: %v", shutdownTimeout, err)
+			webServer.Stop()
+		}
+		cancel()
+		log.Println("Web server stopped")
+	}
+
+	// Finish at the last frame rather than mid-publish, and put the lights back under any effects
+	undoHistory.Stop()
+	rulesEngine.Stop()
+	calendarWatcher.Stop()
+	scheduler.Stop()
+	circadianMode.Stop()
+	sleepTimers.Stop()
+	player.Stop()
+	transitions.Stop()
+	effectsEngine.StopAll()
+	notifier.Stop()
+	onAir.Stop()
+	dispatcher.Stop()
+
 	// Cleanup will happen via defer statements
 	log.Println("Shutdown complete")
 }
+
+// mqttConfig reads the MQTT broker, client ID and credentials from the environment
+func mqttConfig() officemqtt.Config {
+	// Get MQTT broker address from environment variable or use default
+	broker := os.Getenv("MQTT_BROKER")
+	if broker == "" {
+		broker = "tcp://10.1.0.1:1883"
+	}
+
+	// Get MQTT client ID from environment variable or use default
+	clientID := os.Getenv("MQTT_CLIENT_ID")
+	if clientID == "" {
+		clientID = "office_lights_controller"
+	}
+
+	return officemqtt.Config{
+		Broker:   broker,
+		ClientID: clientID,
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+	}
+}
+
+// configureTransitions reads the default scene transition and frame rate from the environment
+func configureTransitions(transitions *lights.TransitionEngine) {
+	transition := lights.Transition{Duration: time.Second, Easing: "ease-in-out"}
+
+	if value := os.Getenv("TRANSITION_DURATION"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			log.Printf("Warning: Invalid TRANSITION_DURATION %q, using %v", value, transition.Duration)
+		} else {
+			transition.Duration = duration
+		}
+	}
+	if value := os.Getenv("TRANSITION_EASING"); value != "" {
+		transition.Easing = value
+	}
+	if err := transitions.SetDefault(transition); err != nil {
+		log.Printf("Warning: Invalid TRANSITION_EASING: %v", err)
+		transitions.SetDefault(lights.Transition{Duration: transition.Duration, Easing: "ease-in-out"})
+	}
+
+	if value := os.Getenv("TRANSITION_FPS"); value != "" {
+		fps, err := strconv.Atoi(value)
+		if err == nil {
+			err = transitions.SetFrameRate(fps)
+		}
+		if err != nil {
+			log.Printf("Warning: Invalid TRANSITION_FPS %q, using %d", value, lights.DefaultFrameRate)
+		}
+	}
+
+	log.Printf("Scene transitions: %v %s", transitions.Default().Duration, transitions.Default().Easing)
+}
+
+// configureScheduler reads the catch-up window and the location for sun events from the environment
+func configureScheduler(scheduler *schedule.Scheduler) {
+	if value := os.Getenv("SCHEDULE_CATCH_UP_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			log.Printf("Warning: Invalid SCHEDULE_CATCH_UP_WINDOW %q, using %v", value, schedule.DefaultCatchUpWindow)
+		} else {
+			scheduler.SetCatchUpWindow(window)
+		}
+	}
+
+	lat, lon := os.Getenv("LATITUDE"), os.Getenv("LONGITUDE")
+	if lat == "" && lon == "" {
+		log.Println("Scheduler: No LATITUDE/LONGITUDE set, sun schedules are disabled")
+		return
+	}
+	latitude, latErr := strconv.ParseFloat(lat, 64)
+	longitude, lonErr := strconv.ParseFloat(lon, 64)
+	if latErr != nil || lonErr != nil {
+		log.Printf("Warning: Invalid LATITUDE %q or LONGITUDE %q, sun schedules are disabled", lat, lon)
+		return
+	}
+	if err := scheduler.SetSite(schedule.Site{Latitude: latitude, Longitude: longitude}); err != nil {
+		log.Printf("Warning: %v, sun schedules are disabled", err)
+		return
+	}
+	log.Printf("Scheduler: Sun events computed for %.4f, %.4f", latitude, longitude)
+}
+
+// calendarConfig reads the calendar to watch and what counts as a meeting from the environment
+func calendarConfig() calendar.Config {
+	config := calendar.Config{
+		Path:     os.Getenv("CALENDAR_PATH"),
+		Scene:    calendar.DefaultScene,
+		Lead:     calendar.DefaultLead,
+		Keywords: splitList(os.Getenv("CALENDAR_KEYWORDS")),
+		Exclude:  splitList(os.Getenv("CALENDAR_EXCLUDE")),
+	}
+	if config.Path == "" {
+		log.Println("Calendar: No CALENDAR_PATH set, meeting lighting is disabled")
+		return config
+	}
+
+	if value := os.Getenv("CALENDAR_SCENE"); value != "" {
+		config.Scene = value
+	}
+	if value := os.Getenv("CALENDAR_LEAD"); value != "" {
+		lead, err := time.ParseDuration(value)
+		if err != nil || lead < 0 {
+			log.Printf("Warning: Invalid CALENDAR_LEAD %q, using %v", value, calendar.DefaultLead)
+		} else {
+			config.Lead = lead
+		}
+	}
+
+	log.Printf("Calendar: Watching %s, recalling %q %v before meetings", config.Path, config.Scene, config.Lead)
+	return config
+}
+
+// historyLimit reads how many states the undo history keeps from the environment
+func historyLimit() int {
+	value := os.Getenv("HISTORY_LIMIT")
+	if value == "" {
+		return history.DefaultLimit
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 2 {
+		log.Printf("Warning: Invalid HISTORY_LIMIT %q, using %d", value, history.DefaultLimit)
+		return history.DefaultLimit
+	}
+	return limit
+}
+
+// webListenConfig reads where and how the web server listens from the environment
+func webListenConfig() web.ListenConfig {
+	// Get web server port from environment variable or use default
+	port := os.Getenv("WEB_PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	config := web.ListenConfig{
+		Addr:         ":" + port,
+		CertFile:     os.Getenv("WEB_TLS_CERT"),
+		KeyFile:      os.Getenv("WEB_TLS_KEY"),
+		SelfSigned:   os.Getenv("WEB_TLS_SELF_SIGNED") != "",
+		ReadTimeout:  durationEnv("WEB_READ_TIMEOUT", web.DefaultReadTimeout),
+		WriteTimeout: durationEnv("WEB_WRITE_TIMEOUT", web.DefaultWriteTimeout),
+		IdleTimeout:  durationEnv("WEB_IDLE_TIMEOUT", web.DefaultIdleTimeout),
+	}
+	if addr := os.Getenv("WEB_ADDR"); addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err == nil {
+			config.Addr = addr
+		} else {
+			config.Addr = net.JoinHostPort(strings.Trim(addr, "[]"), port)
+		}
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		log.Println("Warning: WEB_TLS_CERT and WEB_TLS_KEY must be set together, ignoring them")
+		config.CertFile, config.KeyFile = "", ""
+	}
+	return config
+}
+
+// durationEnv reads a positive duration from an environment variable
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Warning: Invalid %s %q, using %v", name, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// webAuthConfig reads who may use the web server from the environment
+func webAuthConfig() web.AuthConfig {
+	config := web.AuthConfig{
+		Tokens:      credentials("WEB_TOKENS"),
+		Users:       credentials("WEB_USERS"),
+		CORSOrigins: splitList(os.Getenv("WEB_CORS_ORIGINS")),
+	}
+	config.SessionTTL = durationEnv("WEB_SESSION_TTL", web.DefaultSessionTTL)
+
+	if !config.Enabled() {
+		log.Println("Warning: No WEB_TOKENS or WEB_USERS set, anyone who can reach the web server can control the lights")
+	} else {
+		log.Printf("Web: %d API tokens and %d users configured", len(config.Tokens), len(config.Users))
+	}
+	return config
+}
+
+// credentials parses a comma-separated list of name:secret:role from an environment variable
+func credentials(name string) []web.Credential {
+	var list []web.Credential
+	for i, item := range splitList(os.Getenv(name)) {
+		credential, err := web.ParseCredential(item)
+		if err != nil {
+			log.Printf("Warning: Ignoring %s entry %d: %v", name, i+1, err)
+			continue
+		}
+		list = append(list, credential)
+	}
+	return list
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
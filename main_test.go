@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestWebListenConfigAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		port string
+		addr string
+		want string
+	}{
+		{"defaults", "", "", ":8080"},
+		{"port", "9000", "", ":9000"},
+		{"host", "", "127.0.0.1", "127.0.0.1:8080"},
+		{"host and port", "9000", "192.168.1.20", "192.168.1.20:9000"},
+		{"host with its own port", "9000", "0.0.0.0:8443", "0.0.0.0:8443"},
+		{"hostname", "", "lights.local", "lights.local:8080"},
+		{"IPv6", "", "::1", "[::1]:8080"},
+		{"bracketed IPv6", "", "[::1]", "[::1]:8080"},
+		{"IPv6 with port", "", "[::1]:8443", "[::1]:8443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WEB_PORT", tt.port)
+			t.Setenv("WEB_ADDR", tt.addr)
+			if got := webListenConfig().Addr; got != tt.want {
+				t.Errorf("Expected address %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWebListenConfigTLS(t *testing.T) {
+	t.Setenv("WEB_TLS_CERT", "cert.pem")
+	t.Setenv("WEB_TLS_KEY", "")
+	if config := webListenConfig(); config.CertFile != "" || config.TLS() {
+		t.Errorf("Expected a certificate without a key to be ignored, got %+v", config)
+	}
+
+	t.Setenv("WEB_TLS_KEY", "key.pem")
+	if config := webListenConfig(); config.CertFile != "cert.pem" || config.KeyFile != "key.pem" || !config.TLS() {
+		t.Errorf("Expected the certificate and key, got %+v", config)
+	}
+}
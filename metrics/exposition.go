@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Label is a name and value distinguishing one sample of a metric from another
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a metric
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// WriteGauge writes a gauge, a value that goes up and down, in the Prometheus text format
+func WriteGauge(w io.Writer, name, help string, samples ...Sample) error {
+	return writeFamily(w, name, help, "gauge", samples)
+}
+
+// WriteCounter writes a counter, a value that only goes up, in the Prometheus text format
+func WriteCounter(w io.Writer, name, help string, samples ...Sample) error {
+	return writeFamily(w, name, help, "counter", samples)
+}
+
+// writeFamily writes a metric's help, type and samples
+func writeFamily(w io.Writer, name, help, kind string, samples []Sample) error {
+	var buf bytes.Buffer
+	writeHeader(&buf, name, help, kind)
+	for _, sample := range samples {
+		writeSample(&buf, name, sample.Labels, sample.Value)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeHeader writes a metric's HELP and TYPE lines
+func writeHeader(buf *bytes.Buffer, name, help, kind string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+}
+
+// writeSample writes one sample line
+func writeSample(buf *bytes.Buffer, name string, labels []Label, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s=\"%s\"", label.Name, escapeLabel(label.Value))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatValue(value))
+	buf.WriteByte('\n')
+}
+
+// escapeLabel escapes a label value's backslashes, quotes and newlines
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatValue formats a sample value as Prometheus expects
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
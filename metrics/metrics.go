@@ -0,0 +1,187 @@
+// Package metrics counts what the lights system does, for Prometheus to scrape
+//
+// Metrics records MQTT publishes and state saves as they happen, through the
+// Publisher and StateStore wrappers, and writes them out in the Prometheus
+// text exposition format together with anything the caller adds, such as the
+// lights' current values.
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Buckets are the upper bounds, in seconds, of the latency histograms
+var Buckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Connection reports the state of the MQTT connection
+type Connection interface {
+	IsConnected() bool
+	Reconnects() int
+}
+
+// Metrics collects publish and save counts, failures and latencies
+type Metrics struct {
+	mu         sync.Mutex
+	publishes  map[string]*operation // by topic
+	saves      map[string]*operation // by device
+	clients    map[string]int        // by user interface
+	connection Connection
+}
+
+// operation counts one kind of operation and how long it takes
+type operation struct {
+	count    uint64
+	failures uint64
+	buckets  []uint64 // observations per bucket, not cumulative; the last is +Inf
+	sum      float64
+	last     time.Time // when it last succeeded
+}
+
+// New creates an empty set of metrics
+func New() *Metrics {
+	return &Metrics{
+		publishes: make(map[string]*operation),
+		saves:     make(map[string]*operation),
+		clients:   make(map[string]int),
+	}
+}
+
+// ObservePublish records a publish to a topic, how long it took and whether it failed
+func (m *Metrics) ObservePublish(topic string, took time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observe(m.publishes, topic, took, err)
+}
+
+// ObserveSave records a device's state being saved, how long it took and whether it failed
+func (m *Metrics) ObserveSave(device string, took time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observe(m.saves, device, took, err)
+}
+
+// SetClients records how many clients a user interface has
+func (m *Metrics) SetClients(ui string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[ui] = n
+}
+
+// WatchConnection reports the state of an MQTT connection
+func (m *Metrics) WatchConnection(connection Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connection = connection
+}
+
+// Connection returns the MQTT connection being watched, or nil
+func (m *Metrics) Connection() Connection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.connection
+}
+
+// LastPublished returns when a publish to each topic last succeeded
+// Topics that have never been published to successfully are left out.
+func (m *Metrics) LastPublished() map[string]time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last := make(map[string]time.Time, len(m.publishes))
+	for topic, op := range m.publishes {
+		if !op.last.IsZero() {
+			last[topic] = op.last
+		}
+	}
+	return last
+}
+
+// observe records an operation under key; the caller holds mu
+func observe(operations map[string]*operation, key string, took time.Duration, err error) {
+	op, ok := operations[key]
+	if !ok {
+		op = &operation{buckets: make([]uint64, len(Buckets)+1)}
+		operations[key] = op
+	}
+
+	op.count++
+	if err != nil {
+		op.failures++
+	} else {
+		op.last = time.Now()
+	}
+	seconds := took.Seconds()
+	op.sum += seconds
+	i := sort.SearchFloat64s(Buckets, seconds)
+	op.buckets[i]++
+}
+
+// Write writes the metrics in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var buf bytes.Buffer
+	writeOperations(&buf, m.publishes, "office_lights_mqtt_publishes", "office_lights_mqtt_publish", "topic", "MQTT publishes")
+	writeOperations(&buf, m.saves, "office_lights_storage_saves", "office_lights_storage_save", "device", "light state saves to the database")
+
+	if m.connection != nil {
+		connected := 0.0
+		if m.connection.IsConnected() {
+			connected = 1
+		}
+		WriteGauge(&buf, "office_lights_mqtt_connected", "Whether the MQTT client is connected to the broker.", Sample{Value: connected})
+		WriteCounter(&buf, "office_lights_mqtt_reconnects_total", "Times the MQTT client has reconnected to the broker.", Sample{Value: float64(m.connection.Reconnects())})
+	}
+
+	uis := make([]string, 0, len(m.clients))
+	for ui := range m.clients {
+		uis = append(uis, ui)
+	}
+	sort.Strings(uis)
+	var clients []Sample
+	for _, ui := range uis {
+		clients = append(clients, Sample{Labels: []Label{{"ui", ui}}, Value: float64(m.clients[ui])})
+	}
+	WriteGauge(&buf, "office_lights_ui_clients", "Clients connected to each user interface.", clients...)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeOperations writes the count, failures and latency histogram of a kind of operation
+// Counts are named plural_total, failures and the histogram name_failures_total and name_duration_seconds.
+func writeOperations(buf *bytes.Buffer, operations map[string]*operation, plural, name, label, what string) {
+	// In order, so the output is stable between scrapes
+	keys := make([]string, 0, len(operations))
+	for key := range operations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var counts, failures []Sample
+	for _, key := range keys {
+		labels := []Label{{label, key}}
+		counts = append(counts, Sample{Labels: labels, Value: float64(operations[key].count)})
+		failures = append(failures, Sample{Labels: labels, Value: float64(operations[key].failures)})
+	}
+	WriteCounter(buf, plural+"_total", "Number of "+what+".", counts...)
+	WriteCounter(buf, name+"_failures_total", "Number of failed "+what+".", failures...)
+
+	writeHeader(buf, name+"_duration_seconds", "How long "+what+" take.", "histogram")
+	for _, key := range keys {
+		op := operations[key]
+		var cumulative uint64
+		for i, bound := range Buckets {
+			cumulative += op.buckets[i]
+			writeSample(buf, name+"_duration_seconds_bucket", []Label{{label, key}, {"le", formatValue(bound)}}, float64(cumulative))
+		}
+		writeSample(buf, name+"_duration_seconds_bucket", []Label{{label, key}, {"le", "+Inf"}}, float64(op.count))
+		writeSample(buf, name+"_duration_seconds_sum", []Label{{label, key}}, op.sum)
+		writeSample(buf, name+"_duration_seconds_count", []Label{{label, key}}, float64(op.count))
+	}
+}
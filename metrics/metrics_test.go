@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// failingPublisher fails every publish
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(topic string, payload interface{}) error {
+	return errors.New("not connected")
+}
+
+// fakeConnection is a connection with a fixed state
+type fakeConnection struct {
+	connected  bool
+	reconnects int
+}
+
+func (c fakeConnection) IsConnected() bool { return c.connected }
+func (c fakeConnection) Reconnects() int   { return c.reconnects }
+
+// scrape returns the metrics as Prometheus would see them
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	return buf.String()
+}
+
+// expectLines checks every line appears in the output
+func expectLines(t *testing.T, output string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, output)
+		}
+	}
+}
+
+func TestPublisherCountsPerTopic(t *testing.T) {
+	m := New()
+	mock := mqtt.NewMockPublisher()
+	publisher := m.Publisher(mock)
+
+	publisher.Publish("kevinoffice/ledstrip/sequence", "a")
+	publisher.Publish("kevinoffice/ledstrip/sequence", "b")
+	publisher.Publish("kevinoffice/videolight/1/command/light:0", "c")
+	if err := m.Publisher(failingPublisher{}).Publish("kevinoffice/ledbar/0", "d"); err == nil {
+		t.Error("Expected the publish error to be passed back")
+	}
+
+	if mock.MessageCount() != 3 {
+		t.Errorf("Expected 3 messages passed on, got %d", mock.MessageCount())
+	}
+	last := m.LastPublished()
+	if len(last) != 2 || last["kevinoffice/ledstrip/sequence"].IsZero() {
+		t.Errorf("Expected the last publish of the 2 topics that succeeded, got %v", last)
+	}
+	expectLines(t, scrape(t, m),
+		"# TYPE office_lights_mqtt_publishes_total counter",
+		`office_lights_mqtt_publishes_total{topic="kevinoffice/ledstrip/sequence"} 2`,
+		`office_lights_mqtt_publishes_total{topic="kevinoffice/videolight/1/command/light:0"} 1`,
+		`office_lights_mqtt_publishes_total{topic="kevinoffice/ledbar/0"} 1`,
+		`office_lights_mqtt_publish_failures_total{topic="kevinoffice/ledbar/0"} 1`,
+		`office_lights_mqtt_publish_failures_total{topic="kevinoffice/ledstrip/sequence"} 0`,
+		"# TYPE office_lights_mqtt_publish_duration_seconds histogram",
+		`office_lights_mqtt_publish_duration_seconds_count{topic="kevinoffice/ledstrip/sequence"} 2`,
+	)
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	m := New()
+	m.ObserveSave("ledbar", 2*time.Millisecond, nil)
+	m.ObserveSave("ledbar", 40*time.Millisecond, nil)
+	m.ObserveSave("ledbar", 10*time.Second, errors.New("disk full"))
+
+	expectLines(t, scrape(t, m),
+		`office_lights_storage_save_duration_seconds_bucket{device="ledbar",le="0.001"} 0`,
+		`office_lights_storage_save_duration_seconds_bucket{device="ledbar",le="0.0025"} 1`,
+		`office_lights_storage_save_duration_seconds_bucket{device="ledbar",le="0.05"} 2`,
+		`office_lights_storage_save_duration_seconds_bucket{device="ledbar",le="5"} 2`,
+		`office_lights_storage_save_duration_seconds_bucket{device="ledbar",le="+Inf"} 3`,
+		`office_lights_storage_save_duration_seconds_sum{device="ledbar"} 10.042`,
+		`office_lights_storage_save_duration_seconds_count{device="ledbar"} 3`,
+		`office_lights_storage_save_failures_total{device="ledbar"} 1`,
+	)
+}
+
+func TestStateStoreRecordsSaves(t *testing.T) {
+	m := New()
+	mock := storage.NewMockStore()
+	store := m.StateStore(mock)
+
+	store.SaveLEDStripState(0, 255, 0, 0)
+	store.SaveVideoLightState(0, true, 50)
+	store.SaveVideoLightState(1, false, 0)
+
+	if len(mock.GetVideoLightCalls()) != 2 {
+		t.Errorf("Expected 2 video light saves passed on, got %d", len(mock.GetVideoLightCalls()))
+	}
+	expectLines(t, scrape(t, m),
+		`office_lights_storage_saves_total{device="ledstrip"} 1`,
+		`office_lights_storage_saves_total{device="videolight"} 2`,
+	)
+}
+
+func TestConnectionAndClients(t *testing.T) {
+	m := New()
+	m.WatchConnection(fakeConnection{connected: true, reconnects: 3})
+	m.SetClients("web_events", 2)
+	m.SetClients("tui", 1)
+
+	expectLines(t, scrape(t, m),
+		"office_lights_mqtt_connected 1",
+		"office_lights_mqtt_reconnects_total 3",
+		`office_lights_ui_clients{ui="tui"} 1`,
+		`office_lights_ui_clients{ui="web_events"} 2`,
+	)
+}
+
+func TestLabelsAreEscaped(t *testing.T) {
+	var buf bytes.Buffer
+	WriteGauge(&buf, "test_gauge", "A test.", Sample{Labels: []Label{{"name", "say \"hi\"\\\n"}}, Value: 0.5})
+
+	expectLines(t, buf.String(),
+		"# HELP test_gauge A test.",
+		"# TYPE test_gauge gauge",
+		`test_gauge{name="say \"hi\"\\\n"} 0.5`,
+	)
+}
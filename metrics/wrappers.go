@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// Publisher defines the interface for publishing MQTT messages, as the light drivers use it
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
+
+// publisher times and counts the publishes going through it
+type publisher struct {
+	next    Publisher
+	metrics *Metrics
+}
+
+// Publisher wraps a publisher so every publish through it is recorded
+func (m *Metrics) Publisher(next Publisher) Publisher {
+	return &publisher{next: next, metrics: m}
+}
+
+// Publish publishes a message, recording how long it took and whether it failed
+func (p *publisher) Publish(topic string, payload interface{}) error {
+	start := time.Now()
+	err := p.next.Publish(topic, payload)
+	p.metrics.ObservePublish(topic, time.Since(start), err)
+	return err
+}
+
+// stateStore times and counts the light state saves going through it
+type stateStore struct {
+	storage.StateStore
+	metrics *Metrics
+}
+
+// StateStore wraps a state store so every save through it is recorded
+func (m *Metrics) StateStore(next storage.StateStore) storage.StateStore {
+	return &stateStore{StateStore: next, metrics: m}
+}
+
+// SaveLEDStripState saves the LED strip's state, recording how long it took and whether it failed
+func (s *stateStore) SaveLEDStripState(id int, r, g, b int) error {
+	start := time.Now()
+	err := s.StateStore.SaveLEDStripState(id, r, g, b)
+	s.metrics.ObserveSave("ledstrip", time.Since(start), err)
+	return err
+}
+
+// SaveLEDBarChannels saves the LED bar's channels, recording how long it took and whether it failed
+func (s *stateStore) SaveLEDBarChannels(ledbarID int, channels []int) error {
+	start := time.Now()
+	err := s.StateStore.SaveLEDBarChannels(ledbarID, channels)
+	s.metrics.ObserveSave("ledbar", time.Since(start), err)
+	return err
+}
+
+// SaveVideoLightState saves a video light's state, recording how long it took and whether it failed
+func (s *stateStore) SaveVideoLightState(id int, on bool, brightness int) error {
+	start := time.Now()
+	err := s.StateStore.SaveVideoLightState(id, on, brightness)
+	s.metrics.ObserveSave("videolight", time.Since(start), err)
+	return err
+}
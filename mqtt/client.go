@@ -3,15 +3,24 @@ package mqtt
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// MessageHandler is called with the topic and payload of each received message
+type MessageHandler func(topic string, payload []byte)
+
 // Client wraps the MQTT client functionality
 type Client struct {
 	client mqtt.Client
 	broker string
+
+	mu            sync.Mutex
+	subscriptions map[string]MessageHandler // resubscribed after reconnecting
+	connects      int                       // times connected, including the first
+	listeners     []func(connected bool)    // told when the connection comes and goes
 }
 
 // Config holds MQTT connection configuration
@@ -40,23 +49,31 @@ func NewClient(config Config) (*Client, error) {
 	opts.SetConnectTimeout(5 * time.Second)
 	opts.SetKeepAlive(30 * time.Second)
 
+	c := &Client{
+		broker:        config.Broker,
+		subscriptions: make(map[string]MessageHandler),
+	}
+
 	// Set connection callbacks
-	opts.OnConnect = func(c mqtt.Client) {
+	opts.OnConnect = func(mqtt.Client) {
 		log.Println("MQTT: Connected to broker")
+		c.mu.Lock()
+		c.connects++
+		c.mu.Unlock()
+		c.resubscribe()
+		c.connectionChanged(true)
 	}
-	opts.OnConnectionLost = func(c mqtt.Client, err error) {
+	opts.OnConnectionLost = func(_ mqtt.Client, err error) {
 		log.Printf("MQTT: Connection lost: %v\n", err)
+		c.connectionChanged(false)
 	}
 	opts.OnReconnecting = func(c mqtt.Client, opts *mqtt.ClientOptions) {
 		log.Println("MQTT: Reconnecting to broker...")
 	}
 
-	client := mqtt.NewClient(opts)
+	c.client = mqtt.NewClient(opts)
 
-	return &Client{
-		client: client,
-		broker: config.Broker,
-	}, nil
+	return c, nil
 }
 
 // Connect establishes connection to the MQTT broker
@@ -109,7 +126,101 @@ func (c *Client) Publish(topic string, payload interface{}) error {
 	return nil
 }
 
+// Subscribe registers a handler for messages on a topic
+// The subscription is restored automatically after a reconnect.
+func (c *Client) Subscribe(topic string, handler MessageHandler) error {
+	c.mu.Lock()
+	c.subscriptions[topic] = handler
+	c.mu.Unlock()
+
+	if !c.client.IsConnected() {
+		// Subscribed on the next connect
+		return nil
+	}
+	return c.subscribe(topic, handler)
+}
+
+// Unsubscribe removes the handler for a topic
+func (c *Client) Unsubscribe(topic string) error {
+	c.mu.Lock()
+	delete(c.subscriptions, topic)
+	c.mu.Unlock()
+
+	if !c.client.IsConnected() {
+		return nil
+	}
+
+	token := c.client.Unsubscribe(topic)
+	if !token.WaitTimeout(2 * time.Second) {
+		return fmt.Errorf("unsubscribe timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("unsubscribe failed: %w", err)
+	}
+
+	log.Printf("MQTT: Unsubscribed from topic '%s'\n", topic)
+	return nil
+}
+
+// subscribe sends a subscription request to the broker
+func (c *Client) subscribe(topic string, handler MessageHandler) error {
+	token := c.client.Subscribe(topic, 0, func(_ mqtt.Client, msg mqtt.Message) {
+		handler(msg.Topic(), msg.Payload())
+	})
+	if !token.WaitTimeout(2 * time.Second) {
+		return fmt.Errorf("subscribe timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("subscribe failed: %w", err)
+	}
+
+	log.Printf("MQTT: Subscribed to topic '%s'\n", topic)
+	return nil
+}
+
+// resubscribe restores all subscriptions after (re)connecting
+func (c *Client) resubscribe() {
+	c.mu.Lock()
+	subs := make(map[string]MessageHandler, len(c.subscriptions))
+	for topic, handler := range c.subscriptions {
+		subs[topic] = handler
+	}
+	c.mu.Unlock()
+
+	for topic, handler := range subs {
+		// Paho runs OnConnect in its own goroutine, so waiting on the token here is safe
+		if err := c.subscribe(topic, handler); err != nil {
+			log.Printf("MQTT: Failed to resubscribe to '%s': %v\n", topic, err)
+		}
+	}
+}
+
+// OnConnectionChange registers a function called whenever the client connects to or loses the broker
+func (c *Client) OnConnectionChange(fn func(connected bool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+// connectionChanged tells the listeners the connection has come or gone
+func (c *Client) connectionChanged(connected bool) {
+	c.mu.Lock()
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(connected)
+	}
+}
+
 // IsConnected returns whether the client is currently connected
 func (c *Client) IsConnected() bool {
 	return c.client.IsConnected()
 }
+
+// Reconnects returns how many times the client has reconnected after losing the broker
+func (c *Client) Reconnects() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return max(c.connects-1, 0)
+}
@@ -13,4 +13,26 @@ const (
 
 	// TopicVideoLight2 is the topic for controlling video light 2
 	TopicVideoLight2 = "kevinoffice/videolight/2/command/light:0"
+
+	// TopicCommand is the topic this application listens on for scene recalls and transitions
+	TopicCommand = "kevinoffice/office_lights/command"
+
+	// TopicEffect is the topic this application listens on to start and stop effects
+	TopicEffect = "kevinoffice/office_lights/effect"
+
+	// TopicSequence is the topic this application listens on to play, pause and stop sequences
+	TopicSequence = "kevinoffice/office_lights/sequence"
+
+	// TopicOnAir is the topic this application listens on to switch the on-air indicator
+	TopicOnAir = "kevinoffice/office_lights/onair"
+
+	// TopicOnAirState is the topic the on-air state ("on" or "off") is published to when it changes
+	TopicOnAirState = "kevinoffice/office_lights/onair/state"
+
+	// TopicNotify is the topic this application listens on for notifications to flash
+	TopicNotify = "kevinoffice/office_lights/notify"
 )
+
+// CommandTopics lists the topics this application subscribes to for its own commands
+// Each topic has a single handler, so nothing else may subscribe to exactly these.
+var CommandTopics = []string{TopicCommand, TopicEffect, TopicSequence, TopicOnAir, TopicNotify}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CommandHandler queues notifications received over MQTT
+//
+// The payload is a notification as JSON, "clear" to stop every notification,
+// or just a colour to flash with the defaults.
+//
+// Example:
+//
+//	{"name": "doorbell", "color": "#00ff00", "blinks": 2, "priority": 10}
+//	#ff0000
+//	clear
+type CommandHandler struct {
+	notifier *Notifier
+}
+
+// NewCommandHandler creates a notification command handler
+func NewCommandHandler(notifier *Notifier) *CommandHandler {
+	return &CommandHandler{notifier: notifier}
+}
+
+// Handle decodes and queues a notification, or clears them
+func (h *CommandHandler) Handle(payload []byte) error {
+	text := strings.TrimSpace(string(payload))
+	switch {
+	case strings.EqualFold(text, "clear"):
+		h.notifier.Clear()
+		return nil
+	case strings.HasPrefix(text, "#"):
+		_, err := h.notifier.Notify(Notification{Color: text})
+		return err
+	}
+
+	var n Notification
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return fmt.Errorf("invalid notification %q (use JSON, a #rrggbb colour or clear)", text)
+	}
+	_, err := h.notifier.Notify(n)
+	return err
+}
@@ -0,0 +1,14 @@
+package notify
+
+import "errors"
+
+var (
+	// ErrInvalidNotification is returned for a notification with unknown lights, a bad colour or out of range timing
+	ErrInvalidNotification = errors.New("invalid notification")
+
+	// ErrQueueFull is returned when MaxQueue notifications are already waiting
+	ErrQueueFull = errors.New("notification queue is full")
+
+	// ErrNotFound is returned when cancelling a notification that has finished or never existed
+	ErrNotFound = errors.New("notification not found")
+)
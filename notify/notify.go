@@ -0,0 +1,309 @@
+// Package notify flashes notifications, such as a failed build or the doorbell, on the lights
+//
+// A notification blinks a colour pattern on a set of lights a number of times
+// and then lets them show whatever they were showing before. It works through
+// the drivers' overrides, so the lights' saved state is never touched and
+// anything changed underneath while it flashes shows afterwards. One
+// notification flashes at a time; the rest wait in a queue, highest priority
+// first.
+package notify
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/lights"
+)
+
+// Defaults for the parts of a notification left out
+const (
+	DefaultColor    = "#ffffff"
+	DefaultBlinks   = 3
+	DefaultDuration = 1500 * time.Millisecond
+)
+
+// DefaultLights are the lights a notification flashes when none are given
+var DefaultLights = []string{"ledBar"}
+
+// Limits on a notification's timing and the queue
+const (
+	MaxBlinks   = 50
+	MinBlink    = 100 * time.Millisecond // shortest on-and-off period of one blink
+	MaxDuration = time.Minute
+	MaxQueue    = 20
+)
+
+// Notification is a colour pattern to flash
+//
+// Example:
+//
+//	{"name": "ci", "lights": ["ledBar.section1"], "colors": ["#ff0000", "#000080"], "blinks": 4, "duration": 2000, "priority": 5}
+type Notification struct {
+	Name     string   `json:"name,omitempty"`     // label shown in the queue and logs
+	Lights   []string `json:"lights,omitempty"`   // light names, as for partial scenes
+	Color    string   `json:"color,omitempty"`    // "#rrggbb" for every blink
+	Colors   []string `json:"colors,omitempty"`   // a colour per blink, repeated as needed; takes the place of Color
+	Blinks   int      `json:"blinks,omitempty"`   // number of times the lights flash
+	Duration int      `json:"duration,omitempty"` // milliseconds for all the blinks
+	Priority int      `json:"priority,omitempty"` // higher priorities flash first
+}
+
+// Status describes a notification flashing or waiting its turn
+type Status struct {
+	ID           int  `json:"id"`
+	Notification      // with defaults filled in
+	Flashing     bool `json:"flashing"`
+	Blink        int  `json:"blink,omitempty"` // the blink under way, from 1, while flashing
+}
+
+// Notifier flashes notifications one at a time
+type Notifier struct {
+	rig   *lights.Rig
+	clock clock.Clock
+
+	mu      sync.Mutex
+	nextID  int
+	queue   []*flash // waiting, highest priority first, then oldest first
+	current *flash
+	done    chan struct{} // closed when the queue has run out, nil while idle
+}
+
+// flash is a validated notification and its progress
+type flash struct {
+	id       int
+	n        Notification
+	sel      lights.Selection
+	colors   [][3]int
+	duration time.Duration
+	blink    int
+	cancel   chan struct{}
+}
+
+// NewNotifier creates a notifier for the lights of a rig
+func NewNotifier(rig *lights.Rig, clk clock.Clock) *Notifier {
+	return &Notifier{rig: rig, clock: clk, nextID: 1}
+}
+
+// Notify queues a notification, returning its ID
+// It starts flashing straight away unless another notification is flashing.
+func (n *Notifier) Notify(notification Notification) (int, error) {
+	f, err := prepare(notification)
+	if err != nil {
+		return 0, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.queue) >= MaxQueue {
+		return 0, ErrQueueFull
+	}
+
+	f.id = n.nextID
+	n.nextID++
+
+	// Behind everything of the same or higher priority
+	at := len(n.queue)
+	for i, queued := range n.queue {
+		if queued.n.Priority < f.n.Priority {
+			at = i
+			break
+		}
+	}
+	n.queue = slices.Insert(n.queue, at, f)
+
+	if n.done == nil {
+		n.done = make(chan struct{})
+		go n.run(n.done)
+	}
+	return f.id, nil
+}
+
+// Cancel stops a flashing notification or takes a waiting one off the queue
+func (n *Notifier) Cancel(id int) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.current != nil && n.current.id == id {
+		n.cancelCurrent()
+		return nil
+	}
+	for i, f := range n.queue {
+		if f.id == id {
+			n.queue = slices.Delete(n.queue, i, i+1)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Clear stops the flashing notification and empties the queue
+func (n *Notifier) Clear() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.queue = nil
+	if n.current != nil {
+		n.cancelCurrent()
+	}
+}
+
+// Stop clears the notifications and waits for the lights to be given back
+func (n *Notifier) Stop() {
+	n.mu.Lock()
+	n.queue = nil
+	if n.current != nil {
+		n.cancelCurrent()
+	}
+	done := n.done
+	n.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// List returns the flashing notification, if any, followed by the queue in the order it will flash
+func (n *Notifier) List() []Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	list := make([]Status, 0, len(n.queue)+1)
+	if n.current != nil {
+		list = append(list, Status{ID: n.current.id, Notification: n.current.n, Flashing: true, Blink: n.current.blink})
+	}
+	for _, f := range n.queue {
+		list = append(list, Status{ID: f.id, Notification: f.n})
+	}
+	return list
+}
+
+// cancelCurrent stops the flashing notification; the caller holds mu
+func (n *Notifier) cancelCurrent() {
+	select {
+	case <-n.current.cancel:
+	default:
+		close(n.current.cancel)
+	}
+}
+
+// run flashes queued notifications until the queue is empty
+func (n *Notifier) run(done chan struct{}) {
+	defer close(done)
+
+	for {
+		n.mu.Lock()
+		if len(n.queue) == 0 {
+			n.current = nil
+			n.done = nil
+			n.mu.Unlock()
+			return
+		}
+		f := n.queue[0]
+		n.queue = n.queue[1:]
+		n.current = f
+		n.mu.Unlock()
+
+		n.play(f)
+	}
+}
+
+// play flashes a notification's blinks and then gives the lights back
+func (n *Notifier) play(f *flash) {
+	log.Printf("Notify: Flashing %s (%d blinks, priority %d)", f.label(), f.n.Blinks, f.n.Priority)
+
+	half := f.duration / time.Duration(2*f.n.Blinks)
+	finished := true
+	for blink := 0; blink < f.n.Blinks; blink++ {
+		n.mu.Lock()
+		f.blink = blink + 1
+		n.mu.Unlock()
+
+		color := f.colors[blink%len(f.colors)]
+		if err := n.rig.ShowColor(lights.LayerNotification, f.sel, color, 1); err != nil {
+			log.Printf("Notify: Flash failed: %v", err)
+		}
+		if finished = n.wait(f, half); !finished {
+			break
+		}
+		if err := n.rig.ShowColor(lights.LayerNotification, f.sel, color, 0); err != nil {
+			log.Printf("Notify: Flash failed: %v", err)
+		}
+		if finished = n.wait(f, half); !finished {
+			break
+		}
+	}
+
+	if err := n.rig.ClearOverride(lights.LayerNotification, f.sel); err != nil {
+		log.Printf("Notify: Failed to restore the lights: %v", err)
+	}
+	if !finished {
+		log.Printf("Notify: Cancelled %s", f.label())
+	}
+}
+
+// wait waits for d, returning false if the notification is cancelled first
+func (n *Notifier) wait(f *flash, d time.Duration) bool {
+	select {
+	case <-f.cancel:
+		return false
+	case <-n.clock.After(d):
+		return true
+	}
+}
+
+// label names a flash in logs
+func (f *flash) label() string {
+	if f.n.Name != "" {
+		return fmt.Sprintf("%q", f.n.Name)
+	}
+	return fmt.Sprintf("notification %d", f.id)
+}
+
+// prepare fills in defaults and checks a notification
+func prepare(n Notification) (*flash, error) {
+	if len(n.Lights) == 0 {
+		n.Lights = slices.Clone(DefaultLights)
+	}
+	if len(n.Colors) == 0 {
+		if n.Color == "" {
+			n.Color = DefaultColor
+		}
+		n.Colors = []string{n.Color}
+	}
+	if n.Blinks == 0 {
+		n.Blinks = DefaultBlinks
+	}
+	if n.Duration == 0 {
+		n.Duration = int(DefaultDuration / time.Millisecond)
+	}
+
+	sel, err := lights.ParseSelection(n.Lights)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	colors := make([][3]int, len(n.Colors))
+	for i, c := range n.Colors {
+		if colors[i], err = lights.ParseColor(c); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+		}
+	}
+
+	if n.Blinks < 1 || n.Blinks > MaxBlinks {
+		return nil, fmt.Errorf("%w: blinks must be between 1 and %d, got %d", ErrInvalidNotification, MaxBlinks, n.Blinks)
+	}
+	duration := time.Duration(n.Duration) * time.Millisecond
+	if duration <= 0 || duration > MaxDuration {
+		return nil, fmt.Errorf("%w: duration must be between 1 and %d milliseconds, got %d", ErrInvalidNotification, MaxDuration/time.Millisecond, n.Duration)
+	}
+	if duration/time.Duration(n.Blinks) < MinBlink {
+		return nil, fmt.Errorf("%w: %d blinks need at least %d milliseconds", ErrInvalidNotification, n.Blinks, int64(n.Blinks)*MinBlink.Milliseconds())
+	}
+
+	return &flash{n: n, sel: sel, colors: colors, duration: duration, cancel: make(chan struct{})}, nil
+}
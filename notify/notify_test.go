@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+)
+
+// newTestNotifier creates a notifier on a fake clock with mock lights, the LED strip showing 200,100,50
+func newTestNotifier(t *testing.T) (*Notifier, *lights.Rig, *mqtt.MockPublisher, *clock.Fake) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, mock, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, mock, "test/vl2")
+	strip.SetColor(200, 100, 50)
+
+	fake := clock.NewFake(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	rig := lights.NewRig(strip, bar, vl1, vl2)
+	notifier := NewNotifier(rig, fake)
+	t.Cleanup(notifier.Stop)
+	return notifier, rig, mock, fake
+}
+
+// stripShows returns the colour last published to the LED strip
+func stripShows(t *testing.T, mock *mqtt.MockPublisher) [3]int {
+	t.Helper()
+	messages := mock.GetMessages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Topic != "test/strip" {
+			continue
+		}
+		var msg struct {
+			Data struct{ R, G, B int } `json:"data"`
+		}
+		if err := json.Unmarshal(messages[i].Payload.([]byte), &msg); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return [3]int{msg.Data.R, msg.Data.G, msg.Data.B}
+	}
+	t.Fatal("Nothing published to the strip")
+	return [3]int{}
+}
+
+// waitFor polls until cond is true, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlashAndRestore(t *testing.T) {
+	notifier, rig, mock, fake := newTestNotifier(t)
+
+	_, err := notifier.Notify(Notification{Lights: []string{"ledStrip"}, Colors: []string{"#ff0000", "#0000ff"}, Blinks: 2, Duration: 1000})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	steps := [][3]int{{255, 0, 0}, {0, 0, 0}, {0, 0, 255}, {0, 0, 0}}
+	for i, want := range steps {
+		fake.BlockUntil(1)
+		if got := stripShows(t, mock); got != want {
+			t.Errorf("Step %d: expected the strip to show %v, got %v", i, want, got)
+		}
+		if i == 1 {
+			// Changes underneath carry on and show once the flash is over
+			rig.Strip.SetColor(10, 20, 30)
+		}
+		fake.Advance(250 * time.Millisecond)
+	}
+
+	waitFor(t, "the notification to finish", func() bool { return len(notifier.List()) == 0 })
+	if got := stripShows(t, mock); got != [3]int{10, 20, 30} {
+		t.Errorf("Expected the strip's own colour after the flash, got %v", got)
+	}
+	if rig.Strip.Overridden() {
+		t.Error("Expected the override to be cleared")
+	}
+}
+
+func TestQueueByPriority(t *testing.T) {
+	notifier, _, _, fake := newTestNotifier(t)
+
+	ids := make(map[string]int)
+	for _, n := range []Notification{
+		{Name: "first"},
+		{Name: "low", Priority: 1},
+		{Name: "high", Priority: 5},
+		{Name: "high again", Priority: 5},
+	} {
+		id, err := notifier.Notify(n)
+		if err != nil {
+			t.Fatalf("Notify(%s) failed: %v", n.Name, err)
+		}
+		ids[n.Name] = id
+		if n.Name == "first" {
+			fake.BlockUntil(1)
+		}
+	}
+
+	var order []string
+	for _, status := range notifier.List() {
+		order = append(order, status.Name)
+	}
+	want := []string{"first", "high", "high again", "low"}
+	if len(order) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, order)
+		}
+	}
+
+	list := notifier.List()
+	if !list[0].Flashing || list[0].Blink != 1 || list[1].Flashing {
+		t.Errorf("Expected only the first to be flashing, on blink 1, got %+v", list[:2])
+	}
+	if list[0].Blinks != DefaultBlinks || list[0].Color != DefaultColor {
+		t.Errorf("Expected defaults to be filled in, got %+v", list[0].Notification)
+	}
+
+	// Once the first is cancelled, the highest priority flashes next
+	if err := notifier.Cancel(ids["first"]); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	waitFor(t, "the next notification", func() bool {
+		list := notifier.List()
+		return len(list) > 0 && list[0].Flashing && list[0].Name == "high"
+	})
+}
+
+func TestCancelAndClear(t *testing.T) {
+	notifier, rig, _, fake := newTestNotifier(t)
+
+	first, _ := notifier.Notify(Notification{Lights: []string{"ledStrip"}})
+	queued, _ := notifier.Notify(Notification{Lights: []string{"ledStrip"}})
+	fake.BlockUntil(1)
+
+	if err := notifier.Cancel(queued); err != nil {
+		t.Fatalf("Cancel of a queued notification failed: %v", err)
+	}
+	if err := notifier.Cancel(queued); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound cancelling twice, got %v", err)
+	}
+	if list := notifier.List(); len(list) != 1 || list[0].ID != first {
+		t.Errorf("Expected only the first left, got %+v", list)
+	}
+
+	notifier.Notify(Notification{Lights: []string{"ledStrip"}})
+	notifier.Clear()
+	waitFor(t, "the notifications to clear", func() bool { return len(notifier.List()) == 0 })
+	if rig.Strip.Overridden() {
+		t.Error("Expected the strip to be given back")
+	}
+}
+
+func TestOnAirHidesNotification(t *testing.T) {
+	notifier, rig, mock, fake := newTestNotifier(t)
+
+	onAir := lights.Selection{LEDStrip: true}
+	rig.ShowColor(lights.LayerOnAir, onAir, [3]int{255, 0, 0}, 1)
+
+	notifier.Notify(Notification{Lights: []string{"ledStrip"}, Color: "#00ff00", Blinks: 1, Duration: 200})
+	fake.BlockUntil(1)
+	if got := stripShows(t, mock); got != [3]int{255, 0, 0} {
+		t.Errorf("Expected the on-air colour to stay on top, got %v", got)
+	}
+
+	fake.Advance(100 * time.Millisecond)
+	fake.BlockUntil(1)
+	fake.Advance(100 * time.Millisecond)
+	waitFor(t, "the notification to finish", func() bool { return len(notifier.List()) == 0 })
+	if got := stripShows(t, mock); got != [3]int{255, 0, 0} {
+		t.Errorf("Expected the on-air colour after the flash, got %v", got)
+	}
+}
+
+func TestNotifyValidation(t *testing.T) {
+	notifier, _, _, _ := newTestNotifier(t)
+
+	tests := []struct {
+		name string
+		n    Notification
+	}{
+		{"unknown light", Notification{Lights: []string{"desk"}}},
+		{"bad colour", Notification{Color: "red"}},
+		{"bad pattern colour", Notification{Colors: []string{"#ff0000", "blue"}}},
+		{"negative blinks", Notification{Blinks: -1}},
+		{"too many blinks", Notification{Blinks: MaxBlinks + 1, Duration: 60000}},
+		{"too long", Notification{Duration: 61000}},
+		{"blinks too fast", Notification{Blinks: 10, Duration: 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := notifier.Notify(tt.n); !errors.Is(err, ErrInvalidNotification) {
+				t.Errorf("Expected ErrInvalidNotification, got %v", err)
+			}
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	notifier, _, _, fake := newTestNotifier(t)
+
+	notifier.Notify(Notification{})
+	fake.BlockUntil(1)
+	for i := 0; i < MaxQueue; i++ {
+		if _, err := notifier.Notify(Notification{}); err != nil {
+			t.Fatalf("Notify %d failed: %v", i, err)
+		}
+	}
+	if _, err := notifier.Notify(Notification{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	notifier, _, _, fake := newTestNotifier(t)
+	handler := NewCommandHandler(notifier)
+
+	if err := handler.Handle([]byte(`{"name": "doorbell", "color": "#00ff00", "priority": 10}`)); err != nil {
+		t.Fatalf("Handle(JSON) failed: %v", err)
+	}
+	fake.BlockUntil(1)
+	if err := handler.Handle([]byte(" #ff0000\n")); err != nil {
+		t.Fatalf("Handle(colour) failed: %v", err)
+	}
+
+	list := notifier.List()
+	if len(list) != 2 || list[0].Name != "doorbell" || list[1].Color != "#ff0000" {
+		t.Errorf("Expected the doorbell then red, got %+v", list)
+	}
+
+	if err := handler.Handle([]byte("CLEAR")); err != nil {
+		t.Fatalf("Handle(clear) failed: %v", err)
+	}
+	waitFor(t, "the notifications to clear", func() bool { return len(notifier.List()) == 0 })
+
+	for _, payload := range []string{"flash", `{"color": "red"}`} {
+		if err := handler.Handle([]byte(payload)); err == nil {
+			t.Errorf("Expected an error for %q", payload)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package onair
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Command switches the on-air indicator, received over MQTT
+//
+// The payload is "on", "off" or "toggle", or JSON giving the state and
+// optionally new settings.
+//
+// Example:
+//
+//	on
+//	{"active": true}
+//	{"toggle": true}
+//	{"active": true, "color": "#ff8000", "pulse": 1500}
+type Command struct {
+	Active *bool    `json:"active,omitempty"`
+	Toggle bool     `json:"toggle,omitempty"`
+	Lights []string `json:"lights,omitempty"`
+	Color  string   `json:"color,omitempty"`
+	Pulse  *int     `json:"pulse,omitempty"`
+}
+
+// CommandHandler applies on-air commands to an indicator
+type CommandHandler struct {
+	indicator *Indicator
+}
+
+// NewCommandHandler creates an on-air command handler
+func NewCommandHandler(indicator *Indicator) *CommandHandler {
+	return &CommandHandler{indicator: indicator}
+}
+
+// Handle decodes and applies a plain or JSON on-air command
+func (h *CommandHandler) Handle(payload []byte) error {
+	on, off := true, false
+	var cmd Command
+	switch word := strings.ToLower(strings.TrimSpace(string(payload))); word {
+	case "on", "true", "1":
+		cmd.Active = &on
+	case "off", "false", "0":
+		cmd.Active = &off
+	case "toggle":
+		cmd.Toggle = true
+	default:
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			return fmt.Errorf("invalid on-air command %q (use on, off, toggle or JSON)", word)
+		}
+	}
+	return h.Apply(cmd)
+}
+
+// Apply applies an on-air command
+func (h *CommandHandler) Apply(cmd Command) error {
+	if cmd.Toggle && cmd.Active != nil {
+		return fmt.Errorf("on-air command must either toggle or give the state, not both")
+	}
+
+	settings := h.indicator.Settings()
+	switch {
+	case cmd.Toggle:
+		settings.Active = !settings.Active
+	case cmd.Active != nil:
+		settings.Active = *cmd.Active
+	case cmd.Lights == nil && cmd.Color == "" && cmd.Pulse == nil:
+		return fmt.Errorf("on-air command must give the state, toggle or settings")
+	}
+	if cmd.Lights != nil {
+		settings.Lights = cmd.Lights
+	}
+	if cmd.Color != "" {
+		settings.Color = cmd.Color
+	}
+	if cmd.Pulse != nil {
+		settings.Pulse = *cmd.Pulse
+	}
+	return h.indicator.Configure(settings)
+}
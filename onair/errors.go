@@ -0,0 +1,6 @@
+package onair
+
+import "errors"
+
+// ErrInvalidSettings is returned for settings with no lights, a bad colour or too short a pulse
+var ErrInvalidSettings = errors.New("invalid on-air settings")
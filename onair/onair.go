@@ -0,0 +1,293 @@
+// Package onair shows an "on air" status on a chosen set of lights
+//
+// While the indicator is on, its lights show a status colour, steady or
+// pulsing, in place of whatever they were doing. It works through the drivers'
+// overrides, so scenes, effects, sequences, schedules and manual changes carry
+// on underneath without reaching the lights; switching the indicator off shows
+// the lights as they are underneath again.
+package onair
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// DefaultColor is the status colour until one is configured
+const DefaultColor = "#ff0000"
+
+// DefaultLights are the lights the indicator takes over until others are configured
+var DefaultLights = []string{"ledStrip"}
+
+// MinPulse is the shortest pulse period allowed
+const MinPulse = 200 * time.Millisecond
+
+// pulseFloor is how far a pulse dims, as a fraction of the status colour
+const pulseFloor = 0.2
+
+// Indicator switches the on-air status on and off
+// Settings, including whether the indicator is on, are saved in the store and
+// picked up again by Start after a restart.
+type Indicator struct {
+	rig           *lights.Rig
+	store         storage.OnAirStore
+	clock         clock.Clock
+	frameInterval time.Duration
+
+	// switching is held while the indicator is shown or hidden, so changes don't interleave
+	switching sync.Mutex
+
+	mu       sync.Mutex
+	settings storage.OnAirSettings
+	shown    *shown // the lights overridden while the indicator is on
+	onChange []func(active bool)
+}
+
+// shown is the indicator on its lights, pulsing if stop is set
+type shown struct {
+	sel   lights.Selection
+	color [3]int
+	pulse time.Duration
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewIndicator creates an on-air indicator for the lights of a rig
+func NewIndicator(rig *lights.Rig, store storage.OnAirStore, clk clock.Clock) *Indicator {
+	return &Indicator{
+		rig:           rig,
+		store:         store,
+		clock:         clk,
+		frameInterval: time.Second / lights.DefaultFrameRate,
+		settings:      defaults(),
+	}
+}
+
+// OnChange registers a function called with the new state whenever the indicator is switched on or off
+func (i *Indicator) OnChange(fn func(active bool)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.onChange = append(i.onChange, fn)
+}
+
+// Start loads the saved settings and, if the indicator was on, shows it again
+func (i *Indicator) Start() error {
+	saved, err := i.store.LoadOnAir()
+	if err != nil {
+		return fmt.Errorf("failed to load on-air settings: %w", err)
+	}
+	if saved == nil {
+		return nil
+	}
+
+	i.switching.Lock()
+	defer i.switching.Unlock()
+
+	settings := withDefaults(*saved)
+	if err := validate(settings); err != nil {
+		log.Printf("OnAir: Ignoring saved settings: %v", err)
+		return nil
+	}
+
+	i.mu.Lock()
+	i.settings = settings
+	i.mu.Unlock()
+
+	if settings.Active {
+		log.Println("OnAir: Resuming on-air indicator")
+		return i.show(settings)
+	}
+	return nil
+}
+
+// Stop hides the indicator without saving it as off, so it shows again after a restart
+func (i *Indicator) Stop() {
+	i.switching.Lock()
+	defer i.switching.Unlock()
+	i.hide()
+}
+
+// Active reports whether the indicator is on
+func (i *Indicator) Active() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.settings.Active
+}
+
+// Settings returns the current settings
+func (i *Indicator) Settings() storage.OnAirSettings {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	settings := i.settings
+	settings.Lights = slices.Clone(settings.Lights)
+	return settings
+}
+
+// Set switches the indicator on or off
+func (i *Indicator) Set(active bool) error {
+	settings := i.Settings()
+	if settings.Active == active {
+		return nil
+	}
+	settings.Active = active
+	return i.Configure(settings)
+}
+
+// Toggle switches the indicator over, returning whether it is now on
+func (i *Indicator) Toggle() (bool, error) {
+	active := !i.Active()
+	return active, i.Set(active)
+}
+
+// Configure saves new settings and shows them straight away if the indicator is on
+// Missing lights and colour take their defaults.
+func (i *Indicator) Configure(settings storage.OnAirSettings) error {
+	settings = withDefaults(settings)
+	if err := validate(settings); err != nil {
+		return err
+	}
+
+	i.switching.Lock()
+	defer i.switching.Unlock()
+
+	if err := i.store.SaveOnAir(settings); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	changed := i.settings.Active != settings.Active
+	i.settings = settings
+	callbacks := slices.Clone(i.onChange)
+	i.mu.Unlock()
+
+	// Hide first so lights dropped from the settings show as they are underneath
+	i.hide()
+	if settings.Active {
+		if err := i.show(settings); err != nil {
+			return err
+		}
+	}
+
+	if changed {
+		if settings.Active {
+			log.Printf("OnAir: On air (%s)", strings.Join(settings.Lights, ", "))
+		} else {
+			log.Println("OnAir: Off air")
+		}
+		for _, fn := range callbacks {
+			fn(settings.Active)
+		}
+	}
+	return nil
+}
+
+// show overrides the indicator's lights with the status colour, pulsing it if configured
+func (i *Indicator) show(settings storage.OnAirSettings) error {
+	sel, err := lights.ParseSelection(settings.Lights)
+	if err != nil {
+		return err
+	}
+	color, err := lights.ParseColor(settings.Color)
+	if err != nil {
+		return err
+	}
+
+	// Kept even if publishing fails, so hide clears the overrides that were set
+	s := &shown{sel: sel, color: color, pulse: time.Duration(settings.Pulse) * time.Millisecond}
+	i.mu.Lock()
+	i.shown = s
+	i.mu.Unlock()
+
+	err = i.rig.ShowColor(lights.LayerOnAir, s.sel, s.color, 1)
+	if s.pulse > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go i.run(s)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to show on-air indicator: %w", err)
+	}
+	return nil
+}
+
+// hide stops any pulse and shows the indicator's lights as they are underneath
+func (i *Indicator) hide() {
+	i.mu.Lock()
+	s := i.shown
+	i.shown = nil
+	i.mu.Unlock()
+
+	if s == nil {
+		return
+	}
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+
+	if err := i.rig.ClearOverride(lights.LayerOnAir, s.sel); err != nil {
+		log.Printf("OnAir: Failed to restore the lights: %v", err)
+	}
+}
+
+// run pulses the status colour until stopped
+func (i *Indicator) run(s *shown) {
+	defer close(s.done)
+
+	started := i.clock.Now()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-i.clock.After(i.frameInterval):
+		}
+
+		if err := i.rig.ShowColor(lights.LayerOnAir, s.sel, s.color, pulseLevel(i.clock.Now().Sub(started), s.pulse)); err != nil {
+			log.Printf("OnAir: Pulse frame failed: %v", err)
+		}
+	}
+}
+
+// pulseLevel is the brightness of a pulse t into it, from 1 down to pulseFloor and back
+func pulseLevel(t, period time.Duration) float64 {
+	phase := 2 * math.Pi * float64(t%period) / float64(period)
+	return pulseFloor + (1-pulseFloor)*(1+math.Cos(phase))/2
+}
+
+// defaults returns the settings used before any are saved
+func defaults() storage.OnAirSettings {
+	return storage.OnAirSettings{Lights: slices.Clone(DefaultLights), Color: DefaultColor}
+}
+
+// withDefaults fills in missing lights and colour
+func withDefaults(settings storage.OnAirSettings) storage.OnAirSettings {
+	if len(settings.Lights) == 0 {
+		settings.Lights = slices.Clone(DefaultLights)
+	}
+	if settings.Color == "" {
+		settings.Color = DefaultColor
+	}
+	return settings
+}
+
+// validate checks the lights, colour and pulse of settings
+func validate(settings storage.OnAirSettings) error {
+	if _, err := lights.ParseSelection(settings.Lights); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if _, err := lights.ParseColor(settings.Color); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if settings.Pulse < 0 || (settings.Pulse > 0 && time.Duration(settings.Pulse)*time.Millisecond < MinPulse) {
+		return fmt.Errorf("%w: pulse must be 0 or at least %d milliseconds, got %d", ErrInvalidSettings, MinPulse/time.Millisecond, settings.Pulse)
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package onair
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// newTestIndicator creates an indicator on a fake clock with mock lights, the LED strip
+// showing 200,100,50 and the first video light on at 40
+func newTestIndicator(t *testing.T) (*Indicator, *lights.Rig, *mqtt.MockPublisher, *clock.Fake, *storage.Database) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, mock, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, mock, "test/vl2")
+	strip.SetColor(200, 100, 50)
+	vl1.TurnOn(40)
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	fake := clock.NewFake(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	rig := lights.NewRig(strip, bar, vl1, vl2)
+	indicator := NewIndicator(rig, db, fake)
+	t.Cleanup(indicator.Stop)
+	mock.Clear()
+	return indicator, rig, mock, fake, db
+}
+
+// lastPayload returns the last payload published to a topic
+func lastPayload(t *testing.T, mock *mqtt.MockPublisher, topic string) string {
+	t.Helper()
+	messages := mock.GetMessages()
+	for n := len(messages) - 1; n >= 0; n-- {
+		if messages[n].Topic == topic {
+			switch p := messages[n].Payload.(type) {
+			case string:
+				return p
+			case []byte:
+				return string(p)
+			}
+		}
+	}
+	t.Fatalf("Nothing published to %s", topic)
+	return ""
+}
+
+func TestOnAndOff(t *testing.T) {
+	indicator, rig, mock, _, _ := newTestIndicator(t)
+
+	if err := indicator.Set(true); err != nil {
+		t.Fatalf("Set(true) failed: %v", err)
+	}
+	if !indicator.Active() {
+		t.Error("Expected the indicator to be on")
+	}
+	if got := lastPayload(t, mock, "test/strip"); !strings.Contains(got, `"r":255,"g":0,"b":0`) {
+		t.Errorf("Expected the strip to show red, got %s", got)
+	}
+
+	// Changes underneath are kept but don't reach the strip
+	mock.Clear()
+	if err := rig.Strip.SetColor(0, 0, 255); err != nil {
+		t.Fatalf("SetColor failed: %v", err)
+	}
+	if got := lastPayload(t, mock, "test/strip"); !strings.Contains(got, `"r":255,"g":0,"b":0`) {
+		t.Errorf("Expected the strip to stay red, got %s", got)
+	}
+
+	if err := indicator.Set(false); err != nil {
+		t.Fatalf("Set(false) failed: %v", err)
+	}
+	if indicator.Active() {
+		t.Error("Expected the indicator to be off")
+	}
+	if got := lastPayload(t, mock, "test/strip"); !strings.Contains(got, `"r":0,"g":0,"b":255`) {
+		t.Errorf("Expected the strip to show its own colour again, got %s", got)
+	}
+	if rig.Strip.Overridden() {
+		t.Error("Expected the strip override to be cleared")
+	}
+}
+
+func TestBarAndVideoLights(t *testing.T) {
+	indicator, rig, mock, _, _ := newTestIndicator(t)
+
+	settings := storage.OnAirSettings{
+		Active: true,
+		Lights: []string{"ledBar.section1", "videoLight1"},
+		Color:  "#ff8000",
+	}
+	if err := indicator.Configure(settings); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	values := strings.Split(lastPayload(t, mock, "test/bar"), ",")
+	if got := strings.Join(values[0:4], ","); got != "255,128,0,0" {
+		t.Errorf("Expected the first RGBW LED to show 255,128,0,0, got %s", got)
+	}
+	if values[24] != "255" {
+		t.Errorf("Expected the first white LED to show 255, got %s", values[24])
+	}
+	if values[40] != "0" {
+		t.Errorf("Expected section 2 to stay off, got %s", values[40])
+	}
+	if got := lastPayload(t, mock, "test/vl1"); got != "set,true,100" {
+		t.Errorf("Expected video light 1 on at 100, got %s", got)
+	}
+	if rig.Strip.Overridden() {
+		t.Error("Expected the strip to be left alone")
+	}
+
+	if err := indicator.Set(false); err != nil {
+		t.Fatalf("Set(false) failed: %v", err)
+	}
+	if got := lastPayload(t, mock, "test/vl1"); got != "set,true,40" {
+		t.Errorf("Expected video light 1 back at 40, got %s", got)
+	}
+	if rig.Bar.Overridden() || rig.VideoLight1.Overridden() {
+		t.Error("Expected the overrides to be cleared")
+	}
+}
+
+func TestChangingLightsReleasesDroppedOnes(t *testing.T) {
+	indicator, rig, _, _, _ := newTestIndicator(t)
+
+	if err := indicator.Set(true); err != nil {
+		t.Fatalf("Set(true) failed: %v", err)
+	}
+	settings := indicator.Settings()
+	settings.Lights = []string{"videoLight2"}
+	if err := indicator.Configure(settings); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	if rig.Strip.Overridden() {
+		t.Error("Expected the strip to be released")
+	}
+	if !rig.VideoLight2.Overridden() {
+		t.Error("Expected video light 2 to be taken over")
+	}
+}
+
+func TestPulse(t *testing.T) {
+	indicator, _, mock, fake, _ := newTestIndicator(t)
+
+	settings := storage.OnAirSettings{Active: true, Color: "#ff0000", Pulse: 1000}
+	if err := indicator.Configure(settings); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	// Half way through the period the pulse is at its dimmest
+	for elapsed := time.Duration(0); elapsed < 500*time.Millisecond; elapsed += indicator.frameInterval {
+		fake.BlockUntil(1)
+		fake.Advance(indicator.frameInterval)
+	}
+	fake.BlockUntil(1)
+
+	want := `"r":51,"g":0,"b":0`
+	if got := lastPayload(t, mock, "test/strip"); !strings.Contains(got, want) {
+		t.Errorf("Expected the dimmest pulse frame %s, got %s", want, got)
+	}
+
+	if err := indicator.Set(false); err != nil {
+		t.Fatalf("Set(false) failed: %v", err)
+	}
+	if got := lastPayload(t, mock, "test/strip"); !strings.Contains(got, `"r":200,"g":100,"b":50`) {
+		t.Errorf("Expected the strip's own colour after the pulse, got %s", got)
+	}
+}
+
+// TestPulseWithEffect runs a pulse and an effect on the strip at the same time
+// on the real clock; run it with -race
+func TestPulseWithEffect(t *testing.T) {
+	_, rig, mock, _, db := newTestIndicator(t)
+
+	indicator := NewIndicator(rig, db, clock.Real{})
+	engine := effects.NewEngine(rig, clock.Real{})
+
+	if err := engine.Start("rainbow", effects.DeviceLEDStrip, effects.Params{"period": 1}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	settings := storage.OnAirSettings{Active: true, Color: "#ff0000", Pulse: 200}
+	if err := indicator.Configure(settings); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		rig.Strip.GetColor()
+		rig.Strip.Overridden()
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	indicator.Stop()
+	engine.StopAll()
+
+	if r, g, b := rig.Strip.GetColor(); r != 200 || g != 100 || b != 50 {
+		t.Errorf("Expected the strip restored to 200,100,50, got %d,%d,%d", r, g, b)
+	}
+	if got := lastPayload(t, mock, "test/strip"); !strings.Contains(got, `"r":200,"g":100,"b":50`) {
+		t.Errorf("Expected the strip's own colour published last, got %s", got)
+	}
+}
+
+func TestPulseLevel(t *testing.T) {
+	tests := []struct {
+		t    time.Duration
+		want float64
+	}{
+		{0, 1},
+		{500 * time.Millisecond, pulseFloor},
+		{time.Second, 1},
+		{1250 * time.Millisecond, (1 + pulseFloor) / 2},
+	}
+
+	for _, tt := range tests {
+		if got := pulseLevel(tt.t, time.Second); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("pulseLevel(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestStartResumesAndStopKeepsState(t *testing.T) {
+	indicator, rig, _, fake, db := newTestIndicator(t)
+
+	if err := indicator.Set(true); err != nil {
+		t.Fatalf("Set(true) failed: %v", err)
+	}
+	indicator.Stop()
+	if rig.Strip.Overridden() {
+		t.Error("Expected Stop to release the strip")
+	}
+
+	saved, err := db.LoadOnAir()
+	if err != nil {
+		t.Fatalf("LoadOnAir failed: %v", err)
+	}
+	if saved == nil || !saved.Active {
+		t.Fatalf("Expected the indicator to be saved as on, got %+v", saved)
+	}
+
+	restarted := NewIndicator(rig, db, fake)
+	t.Cleanup(restarted.Stop)
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if !restarted.Active() || !rig.Strip.Overridden() {
+		t.Error("Expected the indicator to be shown again after a restart")
+	}
+}
+
+func TestStartWithNothingSaved(t *testing.T) {
+	indicator, rig, _, _, _ := newTestIndicator(t)
+
+	if err := indicator.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if indicator.Active() || rig.Strip.Overridden() {
+		t.Error("Expected the indicator to start off")
+	}
+	settings := indicator.Settings()
+	if settings.Color != DefaultColor || len(settings.Lights) != 1 || settings.Lights[0] != "ledStrip" {
+		t.Errorf("Expected default settings, got %+v", settings)
+	}
+}
+
+func TestConfigureValidation(t *testing.T) {
+	indicator, _, _, _, db := newTestIndicator(t)
+
+	tests := []struct {
+		name     string
+		settings storage.OnAirSettings
+	}{
+		{"unknown light", storage.OnAirSettings{Lights: []string{"desk"}}},
+		{"bad colour", storage.OnAirSettings{Color: "red"}},
+		{"negative pulse", storage.OnAirSettings{Pulse: -1}},
+		{"short pulse", storage.OnAirSettings{Pulse: 50}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := indicator.Configure(tt.settings); !errors.Is(err, ErrInvalidSettings) {
+				t.Errorf("Expected ErrInvalidSettings, got %v", err)
+			}
+		})
+	}
+
+	if saved, _ := db.LoadOnAir(); saved != nil {
+		t.Errorf("Expected nothing saved, got %+v", saved)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	indicator, _, _, _, _ := newTestIndicator(t)
+
+	var changes []bool
+	indicator.OnChange(func(active bool) { changes = append(changes, active) })
+
+	indicator.Set(true)
+	indicator.Set(true)
+	settings := indicator.Settings()
+	settings.Color = "#00ff00"
+	indicator.Configure(settings)
+	if active, _ := indicator.Toggle(); active {
+		t.Error("Expected Toggle to switch the indicator off")
+	}
+
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("Expected changes [true false], got %v", changes)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	indicator, _, _, _, _ := newTestIndicator(t)
+	handler := NewCommandHandler(indicator)
+
+	steps := []struct {
+		payload string
+		want    bool
+	}{
+		{"on", true},
+		{" OFF\n", false},
+		{"toggle", true},
+		{`{"toggle": true}`, false},
+		{`{"active": true, "color": "#0000ff", "pulse": 1500}`, true},
+	}
+	for _, step := range steps {
+		if err := handler.Handle([]byte(step.payload)); err != nil {
+			t.Fatalf("Handle(%q) failed: %v", step.payload, err)
+		}
+		if indicator.Active() != step.want {
+			t.Errorf("After %q expected active %v", step.payload, step.want)
+		}
+	}
+
+	settings := indicator.Settings()
+	if settings.Color != "#0000ff" || settings.Pulse != 1500 {
+		t.Errorf("Expected the JSON settings to be applied, got %+v", settings)
+	}
+
+	for _, payload := range []string{"maybe", `{}`, `{"active": true, "toggle": true}`, `{"color": "blue"}`} {
+		if err := handler.Handle([]byte(payload)); err == nil {
+			t.Errorf("Expected an error for %q", payload)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	officemqtt "github.com/kevin/office_lights/mqtt"
+)
+
+// runOnAirCommand handles "office_lights onair on|off|toggle" by publishing the
+// command for a running instance to pick up
+func runOnAirCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: office_lights onair <on|off|toggle>")
+	}
+
+	command := strings.ToLower(args[0])
+	switch command {
+	case "on", "off", "toggle":
+	default:
+		return fmt.Errorf("unknown onair command %q (use on, off or toggle)", args[0])
+	}
+
+	// A client ID of its own, so the running instance isn't disconnected
+	config := mqttConfig()
+	config.ClientID += "_cli"
+
+	client, err := officemqtt.NewClient(config)
+	if err != nil {
+		return fmt.Errorf("failed to create MQTT client: %w", err)
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	defer client.Disconnect()
+
+	if err := client.Publish(officemqtt.TopicOnAir, command); err != nil {
+		return fmt.Errorf("failed to publish on-air command: %w", err)
+	}
+
+	fmt.Printf("Sent %s to %s\n", command, officemqtt.TopicOnAir)
+	return nil
+}
@@ -0,0 +1,403 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/actions"
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/lights"
+	officemqtt "github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/schedule"
+	"github.com/kevin/office_lights/storage"
+)
+
+// StatePollInterval is how often the lights are checked for state triggers
+// The drivers don't report changes, and effects and transitions change the lights
+// many times a second, so checking at this rate is enough to catch every state that lasts.
+const StatePollInterval = 250 * time.Millisecond
+
+// maxSleep caps how long the engine waits between checks, so time triggers notice
+// the wall clock jumping within this time
+const maxSleep = time.Hour
+
+// Runner carries out the actions of a rule
+type Runner interface {
+	Run(a actions.Action) error
+}
+
+// Subscriber delivers MQTT messages for the topic filters of mqtt triggers
+type Subscriber interface {
+	Subscribe(topic string, handler officemqtt.MessageHandler) error
+	Unsubscribe(topic string) error
+}
+
+// Engine fires the stored rules
+//
+// State triggers are edge-triggered: a rule fires when its light states become
+// true together, not while they stay true, and states already true when the rules
+// are loaded don't fire. A rule with a cooldown doesn't fire again until the
+// cooldown has passed since it last fired.
+type Engine struct {
+	store      storage.RuleStore
+	runner     Runner
+	rig        *lights.Rig
+	clock      clock.Clock
+	loc        *time.Location
+	site       *schedule.Site
+	subscriber Subscriber
+
+	mu      sync.Mutex
+	entries []*entry
+	reload  chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+
+	subMu  sync.Mutex
+	topics map[string]bool // topic filters subscribed to
+}
+
+// entry is a loaded, enabled rule
+type entry struct {
+	*compiled
+	next      time.Time // time triggers: when the trigger fires next
+	matched   bool      // state triggers: whether the states held at the last check
+	lastFired time.Time
+}
+
+// NewEngine creates a rule engine evaluating wall-clock times in loc
+func NewEngine(store storage.RuleStore, runner Runner, rig *lights.Rig, clk clock.Clock, loc *time.Location) *Engine {
+	return &Engine{
+		store:  store,
+		runner: runner,
+		rig:    rig,
+		clock:  clk,
+		loc:    loc,
+		reload: make(chan struct{}, 1),
+		topics: make(map[string]bool),
+	}
+}
+
+// SetSite sets where sun events are computed for; without one, rules with sun triggers are skipped
+func (e *Engine) SetSite(site schedule.Site) error {
+	if err := site.Validate(); err != nil {
+		return err
+	}
+	e.site = &site
+	return nil
+}
+
+// SetSubscriber sets where the topic filters of mqtt triggers are subscribed
+// Without one, only messages passed to HandleMessage fire mqtt triggers.
+func (e *Engine) SetSubscriber(sub Subscriber) {
+	e.subscriber = sub
+}
+
+// Validate checks that a rule's trigger, conditions and actions are usable by this engine
+func (e *Engine) Validate(rule storage.Rule) error {
+	return Validate(rule, e.loc, e.site)
+}
+
+// Start loads the rules and starts watching the time and the lights
+func (e *Engine) Start() error {
+	if err := e.load(); err != nil {
+		return err
+	}
+
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.loop()
+	return nil
+}
+
+// Stop stops watching the time and the lights
+func (e *Engine) Stop() {
+	if e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+}
+
+// Reload re-reads the rules after they have been changed
+func (e *Engine) Reload() error {
+	if err := e.load(); err != nil {
+		return err
+	}
+	select {
+	case e.reload <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// NextFire returns when a rule with a time trigger fires next
+// It returns false if the rule is disabled, unknown or not triggered by time.
+func (e *Engine) NextFire(ruleID int) (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, en := range e.entries {
+		if en.rule.ID == ruleID && !en.next.IsZero() {
+			return en.next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// HandleMessage fires the rules with an mqtt trigger matching a message
+func (e *Engine) HandleMessage(topic string, payload []byte) {
+	e.fireMatching(func(en *entry) bool {
+		return en.trigger.Type == TriggerMQTT && MatchTopic(en.trigger.Topic, topic) && en.trigger.matchesPayload(payload)
+	})
+}
+
+// Webhook fires the rules with a webhook trigger for a hook
+// It returns how many enabled rules listen for the hook and how many of them fired.
+func (e *Engine) Webhook(hook string, payload []byte) (listening, fired int) {
+	e.mu.Lock()
+	for _, en := range e.entries {
+		if en.trigger.Type == TriggerWebhook && en.trigger.Hook == hook {
+			listening++
+		}
+	}
+	e.mu.Unlock()
+
+	fired = e.fireMatching(func(en *entry) bool {
+		return en.trigger.Type == TriggerWebhook && en.trigger.Hook == hook && en.trigger.matchesPayload(payload)
+	})
+	return listening, fired
+}
+
+// RunNow runs a rule's actions straight away, whatever its trigger, conditions and cooldown
+func (e *Engine) RunNow(ruleID int) error {
+	rule, err := e.store.GetRule(ruleID)
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		return fmt.Errorf("%w: %d", storage.ErrRuleNotFound, ruleID)
+	}
+	c, err := compile(*rule, e.loc, e.site)
+	if err != nil {
+		return err
+	}
+	return e.run(c, e.clock.Now())
+}
+
+// load compiles the enabled rules, subscribes to their topics and notes which
+// state triggers already hold
+func (e *Engine) load() error {
+	list, err := e.store.ListRules()
+	if err != nil {
+		return fmt.Errorf("failed to load rules: %w", err)
+	}
+
+	now := e.clock.Now()
+	state := e.rig.Capture(lights.SelectAll())
+	entries := make([]*entry, 0, len(list))
+
+	for _, rule := range list {
+		if !rule.Enabled {
+			continue
+		}
+		c, err := compile(rule, e.loc, e.site)
+		if err != nil {
+			log.Printf("Rules: Skipping %q: %v", rule.Name, err)
+			continue
+		}
+
+		en := &entry{compiled: c}
+		if rule.LastFired != nil {
+			en.lastFired = *rule.LastFired
+		}
+		switch c.trigger.Type {
+		case TriggerTime:
+			en.next = c.trigger.schedule.Next(now)
+		case TriggerState:
+			en.matched = c.trigger.stateHolds(state)
+		}
+		entries = append(entries, en)
+	}
+
+	e.mu.Lock()
+	e.entries = entries
+	e.mu.Unlock()
+
+	e.subscribe(entries)
+	return nil
+}
+
+// subscribe subscribes to the topic filters of the mqtt triggers, dropping filters no longer used
+func (e *Engine) subscribe(entries []*entry) {
+	if e.subscriber == nil {
+		return
+	}
+
+	e.subMu.Lock()
+	defer e.subMu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, en := range entries {
+		if en.trigger.Type == TriggerMQTT {
+			wanted[en.trigger.Topic] = true
+		}
+	}
+
+	for filter := range e.topics {
+		if wanted[filter] {
+			continue
+		}
+		if err := e.subscriber.Unsubscribe(filter); err != nil {
+			log.Printf("Rules: Failed to unsubscribe from %s: %v", filter, err)
+		}
+	}
+	for filter := range wanted {
+		if e.topics[filter] {
+			continue
+		}
+		// The broker has matched the message to this filter already; a message
+		// matching several filters arrives once for each
+		err := e.subscriber.Subscribe(filter, func(topic string, payload []byte) {
+			e.fireMatching(func(en *entry) bool {
+				return en.trigger.Type == TriggerMQTT && en.trigger.Topic == filter && en.trigger.matchesPayload(payload)
+			})
+		})
+		if err != nil {
+			log.Printf("Rules: Failed to subscribe to %s: %v", filter, err)
+		}
+	}
+	e.topics = wanted
+}
+
+// loop sleeps until the next time trigger or state check is due
+func (e *Engine) loop() {
+	defer close(e.done)
+
+	for {
+		select {
+		case <-e.clock.After(e.untilNext()):
+			e.check()
+		case <-e.reload:
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// untilNext returns how long to sleep before the next check
+func (e *Engine) untilNext() time.Duration {
+	now := e.clock.Now()
+	wait := maxSleep
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, en := range e.entries {
+		switch {
+		case en.trigger.Type == TriggerState:
+			wait = min(wait, StatePollInterval)
+		case !en.next.IsZero():
+			wait = min(wait, en.next.Sub(now))
+		}
+	}
+	return wait
+}
+
+// check fires the time triggers that are due and the state triggers that have become true
+func (e *Engine) check() {
+	now := e.clock.Now()
+	state := e.rig.Capture(lights.SelectAll())
+
+	e.mu.Lock()
+	var due []*entry
+	for _, en := range e.entries {
+		switch en.trigger.Type {
+		case TriggerTime:
+			if en.next.IsZero() || en.next.After(now) {
+				continue
+			}
+			en.next = en.trigger.schedule.Next(now)
+			due = append(due, en)
+		case TriggerState:
+			matched := en.trigger.stateHolds(state)
+			if matched && !en.matched {
+				due = append(due, en)
+			}
+			en.matched = matched
+		}
+	}
+	e.mu.Unlock()
+
+	for _, en := range due {
+		e.fire(en, now, state)
+	}
+}
+
+// fireMatching fires the loaded rules picked by match, in name order, and returns how many ran
+func (e *Engine) fireMatching(match func(en *entry) bool) int {
+	e.mu.Lock()
+	var matched []*entry
+	for _, en := range e.entries {
+		if match(en) {
+			matched = append(matched, en)
+		}
+	}
+	e.mu.Unlock()
+	if len(matched) == 0 {
+		return 0
+	}
+
+	now := e.clock.Now()
+	state := e.rig.Capture(lights.SelectAll())
+	fired := 0
+	for _, en := range matched {
+		if e.fire(en, now, state) {
+			fired++
+		}
+	}
+	return fired
+}
+
+// fire runs a triggered rule's actions if its cooldown has passed and its conditions hold
+func (e *Engine) fire(en *entry, now time.Time, state *storage.SceneData) bool {
+	local := now.In(e.loc)
+	for i := range en.conditions {
+		if !en.conditions[i].holds(local, state) {
+			return false
+		}
+	}
+
+	e.mu.Lock()
+	cooldown := time.Duration(en.rule.Cooldown) * time.Millisecond
+	if !en.lastFired.IsZero() && now.Sub(en.lastFired) < cooldown {
+		e.mu.Unlock()
+		return false
+	}
+	en.lastFired = now
+	e.mu.Unlock()
+
+	e.run(en.compiled, now)
+	return true
+}
+
+// run carries out a rule's actions in order and records when it fired
+func (e *Engine) run(c *compiled, now time.Time) error {
+	log.Printf("Rules: Firing %q", c.rule.Name)
+
+	var errs []error
+	for _, a := range c.actions {
+		if err := e.runner.Run(a); err != nil {
+			log.Printf("Rules: %q failed to %s: %v", c.rule.Name, a, err)
+			errs = append(errs, err)
+		}
+	}
+
+	if err := e.store.SetRuleLastFired(c.rule.ID, now); err != nil {
+		log.Printf("Rules: Failed to record firing of %q: %v", c.rule.Name, err)
+	}
+	return errors.Join(errs...)
+}
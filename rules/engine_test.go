@@ -0,0 +1,333 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/actions"
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	officemqtt "github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// recorder is a Runner that records the actions it is asked to run
+type recorder struct {
+	ran chan actions.Action
+}
+
+func newRecorder() *recorder {
+	return &recorder{ran: make(chan actions.Action, 16)}
+}
+
+func (r *recorder) Run(a actions.Action) error {
+	r.ran <- a
+	return nil
+}
+
+// next waits for the next action to run
+func (r *recorder) next(t *testing.T) actions.Action {
+	t.Helper()
+	select {
+	case a := <-r.ran:
+		return a
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an action to run")
+		return actions.Action{}
+	}
+}
+
+// none checks that nothing has run
+func (r *recorder) none(t *testing.T) {
+	t.Helper()
+	select {
+	case a := <-r.ran:
+		t.Fatalf("Unexpected action: %s", a)
+	default:
+	}
+}
+
+// subscriber is a Subscriber that records the topic filters subscribed to
+type subscriber struct {
+	mu       sync.Mutex
+	handlers map[string]officemqtt.MessageHandler
+}
+
+func (s *subscriber) Subscribe(topic string, handler officemqtt.MessageHandler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[topic] = handler
+	return nil
+}
+
+func (s *subscriber) Unsubscribe(topic string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.handlers, topic)
+	return nil
+}
+
+func (s *subscriber) topics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := make([]string, 0, len(s.handlers))
+	for topic := range s.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (s *subscriber) deliver(filter, topic, payload string) {
+	s.mu.Lock()
+	handler := s.handlers[filter]
+	s.mu.Unlock()
+	handler(topic, []byte(payload))
+}
+
+// rig holds an engine with mock lights, a fake clock and a recording runner
+type rig struct {
+	db     *storage.Database
+	lights *lights.Rig
+	clock  *clock.Fake
+	runner *recorder
+	engine *Engine
+}
+
+// start is 17:00 on Monday 2 March 2026
+var start = time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC)
+
+func newRig(t *testing.T) *rig {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	mock := officemqtt.NewMockPublisher()
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, mock, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, mock, "test/vl2")
+
+	r := &rig{
+		db:     db,
+		lights: lights.NewRig(ledstrip.NewLEDStrip(mock, "test/strip"), bar, vl1, vl2),
+		clock:  clock.NewFake(start),
+		runner: newRecorder(),
+	}
+	r.engine = NewEngine(db, r.runner, r.lights, r.clock, time.UTC)
+	return r
+}
+
+// addRule stores an enabled rule recalling the named scene
+func (r *rig) addRule(t *testing.T, name, trigger, conditions, scene string, cooldown int) int {
+	t.Helper()
+	id, err := r.db.CreateRule(storage.Rule{
+		Name:       name,
+		Enabled:    true,
+		Trigger:    json.RawMessage(trigger),
+		Conditions: json.RawMessage(conditions),
+		Actions:    json.RawMessage(`[{"type":"scene","scene":"` + scene + `"}]`),
+		Cooldown:   cooldown,
+	})
+	if err != nil {
+		t.Fatalf("CreateRule failed: %v", err)
+	}
+	return id
+}
+
+func (r *rig) start(t *testing.T) {
+	t.Helper()
+	if err := r.engine.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(r.engine.Stop)
+}
+
+func TestMQTTRuleWithTimeCondition(t *testing.T) {
+	r := newRig(t)
+	id := r.addRule(t, "Door Evening", `{"type":"mqtt","topic":"door/office","payload":"open"}`,
+		`[{"type":"time","after":"18:00"}]`, "Evening", 0)
+	r.start(t)
+
+	// Before 18:00 the condition fails
+	r.engine.HandleMessage("door/office", []byte("open"))
+	r.runner.none(t)
+
+	r.clock.Set(start.Add(90 * time.Minute))
+	r.engine.HandleMessage("door/office", []byte("closed"))
+	r.engine.HandleMessage("door/kitchen", []byte("open"))
+	r.runner.none(t)
+
+	r.engine.HandleMessage("door/office", []byte("open"))
+	if a := r.runner.next(t); a.Type != actions.TypeScene || a.Scene != "Evening" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+
+	rule, _ := r.db.GetRule(id)
+	if rule.LastFired == nil || !rule.LastFired.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("LastFired = %v", rule.LastFired)
+	}
+}
+
+func TestStateRuleFiresOnEdge(t *testing.T) {
+	r := newRig(t)
+	r.addRule(t, "Recording", `{"type":"state","state":[{"light":"videoLight1","on":true},{"light":"videoLight2","on":true}]}`,
+		"", "Dim Strip", 0)
+	r.start(t)
+
+	vl1, vl2 := r.lights.VideoLight1, r.lights.VideoLight2
+	step := func() {
+		r.clock.BlockUntil(1)
+		r.clock.Advance(StatePollInterval)
+		r.clock.BlockUntil(1)
+	}
+
+	vl1.TurnOn(50)
+	step()
+	r.runner.none(t)
+
+	vl2.TurnOn(50)
+	step()
+	if a := r.runner.next(t); a.Scene != "Dim Strip" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+
+	// Staying on doesn't fire again
+	step()
+	r.runner.none(t)
+
+	// Switching one off and on again does
+	vl2.TurnOff()
+	step()
+	vl2.TurnOn(50)
+	step()
+	if a := r.runner.next(t); a.Scene != "Dim Strip" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+}
+
+func TestStateAlreadyTrueDoesNotFire(t *testing.T) {
+	r := newRig(t)
+	r.lights.Strip.SetColor(255, 0, 0)
+	r.addRule(t, "Strip On", `{"type":"state","state":[{"light":"ledStrip","on":true}]}`, "", "Red", 0)
+	r.start(t)
+
+	r.clock.BlockUntil(1)
+	r.clock.Advance(StatePollInterval)
+	r.clock.BlockUntil(1)
+	r.runner.none(t)
+}
+
+func TestTimeRule(t *testing.T) {
+	r := newRig(t)
+	id := r.addRule(t, "Lunch", `{"type":"time","times":["17:30"]}`, "", "Lunch", 0)
+	r.start(t)
+
+	next, ok := r.engine.NextFire(id)
+	if !ok || !next.Equal(start.Add(30*time.Minute)) {
+		t.Fatalf("NextFire() = %v, %v", next, ok)
+	}
+
+	r.clock.BlockUntil(1)
+	r.clock.Advance(30 * time.Minute)
+	if a := r.runner.next(t); a.Scene != "Lunch" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+}
+
+func TestWebhookAndCooldown(t *testing.T) {
+	r := newRig(t)
+	r.addRule(t, "Doorbell", `{"type":"webhook","hook":"doorbell"}`, `[{"light":"ledStrip","on":false}]`, "Flash", 60000)
+	r.start(t)
+
+	if listening, fired := r.engine.Webhook("doorbell", nil); listening != 1 || fired != 1 {
+		t.Fatalf("Webhook() = %d, %d; want 1, 1", listening, fired)
+	}
+	r.runner.next(t)
+
+	// Within the cooldown
+	r.clock.Set(start.Add(30 * time.Second))
+	if _, fired := r.engine.Webhook("doorbell", nil); fired != 0 {
+		t.Errorf("Expected the cooldown to hold the rule back, fired %d", fired)
+	}
+
+	// After the cooldown but with the strip on, the condition fails
+	r.clock.Set(start.Add(2 * time.Minute))
+	r.lights.Strip.SetColor(10, 10, 10)
+	if _, fired := r.engine.Webhook("doorbell", nil); fired != 0 {
+		t.Errorf("Expected the condition to hold the rule back, fired %d", fired)
+	}
+
+	r.lights.Strip.SetColor(0, 0, 0)
+	if _, fired := r.engine.Webhook("doorbell", nil); fired != 1 {
+		t.Errorf("Expected the rule to fire, fired %d", fired)
+	}
+	r.runner.next(t)
+
+	if listening, _ := r.engine.Webhook("unknown", nil); listening != 0 {
+		t.Errorf("Expected no rule to listen for an unknown hook, got %d", listening)
+	}
+	r.runner.none(t)
+}
+
+func TestSubscriptionsFollowRules(t *testing.T) {
+	r := newRig(t)
+	sub := &subscriber{handlers: make(map[string]officemqtt.MessageHandler)}
+	r.engine.SetSubscriber(sub)
+
+	door := r.addRule(t, "Door", `{"type":"mqtt","topic":"door/+","field":"contact","payload":"false"}`, "", "Welcome", 0)
+	r.addRule(t, "Motion", `{"type":"mqtt","topic":"motion/office"}`, "", "Bright", 0)
+	r.start(t)
+
+	if topics := sub.topics(); len(topics) != 2 || topics[0] != "door/+" || topics[1] != "motion/office" {
+		t.Fatalf("Subscribed to %v", topics)
+	}
+
+	sub.deliver("door/+", "door/office", `{"contact":false}`)
+	if a := r.runner.next(t); a.Scene != "Welcome" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+
+	if err := r.db.DeleteRule(door); err != nil {
+		t.Fatalf("DeleteRule failed: %v", err)
+	}
+	if err := r.engine.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if topics := sub.topics(); len(topics) != 1 || topics[0] != "motion/office" {
+		t.Errorf("After reload subscribed to %v", topics)
+	}
+}
+
+func TestRunNow(t *testing.T) {
+	r := newRig(t)
+	id := r.addRule(t, "Late", `{"type":"webhook","hook":"late"}`, `[{"after":"23:00"}]`, "Night", 0)
+
+	if err := r.engine.RunNow(id); err != nil {
+		t.Fatalf("RunNow failed: %v", err)
+	}
+	if a := r.runner.next(t); a.Scene != "Night" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+
+	if err := r.engine.RunNow(99); !errors.Is(err, storage.ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+}
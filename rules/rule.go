@@ -0,0 +1,412 @@
+// Package rules runs actions when events happen and conditions hold
+//
+// A rule has a trigger (an MQTT message, the lights reaching a state, a time or
+// a webhook call), optional conditions on the lights and the time, and a list
+// of actions as used by schedules:
+//
+//	{
+//	  "name": "Door Evening",
+//	  "trigger": {"type": "mqtt", "topic": "door/office", "payload": "open"},
+//	  "conditions": [{"type": "time", "after": "18:00"}],
+//	  "actions": [{"type": "scene", "scene": "Evening"}]
+//	}
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kevin/office_lights/actions"
+	"github.com/kevin/office_lights/lights"
+	officemqtt "github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/schedule"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Trigger types
+const (
+	TriggerMQTT    = "mqtt"    // a message arrives on a topic
+	TriggerState   = "state"   // the lights reach a state
+	TriggerTime    = "time"    // a time given like a schedule's
+	TriggerWebhook = "webhook" // a webhook is called
+)
+
+// TriggerTypes lists the trigger types in the order they are documented
+var TriggerTypes = []string{TriggerMQTT, TriggerState, TriggerTime, TriggerWebhook}
+
+// Condition types
+const (
+	ConditionState = "state" // a light is on, off, above or below a level
+	ConditionTime  = "time"  // the time of day and weekday are in a range
+)
+
+// Trigger is the event that makes a rule check its conditions and run
+//
+// Examples:
+//
+//	{"type": "mqtt", "topic": "door/+", "field": "contact", "payload": "false"}
+//	{"type": "state", "state": [{"light": "videoLight1", "on": true}, {"light": "videoLight2", "on": true}]}
+//	{"type": "time", "sun": "sunset", "offset": -15}
+//	{"type": "webhook", "hook": "doorbell"}
+type Trigger struct {
+	Type string `json:"type"`
+
+	// MQTT: the topic filter, which may use the + and # wildcards
+	Topic string `json:"topic,omitempty"`
+
+	// MQTT and webhook: a dot-separated path to a value in a JSON payload, and the
+	// value (or whole payload) that fires the rule, ignoring case; empty matches anything
+	Field   string `json:"field,omitempty"`
+	Payload string `json:"payload,omitempty"`
+
+	// State: fires when all of these become true together
+	State []Condition `json:"state,omitempty"`
+
+	// Time: as for schedules
+	Cron   string   `json:"cron,omitempty"`
+	Days   []string `json:"days,omitempty"`
+	Times  []string `json:"times,omitempty"`
+	Sun    string   `json:"sun,omitempty"`
+	Offset int      `json:"offset,omitempty"`
+
+	// Webhook: the name called at /api/hooks/{hook}
+	Hook string `json:"hook,omitempty"`
+
+	schedule schedule.Trigger
+}
+
+// Condition must hold for a rule to run when its trigger fires
+// The type may be left out: conditions naming a light are state conditions,
+// the others time conditions.
+//
+// Examples:
+//
+//	{"light": "ledStrip", "on": false}
+//	{"light": "videoLight1", "above": 50}
+//	{"type": "time", "after": "22:00", "before": "06:00", "days": ["weekdays"]}
+type Condition struct {
+	Type string `json:"type,omitempty"`
+
+	// State: a light name as accepted by lights.ParseSelection, and what its
+	// brightest channel must be (0-255, or 0-100 for video lights)
+	Light string `json:"light,omitempty"`
+	On    *bool  `json:"on,omitempty"`
+	Above *int   `json:"above,omitempty"`
+	Below *int   `json:"below,omitempty"`
+
+	// Time: local "HH:MM" bounds (after is inclusive, before exclusive; a range
+	// whose end is earlier than its start wraps past midnight) and weekday names
+	After  string   `json:"after,omitempty"`
+	Before string   `json:"before,omitempty"`
+	Days   []string `json:"days,omitempty"`
+
+	selection     lights.Selection
+	after, before int // minutes after midnight, or -1 if not set
+	days          [7]bool
+}
+
+// hookName matches the webhook names usable in a URL path
+var hookName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// compiled is a rule with its trigger, conditions and actions decoded and checked
+type compiled struct {
+	rule       storage.Rule
+	trigger    Trigger
+	conditions []Condition
+	actions    []actions.Action
+}
+
+// Validate checks that a rule's trigger, conditions and actions are usable
+// Sun triggers need a site.
+func Validate(rule storage.Rule, loc *time.Location, site *schedule.Site) error {
+	_, err := compile(rule, loc, site)
+	return err
+}
+
+// compile decodes and checks a stored rule
+func compile(rule storage.Rule, loc *time.Location, site *schedule.Site) (*compiled, error) {
+	c := &compiled{rule: rule}
+
+	if err := json.Unmarshal(rule.Trigger, &c.trigger); err != nil {
+		return nil, fmt.Errorf("invalid trigger: %w", err)
+	}
+	if err := c.trigger.compile(loc, site); err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(rule.Conditions)) > 0 && string(bytes.TrimSpace(rule.Conditions)) != "null" {
+		if err := json.Unmarshal(rule.Conditions, &c.conditions); err != nil {
+			return nil, fmt.Errorf("invalid conditions: %w", err)
+		}
+	}
+	for i := range c.conditions {
+		if err := c.conditions[i].compile(); err != nil {
+			return nil, fmt.Errorf("condition %d: %w", i+1, err)
+		}
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(rule.Actions, &raw); err != nil {
+		return nil, fmt.Errorf("invalid actions (want a list): %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("rule needs at least one action")
+	}
+	for i, data := range raw {
+		a, err := actions.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("action %d: %w", i+1, err)
+		}
+		c.actions = append(c.actions, a)
+	}
+	return c, nil
+}
+
+// compile checks a trigger has what its type needs
+func (t *Trigger) compile(loc *time.Location, site *schedule.Site) error {
+	if t.Field != "" && t.Type != TriggerMQTT && t.Type != TriggerWebhook {
+		return fmt.Errorf("only mqtt and webhook triggers match payload fields")
+	}
+
+	switch t.Type {
+	case TriggerMQTT:
+		if err := ValidateTopicFilter(t.Topic); err != nil {
+			return err
+		}
+		if slices.Contains(officemqtt.CommandTopics, t.Topic) {
+			return fmt.Errorf("topic %q is used for this application's own commands (use a wildcard filter to watch it)", t.Topic)
+		}
+	case TriggerState:
+		if len(t.State) == 0 {
+			return fmt.Errorf("state trigger needs at least one light state")
+		}
+		for i := range t.State {
+			if err := t.State[i].compile(); err != nil {
+				return fmt.Errorf("trigger state %d: %w", i+1, err)
+			}
+			if t.State[i].Type != ConditionState {
+				return fmt.Errorf("trigger state %d: only light states can trigger a rule", i+1)
+			}
+		}
+	case TriggerTime:
+		sched := storage.Schedule{Cron: t.Cron, Days: t.Days, Times: t.Times, Sun: t.Sun, Offset: t.Offset}
+		trigger, err := schedule.Compile(sched, loc, site)
+		if err != nil {
+			return err
+		}
+		t.schedule = trigger
+	case TriggerWebhook:
+		if !hookName.MatchString(t.Hook) {
+			return fmt.Errorf("webhook trigger needs a hook name of letters, digits, '.', '-' or '_'")
+		}
+	default:
+		return fmt.Errorf("unknown trigger type %q (want one of %v)", t.Type, TriggerTypes)
+	}
+	return nil
+}
+
+// matchesPayload reports whether a message or webhook body fires the trigger
+func (t *Trigger) matchesPayload(payload []byte) bool {
+	value := strings.TrimSpace(string(payload))
+	if t.Field != "" {
+		v, ok := jsonField(payload, t.Field)
+		if !ok {
+			return false
+		}
+		value = v
+	}
+	return t.Payload == "" || strings.EqualFold(value, strings.TrimSpace(t.Payload))
+}
+
+// stateHolds reports whether every light state of a state trigger holds
+func (t *Trigger) stateHolds(state *storage.SceneData) bool {
+	for i := range t.State {
+		if !t.State[i].lightHolds(state) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonField returns the value at a dot-separated path in a JSON document as a string
+func jsonField(payload []byte, path string) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number, bool:
+		return fmt.Sprint(v), true
+	case nil:
+		return "null", true
+	default:
+		return "", false
+	}
+}
+
+// ValidateTopicFilter checks an MQTT topic filter: + must fill a whole level and
+// # must be the whole last level
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("mqtt trigger needs a topic")
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("invalid topic %q: # must be the whole last level", filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("invalid topic %q: + must be a whole level", filter)
+		}
+	}
+	return nil
+}
+
+// MatchTopic reports whether a topic matches an MQTT topic filter
+func MatchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// compile checks a condition and works out its type if it was left out
+func (c *Condition) compile() error {
+	if c.Type == "" {
+		c.Type = ConditionTime
+		if c.Light != "" {
+			c.Type = ConditionState
+		}
+	}
+
+	switch c.Type {
+	case ConditionState:
+		if c.Light == "" {
+			return fmt.Errorf("state condition needs a light")
+		}
+		sel, err := lights.ParseSelection([]string{c.Light})
+		if err != nil {
+			return err
+		}
+		if c.On == nil && c.Above == nil && c.Below == nil {
+			return fmt.Errorf("state condition on %s needs on, above or below", c.Light)
+		}
+		c.selection = sel
+	case ConditionTime:
+		if c.After == "" && c.Before == "" && len(c.Days) == 0 {
+			return fmt.Errorf("time condition needs after, before or days")
+		}
+		c.after, c.before = -1, -1
+		var err error
+		if c.After != "" {
+			if c.after, err = schedule.ParseTimeOfDay(c.After); err != nil {
+				return err
+			}
+		}
+		if c.Before != "" {
+			if c.before, err = schedule.ParseTimeOfDay(c.Before); err != nil {
+				return err
+			}
+		}
+		if c.days, err = schedule.ParseDays(c.Days); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown condition type %q (want %s or %s)", c.Type, ConditionState, ConditionTime)
+	}
+	return nil
+}
+
+// holds reports whether the condition is true at a local time with the lights in a state
+func (c *Condition) holds(now time.Time, state *storage.SceneData) bool {
+	if c.Type == ConditionState {
+		return c.lightHolds(state)
+	}
+	return c.timeHolds(now)
+}
+
+// lightHolds reports whether a state condition is true
+func (c *Condition) lightHolds(state *storage.SceneData) bool {
+	level := level(c.selection, state)
+	if c.On != nil && (level > 0) != *c.On {
+		return false
+	}
+	if c.Above != nil && level <= *c.Above {
+		return false
+	}
+	if c.Below != nil && level >= *c.Below {
+		return false
+	}
+	return true
+}
+
+// timeHolds reports whether a time condition is true at a local time
+func (c *Condition) timeHolds(now time.Time) bool {
+	if !c.days[now.Weekday()] {
+		return false
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	switch {
+	case c.after >= 0 && c.before >= 0:
+		if c.after <= c.before {
+			return minute >= c.after && minute < c.before
+		}
+		return minute >= c.after || minute < c.before
+	case c.after >= 0:
+		return minute >= c.after
+	case c.before >= 0:
+		return minute < c.before
+	}
+	return true
+}
+
+// level returns the brightest selected channel; video lights that are off count as 0
+func level(sel lights.Selection, state *storage.SceneData) int {
+	level := 0
+	if sel.LEDStrip && state.LEDStrip != nil {
+		level = max(state.LEDStrip.Red, state.LEDStrip.Green, state.LEDStrip.Blue)
+	}
+	for _, led := range state.LEDBarLEDs {
+		if slices.Contains(sel.LEDBarChannels, led.ChannelNum) {
+			level = max(level, led.Value)
+		}
+	}
+	for _, vl := range state.VideoLights {
+		if vl.On && slices.Contains(sel.VideoLights, vl.ID) {
+			level = max(level, vl.Brightness)
+		}
+	}
+	return level
+}
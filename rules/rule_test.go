@@ -0,0 +1,185 @@
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/schedule"
+	"github.com/kevin/office_lights/storage"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"door/office", "door/office", true},
+		{"door/office", "door/kitchen", false},
+		{"door/+", "door/office", true},
+		{"door/+", "door/office/state", false},
+		{"+/office", "door/office", true},
+		{"door/#", "door/office/state", true},
+		{"door/#", "door", true},
+		{"#", "anything/at/all", true},
+		{"door/office/state", "door/office", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchTopic(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	site := &schedule.Site{Latitude: 51.5, Longitude: -0.1}
+	scene := `[{"type":"scene","scene":"Evening"}]`
+
+	tests := []struct {
+		name       string
+		trigger    string
+		conditions string
+		actions    string
+		site       *schedule.Site
+		wantErr    bool
+	}{
+		{"mqtt", `{"type":"mqtt","topic":"door/office","payload":"open"}`, `[{"type":"time","after":"18:00"}]`, scene, nil, false},
+		{"mqtt wildcard", `{"type":"mqtt","topic":"sensors/+/motion","field":"occupancy","payload":"true"}`, "", scene, nil, false},
+		{"mqtt no topic", `{"type":"mqtt"}`, "", scene, nil, true},
+		{"mqtt bad wildcard", `{"type":"mqtt","topic":"door/#/state"}`, "", scene, nil, true},
+		{"mqtt own command topic", `{"type":"mqtt","topic":"kevinoffice/office_lights/command"}`, "", scene, nil, true},
+		{"state", `{"type":"state","state":[{"light":"videoLight1","on":true},{"light":"videoLight2","on":true}]}`, "", scene, nil, false},
+		{"state empty", `{"type":"state"}`, "", scene, nil, true},
+		{"state unknown light", `{"type":"state","state":[{"light":"lamp","on":true}]}`, "", scene, nil, true},
+		{"state without test", `{"type":"state","state":[{"light":"ledStrip"}]}`, "", scene, nil, true},
+		{"state with time", `{"type":"state","state":[{"after":"10:00"}]}`, "", scene, nil, true},
+		{"time", `{"type":"time","days":["weekdays"],"times":["09:00"]}`, "", scene, nil, false},
+		{"time bad cron", `{"type":"time","cron":"61 * * * *"}`, "", scene, nil, true},
+		{"sun without site", `{"type":"time","sun":"sunset"}`, "", scene, nil, true},
+		{"sun with site", `{"type":"time","sun":"sunset","offset":-15}`, "", scene, site, false},
+		{"webhook", `{"type":"webhook","hook":"doorbell"}`, "", scene, nil, false},
+		{"webhook bad name", `{"type":"webhook","hook":"door bell"}`, "", scene, nil, true},
+		{"field on time", `{"type":"time","times":["09:00"],"field":"x"}`, "", scene, nil, true},
+		{"unknown trigger", `{"type":"button"}`, "", scene, nil, true},
+		{"bad condition time", `{"type":"webhook","hook":"a"}`, `[{"after":"25:00"}]`, scene, nil, true},
+		{"empty condition", `{"type":"webhook","hook":"a"}`, `[{}]`, scene, nil, true},
+		{"unknown condition", `{"type":"webhook","hook":"a"}`, `[{"type":"weather"}]`, scene, nil, true},
+		{"no actions", `{"type":"webhook","hook":"a"}`, "", `[]`, nil, true},
+		{"single action", `{"type":"webhook","hook":"a"}`, "", `{"type":"off"}`, nil, true},
+		{"bad action", `{"type":"webhook","hook":"a"}`, "", `[{"type":"dance"}]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := storage.Rule{
+				Name:       tt.name,
+				Trigger:    json.RawMessage(tt.trigger),
+				Conditions: json.RawMessage(tt.conditions),
+				Actions:    json.RawMessage(tt.actions),
+			}
+			err := Validate(rule, time.UTC, tt.site)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTimeCondition(t *testing.T) {
+	// Monday 2 March 2026
+	at := func(hour, minute int) time.Time { return time.Date(2026, 3, 2, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		cond Condition
+		at   time.Time
+		want bool
+	}{
+		{"after", Condition{After: "18:00"}, at(18, 0), true},
+		{"before after", Condition{After: "18:00"}, at(17, 59), false},
+		{"before", Condition{Before: "08:00"}, at(7, 59), true},
+		{"range", Condition{After: "09:00", Before: "17:00"}, at(12, 0), true},
+		{"range end", Condition{After: "09:00", Before: "17:00"}, at(17, 0), false},
+		{"wrapping late", Condition{After: "22:00", Before: "06:00"}, at(23, 30), true},
+		{"wrapping early", Condition{After: "22:00", Before: "06:00"}, at(5, 0), true},
+		{"wrapping day", Condition{After: "22:00", Before: "06:00"}, at(12, 0), false},
+		{"weekday", Condition{Days: []string{"weekdays"}}, at(12, 0), true},
+		{"weekend", Condition{Days: []string{"weekends"}, After: "10:00"}, at(12, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cond.compile(); err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			if got := tt.cond.holds(tt.at, &storage.SceneData{}); got != tt.want {
+				t.Errorf("holds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateCondition(t *testing.T) {
+	on, off := true, false
+	ten, fifty := 10, 50
+	state := &storage.SceneData{
+		LEDStrip:   &storage.LEDStripState{Red: 40, Green: 20, Blue: 0},
+		LEDBarLEDs: []storage.LEDBarLEDState{{ChannelNum: 0, Value: 0}, {ChannelNum: 1, Value: 0}},
+		VideoLights: []storage.VideoLightState{
+			{ID: 0, On: true, Brightness: 60},
+			{ID: 1, On: false, Brightness: 80},
+		},
+	}
+
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"strip on", Condition{Light: "ledStrip", On: &on}, true},
+		{"strip above", Condition{Light: "ledStrip", Above: &fifty}, false},
+		{"strip between", Condition{Light: "ledStrip", Above: &ten, Below: &fifty}, true},
+		{"bar off", Condition{Light: "ledBar", On: &off}, true},
+		{"video light on", Condition{Light: "videoLight1", Above: &fifty}, true},
+		{"video light switched off", Condition{Light: "videoLight2", On: &on}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cond.compile(); err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			if got := tt.cond.holds(time.Time{}, state); got != tt.want {
+				t.Errorf("holds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger Trigger
+		payload string
+		want    bool
+	}{
+		{"any", Trigger{}, "whatever", true},
+		{"exact", Trigger{Payload: "open"}, " OPEN\n", true},
+		{"different", Trigger{Payload: "open"}, "closed", false},
+		{"field", Trigger{Field: "state", Payload: "open"}, `{"state":"open"}`, true},
+		{"nested field", Trigger{Field: "door.contact", Payload: "false"}, `{"door":{"contact":false}}`, true},
+		{"number field", Trigger{Field: "lux", Payload: "12"}, `{"lux":12}`, true},
+		{"missing field", Trigger{Field: "state", Payload: "open"}, `{"contact":false}`, false},
+		{"field of any value", Trigger{Field: "state"}, `{"state":"closed"}`, true},
+		{"not JSON", Trigger{Field: "state"}, "open", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.trigger.matchesPayload([]byte(tt.payload)); got != tt.want {
+				t.Errorf("matchesPayload(%q) = %v, want %v", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// runScenesCommand handles "office_lights scenes export|import ..." without connecting to MQTT
+func runScenesCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: office_lights scenes <export|import> [options]")
+	}
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "lights.sqlite3"
+	}
+
+	db, err := storage.NewDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.InitSchema(); err != nil {
+		return fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	switch args[0] {
+	case "export":
+		return exportScenes(db, args[1:])
+	case "import":
+		return importScenes(db, args[1:])
+	default:
+		return fmt.Errorf("unknown scenes command %q (use export or import)", args[0])
+	}
+}
+
+// exportScenes writes the named scenes (or all scenes) as JSON
+// Usage: office_lights scenes export [-o file] [name-or-id ...]
+func exportScenes(db *storage.Database, args []string) error {
+	fs := flag.NewFlagSet("scenes export", flag.ContinueOnError)
+	output := fs.String("o", "-", "output file (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var ids []int
+	for _, ref := range fs.Args() {
+		id, err := resolveSceneRef(db, ref)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	doc, err := storage.ExportScenes(db, ids...)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// importScenes reads a scene document and adds its scenes to the library
+// Usage: office_lights scenes import [-conflict skip|replace|rename|fail] file
+func importScenes(db *storage.Database, args []string) error {
+	fs := flag.NewFlagSet("scenes import", flag.ContinueOnError)
+	conflict := fs.String("conflict", "skip", "what to do when a scene name already exists: skip, replace, rename or fail")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: office_lights scenes import [-conflict policy] <file|->")
+	}
+
+	policy, err := storage.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read scene document: %w", err)
+	}
+
+	doc, err := storage.ParseSceneDocument(data)
+	if err != nil {
+		return err
+	}
+
+	results, err := db.ImportScenes(doc, policy)
+	for _, result := range results {
+		fmt.Printf("%-8s %s\n", result.Action, result.Name)
+	}
+	return err
+}
+
+// resolveSceneRef finds a scene by name, falling back to a numeric ID
+func resolveSceneRef(db *storage.Database, ref string) (int, error) {
+	info, err := db.FindSceneByName(ref)
+	if err != nil {
+		return 0, err
+	}
+	if info != nil {
+		return info.ID, nil
+	}
+
+	id, err := strconv.Atoi(ref)
+	if err != nil {
+		return 0, fmt.Errorf("scene %q: %w", ref, storage.ErrSceneNotFound)
+	}
+	return id, nil
+}
@@ -0,0 +1,196 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the accepted shorthand expressions
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// monthNames and dayNames are the names accepted in the month and day-of-week fields
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	dayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// Cron fires at the times matched by a standard five-field cron expression:
+// minute, hour, day of month, month and day of week
+//
+// Fields accept *, numbers, names (jan-dec, sun-sat), ranges (1-5), lists (1,15)
+// and steps (*/15, 8-18/2). Sunday is 0 or 7. As in cron, when both the day of
+// month and the day of week are restricted, a day matching either one fires.
+// The macros @hourly, @daily, @weekly, @monthly and @yearly are also accepted.
+type Cron struct {
+	expr   string
+	times  []clockTime
+	dom    []bool
+	months []bool
+	dow    []bool
+
+	domAny, dowAny bool
+	loc            *time.Location
+}
+
+// ParseCron parses a cron expression evaluated in loc
+func ParseCron(expr string, loc *time.Location) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: want 5 fields, got %d", expr, len(fields))
+	}
+
+	minutes, _, err := parseCronField(fields[0], 0, 59, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron minute: %w", err)
+	}
+	hours, _, err := parseCronField(fields[1], 0, 23, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron hour: %w", err)
+	}
+	dom, domAny, err := parseCronField(fields[2], 1, 31, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron day of month: %w", err)
+	}
+	months, _, err := parseCronField(fields[3], 1, 12, monthNames)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron month: %w", err)
+	}
+	dow, dowAny, err := parseCronField(fields[4], 0, 7, dayNames)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron day of week: %w", err)
+	}
+	if dow[7] {
+		dow[0] = true
+	}
+
+	c := &Cron{
+		expr:   expr,
+		dom:    dom,
+		months: months,
+		dow:    dow[:7],
+		domAny: domAny,
+		dowAny: dowAny,
+		loc:    loc,
+	}
+	for hour := 0; hour <= 23; hour++ {
+		for minute := 0; minute <= 59; minute++ {
+			if hours[hour] && minutes[minute] {
+				c.times = append(c.times, clockTime{hour, minute})
+			}
+		}
+	}
+	return c, nil
+}
+
+// String returns the expression the trigger was parsed from
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first firing time after t
+func (c *Cron) Next(t time.Time) time.Time {
+	return nextWallTime(t, c.loc, func(day time.Time) []clockTime {
+		if !c.months[day.Month()] || !c.matchDay(day) {
+			return nil
+		}
+		return c.times
+	})
+}
+
+// matchDay applies cron's rule for combining the day of month and day of week fields
+func (c *Cron) matchDay(day time.Time) bool {
+	domMatch := c.dom[day.Day()]
+	dowMatch := c.dow[day.Weekday()]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// parseCronField parses one field into a set indexed by value
+// any reports whether the field is an unrestricted *.
+func parseCronField(field string, min, max int, names map[string]int) (set []bool, any bool, err error) {
+	set = make([]bool, max+1)
+	any = field == "*"
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, false, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			if lo, err = cronValue(bounds[0], min, max, names); err != nil {
+				return nil, false, err
+			}
+			if hi, err = cronValue(bounds[1], min, max, names); err != nil {
+				return nil, false, err
+			}
+			if hi < lo {
+				return nil, false, fmt.Errorf("range %q runs backwards", rangePart)
+			}
+		default:
+			if lo, err = cronValue(rangePart, min, max, names); err != nil {
+				return nil, false, err
+			}
+			// A single value with a step runs to the end of the range, as in cron
+			if step == 1 {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, any, nil
+}
+
+// cronValue parses a number or name within a field's range
+func cronValue(s string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, min, max)
+	}
+	return v, nil
+}
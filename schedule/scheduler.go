@@ -0,0 +1,381 @@
+package schedule
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/actions"
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/storage"
+)
+
+// DefaultCatchUpWindow is how far back a restart looks for missed runs
+const DefaultCatchUpWindow = 12 * time.Hour
+
+// maxSleep caps how long the scheduler waits between checks, so it notices the
+// wall clock jumping (suspend, NTP corrections) within this time
+const maxSleep = time.Hour
+
+// Runner carries out the action of a schedule
+type Runner interface {
+	Run(a actions.Action) error
+}
+
+// Upcoming is the next run of an enabled schedule
+type Upcoming struct {
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Action string    `json:"action"`
+	Next   time.Time `json:"next"`
+}
+
+// Event kinds
+const (
+	EventSchedule = "schedule" // a schedule runs
+	EventSun      = "sun"      // a sun event happens
+)
+
+// Event is something that happens at a known time
+type Event struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	Detail     string    `json:"detail,omitempty"`
+	ScheduleID int       `json:"scheduleId,omitempty"`
+}
+
+// Scheduler runs the actions of stored schedules when their triggers fire
+//
+// Each schedule fires at most once per check: if the process was busy or the
+// machine slept through several occurrences, the action runs once. After a
+// restart, schedules with catch-up enabled run once if they missed a time
+// within the catch-up window; the others wait for their next time.
+type Scheduler struct {
+	store  storage.ScheduleStore
+	runner Runner
+	clock  clock.Clock
+	loc    *time.Location
+	site   *Site
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[int]*entry
+	reload  chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// entry is a loaded, enabled schedule
+type entry struct {
+	schedule storage.Schedule
+	trigger  Trigger
+	action   actions.Action
+	next     time.Time
+}
+
+// NewScheduler creates a scheduler evaluating wall-clock times in loc
+func NewScheduler(store storage.ScheduleStore, runner Runner, clk clock.Clock, loc *time.Location) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		runner:  runner,
+		clock:   clk,
+		loc:     loc,
+		window:  DefaultCatchUpWindow,
+		entries: make(map[int]*entry),
+		reload:  make(chan struct{}, 1),
+	}
+}
+
+// SetCatchUpWindow sets how far back Start looks for missed runs
+func (s *Scheduler) SetCatchUpWindow(d time.Duration) {
+	s.window = d
+}
+
+// SetSite sets where sun events are computed for; without one, sun schedules are skipped
+func (s *Scheduler) SetSite(site Site) error {
+	if err := site.Validate(); err != nil {
+		return err
+	}
+	s.site = &site
+	return nil
+}
+
+// Site returns where sun events are computed for, or nil if no site is set
+func (s *Scheduler) Site() *Site {
+	return s.site
+}
+
+// Validate checks that a schedule's trigger and action are usable by this scheduler
+func (s *Scheduler) Validate(sched storage.Schedule) error {
+	return Validate(sched, s.loc, s.site)
+}
+
+// Validate checks that a schedule's trigger and action are usable
+func Validate(sched storage.Schedule, loc *time.Location, site *Site) error {
+	if _, err := Compile(sched, loc, site); err != nil {
+		return err
+	}
+	if _, err := actions.Parse(sched.Action); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Start loads the schedules, runs any missed ones that catch up and starts the scheduling loop
+func (s *Scheduler) Start() error {
+	missed, err := s.load(true)
+	if err != nil {
+		return err
+	}
+	for _, e := range missed {
+		log.Printf("Schedule: Catching up on %q", e.schedule.Name)
+		s.run(e.schedule, e.action)
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop()
+	return nil
+}
+
+// Stop ends the scheduling loop
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+// Reload re-reads the schedules after they have been changed
+func (s *Scheduler) Reload() error {
+	if _, err := s.load(false); err != nil {
+		return err
+	}
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Upcoming returns the next run of every enabled schedule, soonest first
+func (s *Scheduler) Upcoming() []Upcoming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upcoming := make([]Upcoming, 0, len(s.entries))
+	for _, e := range s.entries {
+		if e.next.IsZero() {
+			continue
+		}
+		upcoming = append(upcoming, Upcoming{
+			ID:     e.schedule.ID,
+			Name:   e.schedule.Name,
+			Action: e.action.String(),
+			Next:   e.next,
+		})
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		if !upcoming[i].Next.Equal(upcoming[j].Next) {
+			return upcoming[i].Next.Before(upcoming[j].Next)
+		}
+		return upcoming[i].ID < upcoming[j].ID
+	})
+	return upcoming
+}
+
+// NextEvents returns the next run of every enabled schedule and, when a site is
+// set, the next dawn, sunrise, sunset and dusk, in time order
+func (s *Scheduler) NextEvents() []Event {
+	events := make([]Event, 0)
+	for _, u := range s.Upcoming() {
+		events = append(events, Event{Time: u.Next, Kind: EventSchedule, Name: u.Name, Detail: u.Action, ScheduleID: u.ID})
+	}
+	if s.site != nil {
+		events = append(events, s.site.NextSunEvents(s.clock.Now(), s.loc)...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// NextRun returns when a schedule runs next
+// It returns false if the schedule is disabled, unknown or has no future time.
+func (s *Scheduler) NextRun(scheduleID int) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[scheduleID]
+	if !ok || e.next.IsZero() {
+		return time.Time{}, false
+	}
+	return e.next, true
+}
+
+// RunNow runs a schedule's action straight away, whether or not it is enabled
+func (s *Scheduler) RunNow(scheduleID int) error {
+	sched, err := s.store.GetSchedule(scheduleID)
+	if err != nil {
+		return err
+	}
+	if sched == nil {
+		return fmt.Errorf("%w: %d", storage.ErrScheduleNotFound, scheduleID)
+	}
+	action, err := actions.Parse(sched.Action)
+	if err != nil {
+		return err
+	}
+	return s.run(*sched, action)
+}
+
+// load compiles the enabled schedules and works out when each runs next
+// With catchUp set it also returns the schedules that missed a run while the
+// program wasn't running, ordered by when they should have last run.
+func (s *Scheduler) load(catchUp bool) ([]*entry, error) {
+	schedules, err := s.store.ListSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	now := s.clock.Now()
+	entries := make(map[int]*entry, len(schedules))
+	type missedRun struct {
+		entry *entry
+		at    time.Time
+	}
+	var missed []missedRun
+
+	for _, sched := range schedules {
+		if !sched.Enabled {
+			continue
+		}
+		trigger, err := Compile(sched, s.loc, s.site)
+		if err != nil {
+			log.Printf("Schedule: Skipping %q: %v", sched.Name, err)
+			continue
+		}
+		action, err := actions.Parse(sched.Action)
+		if err != nil {
+			log.Printf("Schedule: Skipping %q: %v", sched.Name, err)
+			continue
+		}
+
+		e := &entry{schedule: sched, trigger: trigger, action: action, next: trigger.Next(now)}
+		entries[sched.ID] = e
+
+		if catchUp && sched.CatchUp {
+			if at, ok := s.lastMissed(sched, trigger, now); ok {
+				missed = append(missed, missedRun{e, at})
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+
+	sort.Slice(missed, func(i, j int) bool { return missed[i].at.Before(missed[j].at) })
+	result := make([]*entry, len(missed))
+	for i, m := range missed {
+		result[i] = m.entry
+	}
+	return result, nil
+}
+
+// lastMissed returns the latest time a schedule should have run since it last
+// did (or was created), looking back no further than the catch-up window
+func (s *Scheduler) lastMissed(sched storage.Schedule, trigger Trigger, now time.Time) (time.Time, bool) {
+	since := sched.CreatedAt
+	if sched.LastRun != nil {
+		since = *sched.LastRun
+	}
+	if earliest := now.Add(-s.window); since.Before(earliest) {
+		since = earliest
+	}
+
+	var last time.Time
+	for at := trigger.Next(since); !at.IsZero() && !at.After(now); at = trigger.Next(at) {
+		last = at
+	}
+	return last, !last.IsZero()
+}
+
+// loop sleeps until the next schedule is due and runs it
+func (s *Scheduler) loop() {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.clock.After(s.untilNext()):
+			s.fire()
+		case <-s.reload:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// untilNext returns how long to sleep before the next check
+func (s *Scheduler) untilNext() time.Duration {
+	now := s.clock.Now()
+	wait := maxSleep
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.next.IsZero() {
+			continue
+		}
+		if d := e.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// fire runs every schedule that is due and moves it on to its next time
+func (s *Scheduler) fire() {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	var due []*entry
+	for _, e := range s.entries {
+		if e.next.IsZero() || e.next.After(now) {
+			continue
+		}
+		due = append(due, e)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].next.Equal(due[j].next) {
+			return due[i].next.Before(due[j].next)
+		}
+		return due[i].schedule.ID < due[j].schedule.ID
+	})
+	for _, e := range due {
+		e.next = e.trigger.Next(now)
+	}
+	s.mu.Unlock()
+
+	for _, e := range due {
+		s.run(e.schedule, e.action)
+	}
+}
+
+// run carries out a schedule's action and records when it ran
+func (s *Scheduler) run(sched storage.Schedule, action actions.Action) error {
+	log.Printf("Schedule: Running %q: %s", sched.Name, action)
+	err := s.runner.Run(action)
+	if err != nil {
+		log.Printf("Schedule: %q failed: %v", sched.Name, err)
+	}
+
+	if recordErr := s.store.SetScheduleLastRun(sched.ID, s.clock.Now()); recordErr != nil {
+		log.Printf("Schedule: Failed to record run of %q: %v", sched.Name, recordErr)
+	}
+	return err
+}
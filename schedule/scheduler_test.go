@@ -0,0 +1,311 @@
+package schedule
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/actions"
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/storage"
+)
+
+// recorder is a Runner that records the actions it is asked to run
+type recorder struct {
+	ran chan actions.Action
+}
+
+func newRecorder() *recorder {
+	return &recorder{ran: make(chan actions.Action, 16)}
+}
+
+func (r *recorder) Run(a actions.Action) error {
+	r.ran <- a
+	return nil
+}
+
+// next waits for the next action to run
+func (r *recorder) next(t *testing.T) actions.Action {
+	t.Helper()
+	select {
+	case a := <-r.ran:
+		return a
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an action to run")
+		return actions.Action{}
+	}
+}
+
+// none checks that nothing has run
+func (r *recorder) none(t *testing.T) {
+	t.Helper()
+	select {
+	case a := <-r.ran:
+		t.Fatalf("Unexpected action: %s", a)
+	default:
+	}
+}
+
+func newTestDatabase(t *testing.T) *storage.Database {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+	return db
+}
+
+// addSchedule stores a schedule recalling the named scene
+func addSchedule(t *testing.T, db *storage.Database, sched storage.Schedule, scene string) int {
+	t.Helper()
+	sched.Enabled = true
+	sched.Action = json.RawMessage(`{"type":"scene","scene":"` + scene + `"}`)
+	id, err := db.CreateSchedule(sched)
+	if err != nil {
+		t.Fatalf("CreateSchedule failed: %v", err)
+	}
+	return id
+}
+
+// start is 10:00 on Monday 2 March 2026
+var start = time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+func TestSchedulerFires(t *testing.T) {
+	db := newTestDatabase(t)
+	clk := clock.NewFake(start)
+	runner := newRecorder()
+
+	id := addSchedule(t, db, storage.Schedule{Name: "Focus", Cron: "30 10 * * mon-fri"}, "Focus")
+	addSchedule(t, db, storage.Schedule{Name: "Weekend", Days: []string{"sat"}, Times: []string{"09:00"}}, "Relax")
+
+	s := NewScheduler(db, runner, clk, time.UTC)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	upcoming := s.Upcoming()
+	if len(upcoming) != 2 || upcoming[0].Name != "Focus" || !upcoming[0].Next.Equal(start.Add(30*time.Minute)) {
+		t.Fatalf("Unexpected upcoming runs: %+v", upcoming)
+	}
+
+	clk.BlockUntil(1)
+	clk.Advance(29 * time.Minute)
+	runner.none(t)
+
+	clk.Advance(time.Minute)
+	if a := runner.next(t); a.Type != actions.TypeScene || a.Scene != "Focus" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+
+	next, ok := s.NextRun(id)
+	if !ok || !next.Equal(time.Date(2026, 3, 3, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("NextRun() = %v, %v; want tomorrow 10:30", next, ok)
+	}
+
+	// The run is recorded after the action
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sched, _ := db.GetSchedule(id)
+		if sched.LastRun != nil {
+			if !sched.LastRun.Equal(start.Add(30 * time.Minute)) {
+				t.Errorf("LastRun = %v", sched.LastRun)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("LastRun was not recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerRunsMissedTimesOnce(t *testing.T) {
+	db := newTestDatabase(t)
+	clk := clock.NewFake(start)
+	runner := newRecorder()
+
+	addSchedule(t, db, storage.Schedule{Name: "Every minute", Cron: "* * * * *"}, "Tick")
+
+	s := NewScheduler(db, runner, clk, time.UTC)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	// Sleeping through several runs (e.g. a suspended laptop) runs the action once
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Minute)
+	runner.next(t)
+
+	clk.BlockUntil(1)
+	runner.none(t)
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		catchUp bool
+		lastRun time.Time
+		window  time.Duration
+		want    []string
+	}{
+		{"missed since last run", true, start.Add(-5 * time.Hour), 4 * time.Hour, []string{"Morning"}},
+		{"long since last run", true, start.Add(-30 * time.Hour), 4 * time.Hour, []string{"Morning"}},
+		{"catch-up disabled", false, start.Add(-5 * time.Hour), 4 * time.Hour, nil},
+		{"already ran", true, start.Add(-2 * time.Hour), 4 * time.Hour, nil},
+		{"outside the window", true, start.Add(-5 * time.Hour), 2 * time.Hour, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(t)
+			runner := newRecorder()
+
+			// 07:00 was missed if the last run was before it
+			id := addSchedule(t, db, storage.Schedule{Name: "Morning", Times: []string{"07:00"}, CatchUp: tt.catchUp}, "Morning")
+			if err := db.SetScheduleLastRun(id, tt.lastRun); err != nil {
+				t.Fatalf("SetScheduleLastRun failed: %v", err)
+			}
+
+			// It is caught up on only if it falls within the window before 10:00
+			s := NewScheduler(db, runner, clock.NewFake(start), time.UTC)
+			s.SetCatchUpWindow(tt.window)
+			if err := s.Start(); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			defer s.Stop()
+
+			for _, scene := range tt.want {
+				if a := runner.next(t); a.Scene != scene {
+					t.Errorf("Caught up on %q, want %q", a.Scene, scene)
+				}
+			}
+			runner.none(t)
+		})
+	}
+}
+
+func TestSchedulerCatchUpOrder(t *testing.T) {
+	db := newTestDatabase(t)
+	runner := newRecorder()
+
+	// Both were missed; the one that should have run most recently runs last
+	late := addSchedule(t, db, storage.Schedule{Name: "Late", Times: []string{"09:00"}, CatchUp: true}, "Late")
+	early := addSchedule(t, db, storage.Schedule{Name: "Early", Times: []string{"08:00"}, CatchUp: true}, "Early")
+	for _, id := range []int{late, early} {
+		db.SetScheduleLastRun(id, start.Add(-6*time.Hour))
+	}
+
+	s := NewScheduler(db, runner, clock.NewFake(start), time.UTC)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	if a := runner.next(t); a.Scene != "Early" {
+		t.Errorf("First catch-up = %q, want Early", a.Scene)
+	}
+	if a := runner.next(t); a.Scene != "Late" {
+		t.Errorf("Second catch-up = %q, want Late", a.Scene)
+	}
+}
+
+func TestSchedulerReload(t *testing.T) {
+	db := newTestDatabase(t)
+	clk := clock.NewFake(start)
+	runner := newRecorder()
+
+	s := NewScheduler(db, runner, clk, time.UTC)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	if len(s.Upcoming()) != 0 {
+		t.Fatal("Expected no upcoming runs")
+	}
+
+	id := addSchedule(t, db, storage.Schedule{Name: "Soon", Times: []string{"10:05"}}, "Soon")
+	addSchedule(t, db, storage.Schedule{Name: "Broken", Cron: "not a cron"}, "Broken")
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	upcoming := s.Upcoming()
+	if len(upcoming) != 1 || upcoming[0].ID != id {
+		t.Fatalf("Expected only the valid schedule, got %+v", upcoming)
+	}
+
+	// The loop now waits for the new schedule rather than the idle hour
+	clk.BlockUntil(2)
+	clk.Advance(5 * time.Minute)
+	if a := runner.next(t); a.Scene != "Soon" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+
+	// Disabled schedules don't run, but can still be run by hand
+	sched, _ := db.GetSchedule(id)
+	sched.Enabled = false
+	if err := db.UpdateSchedule(*sched); err != nil {
+		t.Fatalf("UpdateSchedule failed: %v", err)
+	}
+	s.Reload()
+	if _, ok := s.NextRun(id); ok {
+		t.Error("Expected no next run for a disabled schedule")
+	}
+	if err := s.RunNow(id); err != nil {
+		t.Fatalf("RunNow failed: %v", err)
+	}
+	if a := runner.next(t); a.Scene != "Soon" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+	if err := s.RunNow(999); err == nil {
+		t.Error("Expected an error for an unknown schedule")
+	}
+}
+
+func TestSchedulerNextEvents(t *testing.T) {
+	db := newTestDatabase(t)
+	tz := mustLoad(t, "Europe/London")
+	clk := clock.NewFake(time.Date(2026, 6, 19, 12, 0, 0, 0, tz))
+
+	addSchedule(t, db, storage.Schedule{Name: "Warm", Sun: "sunset", Offset: -30}, "Warm")
+	addSchedule(t, db, storage.Schedule{Name: "Lunch", Times: []string{"12:30"}}, "Lunch")
+
+	s := NewScheduler(db, newRecorder(), clk, tz)
+
+	// Without a site sun schedules can't be used
+	if err := s.Validate(storage.Schedule{Name: "Warm", Sun: "sunset", Action: json.RawMessage(`{"type":"off"}`)}); err == nil {
+		t.Error("Expected sun schedules to need a site")
+	}
+
+	if err := s.SetSite(london); err != nil {
+		t.Fatalf("SetSite failed: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	var names []string
+	for _, e := range s.NextEvents() {
+		names = append(names, e.Name)
+	}
+	want := []string{"Lunch", "Warm", "sunset", "dusk", "dawn", "sunrise"}
+	if len(names) != len(want) {
+		t.Fatalf("NextEvents() = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("NextEvents() = %v, want %v", names, want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package schedule
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SunEvent is a point in the sun's daily path
+type SunEvent string
+
+const (
+	Dawn    SunEvent = "dawn"    // civil twilight begins, sun 6° below the horizon
+	Sunrise SunEvent = "sunrise" // upper edge of the sun appears
+	Sunset  SunEvent = "sunset"  // upper edge of the sun disappears
+	Dusk    SunEvent = "dusk"    // civil twilight ends, sun 6° below the horizon
+)
+
+// SunEvents lists the events in the order they happen each day
+var SunEvents = []SunEvent{Dawn, Sunrise, Sunset, Dusk}
+
+// ParseSunEvent looks up a sun event by name
+func ParseSunEvent(name string) (SunEvent, error) {
+	for _, e := range SunEvents {
+		if string(e) == strings.ToLower(strings.TrimSpace(name)) {
+			return e, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sun event %q (use dawn, sunrise, sunset or dusk)", name)
+}
+
+// altitude is the sun's altitude at the event, in degrees
+// Sunrise and sunset allow for refraction and the sun's radius.
+func (e SunEvent) altitude() float64 {
+	if e == Dawn || e == Dusk {
+		return -6
+	}
+	return -0.833
+}
+
+// rising reports whether the event is in the morning
+func (e SunEvent) rising() bool {
+	return e == Dawn || e == Sunrise
+}
+
+// Site is where on Earth sun events are computed for
+type Site struct {
+	Latitude  float64 // degrees, north positive
+	Longitude float64 // degrees, east positive
+}
+
+// Validate checks the coordinates are on the globe
+func (s Site) Validate() error {
+	if s.Latitude < -90 || s.Latitude > 90 {
+		return fmt.Errorf("latitude %v out of range -90 to 90", s.Latitude)
+	}
+	if s.Longitude < -180 || s.Longitude > 180 {
+		return fmt.Errorf("longitude %v out of range -180 to 180", s.Longitude)
+	}
+	return nil
+}
+
+// julianUnixEpoch is the Julian date of 1970-01-01T00:00:00Z
+const julianUnixEpoch = 2440587.5
+
+// j2000 is the Julian date of 2000-01-01T12:00:00Z
+const j2000 = 2451545.0
+
+// SunTime returns when an event happens on the solar day nearest the given date
+// at the site. It returns false when the sun doesn't reach the event's altitude
+// that day, as in polar summer or winter.
+//
+// This is the sunrise equation with the usual low-precision solar position,
+// which is good to about a minute away from the poles.
+func (s Site) SunTime(event SunEvent, date time.Time) (time.Time, bool) {
+	const rad = math.Pi / 180
+
+	// Days since J2000 to the local solar noon nearest date
+	jd := float64(date.Unix())/86400 + julianUnixEpoch
+	n := math.Round(jd - j2000 - 0.0008 + s.Longitude/360)
+	meanNoon := n - s.Longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := j2000 + meanNoon + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*longitude*rad)
+
+	declination := math.Asin(math.Sin(longitude*rad) * math.Sin(23.4397*rad))
+	latitude := s.Latitude * rad
+	cosHourAngle := (math.Sin(event.altitude()*rad) - math.Sin(latitude)*math.Sin(declination)) /
+		(math.Cos(latitude) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) / rad / 360
+	at := transit + hourAngle
+	if event.rising() {
+		at = transit - hourAngle
+	}
+
+	seconds := (at - julianUnixEpoch) * 86400
+	return time.Unix(0, int64(seconds*float64(time.Second))).Round(time.Second), true
+}
+
+// Solar fires at a sun event, offset by a fixed time, on chosen days of the week
+type Solar struct {
+	event  SunEvent
+	offset time.Duration
+	days   [7]bool
+	site   Site
+	loc    *time.Location
+}
+
+// ParseSolar builds a sun-relative trigger
+// A negative offset fires before the event. The days are as for ParseWeekly and
+// apply to the local day of the event itself.
+func ParseSolar(event string, offset time.Duration, days []string, site *Site, loc *time.Location) (*Solar, error) {
+	if site == nil {
+		return nil, fmt.Errorf("sun schedules need a latitude and longitude to be configured")
+	}
+	if err := site.Validate(); err != nil {
+		return nil, err
+	}
+	e, err := ParseSunEvent(event)
+	if err != nil {
+		return nil, err
+	}
+	if offset <= -12*time.Hour || offset >= 12*time.Hour {
+		return nil, fmt.Errorf("sun offset %v must be less than 12 hours", offset)
+	}
+	set, err := ParseDays(days)
+	if err != nil {
+		return nil, err
+	}
+	return &Solar{event: e, offset: offset, days: set, site: *site, loc: loc}, nil
+}
+
+// Next returns the first firing time after t
+func (s *Solar) Next(t time.Time) time.Time {
+	// Start a day early, as the offset can bring yesterday's event past t
+	local := t.In(s.loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, s.loc).AddDate(0, 0, -1)
+
+	for i := 0; i < searchDays; i++ {
+		if event, ok := s.site.SunTime(s.event, day); ok && s.days[event.In(s.loc).Weekday()] {
+			if at := event.Add(s.offset); at.After(t) {
+				return at
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// String describes the trigger, e.g. "30m before sunset"
+func (s *Solar) String() string {
+	switch {
+	case s.offset < 0:
+		return fmt.Sprintf("%v before %s", -s.offset, s.event)
+	case s.offset > 0:
+		return fmt.Sprintf("%v after %s", s.offset, s.event)
+	default:
+		return "at " + string(s.event)
+	}
+}
+
+// NextSunEvents returns the next time each sun event happens after t, in time order
+// Events that don't happen within the search range (near the poles) are left out.
+func (s Site) NextSunEvents(t time.Time, loc *time.Location) []Event {
+	var events []Event
+	for _, e := range SunEvents {
+		trigger := &Solar{event: e, site: s, loc: loc, days: everyDay}
+		if at := trigger.Next(t); !at.IsZero() {
+			events = append(events, Event{Time: at, Kind: EventSun, Name: string(e)})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
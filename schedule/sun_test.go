@@ -0,0 +1,165 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+var (
+	london = Site{Latitude: 51.5074, Longitude: -0.1278}
+	tromso = Site{Latitude: 69.6492, Longitude: 18.9553}
+)
+
+func TestSunTime(t *testing.T) {
+	londonTZ := mustLoad(t, "Europe/London")
+	newYorkTZ := mustLoad(t, "America/New_York")
+	sydneyTZ := mustLoad(t, "Australia/Sydney")
+
+	// Published times, to the minute
+	tests := []struct {
+		name  string
+		site  Site
+		date  time.Time
+		event SunEvent
+		want  time.Time
+	}{
+		{"London midsummer sunrise", london, time.Date(2026, 6, 21, 12, 0, 0, 0, londonTZ), Sunrise, time.Date(2026, 6, 21, 4, 43, 0, 0, londonTZ)},
+		{"London midsummer sunset", london, time.Date(2026, 6, 21, 12, 0, 0, 0, londonTZ), Sunset, time.Date(2026, 6, 21, 21, 21, 0, 0, londonTZ)},
+		{"London midsummer dawn", london, time.Date(2026, 6, 21, 12, 0, 0, 0, londonTZ), Dawn, time.Date(2026, 6, 21, 3, 55, 0, 0, londonTZ)},
+		{"New York midwinter sunrise", Site{40.7128, -74.0060}, time.Date(2026, 12, 21, 12, 0, 0, 0, newYorkTZ), Sunrise, time.Date(2026, 12, 21, 7, 16, 0, 0, newYorkTZ)},
+		{"New York midwinter dusk", Site{40.7128, -74.0060}, time.Date(2026, 12, 21, 12, 0, 0, 0, newYorkTZ), Dusk, time.Date(2026, 12, 21, 17, 2, 0, 0, newYorkTZ)},
+		{"Sydney summer sunset", Site{-33.8688, 151.2093}, time.Date(2026, 1, 10, 12, 0, 0, 0, sydneyTZ), Sunset, time.Date(2026, 1, 10, 20, 10, 0, 0, sydneyTZ)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.site.SunTime(tt.event, tt.date)
+			if !ok {
+				t.Fatal("Expected the event to happen")
+			}
+			if diff := got.Sub(tt.want); diff < -2*time.Minute || diff > 2*time.Minute {
+				t.Errorf("SunTime() = %v, want %v", got.In(tt.want.Location()), tt.want)
+			}
+		})
+	}
+}
+
+func TestPolarNight(t *testing.T) {
+	oslo := mustLoad(t, "Europe/Oslo")
+	midwinter := time.Date(2026, 12, 21, 12, 0, 0, 0, oslo)
+
+	// In Tromsø the sun doesn't rise at midwinter, but there is civil twilight
+	if _, ok := tromso.SunTime(Sunrise, midwinter); ok {
+		t.Error("Expected no sunrise in Tromsø at midwinter")
+	}
+	if _, ok := tromso.SunTime(Dawn, midwinter); !ok {
+		t.Error("Expected civil dawn in Tromsø at midwinter")
+	}
+
+	// A sunrise trigger skips the polar night and fires when the sun returns in January
+	trigger, err := ParseSolar("sunrise", 0, nil, &tromso, oslo)
+	if err != nil {
+		t.Fatalf("ParseSolar failed: %v", err)
+	}
+	next := trigger.Next(midwinter)
+	if next.Month() != time.January || next.Year() != 2027 {
+		t.Errorf("Expected the first sunrise in January 2027, got %v", next.In(oslo))
+	}
+}
+
+func TestSolarNext(t *testing.T) {
+	tz := mustLoad(t, "Europe/London")
+
+	// Sunset on Friday 19 June 2026 is at about 21:21
+	friday := time.Date(2026, 6, 19, 12, 0, 0, 0, tz)
+	sunset, _ := london.SunTime(Sunset, friday)
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		days   []string
+		from   time.Time
+		want   time.Time
+	}{
+		{"30 minutes before sunset", -30 * time.Minute, nil, friday, sunset.Add(-30 * time.Minute)},
+		{"an hour after sunset", time.Hour, nil, friday, sunset.Add(time.Hour)},
+		{"already passed today", 0, nil, sunset, nextSunset(t, sunset, tz)},
+		{"weekdays skip the weekend", 0, []string{"weekdays"}, sunset, nextWeekdaySunset(t, sunset, tz)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger, err := ParseSolar("sunset", tt.offset, tt.days, &london, tz)
+			if err != nil {
+				t.Fatalf("ParseSolar failed: %v", err)
+			}
+			if got := trigger.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got.In(tz), tt.want.In(tz))
+			}
+		})
+	}
+
+	// An offset that carries yesterday's event past midnight is still found
+	late, _ := ParseSolar("dusk", 4*time.Hour, nil, &london, tz)
+	midnight := time.Date(2026, 6, 20, 0, 0, 0, 0, tz)
+	if got := late.Next(midnight).In(tz); got.Day() != 20 || got.Hour() != 2 {
+		t.Errorf("Expected yesterday's dusk + 4h at about 02:00, got %v", got.In(tz))
+	}
+}
+
+// nextSunset returns the sunset the day after the one given
+func nextSunset(t *testing.T, sunset time.Time, tz *time.Location) time.Time {
+	t.Helper()
+	at, _ := london.SunTime(Sunset, sunset.In(tz).AddDate(0, 0, 1))
+	return at
+}
+
+// nextWeekdaySunset returns the sunset on the Monday after a Friday
+func nextWeekdaySunset(t *testing.T, sunset time.Time, tz *time.Location) time.Time {
+	t.Helper()
+	at, _ := london.SunTime(Sunset, sunset.In(tz).AddDate(0, 0, 3))
+	return at
+}
+
+func TestParseSolar(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   string
+		offset  time.Duration
+		site    *Site
+		wantErr bool
+	}{
+		{"sunset", "sunset", -30 * time.Minute, &london, false},
+		{"case insensitive", "Dawn", 0, &london, false},
+		{"no site", "sunrise", 0, nil, true},
+		{"unknown event", "noon", 0, &london, true},
+		{"offset too large", "sunset", 12 * time.Hour, &london, true},
+		{"bad latitude", "sunset", 0, &Site{Latitude: 91}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSolar(tt.event, tt.offset, nil, tt.site, time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSolar() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	sched := storage.Schedule{Sun: "sunset", Offset: -30, Days: []string{"weekdays"}}
+	trigger, err := Compile(sched, time.UTC, &london)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if got := trigger.(*Solar).String(); got != "30m0s before sunset" {
+		t.Errorf("String() = %q", got)
+	}
+	if _, err := Compile(storage.Schedule{Times: []string{"07:00"}, Offset: 10}, time.UTC, &london); err == nil {
+		t.Error("Expected an error for an offset without a sun event")
+	}
+	if _, err := Compile(storage.Schedule{Sun: "sunset", Times: []string{"07:00"}}, time.UTC, &london); err == nil {
+		t.Error("Expected an error for a sun event with times")
+	}
+}
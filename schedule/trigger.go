@@ -0,0 +1,243 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// searchDays is how far ahead a trigger looks for its next time
+const searchDays = 5 * 366
+
+// Trigger computes when a schedule next fires
+type Trigger interface {
+	// Next returns the first firing time strictly after t, or the zero time if there is none
+	Next(t time.Time) time.Time
+}
+
+// clockTime is a wall-clock time of day
+type clockTime struct {
+	hour, minute int
+}
+
+// parseClockTime parses "HH:MM"
+func parseClockTime(s string) (clockTime, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return clockTime{}, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return clockTime{}, fmt.Errorf("invalid hour in %q", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || len(parts[1]) != 2 {
+		return clockTime{}, fmt.Errorf("invalid minute in %q", s)
+	}
+	return clockTime{hour, minute}, nil
+}
+
+// ParseTimeOfDay parses "HH:MM" into minutes after midnight
+func ParseTimeOfDay(s string) (int, error) {
+	ct, err := parseClockTime(s)
+	if err != nil {
+		return 0, err
+	}
+	return ct.hour*60 + ct.minute, nil
+}
+
+// nextWallTime returns the first time after t at which one of the wall-clock times
+// returned by timesOn for that day falls, searching day by day in loc
+// timesOn must return times in ascending order.
+func nextWallTime(t time.Time, loc *time.Location, timesOn func(day time.Time) []clockTime) time.Time {
+	local := t.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < searchDays; i++ {
+		for _, ct := range timesOn(day) {
+			// A repeated time resolves to its first occurrence, which is skipped here
+			// if it has passed, so it never fires twice
+			if at := resolve(day.Year(), day.Month(), day.Day(), ct, loc); at.After(t) {
+				return at
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// resolve turns a wall-clock time into an instant, handling daylight saving changes:
+//
+//   - a time skipped when the clocks go forward fires at the moment they change
+//   - a time repeated when the clocks go back resolves to its first occurrence
+func resolve(year int, month time.Month, day int, ct clockTime, loc *time.Location) time.Time {
+	naive := time.Date(year, month, day, ct.hour, ct.minute, 0, 0, time.UTC)
+
+	// The zone offsets either side of the date cover any change that day
+	_, before := naive.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := naive.Add(24 * time.Hour).In(loc).Zone()
+
+	var valid []time.Time
+	for _, offset := range []int{before, after} {
+		candidate := naive.Add(-time.Duration(offset) * time.Second)
+		local := candidate.In(loc)
+		if local.Hour() == ct.hour && local.Minute() == ct.minute && local.Day() == day {
+			valid = append(valid, candidate)
+		}
+	}
+
+	switch {
+	case len(valid) == 0:
+		// Skipped: find the instant the clocks jump past this time
+		lo := naive.Add(-time.Duration(before) * time.Second)
+		hi := naive.Add(-time.Duration(after) * time.Second)
+		if hi.Before(lo) {
+			lo, hi = hi, lo
+		}
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, offset := mid.In(loc).Zone(); offset == before {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		return hi.Truncate(time.Second)
+	case len(valid) == 2 && !valid[0].Equal(valid[1]):
+		// Repeated: the earlier instant is the first occurrence
+		if valid[1].Before(valid[0]) {
+			valid[0] = valid[1]
+		}
+		return valid[0]
+	default:
+		return valid[0]
+	}
+}
+
+// Weekly fires at the same times of day on chosen days of the week
+type Weekly struct {
+	days  [7]bool
+	times []clockTime
+	loc   *time.Location
+}
+
+// weekdays maps the accepted day names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// ParseWeekly builds a weekly trigger from day names and "HH:MM" times
+// The day names "weekdays", "weekends" and "daily" are also accepted; no days means every day.
+func ParseWeekly(days, times []string, loc *time.Location) (*Weekly, error) {
+	if len(times) == 0 {
+		return nil, fmt.Errorf("at least one time of day is required")
+	}
+
+	set, err := ParseDays(days)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Weekly{days: set, loc: loc}
+	for _, s := range times {
+		ct, err := parseClockTime(s)
+		if err != nil {
+			return nil, err
+		}
+		w.times = append(w.times, ct)
+	}
+	sort.Slice(w.times, func(i, j int) bool {
+		if w.times[i].hour != w.times[j].hour {
+			return w.times[i].hour < w.times[j].hour
+		}
+		return w.times[i].minute < w.times[j].minute
+	})
+	return w, nil
+}
+
+// everyDay is the day set used when no days are given
+var everyDay = [7]bool{true, true, true, true, true, true, true}
+
+// ParseDays turns day names into a set indexed by time.Weekday; no days means every day
+func ParseDays(days []string) ([7]bool, error) {
+	if len(days) == 0 {
+		return everyDay, nil
+	}
+
+	var set [7]bool
+	for _, name := range days {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "daily", "everyday":
+			set = everyDay
+		case "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				set[d] = true
+			}
+		case "weekends":
+			set[time.Saturday] = true
+			set[time.Sunday] = true
+		default:
+			day, ok := weekdays[name]
+			if !ok {
+				return set, fmt.Errorf("unknown day %q", name)
+			}
+			set[day] = true
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first firing time after t
+func (w *Weekly) Next(t time.Time) time.Time {
+	return nextWallTime(t, w.loc, func(day time.Time) []clockTime {
+		if !w.days[day.Weekday()] {
+			return nil
+		}
+		return w.times
+	})
+}
+
+// Compile builds the trigger for a stored schedule
+// site may be nil when no location is configured, in which case sun schedules fail.
+func Compile(s storage.Schedule, loc *time.Location, site *Site) (Trigger, error) {
+	hasCron := strings.TrimSpace(s.Cron) != ""
+	hasTimes := len(s.Times) > 0
+	hasSun := strings.TrimSpace(s.Sun) != ""
+
+	kinds := 0
+	for _, has := range []bool{hasCron, hasTimes, hasSun} {
+		if has {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return nil, fmt.Errorf("schedule %q must use only one of cron, times or sun", s.Name)
+	}
+	if s.Offset != 0 && !hasSun {
+		return nil, fmt.Errorf("schedule %q: offset only applies to sun events", s.Name)
+	}
+
+	switch {
+	case hasCron:
+		if len(s.Days) > 0 {
+			return nil, fmt.Errorf("schedule %q: cron expressions give their own days", s.Name)
+		}
+		return ParseCron(s.Cron, loc)
+	case hasSun:
+		return ParseSolar(s.Sun, time.Duration(s.Offset)*time.Minute, s.Days, site, loc)
+	case hasTimes || len(s.Days) > 0:
+		return ParseWeekly(s.Days, s.Times, loc)
+	default:
+		return nil, fmt.Errorf("schedule %q needs a cron expression, times of day or a sun event", s.Name)
+	}
+}
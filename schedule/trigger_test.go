@@ -0,0 +1,233 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // DST tests must not depend on the host's zone database
+
+	"github.com/kevin/office_lights/storage"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q) failed: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"0 7 * * mon-fri", false},
+		{"*/15 8-18 * * *", false},
+		{"30 6 1,15 jan-mar 0", false},
+		{"0 0 * * 7", false},
+		{"5/20 * * * *", false},
+		{"@daily", false},
+		{"@Hourly", false},
+		{"0 7 * *", true},
+		{"60 7 * * *", true},
+		{"0 24 * * *", true},
+		{"0 7 0 * *", true},
+		{"0 7 * 13 *", true},
+		{"0 7 * * 8", true},
+		{"0 7 * * fri-mon", true},
+		{"*/0 * * * *", true},
+		{"@sometimes", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr, time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-03-02 is a Monday
+	from := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 7 * * mon-fri", time.Date(2026, 3, 3, 7, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 2, 10, 15, 0, 0, time.UTC)},
+		{"0 10 * * *", time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2026, 3, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2026, 3, 8, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week together match either (the 13th or a Friday)
+		{"0 8 13 * fri", time.Date(2026, 3, 6, 8, 0, 0, 0, time.UTC)},
+		{"0 8 29 2 *", time.Date(2028, 2, 29, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatalf("ParseCron failed: %v", err)
+			}
+			if got := c.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	never, _ := ParseCron("0 0 31 2 *", time.UTC)
+	if got := never.Next(from); !got.IsZero() {
+		t.Errorf("Expected no time for 31 February, got %v", got)
+	}
+}
+
+func TestWeekly(t *testing.T) {
+	from := time.Date(2026, 3, 6, 18, 0, 0, 0, time.UTC) // Friday evening
+
+	tests := []struct {
+		name    string
+		days    []string
+		times   []string
+		want    time.Time
+		wantErr bool
+	}{
+		{"weekdays", []string{"weekdays"}, []string{"07:30"}, time.Date(2026, 3, 9, 7, 30, 0, 0, time.UTC), false},
+		{"later today", []string{"fri"}, []string{"07:00", "21:15"}, time.Date(2026, 3, 6, 21, 15, 0, 0, time.UTC), false},
+		{"every day", nil, []string{"06:00"}, time.Date(2026, 3, 7, 6, 0, 0, 0, time.UTC), false},
+		{"weekends", []string{"Weekends"}, []string{"10:00"}, time.Date(2026, 3, 7, 10, 0, 0, 0, time.UTC), false},
+		{"unsorted times", []string{"sunday"}, []string{"20:00", "08:00"}, time.Date(2026, 3, 8, 8, 0, 0, 0, time.UTC), false},
+		{"no times", []string{"mon"}, nil, time.Time{}, true},
+		{"bad day", []string{"funday"}, []string{"07:00"}, time.Time{}, true},
+		{"bad time", nil, []string{"7:5"}, time.Time{}, true},
+		{"hour out of range", nil, []string{"24:00"}, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseWeekly(tt.days, tt.times, time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWeekly() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := w.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDaylightSaving(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+	london := mustLoad(t, "Europe/London")
+
+	tests := []struct {
+		name string
+		loc  *time.Location
+		expr string
+		from time.Time
+		want []time.Time // successive firing times, in UTC
+	}{
+		{
+			// 02:30 doesn't exist on 8 March 2026: fire when the clocks jump to 03:00
+			name: "New York spring forward",
+			loc:  newYork,
+			expr: "30 2 * * *",
+			from: time.Date(2026, 3, 8, 0, 0, 0, 0, newYork),
+			want: []time.Time{
+				time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC),
+				time.Date(2026, 3, 9, 6, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// 01:30 happens twice on 1 November 2026: fire only at the first
+			name: "New York fall back",
+			loc:  newYork,
+			expr: "30 1 * * *",
+			from: time.Date(2026, 11, 1, 0, 0, 0, 0, newYork),
+			want: []time.Time{
+				time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC),
+				time.Date(2026, 11, 2, 6, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "London spring forward",
+			loc:  london,
+			expr: "30 1 * * *",
+			from: time.Date(2026, 3, 29, 0, 0, 0, 0, london),
+			want: []time.Time{
+				time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC),
+				time.Date(2026, 3, 30, 0, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "London fall back",
+			loc:  london,
+			expr: "30 1 * * *",
+			from: time.Date(2026, 10, 25, 0, 0, 0, 0, london),
+			want: []time.Time{
+				time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC),
+				time.Date(2026, 10, 26, 1, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Half-hourly runs in the repeated hour happen once, not twice
+			name: "New York half hours through fall back",
+			loc:  newYork,
+			expr: "*/30 1 * * *",
+			from: time.Date(2026, 11, 1, 5, 10, 0, 0, time.UTC), // 01:10 EDT
+			want: []time.Time{
+				time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC),
+				time.Date(2026, 11, 2, 6, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr, tt.loc)
+			if err != nil {
+				t.Fatalf("ParseCron failed: %v", err)
+			}
+			at := tt.from
+			for i, want := range tt.want {
+				at = c.Next(at)
+				if !at.Equal(want) {
+					t.Fatalf("Run %d at %v, want %v", i+1, at.UTC(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		sched   storage.Schedule
+		wantErr bool
+	}{
+		{"cron", storage.Schedule{Cron: "0 7 * * *"}, false},
+		{"weekly", storage.Schedule{Days: []string{"mon"}, Times: []string{"07:00"}}, false},
+		{"times only", storage.Schedule{Times: []string{"07:00"}}, false},
+		{"both", storage.Schedule{Cron: "0 7 * * *", Times: []string{"07:00"}}, true},
+		{"neither", storage.Schedule{}, true},
+		{"days without times", storage.Schedule{Days: []string{"mon"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.sched, time.UTC, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package sequences
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// Command controls sequence playback, received over MQTT
+//
+// Example:
+//
+//	{"action": "play", "sequence": "Wind Down"}
+//	{"action": "play", "sequence": "Countdown", "loop": true}
+//	{"action": "pause"}
+//	{"action": "resume"}
+//	{"action": "stop"}
+type Command struct {
+	Action   string `json:"action"`
+	Sequence string `json:"sequence,omitempty"` // name or ID
+	Loop     *bool  `json:"loop,omitempty"`     // overrides the sequence's own setting
+}
+
+// CommandHandler applies sequence commands to a player
+type CommandHandler struct {
+	player *Player
+	store  storage.SequenceStore
+}
+
+// NewCommandHandler creates a sequence command handler
+func NewCommandHandler(player *Player, store storage.SequenceStore) *CommandHandler {
+	return &CommandHandler{player: player, store: store}
+}
+
+// Handle decodes and applies a JSON sequence command
+func (h *CommandHandler) Handle(payload []byte) error {
+	var cmd Command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return fmt.Errorf("invalid sequence command: %w", err)
+	}
+	return h.Apply(cmd)
+}
+
+// Apply applies a sequence command
+func (h *CommandHandler) Apply(cmd Command) error {
+	switch cmd.Action {
+	case "play":
+		seq, err := Find(h.store, cmd.Sequence)
+		if err != nil {
+			return err
+		}
+		loop := seq.Loop
+		if cmd.Loop != nil {
+			loop = *cmd.Loop
+		}
+		return h.player.Play(seq, loop)
+	case "pause":
+		return h.player.Pause()
+	case "resume":
+		return h.player.Resume()
+	case "toggle":
+		return h.player.TogglePause()
+	case "stop":
+		h.player.Stop()
+		return nil
+	default:
+		return fmt.Errorf("unknown sequence action %q (want play, pause, resume, toggle or stop)", cmd.Action)
+	}
+}
+
+// Find looks up a sequence by name, falling back to a numeric ID
+func Find(store storage.SequenceStore, ref string) (*storage.Sequence, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("sequence name is required")
+	}
+
+	seq, err := store.FindSequenceByName(ref)
+	if err != nil {
+		return nil, err
+	}
+	if seq == nil {
+		if id, convErr := strconv.Atoi(ref); convErr == nil {
+			seq, err = store.GetSequence(id)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if seq == nil {
+		return nil, fmt.Errorf("%w: %q", storage.ErrSequenceNotFound, ref)
+	}
+	return seq, nil
+}
@@ -0,0 +1,11 @@
+package sequences
+
+import "errors"
+
+var (
+	// ErrNotPlaying is returned when pausing or resuming with nothing playing
+	ErrNotPlaying = errors.New("no sequence is playing")
+
+	// ErrNoKeyframes is returned when playing a sequence without keyframes
+	ErrNoKeyframes = errors.New("sequence has no keyframes")
+)
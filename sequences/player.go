@@ -0,0 +1,433 @@
+package sequences
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// State is the playback state of the player
+type State string
+
+const (
+	StateStopped State = "stopped"
+	StatePlaying State = "playing"
+	StatePaused  State = "paused"
+)
+
+// Status describes what the player is doing
+type Status struct {
+	State      State   `json:"state"`
+	SequenceID int     `json:"sequenceId,omitempty"`
+	Sequence   string  `json:"sequence,omitempty"`
+	Loop       bool    `json:"loop"`
+	Keyframe   int     `json:"keyframe,omitempty"` // 1-based
+	Keyframes  int     `json:"keyframes,omitempty"`
+	Phase      string  `json:"phase,omitempty"` // "fade" or "hold"
+	Iteration  int     `json:"iteration,omitempty"`
+	Elapsed    int     `json:"elapsed"`  // milliseconds into the current pass
+	Duration   int     `json:"duration"` // milliseconds per pass
+	Progress   float64 `json:"progress"` // 0-1 through the current pass
+}
+
+// Player plays keyframe sequences through a transition engine
+//
+// Each keyframe is crossfaded to over its fade time and then held. One
+// sequence plays at a time. Pausing mid-fade freezes the lights where they
+// are and resuming fades on from there over the remaining time. Recalling a
+// scene (any other TransitionEngine.Apply) stops the sequence.
+type Player struct {
+	engine *lights.TransitionEngine
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	current *playback
+}
+
+// playback is one run of a sequence
+// Fields below mu-guarded are only accessed with Player.mu held.
+type playback struct {
+	seq  *storage.Sequence
+	loop bool
+	stop chan struct{}
+	wake chan struct{}
+	done chan struct{}
+
+	// Requests from Pause, Resume and Interrupt
+	wantPaused  bool
+	interrupted bool
+	acks        []chan struct{}
+
+	// Progress
+	paused     bool
+	applying   *storage.SceneData
+	index      int
+	phase      string
+	iteration  int
+	segBase    time.Duration // pass time at which the current segment starts
+	segLength  time.Duration
+	offset     time.Duration // pass time reached when the segment (re)started
+	segStarted time.Time
+}
+
+// NewPlayer creates a sequence player
+func NewPlayer(engine *lights.TransitionEngine, clk clock.Clock) *Player {
+	return &Player{
+		engine: engine,
+		clock:  clk,
+	}
+}
+
+// Play starts a sequence from its first keyframe, replacing anything already playing
+func (p *Player) Play(seq *storage.Sequence, loop bool) error {
+	if err := Validate(seq); err != nil {
+		return err
+	}
+
+	p.Stop()
+
+	pb := &playback{
+		seq:  seq,
+		loop: loop,
+		stop: make(chan struct{}),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	p.current = pb
+	p.mu.Unlock()
+
+	log.Printf("Sequences: Playing %q (%d keyframes, loop=%v)", seq.Name, len(seq.Keyframes), loop)
+	go p.run(pb)
+	return nil
+}
+
+// Validate checks that a sequence can be played
+func Validate(seq *storage.Sequence) error {
+	if len(seq.Keyframes) == 0 {
+		return fmt.Errorf("%w: %q", ErrNoKeyframes, seq.Name)
+	}
+	for i, kf := range seq.Keyframes {
+		if kf.Devices == nil || kf.Devices.IsEmpty() {
+			return fmt.Errorf("keyframe %d has no light state", i+1)
+		}
+		if kf.Fade < 0 || kf.Hold < 0 {
+			return fmt.Errorf("keyframe %d: fade and hold must not be negative", i+1)
+		}
+		if _, err := lights.ParseEasing(kf.Easing); err != nil {
+			return fmt.Errorf("keyframe %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Pause freezes the playing sequence where it is
+func (p *Player) Pause() error {
+	return p.request(true)
+}
+
+// Resume continues a paused sequence
+func (p *Player) Resume() error {
+	return p.request(false)
+}
+
+// TogglePause pauses a playing sequence or resumes a paused one
+func (p *Player) TogglePause() error {
+	return p.request(p.Status().State == StatePlaying)
+}
+
+// request asks the playback goroutine to pause or resume and waits until it has
+func (p *Player) request(pause bool) error {
+	p.mu.Lock()
+	pb := p.current
+	if pb == nil {
+		p.mu.Unlock()
+		return ErrNotPlaying
+	}
+	ack := make(chan struct{})
+	pb.wantPaused = pause
+	pb.acks = append(pb.acks, ack)
+	p.mu.Unlock()
+
+	pb.signal()
+	select {
+	case <-ack:
+	case <-pb.done:
+	}
+	return nil
+}
+
+// Stop ends the sequence, leaving the lights where they are
+func (p *Player) Stop() {
+	p.mu.Lock()
+	pb := p.current
+	p.current = nil
+	p.mu.Unlock()
+
+	if pb == nil {
+		return
+	}
+	close(pb.stop)
+	<-pb.done
+	log.Printf("Sequences: Stopped %q", pb.seq.Name)
+}
+
+// Interrupt stops the sequence when something else applies a scene
+// Pass it to TransitionEngine.OnApply.
+func (p *Player) Interrupt(data *storage.SceneData) {
+	p.mu.Lock()
+	pb := p.current
+	if pb == nil || pb.applying == data {
+		p.mu.Unlock()
+		return
+	}
+	pb.interrupted = true
+	p.mu.Unlock()
+
+	pb.signal()
+}
+
+// Owns reports whether a scene being applied is a keyframe of the playing sequence
+func (p *Player) Owns(data *storage.SceneData) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current != nil && p.current.applying == data
+}
+
+// Status reports the current playback state and progress
+func (p *Player) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pb := p.current
+	if pb == nil {
+		return Status{State: StateStopped}
+	}
+
+	elapsed := pb.offset
+	if !pb.paused {
+		elapsed += p.clock.Now().Sub(pb.segStarted)
+	}
+	if end := pb.segBase + pb.segLength; elapsed > end {
+		elapsed = end
+	}
+
+	duration := pb.seq.Duration()
+	progress := 1.0
+	if duration > 0 {
+		progress = float64(elapsed) / float64(duration)
+	}
+
+	state := StatePlaying
+	if pb.paused {
+		state = StatePaused
+	}
+
+	return Status{
+		State:      state,
+		SequenceID: pb.seq.ID,
+		Sequence:   pb.seq.Name,
+		Loop:       pb.loop,
+		Keyframe:   pb.index + 1,
+		Keyframes:  len(pb.seq.Keyframes),
+		Phase:      pb.phase,
+		Iteration:  pb.iteration + 1,
+		Elapsed:    int(elapsed / time.Millisecond),
+		Duration:   int(duration / time.Millisecond),
+		Progress:   progress,
+	}
+}
+
+// signal wakes the playback goroutine without blocking
+func (pb *playback) signal() {
+	select {
+	case pb.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run plays the keyframes until the sequence ends or is stopped
+func (p *Player) run(pb *playback) {
+	defer close(pb.done)
+	defer p.finished(pb)
+
+	for iteration := 0; ; iteration++ {
+		var base time.Duration
+		for i, kf := range pb.seq.Keyframes {
+			p.mu.Lock()
+			pb.index = i
+			pb.iteration = iteration
+			p.mu.Unlock()
+
+			if !p.segment(pb, "fade", base, kf) {
+				return
+			}
+			base += kf.FadeDuration()
+
+			if !p.segment(pb, "hold", base, kf) {
+				return
+			}
+			base += kf.HoldDuration()
+		}
+
+		if !pb.loop {
+			log.Printf("Sequences: Finished %q", pb.seq.Name)
+			return
+		}
+	}
+}
+
+// segment fades to or holds a keyframe, handling pause and resume
+// It returns false when playback should end.
+func (p *Player) segment(pb *playback, phase string, base time.Duration, kf storage.Keyframe) bool {
+	length := kf.FadeDuration()
+	if phase == "hold" {
+		length = kf.HoldDuration()
+	}
+	remaining := length
+
+	for {
+		now := p.clock.Now()
+		p.mu.Lock()
+		pb.phase = phase
+		pb.segBase = base
+		pb.segLength = length
+		pb.offset = base + length - remaining
+		pb.segStarted = now
+		p.mu.Unlock()
+
+		// Fades finish when the transition does, holds after the remaining time
+		var finished <-chan struct{}
+		var timer <-chan time.Time
+		if phase == "fade" {
+			if !p.apply(pb, kf, remaining) {
+				return false
+			}
+			finished = p.engine.Done()
+		} else {
+			timer = p.clock.After(remaining)
+		}
+
+	wait:
+		for {
+			select {
+			case <-finished:
+				return true
+			case <-timer:
+				return true
+			case <-pb.stop:
+				if phase == "fade" {
+					p.engine.Stop()
+				}
+				return false
+			case <-pb.wake:
+				interrupted, pause := p.requests(pb)
+				if interrupted {
+					log.Printf("Sequences: %q interrupted by a scene recall", pb.seq.Name)
+					return false
+				}
+				if !pause {
+					p.acknowledge(pb)
+					continue
+				}
+
+				if phase == "fade" {
+					p.engine.Stop()
+				}
+				remaining -= p.clock.Now().Sub(now)
+				if remaining < 0 {
+					remaining = 0
+				}
+				if !p.paused(pb, base+length-remaining) {
+					return false
+				}
+				break wait
+			}
+		}
+	}
+}
+
+// apply starts the transition to a keyframe, marking it as the player's own
+func (p *Player) apply(pb *playback, kf storage.Keyframe, d time.Duration) bool {
+	p.mu.Lock()
+	pb.applying = kf.Devices
+	p.mu.Unlock()
+
+	err := p.engine.Apply(kf.Devices, lights.Transition{Duration: d, Easing: kf.Easing})
+
+	p.mu.Lock()
+	pb.applying = nil
+	p.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Sequences: %q keyframe %d failed: %v", pb.seq.Name, pb.index+1, err)
+		return false
+	}
+	return true
+}
+
+// paused waits while the sequence is paused at the given pass time
+// It returns false when playback should end instead of resuming.
+func (p *Player) paused(pb *playback, offset time.Duration) bool {
+	p.mu.Lock()
+	pb.paused = true
+	pb.offset = offset
+	p.mu.Unlock()
+	p.acknowledge(pb)
+	log.Printf("Sequences: Paused %q", pb.seq.Name)
+
+	for {
+		select {
+		case <-pb.stop:
+			return false
+		case <-pb.wake:
+			interrupted, pause := p.requests(pb)
+			if interrupted {
+				return false
+			}
+			if pause {
+				p.acknowledge(pb)
+				continue
+			}
+
+			p.mu.Lock()
+			pb.paused = false
+			p.mu.Unlock()
+			p.acknowledge(pb)
+			log.Printf("Sequences: Resumed %q", pb.seq.Name)
+			return true
+		}
+	}
+}
+
+// requests returns the pending interrupt and pause requests
+func (p *Player) requests(pb *playback) (interrupted, pause bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return pb.interrupted, pb.wantPaused
+}
+
+// acknowledge releases the callers waiting for a pause or resume to take effect
+func (p *Player) acknowledge(pb *playback) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ack := range pb.acks {
+		close(ack)
+	}
+	pb.acks = nil
+}
+
+// finished clears a playback that ended by itself
+func (p *Player) finished(pb *playback) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current == pb {
+		p.current = nil
+	}
+}
@@ -0,0 +1,343 @@
+package sequences
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// newTestPlayer creates a player on a fake clock whose transitions run at 10 frames per second
+func newTestPlayer(t *testing.T) (*Player, *lights.TransitionEngine, *clock.Fake, *mqtt.MockPublisher) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, err := videolight.NewVideoLight(1, mock, "test/vl1")
+	if err != nil {
+		t.Fatalf("NewVideoLight failed: %v", err)
+	}
+	vl2, err := videolight.NewVideoLight(2, mock, "test/vl2")
+	if err != nil {
+		t.Fatalf("NewVideoLight failed: %v", err)
+	}
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	engine := lights.NewTransitionEngine(lights.NewRig(strip, bar, vl1, vl2), fake)
+	if err := engine.SetFrameRate(10); err != nil {
+		t.Fatalf("SetFrameRate failed: %v", err)
+	}
+
+	player := NewPlayer(engine, fake)
+	engine.OnApply(player.Interrupt)
+	t.Cleanup(player.Stop)
+	return player, engine, fake, mock
+}
+
+// newTestDatabase creates an initialized database in a temporary directory
+func newTestDatabase(t *testing.T) *storage.Database {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+	return db
+}
+
+// ramp returns a sequence that fades the strip up to red over a second, holds
+// for half a second and then switches it off
+func ramp() *storage.Sequence {
+	return &storage.Sequence{
+		ID:   1,
+		Name: "Ramp",
+		Keyframes: []storage.Keyframe{
+			{Devices: &storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 200}}, Fade: 1000, Hold: 500},
+			{Devices: &storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 0}}},
+		},
+	}
+}
+
+// step advances the fake clock by one transition frame once something is waiting for it
+func step(fake *clock.Fake) {
+	fake.BlockUntil(1)
+	fake.Advance(100 * time.Millisecond)
+}
+
+// waitState waits for the player to reach a state
+func waitState(t *testing.T, player *Player, want State) Status {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := player.Status()
+		if status.State == want {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected state %s, got %+v", want, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// lastRed returns the red value of the most recent LED strip message
+func lastRed(t *testing.T, mock *mqtt.MockPublisher) int {
+	t.Helper()
+
+	red := -1
+	for _, msg := range mock.GetMessages() {
+		if msg.Topic != "test/strip" {
+			continue
+		}
+		var decoded struct {
+			Data struct {
+				R int `json:"r"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(msg.Payload.([]byte), &decoded); err != nil {
+			t.Fatalf("Invalid strip payload: %v", err)
+		}
+		red = decoded.Data.R
+	}
+	return red
+}
+
+func TestPlayOnce(t *testing.T) {
+	player, _, fake, mock := newTestPlayer(t)
+
+	if err := player.Play(ramp(), false); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+	fake.BlockUntil(1)
+	status := player.Status()
+	if status.State != StatePlaying || status.Keyframe != 1 || status.Phase != "fade" {
+		t.Errorf("Unexpected status mid-fade: %+v", status)
+	}
+	if status.Elapsed != 500 || status.Duration != 1500 {
+		t.Errorf("Expected 500 of 1500ms, got %d of %d", status.Elapsed, status.Duration)
+	}
+
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+
+	// Holding at the top of the ramp
+	fake.BlockUntil(1)
+	if red := lastRed(t, mock); red != 200 {
+		t.Errorf("Expected red 200 after the fade, got %d", red)
+	}
+	if status := player.Status(); status.Phase != "hold" {
+		t.Errorf("Expected hold phase, got %+v", status)
+	}
+
+	fake.Advance(500 * time.Millisecond)
+	waitState(t, player, StateStopped)
+	if red := lastRed(t, mock); red != 0 {
+		t.Errorf("Expected the last keyframe to switch the strip off, got %d", red)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	player, _, fake, mock := newTestPlayer(t)
+
+	if err := player.Play(ramp(), false); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+	fake.BlockUntil(1)
+
+	if err := player.Pause(); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	status := player.Status()
+	if status.State != StatePaused || status.Elapsed != 500 {
+		t.Errorf("Expected paused at 500ms, got %+v", status)
+	}
+
+	// Nothing moves while paused
+	frozen := lastRed(t, mock)
+	count := mock.MessageCount()
+	fake.Advance(10 * time.Second)
+	if mock.MessageCount() != count {
+		t.Errorf("Expected no frames while paused, got %d more", mock.MessageCount()-count)
+	}
+	if status := player.Status(); status.Elapsed != 500 {
+		t.Errorf("Expected progress to stay at 500ms, got %d", status.Elapsed)
+	}
+
+	if err := player.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if status := player.Status(); status.State != StatePlaying {
+		t.Errorf("Expected playing after resume, got %+v", status)
+	}
+
+	// The rest of the fade takes the remaining half second, starting from where it froze
+	for i := 0; i < 5; i++ {
+		step(fake)
+	}
+	fake.BlockUntil(1)
+	if red := lastRed(t, mock); red != 200 || frozen <= 0 || frozen >= 200 {
+		t.Errorf("Expected fade to resume from %d and reach 200, got %d", frozen, red)
+	}
+
+	if err := player.TogglePause(); err != nil {
+		t.Fatalf("TogglePause failed: %v", err)
+	}
+	if status := player.Status(); status.State != StatePaused || status.Phase != "hold" {
+		t.Errorf("Expected paused during hold, got %+v", status)
+	}
+	if err := player.TogglePause(); err != nil {
+		t.Fatalf("TogglePause failed: %v", err)
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(500 * time.Millisecond)
+	waitState(t, player, StateStopped)
+
+	if err := player.Pause(); !errors.Is(err, ErrNotPlaying) {
+		t.Errorf("Expected ErrNotPlaying, got %v", err)
+	}
+}
+
+func TestLoop(t *testing.T) {
+	player, _, fake, _ := newTestPlayer(t)
+
+	seq := &storage.Sequence{
+		Name: "Blink",
+		Keyframes: []storage.Keyframe{
+			{Devices: &storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 255}}, Hold: 1000},
+			{Devices: &storage.SceneData{LEDStrip: &storage.LEDStripState{}}, Hold: 1000},
+		},
+	}
+	if err := player.Play(seq, true); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		fake.BlockUntil(1)
+		fake.Advance(time.Second)
+	}
+	fake.BlockUntil(1)
+
+	status := player.Status()
+	if status.State != StatePlaying || status.Iteration != 3 || status.Keyframe != 2 {
+		t.Errorf("Expected the second keyframe of the third pass, got %+v", status)
+	}
+
+	player.Stop()
+	if status := player.Status(); status.State != StateStopped {
+		t.Errorf("Expected stopped, got %+v", status)
+	}
+}
+
+func TestSceneRecallInterruptsSequence(t *testing.T) {
+	player, engine, fake, mock := newTestPlayer(t)
+
+	if err := player.Play(ramp(), false); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	step(fake)
+	fake.BlockUntil(1)
+
+	scene := &storage.SceneData{LEDStrip: &storage.LEDStripState{Blue: 100}}
+	if err := engine.Apply(scene, lights.Transition{}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	waitState(t, player, StateStopped)
+
+	// The sequence must not carry on over the recalled scene
+	count := mock.MessageCount()
+	fake.Advance(5 * time.Second)
+	if mock.MessageCount() != count {
+		t.Errorf("Expected no more frames after the scene recall, got %d more", mock.MessageCount()-count)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []*storage.Sequence{
+		{Name: "Empty"},
+		{Name: "Blank keyframe", Keyframes: []storage.Keyframe{{Devices: &storage.SceneData{}}}},
+		{Name: "Bad easing", Keyframes: []storage.Keyframe{{Devices: ramp().Keyframes[0].Devices, Easing: "bounce"}}},
+	}
+	for _, seq := range bad {
+		if err := Validate(seq); err == nil {
+			t.Errorf("%s: expected an error", seq.Name)
+		}
+	}
+	if err := Validate(ramp()); err != nil {
+		t.Errorf("Expected ramp to be valid, got %v", err)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	player, _, fake, _ := newTestPlayer(t)
+	db := newTestDatabase(t)
+
+	seq := ramp()
+	id, err := db.CreateSequence(*seq)
+	if err != nil {
+		t.Fatalf("CreateSequence failed: %v", err)
+	}
+	handler := NewCommandHandler(player, db)
+
+	tests := []struct {
+		name      string
+		payload   string
+		wantState State
+		wantError bool
+	}{
+		{"play by name", `{"action": "play", "sequence": "Ramp"}`, StatePlaying, false},
+		{"pause", `{"action": "pause"}`, StatePaused, false},
+		{"resume", `{"action": "resume"}`, StatePlaying, false},
+		{"toggle", `{"action": "toggle"}`, StatePaused, false},
+		{"stop", `{"action": "stop"}`, StateStopped, false},
+		{"play by ID with loop", `{"action": "play", "sequence": "` + strconv.Itoa(id) + `", "loop": true}`, StatePlaying, false},
+		{"unknown sequence", `{"action": "play", "sequence": "Nope"}`, StatePlaying, true},
+		{"unknown action", `{"action": "rewind"}`, StatePlaying, true},
+		{"invalid JSON", `{`, StatePlaying, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handler.Handle([]byte(tt.payload))
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Handle() error = %v, wantError %v", err, tt.wantError)
+			}
+			fake.BlockUntil(1)
+			if status := player.Status(); status.State != tt.wantState {
+				t.Errorf("Expected state %s, got %+v", tt.wantState, status)
+			}
+		})
+	}
+
+	if status := player.Status(); !status.Loop || status.SequenceID != id {
+		t.Errorf("Expected looping sequence %d, got %+v", id, status)
+	}
+}
@@ -0,0 +1,14 @@
+package sleeptimer
+
+import "errors"
+
+var (
+	// ErrNoTimer is returned when cancelling a sleep timer that isn't set
+	ErrNoTimer = errors.New("no sleep timer set")
+
+	// ErrUnknownTarget is returned for a target other than "all" or a light name
+	ErrUnknownTarget = errors.New("unknown sleep timer target")
+
+	// ErrInvalidTimer is returned for a timer that isn't positive or has a negative fade
+	ErrInvalidTimer = errors.New("invalid sleep timer")
+)
@@ -0,0 +1,382 @@
+package sleeptimer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// TargetAll is the target of a sleep timer that switches off every light
+const TargetAll = "all"
+
+// Targets lists the lights a sleep timer can switch off
+var Targets = []string{TargetAll, "ledStrip", "ledBar", "videoLight1", "videoLight2"}
+
+// DefaultFade is the fade used by the TUI and Stream Deck
+const DefaultFade = time.Minute
+
+// Presets are the timer lengths the TUI cycles through
+var Presets = []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, 90 * time.Minute}
+
+// Status describes a pending sleep timer
+type Status struct {
+	Target    string    `json:"target"`
+	Deadline  time.Time `json:"deadline"`
+	Remaining int       `json:"remaining"` // milliseconds until the lights are off
+	Duration  int       `json:"duration"`  // milliseconds from setting the timer to the deadline
+	Fade      int       `json:"fade"`      // milliseconds
+	Fading    bool      `json:"fading"`
+}
+
+// Timers switches lights off when their sleep timers run out
+//
+// Each target has at most one timer. With a fade, the lights crossfade to off
+// over the last part of the countdown through the transition engine, so a
+// scene recall takes over from the fade; the lights are still switched off at
+// the deadline. Cancelling a timer mid-fade puts the lights back as they were
+// when the fade began, unless something else has changed them since. Timers
+// are saved in the store and picked up again by Start after a restart.
+type Timers struct {
+	engine *lights.TransitionEngine
+	store  storage.SleepTimerStore
+	clock  clock.Clock
+
+	mu       sync.Mutex
+	timers   map[string]*timer
+	applying map[*storage.SceneData]bool
+}
+
+// timer is one running countdown
+// The fade fields are only accessed with Timers.mu held.
+type timer struct {
+	storage.SleepTimer
+	stop chan struct{}
+	done chan struct{}
+
+	fading   bool
+	before   *storage.SceneData // the lights when the fade began
+	fadeDone <-chan struct{}    // closed when the fade transition ends or is replaced
+}
+
+// NewTimers creates the sleep timers for the lights of a transition engine
+func NewTimers(engine *lights.TransitionEngine, store storage.SleepTimerStore, clk clock.Clock) *Timers {
+	return &Timers{
+		engine:   engine,
+		store:    store,
+		clock:    clk,
+		timers:   make(map[string]*timer),
+		applying: make(map[*storage.SceneData]bool),
+	}
+}
+
+// Start resumes the timers saved before a restart
+// Timers whose deadline passed while stopped switch their lights off straight away.
+func (t *Timers) Start() error {
+	saved, err := t.store.ListSleepTimers()
+	if err != nil {
+		return fmt.Errorf("failed to load sleep timers: %w", err)
+	}
+
+	for _, st := range saved {
+		if _, err := selection(st.Target); err != nil {
+			log.Printf("Sleep: Dropping timer for unknown target %q", st.Target)
+			if err := t.store.DeleteSleepTimer(st.Target); err != nil {
+				log.Printf("Sleep: %v", err)
+			}
+			continue
+		}
+		log.Printf("Sleep: Resuming timer for %s (off at %s)", st.Target, st.Deadline.Format("15:04:05"))
+		t.start(st)
+	}
+	return nil
+}
+
+// Stop ends every countdown without touching the lights or the saved timers
+func (t *Timers) Stop() {
+	t.mu.Lock()
+	running := t.timers
+	t.timers = make(map[string]*timer)
+	t.mu.Unlock()
+
+	for _, tm := range running {
+		close(tm.stop)
+		<-tm.done
+	}
+}
+
+// Set starts a timer that switches a target off after d, fading over the last fade of it
+// A fade longer than d starts straight away. Any existing timer for the target is cancelled.
+func (t *Timers) Set(target string, d, fade time.Duration) (Status, error) {
+	if _, err := selection(target); err != nil {
+		return Status{}, err
+	}
+	if d <= 0 {
+		return Status{}, fmt.Errorf("%w: duration must be positive", ErrInvalidTimer)
+	}
+	if fade < 0 {
+		return Status{}, fmt.Errorf("%w: fade can't be negative", ErrInvalidTimer)
+	}
+	if fade > d {
+		fade = d
+	}
+
+	if err := t.Cancel(target); err != nil && !errors.Is(err, ErrNoTimer) {
+		return Status{}, err
+	}
+
+	now := t.clock.Now()
+	st := storage.SleepTimer{
+		Target:   target,
+		Started:  now,
+		Deadline: now.Add(d),
+		Fade:     int(fade / time.Millisecond),
+	}
+	if err := t.store.SaveSleepTimer(st); err != nil {
+		return Status{}, err
+	}
+
+	log.Printf("Sleep: %s off in %s (fade %s)", target, d, fade)
+	tm := t.start(st)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status(tm, now), nil
+}
+
+// Cancel stops the timer for a target, undoing its fade if one has begun
+func (t *Timers) Cancel(target string) error {
+	t.mu.Lock()
+	tm := t.timers[target]
+	delete(t.timers, target)
+	t.mu.Unlock()
+
+	if tm == nil {
+		return ErrNoTimer
+	}
+
+	close(tm.stop)
+	<-tm.done
+
+	t.mu.Lock()
+	before, fadeDone := tm.before, tm.fadeDone
+	t.mu.Unlock()
+
+	if before != nil {
+		select {
+		case <-fadeDone:
+			// The fade finished or something else took over the lights
+		default:
+			if err := t.apply(before); err != nil {
+				log.Printf("Sleep: Failed to restore %s: %v", target, err)
+			}
+		}
+	}
+
+	log.Printf("Sleep: Cancelled timer for %s", target)
+	return t.store.DeleteSleepTimer(target)
+}
+
+// Get returns the timer for a target, if one is set
+func (t *Timers) Get(target string) (Status, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tm, ok := t.timers[target]
+	if !ok {
+		return Status{}, false
+	}
+	return t.status(tm, t.clock.Now()), true
+}
+
+// List returns every pending timer, soonest first
+func (t *Timers) List() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	list := make([]Status, 0, len(t.timers))
+	for _, tm := range t.timers {
+		list = append(list, t.status(tm, now))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Deadline.Equal(list[j].Deadline) {
+			return list[i].Deadline.Before(list[j].Deadline)
+		}
+		return list[i].Target < list[j].Target
+	})
+	return list
+}
+
+// Owns reports whether a scene being applied is a sleep timer fading or switching off its lights
+func (t *Timers) Owns(data *storage.SceneData) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.applying[data]
+}
+
+// NextPreset returns the first preset longer than the remaining time, or 0
+// once the presets are used up, so repeated presses step through them and then cancel
+func NextPreset(remaining time.Duration) time.Duration {
+	for _, preset := range Presets {
+		if preset > remaining {
+			return preset
+		}
+	}
+	return 0
+}
+
+// selection returns the lights a target switches off
+func selection(target string) (lights.Selection, error) {
+	if target == TargetAll {
+		return lights.SelectAll(), nil
+	}
+	for _, name := range Targets {
+		if name == target {
+			return lights.ParseSelection([]string{target})
+		}
+	}
+	return lights.Selection{}, fmt.Errorf("%w: %q", ErrUnknownTarget, target)
+}
+
+// status describes a timer; the caller holds t.mu
+func (t *Timers) status(tm *timer, now time.Time) Status {
+	remaining := tm.Deadline.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Status{
+		Target:    tm.Target,
+		Deadline:  tm.Deadline,
+		Remaining: int(remaining / time.Millisecond),
+		Duration:  int(tm.Deadline.Sub(tm.Started) / time.Millisecond),
+		Fade:      tm.Fade,
+		Fading:    tm.fading,
+	}
+}
+
+// start registers a timer and runs its countdown
+func (t *Timers) start(st storage.SleepTimer) *timer {
+	tm := &timer{
+		SleepTimer: st,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	t.mu.Lock()
+	t.timers[st.Target] = tm
+	t.mu.Unlock()
+
+	go t.run(tm)
+	return tm
+}
+
+// run waits for the fade to begin, fades, then switches the lights off at the deadline
+func (t *Timers) run(tm *timer) {
+	defer close(tm.done)
+
+	fade := time.Duration(tm.Fade) * time.Millisecond
+	if !t.waitUntil(tm, tm.Deadline.Add(-fade)) {
+		return
+	}
+
+	if remaining := tm.Deadline.Sub(t.clock.Now()); fade > 0 && remaining > 0 {
+		t.fadeOut(tm, remaining)
+		if !t.waitUntil(tm, tm.Deadline) {
+			return
+		}
+	}
+
+	t.expire(tm)
+}
+
+// waitUntil blocks until the given time, returning false if the timer is stopped first
+func (t *Timers) waitUntil(tm *timer, at time.Time) bool {
+	select {
+	case <-tm.stop:
+		return false
+	case <-t.clock.After(at.Sub(t.clock.Now())):
+		return true
+	}
+}
+
+// fadeOut starts crossfading the timer's lights to off over d
+func (t *Timers) fadeOut(tm *timer, d time.Duration) {
+	sel, _ := selection(tm.Target)
+	rig := t.engine.Rig()
+	before := rig.Capture(sel)
+	off := rig.Off(sel)
+
+	t.mu.Lock()
+	t.applying[off] = true
+	t.mu.Unlock()
+
+	err := t.engine.Apply(off, lights.Transition{Duration: d})
+	done := t.engine.Done()
+
+	t.mu.Lock()
+	delete(t.applying, off)
+	tm.fading = true
+	if err == nil {
+		tm.before = before
+		tm.fadeDone = done
+	}
+	t.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Sleep: Failed to fade %s: %v", tm.Target, err)
+		return
+	}
+	log.Printf("Sleep: Fading %s over %s", tm.Target, d)
+}
+
+// expire switches the timer's lights off and forgets the timer
+func (t *Timers) expire(tm *timer) {
+	// Finish with the fade first, so its last frame doesn't race the capture below
+	t.mu.Lock()
+	fadeDone := tm.fadeDone
+	t.mu.Unlock()
+	if fadeDone != nil {
+		select {
+		case <-fadeDone:
+		default:
+			t.engine.Stop()
+		}
+	}
+
+	sel, _ := selection(tm.Target)
+	if err := t.apply(t.engine.Rig().Off(sel)); err != nil {
+		log.Printf("Sleep: Failed to switch off %s: %v", tm.Target, err)
+	}
+
+	t.mu.Lock()
+	if t.timers[tm.Target] == tm {
+		delete(t.timers, tm.Target)
+	}
+	t.mu.Unlock()
+
+	if err := t.store.DeleteSleepTimer(tm.Target); err != nil {
+		log.Printf("Sleep: %v", err)
+	}
+	log.Printf("Sleep: %s off", tm.Target)
+}
+
+// apply sets the lights straight away, marking the scene as the timers' own
+func (t *Timers) apply(data *storage.SceneData) error {
+	t.mu.Lock()
+	t.applying[data] = true
+	t.mu.Unlock()
+
+	err := t.engine.Apply(data, lights.Transition{})
+
+	t.mu.Lock()
+	delete(t.applying, data)
+	t.mu.Unlock()
+	return err
+}
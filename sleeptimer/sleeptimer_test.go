@@ -0,0 +1,282 @@
+package sleeptimer
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+var start = time.Date(2026, 3, 2, 22, 0, 0, 0, time.UTC)
+
+// newTestTimers creates sleep timers on a fake clock with mock lights, the LED strip and
+// first video light switched on
+func newTestTimers(t *testing.T) (*Timers, *lights.TransitionEngine, *clock.Fake, *storage.Database) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	strip := ledstrip.NewLEDStrip(mock, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, mock, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, mock, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, mock, "test/vl2")
+	strip.SetColor(200, 100, 50)
+	vl1.TurnOn(80)
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	fake := clock.NewFake(start)
+	engine := lights.NewTransitionEngine(lights.NewRig(strip, bar, vl1, vl2), fake)
+	timers := NewTimers(engine, db, fake)
+	t.Cleanup(timers.Stop)
+	return timers, engine, fake, db
+}
+
+// waitFor polls until cond is true, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSetValidation(t *testing.T) {
+	timers, _, _, _ := newTestTimers(t)
+
+	tests := []struct {
+		name   string
+		target string
+		d      time.Duration
+		fade   time.Duration
+		want   error
+	}{
+		{"unknown target", "ledBar.section1", time.Minute, 0, ErrUnknownTarget},
+		{"zero duration", TargetAll, 0, 0, ErrInvalidTimer},
+		{"negative fade", TargetAll, time.Minute, -time.Second, ErrInvalidTimer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := timers.Set(tt.target, tt.d, tt.fade)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Set() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if err := timers.Cancel("ledStrip"); !errors.Is(err, ErrNoTimer) {
+		t.Errorf("Cancel() error = %v, want %v", err, ErrNoTimer)
+	}
+	if len(timers.List()) != 0 {
+		t.Error("Expected no timers after failed sets")
+	}
+}
+
+func TestTimerSwitchesOff(t *testing.T) {
+	timers, engine, fake, db := newTestTimers(t)
+	rig := engine.Rig()
+
+	status, err := timers.Set("ledStrip", 10*time.Minute, 0)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if status.Remaining != 600000 || status.Duration != 600000 || status.Fading {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(4 * time.Minute)
+	if got, ok := timers.Get("ledStrip"); !ok || got.Remaining != 360000 {
+		t.Errorf("Get() = %+v, %v, want 6 minutes remaining", got, ok)
+	}
+	if r, _, _ := rig.Strip.GetColor(); r != 200 {
+		t.Error("Strip switched off early")
+	}
+
+	fake.Advance(6 * time.Minute)
+	waitFor(t, "the timer to expire", func() bool { return len(timers.List()) == 0 })
+
+	if r, g, b := rig.Strip.GetColor(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("Strip = %d,%d,%d, want off", r, g, b)
+	}
+	if !rig.VideoLight1.IsOn() {
+		t.Error("Video light 1 isn't part of the timer but was switched off")
+	}
+	if saved, _ := db.ListSleepTimers(); len(saved) != 0 {
+		t.Errorf("Expired timer still saved: %+v", saved)
+	}
+}
+
+func TestTimerFades(t *testing.T) {
+	timers, engine, fake, _ := newTestTimers(t)
+	rig := engine.Rig()
+
+	var owned []bool
+	engine.OnApply(func(data *storage.SceneData) { owned = append(owned, timers.Owns(data)) })
+
+	if _, err := timers.Set(TargetAll, 2*time.Minute, time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	waitFor(t, "the fade to start", func() bool {
+		status, _ := timers.Get(TargetAll)
+		return status.Fading
+	})
+
+	// Halfway through the fade the strip is about half as bright
+	for i := 0; i < 300; i++ {
+		fake.BlockUntil(2)
+		fake.Advance(100 * time.Millisecond)
+	}
+	if r, _, _ := rig.Strip.GetColor(); r < 90 || r > 110 {
+		t.Errorf("Strip red = %d halfway through the fade, want about 100", r)
+	}
+
+	fake.BlockUntil(2)
+	fake.Advance(30 * time.Second)
+	waitFor(t, "the timer to expire", func() bool { return len(timers.List()) == 0 })
+
+	if r, _, _ := rig.Strip.GetColor(); r != 0 {
+		t.Errorf("Strip red = %d, want off", r)
+	}
+	if rig.VideoLight1.IsOn() {
+		t.Error("Video light 1 still on")
+	}
+	if len(owned) != 2 || !owned[0] || !owned[1] {
+		t.Errorf("Expected the fade and switch off to be owned by the timers, got %v", owned)
+	}
+}
+
+func TestCancelRestoresFade(t *testing.T) {
+	timers, engine, fake, db := newTestTimers(t)
+	rig := engine.Rig()
+
+	if _, err := timers.Set("ledStrip", 2*time.Minute, 5*time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// The fade is longer than the timer, so it starts straight away
+	waitFor(t, "the fade to start", func() bool {
+		status, _ := timers.Get("ledStrip")
+		return status.Fading
+	})
+	for i := 0; i < 100; i++ {
+		fake.BlockUntil(2)
+		fake.Advance(100 * time.Millisecond)
+	}
+	if r, _, _ := rig.Strip.GetColor(); r >= 200 {
+		t.Fatalf("Strip red = %d, expected it to be fading", r)
+	}
+
+	if err := timers.Cancel("ledStrip"); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if r, g, b := rig.Strip.GetColor(); r != 200 || g != 100 || b != 50 {
+		t.Errorf("Strip = %d,%d,%d after cancelling, want it restored", r, g, b)
+	}
+	if _, ok := timers.Get("ledStrip"); ok {
+		t.Error("Timer still set after cancelling")
+	}
+	if saved, _ := db.ListSleepTimers(); len(saved) != 0 {
+		t.Errorf("Cancelled timer still saved: %+v", saved)
+	}
+}
+
+func TestCancelAfterSceneRecall(t *testing.T) {
+	timers, engine, _, _ := newTestTimers(t)
+	rig := engine.Rig()
+
+	timers.Set("ledStrip", time.Minute, time.Minute)
+	waitFor(t, "the fade to start", func() bool {
+		status, _ := timers.Get("ledStrip")
+		return status.Fading
+	})
+
+	// A scene recall takes over from the fade, and cancelling leaves it alone
+	engine.Apply(&storage.SceneData{LEDStrip: &storage.LEDStripState{Red: 10, Green: 20, Blue: 30}}, lights.Transition{})
+	if err := timers.Cancel("ledStrip"); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if r, g, b := rig.Strip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Strip = %d,%d,%d, want the recalled scene", r, g, b)
+	}
+}
+
+func TestTimersSurviveRestart(t *testing.T) {
+	timers, engine, fake, db := newTestTimers(t)
+	rig := engine.Rig()
+
+	timers.Set("videoLight1", 10*time.Minute, 0)
+	timers.Set("ledStrip", 5*time.Minute, 0)
+	timers.Stop()
+
+	// Restart after the strip's deadline but before the video light's
+	fake.Advance(6 * time.Minute)
+	restarted := NewTimers(engine, db, fake)
+	defer restarted.Stop()
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	waitFor(t, "the missed timer to expire", func() bool { return len(restarted.List()) == 1 })
+	if r, _, _ := rig.Strip.GetColor(); r != 0 {
+		t.Error("Strip not switched off after missing its deadline")
+	}
+
+	status, ok := restarted.Get("videoLight1")
+	if !ok || status.Remaining != 240000 || status.Duration != 600000 {
+		t.Fatalf("Get() = %+v, %v, want 4 of 10 minutes remaining", status, ok)
+	}
+	if !rig.VideoLight1.IsOn() {
+		t.Fatal("Video light 1 switched off early")
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(4 * time.Minute)
+	waitFor(t, "the resumed timer to expire", func() bool { return len(restarted.List()) == 0 })
+	if rig.VideoLight1.IsOn() {
+		t.Error("Video light 1 still on")
+	}
+}
+
+func TestNextPreset(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      time.Duration
+	}{
+		{0, 15 * time.Minute},
+		{10 * time.Minute, 15 * time.Minute},
+		{15 * time.Minute, 30 * time.Minute},
+		{59 * time.Minute, time.Hour},
+		{90 * time.Minute, 0},
+	}
+
+	for _, tt := range tests {
+		if got := NextPreset(tt.remaining); got != tt.want {
+			t.Errorf("NextPreset(%s) = %s, want %s", tt.remaining, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// LoadCircadian returns the saved circadian settings (returns nil if none have been saved)
+func (d *Database) LoadCircadian() (*CircadianSettings, error) {
+	var settings CircadianSettings
+	var curve string
+	err := d.db.QueryRow("SELECT led_strip, led_bar, curve FROM circadian WHERE id = 0").
+		Scan(&settings.LEDStrip, &settings.LEDBar, &curve)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load circadian settings: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(curve), &settings.Curve); err != nil {
+		return nil, fmt.Errorf("failed to decode circadian curve: %w", err)
+	}
+	return &settings, nil
+}
+
+// SaveCircadian replaces the saved circadian settings
+func (d *Database) SaveCircadian(settings CircadianSettings) error {
+	curve, err := json.Marshal(settings.Curve)
+	if err != nil {
+		return fmt.Errorf("failed to encode circadian curve: %w", err)
+	}
+
+	_, err = d.db.Exec(
+		"INSERT OR REPLACE INTO circadian (id, led_strip, led_bar, curve) VALUES (0, ?, ?, ?)",
+		settings.LEDStrip, settings.LEDBar, string(curve),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save circadian settings: %w", err)
+	}
+
+	log.Printf("Storage: Circadian settings saved (strip=%v, bar=%v, %d curve points)", settings.LEDStrip, settings.LEDBar, len(settings.Curve))
+	return nil
+}
@@ -0,0 +1,40 @@
+package storage
+
+import "testing"
+
+func TestCircadianSettings(t *testing.T) {
+	db := newTestDatabase(t)
+
+	settings, err := db.LoadCircadian()
+	if err != nil {
+		t.Fatalf("LoadCircadian failed: %v", err)
+	}
+	if settings != nil {
+		t.Fatalf("Expected no settings before the first save, got %+v", settings)
+	}
+
+	want := CircadianSettings{
+		LEDBar: true,
+		Curve: []CurvePoint{
+			{Time: "07:00", Kelvin: 3000, Brightness: 40},
+			{Time: "13:00", Kelvin: 6000, Brightness: 100},
+		},
+	}
+	if err := db.SaveCircadian(want); err != nil {
+		t.Fatalf("SaveCircadian failed: %v", err)
+	}
+
+	want.LEDStrip = true
+	want.Curve = want.Curve[1:]
+	if err := db.SaveCircadian(want); err != nil {
+		t.Fatalf("SaveCircadian failed: %v", err)
+	}
+
+	got, err := db.LoadCircadian()
+	if err != nil || got == nil {
+		t.Fatalf("LoadCircadian() = %v, %v", got, err)
+	}
+	if !got.LEDStrip || !got.LEDBar || len(got.Curve) != 1 || got.Curve[0] != want.Curve[0] {
+		t.Errorf("Settings not restored: %+v", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	_ "modernc.org/sqlite" // SQLite driver
 )
@@ -60,25 +61,66 @@ func (d *Database) InitSchema() error {
 		}
 	}
 
-	// Ensure scene slots exist (needed for foreign key constraints)
-	if err := d.ensureSceneSlots(); err != nil {
-		return fmt.Errorf("failed to ensure scene slots: %w", err)
+	// Bring older scene tables up to date with the scene library
+	if err := d.migrateScenes(); err != nil {
+		return fmt.Errorf("failed to migrate scenes: %w", err)
+	}
+
+	if _, err := d.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
 	}
 
 	log.Println("Storage: Schema initialized successfully")
 	return nil
 }
 
-// ensureSceneSlots ensures the 4 scene slots exist in the scenes table
-func (d *Database) ensureSceneSlots() error {
+// migrateScenes upgrades the scenes table from the original 4 fixed slots to the scene library
+func (d *Database) migrateScenes() error {
 	// Try to add columns if they don't exist (migration for existing DBs)
 	_, _ = d.db.Exec("ALTER TABLE scenes ADD COLUMN name TEXT NOT NULL DEFAULT ''")
 	_, _ = d.db.Exec("ALTER TABLE scenes ADD COLUMN bgcolor TEXT NOT NULL DEFAULT ''")
+	_, _ = d.db.Exec("ALTER TABLE scenes ADD COLUMN description TEXT NOT NULL DEFAULT ''")
+	_, _ = d.db.Exec("ALTER TABLE scenes ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0")
+	_, _ = d.db.Exec("ALTER TABLE scenes ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0")
+
+	// Scenes need names now; the old slots were often left unnamed, so name them
+	// after their button, unless a scene already has that name
+	_, err := d.db.Exec(`
+UPDATE scenes SET name = CASE
+    WHEN EXISTS (SELECT 1 FROM scenes AS other WHERE other.name = 'Scene ' || (scenes.id + 1))
+    THEN 'Scene ' || (id + 1) || ' (' || id || ')'
+    ELSE 'Scene ' || (id + 1)
+END
+WHERE name = ''`)
+	if err != nil {
+		return fmt.Errorf("failed to name scenes: %w", err)
+	}
+
+	// Scene names must be unique; disambiguate any duplicates from before the constraint existed
+	_, err = d.db.Exec(`
+UPDATE scenes SET name = name || ' (' || id || ')'
+WHERE name != '' AND id NOT IN (SELECT MIN(id) FROM scenes WHERE name != '' GROUP BY name)`)
+	if err != nil {
+		return fmt.Errorf("failed to deduplicate scene names: %w", err)
+	}
+	_, err = d.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_scenes_name ON scenes(name) WHERE name != ''")
+	if err != nil {
+		return fmt.Errorf("failed to create scene name index: %w", err)
+	}
+
+	// The old slots 0-3 become the initial shortcut assignments
+	_, err = d.db.Exec(
+		"INSERT OR IGNORE INTO scene_shortcuts (slot, scene_id) SELECT id, id FROM scenes WHERE id >= 0 AND id < ?",
+		SceneShortcutSlots,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to migrate scene slots: %w", err)
+	}
 
-	for i := 0; i < 4; i++ {
-		_, err := d.db.Exec("INSERT OR IGNORE INTO scenes (id, name) VALUES (?, ?)", i, "")
+	for i := 0; i < SceneShortcutSlots; i++ {
+		_, err := d.db.Exec("INSERT OR IGNORE INTO scene_shortcuts (slot, scene_id) VALUES (?, NULL)", i)
 		if err != nil {
-			return fmt.Errorf("failed to create scene slot %d: %w", i, err)
+			return fmt.Errorf("failed to create scene shortcut %d: %w", i, err)
 		}
 	}
 	return nil
@@ -261,11 +303,13 @@ func (d *Database) LoadLEDBarChannels(ledbarID int) ([]int, error) {
 	return channels, nil
 }
 
-// SceneExists checks if a scene slot has saved data
+// SceneExists checks if a scene has saved light state
 func (d *Database) SceneExists(sceneID int) (bool, error) {
 	var count int
-	err := d.db.QueryRow(
-		"SELECT COUNT(*) FROM scenes_ledstrips WHERE scene_id = ?",
+	err := d.db.QueryRow(`
+SELECT (SELECT COUNT(*) FROM scenes_ledstrips WHERE scene_id = ?1)
+     + (SELECT COUNT(*) FROM scenes_ledbars_leds WHERE scene_id = ?1)
+     + (SELECT COUNT(*) FROM scenes_videolights WHERE scene_id = ?1)`,
 		sceneID,
 	).Scan(&count)
 	if err != nil {
@@ -274,7 +318,7 @@ func (d *Database) SceneExists(sceneID int) (bool, error) {
 	return count > 0, nil
 }
 
-// GetSceneName returns the name of a scene slot
+// GetSceneName returns the name of a scene
 func (d *Database) GetSceneName(sceneID int) (string, error) {
 	var name string
 	err := d.db.QueryRow("SELECT name FROM scenes WHERE id = ?", sceneID).Scan(&name)
@@ -287,7 +331,7 @@ func (d *Database) GetSceneName(sceneID int) (string, error) {
 	return name, nil
 }
 
-// GetSceneBgColor returns the background color of a scene slot (hex string like "#FF5500")
+// GetSceneBgColor returns the background color of a scene (hex string like "#FF5500")
 func (d *Database) GetSceneBgColor(sceneID int) (string, error) {
 	var bgcolor string
 	err := d.db.QueryRow("SELECT bgcolor FROM scenes WHERE id = ?", sceneID).Scan(&bgcolor)
@@ -300,7 +344,7 @@ func (d *Database) GetSceneBgColor(sceneID int) (string, error) {
 	return bgcolor, nil
 }
 
-// SaveScene saves the current light state to a scene slot
+// SaveScene saves the current light state to a scene
 func (d *Database) SaveScene(sceneID int, data *SceneData) error {
 	tx, err := d.db.Begin()
 	if err != nil {
@@ -308,6 +352,34 @@ func (d *Database) SaveScene(sceneID int, data *SceneData) error {
 	}
 	defer tx.Rollback()
 
+	// Record the modification time, which also checks that the scene exists
+	result, err := tx.Exec("UPDATE scenes SET updated_at = ? WHERE id = ?", time.Now().Unix(), sceneID)
+	if err != nil {
+		return fmt.Errorf("failed to update scene: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSceneNotFound
+	}
+
+	if err := saveSceneData(tx, sceneID, data); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Scene %d saved successfully", sceneID)
+	return nil
+}
+
+// saveSceneData replaces the light state of a scene within a transaction
+// A nil or empty scene clears it.
+func saveSceneData(tx *sql.Tx, sceneID int, data *SceneData) error {
+	if data == nil {
+		data = &SceneData{}
+	}
+
 	// Delete existing scene data
 	if _, err := tx.Exec("DELETE FROM scenes_ledbars_leds WHERE scene_id = ?", sceneID); err != nil {
 		return fmt.Errorf("failed to delete old LED bar data: %w", err)
@@ -319,13 +391,15 @@ func (d *Database) SaveScene(sceneID int, data *SceneData) error {
 		return fmt.Errorf("failed to delete old video light data: %w", err)
 	}
 
-	// Insert LED strip state
-	_, err = tx.Exec(
-		"INSERT INTO scenes_ledstrips (scene_id, red, green, blue) VALUES (?, ?, ?, ?)",
-		sceneID, data.LEDStrip.Red, data.LEDStrip.Green, data.LEDStrip.Blue,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to save LED strip state: %w", err)
+	// Insert LED strip state (absent in partial scenes that don't touch the strip)
+	if data.LEDStrip != nil {
+		_, err := tx.Exec(
+			"INSERT INTO scenes_ledstrips (scene_id, red, green, blue) VALUES (?, ?, ?, ?)",
+			sceneID, data.LEDStrip.Red, data.LEDStrip.Green, data.LEDStrip.Blue,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save LED strip state: %w", err)
+		}
 	}
 
 	// Insert LED bar LEDs
@@ -356,15 +430,10 @@ func (d *Database) SaveScene(sceneID int, data *SceneData) error {
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	log.Printf("Storage: Scene %d saved successfully", sceneID)
 	return nil
 }
 
-// LoadScene loads scene data from a slot (returns nil if empty)
+// LoadScene loads scene data (returns nil if the scene has no saved state)
 func (d *Database) LoadScene(sceneID int) (*SceneData, error) {
 	// Check if scene exists
 	exists, err := d.SceneExists(sceneID)
@@ -378,13 +447,17 @@ func (d *Database) LoadScene(sceneID int) (*SceneData, error) {
 	data := &SceneData{}
 
 	// Load LED strip
+	var strip LEDStripState
 	err = d.db.QueryRow(
 		"SELECT red, green, blue FROM scenes_ledstrips WHERE scene_id = ?",
 		sceneID,
-	).Scan(&data.LEDStrip.Red, &data.LEDStrip.Green, &data.LEDStrip.Blue)
+	).Scan(&strip.Red, &strip.Green, &strip.Blue)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to load LED strip state: %w", err)
 	}
+	if err == nil {
+		data.LEDStrip = &strip
+	}
 
 	// Load LED bar LEDs
 	rows, err := d.db.Query(
@@ -434,7 +507,7 @@ func (d *Database) LoadScene(sceneID int) (*SceneData, error) {
 	return data, nil
 }
 
-// DeleteScene clears a scene slot
+// DeleteScene removes a scene and its light state from the library
 func (d *Database) DeleteScene(sceneID int) error {
 	tx, err := d.db.Begin()
 	if err != nil {
@@ -451,6 +524,15 @@ func (d *Database) DeleteScene(sceneID int) error {
 	if _, err := tx.Exec("DELETE FROM scenes_videolights WHERE scene_id = ?", sceneID); err != nil {
 		return fmt.Errorf("failed to delete video light data: %w", err)
 	}
+	if _, err := tx.Exec("DELETE FROM scenes_tags WHERE scene_id = ?", sceneID); err != nil {
+		return fmt.Errorf("failed to delete scene tags: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE scene_shortcuts SET scene_id = NULL WHERE scene_id = ?", sceneID); err != nil {
+		return fmt.Errorf("failed to clear scene shortcuts: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM scenes WHERE id = ?", sceneID); err != nil {
+		return fmt.Errorf("failed to delete scene: %w", err)
+	}
 
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
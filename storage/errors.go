@@ -0,0 +1,56 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrSceneNotFound is returned when a scene ID doesn't exist in the library
+	ErrSceneNotFound = errors.New("scene not found")
+
+	// ErrSceneNameRequired is returned when a scene is given an empty name
+	ErrSceneNameRequired = errors.New("scene name is required")
+
+	// ErrSceneNameTaken is returned when a scene name is already used by another scene
+	ErrSceneNameTaken = errors.New("scene name already in use")
+
+	// ErrInvalidShortcut is returned when a shortcut slot is out of range
+	ErrInvalidShortcut = errors.New("invalid scene shortcut slot")
+
+	// ErrSequenceNotFound is returned when a sequence ID doesn't exist
+	ErrSequenceNotFound = errors.New("sequence not found")
+
+	// ErrSequenceNameRequired is returned when a sequence is given an empty name
+	ErrSequenceNameRequired = errors.New("sequence name is required")
+
+	// ErrSequenceNameTaken is returned when a sequence name is already used by another sequence
+	ErrSequenceNameTaken = errors.New("sequence name already in use")
+
+	// ErrScheduleNotFound is returned when a schedule ID doesn't exist
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	// ErrScheduleNameRequired is returned when a schedule is given an empty name
+	ErrScheduleNameRequired = errors.New("schedule name is required")
+
+	// ErrScheduleNameTaken is returned when a schedule name is already used by another schedule
+	ErrScheduleNameTaken = errors.New("schedule name already in use")
+
+	// ErrRuleNotFound is returned when a rule ID doesn't exist
+	ErrRuleNotFound = errors.New("rule not found")
+
+	// ErrRuleNameRequired is returned when a rule is given an empty name
+	ErrRuleNameRequired = errors.New("rule name is required")
+
+	// ErrRuleNameTaken is returned when a rule name is already used by another rule
+	ErrRuleNameTaken = errors.New("rule name already in use")
+
+	// ErrWebhookNotFound is returned when a webhook ID doesn't exist
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrWebhookNameRequired is returned when a webhook is given an empty name
+	ErrWebhookNameRequired = errors.New("webhook name is required")
+
+	// ErrWebhookNameTaken is returned when a webhook name is already used by another webhook
+	ErrWebhookNameTaken = errors.New("webhook name already in use")
+
+	// ErrHistoryEntryNotFound is returned when a history entry ID doesn't exist
+	ErrHistoryEntryNotFound = errors.New("history entry not found")
+)
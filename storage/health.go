@@ -0,0 +1,38 @@
+package storage
+
+import "fmt"
+
+// SchemaVersion is the version of the schema InitSchema creates, recorded in
+// the database's user_version; bump it whenever the schema changes
+const SchemaVersion = 3
+
+// GetSchemaVersion returns the schema version recorded in the database
+// A database InitSchema hasn't run on yet reports 0.
+func (d *Database) GetSchemaVersion() (int, error) {
+	var version int
+	if err := d.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// CheckWritable returns an error if the database can't be written to
+// It takes the write lock by rewriting the schema version in a transaction
+// that is then rolled back, so nothing changes.
+func (d *Database) CheckWritable() error {
+	version, err := d.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+	return nil
+}
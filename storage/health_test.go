@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if version, err := db.GetSchemaVersion(); err != nil || version != 0 {
+		t.Errorf("GetSchemaVersion() before InitSchema = %d, %v; want 0", version, err)
+	}
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+	if version, err := db.GetSchemaVersion(); err != nil || version != SchemaVersion {
+		t.Errorf("GetSchemaVersion() = %d, %v; want %d", version, err, SchemaVersion)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	if err := db.CheckWritable(); err != nil {
+		t.Errorf("CheckWritable failed: %v", err)
+	}
+	if version, _ := db.GetSchemaVersion(); version != SchemaVersion {
+		t.Errorf("CheckWritable changed the schema version to %d", version)
+	}
+
+	readOnly, err := NewDatabase("file:" + path + "?mode=ro")
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer readOnly.Close()
+	if err := readOnly.CheckWritable(); err == nil {
+		t.Error("Expected a read-only database not to be writable")
+	}
+}
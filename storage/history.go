@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ListHistory returns every history entry, oldest first
+func (d *Database) ListHistory() ([]HistoryEntry, error) {
+	rows, err := d.db.Query("SELECT id, devices, undone, created_at FROM history ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]HistoryEntry, 0)
+	for rows.Next() {
+		var entry HistoryEntry
+		var devices string
+		var created int64
+		if err := rows.Scan(&entry.ID, &devices, &entry.Undone, &created); err != nil {
+			return nil, fmt.Errorf("failed to scan history entry: %w", err)
+		}
+		entry.Data = &SceneData{}
+		if err := json.Unmarshal([]byte(devices), entry.Data); err != nil {
+			return nil, fmt.Errorf("failed to decode history entry %d: %w", entry.ID, err)
+		}
+		entry.CreatedAt = time.UnixMilli(created)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating history: %w", err)
+	}
+	return entries, nil
+}
+
+// AddHistory records a state after the entries that haven't been undone,
+// dropping the undone ones and all but the newest limit entries
+func (d *Database) AddHistory(data *SceneData, limit int) (*HistoryEntry, error) {
+	devices, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode history entry: %w", err)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A new edit can't be redone past, so the undone entries go
+	if _, err := tx.Exec("DELETE FROM history WHERE undone = 1"); err != nil {
+		return nil, fmt.Errorf("failed to drop undone history: %w", err)
+	}
+
+	now := time.Now()
+	result, err := tx.Exec("INSERT INTO history (devices, undone, created_at) VALUES (?, 0, ?)", string(devices), now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to add history entry: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get new history entry ID: %w", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM history WHERE id NOT IN (SELECT id FROM history ORDER BY id DESC LIMIT ?)", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to trim history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &HistoryEntry{ID: int(id), Data: data, CreatedAt: time.UnixMilli(now.UnixMilli())}, nil
+}
+
+// SetHistoryUndone marks a history entry as undone or redone
+func (d *Database) SetHistoryUndone(entryID int, undone bool) error {
+	result, err := d.db.Exec("UPDATE history SET undone = ? WHERE id = ?", undone, entryID)
+	if err != nil {
+		return fmt.Errorf("failed to update history entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrHistoryEntryNotFound, entryID)
+	}
+	return nil
+}
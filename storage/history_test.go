@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func historyState(red int) *SceneData {
+	return &SceneData{
+		LEDStrip:    &LEDStripState{Red: red},
+		VideoLights: []VideoLightState{{ID: 0, On: true, Brightness: 50}},
+	}
+}
+
+func TestHistory(t *testing.T) {
+	db := newTestDatabase(t)
+
+	entries, err := db.ListHistory()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("ListHistory() on a new database = %v, %v", entries, err)
+	}
+
+	var ids []int
+	for red := 1; red <= 3; red++ {
+		entry, err := db.AddHistory(historyState(red), 10)
+		if err != nil {
+			t.Fatalf("AddHistory failed: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+
+	if err := db.SetHistoryUndone(ids[2], true); err != nil {
+		t.Fatalf("SetHistoryUndone failed: %v", err)
+	}
+	entries, _ = db.ListHistory()
+	if len(entries) != 3 || !entries[2].Undone || entries[1].Undone {
+		t.Fatalf("Unexpected history after undo: %+v", entries)
+	}
+	if entries[0].Data.LEDStrip.Red != 1 || len(entries[0].Data.VideoLights) != 1 || entries[0].Data.VideoLights[0].Brightness != 50 {
+		t.Errorf("Entry data not kept: %+v", entries[0].Data)
+	}
+
+	// A new edit drops the undone entry
+	if _, err := db.AddHistory(historyState(4), 10); err != nil {
+		t.Fatalf("AddHistory failed: %v", err)
+	}
+	entries, _ = db.ListHistory()
+	if len(entries) != 3 || entries[2].Data.LEDStrip.Red != 4 || entries[2].Undone {
+		t.Errorf("Unexpected history after a new edit: %+v", entries)
+	}
+
+	if err := db.SetHistoryUndone(ids[2], false); !errors.Is(err, ErrHistoryEntryNotFound) {
+		t.Errorf("Expected ErrHistoryEntryNotFound for a dropped entry, got %v", err)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	db := newTestDatabase(t)
+
+	for red := 1; red <= 5; red++ {
+		if _, err := db.AddHistory(historyState(red), 3); err != nil {
+			t.Fatalf("AddHistory failed: %v", err)
+		}
+	}
+
+	entries, err := db.ListHistory()
+	if err != nil {
+		t.Fatalf("ListHistory failed: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Data.LEDStrip.Red != 3 || entries[2].Data.LEDStrip.Red != 5 {
+		t.Errorf("Expected the newest 3 entries, got %+v", entries)
+	}
+}
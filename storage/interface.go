@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // StateStore defines the interface for persistent state storage
 type StateStore interface {
 	// SaveLEDStripState saves the RGB state for an LED strip
@@ -21,34 +26,213 @@ type StateStore interface {
 	LoadVideoLightState(id int) (on bool, brightness int, err error)
 }
 
+// SceneShortcutSlots is the number of Stream Deck buttons that can point at library scenes
+const SceneShortcutSlots = 4
+
 // SceneStore defines the interface for scene storage operations
 type SceneStore interface {
-	// SceneExists checks if a scene slot has saved data
+	// SceneExists checks if a scene has saved light state
 	SceneExists(sceneID int) (bool, error)
 
-	// GetSceneName returns the name of a scene slot
+	// GetSceneName returns the name of a scene
 	GetSceneName(sceneID int) (string, error)
 
-	// GetSceneBgColor returns the background color of a scene slot (hex string like "#FF5500")
+	// GetSceneBgColor returns the background color of a scene (hex string like "#FF5500")
 	GetSceneBgColor(sceneID int) (string, error)
 
-	// SaveScene saves the current light state to a scene slot
+	// SaveScene saves the current light state to a scene
 	SaveScene(sceneID int, data *SceneData) error
 
-	// LoadScene loads scene data from a slot (returns nil if empty)
+	// LoadScene loads scene data (returns nil if the scene has no saved state)
 	LoadScene(sceneID int) (*SceneData, error)
 
-	// DeleteScene clears a scene slot
+	// DeleteScene removes a scene and its light state from the library
 	DeleteScene(sceneID int) error
+
+	// ListScenes returns the metadata of every scene in the library, ordered by name
+	ListScenes() ([]SceneInfo, error)
+
+	// GetScene returns the metadata of a scene (returns nil if it doesn't exist)
+	GetScene(sceneID int) (*SceneInfo, error)
+
+	// FindSceneByName returns the metadata of the scene with the given name (returns nil if none)
+	FindSceneByName(name string) (*SceneInfo, error)
+
+	// CreateScene adds a new scene without light state and returns its ID
+	CreateScene(info SceneInfo) (int, error)
+
+	// CreateSceneWithData adds a new scene holding the given light state and returns its ID
+	CreateSceneWithData(info SceneInfo, data *SceneData) (int, error)
+
+	// UpdateScene updates the name, description, background color and tags of a scene
+	UpdateScene(info SceneInfo) error
+
+	// RenameScene changes the name of a scene
+	RenameScene(sceneID int, name string) error
+
+	// DuplicateScene copies a scene, including its light state, under a new name
+	DuplicateScene(sceneID int, name string) (int, error)
+
+	// GetSceneShortcut returns the scene assigned to a shortcut slot (ok is false if unassigned)
+	GetSceneShortcut(slot int) (sceneID int, ok bool, err error)
+
+	// SetSceneShortcut assigns a scene to a shortcut slot
+	SetSceneShortcut(slot int, sceneID int) error
+
+	// ClearSceneShortcut removes the scene assigned to a shortcut slot
+	ClearSceneShortcut(slot int) error
+
+	// ImportScenes writes the scenes of a document into the library, all or nothing
+	ImportScenes(doc *SceneDocument, policy ConflictPolicy) ([]ImportResult, error)
+}
+
+// SequenceStore defines the interface for keyframe sequence storage
+type SequenceStore interface {
+	// ListSequences returns every sequence, including keyframes, ordered by name
+	ListSequences() ([]Sequence, error)
+
+	// GetSequence returns a sequence and its keyframes (returns nil if it doesn't exist)
+	GetSequence(sequenceID int) (*Sequence, error)
+
+	// FindSequenceByName returns the sequence with the given name (returns nil if none)
+	FindSequenceByName(name string) (*Sequence, error)
+
+	// CreateSequence adds a sequence with its keyframes and returns its ID
+	CreateSequence(seq Sequence) (int, error)
+
+	// UpdateSequence replaces the name, description, loop flag and keyframes of a sequence
+	UpdateSequence(seq Sequence) error
+
+	// DeleteSequence removes a sequence and its keyframes
+	DeleteSequence(sequenceID int) error
+}
+
+// Sequence is an ordered list of keyframes that can be played once or on loop
+type Sequence struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Loop        bool       `json:"loop"`
+	Keyframes   []Keyframe `json:"keyframes"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// Duration returns how long one pass through the sequence takes
+func (s *Sequence) Duration() time.Duration {
+	var total time.Duration
+	for _, kf := range s.Keyframes {
+		total += kf.FadeDuration() + kf.HoldDuration()
+	}
+	return total
+}
+
+// Keyframe is a full or partial light state, faded to and then held
+type Keyframe struct {
+	Devices *SceneData `json:"devices"`
+	Fade    int        `json:"fade"` // milliseconds
+	Hold    int        `json:"hold"` // milliseconds
+	Easing  string     `json:"easing,omitempty"`
+}
+
+// FadeDuration returns the time taken to fade to the keyframe
+func (k Keyframe) FadeDuration() time.Duration {
+	return time.Duration(k.Fade) * time.Millisecond
+}
+
+// HoldDuration returns the time the keyframe is held once reached
+func (k Keyframe) HoldDuration() time.Duration {
+	return time.Duration(k.Hold) * time.Millisecond
+}
+
+// ScheduleStore defines the interface for scheduled action storage
+type ScheduleStore interface {
+	// ListSchedules returns every schedule ordered by name
+	ListSchedules() ([]Schedule, error)
+
+	// GetSchedule returns a schedule (returns nil if it doesn't exist)
+	GetSchedule(scheduleID int) (*Schedule, error)
+
+	// CreateSchedule adds a schedule and returns its ID
+	CreateSchedule(sched Schedule) (int, error)
+
+	// UpdateSchedule replaces everything about a schedule except when it last ran
+	UpdateSchedule(sched Schedule) error
+
+	// DeleteSchedule removes a schedule
+	DeleteSchedule(scheduleID int) error
+
+	// SetScheduleLastRun records when a schedule last ran
+	SetScheduleLastRun(scheduleID int, at time.Time) error
+}
+
+// Schedule runs an action at times given by a cron expression, by weekdays and
+// times of day, or relative to a sun event
+type Schedule struct {
+	ID      int             `json:"id"`
+	Name    string          `json:"name"`
+	Enabled bool            `json:"enabled"`
+	Cron    string          `json:"cron,omitempty"`   // five-field cron expression
+	Days    []string        `json:"days,omitempty"`   // weekday names, used with Times or Sun
+	Times   []string        `json:"times,omitempty"`  // local times of day as "HH:MM"
+	Sun     string          `json:"sun,omitempty"`    // dawn, sunrise, sunset or dusk
+	Offset  int             `json:"offset,omitempty"` // minutes after (or, if negative, before) Sun
+	Action  json.RawMessage `json:"action"`
+	CatchUp bool            `json:"catchUp"` // run once at startup if a time was missed
+	LastRun *time.Time      `json:"lastRun,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CircadianStore defines the interface for circadian mode settings storage
+type CircadianStore interface {
+	// LoadCircadian returns the saved settings (returns nil if none have been saved)
+	LoadCircadian() (*CircadianSettings, error)
+
+	// SaveCircadian replaces the saved settings
+	SaveCircadian(settings CircadianSettings) error
+}
+
+// CircadianSettings chooses which devices follow the circadian curve and the curve itself
+type CircadianSettings struct {
+	LEDStrip bool         `json:"ledStrip"`
+	LEDBar   bool         `json:"ledBar"`
+	Curve    []CurvePoint `json:"curve"`
+}
+
+// CurvePoint is the colour temperature and brightness wanted at a time of day
+type CurvePoint struct {
+	Time       string `json:"time"`       // local time of day as "HH:MM"
+	Kelvin     int    `json:"kelvin"`     // colour temperature
+	Brightness int    `json:"brightness"` // percent
 }
 
-// SceneData holds the complete state for a saved scene
+// SceneInfo holds the library metadata for a scene
+type SceneInfo struct {
+	ID          int
+	Name        string
+	Description string
+	BgColor     string
+	Tags        []string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SceneData holds the state for a saved scene
+// A scene may be partial: a nil LEDStrip, a subset of LED bar channels, or a subset of
+// video lights means the missing lights are left untouched when the scene is recalled
 type SceneData struct {
-	LEDStrip    LEDStripState
+	LEDStrip    *LEDStripState
 	LEDBarLEDs  []LEDBarLEDState
 	VideoLights []VideoLightState
 }
 
+// IsEmpty reports whether the scene contains no light state at all
+func (s *SceneData) IsEmpty() bool {
+	return s.LEDStrip == nil && len(s.LEDBarLEDs) == 0 && len(s.VideoLights) == 0
+}
+
 // LEDStripState holds the RGB state of an LED strip
 type LEDStripState struct {
 	Red   int
@@ -69,3 +253,161 @@ type VideoLightState struct {
 	On         bool
 	Brightness int
 }
+
+// SleepTimerStore defines the interface for sleep timer storage, so timers survive restarts
+type SleepTimerStore interface {
+	// ListSleepTimers returns every pending sleep timer ordered by deadline
+	ListSleepTimers() ([]SleepTimer, error)
+
+	// SaveSleepTimer adds a sleep timer, replacing any existing timer for the same target
+	SaveSleepTimer(timer SleepTimer) error
+
+	// DeleteSleepTimer removes the sleep timer for a target (no error if there isn't one)
+	DeleteSleepTimer(target string) error
+}
+
+// SleepTimer switches lights off at a deadline, optionally fading them out first
+type SleepTimer struct {
+	Target   string    `json:"target"`   // "all" or a light name such as "ledStrip"
+	Started  time.Time `json:"started"`  // when the timer was set
+	Deadline time.Time `json:"deadline"` // when the lights are off
+	Fade     int       `json:"fade"`     // milliseconds of fading before the deadline
+}
+
+// RuleStore defines the interface for event-condition-action rule storage
+type RuleStore interface {
+	// ListRules returns every rule ordered by name
+	ListRules() ([]Rule, error)
+
+	// GetRule returns a rule (returns nil if it doesn't exist)
+	GetRule(ruleID int) (*Rule, error)
+
+	// CreateRule adds a rule and returns its ID
+	CreateRule(rule Rule) (int, error)
+
+	// UpdateRule replaces everything about a rule except when it last fired
+	UpdateRule(rule Rule) error
+
+	// DeleteRule removes a rule
+	DeleteRule(ruleID int) error
+
+	// SetRuleLastFired records when a rule last fired
+	SetRuleLastFired(ruleID int, at time.Time) error
+}
+
+// Rule runs actions when its trigger fires and all of its conditions hold
+// The trigger, conditions and actions are stored as JSON and interpreted by the rules package.
+type Rule struct {
+	ID         int             `json:"id"`
+	Name       string          `json:"name"`
+	Enabled    bool            `json:"enabled"`
+	Trigger    json.RawMessage `json:"trigger"`
+	Conditions json.RawMessage `json:"conditions,omitempty"`
+	Actions    json.RawMessage `json:"actions"`
+	Cooldown   int             `json:"cooldown,omitempty"` // milliseconds before the rule may fire again
+	LastFired  *time.Time      `json:"lastFired,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OnAirStore defines the interface for on-air indicator storage, so the indicator survives restarts
+type OnAirStore interface {
+	// LoadOnAir returns the saved settings (returns nil if none have been saved)
+	LoadOnAir() (*OnAirSettings, error)
+
+	// SaveOnAir replaces the saved settings
+	SaveOnAir(settings OnAirSettings) error
+}
+
+// OnAirSettings chooses the lights the on-air indicator takes over and how it shows
+type OnAirSettings struct {
+	Active bool     `json:"active"` // whether the indicator is on
+	Lights []string `json:"lights"` // light names such as "ledStrip" or "ledBar.section1.rgbw"
+	Color  string   `json:"color"`  // "#rrggbb"
+	Pulse  int      `json:"pulse"`  // milliseconds per pulse, or 0 for a steady colour
+}
+
+// WebhookStore defines the interface for outbound webhook storage
+type WebhookStore interface {
+	// ListWebhooks returns every webhook ordered by name
+	ListWebhooks() ([]Webhook, error)
+
+	// GetWebhook returns a webhook (returns nil if it doesn't exist)
+	GetWebhook(webhookID int) (*Webhook, error)
+
+	// CreateWebhook adds a webhook and returns its ID
+	CreateWebhook(hook Webhook) (int, error)
+
+	// UpdateWebhook replaces a webhook
+	UpdateWebhook(hook Webhook) error
+
+	// DeleteWebhook removes a webhook and its delivery log
+	DeleteWebhook(webhookID int) error
+
+	// AddWebhookDelivery records an attempt to deliver to a webhook, keeping
+	// only the most recent WebhookDeliveryLogSize attempts per webhook
+	AddWebhookDelivery(delivery WebhookDelivery) error
+
+	// ListWebhookDeliveries returns a webhook's delivery attempts, newest first
+	ListWebhookDeliveries(webhookID int, limit int) ([]WebhookDelivery, error)
+}
+
+// WebhookDeliveryLogSize is how many delivery attempts are kept per webhook
+const WebhookDeliveryLogSize = 200
+
+// Webhook is a URL that is sent a signed JSON POST when something happens
+type Webhook struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret,omitempty"` // key for the HMAC-SHA256 signature; no signature if empty
+	Events  []string `json:"events"`           // events to send, or all of them if empty
+	Enabled bool     `json:"enabled"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebhookDelivery is one attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID        int       `json:"id"`
+	WebhookID int       `json:"webhookId"`
+	Delivery  string    `json:"delivery"` // the same for every attempt to deliver one event
+	Event     string    `json:"event"`
+	Attempt   int       `json:"attempt"`         // 1 for the first try
+	Status    int       `json:"status"`          // HTTP status, or 0 if there was no response
+	Error     string    `json:"error,omitempty"` // why the attempt failed
+	Duration  int       `json:"duration"`        // milliseconds
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// HistoryStore defines the interface for the undo history of light states
+type HistoryStore interface {
+	// ListHistory returns every history entry, oldest first
+	ListHistory() ([]HistoryEntry, error)
+
+	// AddHistory records a state after the entries that haven't been undone,
+	// dropping the undone ones and all but the newest limit entries
+	AddHistory(data *SceneData, limit int) (*HistoryEntry, error)
+
+	// SetHistoryUndone marks a history entry as undone or redone
+	SetHistoryUndone(entryID int, undone bool) error
+}
+
+// HistoryEntry is the state of every light after one edit
+type HistoryEntry struct {
+	ID        int        `json:"id"`
+	Data      *SceneData `json:"devices"`
+	Undone    bool       `json:"undone"` // undone entries can be redone until another edit is made
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// HealthStore defines the interface for checking on the database itself
+type HealthStore interface {
+	// GetSchemaVersion returns the schema version recorded in the database
+	GetSchemaVersion() (int, error)
+
+	// CheckWritable returns an error if the database can't be written to
+	CheckWritable() error
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// LoadOnAir returns the saved on-air indicator settings (returns nil if none have been saved)
+func (d *Database) LoadOnAir() (*OnAirSettings, error) {
+	var settings OnAirSettings
+	var lights string
+	err := d.db.QueryRow("SELECT active, lights, color, pulse FROM on_air WHERE id = 0").
+		Scan(&settings.Active, &lights, &settings.Color, &settings.Pulse)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load on-air settings: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(lights), &settings.Lights); err != nil {
+		return nil, fmt.Errorf("failed to decode on-air lights: %w", err)
+	}
+	return &settings, nil
+}
+
+// SaveOnAir replaces the saved on-air indicator settings
+func (d *Database) SaveOnAir(settings OnAirSettings) error {
+	if settings.Lights == nil {
+		settings.Lights = []string{}
+	}
+	lights, err := json.Marshal(settings.Lights)
+	if err != nil {
+		return fmt.Errorf("failed to encode on-air lights: %w", err)
+	}
+
+	_, err = d.db.Exec(
+		"INSERT OR REPLACE INTO on_air (id, active, lights, color, pulse) VALUES (0, ?, ?, ?, ?)",
+		settings.Active, string(lights), settings.Color, settings.Pulse,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save on-air settings: %w", err)
+	}
+
+	log.Printf("Storage: On-air settings saved (active=%v, lights=%v)", settings.Active, settings.Lights)
+	return nil
+}
@@ -0,0 +1,37 @@
+package storage
+
+import "testing"
+
+func TestOnAirSettings(t *testing.T) {
+	db := newTestDatabase(t)
+
+	settings, err := db.LoadOnAir()
+	if err != nil {
+		t.Fatalf("LoadOnAir failed: %v", err)
+	}
+	if settings != nil {
+		t.Fatalf("Expected no settings before the first save, got %+v", settings)
+	}
+
+	want := OnAirSettings{Lights: []string{"ledStrip"}, Color: "#ff0000"}
+	if err := db.SaveOnAir(want); err != nil {
+		t.Fatalf("SaveOnAir failed: %v", err)
+	}
+
+	want = OnAirSettings{Active: true, Lights: []string{"ledStrip", "ledBar.section1.rgbw"}, Color: "#ff8000", Pulse: 1500}
+	if err := db.SaveOnAir(want); err != nil {
+		t.Fatalf("SaveOnAir failed: %v", err)
+	}
+
+	got, err := db.LoadOnAir()
+	if err != nil || got == nil {
+		t.Fatalf("LoadOnAir() = %v, %v", got, err)
+	}
+	if !got.Active || len(got.Lights) != 2 || got.Lights[1] != "ledBar.section1.rgbw" || got.Color != want.Color || got.Pulse != want.Pulse {
+		t.Errorf("Settings not restored: %+v", got)
+	}
+
+	if err := db.SaveOnAir(OnAirSettings{Pulse: -1}); err == nil {
+		t.Error("Expected a negative pulse to be rejected")
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ruleColumns are the columns read by scanRule, in order
+const ruleColumns = `id, name, enabled, "trigger", conditions, actions, cooldown, last_fired, created_at, updated_at`
+
+// ListRules returns every rule ordered by name
+func (d *Database) ListRules() ([]Rule, error) {
+	rows, err := d.db.Query("SELECT " + ruleColumns + " FROM rules ORDER BY name COLLATE NOCASE, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]Rule, 0)
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetRule returns a rule (returns nil if it doesn't exist)
+func (d *Database) GetRule(ruleID int) (*Rule, error) {
+	row := d.db.QueryRow("SELECT "+ruleColumns+" FROM rules WHERE id = ?", ruleID)
+	rule, err := scanRule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// CreateRule adds a rule and returns its ID
+func (d *Database) CreateRule(rule Rule) (int, error) {
+	if err := checkRule(d.db, rule, -1); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	result, err := d.db.Exec(
+		`INSERT INTO rules (name, enabled, "trigger", conditions, actions, cooldown, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.Name, rule.Enabled, string(rule.Trigger), string(rule.Conditions), string(rule.Actions), rule.Cooldown, now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create rule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get new rule ID: %w", err)
+	}
+
+	log.Printf("Storage: Rule %d (%q) created", id, rule.Name)
+	return int(id), nil
+}
+
+// UpdateRule replaces everything about a rule except when it last fired
+func (d *Database) UpdateRule(rule Rule) error {
+	if err := checkRule(d.db, rule, rule.ID); err != nil {
+		return err
+	}
+
+	result, err := d.db.Exec(
+		`UPDATE rules SET name = ?, enabled = ?, "trigger" = ?, conditions = ?, actions = ?, cooldown = ?, updated_at = ? WHERE id = ?`,
+		rule.Name, rule.Enabled, string(rule.Trigger), string(rule.Conditions), string(rule.Actions), rule.Cooldown,
+		time.Now().Unix(), rule.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrRuleNotFound, rule.ID)
+	}
+
+	log.Printf("Storage: Rule %d (%q) updated", rule.ID, rule.Name)
+	return nil
+}
+
+// DeleteRule removes a rule
+func (d *Database) DeleteRule(ruleID int) error {
+	result, err := d.db.Exec("DELETE FROM rules WHERE id = ?", ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrRuleNotFound, ruleID)
+	}
+
+	log.Printf("Storage: Rule %d deleted", ruleID)
+	return nil
+}
+
+// SetRuleLastFired records when a rule last fired
+func (d *Database) SetRuleLastFired(ruleID int, at time.Time) error {
+	result, err := d.db.Exec("UPDATE rules SET last_fired = ? WHERE id = ?", at.UnixMilli(), ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to record rule firing: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrRuleNotFound, ruleID)
+	}
+	return nil
+}
+
+// scanRule reads a rule row
+func scanRule(row rowScanner) (*Rule, error) {
+	var rule Rule
+	var trigger, conditions, actions string
+	var lastFired sql.NullInt64
+	var created, updated int64
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Enabled, &trigger, &conditions, &actions, &rule.Cooldown,
+		&lastFired, &created, &updated)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan rule: %w", err)
+	}
+
+	rule.Trigger = []byte(trigger)
+	if conditions != "" {
+		rule.Conditions = []byte(conditions)
+	}
+	rule.Actions = []byte(actions)
+	if lastFired.Valid {
+		t := time.UnixMilli(lastFired.Int64)
+		rule.LastFired = &t
+	}
+	rule.CreatedAt = unixTime(created)
+	rule.UpdatedAt = unixTime(updated)
+	return &rule, nil
+}
+
+// checkRule verifies a rule has a trigger and actions, and a non-empty name not
+// used by any rule other than excludeID
+func checkRule(q sceneQuerier, rule Rule, excludeID int) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return ErrRuleNameRequired
+	}
+	if len(rule.Trigger) == 0 {
+		return fmt.Errorf("rule %q has no trigger", rule.Name)
+	}
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("rule %q has no actions", rule.Name)
+	}
+	if rule.Cooldown < 0 {
+		return fmt.Errorf("rule %q has a negative cooldown", rule.Name)
+	}
+
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM rules WHERE name = ? AND id != ?", rule.Name, excludeID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check rule name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %q", ErrRuleNameTaken, rule.Name)
+	}
+	return nil
+}
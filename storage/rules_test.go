@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRuleCRUD(t *testing.T) {
+	db := newTestDatabase(t)
+
+	rule := Rule{
+		Name:       "Door Evening",
+		Enabled:    true,
+		Trigger:    json.RawMessage(`{"type":"mqtt","topic":"door/office","payload":"open"}`),
+		Conditions: json.RawMessage(`[{"type":"time","after":"18:00"}]`),
+		Actions:    json.RawMessage(`[{"type":"scene","scene":"Evening"}]`),
+		Cooldown:   30000,
+	}
+	id, err := db.CreateRule(rule)
+	if err != nil {
+		t.Fatalf("CreateRule failed: %v", err)
+	}
+
+	got, err := db.GetRule(id)
+	if err != nil || got == nil {
+		t.Fatalf("GetRule() = %v, %v", got, err)
+	}
+	if got.Name != "Door Evening" || !got.Enabled || got.Cooldown != 30000 || got.LastFired != nil {
+		t.Errorf("Unexpected rule: %+v", got)
+	}
+	if string(got.Trigger) != string(rule.Trigger) || string(got.Conditions) != string(rule.Conditions) ||
+		string(got.Actions) != string(rule.Actions) {
+		t.Errorf("JSON not restored: %s %s %s", got.Trigger, got.Conditions, got.Actions)
+	}
+
+	fired := time.Date(2024, 5, 6, 18, 30, 0, 250_000_000, time.UTC)
+	if err := db.SetRuleLastFired(id, fired); err != nil {
+		t.Fatalf("SetRuleLastFired failed: %v", err)
+	}
+
+	got.Name = "Door"
+	got.Conditions = nil
+	got.Enabled = false
+	if err := db.UpdateRule(*got); err != nil {
+		t.Fatalf("UpdateRule failed: %v", err)
+	}
+
+	got, _ = db.GetRule(id)
+	if got.Name != "Door" || got.Enabled || got.Conditions != nil {
+		t.Errorf("Update not applied: %+v", got)
+	}
+	if got.LastFired == nil || !got.LastFired.Equal(fired) {
+		t.Errorf("Expected last fired %v to survive the update, got %v", fired, got.LastFired)
+	}
+
+	list, err := db.ListRules()
+	if err != nil || len(list) != 1 || list[0].ID != id {
+		t.Errorf("ListRules() = %v, %v", list, err)
+	}
+
+	if err := db.DeleteRule(id); err != nil {
+		t.Fatalf("DeleteRule failed: %v", err)
+	}
+	if got, _ := db.GetRule(id); got != nil {
+		t.Error("Expected rule to be deleted")
+	}
+	if err := db.DeleteRule(id); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	trigger := json.RawMessage(`{"type":"webhook","hook":"doorbell"}`)
+	actions := json.RawMessage(`[{"type":"off"}]`)
+	if _, err := db.CreateRule(Rule{Name: "Bell", Trigger: trigger, Actions: actions}); err != nil {
+		t.Fatalf("CreateRule failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr error
+	}{
+		{"empty name", Rule{Name: " ", Trigger: trigger, Actions: actions}, ErrRuleNameRequired},
+		{"duplicate name", Rule{Name: "Bell", Trigger: trigger, Actions: actions}, ErrRuleNameTaken},
+		{"no trigger", Rule{Name: "Untriggered", Actions: actions}, nil},
+		{"no actions", Rule{Name: "Idle", Trigger: trigger}, nil},
+		{"negative cooldown", Rule{Name: "Eager", Trigger: trigger, Actions: actions, Cooldown: -1}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateRule(tt.rule)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := db.UpdateRule(Rule{ID: 99, Name: "Ghost", Trigger: trigger, Actions: actions}); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+	if err := db.SetRuleLastFired(99, time.Now()); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// SceneFormatVersion is the schema version written to exported scene documents
+const SceneFormatVersion = 1
+
+// ledBarChannelCount is the number of channels stored for an LED bar
+const ledBarChannelCount = 77
+
+// SceneDocument is the portable JSON format for exported scenes
+//
+// Example:
+//
+//	{
+//	  "version": 1,
+//	  "scenes": [
+//	    {
+//	      "name": "Video Call",
+//	      "description": "Key light on, warm strip",
+//	      "bgColor": "#FF8800",
+//	      "tags": ["calls"],
+//	      "devices": {
+//	        "ledStrip": {"r": 255, "g": 120, "b": 40},
+//	        "ledBars": [{"id": 0, "channels": [0, 0, 0, 255, ...]}],
+//	        "videoLights": [{"id": 0, "on": true, "brightness": 80}]
+//	      }
+//	    }
+//	  ]
+//	}
+type SceneDocument struct {
+	Version int           `json:"version"`
+	Scenes  []SceneExport `json:"scenes"`
+}
+
+// SceneExport is one scene in a SceneDocument
+type SceneExport struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	BgColor     string     `json:"bgColor,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Devices     *SceneData `json:"devices"`
+}
+
+// sceneDevicesJSON is the JSON representation of SceneData
+type sceneDevicesJSON struct {
+	LEDStrip    *ledStripJSON    `json:"ledStrip,omitempty"`
+	LEDBars     []ledBarJSON     `json:"ledBars,omitempty"`
+	VideoLights []videoLightJSON `json:"videoLights,omitempty"`
+}
+
+type ledStripJSON struct {
+	R int `json:"r"`
+	G int `json:"g"`
+	B int `json:"b"`
+}
+
+// ledBarJSON lists channel values in channel order; null means the channel isn't part of the scene
+type ledBarJSON struct {
+	ID       int    `json:"id"`
+	Channels []*int `json:"channels"`
+}
+
+// videoLightJSON uses database IDs (0 and 1)
+type videoLightJSON struct {
+	ID         int  `json:"id"`
+	On         bool `json:"on"`
+	Brightness int  `json:"brightness"`
+}
+
+// MarshalJSON encodes scene data in the portable per-device format
+func (s SceneData) MarshalJSON() ([]byte, error) {
+	out := sceneDevicesJSON{}
+	if s.LEDStrip != nil {
+		out.LEDStrip = &ledStripJSON{R: s.LEDStrip.Red, G: s.LEDStrip.Green, B: s.LEDStrip.Blue}
+	}
+
+	// Group LED bar channels by bar
+	bars := make(map[int]int) // ledbar ID -> index in out.LEDBars
+	for _, led := range s.LEDBarLEDs {
+		if led.ChannelNum < 0 || led.ChannelNum >= ledBarChannelCount {
+			continue
+		}
+		i, ok := bars[led.LEDBarID]
+		if !ok {
+			i = len(out.LEDBars)
+			bars[led.LEDBarID] = i
+			out.LEDBars = append(out.LEDBars, ledBarJSON{
+				ID:       led.LEDBarID,
+				Channels: make([]*int, ledBarChannelCount),
+			})
+		}
+		value := led.Value
+		out.LEDBars[i].Channels[led.ChannelNum] = &value
+	}
+
+	for _, vl := range s.VideoLights {
+		out.VideoLights = append(out.VideoLights, videoLightJSON{ID: vl.ID, On: vl.On, Brightness: vl.Brightness})
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes and validates scene data in the portable per-device format
+func (s *SceneData) UnmarshalJSON(data []byte) error {
+	var in sceneDevicesJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	result := SceneData{}
+
+	if in.LEDStrip != nil {
+		for _, v := range []int{in.LEDStrip.R, in.LEDStrip.G, in.LEDStrip.B} {
+			if v < 0 || v > 255 {
+				return fmt.Errorf("LED strip value out of range: %d", v)
+			}
+		}
+		result.LEDStrip = &LEDStripState{Red: in.LEDStrip.R, Green: in.LEDStrip.G, Blue: in.LEDStrip.B}
+	}
+
+	for _, bar := range in.LEDBars {
+		if bar.ID < 0 {
+			return fmt.Errorf("LED bar ID must be non-negative, got %d", bar.ID)
+		}
+		if len(bar.Channels) > ledBarChannelCount {
+			return fmt.Errorf("LED bar %d has %d channels, maximum is %d", bar.ID, len(bar.Channels), ledBarChannelCount)
+		}
+		for ch, value := range bar.Channels {
+			if value == nil {
+				continue
+			}
+			if *value < 0 || *value > 255 {
+				return fmt.Errorf("LED bar %d channel %d out of range: %d", bar.ID, ch, *value)
+			}
+			result.LEDBarLEDs = append(result.LEDBarLEDs, LEDBarLEDState{
+				LEDBarID:   bar.ID,
+				ChannelNum: ch,
+				Value:      *value,
+			})
+		}
+	}
+
+	for _, vl := range in.VideoLights {
+		if vl.ID < 0 {
+			return fmt.Errorf("video light ID must be non-negative, got %d", vl.ID)
+		}
+		if vl.Brightness < 0 || vl.Brightness > 100 {
+			return fmt.Errorf("video light %d brightness out of range: %d", vl.ID, vl.Brightness)
+		}
+		result.VideoLights = append(result.VideoLights, VideoLightState{ID: vl.ID, On: vl.On, Brightness: vl.Brightness})
+	}
+
+	*s = result
+	return nil
+}
+
+// ParseSceneDocument decodes an exported scene document and checks its version,
+// names and colours
+// Names are trimmed and colours written as "#RRGGBB".
+func ParseSceneDocument(data []byte) (*SceneDocument, error) {
+	var doc SceneDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid scene document: %w", err)
+	}
+	if doc.Version < 1 || doc.Version > SceneFormatVersion {
+		return nil, fmt.Errorf("unsupported scene document version %d (supported: 1-%d)", doc.Version, SceneFormatVersion)
+	}
+	for i := range doc.Scenes {
+		scene := &doc.Scenes[i]
+		scene.Name = strings.TrimSpace(scene.Name)
+		if scene.Name == "" {
+			return nil, fmt.Errorf("scene %d: %w", i, ErrSceneNameRequired)
+		}
+		color, err := normalizeBgColor(scene.BgColor)
+		if err != nil {
+			return nil, fmt.Errorf("scene %q: %w", scene.Name, err)
+		}
+		scene.BgColor = color
+	}
+	return &doc, nil
+}
+
+// normalizeBgColor checks a background colour is "#rrggbb" or empty, returning it as "#RRGGBB"
+func normalizeBgColor(color string) (string, error) {
+	if color == "" {
+		return "", nil
+	}
+	if len(color) != 7 || color[0] != '#' {
+		return "", fmt.Errorf("invalid background colour %q (use #rrggbb)", color)
+	}
+	if _, err := hex.DecodeString(color[1:]); err != nil {
+		return "", fmt.Errorf("invalid background colour %q (use #rrggbb)", color)
+	}
+	return strings.ToUpper(color), nil
+}
+
+// ExportScenes builds a document containing the given scenes, or every named scene if none are given
+func ExportScenes(store SceneStore, sceneIDs ...int) (*SceneDocument, error) {
+	var infos []SceneInfo
+	if len(sceneIDs) == 0 {
+		all, err := store.ListScenes()
+		if err != nil {
+			return nil, err
+		}
+		infos = all
+	} else {
+		for _, id := range sceneIDs {
+			info, err := store.GetScene(id)
+			if err != nil {
+				return nil, err
+			}
+			if info == nil {
+				return nil, fmt.Errorf("scene %d: %w", id, ErrSceneNotFound)
+			}
+			// Unnamed scenes from the old fixed slots can't be imported by name
+			if info.Name == "" {
+				return nil, fmt.Errorf("scene %d: %w", id, ErrSceneNameRequired)
+			}
+			infos = append(infos, *info)
+		}
+	}
+
+	doc := &SceneDocument{Version: SceneFormatVersion, Scenes: make([]SceneExport, 0, len(infos))}
+	for _, info := range infos {
+		// Leave unnamed scenes out of a full export rather than failing it
+		if info.Name == "" {
+			continue
+		}
+
+		data, err := store.LoadScene(info.ID)
+		if err != nil {
+			return nil, fmt.Errorf("scene %q: %w", info.Name, err)
+		}
+
+		doc.Scenes = append(doc.Scenes, SceneExport{
+			Name:        info.Name,
+			Description: info.Description,
+			BgColor:     info.BgColor,
+			Tags:        info.Tags,
+			Devices:     data,
+		})
+	}
+
+	return doc, nil
+}
+
+// ConflictPolicy decides what happens when an imported scene's name already exists
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves the existing scene alone and ignores the imported one
+	ConflictSkip ConflictPolicy = "skip"
+
+	// ConflictReplace overwrites the existing scene's metadata and light state
+	ConflictReplace ConflictPolicy = "replace"
+
+	// ConflictRename imports the scene under a new name such as "Evening (2)"
+	ConflictRename ConflictPolicy = "rename"
+
+	// ConflictFail aborts the import without writing any scene
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ParseConflictPolicy converts a policy name, defaulting to ConflictSkip when empty
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch ConflictPolicy(name) {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictReplace, ConflictRename, ConflictFail:
+		return ConflictPolicy(name), nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q (use skip, replace, rename or fail)", name)
+	}
+}
+
+// ImportResult records what happened to one imported scene
+type ImportResult struct {
+	Name    string `json:"name"`
+	SceneID int    `json:"sceneId,omitempty"`
+	Action  string `json:"action"` // "created", "replaced", "renamed" or "skipped"
+}
+
+// ImportScenes writes the scenes of a document into the library in a single
+// transaction, so a failed import leaves the library untouched
+func (d *Database) ImportScenes(doc *SceneDocument, policy ConflictPolicy) ([]ImportResult, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A document naming the same scene twice conflicts with itself
+	if policy == ConflictFail {
+		seen := make(map[string]bool, len(doc.Scenes))
+		for _, scene := range doc.Scenes {
+			if seen[scene.Name] {
+				return nil, fmt.Errorf("%w: %q appears more than once in the document", ErrSceneNameTaken, scene.Name)
+			}
+			seen[scene.Name] = true
+		}
+	}
+
+	results := make([]ImportResult, 0, len(doc.Scenes))
+	for _, scene := range doc.Scenes {
+		result, err := importScene(tx, scene, policy)
+		if err != nil {
+			return nil, fmt.Errorf("scene %q: %w", scene.Name, err)
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Imported %d scenes", len(results))
+	return results, nil
+}
+
+// importScene writes a single scene according to the conflict policy
+// Created and replaced scenes take the document's light state, even when it is empty.
+func importScene(tx *sql.Tx, scene SceneExport, policy ConflictPolicy) (ImportResult, error) {
+	info := SceneInfo{
+		Name:        scene.Name,
+		Description: scene.Description,
+		BgColor:     scene.BgColor,
+		Tags:        scene.Tags,
+	}
+	result := ImportResult{Name: scene.Name, Action: "created"}
+
+	existingID, exists, err := sceneIDByName(tx, scene.Name)
+	if err != nil {
+		return result, err
+	}
+
+	var sceneID int
+	switch {
+	case !exists:
+		sceneID, err = insertScene(tx, info)
+	case policy == ConflictSkip:
+		result.SceneID = existingID
+		result.Action = "skipped"
+		return result, nil
+	case policy == ConflictReplace:
+		sceneID = existingID
+		info.ID = existingID
+		result.Action = "replaced"
+		err = updateScene(tx, info)
+	case policy == ConflictRename:
+		info.Name, err = uniqueSceneName(tx, scene.Name)
+		if err != nil {
+			return result, err
+		}
+		result.Name = info.Name
+		result.Action = "renamed"
+		sceneID, err = insertScene(tx, info)
+	default:
+		return result, fmt.Errorf("%w: %q", ErrSceneNameTaken, scene.Name)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.SceneID = sceneID
+
+	if err := saveSceneData(tx, sceneID, scene.Devices); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// sceneIDByName looks up a scene by name (ok is false if none has it)
+func sceneIDByName(q sceneQuerier, name string) (id int, ok bool, err error) {
+	err = q.QueryRow("SELECT id FROM scenes WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to find scene: %w", err)
+	}
+	return id, true, nil
+}
+
+// uniqueSceneName returns name with the lowest " (N)" suffix that isn't already taken
+func uniqueSceneName(q sceneQuerier, name string) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		_, exists, err := sceneIDByName(q, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+}
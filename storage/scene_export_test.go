@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSceneDataJSONRoundTrip(t *testing.T) {
+	data := SceneData{
+		LEDStrip: &LEDStripState{Red: 255, Green: 120, Blue: 40},
+		LEDBarLEDs: []LEDBarLEDState{
+			{LEDBarID: 0, ChannelNum: 0, Value: 10},
+			{LEDBarID: 0, ChannelNum: 76, Value: 250},
+		},
+		VideoLights: []VideoLightState{{ID: 1, On: true, Brightness: 80}},
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	// Channels not in the scene are encoded as null
+	if !strings.Contains(string(encoded), `"channels":[10,null,`) {
+		t.Errorf("Unexpected channel encoding: %s", encoded)
+	}
+
+	var decoded SceneData
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if decoded.LEDStrip == nil || *decoded.LEDStrip != *data.LEDStrip {
+		t.Errorf("LED strip mismatch: %+v", decoded.LEDStrip)
+	}
+	if len(decoded.LEDBarLEDs) != 2 || decoded.LEDBarLEDs[1] != data.LEDBarLEDs[1] {
+		t.Errorf("LED bar mismatch: %+v", decoded.LEDBarLEDs)
+	}
+	if len(decoded.VideoLights) != 1 || decoded.VideoLights[0] != data.VideoLights[0] {
+		t.Errorf("Video light mismatch: %+v", decoded.VideoLights)
+	}
+}
+
+func TestSceneDataJSONValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"strip out of range", `{"ledStrip":{"r":256,"g":0,"b":0}}`},
+		{"bar value out of range", `{"ledBars":[{"id":0,"channels":[300]}]}`},
+		{"too many channels", `{"ledBars":[{"id":0,"channels":[` + strings.Repeat("0,", 77) + `0]}]}`},
+		{"brightness out of range", `{"videoLights":[{"id":0,"on":true,"brightness":101}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data SceneData
+			if err := json.Unmarshal([]byte(tt.json), &data); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestParseSceneDocumentVersion(t *testing.T) {
+	if _, err := ParseSceneDocument([]byte(`{"version":99,"scenes":[]}`)); err == nil {
+		t.Error("Expected error for unsupported version")
+	}
+	if _, err := ParseSceneDocument([]byte(`{"version":1,"scenes":[{"name":""}]}`)); err == nil {
+		t.Error("Expected error for unnamed scene")
+	}
+	if _, err := ParseSceneDocument([]byte(`{"version":1,"scenes":[]}`)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseSceneDocumentScenes(t *testing.T) {
+	doc, err := ParseSceneDocument([]byte(`{"version":1,"scenes":[{"name":"  Evening ","bgColor":"#ff8800"},{"name":"Night"}]}`))
+	if err != nil {
+		t.Fatalf("ParseSceneDocument failed: %v", err)
+	}
+	if doc.Scenes[0].Name != "Evening" || doc.Scenes[0].BgColor != "#FF8800" {
+		t.Errorf("Expected the name trimmed and colour normalized, got %+v", doc.Scenes[0])
+	}
+	if doc.Scenes[1].BgColor != "" {
+		t.Errorf("Expected no colour, got %q", doc.Scenes[1].BgColor)
+	}
+
+	tests := []struct {
+		name  string
+		scene string
+	}{
+		{"blank name", `{"name":" \t "}`},
+		{"colour name", `{"name":"Evening","bgColor":"orange"}`},
+		{"short colour", `{"name":"Evening","bgColor":"#f80"}`},
+		{"not hex", `{"name":"Evening","bgColor":"#ff88zz"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSceneDocument([]byte(`{"version":1,"scenes":[` + tt.scene + `]}`)); err == nil {
+				t.Error("Expected the scene to be refused")
+			}
+		})
+	}
+}
+
+func TestExportImportScenes(t *testing.T) {
+	source := newTestDatabase(t)
+
+	id, _ := source.CreateScene(SceneInfo{Name: "Video Call", BgColor: "#FF8800", Tags: []string{"calls"}})
+	source.SaveScene(id, &SceneData{
+		LEDStrip:    &LEDStripState{Red: 1, Green: 2, Blue: 3},
+		VideoLights: []VideoLightState{{ID: 0, On: true, Brightness: 60}},
+	})
+	source.CreateScene(SceneInfo{Name: "Empty"})
+
+	doc, err := ExportScenes(source)
+	if err != nil {
+		t.Fatalf("ExportScenes failed: %v", err)
+	}
+	if doc.Version != SceneFormatVersion || len(doc.Scenes) != 2 {
+		t.Fatalf("Unexpected document: version %d, %d scenes", doc.Version, len(doc.Scenes))
+	}
+
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	parsed, err := ParseSceneDocument(encoded)
+	if err != nil {
+		t.Fatalf("ParseSceneDocument failed: %v", err)
+	}
+
+	target := newTestDatabase(t)
+	results, err := target.ImportScenes(parsed, ConflictSkip)
+	if err != nil {
+		t.Fatalf("ImportScenes failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Action != "created" {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+
+	imported, _ := target.FindSceneByName("Video Call")
+	if imported == nil || imported.BgColor != "#FF8800" || len(imported.Tags) != 1 {
+		t.Fatalf("Metadata not imported: %+v", imported)
+	}
+	data, _ := target.LoadScene(imported.ID)
+	if data == nil || data.LEDStrip.Blue != 3 || len(data.VideoLights) != 1 {
+		t.Errorf("Light state not imported: %+v", data)
+	}
+}
+
+func TestExportUnnamedScene(t *testing.T) {
+	db := newTestDatabase(t)
+	if _, err := db.db.Exec("INSERT INTO scenes (id, name) VALUES (7, '')"); err != nil {
+		t.Fatalf("Failed to insert unnamed scene: %v", err)
+	}
+	db.CreateScene(SceneInfo{Name: "Named"})
+
+	doc, err := ExportScenes(db)
+	if err != nil || len(doc.Scenes) != 1 {
+		t.Fatalf("Expected only the named scene exported, got %+v, %v", doc, err)
+	}
+
+	if _, err := ExportScenes(db, 7); !errors.Is(err, ErrSceneNameRequired) {
+		t.Errorf("Expected ErrSceneNameRequired exporting an unnamed scene, got %v", err)
+	}
+}
+
+func TestImportScenesAllOrNothing(t *testing.T) {
+	db := newTestDatabase(t)
+	db.CreateScene(SceneInfo{Name: "Evening"})
+
+	doc := &SceneDocument{
+		Version: SceneFormatVersion,
+		Scenes: []SceneExport{
+			{Name: "Morning", Devices: &SceneData{LEDStrip: &LEDStripState{Red: 10}}},
+			{Name: "Evening"},
+		},
+	}
+	// The conflict is only found after the first scene has been written
+	if _, err := db.ImportScenes(doc, ConflictFail); !errors.Is(err, ErrSceneNameTaken) {
+		t.Fatalf("Expected ErrSceneNameTaken, got %v", err)
+	}
+	if info, _ := db.FindSceneByName("Morning"); info != nil {
+		t.Error("Scene written by a failed import")
+	}
+}
+
+func TestImportDuplicateNames(t *testing.T) {
+	doc := &SceneDocument{
+		Version: SceneFormatVersion,
+		Scenes: []SceneExport{
+			{Name: "Evening", Devices: &SceneData{LEDStrip: &LEDStripState{Red: 1}}},
+			{Name: "Evening", Devices: &SceneData{LEDStrip: &LEDStripState{Red: 2}}},
+		},
+	}
+
+	db := newTestDatabase(t)
+	if _, err := db.ImportScenes(doc, ConflictFail); !errors.Is(err, ErrSceneNameTaken) {
+		t.Fatalf("Expected ErrSceneNameTaken, got %v", err)
+	}
+	if info, _ := db.FindSceneByName("Evening"); info != nil {
+		t.Error("Scene written by a failed import")
+	}
+
+	results, err := db.ImportScenes(doc, ConflictRename)
+	if err != nil || len(results) != 2 || results[1].Name != "Evening (2)" {
+		t.Fatalf("Unexpected rename results: %+v, %v", results, err)
+	}
+}
+
+func TestImportConflictPolicies(t *testing.T) {
+	doc := &SceneDocument{
+		Version: SceneFormatVersion,
+		Scenes: []SceneExport{{
+			Name:        "Evening",
+			Description: "imported",
+			Devices:     &SceneData{LEDStrip: &LEDStripState{Red: 200}},
+		}},
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		db := newTestDatabase(t)
+		db.CreateScene(SceneInfo{Name: "Evening", Description: "original"})
+
+		results, err := db.ImportScenes(doc, ConflictSkip)
+		if err != nil || results[0].Action != "skipped" {
+			t.Fatalf("Unexpected result: %+v, %v", results, err)
+		}
+		info, _ := db.FindSceneByName("Evening")
+		if info.Description != "original" {
+			t.Error("Skipped scene was modified")
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		db := newTestDatabase(t)
+		id, _ := db.CreateScene(SceneInfo{Name: "Evening", Description: "original"})
+
+		results, err := db.ImportScenes(doc, ConflictReplace)
+		if err != nil || results[0].Action != "replaced" || results[0].SceneID != id {
+			t.Fatalf("Unexpected result: %+v, %v", results, err)
+		}
+		info, _ := db.GetScene(id)
+		if info.Description != "imported" {
+			t.Error("Scene metadata not replaced")
+		}
+		data, _ := db.LoadScene(id)
+		if data == nil || data.LEDStrip.Red != 200 {
+			t.Errorf("Scene state not replaced: %+v", data)
+		}
+
+		// A scene with no devices replaces the light state with nothing
+		empty := &SceneDocument{Version: SceneFormatVersion, Scenes: []SceneExport{{Name: "Evening"}}}
+		if _, err := db.ImportScenes(empty, ConflictReplace); err != nil {
+			t.Fatalf("ImportScenes failed: %v", err)
+		}
+		if data, _ := db.LoadScene(id); data != nil && !data.IsEmpty() {
+			t.Errorf("Scene state kept after replacing with an empty scene: %+v", data)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		db := newTestDatabase(t)
+		db.CreateScene(SceneInfo{Name: "Evening"})
+		db.CreateScene(SceneInfo{Name: "Evening (2)"})
+
+		results, err := db.ImportScenes(doc, ConflictRename)
+		if err != nil || results[0].Action != "renamed" || results[0].Name != "Evening (3)" {
+			t.Fatalf("Unexpected result: %+v, %v", results, err)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		db := newTestDatabase(t)
+		db.CreateScene(SceneInfo{Name: "Evening"})
+
+		_, err := db.ImportScenes(doc, ConflictFail)
+		if !errors.Is(err, ErrSceneNameTaken) {
+			t.Errorf("Expected ErrSceneNameTaken, got %v", err)
+		}
+	})
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	if p, err := ParseConflictPolicy(""); err != nil || p != ConflictSkip {
+		t.Errorf("Expected default skip, got %q, %v", p, err)
+	}
+	if _, err := ParseConflictPolicy("merge"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
@@ -0,0 +1,416 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// sceneQuerier is satisfied by both *sql.DB and *sql.Tx
+type sceneQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// ListScenes returns the metadata of every scene in the library, ordered by name
+func (d *Database) ListScenes() ([]SceneInfo, error) {
+	rows, err := d.db.Query(
+		"SELECT id, name, description, bgcolor, created_at, updated_at FROM scenes ORDER BY name COLLATE NOCASE, id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scenes: %w", err)
+	}
+	defer rows.Close()
+
+	scenes := make([]SceneInfo, 0)
+	index := make(map[int]int)
+	for rows.Next() {
+		var info SceneInfo
+		var created, updated int64
+		if err := rows.Scan(&info.ID, &info.Name, &info.Description, &info.BgColor, &created, &updated); err != nil {
+			return nil, fmt.Errorf("failed to scan scene: %w", err)
+		}
+		info.CreatedAt = unixTime(created)
+		info.UpdatedAt = unixTime(updated)
+		index[info.ID] = len(scenes)
+		scenes = append(scenes, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scenes: %w", err)
+	}
+
+	// Attach tags in a single pass
+	tagRows, err := d.db.Query("SELECT scene_id, tag FROM scenes_tags ORDER BY scene_id, tag")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scene tags: %w", err)
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var sceneID int
+		var tag string
+		if err := tagRows.Scan(&sceneID, &tag); err != nil {
+			return nil, fmt.Errorf("failed to scan scene tag: %w", err)
+		}
+		if i, ok := index[sceneID]; ok {
+			scenes[i].Tags = append(scenes[i].Tags, tag)
+		}
+	}
+	if err := tagRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scene tags: %w", err)
+	}
+
+	return scenes, nil
+}
+
+// GetScene returns the metadata of a scene (returns nil if it doesn't exist)
+func (d *Database) GetScene(sceneID int) (*SceneInfo, error) {
+	return d.getSceneWhere("id = ?", sceneID)
+}
+
+// FindSceneByName returns the metadata of the scene with the given name (returns nil if none)
+func (d *Database) FindSceneByName(name string) (*SceneInfo, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return d.getSceneWhere("name = ?", name)
+}
+
+// getSceneWhere loads a single scene's metadata and tags
+func (d *Database) getSceneWhere(where string, arg interface{}) (*SceneInfo, error) {
+	var info SceneInfo
+	var created, updated int64
+	err := d.db.QueryRow(
+		"SELECT id, name, description, bgcolor, created_at, updated_at FROM scenes WHERE "+where,
+		arg,
+	).Scan(&info.ID, &info.Name, &info.Description, &info.BgColor, &created, &updated)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scene: %w", err)
+	}
+	info.CreatedAt = unixTime(created)
+	info.UpdatedAt = unixTime(updated)
+
+	info.Tags, err = loadSceneTags(d.db, info.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// CreateScene adds a new scene without light state and returns its ID
+func (d *Database) CreateScene(info SceneInfo) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	id, err := insertScene(tx, info)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Scene %d (%q) created", id, info.Name)
+	return id, nil
+}
+
+// CreateSceneWithData adds a new scene holding the given light state and returns its ID
+// Nothing is saved if either part fails.
+func (d *Database) CreateSceneWithData(info SceneInfo, data *SceneData) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	id, err := insertScene(tx, info)
+	if err != nil {
+		return 0, err
+	}
+	if err := saveSceneData(tx, id, data); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Scene %d (%q) created", id, info.Name)
+	return id, nil
+}
+
+// UpdateScene updates the name, description, background color and tags of a scene
+func (d *Database) UpdateScene(info SceneInfo) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := updateScene(tx, info); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Scene %d updated", info.ID)
+	return nil
+}
+
+// RenameScene changes the name of a scene
+func (d *Database) RenameScene(sceneID int, name string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkSceneName(tx, name, sceneID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE scenes SET name = ?, updated_at = ? WHERE id = ?", name, time.Now().Unix(), sceneID)
+	if err != nil {
+		return fmt.Errorf("failed to rename scene: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSceneNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Scene %d renamed to %q", sceneID, name)
+	return nil
+}
+
+// DuplicateScene copies a scene, including its light state, under a new name
+func (d *Database) DuplicateScene(sceneID int, name string) (int, error) {
+	source, err := d.GetScene(sceneID)
+	if err != nil {
+		return 0, err
+	}
+	if source == nil {
+		return 0, ErrSceneNotFound
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	copyInfo := *source
+	copyInfo.Name = name
+	newID, err := insertScene(tx, copyInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	// Copy the light state rows
+	copies := []struct {
+		what  string
+		query string
+	}{
+		{"LED strip", "INSERT INTO scenes_ledstrips (scene_id, red, green, blue) SELECT ?, red, green, blue FROM scenes_ledstrips WHERE scene_id = ?"},
+		{"LED bar", "INSERT INTO scenes_ledbars_leds (scene_id, ledbar_id, channel_num, value) SELECT ?, ledbar_id, channel_num, value FROM scenes_ledbars_leds WHERE scene_id = ?"},
+		{"video light", "INSERT INTO scenes_videolights (scene_id, videolight_id, on_state, brightness) SELECT ?, videolight_id, on_state, brightness FROM scenes_videolights WHERE scene_id = ?"},
+	}
+	for _, c := range copies {
+		if _, err := tx.Exec(c.query, newID, sceneID); err != nil {
+			return 0, fmt.Errorf("failed to copy %s data: %w", c.what, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Scene %d duplicated as scene %d (%q)", sceneID, newID, name)
+	return newID, nil
+}
+
+// GetSceneShortcut returns the scene assigned to a shortcut slot (ok is false if unassigned)
+func (d *Database) GetSceneShortcut(slot int) (sceneID int, ok bool, err error) {
+	if slot < 0 || slot >= SceneShortcutSlots {
+		return 0, false, ErrInvalidShortcut
+	}
+
+	var id sql.NullInt64
+	err = d.db.QueryRow("SELECT scene_id FROM scene_shortcuts WHERE slot = ?", slot).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get scene shortcut: %w", err)
+	}
+	if !id.Valid {
+		return 0, false, nil
+	}
+
+	return int(id.Int64), true, nil
+}
+
+// SetSceneShortcut assigns a scene to a shortcut slot
+func (d *Database) SetSceneShortcut(slot int, sceneID int) error {
+	if slot < 0 || slot >= SceneShortcutSlots {
+		return ErrInvalidShortcut
+	}
+
+	info, err := d.GetScene(sceneID)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return ErrSceneNotFound
+	}
+
+	_, err = d.db.Exec("INSERT OR REPLACE INTO scene_shortcuts (slot, scene_id) VALUES (?, ?)", slot, sceneID)
+	if err != nil {
+		return fmt.Errorf("failed to set scene shortcut: %w", err)
+	}
+
+	log.Printf("Storage: Shortcut %d assigned to scene %d", slot, sceneID)
+	return nil
+}
+
+// ClearSceneShortcut removes the scene assigned to a shortcut slot
+func (d *Database) ClearSceneShortcut(slot int) error {
+	if slot < 0 || slot >= SceneShortcutSlots {
+		return ErrInvalidShortcut
+	}
+
+	_, err := d.db.Exec("INSERT OR REPLACE INTO scene_shortcuts (slot, scene_id) VALUES (?, NULL)", slot)
+	if err != nil {
+		return fmt.Errorf("failed to clear scene shortcut: %w", err)
+	}
+
+	log.Printf("Storage: Shortcut %d cleared", slot)
+	return nil
+}
+
+// insertScene creates a scene row and its tags within a transaction
+func insertScene(tx *sql.Tx, info SceneInfo) (int, error) {
+	if err := checkSceneName(tx, info.Name, -1); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	result, err := tx.Exec(
+		"INSERT INTO scenes (name, description, bgcolor, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		info.Name, info.Description, info.BgColor, now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create scene: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get new scene ID: %w", err)
+	}
+
+	if err := saveSceneTags(tx, int(id), info.Tags); err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// updateScene updates a scene row and its tags within a transaction
+func updateScene(tx *sql.Tx, info SceneInfo) error {
+	if err := checkSceneName(tx, info.Name, info.ID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE scenes SET name = ?, description = ?, bgcolor = ?, updated_at = ? WHERE id = ?",
+		info.Name, info.Description, info.BgColor, time.Now().Unix(), info.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update scene: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSceneNotFound
+	}
+
+	return saveSceneTags(tx, info.ID, info.Tags)
+}
+
+// checkSceneName verifies a name is non-empty and not used by any scene other than excludeID
+func checkSceneName(q sceneQuerier, name string, excludeID int) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrSceneNameRequired
+	}
+
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM scenes WHERE name = ? AND id != ?", name, excludeID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check scene name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %q", ErrSceneNameTaken, name)
+	}
+	return nil
+}
+
+// saveSceneTags replaces the tags of a scene
+func saveSceneTags(q sceneQuerier, sceneID int, tags []string) error {
+	if _, err := q.Exec("DELETE FROM scenes_tags WHERE scene_id = ?", sceneID); err != nil {
+		return fmt.Errorf("failed to delete old scene tags: %w", err)
+	}
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if _, err := q.Exec("INSERT OR IGNORE INTO scenes_tags (scene_id, tag) VALUES (?, ?)", sceneID, tag); err != nil {
+			return fmt.Errorf("failed to save scene tag %q: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// loadSceneTags returns the tags of a scene in alphabetical order
+func loadSceneTags(q sceneQuerier, sceneID int) ([]string, error) {
+	rows, err := q.Query("SELECT tag FROM scenes_tags WHERE scene_id = ? ORDER BY tag", sceneID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scene tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan scene tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scene tags: %w", err)
+	}
+	return tags, nil
+}
+
+// unixTime converts a stored Unix timestamp, treating 0 (pre-library scenes) as unknown
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
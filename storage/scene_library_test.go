@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDatabase creates an initialized database in a temporary directory
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+	if err := db.InitDefaultData(); err != nil {
+		t.Fatalf("InitDefaultData failed: %v", err)
+	}
+	return db
+}
+
+func TestCreateAndListScenes(t *testing.T) {
+	db := newTestDatabase(t)
+
+	// A fresh library is empty
+	scenes, err := db.ListScenes()
+	if err != nil {
+		t.Fatalf("ListScenes failed: %v", err)
+	}
+	if len(scenes) != 0 {
+		t.Fatalf("Expected empty library, got %d scenes", len(scenes))
+	}
+
+	names := []string{"Video Call", "Evening", "Focus", "Reading", "Party"}
+	for _, name := range names {
+		if _, err := db.CreateScene(SceneInfo{Name: name, Tags: []string{"work"}}); err != nil {
+			t.Fatalf("CreateScene(%q) failed: %v", name, err)
+		}
+	}
+
+	scenes, err = db.ListScenes()
+	if err != nil {
+		t.Fatalf("ListScenes failed: %v", err)
+	}
+	if len(scenes) != len(names) {
+		t.Fatalf("Expected %d scenes, got %d", len(names), len(scenes))
+	}
+
+	// Ordered by name
+	if scenes[0].Name != "Evening" || scenes[4].Name != "Video Call" {
+		t.Errorf("Scenes not ordered by name: first=%q last=%q", scenes[0].Name, scenes[4].Name)
+	}
+	for _, scene := range scenes {
+		if len(scene.Tags) != 1 || scene.Tags[0] != "work" {
+			t.Errorf("Scene %q: expected tags [work], got %v", scene.Name, scene.Tags)
+		}
+		if scene.CreatedAt.IsZero() || scene.UpdatedAt.IsZero() {
+			t.Errorf("Scene %q: expected timestamps to be set", scene.Name)
+		}
+	}
+}
+
+func TestCreateSceneValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if _, err := db.CreateScene(SceneInfo{Name: ""}); !errors.Is(err, ErrSceneNameRequired) {
+		t.Errorf("Expected ErrSceneNameRequired, got %v", err)
+	}
+
+	if _, err := db.CreateScene(SceneInfo{Name: "Focus"}); err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+	if _, err := db.CreateScene(SceneInfo{Name: "Focus"}); !errors.Is(err, ErrSceneNameTaken) {
+		t.Errorf("Expected ErrSceneNameTaken, got %v", err)
+	}
+}
+
+func TestCreateSceneWithData(t *testing.T) {
+	db := newTestDatabase(t)
+
+	data := &SceneData{LEDStrip: &LEDStripState{Red: 10, Green: 20, Blue: 30}}
+	id, err := db.CreateSceneWithData(SceneInfo{Name: "Strip", BgColor: "#FF8800"}, data)
+	if err != nil {
+		t.Fatalf("CreateSceneWithData failed: %v", err)
+	}
+	loaded, err := db.LoadScene(id)
+	if err != nil || loaded == nil || loaded.LEDStrip == nil || *loaded.LEDStrip != *data.LEDStrip {
+		t.Errorf("Expected the strip saved with the scene, got %+v (%v)", loaded, err)
+	}
+
+	// A taken name saves nothing
+	if _, err := db.CreateSceneWithData(SceneInfo{Name: "Strip"}, data); !errors.Is(err, ErrSceneNameTaken) {
+		t.Errorf("Expected ErrSceneNameTaken, got %v", err)
+	}
+
+	// Neither does light state that can't be saved
+	bad := &SceneData{LEDStrip: &LEDStripState{Red: 300}}
+	if _, err := db.CreateSceneWithData(SceneInfo{Name: "Broken"}, bad); err == nil {
+		t.Fatal("Expected an out of range colour to be refused")
+	}
+	if info, _ := db.FindSceneByName("Broken"); info != nil {
+		t.Errorf("Expected no scene left behind, got %+v", info)
+	}
+}
+
+func TestUpdateAndRenameScene(t *testing.T) {
+	db := newTestDatabase(t)
+
+	id, err := db.CreateScene(SceneInfo{Name: "Focus", Description: "Desk work"})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+	otherID, err := db.CreateScene(SceneInfo{Name: "Evening"})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+
+	err = db.UpdateScene(SceneInfo{ID: id, Name: "Deep Focus", Description: "Headphones on", BgColor: "#FF5500", Tags: []string{"b", "a"}})
+	if err != nil {
+		t.Fatalf("UpdateScene failed: %v", err)
+	}
+
+	info, err := db.GetScene(id)
+	if err != nil || info == nil {
+		t.Fatalf("GetScene failed: %v", err)
+	}
+	if info.Name != "Deep Focus" || info.Description != "Headphones on" || info.BgColor != "#FF5500" {
+		t.Errorf("Scene not updated: %+v", info)
+	}
+	if len(info.Tags) != 2 || info.Tags[0] != "a" || info.Tags[1] != "b" {
+		t.Errorf("Expected tags [a b], got %v", info.Tags)
+	}
+
+	// Renaming onto another scene's name fails
+	if err := db.RenameScene(otherID, "Deep Focus"); !errors.Is(err, ErrSceneNameTaken) {
+		t.Errorf("Expected ErrSceneNameTaken, got %v", err)
+	}
+
+	// Renaming to the current name succeeds
+	if err := db.RenameScene(id, "Deep Focus"); err != nil {
+		t.Errorf("Renaming to own name failed: %v", err)
+	}
+
+	if err := db.RenameScene(999, "Missing"); !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("Expected ErrSceneNotFound, got %v", err)
+	}
+
+	found, err := db.FindSceneByName("Deep Focus")
+	if err != nil || found == nil || found.ID != id {
+		t.Errorf("FindSceneByName returned %+v, %v", found, err)
+	}
+}
+
+func TestDuplicateScene(t *testing.T) {
+	db := newTestDatabase(t)
+
+	id, err := db.CreateScene(SceneInfo{Name: "Video Call", BgColor: "#00FF00", Tags: []string{"calls"}})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+
+	data := &SceneData{
+		LEDStrip:    &LEDStripState{Red: 10, Green: 20, Blue: 30},
+		LEDBarLEDs:  []LEDBarLEDState{{LEDBarID: 0, ChannelNum: 5, Value: 200}},
+		VideoLights: []VideoLightState{{ID: 0, On: true, Brightness: 80}},
+	}
+	if err := db.SaveScene(id, data); err != nil {
+		t.Fatalf("SaveScene failed: %v", err)
+	}
+
+	copyID, err := db.DuplicateScene(id, "Video Call (copy)")
+	if err != nil {
+		t.Fatalf("DuplicateScene failed: %v", err)
+	}
+	if copyID == id {
+		t.Fatal("Duplicate should have a new ID")
+	}
+
+	info, _ := db.GetScene(copyID)
+	if info.BgColor != "#00FF00" || len(info.Tags) != 1 || info.Tags[0] != "calls" {
+		t.Errorf("Metadata not copied: %+v", info)
+	}
+
+	copied, err := db.LoadScene(copyID)
+	if err != nil || copied == nil {
+		t.Fatalf("LoadScene failed: %v", err)
+	}
+	if copied.LEDStrip == nil || *copied.LEDStrip != *data.LEDStrip {
+		t.Errorf("LED strip not copied: %+v", copied.LEDStrip)
+	}
+	if len(copied.LEDBarLEDs) != 1 || copied.LEDBarLEDs[0].Value != 200 {
+		t.Errorf("LED bar not copied: %+v", copied.LEDBarLEDs)
+	}
+	if len(copied.VideoLights) != 1 || !copied.VideoLights[0].On {
+		t.Errorf("Video lights not copied: %+v", copied.VideoLights)
+	}
+
+	if _, err := db.DuplicateScene(id, "Video Call"); !errors.Is(err, ErrSceneNameTaken) {
+		t.Errorf("Expected ErrSceneNameTaken, got %v", err)
+	}
+}
+
+func TestSaveSceneRequiresExistingScene(t *testing.T) {
+	db := newTestDatabase(t)
+
+	err := db.SaveScene(42, &SceneData{})
+	if !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("Expected ErrSceneNotFound, got %v", err)
+	}
+}
+
+func TestSceneShortcuts(t *testing.T) {
+	db := newTestDatabase(t)
+
+	// All shortcuts start unassigned
+	for slot := 0; slot < SceneShortcutSlots; slot++ {
+		_, ok, err := db.GetSceneShortcut(slot)
+		if err != nil {
+			t.Fatalf("GetSceneShortcut(%d) failed: %v", slot, err)
+		}
+		if ok {
+			t.Errorf("Shortcut %d should start unassigned", slot)
+		}
+	}
+
+	id, _ := db.CreateScene(SceneInfo{Name: "Evening"})
+	if err := db.SetSceneShortcut(2, id); err != nil {
+		t.Fatalf("SetSceneShortcut failed: %v", err)
+	}
+
+	sceneID, ok, err := db.GetSceneShortcut(2)
+	if err != nil || !ok || sceneID != id {
+		t.Errorf("Expected shortcut 2 -> %d, got %d, %v, %v", id, sceneID, ok, err)
+	}
+
+	if err := db.SetSceneShortcut(4, id); !errors.Is(err, ErrInvalidShortcut) {
+		t.Errorf("Expected ErrInvalidShortcut, got %v", err)
+	}
+	if err := db.SetSceneShortcut(0, 999); !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("Expected ErrSceneNotFound, got %v", err)
+	}
+
+	// The table refuses the slots the Go code refuses
+	if _, err := db.db.Exec("INSERT OR REPLACE INTO scene_shortcuts (slot) VALUES (?)", SceneShortcutSlots); err == nil {
+		t.Errorf("Expected the schema to refuse shortcut slot %d", SceneShortcutSlots)
+	}
+	if _, err := db.db.Exec("INSERT OR REPLACE INTO scene_shortcuts (slot) VALUES (?)", SceneShortcutSlots-1); err != nil {
+		t.Errorf("Expected the schema to accept shortcut slot %d: %v", SceneShortcutSlots-1, err)
+	}
+
+	// Deleting the scene clears the shortcut
+	if err := db.DeleteScene(id); err != nil {
+		t.Fatalf("DeleteScene failed: %v", err)
+	}
+	if _, ok, _ := db.GetSceneShortcut(2); ok {
+		t.Error("Shortcut should be cleared after its scene is deleted")
+	}
+	if info, _ := db.GetScene(id); info != nil {
+		t.Error("Scene should be removed from the library")
+	}
+
+	// Clearing is idempotent
+	if err := db.ClearSceneShortcut(2); err != nil {
+		t.Errorf("ClearSceneShortcut failed: %v", err)
+	}
+}
+
+func TestMigrateLegacySceneSlots(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Recreate the original 4-slot layout
+	legacy := []string{
+		"CREATE TABLE scenes (id INTEGER PRIMARY KEY, name TEXT NOT NULL DEFAULT '', bgcolor TEXT NOT NULL DEFAULT '')",
+		"INSERT INTO scenes (id, name) VALUES (0, 'Morning'), (1, ''), (2, 'Morning'), (3, ''), (4, 'Scene 4')",
+	}
+	for _, stmt := range legacy {
+		if _, err := db.db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+	}
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	// Old slots become shortcuts to the same scene IDs
+	for slot := 0; slot < SceneShortcutSlots; slot++ {
+		sceneID, ok, err := db.GetSceneShortcut(slot)
+		if err != nil || !ok || sceneID != slot {
+			t.Errorf("Shortcut %d: expected scene %d, got %d, %v, %v", slot, slot, sceneID, ok, err)
+		}
+	}
+
+	// Duplicate names are disambiguated
+	info, _ := db.GetScene(2)
+	if info == nil || info.Name != "Morning (2)" {
+		t.Errorf("Expected duplicate name to be renamed, got %+v", info)
+	}
+
+	// Unnamed slots are named after their button, clashing names disambiguated
+	for id, want := range map[int]string{1: "Scene 2", 3: "Scene 4 (3)", 4: "Scene 4"} {
+		if info, _ := db.GetScene(id); info == nil || info.Name != want {
+			t.Errorf("Expected scene %d named %q, got %+v", id, want, info)
+		}
+	}
+
+	// Running the migration again leaves cleared shortcuts alone
+	if err := db.ClearSceneShortcut(1); err != nil {
+		t.Fatalf("ClearSceneShortcut failed: %v", err)
+	}
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("Second InitSchema failed: %v", err)
+	}
+	if _, ok, _ := db.GetSceneShortcut(1); ok {
+		t.Error("Cleared shortcut was reassigned by migration")
+	}
+}
+
+func TestPartialScene(t *testing.T) {
+	db := newTestDatabase(t)
+
+	id, _ := db.CreateScene(SceneInfo{Name: "Key Light"})
+
+	// A new scene has nothing saved yet
+	if exists, _ := db.SceneExists(id); exists {
+		t.Error("New scene should not have saved state")
+	}
+
+	data := &SceneData{
+		LEDBarLEDs: []LEDBarLEDState{{LEDBarID: 0, ChannelNum: 70, Value: 255}},
+	}
+	if err := db.SaveScene(id, data); err != nil {
+		t.Fatalf("SaveScene failed: %v", err)
+	}
+
+	if exists, _ := db.SceneExists(id); !exists {
+		t.Error("Scene with only LED bar channels should exist")
+	}
+
+	loaded, err := db.LoadScene(id)
+	if err != nil || loaded == nil {
+		t.Fatalf("LoadScene failed: %v", err)
+	}
+	if loaded.LEDStrip != nil {
+		t.Errorf("LED strip should not be part of the scene, got %+v", loaded.LEDStrip)
+	}
+	if len(loaded.VideoLights) != 0 {
+		t.Errorf("Video lights should not be part of the scene, got %+v", loaded.VideoLights)
+	}
+	if len(loaded.LEDBarLEDs) != 1 || loaded.LEDBarLEDs[0].ChannelNum != 70 {
+		t.Errorf("Unexpected LED bar channels: %+v", loaded.LEDBarLEDs)
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// scheduleColumns are the columns read by scanSchedule, in order
+const scheduleColumns = "id, name, enabled, cron, days, times, sun, sun_offset, action, catch_up, last_run, created_at, updated_at"
+
+// ListSchedules returns every schedule ordered by name
+func (d *Database) ListSchedules() ([]Schedule, error) {
+	rows, err := d.db.Query("SELECT " + scheduleColumns + " FROM schedules ORDER BY name COLLATE NOCASE, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := make([]Schedule, 0)
+	for rows.Next() {
+		sched, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *sched)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// GetSchedule returns a schedule (returns nil if it doesn't exist)
+func (d *Database) GetSchedule(scheduleID int) (*Schedule, error) {
+	row := d.db.QueryRow("SELECT "+scheduleColumns+" FROM schedules WHERE id = ?", scheduleID)
+	sched, err := scanSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sched, nil
+}
+
+// CreateSchedule adds a schedule and returns its ID
+func (d *Database) CreateSchedule(sched Schedule) (int, error) {
+	if err := checkScheduleName(d.db, sched.Name, -1); err != nil {
+		return 0, err
+	}
+	if len(sched.Action) == 0 {
+		return 0, fmt.Errorf("schedule %q has no action", sched.Name)
+	}
+
+	now := time.Now().Unix()
+	result, err := d.db.Exec(
+		"INSERT INTO schedules (name, enabled, cron, days, times, sun, sun_offset, action, catch_up, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		sched.Name, sched.Enabled, sched.Cron, joinList(sched.Days), joinList(sched.Times), sched.Sun, sched.Offset,
+		string(sched.Action), sched.CatchUp, now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create schedule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get new schedule ID: %w", err)
+	}
+
+	log.Printf("Storage: Schedule %d (%q) created", id, sched.Name)
+	return int(id), nil
+}
+
+// UpdateSchedule replaces everything about a schedule except when it last ran
+func (d *Database) UpdateSchedule(sched Schedule) error {
+	if err := checkScheduleName(d.db, sched.Name, sched.ID); err != nil {
+		return err
+	}
+	if len(sched.Action) == 0 {
+		return fmt.Errorf("schedule %q has no action", sched.Name)
+	}
+
+	result, err := d.db.Exec(
+		"UPDATE schedules SET name = ?, enabled = ?, cron = ?, days = ?, times = ?, sun = ?, sun_offset = ?, action = ?, catch_up = ?, updated_at = ? WHERE id = ?",
+		sched.Name, sched.Enabled, sched.Cron, joinList(sched.Days), joinList(sched.Times), sched.Sun, sched.Offset,
+		string(sched.Action), sched.CatchUp, time.Now().Unix(), sched.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrScheduleNotFound, sched.ID)
+	}
+
+	log.Printf("Storage: Schedule %d (%q) updated", sched.ID, sched.Name)
+	return nil
+}
+
+// DeleteSchedule removes a schedule
+func (d *Database) DeleteSchedule(scheduleID int) error {
+	result, err := d.db.Exec("DELETE FROM schedules WHERE id = ?", scheduleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrScheduleNotFound, scheduleID)
+	}
+
+	log.Printf("Storage: Schedule %d deleted", scheduleID)
+	return nil
+}
+
+// SetScheduleLastRun records when a schedule last ran
+func (d *Database) SetScheduleLastRun(scheduleID int, at time.Time) error {
+	result, err := d.db.Exec("UPDATE schedules SET last_run = ? WHERE id = ?", at.Unix(), scheduleID)
+	if err != nil {
+		return fmt.Errorf("failed to record schedule run: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrScheduleNotFound, scheduleID)
+	}
+	return nil
+}
+
+// scanSchedule reads a schedule row
+func scanSchedule(row rowScanner) (*Schedule, error) {
+	var sched Schedule
+	var days, times, action string
+	var lastRun sql.NullInt64
+	var created, updated int64
+	err := row.Scan(&sched.ID, &sched.Name, &sched.Enabled, &sched.Cron, &days, &times, &sched.Sun, &sched.Offset, &action, &sched.CatchUp,
+		&lastRun, &created, &updated)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan schedule: %w", err)
+	}
+
+	sched.Days = splitList(days)
+	sched.Times = splitList(times)
+	sched.Action = []byte(action)
+	if lastRun.Valid {
+		t := unixTime(lastRun.Int64)
+		sched.LastRun = &t
+	}
+	sched.CreatedAt = unixTime(created)
+	sched.UpdatedAt = unixTime(updated)
+	return &sched, nil
+}
+
+// checkScheduleName verifies a name is non-empty and not used by any schedule other than excludeID
+func checkScheduleName(q sceneQuerier, name string, excludeID int) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrScheduleNameRequired
+	}
+
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM schedules WHERE name = ? AND id != ?", name, excludeID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check schedule name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %q", ErrScheduleNameTaken, name)
+	}
+	return nil
+}
+
+// joinList stores a list of short values as a comma-separated column
+func joinList(values []string) string {
+	trimmed := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// splitList reads a column written by joinList
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
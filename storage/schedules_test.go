@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduleCRUD(t *testing.T) {
+	db := newTestDatabase(t)
+
+	sched := Schedule{
+		Name:    "Morning",
+		Enabled: true,
+		Days:    []string{"mon", "tue", " wed "},
+		Times:   []string{"07:30", "12:00"},
+		Action:  json.RawMessage(`{"type":"scene","scene":"Work"}`),
+		CatchUp: true,
+	}
+	id, err := db.CreateSchedule(sched)
+	if err != nil {
+		t.Fatalf("CreateSchedule failed: %v", err)
+	}
+
+	got, err := db.GetSchedule(id)
+	if err != nil || got == nil {
+		t.Fatalf("GetSchedule() = %v, %v", got, err)
+	}
+	if got.Name != "Morning" || !got.Enabled || !got.CatchUp || got.LastRun != nil {
+		t.Errorf("Unexpected schedule: %+v", got)
+	}
+	if len(got.Days) != 3 || got.Days[2] != "wed" || len(got.Times) != 2 || got.Times[0] != "07:30" {
+		t.Errorf("Days and times not restored: %v %v", got.Days, got.Times)
+	}
+	if string(got.Action) != `{"type":"scene","scene":"Work"}` {
+		t.Errorf("Action not restored: %s", got.Action)
+	}
+
+	ran := time.Date(2024, 5, 6, 7, 30, 0, 0, time.UTC)
+	if err := db.SetScheduleLastRun(id, ran); err != nil {
+		t.Fatalf("SetScheduleLastRun failed: %v", err)
+	}
+
+	got.Name = "Weekday Morning"
+	got.Days = nil
+	got.Times = nil
+	got.Cron = "30 7 * * 1-5"
+	got.Enabled = false
+	if err := db.UpdateSchedule(*got); err != nil {
+		t.Fatalf("UpdateSchedule failed: %v", err)
+	}
+
+	got, _ = db.GetSchedule(id)
+	if got.Name != "Weekday Morning" || got.Enabled || got.Cron != "30 7 * * 1-5" || got.Days != nil {
+		t.Errorf("Update not applied: %+v", got)
+	}
+	if got.LastRun == nil || !got.LastRun.Equal(ran) {
+		t.Errorf("Expected last run %v to survive the update, got %v", ran, got.LastRun)
+	}
+
+	got.Cron = ""
+	got.Sun = "sunset"
+	got.Offset = -30
+	if err := db.UpdateSchedule(*got); err != nil {
+		t.Fatalf("UpdateSchedule failed: %v", err)
+	}
+	got, _ = db.GetSchedule(id)
+	if got.Sun != "sunset" || got.Offset != -30 || got.Cron != "" {
+		t.Errorf("Sun event not restored: %+v", got)
+	}
+
+	if err := db.DeleteSchedule(id); err != nil {
+		t.Fatalf("DeleteSchedule failed: %v", err)
+	}
+	if got, _ := db.GetSchedule(id); got != nil {
+		t.Error("Expected schedule to be deleted")
+	}
+	if err := db.DeleteSchedule(id); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	action := json.RawMessage(`{"type":"off"}`)
+	if _, err := db.CreateSchedule(Schedule{Name: "Night", Cron: "0 23 * * *", Action: action}); err != nil {
+		t.Fatalf("CreateSchedule failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		sched   Schedule
+		wantErr error
+	}{
+		{"empty name", Schedule{Name: "", Cron: "0 1 * * *", Action: action}, ErrScheduleNameRequired},
+		{"duplicate name", Schedule{Name: "Night", Cron: "0 1 * * *", Action: action}, ErrScheduleNameTaken},
+		{"no action", Schedule{Name: "Nothing", Cron: "0 1 * * *"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateSchedule(tt.sched)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := db.UpdateSchedule(Schedule{ID: 99, Name: "Ghost", Action: action}); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+	if err := db.SetScheduleLastRun(99, time.Now()); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package storage
 
+import "fmt"
+
 const (
 	// SQL schema for the lights database
 	schemaLEDBars = `
@@ -41,7 +43,28 @@ ON ledbars_leds(ledbar_id, channel_num);`
 CREATE TABLE IF NOT EXISTS scenes (
     id INTEGER PRIMARY KEY,
     name TEXT NOT NULL DEFAULT '',
-    bgcolor TEXT NOT NULL DEFAULT ''
+    bgcolor TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL DEFAULT 0
+);`
+
+	schemaScenesTags = `
+CREATE TABLE IF NOT EXISTS scenes_tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scene_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    FOREIGN KEY (scene_id) REFERENCES scenes(id) ON DELETE CASCADE,
+    UNIQUE(scene_id, tag)
+);`
+
+	// Stream Deck shortcut buttons pointing into the scene library; the slot
+	// limit is filled in from SceneShortcutSlots
+	schemaSceneShortcuts = `
+CREATE TABLE IF NOT EXISTS scene_shortcuts (
+    slot INTEGER PRIMARY KEY CHECK(slot >= 0 AND slot < %d),
+    scene_id INTEGER,
+    FOREIGN KEY (scene_id) REFERENCES scenes(id) ON DELETE SET NULL
 );`
 
 	schemaScenesLEDBarsLEDs = `
@@ -78,6 +101,128 @@ CREATE TABLE IF NOT EXISTS scenes_videolights (
 CREATE INDEX IF NOT EXISTS idx_scenes_ledbars_leds_lookup
 ON scenes_ledbars_leds(scene_id, ledbar_id, channel_num);`
 
+	// Keyframe sequences played back through scene transitions
+	schemaSequences = `
+CREATE TABLE IF NOT EXISTS sequences (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    loop INTEGER NOT NULL DEFAULT 0 CHECK(loop IN (0, 1)),
+    created_at INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL DEFAULT 0
+);`
+
+	// Keyframe light state is stored in the scene export JSON format, as keyframes are
+	// always read and written as a whole
+	schemaSequenceKeyframes = `
+CREATE TABLE IF NOT EXISTS sequence_keyframes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sequence_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    fade_ms INTEGER NOT NULL DEFAULT 0 CHECK(fade_ms >= 0),
+    hold_ms INTEGER NOT NULL DEFAULT 0 CHECK(hold_ms >= 0),
+    easing TEXT NOT NULL DEFAULT '',
+    devices TEXT NOT NULL,
+    FOREIGN KEY (sequence_id) REFERENCES sequences(id) ON DELETE CASCADE,
+    UNIQUE(sequence_id, position)
+);`
+
+	// Scheduled actions; the action is stored as JSON and interpreted by the scheduler
+	schemaSchedules = `
+CREATE TABLE IF NOT EXISTS schedules (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    enabled INTEGER NOT NULL DEFAULT 1 CHECK(enabled IN (0, 1)),
+    cron TEXT NOT NULL DEFAULT '',
+    days TEXT NOT NULL DEFAULT '',
+    times TEXT NOT NULL DEFAULT '',
+    sun TEXT NOT NULL DEFAULT '',
+    sun_offset INTEGER NOT NULL DEFAULT 0,
+    action TEXT NOT NULL,
+    catch_up INTEGER NOT NULL DEFAULT 0 CHECK(catch_up IN (0, 1)),
+    last_run INTEGER,
+    created_at INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL DEFAULT 0
+);`
+
+	// Circadian mode settings (a single row)
+	schemaCircadian = `
+CREATE TABLE IF NOT EXISTS circadian (
+    id INTEGER PRIMARY KEY CHECK(id = 0),
+    led_strip INTEGER NOT NULL DEFAULT 0 CHECK(led_strip IN (0, 1)),
+    led_bar INTEGER NOT NULL DEFAULT 0 CHECK(led_bar IN (0, 1)),
+    curve TEXT NOT NULL DEFAULT '[]'
+);`
+
+	schemaSleepTimers = `
+CREATE TABLE IF NOT EXISTS sleep_timers (
+    target TEXT PRIMARY KEY,
+    started INTEGER NOT NULL,
+    deadline INTEGER NOT NULL,
+    fade INTEGER NOT NULL DEFAULT 0 CHECK(fade >= 0)
+);`
+
+	// Event-condition-action rules
+	schemaRules = `
+CREATE TABLE IF NOT EXISTS rules (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    enabled INTEGER NOT NULL DEFAULT 1 CHECK(enabled IN (0, 1)),
+    "trigger" TEXT NOT NULL,
+    conditions TEXT NOT NULL DEFAULT '',
+    actions TEXT NOT NULL,
+    cooldown INTEGER NOT NULL DEFAULT 0 CHECK(cooldown >= 0),
+    last_fired INTEGER,
+    created_at INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL DEFAULT 0
+);`
+
+	// On-air indicator settings (a single row)
+	schemaOnAir = `
+CREATE TABLE IF NOT EXISTS on_air (
+    id INTEGER PRIMARY KEY CHECK(id = 0),
+    active INTEGER NOT NULL DEFAULT 0 CHECK(active IN (0, 1)),
+    lights TEXT NOT NULL DEFAULT '[]',
+    color TEXT NOT NULL DEFAULT '',
+    pulse INTEGER NOT NULL DEFAULT 0 CHECK(pulse >= 0)
+);`
+
+	// Outbound webhooks, and the log of attempts to deliver to them
+	schemaWebhooks = `
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL DEFAULT '',
+    events TEXT NOT NULL DEFAULT '[]',
+    enabled INTEGER NOT NULL DEFAULT 1 CHECK(enabled IN (0, 1)),
+    created_at INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL DEFAULT 0
+);`
+
+	schemaWebhookDeliveries = `
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL,
+    delivery TEXT NOT NULL,
+    event TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    duration INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);`
+
+	schemaHistory = `
+CREATE TABLE IF NOT EXISTS history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    devices TEXT NOT NULL,
+    undone INTEGER NOT NULL DEFAULT 0 CHECK(undone IN (0, 1)),
+    created_at INTEGER NOT NULL
+);`
+
 	// Default data initialization
 	initLEDBars = `INSERT OR IGNORE INTO ledbars (id) VALUES (0);`
 
@@ -86,13 +231,6 @@ ON scenes_ledbars_leds(scene_id, ledbar_id, channel_num);`
 	initVideoLights = `
 INSERT OR IGNORE INTO videolights (id, "on", brightness) VALUES (0, 0, 0);
 INSERT OR IGNORE INTO videolights (id, "on", brightness) VALUES (1, 0, 0);`
-
-	// Initialize 4 empty scene slots (IDs 0-3)
-	initScenes = `
-INSERT OR IGNORE INTO scenes (id) VALUES (0);
-INSERT OR IGNORE INTO scenes (id) VALUES (1);
-INSERT OR IGNORE INTO scenes (id) VALUES (2);
-INSERT OR IGNORE INTO scenes (id) VALUES (3);`
 )
 
 // allSchemas returns all CREATE TABLE statements in order
@@ -108,6 +246,18 @@ func allSchemas() []string {
 		schemaScenesLEDStrips,
 		schemaScenesVideoLights,
 		schemaScenesIndex,
+		schemaScenesTags,
+		fmt.Sprintf(schemaSceneShortcuts, SceneShortcutSlots),
+		schemaSequences,
+		schemaSequenceKeyframes,
+		schemaSchedules,
+		schemaCircadian,
+		schemaSleepTimers,
+		schemaRules,
+		schemaOnAir,
+		schemaWebhooks,
+		schemaWebhookDeliveries,
+		schemaHistory,
 	}
 }
 
@@ -117,6 +267,5 @@ func allInitData() []string {
 		initLEDBars,
 		initLEDStrips,
 		initVideoLights,
-		initScenes,
 	}
 }
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ListSequences returns every sequence, including keyframes, ordered by name
+func (d *Database) ListSequences() ([]Sequence, error) {
+	rows, err := d.db.Query(
+		"SELECT id, name, description, loop, created_at, updated_at FROM sequences ORDER BY name COLLATE NOCASE, id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sequences: %w", err)
+	}
+	defer rows.Close()
+
+	sequences := make([]Sequence, 0)
+	for rows.Next() {
+		seq, err := scanSequence(rows)
+		if err != nil {
+			return nil, err
+		}
+		sequences = append(sequences, *seq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sequences: %w", err)
+	}
+	rows.Close()
+
+	for i := range sequences {
+		sequences[i].Keyframes, err = loadKeyframes(d.db, sequences[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sequences, nil
+}
+
+// GetSequence returns a sequence and its keyframes (returns nil if it doesn't exist)
+func (d *Database) GetSequence(sequenceID int) (*Sequence, error) {
+	return d.getSequenceWhere("id = ?", sequenceID)
+}
+
+// FindSequenceByName returns the sequence with the given name (returns nil if none)
+func (d *Database) FindSequenceByName(name string) (*Sequence, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return d.getSequenceWhere("name = ?", name)
+}
+
+// getSequenceWhere loads a single sequence and its keyframes
+func (d *Database) getSequenceWhere(where string, arg interface{}) (*Sequence, error) {
+	row := d.db.QueryRow(
+		"SELECT id, name, description, loop, created_at, updated_at FROM sequences WHERE "+where,
+		arg,
+	)
+	seq, err := scanSequence(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seq.Keyframes, err = loadKeyframes(d.db, seq.ID)
+	if err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+// CreateSequence adds a sequence with its keyframes and returns its ID
+func (d *Database) CreateSequence(seq Sequence) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkSequenceName(tx, seq.Name, -1); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	result, err := tx.Exec(
+		"INSERT INTO sequences (name, description, loop, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		seq.Name, seq.Description, seq.Loop, now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create sequence: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get new sequence ID: %w", err)
+	}
+
+	if err := saveKeyframes(tx, int(id), seq.Keyframes); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Sequence %d (%q) created with %d keyframes", id, seq.Name, len(seq.Keyframes))
+	return int(id), nil
+}
+
+// UpdateSequence replaces the name, description, loop flag and keyframes of a sequence
+func (d *Database) UpdateSequence(seq Sequence) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkSequenceName(tx, seq.Name, seq.ID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE sequences SET name = ?, description = ?, loop = ?, updated_at = ? WHERE id = ?",
+		seq.Name, seq.Description, seq.Loop, time.Now().Unix(), seq.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update sequence: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrSequenceNotFound, seq.ID)
+	}
+
+	if err := saveKeyframes(tx, seq.ID, seq.Keyframes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Storage: Sequence %d (%q) updated", seq.ID, seq.Name)
+	return nil
+}
+
+// DeleteSequence removes a sequence and its keyframes
+func (d *Database) DeleteSequence(sequenceID int) error {
+	result, err := d.db.Exec("DELETE FROM sequences WHERE id = ?", sequenceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete sequence: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrSequenceNotFound, sequenceID)
+	}
+
+	log.Printf("Storage: Sequence %d deleted", sequenceID)
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSequence reads a sequence row without its keyframes
+func scanSequence(row rowScanner) (*Sequence, error) {
+	var seq Sequence
+	var created, updated int64
+	err := row.Scan(&seq.ID, &seq.Name, &seq.Description, &seq.Loop, &created, &updated)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sequence: %w", err)
+	}
+	seq.CreatedAt = unixTime(created)
+	seq.UpdatedAt = unixTime(updated)
+	return &seq, nil
+}
+
+// checkSequenceName verifies a name is non-empty and not used by any sequence other than excludeID
+func checkSequenceName(q sceneQuerier, name string, excludeID int) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrSequenceNameRequired
+	}
+
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM sequences WHERE name = ? AND id != ?", name, excludeID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check sequence name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %q", ErrSequenceNameTaken, name)
+	}
+	return nil
+}
+
+// saveKeyframes replaces the keyframes of a sequence
+func saveKeyframes(q sceneQuerier, sequenceID int, keyframes []Keyframe) error {
+	if _, err := q.Exec("DELETE FROM sequence_keyframes WHERE sequence_id = ?", sequenceID); err != nil {
+		return fmt.Errorf("failed to delete old keyframes: %w", err)
+	}
+
+	for i, kf := range keyframes {
+		if kf.Devices == nil || kf.Devices.IsEmpty() {
+			return fmt.Errorf("keyframe %d has no light state", i+1)
+		}
+		if kf.Fade < 0 || kf.Hold < 0 {
+			return fmt.Errorf("keyframe %d: fade and hold must not be negative", i+1)
+		}
+
+		devices, err := json.Marshal(kf.Devices)
+		if err != nil {
+			return fmt.Errorf("failed to encode keyframe %d: %w", i+1, err)
+		}
+
+		_, err = q.Exec(
+			"INSERT INTO sequence_keyframes (sequence_id, position, fade_ms, hold_ms, easing, devices) VALUES (?, ?, ?, ?, ?, ?)",
+			sequenceID, i, kf.Fade, kf.Hold, kf.Easing, string(devices),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save keyframe %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// loadKeyframes returns the keyframes of a sequence in order
+func loadKeyframes(q sceneQuerier, sequenceID int) ([]Keyframe, error) {
+	rows, err := q.Query(
+		"SELECT fade_ms, hold_ms, easing, devices FROM sequence_keyframes WHERE sequence_id = ? ORDER BY position",
+		sequenceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keyframes: %w", err)
+	}
+	defer rows.Close()
+
+	keyframes := make([]Keyframe, 0)
+	for rows.Next() {
+		var kf Keyframe
+		var devices string
+		if err := rows.Scan(&kf.Fade, &kf.Hold, &kf.Easing, &devices); err != nil {
+			return nil, fmt.Errorf("failed to scan keyframe: %w", err)
+		}
+		kf.Devices = &SceneData{}
+		if err := json.Unmarshal([]byte(devices), kf.Devices); err != nil {
+			return nil, fmt.Errorf("failed to decode keyframe %d of sequence %d: %w", len(keyframes)+1, sequenceID, err)
+		}
+		keyframes = append(keyframes, kf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating keyframes: %w", err)
+	}
+	return keyframes, nil
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testKeyframes returns a two-step ramp: strip up to full red, then video light 1 off
+func testKeyframes() []Keyframe {
+	return []Keyframe{
+		{
+			Devices: &SceneData{LEDStrip: &LEDStripState{Red: 255}},
+			Fade:    2000,
+			Hold:    500,
+			Easing:  "ease-in-out",
+		},
+		{
+			Devices: &SceneData{
+				LEDBarLEDs:  []LEDBarLEDState{{LEDBarID: 0, ChannelNum: 64, Value: 30}},
+				VideoLights: []VideoLightState{{ID: 0, On: false, Brightness: 0}},
+			},
+			Fade: 60000,
+		},
+	}
+}
+
+func TestCreateAndGetSequence(t *testing.T) {
+	db := newTestDatabase(t)
+
+	id, err := db.CreateSequence(Sequence{Name: "Wind Down", Description: "Evening ramp", Loop: true, Keyframes: testKeyframes()})
+	if err != nil {
+		t.Fatalf("CreateSequence failed: %v", err)
+	}
+
+	seq, err := db.GetSequence(id)
+	if err != nil {
+		t.Fatalf("GetSequence failed: %v", err)
+	}
+	if seq == nil {
+		t.Fatal("Expected sequence, got nil")
+	}
+	if seq.Name != "Wind Down" || seq.Description != "Evening ramp" || !seq.Loop {
+		t.Errorf("Unexpected metadata: %+v", seq)
+	}
+	if len(seq.Keyframes) != 2 {
+		t.Fatalf("Expected 2 keyframes, got %d", len(seq.Keyframes))
+	}
+
+	first := seq.Keyframes[0]
+	if first.Devices.LEDStrip == nil || first.Devices.LEDStrip.Red != 255 {
+		t.Errorf("First keyframe strip not restored: %+v", first.Devices.LEDStrip)
+	}
+	if first.Fade != 2000 || first.Hold != 500 || first.Easing != "ease-in-out" {
+		t.Errorf("First keyframe timing not restored: %+v", first)
+	}
+
+	second := seq.Keyframes[1]
+	if second.Devices.LEDStrip != nil {
+		t.Error("Second keyframe should leave the strip out")
+	}
+	if len(second.Devices.LEDBarLEDs) != 1 || second.Devices.LEDBarLEDs[0].ChannelNum != 64 {
+		t.Errorf("Second keyframe LED bar not restored: %+v", second.Devices.LEDBarLEDs)
+	}
+	if len(second.Devices.VideoLights) != 1 || second.Devices.VideoLights[0].ID != 0 {
+		t.Errorf("Second keyframe video light not restored: %+v", second.Devices.VideoLights)
+	}
+
+	if got := seq.Duration(); got != 62500*time.Millisecond {
+		t.Errorf("Expected duration 62.5s, got %v", got)
+	}
+
+	found, err := db.FindSequenceByName("Wind Down")
+	if err != nil || found == nil || found.ID != id {
+		t.Errorf("FindSequenceByName() = %v, %v; want ID %d", found, err, id)
+	}
+	missing, err := db.FindSequenceByName("Nope")
+	if err != nil || missing != nil {
+		t.Errorf("Expected nil for a missing sequence, got %v, %v", missing, err)
+	}
+}
+
+func TestSequenceValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if _, err := db.CreateSequence(Sequence{Name: "Countdown", Keyframes: testKeyframes()}); err != nil {
+		t.Fatalf("CreateSequence failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		seq     Sequence
+		wantErr error
+	}{
+		{"empty name", Sequence{Name: " ", Keyframes: testKeyframes()}, ErrSequenceNameRequired},
+		{"duplicate name", Sequence{Name: "Countdown", Keyframes: testKeyframes()}, ErrSequenceNameTaken},
+		{"empty keyframe", Sequence{Name: "Blank", Keyframes: []Keyframe{{Devices: &SceneData{}}}}, nil},
+		{"negative fade", Sequence{Name: "Backwards", Keyframes: []Keyframe{{Devices: testKeyframes()[0].Devices, Fade: -1}}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateSequence(tt.seq)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Failed creates must not leave anything behind
+	sequences, err := db.ListSequences()
+	if err != nil {
+		t.Fatalf("ListSequences failed: %v", err)
+	}
+	if len(sequences) != 1 {
+		t.Errorf("Expected 1 sequence, got %d", len(sequences))
+	}
+}
+
+func TestUpdateAndDeleteSequence(t *testing.T) {
+	db := newTestDatabase(t)
+
+	id, err := db.CreateSequence(Sequence{Name: "Go Live", Keyframes: testKeyframes()})
+	if err != nil {
+		t.Fatalf("CreateSequence failed: %v", err)
+	}
+	if _, err := db.CreateSequence(Sequence{Name: "Another", Keyframes: testKeyframes()}); err != nil {
+		t.Fatalf("CreateSequence failed: %v", err)
+	}
+
+	update := Sequence{ID: id, Name: "Go Live Countdown", Keyframes: testKeyframes()[:1]}
+	if err := db.UpdateSequence(update); err != nil {
+		t.Fatalf("UpdateSequence failed: %v", err)
+	}
+
+	seq, _ := db.GetSequence(id)
+	if seq.Name != "Go Live Countdown" || len(seq.Keyframes) != 1 {
+		t.Errorf("Update not applied: %+v", seq)
+	}
+
+	update.Name = "Another"
+	if err := db.UpdateSequence(update); !errors.Is(err, ErrSequenceNameTaken) {
+		t.Errorf("Expected ErrSequenceNameTaken, got %v", err)
+	}
+	if err := db.UpdateSequence(Sequence{ID: 999, Name: "Ghost"}); !errors.Is(err, ErrSequenceNotFound) {
+		t.Errorf("Expected ErrSequenceNotFound, got %v", err)
+	}
+
+	if err := db.DeleteSequence(id); err != nil {
+		t.Fatalf("DeleteSequence failed: %v", err)
+	}
+	if seq, _ := db.GetSequence(id); seq != nil {
+		t.Error("Expected sequence to be deleted")
+	}
+	if err := db.DeleteSequence(id); !errors.Is(err, ErrSequenceNotFound) {
+		t.Errorf("Expected ErrSequenceNotFound, got %v", err)
+	}
+
+	// Keyframes go with the sequence
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM sequence_keyframes WHERE sequence_id = ?", id).Scan(&count); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected keyframes to be deleted, found %d", count)
+	}
+
+	sequences, _ := db.ListSequences()
+	if len(sequences) != 1 || sequences[0].Name != "Another" || len(sequences[0].Keyframes) != 2 {
+		t.Errorf("Unexpected sequences after delete: %+v", sequences)
+	}
+}
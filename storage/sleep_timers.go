@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ListSleepTimers returns every pending sleep timer ordered by deadline
+func (d *Database) ListSleepTimers() ([]SleepTimer, error) {
+	rows, err := d.db.Query("SELECT target, started, deadline, fade FROM sleep_timers ORDER BY deadline, target")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sleep timers: %w", err)
+	}
+	defer rows.Close()
+
+	timers := []SleepTimer{}
+	for rows.Next() {
+		var timer SleepTimer
+		var started, deadline int64
+		if err := rows.Scan(&timer.Target, &started, &deadline, &timer.Fade); err != nil {
+			return nil, fmt.Errorf("failed to scan sleep timer: %w", err)
+		}
+		timer.Started = time.UnixMilli(started)
+		timer.Deadline = time.UnixMilli(deadline)
+		timers = append(timers, timer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sleep timers: %w", err)
+	}
+	return timers, nil
+}
+
+// SaveSleepTimer adds a sleep timer, replacing any existing timer for the same target
+func (d *Database) SaveSleepTimer(timer SleepTimer) error {
+	_, err := d.db.Exec(
+		"INSERT OR REPLACE INTO sleep_timers (target, started, deadline, fade) VALUES (?, ?, ?, ?)",
+		timer.Target, timer.Started.UnixMilli(), timer.Deadline.UnixMilli(), timer.Fade,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save sleep timer: %w", err)
+	}
+
+	log.Printf("Storage: Sleep timer saved for %s (deadline %s)", timer.Target, timer.Deadline.Format(time.RFC3339))
+	return nil
+}
+
+// DeleteSleepTimer removes the sleep timer for a target (no error if there isn't one)
+func (d *Database) DeleteSleepTimer(target string) error {
+	if _, err := d.db.Exec("DELETE FROM sleep_timers WHERE target = ?", target); err != nil {
+		return fmt.Errorf("failed to delete sleep timer: %w", err)
+	}
+	return nil
+}
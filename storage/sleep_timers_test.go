@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSleepTimers(t *testing.T) {
+	db := newTestDatabase(t)
+
+	timers, err := db.ListSleepTimers()
+	if err != nil {
+		t.Fatalf("ListSleepTimers failed: %v", err)
+	}
+	if len(timers) != 0 {
+		t.Fatalf("Expected no timers, got %+v", timers)
+	}
+
+	now := time.Date(2026, 3, 2, 22, 0, 0, 0, time.UTC)
+	all := SleepTimer{Target: "all", Started: now, Deadline: now.Add(30 * time.Minute), Fade: 60000}
+	strip := SleepTimer{Target: "ledStrip", Started: now, Deadline: now.Add(10*time.Minute + 500*time.Millisecond)}
+	for _, timer := range []SleepTimer{all, strip} {
+		if err := db.SaveSleepTimer(timer); err != nil {
+			t.Fatalf("SaveSleepTimer failed: %v", err)
+		}
+	}
+
+	// Saving again replaces the timer for that target
+	all.Deadline = now.Add(time.Hour)
+	if err := db.SaveSleepTimer(all); err != nil {
+		t.Fatalf("SaveSleepTimer failed: %v", err)
+	}
+
+	timers, err = db.ListSleepTimers()
+	if err != nil {
+		t.Fatalf("ListSleepTimers failed: %v", err)
+	}
+	if len(timers) != 2 {
+		t.Fatalf("Expected 2 timers, got %+v", timers)
+	}
+	if timers[0].Target != "ledStrip" || !timers[0].Deadline.Equal(strip.Deadline) || timers[0].Fade != 0 {
+		t.Errorf("Unexpected first timer %+v", timers[0])
+	}
+	if timers[1].Target != "all" || !timers[1].Deadline.Equal(all.Deadline) || !timers[1].Started.Equal(now) || timers[1].Fade != 60000 {
+		t.Errorf("Unexpected second timer %+v", timers[1])
+	}
+
+	if err := db.DeleteSleepTimer("ledStrip"); err != nil {
+		t.Fatalf("DeleteSleepTimer failed: %v", err)
+	}
+	if err := db.DeleteSleepTimer("ledStrip"); err != nil {
+		t.Fatalf("Deleting a missing timer should succeed: %v", err)
+	}
+	timers, _ = db.ListSleepTimers()
+	if len(timers) != 1 || timers[0].Target != "all" {
+		t.Errorf("Expected only the global timer left, got %+v", timers)
+	}
+}
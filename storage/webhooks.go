@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// webhookColumns are the columns read by scanWebhook, in order
+const webhookColumns = "id, name, url, secret, events, enabled, created_at, updated_at"
+
+// ListWebhooks returns every webhook ordered by name
+func (d *Database) ListWebhooks() ([]Webhook, error) {
+	rows, err := d.db.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY name COLLATE NOCASE, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := make([]Webhook, 0)
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// GetWebhook returns a webhook (returns nil if it doesn't exist)
+func (d *Database) GetWebhook(webhookID int) (*Webhook, error) {
+	row := d.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", webhookID)
+	hook, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// CreateWebhook adds a webhook and returns its ID
+func (d *Database) CreateWebhook(hook Webhook) (int, error) {
+	events, err := checkWebhook(d.db, hook, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	result, err := d.db.Exec(
+		"INSERT INTO webhooks (name, url, secret, events, enabled, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		hook.Name, hook.URL, hook.Secret, events, hook.Enabled, now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get new webhook ID: %w", err)
+	}
+
+	log.Printf("Storage: Webhook %d (%q) created", id, hook.Name)
+	return int(id), nil
+}
+
+// UpdateWebhook replaces a webhook
+func (d *Database) UpdateWebhook(hook Webhook) error {
+	events, err := checkWebhook(d.db, hook, hook.ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := d.db.Exec(
+		"UPDATE webhooks SET name = ?, url = ?, secret = ?, events = ?, enabled = ?, updated_at = ? WHERE id = ?",
+		hook.Name, hook.URL, hook.Secret, events, hook.Enabled, time.Now().Unix(), hook.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrWebhookNotFound, hook.ID)
+	}
+
+	log.Printf("Storage: Webhook %d (%q) updated", hook.ID, hook.Name)
+	return nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (d *Database) DeleteWebhook(webhookID int) error {
+	result, err := d.db.Exec("DELETE FROM webhooks WHERE id = ?", webhookID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrWebhookNotFound, webhookID)
+	}
+
+	// Not left to the foreign key, which only cascades on connections that turned it on
+	if _, err := d.db.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", webhookID); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	log.Printf("Storage: Webhook %d deleted", webhookID)
+	return nil
+}
+
+// AddWebhookDelivery records an attempt to deliver to a webhook, keeping only
+// the most recent WebhookDeliveryLogSize attempts per webhook
+func (d *Database) AddWebhookDelivery(delivery WebhookDelivery) error {
+	createdAt := delivery.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	_, err := d.db.Exec(
+		"INSERT INTO webhook_deliveries (webhook_id, delivery, event, attempt, status, error, duration, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		delivery.WebhookID, delivery.Delivery, delivery.Event, delivery.Attempt, delivery.Status, delivery.Error,
+		delivery.Duration, createdAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+
+	_, err = d.db.Exec(
+		`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND id NOT IN (
+			SELECT id FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?)`,
+		delivery.WebhookID, delivery.WebhookID, WebhookDeliveryLogSize,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to trim webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns a webhook's delivery attempts, newest first
+func (d *Database) ListWebhookDeliveries(webhookID int, limit int) ([]WebhookDelivery, error) {
+	rows, err := d.db.Query(
+		`SELECT id, webhook_id, delivery, event, attempt, status, error, duration, created_at
+		FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`,
+		webhookID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var created int64
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Delivery, &delivery.Event, &delivery.Attempt,
+			&delivery.Status, &delivery.Error, &delivery.Duration, &created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		delivery.CreatedAt = time.UnixMilli(created)
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// scanWebhook reads a webhook row
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var hook Webhook
+	var events string
+	var created, updated int64
+	err := row.Scan(&hook.ID, &hook.Name, &hook.URL, &hook.Secret, &events, &hook.Enabled, &created, &updated)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan webhook: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(events), &hook.Events); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook %d events: %w", hook.ID, err)
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	hook.CreatedAt = unixTime(created)
+	hook.UpdatedAt = unixTime(updated)
+	return &hook, nil
+}
+
+// checkWebhook verifies a webhook has a URL and a non-empty name not used by
+// any webhook other than excludeID, returning its events encoded for storage
+func checkWebhook(q sceneQuerier, hook Webhook, excludeID int) (string, error) {
+	if strings.TrimSpace(hook.Name) == "" {
+		return "", ErrWebhookNameRequired
+	}
+	if hook.URL == "" {
+		return "", fmt.Errorf("webhook %q has no URL", hook.Name)
+	}
+
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM webhooks WHERE name = ? AND id != ?", hook.Name, excludeID).Scan(&count)
+	if err != nil {
+		return "", fmt.Errorf("failed to check webhook name: %w", err)
+	}
+	if count > 0 {
+		return "", fmt.Errorf("%w: %q", ErrWebhookNameTaken, hook.Name)
+	}
+
+	events := hook.Events
+	if events == nil {
+		events = []string{}
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
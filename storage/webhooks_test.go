@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWebhookCRUD(t *testing.T) {
+	db := newTestDatabase(t)
+
+	id, err := db.CreateWebhook(Webhook{
+		Name:    "Home Assistant",
+		URL:     "http://ha.local:8123/api/webhook/lights",
+		Secret:  "s3cret",
+		Events:  []string{"scene.recalled"},
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+
+	got, err := db.GetWebhook(id)
+	if err != nil || got == nil {
+		t.Fatalf("GetWebhook() = %v, %v", got, err)
+	}
+	if got.Name != "Home Assistant" || got.Secret != "s3cret" || !got.Enabled || len(got.Events) != 1 || got.Events[0] != "scene.recalled" {
+		t.Errorf("Unexpected webhook: %+v", got)
+	}
+
+	got.Events = nil
+	got.Enabled = false
+	if err := db.UpdateWebhook(*got); err != nil {
+		t.Fatalf("UpdateWebhook failed: %v", err)
+	}
+	got, _ = db.GetWebhook(id)
+	if got.Enabled || got.Events == nil || len(got.Events) != 0 {
+		t.Errorf("Update not applied: %+v", got)
+	}
+
+	if _, err := db.CreateWebhook(Webhook{Name: "Home Assistant", URL: "http://other"}); !errors.Is(err, ErrWebhookNameTaken) {
+		t.Errorf("Expected ErrWebhookNameTaken, got %v", err)
+	}
+	if _, err := db.CreateWebhook(Webhook{Name: " ", URL: "http://other"}); !errors.Is(err, ErrWebhookNameRequired) {
+		t.Errorf("Expected ErrWebhookNameRequired, got %v", err)
+	}
+	if _, err := db.CreateWebhook(Webhook{Name: "No URL"}); err == nil {
+		t.Error("Expected a webhook without a URL to be rejected")
+	}
+
+	list, err := db.ListWebhooks()
+	if err != nil || len(list) != 1 || list[0].ID != id {
+		t.Errorf("ListWebhooks() = %v, %v", list, err)
+	}
+
+	if err := db.DeleteWebhook(id); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	if got, _ := db.GetWebhook(id); got != nil {
+		t.Errorf("Expected the webhook to be gone, got %+v", got)
+	}
+	if err := db.DeleteWebhook(id); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+	if err := db.UpdateWebhook(Webhook{ID: id, Name: "Gone", URL: "http://gone"}); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	db := newTestDatabase(t)
+
+	id, err := db.CreateWebhook(Webhook{Name: "Log", URL: "http://log.local", Enabled: true})
+	if err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+
+	for i := 1; i <= WebhookDeliveryLogSize+5; i++ {
+		delivery := WebhookDelivery{WebhookID: id, Delivery: fmt.Sprintf("d%d", i), Event: "device.changed", Attempt: 1, Status: 200, Duration: i}
+		if err := db.AddWebhookDelivery(delivery); err != nil {
+			t.Fatalf("AddWebhookDelivery failed: %v", err)
+		}
+	}
+
+	latest, err := db.ListWebhookDeliveries(id, 2)
+	if err != nil || len(latest) != 2 {
+		t.Fatalf("ListWebhookDeliveries() = %v, %v", latest, err)
+	}
+	if latest[0].Delivery != fmt.Sprintf("d%d", WebhookDeliveryLogSize+5) || latest[0].Status != 200 || latest[0].CreatedAt.IsZero() {
+		t.Errorf("Expected the newest delivery first, got %+v", latest[0])
+	}
+
+	all, _ := db.ListWebhookDeliveries(id, 1000)
+	if len(all) != WebhookDeliveryLogSize {
+		t.Errorf("Expected the log to be trimmed to %d, got %d", WebhookDeliveryLogSize, len(all))
+	}
+
+	db.DeleteWebhook(id)
+	if all, _ := db.ListWebhookDeliveries(id, 1000); len(all) != 0 {
+		t.Errorf("Expected the log to go with the webhook, got %d deliveries", len(all))
+	}
+}
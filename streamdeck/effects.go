@@ -0,0 +1,207 @@
+package streamdeck
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+
+	"github.com/kevin/office_lights/effects"
+)
+
+// effectDeviceLabels are the button labels for the effect devices, in button order
+var effectDeviceLabels = [4]string{"LED Strip", "LED Bar", "Video 1", "Video 2"}
+
+// effectParamSteps is the number of dial ticks from a parameter's minimum to its maximum
+const effectParamSteps = 20
+
+// selectedEffect returns the effect chosen for the current device
+func (s *StreamDeckUI) selectedEffect() *effects.Definition {
+	defs := effects.ForDevice(s.effectDevice)
+	if len(defs) == 0 {
+		return nil
+	}
+	index := ((s.effectIndex % len(defs)) + len(defs)) % len(defs)
+	return defs[index]
+}
+
+// effectParamsFor returns the dial-adjusted parameters of an effect, filled in with defaults
+func (s *StreamDeckUI) effectParamsFor(def *effects.Definition) effects.Params {
+	params := s.effectParams[def.Name]
+	if params == nil {
+		params = make(effects.Params, len(def.Params))
+		for _, spec := range def.Params {
+			params[spec.Name] = spec.Default
+		}
+		s.effectParams[def.Name] = params
+	}
+	return params
+}
+
+// selectEffectDevice switches the effect controls to another device
+// The selected effect follows whatever is already running there.
+func (s *StreamDeckUI) selectEffectDevice(index int) {
+	s.effectDevice = effects.Devices[index]
+	s.effectIndex = 0
+
+	if status, ok := s.effects.RunningOn(s.effectDevice); ok {
+		for i, def := range effects.ForDevice(s.effectDevice) {
+			if def.Name == status.Effect {
+				s.effectIndex = i
+			}
+		}
+	}
+
+	s.refreshEffects()
+}
+
+// rotateEffectDial chooses the effect (dial 0) or adjusts one of its first three parameters (dials 1-3)
+func (s *StreamDeckUI) rotateEffectDial(dialIndex int, ticks int) {
+	def := s.selectedEffect()
+	if def == nil {
+		return
+	}
+
+	if dialIndex == 0 {
+		s.effectIndex += ticks
+		s.refreshEffects()
+		return
+	}
+
+	if dialIndex > len(def.Params) {
+		log.Printf("Dial %d is inactive for effect %s", dialIndex, def.Name)
+		return
+	}
+
+	spec := def.Params[dialIndex-1]
+	params := s.effectParamsFor(def)
+	step := (spec.Max - spec.Min) / effectParamSteps
+	params[spec.Name] = math.Max(spec.Min, math.Min(spec.Max, params[spec.Name]+float64(ticks)*step))
+
+	s.restartRunningEffect(def)
+	s.refreshEffects()
+}
+
+// pressEffectDial starts or stops the effect (dial 0) or resets a parameter to its default (dials 1-3)
+func (s *StreamDeckUI) pressEffectDial(dialIndex int) {
+	def := s.selectedEffect()
+	if def == nil {
+		return
+	}
+
+	if dialIndex == 0 {
+		if status, ok := s.effects.RunningOn(s.effectDevice); ok && status.Effect == def.Name {
+			s.effects.Stop(s.effectDevice)
+		} else if err := s.effects.Start(def.Name, s.effectDevice, s.effectParamsFor(def)); err != nil {
+			log.Printf("Error starting effect %s: %v", def.Name, err)
+		}
+		s.refreshEffects()
+		return
+	}
+
+	if dialIndex > len(def.Params) {
+		return
+	}
+	spec := def.Params[dialIndex-1]
+	s.effectParamsFor(def)[spec.Name] = spec.Default
+
+	s.restartRunningEffect(def)
+	s.refreshEffects()
+}
+
+// restartRunningEffect applies changed parameters to the effect if it is running on the current device
+func (s *StreamDeckUI) restartRunningEffect(def *effects.Definition) {
+	status, ok := s.effects.RunningOn(s.effectDevice)
+	if !ok || status.Effect != def.Name {
+		return
+	}
+	if err := s.effects.Start(def.Name, s.effectDevice, s.effectParamsFor(def)); err != nil {
+		log.Printf("Error updating effect %s: %v", def.Name, err)
+	}
+}
+
+// refreshEffects redraws the buttons and touchscreen after an effects tab change
+func (s *StreamDeckUI) refreshEffects() {
+	if err := s.updateButtons(); err != nil {
+		log.Printf("Error updating buttons: %v", err)
+	}
+	if err := s.updateTouchscreen(); err != nil {
+		log.Printf("Error updating touchscreen: %v", err)
+	}
+}
+
+// renderEffectDeviceButton renders a device selection button, showing the effect running on it
+func (s *StreamDeckUI) renderEffectDeviceButton(index int) image.Image {
+	device := effects.Devices[index]
+	label := effectDeviceLabels[index]
+	if status, ok := s.effects.RunningOn(device); ok {
+		label = status.Effect
+		if device != s.effectDevice {
+			return s.renderColoredButton(label, color.RGBA{40, 110, 60, 255})
+		}
+	}
+	return s.renderTextButton(label, device == s.effectDevice)
+}
+
+// renderEffectsTouchscreen renders the touchscreen for Tab 3 (Effects)
+func (s *StreamDeckUI) renderEffectsTouchscreen() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, touchWidth, touchHeight))
+
+	// Background
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{20, 20, 20, 255}}, image.Point{}, draw.Src)
+
+	def := s.selectedEffect()
+	if def == nil {
+		drawTextAt(img, "No effects", touchWidth/2, touchHeight/2, color.RGBA{100, 100, 100, 255}, true)
+		return img
+	}
+
+	s.renderEffectSection(img, def)
+
+	params := s.effectParamsFor(def)
+	for i := 1; i < 4; i++ {
+		if i > len(def.Params) {
+			x := i * sectionWidth
+			draw.Draw(img, image.Rect(x, 0, x+sectionWidth, touchHeight), &image.Uniform{color.RGBA{10, 10, 10, 255}}, image.Point{x, 0}, draw.Src)
+			continue
+		}
+		s.renderEffectParamSection(img, i, def.Params[i-1], params[def.Params[i-1].Name])
+	}
+
+	return img
+}
+
+// renderEffectSection renders the first section: the selected effect and whether it is running
+func (s *StreamDeckUI) renderEffectSection(img *image.RGBA, def *effects.Definition) {
+	bounds := image.Rect(0, 0, sectionWidth, touchHeight)
+	draw.Draw(img, bounds, &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{}, draw.Src)
+	drawVerticalLine(img, sectionWidth-1, 0, touchHeight, color.RGBA{80, 80, 80, 255})
+
+	drawTextAt(img, "Effect", sectionWidth/2, 15, color.RGBA{150, 150, 150, 255}, true)
+	drawTextAt(img, def.Name, sectionWidth/2, 45, color.RGBA{255, 255, 255, 255}, true)
+
+	status := "Click to start"
+	statusColor := color.RGBA{80, 80, 80, 255}
+	if running, ok := s.effects.RunningOn(s.effectDevice); ok && running.Effect == def.Name {
+		status = "Running"
+		statusColor = color.RGBA{100, 200, 100, 255}
+	}
+	drawTextAt(img, status, sectionWidth/2, 80, statusColor, true)
+}
+
+// renderEffectParamSection renders a parameter value with a bar showing where it lies in its range
+func (s *StreamDeckUI) renderEffectParamSection(img *image.RGBA, index int, spec effects.ParamSpec, value float64) {
+	x := index * sectionWidth
+	bounds := image.Rect(x, 0, x+sectionWidth, touchHeight)
+	draw.Draw(img, bounds, &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{x, 0}, draw.Src)
+	drawVerticalLine(img, x+sectionWidth-1, 0, touchHeight, color.RGBA{80, 80, 80, 255})
+
+	drawTextAt(img, spec.Name, x+sectionWidth/2, 15, color.RGBA{150, 150, 150, 255}, true)
+	drawTextAt(img, fmt.Sprintf("%.4g", value), x+sectionWidth/2, 50, color.RGBA{255, 255, 255, 255}, true)
+
+	// Scale to 0-1000 so the integer progress bar can show fractional parameters
+	fill := int(math.Round((value - spec.Min) / (spec.Max - spec.Min) * 1000))
+	s.drawProgressBar(img, x+10, 80, sectionWidth-20, 10, fill, 1000)
+}
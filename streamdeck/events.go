@@ -47,6 +47,17 @@ func (s *StreamDeckUI) handleButtonPress(buttonIndex int) {
 	case TabScenes:
 		// Recall scene from slot
 		s.recallScene(buttonIndex - 4)
+	case TabEffects:
+		// Select the device the effect controls apply to
+		s.selectEffectDevice(buttonIndex - 4)
+	case TabSequences:
+		// Play a sequence, or pause/resume it if it is already playing; the
+		// last button switches the on-air indicator
+		if buttonIndex-4 == onAirButton {
+			s.pressOnAirButton()
+		} else {
+			s.pressSequenceButton(buttonIndex - 4)
+		}
 	default:
 		// Future tabs: no action yet
 		log.Printf("Button %d pressed on unimplemented tab %s", buttonIndex, s.currentTab)
@@ -60,6 +71,22 @@ func (s *StreamDeckUI) handleDialRotate(dialIndex int, ticks int) {
 		return
 	}
 
+	if s.currentTab == TabEffects {
+		s.rotateEffectDial(dialIndex, ticks)
+		return
+	}
+
+	// On the sequences tab the third dial pages through the sequences and the
+	// last sets the sleep timer
+	if s.currentTab == TabSequences && dialIndex == 2 {
+		s.rotateSequencePage(ticks)
+		return
+	}
+	if s.currentTab == TabSequences && dialIndex == 3 {
+		s.rotateSleepDial(ticks)
+		return
+	}
+
 	// Only handle dials on Tab 1 (Light Control)
 	if s.currentTab != TabLightControl {
 		log.Printf("Dial %d rotated on unimplemented tab %s", dialIndex, s.currentTab)
@@ -123,6 +150,10 @@ func (s *StreamDeckUI) handleDialPress(dialIndex int) {
 	case TabScenes:
 		// Save current state to scene slot
 		s.saveScene(dialIndex)
+	case TabEffects:
+		s.pressEffectDial(dialIndex)
+	case TabSequences:
+		s.pressSequenceDial(dialIndex)
 	default:
 		log.Printf("Dial %d pressed on unimplemented tab %s", dialIndex, s.currentTab)
 	}
@@ -140,6 +171,26 @@ func (s *StreamDeckUI) handleTouch(x, y int) {
 		return
 	}
 
+	// Touching an effects section acts like clicking its dial
+	if s.currentTab == TabEffects {
+		s.pressEffectDial(section)
+		return
+	}
+
+	// Touching the sequences screen pauses/resumes (left half), stops (third section)
+	// or cancels the sleep timer (last section)
+	if s.currentTab == TabSequences {
+		switch {
+		case section < 2:
+			s.pressSequenceDial(0)
+		case section == 2:
+			s.pressSequenceDial(1)
+		default:
+			s.pressSequenceDial(3)
+		}
+		return
+	}
+
 	// Only handle touches on Tab 1 (Light Control)
 	if s.currentTab != TabLightControl {
 		log.Printf("Touchscreen touched on unimplemented tab %s", s.currentTab)
@@ -0,0 +1,51 @@
+package streamdeck
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kevin/office_lights/history"
+)
+
+// longPress is how long the undo or redo button must be held to undo or redo rather than press it
+const longPress = 800 * time.Millisecond
+
+// undoButton and redoButton are the first two tab buttons, which undo and redo when held
+const (
+	undoButton = 0
+	redoButton = 1
+)
+
+// holdHistoryButton undoes or redoes after the undo or redo button was held
+func (s *StreamDeckUI) holdHistoryButton(index int) {
+	if index == undoButton {
+		s.undo()
+	} else {
+		s.redo()
+	}
+}
+
+// undo puts the lights back as they were before the last change
+func (s *StreamDeckUI) undo() {
+	if s.history == nil {
+		return
+	}
+	if _, err := s.history.Undo(); errors.Is(err, history.ErrNothingToUndo) {
+		log.Println("Nothing to undo")
+	} else if err != nil {
+		log.Printf("Error undoing: %v", err)
+	}
+}
+
+// redo makes the last undone change again
+func (s *StreamDeckUI) redo() {
+	if s.history == nil {
+		return
+	}
+	if _, err := s.history.Redo(); errors.Is(err, history.ErrNothingToRedo) {
+		log.Println("Nothing to redo")
+	} else if err != nil {
+		log.Printf("Error redoing: %v", err)
+	}
+}
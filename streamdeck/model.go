@@ -3,10 +3,17 @@ package streamdeck
 import (
 	"image"
 	"sync"
+	"sync/atomic"
 
 	"github.com/kevin/office_lights/drivers/ledbar"
 	"github.com/kevin/office_lights/drivers/ledstrip"
 	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/history"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/onair"
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/sleeptimer"
 	"github.com/kevin/office_lights/storage"
 	sdlib "rafaelmartins.com/p/streamdeck"
 )
@@ -17,8 +24,8 @@ type Tab int
 const (
 	TabLightControl Tab = iota // Tab 1: Light control (existing functionality)
 	TabScenes                  // Tab 2: Save and recall lighting scenes
-	TabFuture3                 // Tab 3: Reserved for future use
-	TabFuture4                 // Tab 4: Reserved for future use
+	TabEffects                 // Tab 3: Start and tune lighting effects
+	TabSequences               // Tab 4: Play keyframe sequences
 )
 
 // String returns the string representation of a Tab
@@ -28,10 +35,10 @@ func (t Tab) String() string {
 		return "Lights"
 	case TabScenes:
 		return "Scenes"
-	case TabFuture3:
-		return "Tab 3"
-	case TabFuture4:
-		return "Tab 4"
+	case TabEffects:
+		return "Effects"
+	case TabSequences:
+		return "Sequences"
 	default:
 		return "Unknown"
 	}
@@ -79,28 +86,62 @@ type StreamDeckUI struct {
 	videoLight1 *videolight.VideoLight
 	videoLight2 *videolight.VideoLight
 	storage     storage.SceneStore
+	transitions *lights.TransitionEngine
+	effects     *effects.Engine
 
 	mu          sync.Mutex
 	currentTab  Tab  // Currently selected tab (0-3)
 	currentMode Mode // Mode within TabLightControl
 	lastValues  [4]int // Store last non-zero values for toggle functionality
 
+	// Effects tab state
+	effectDevice effects.Device            // Device the effect buttons and dials apply to
+	effectIndex  int                       // Selected effect among those the device supports
+	effectParams map[string]effects.Params // Dial-adjusted parameters per effect
+
+	// Sequences tab state
+	sequenceStore storage.SequenceStore
+	player        *sequences.Player
+	sleepTimers   *sleeptimer.Timers
+	sequencePage  int // Page of sequences the buttons show, turned by the third dial
+
+	// On-air indicator, and whether the buttons last showed it on
+	onAir      *onair.Indicator
+	onAirShown bool
+
+	// Undo history, stepped through by holding the undo or redo button
+	history *history.History
+
 	// Cached images
 	buttonImages [8]image.Image
 	touchImage   image.Image
 
 	// Control
-	quit chan struct{}
+	quit     chan struct{}
+	attached atomic.Bool // whether the device is open and answering
+}
+
+// Dependencies are the lights and subsystems the Stream Deck controls
+// Every field is needed except History, without which holding the undo or redo button does nothing.
+type Dependencies struct {
+	LEDStrip    *ledstrip.LEDStrip
+	LEDBar      *ledbar.LEDBar
+	VideoLight1 *videolight.VideoLight
+	VideoLight2 *videolight.VideoLight
+
+	Scenes        storage.SceneStore
+	SequenceStore storage.SequenceStore
+
+	Transitions *lights.TransitionEngine
+	Effects     *effects.Engine
+	Player      *sequences.Player
+	SleepTimers *sleeptimer.Timers
+	OnAir       *onair.Indicator
+	History     *history.History
 }
 
 // NewStreamDeckUI creates a new Stream Deck UI instance
-func NewStreamDeckUI(
-	ledStrip *ledstrip.LEDStrip,
-	ledBar *ledbar.LEDBar,
-	videoLight1 *videolight.VideoLight,
-	videoLight2 *videolight.VideoLight,
-	store storage.SceneStore,
-) (*StreamDeckUI, error) {
+func NewStreamDeckUI(deps Dependencies) (*StreamDeckUI, error) {
 	// Find Stream Deck devices
 	devices, err := sdlib.Enumerate()
 	if err != nil {
@@ -120,15 +161,24 @@ func NewStreamDeckUI(
 	}
 
 	ui := &StreamDeckUI{
-		device:      device,
-		ledStrip:    ledStrip,
-		ledBar:      ledBar,
-		videoLight1: videoLight1,
-		videoLight2: videoLight2,
-		storage:     store,
-		currentTab:  TabLightControl, // Default to Light Control tab
-		currentMode: ModeLEDStrip,    // Default mode within Light Control
-		quit:        make(chan struct{}),
+		device:        device,
+		ledStrip:      deps.LEDStrip,
+		ledBar:        deps.LEDBar,
+		videoLight1:   deps.VideoLight1,
+		videoLight2:   deps.VideoLight2,
+		storage:       deps.Scenes,
+		transitions:   deps.Transitions,
+		effects:       deps.Effects,
+		effectDevice:  effects.DeviceLEDStrip,
+		effectParams:  make(map[string]effects.Params),
+		sequenceStore: deps.SequenceStore,
+		player:        deps.Player,
+		sleepTimers:   deps.SleepTimers,
+		onAir:         deps.OnAir,
+		history:       deps.History,
+		currentTab:    TabLightControl, // Default to Light Control tab
+		currentMode:   ModeLEDStrip,    // Default mode within Light Control
+		quit:          make(chan struct{}),
 	}
 
 	return ui, nil
@@ -0,0 +1,66 @@
+package streamdeck
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+)
+
+// onAirButton is the second-row button on the sequences tab that switches the on-air indicator
+const onAirButton = 3
+
+// onAirColor is the colour of the On Air button and stripe while the indicator is on
+var onAirColor = color.RGBA{200, 30, 30, 255}
+
+// pressOnAirButton switches the on-air indicator over
+func (s *StreamDeckUI) pressOnAirButton() {
+	if s.onAir == nil {
+		return
+	}
+
+	if _, err := s.onAir.Toggle(); err != nil {
+		log.Printf("Error switching on air: %v", err)
+	}
+
+	s.refreshSequences()
+}
+
+// renderOnAirButton renders the On Air button, red while the indicator is on
+func (s *StreamDeckUI) renderOnAirButton() image.Image {
+	if s.onAir == nil {
+		return s.renderBlankButton()
+	}
+	if s.onAir.Active() {
+		return s.renderColoredButton("ON AIR", onAirColor)
+	}
+	return s.renderTextButton("On Air", false)
+}
+
+// drawOnAirStripe draws a red stripe across the top of the touchscreen while the indicator is on
+func (s *StreamDeckUI) drawOnAirStripe(img *image.RGBA) {
+	if s.onAir == nil || !s.onAir.Active() {
+		return
+	}
+	draw.Draw(img, image.Rect(0, 0, touchWidth, 4), &image.Uniform{onAirColor}, image.Point{}, draw.Src)
+}
+
+// checkOnAir redraws the On Air button when the indicator was switched from elsewhere
+func (s *StreamDeckUI) checkOnAir() {
+	if s.onAir == nil {
+		return
+	}
+
+	active := s.onAir.Active()
+	if active == s.onAirShown {
+		return
+	}
+	s.onAirShown = active
+
+	if s.currentTab != TabSequences {
+		return
+	}
+	if err := s.updateButtons(); err != nil {
+		log.Printf("Error updating buttons: %v", err)
+	}
+}
@@ -59,6 +59,10 @@ func (s *StreamDeckUI) renderButton(index int) (image.Image, error) {
 		return s.renderModeButton(index - 4)
 	case TabScenes:
 		return s.renderSceneButton(index - 4)
+	case TabEffects:
+		return s.renderEffectDeviceButton(index - 4), nil
+	case TabSequences:
+		return s.renderSequenceButton(index - 4), nil
 	default:
 		// Future tabs: show blank buttons
 		return s.renderBlankButton(), nil
@@ -95,10 +99,10 @@ func (s *StreamDeckUI) getTabIconFilename(tab Tab) string {
 		return "tab_lights.png"
 	case TabScenes:
 		return "tab_scenes.png"
-	case TabFuture3:
-		return "tab_3.png"
-	case TabFuture4:
-		return "tab_4.png"
+	case TabEffects:
+		return "tab_effects.png"
+	case TabSequences:
+		return "tab_sequences.png"
 	default:
 		return "unknown.png"
 	}
@@ -207,9 +211,13 @@ func (s *StreamDeckUI) updateTouchscreen() error {
 	return nil
 }
 
-// renderSceneButton renders a scene slot button
+// renderSceneButton renders a scene shortcut button
 func (s *StreamDeckUI) renderSceneButton(index int) (image.Image, error) {
-	exists, _ := s.storage.SceneExists(index)
+	sceneID, assigned := s.sceneForSlot(index)
+	exists := false
+	if assigned {
+		exists, _ = s.storage.SceneExists(sceneID)
+	}
 
 	var label string
 	if !exists {
@@ -219,7 +227,7 @@ func (s *StreamDeckUI) renderSceneButton(index int) (image.Image, error) {
 	}
 
 	// Try to get the scene name from the database
-	name, _ := s.storage.GetSceneName(index)
+	name, _ := s.storage.GetSceneName(sceneID)
 	if name != "" {
 		label = name
 	} else {
@@ -227,7 +235,7 @@ func (s *StreamDeckUI) renderSceneButton(index int) (image.Image, error) {
 	}
 
 	// Try to get the background color from the database
-	bgColorHex, _ := s.storage.GetSceneBgColor(index)
+	bgColorHex, _ := s.storage.GetSceneBgColor(sceneID)
 	if bgColorHex != "" {
 		if bgColor := parseHexColor(bgColorHex); bgColor != nil {
 			return s.renderColoredButton(label, *bgColor), nil
@@ -240,14 +248,26 @@ func (s *StreamDeckUI) renderSceneButton(index int) (image.Image, error) {
 
 // renderTouchscreen creates the full touchscreen image
 func (s *StreamDeckUI) renderTouchscreen() image.Image {
+	var img image.Image
 	switch s.currentTab {
 	case TabLightControl:
-		return s.renderLightControlTouchscreen()
+		img = s.renderLightControlTouchscreen()
 	case TabScenes:
-		return s.renderScenesTouchscreen()
+		img = s.renderScenesTouchscreen()
+	case TabEffects:
+		img = s.renderEffectsTouchscreen()
+	case TabSequences:
+		img = s.renderSequencesTouchscreen()
 	default:
-		return s.renderPlaceholderTouchscreen()
+		img = s.renderPlaceholderTouchscreen()
+	}
+
+	// A running sleep timer and the on-air indicator show on every tab
+	if rgba, ok := img.(*image.RGBA); ok {
+		s.drawSleepCountdown(rgba)
+		s.drawOnAirStripe(rgba)
 	}
+	return img
 }
 
 // renderScenesTouchscreen renders the touchscreen for Tab 2 (Scenes)
@@ -278,10 +298,14 @@ func (s *StreamDeckUI) renderSceneSection(img *image.RGBA, index int) {
 	drawVerticalLine(img, x+sectionWidth-1, 0, touchHeight, color.RGBA{80, 80, 80, 255})
 
 	// Label - use scene name if available
-	exists, _ := s.storage.SceneExists(index)
+	sceneID, assigned := s.sceneForSlot(index)
+	exists := false
+	if assigned {
+		exists, _ = s.storage.SceneExists(sceneID)
+	}
 	var label string
 	if exists {
-		name, _ := s.storage.GetSceneName(index)
+		name, _ := s.storage.GetSceneName(sceneID)
 		if name != "" {
 			label = name
 		} else {
@@ -1,50 +1,67 @@
 package streamdeck
 
 import (
+	"fmt"
 	"log"
 
+	"github.com/kevin/office_lights/lights"
 	"github.com/kevin/office_lights/storage"
 )
 
-// saveScene captures current light state and saves to database
-func (s *StreamDeckUI) saveScene(slotIndex int) {
-	log.Printf("Saving scene %d...", slotIndex+1)
+// sceneForSlot returns the library scene assigned to a shortcut button (ok is false if unassigned)
+func (s *StreamDeckUI) sceneForSlot(slotIndex int) (int, bool) {
+	sceneID, ok, err := s.storage.GetSceneShortcut(slotIndex)
+	if err != nil {
+		log.Printf("Error reading scene shortcut %d: %v", slotIndex+1, err)
+		return 0, false
+	}
+	return sceneID, ok
+}
 
-	// Gather current state from all drivers
-	data := &storage.SceneData{
-		LEDStrip: storage.LEDStripState{
-			Red:   s.ledStrip.R(),
-			Green: s.ledStrip.G(),
-			Blue:  s.ledStrip.B(),
-		},
+// createSceneForSlot adds a new library scene and assigns it to an unassigned shortcut button
+func (s *StreamDeckUI) createSceneForSlot(slotIndex int) (int, error) {
+	// Find an unused default name, starting from the button number
+	var name string
+	for n := slotIndex + 1; ; n++ {
+		name = fmt.Sprintf("Scene %d", n)
+		existing, err := s.storage.FindSceneByName(name)
+		if err != nil {
+			return 0, err
+		}
+		if existing == nil {
+			break
+		}
 	}
 
-	// Gather LED bar state
-	channels := s.ledBar.GetChannels()
-	for i, value := range channels {
-		data.LEDBarLEDs = append(data.LEDBarLEDs, storage.LEDBarLEDState{
-			LEDBarID:   s.ledBar.GetBarID(),
-			ChannelNum: i,
-			Value:      value,
-		})
+	sceneID, err := s.storage.CreateScene(storage.SceneInfo{Name: name})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.storage.SetSceneShortcut(slotIndex, sceneID); err != nil {
+		return 0, err
 	}
+	return sceneID, nil
+}
+
+// saveScene captures current light state and saves it to the scene assigned to a shortcut button
+func (s *StreamDeckUI) saveScene(slotIndex int) {
+	log.Printf("Saving scene %d...", slotIndex+1)
 
-	// Gather video light states
-	data.VideoLights = []storage.VideoLightState{
-		{
-			ID:         0,
-			On:         s.videoLight1.IsOn(),
-			Brightness: s.videoLight1.Brightness(),
-		},
-		{
-			ID:         1,
-			On:         s.videoLight2.IsOn(),
-			Brightness: s.videoLight2.Brightness(),
-		},
+	sceneID, ok := s.sceneForSlot(slotIndex)
+	if !ok {
+		var err error
+		sceneID, err = s.createSceneForSlot(slotIndex)
+		if err != nil {
+			log.Printf("Error creating scene for button %d: %v", slotIndex+1, err)
+			return
+		}
 	}
 
+	// Gather current state from all lights
+	data := s.transitions.Rig().Capture(lights.SelectAll())
+
 	// Save to database
-	if err := s.storage.SaveScene(slotIndex, data); err != nil {
+	if err := s.storage.SaveScene(sceneID, data); err != nil {
 		log.Printf("Error saving scene %d: %v", slotIndex+1, err)
 		return
 	}
@@ -60,12 +77,18 @@ func (s *StreamDeckUI) saveScene(slotIndex int) {
 	}
 }
 
-// recallScene loads saved state and applies to all lights
+// recallScene loads the scene assigned to a shortcut button and applies it to the lights it contains
 func (s *StreamDeckUI) recallScene(slotIndex int) {
 	log.Printf("Recalling scene %d...", slotIndex+1)
 
+	sceneID, ok := s.sceneForSlot(slotIndex)
+	if !ok {
+		log.Printf("Scene %d is not assigned", slotIndex+1)
+		return
+	}
+
 	// Load from database
-	data, err := s.storage.LoadScene(slotIndex)
+	data, err := s.storage.LoadScene(sceneID)
 	if err != nil {
 		log.Printf("Error loading scene %d: %v", slotIndex+1, err)
 		return
@@ -76,48 +99,11 @@ func (s *StreamDeckUI) recallScene(slotIndex int) {
 		return
 	}
 
-	// Apply to LED strip
-	if err := s.ledStrip.SetColor(data.LEDStrip.Red, data.LEDStrip.Green, data.LEDStrip.Blue); err != nil {
-		log.Printf("Error setting LED strip: %v", err)
-	}
-
-	// Apply to LED bar
-	if len(data.LEDBarLEDs) > 0 {
-		channels := make([]int, 77)
-		for _, led := range data.LEDBarLEDs {
-			if led.ChannelNum >= 0 && led.ChannelNum < 77 {
-				channels[led.ChannelNum] = led.Value
-			}
-		}
-		if err := s.ledBar.SetChannels(channels); err != nil {
-			log.Printf("Error setting LED bar: %v", err)
-		}
-	}
-
-	// Apply to video lights
-	for _, vl := range data.VideoLights {
-		switch vl.ID {
-		case 0:
-			if vl.On {
-				if err := s.videoLight1.TurnOn(vl.Brightness); err != nil {
-					log.Printf("Error setting video light 1: %v", err)
-				}
-			} else {
-				if err := s.videoLight1.TurnOff(); err != nil {
-					log.Printf("Error turning off video light 1: %v", err)
-				}
-			}
-		case 1:
-			if vl.On {
-				if err := s.videoLight2.TurnOn(vl.Brightness); err != nil {
-					log.Printf("Error setting video light 2: %v", err)
-				}
-			} else {
-				if err := s.videoLight2.TurnOff(); err != nil {
-					log.Printf("Error turning off video light 2: %v", err)
-				}
-			}
-		}
+	// Crossfade to the lights stored in the scene, leaving the rest untouched
+	name, _ := s.storage.GetSceneName(sceneID)
+	if err := s.transitions.Recall(sceneID, name, data, s.transitions.Default()); err != nil {
+		log.Printf("Error recalling scene %d: %v", slotIndex+1, err)
+		return
 	}
 
 	log.Printf("Scene %d recalled successfully", slotIndex+1)
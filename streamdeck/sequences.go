@@ -0,0 +1,205 @@
+package streamdeck
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"time"
+
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/storage"
+)
+
+// sequencesPerPage is how many sequences the buttons show at once, the fourth
+// button being the On Air button
+const sequencesPerPage = onAirButton
+
+// listSequences returns the sequences in name order and the number of pages they fill,
+// keeping the current page in range if sequences were deleted
+func (s *StreamDeckUI) listSequences() ([]storage.Sequence, int) {
+	if s.sequenceStore == nil {
+		return nil, 1
+	}
+
+	list, err := s.sequenceStore.ListSequences()
+	if err != nil {
+		log.Printf("Error listing sequences: %v", err)
+		return nil, 1
+	}
+	pages := (len(list) + sequencesPerPage - 1) / sequencesPerPage
+	if pages < 1 {
+		pages = 1
+	}
+	if s.sequencePage >= pages {
+		s.sequencePage = pages - 1
+	}
+	return list, pages
+}
+
+// sequenceForButton returns the sequence shown on a button on the current page
+func (s *StreamDeckUI) sequenceForButton(index int) *storage.Sequence {
+	if index < 0 || index >= sequencesPerPage {
+		return nil
+	}
+
+	list, _ := s.listSequences()
+	index += s.sequencePage * sequencesPerPage
+	if index >= len(list) {
+		return nil
+	}
+	return &list[index]
+}
+
+// rotateSequencePage turns the page of sequences the buttons show, wrapping round at either end
+func (s *StreamDeckUI) rotateSequencePage(ticks int) {
+	_, pages := s.listSequences()
+	page := (s.sequencePage + ticks) % pages
+	if page < 0 {
+		page += pages
+	}
+	if page == s.sequencePage {
+		return
+	}
+	s.sequencePage = page
+	log.Printf("Showing sequence page %d of %d", page+1, pages)
+
+	s.refreshSequences()
+}
+
+// pressSequenceButton plays the sequence on a button, or pauses/resumes it if it is already playing
+func (s *StreamDeckUI) pressSequenceButton(index int) {
+	seq := s.sequenceForButton(index)
+	if seq == nil {
+		log.Printf("No sequence on button %d", index+4)
+		return
+	}
+
+	status := s.player.Status()
+	if status.State != sequences.StateStopped && status.SequenceID == seq.ID {
+		if err := s.player.TogglePause(); err != nil {
+			log.Printf("Error pausing sequence %q: %v", seq.Name, err)
+		}
+	} else if err := s.player.Play(seq, seq.Loop); err != nil {
+		log.Printf("Error playing sequence %q: %v", seq.Name, err)
+	}
+
+	s.refreshSequences()
+}
+
+// pressSequenceDial pauses/resumes (dial 0) or stops (dial 1) the playing sequence,
+// or cancels the sleep timer (dial 3)
+func (s *StreamDeckUI) pressSequenceDial(dialIndex int) {
+	switch dialIndex {
+	case 0:
+		if err := s.player.TogglePause(); err != nil {
+			log.Printf("Error pausing sequence: %v", err)
+		}
+	case 1:
+		s.player.Stop()
+	case 3:
+		s.cancelSleep()
+	default:
+		return
+	}
+
+	s.refreshSequences()
+}
+
+// refreshSequences redraws the buttons and touchscreen after a sequences tab change
+func (s *StreamDeckUI) refreshSequences() {
+	if err := s.updateButtons(); err != nil {
+		log.Printf("Error updating buttons: %v", err)
+	}
+	if err := s.updateTouchscreen(); err != nil {
+		log.Printf("Error updating touchscreen: %v", err)
+	}
+}
+
+// renderSequenceButton renders a sequence button, highlighting the one playing
+func (s *StreamDeckUI) renderSequenceButton(index int) image.Image {
+	if index == onAirButton {
+		return s.renderOnAirButton()
+	}
+
+	seq := s.sequenceForButton(index)
+	if seq == nil {
+		return s.renderBlankButton()
+	}
+
+	status := s.player.Status()
+	if status.State != sequences.StateStopped && status.SequenceID == seq.ID {
+		bg := color.RGBA{40, 110, 60, 255}
+		if status.State == sequences.StatePaused {
+			bg = color.RGBA{150, 110, 30, 255}
+		}
+		return s.renderColoredButton(seq.Name, bg)
+	}
+	return s.renderTextButton(seq.Name, false)
+}
+
+// renderSequencesTouchscreen renders the touchscreen for Tab 4 (Sequences):
+// the playing sequence, its keyframe and progress, and the sleep timer on the right
+func (s *StreamDeckUI) renderSequencesTouchscreen() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, touchWidth, touchHeight))
+
+	// Background
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{20, 20, 20, 255}}, image.Point{}, draw.Src)
+
+	// Section 3: sleep timer
+	s.renderSleepSection(img, 3*sectionWidth)
+
+	status := s.player.Status()
+	if status.State == sequences.StateStopped {
+		drawTextAt(img, "Press a button to play a sequence", 3*sectionWidth/2, touchHeight/2, color.RGBA{100, 100, 100, 255}, true)
+		if _, pages := s.listSequences(); pages > 1 {
+			page := fmt.Sprintf("Page %d of %d, turn the third dial for more", s.sequencePage+1, pages)
+			drawTextAt(img, page, 3*sectionWidth/2, touchHeight/2+25, color.RGBA{80, 80, 80, 255}, true)
+		}
+		return img
+	}
+
+	// Section 0: name and state
+	draw.Draw(img, image.Rect(0, 0, sectionWidth, touchHeight), &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{}, draw.Src)
+	drawVerticalLine(img, sectionWidth-1, 0, touchHeight, color.RGBA{80, 80, 80, 255})
+	drawTextAt(img, "Sequence", sectionWidth/2, 15, color.RGBA{150, 150, 150, 255}, true)
+	drawTextAt(img, status.Sequence, sectionWidth/2, 45, color.RGBA{255, 255, 255, 255}, true)
+
+	state := "Playing"
+	stateColor := color.RGBA{100, 200, 100, 255}
+	if status.State == sequences.StatePaused {
+		state = "Paused"
+		stateColor = color.RGBA{230, 170, 50, 255}
+	}
+	drawTextAt(img, state, sectionWidth/2, 80, stateColor, true)
+
+	// Section 1: keyframe and phase
+	x := sectionWidth
+	draw.Draw(img, image.Rect(x, 0, x+sectionWidth, touchHeight), &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{x, 0}, draw.Src)
+	drawVerticalLine(img, x+sectionWidth-1, 0, touchHeight, color.RGBA{80, 80, 80, 255})
+	drawTextAt(img, "Keyframe", x+sectionWidth/2, 15, color.RGBA{150, 150, 150, 255}, true)
+	drawTextAt(img, fmt.Sprintf("%d/%d %s", status.Keyframe, status.Keyframes, status.Phase), x+sectionWidth/2, 45, color.RGBA{255, 255, 255, 255}, true)
+	drawTextAt(img, "Click to stop", x+sectionWidth/2, 80, color.RGBA{80, 80, 80, 255}, true)
+
+	// Section 2: elapsed time and progress
+	x = 2 * sectionWidth
+	draw.Draw(img, image.Rect(x, 0, x+sectionWidth, touchHeight), &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{x, 0}, draw.Src)
+	drawVerticalLine(img, x+sectionWidth-1, 0, touchHeight, color.RGBA{80, 80, 80, 255})
+	label := "Progress"
+	if status.Loop {
+		label = fmt.Sprintf("Progress (pass %d)", status.Iteration)
+	}
+	drawTextAt(img, label, x+sectionWidth/2, 15, color.RGBA{150, 150, 150, 255}, true)
+	elapsed := fmt.Sprintf("%s / %s", formatClock(status.Elapsed), formatClock(status.Duration))
+	drawTextAt(img, elapsed, x+sectionWidth/2, 45, color.RGBA{255, 255, 255, 255}, true)
+	s.drawProgressBar(img, x+10, 80, sectionWidth-20, 10, status.Elapsed, status.Duration)
+
+	return img
+}
+
+// formatClock formats milliseconds as m:ss
+func formatClock(ms int) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
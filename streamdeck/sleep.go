@@ -0,0 +1,87 @@
+package streamdeck
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"time"
+
+	"github.com/kevin/office_lights/sleeptimer"
+)
+
+// sleepStep is how much one dial tick adds to or takes off the sleep timer
+const sleepStep = 5 * time.Minute
+
+// rotateSleepDial lengthens or shortens the sleep timer for every light, cancelling it at zero
+func (s *StreamDeckUI) rotateSleepDial(ticks int) {
+	if s.sleepTimers == nil {
+		return
+	}
+
+	// Round to whole steps so the timer reads 5:00, 10:00, ... as the dial turns
+	var remaining time.Duration
+	if status, ok := s.sleepTimers.Get(sleeptimer.TargetAll); ok {
+		remaining = time.Duration(status.Remaining) * time.Millisecond
+	}
+	steps := int((remaining + sleepStep/2) / sleepStep)
+	d := time.Duration(steps+ticks) * sleepStep
+
+	if d <= 0 {
+		s.cancelSleep()
+		return
+	}
+	if _, err := s.sleepTimers.Set(sleeptimer.TargetAll, d, sleeptimer.DefaultFade); err != nil {
+		log.Printf("Error setting sleep timer: %v", err)
+	}
+}
+
+// cancelSleep cancels the sleep timer for every light
+func (s *StreamDeckUI) cancelSleep() {
+	if s.sleepTimers == nil {
+		return
+	}
+	if err := s.sleepTimers.Cancel(sleeptimer.TargetAll); err != nil {
+		log.Printf("Error cancelling sleep timer: %v", err)
+	}
+}
+
+// renderSleepSection renders the sleep timer in the touchscreen section at x
+func (s *StreamDeckUI) renderSleepSection(img *image.RGBA, x int) {
+	draw.Draw(img, image.Rect(x, 0, x+sectionWidth, touchHeight), &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{x, 0}, draw.Src)
+	drawTextAt(img, "Sleep timer", x+sectionWidth/2, 15, color.RGBA{150, 150, 150, 255}, true)
+
+	status, ok := s.sleepStatus()
+	if !ok {
+		drawTextAt(img, "Off", x+sectionWidth/2, 45, color.RGBA{100, 100, 100, 255}, true)
+		drawTextAt(img, "Turn dial to set", x+sectionWidth/2, 80, color.RGBA{80, 80, 80, 255}, true)
+		return
+	}
+
+	text := formatClock(status.Remaining + 999)
+	if status.Fading {
+		text += " fading"
+	}
+	drawTextAt(img, text, x+sectionWidth/2, 45, color.RGBA{230, 170, 50, 255}, true)
+	drawTextAt(img, "Click to cancel", x+sectionWidth/2, 80, color.RGBA{80, 80, 80, 255}, true)
+}
+
+// drawSleepCountdown draws a bar along the bottom of the touchscreen that shrinks
+// as the sleep timer for every light runs down
+func (s *StreamDeckUI) drawSleepCountdown(img *image.RGBA) {
+	status, ok := s.sleepStatus()
+	if !ok || status.Duration <= 0 {
+		return
+	}
+
+	width := status.Remaining * touchWidth / status.Duration
+	draw.Draw(img, image.Rect(0, touchHeight-3, width, touchHeight), &image.Uniform{color.RGBA{230, 170, 50, 255}}, image.Point{}, draw.Src)
+}
+
+// sleepStatus returns the sleep timer for every light, if one is set
+func (s *StreamDeckUI) sleepStatus() (sleeptimer.Status, bool) {
+	if s.sleepTimers == nil {
+		return sleeptimer.Status{}, false
+	}
+	return s.sleepTimers.Get(sleeptimer.TargetAll)
+}
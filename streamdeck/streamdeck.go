@@ -26,10 +26,13 @@ func (s *StreamDeckUI) Run() error {
 
 	// Start listening for events in a goroutine
 	errCh := make(chan error, 1)
+	s.attached.Store(true)
 	go func() {
 		if err := s.device.Listen(errCh); err != nil {
 			log.Printf("Stream Deck Listen error: %v", err)
 		}
+		// Listening only stops when the device goes away or is closed
+		s.attached.Store(false)
 	}()
 
 	log.Println("Stream Deck UI running")
@@ -43,9 +46,13 @@ func (s *StreamDeckUI) Run() error {
 		case err := <-errCh:
 			if err != nil {
 				log.Printf("Stream Deck error: %v", err)
+				s.attached.Store(false)
 			}
 
 		case <-ticker.C:
+			// Pick up the on-air indicator being switched from elsewhere
+			s.checkOnAir()
+
 			// Update touchscreen display
 			if err := s.updateTouchscreen(); err != nil {
 				log.Printf("Error updating touchscreen: %v", err)
@@ -54,6 +61,11 @@ func (s *StreamDeckUI) Run() error {
 	}
 }
 
+// Attached reports whether the Stream Deck is open and answering
+func (s *StreamDeckUI) Attached() bool {
+	return s.attached.Load()
+}
+
 // initializeDisplay sets up the initial button images and touchscreen
 func (s *StreamDeckUI) initializeDisplay() error {
 	log.Println("Initializing Stream Deck display...")
@@ -82,6 +94,14 @@ func (s *StreamDeckUI) registerHandlers() error {
 	for i, keyID := range keyIDs {
 		index := i // Capture loop variable
 		if err := s.device.AddKeyHandler(keyID, func(d *sdlib.Device, k *sdlib.Key) error {
+			// The undo and redo buttons act on release, stepping through the
+			// history if held; every other button acts as soon as it is pressed
+			if index == undoButton || index == redoButton {
+				if k.WaitForRelease() >= longPress {
+					s.holdHistoryButton(index)
+					return nil
+				}
+			}
 			s.handleButtonPress(index)
 			return nil
 		}); err != nil {
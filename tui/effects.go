@@ -0,0 +1,82 @@
+package tui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kevin/office_lights/effects"
+)
+
+// sectionDevice returns the effects device for a section
+func sectionDevice(section Section) effects.Device {
+	switch section {
+	case SectionLEDBar:
+		return effects.DeviceLEDBar
+	case SectionVideoLight1:
+		return effects.DeviceVideoLight1
+	case SectionVideoLight2:
+		return effects.DeviceVideoLight2
+	default:
+		return effects.DeviceLEDStrip
+	}
+}
+
+// handleNextEffect starts the next effect (with default parameters) on the active section,
+// cycling through the effects the device supports
+func (m *Model) handleNextEffect() tea.Cmd {
+	if m.effects == nil {
+		return nil
+	}
+
+	device := sectionDevice(m.activeSection)
+	defs := effects.ForDevice(device)
+	if len(defs) == 0 {
+		return nil
+	}
+
+	next := 0
+	if status, ok := m.effects.RunningOn(device); ok {
+		for i, def := range defs {
+			if def.Name == status.Effect {
+				next = (i + 1) % len(defs)
+				break
+			}
+		}
+	}
+
+	return func() tea.Msg {
+		if err := m.effects.Start(defs[next].Name, device, nil); err != nil {
+			return publishErrorMsg{err}
+		}
+		return publishSuccessMsg{}
+	}
+}
+
+// handleStopEffect stops the effect on the active section
+func (m *Model) handleStopEffect() tea.Cmd {
+	if m.effects == nil {
+		return nil
+	}
+
+	device := sectionDevice(m.activeSection)
+	return func() tea.Msg {
+		m.effects.Stop(device)
+		return publishSuccessMsg{}
+	}
+}
+
+// effectStatus summarises the running effects for the help line
+func (m Model) effectStatus() string {
+	if m.effects == nil {
+		return ""
+	}
+
+	var parts []string
+	for _, status := range m.effects.Running() {
+		parts = append(parts, string(status.Device)+": "+status.Effect)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Effects: " + strings.Join(parts, ", ")
+}
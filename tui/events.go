@@ -0,0 +1,61 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kevin/office_lights/schedule"
+)
+
+// maxEvents is how many upcoming events the events panel lists
+const maxEvents = 8
+
+// handleToggleEvents shows or hides the next events panel
+func (m *Model) handleToggleEvents() {
+	m.showEvents = !m.showEvents
+}
+
+// renderEvents lists upcoming schedule runs and sun events
+func (m Model) renderEvents() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Next Events"))
+	b.WriteString("\n")
+
+	if m.scheduler == nil {
+		b.WriteString(inactiveControlStyle.Render("Scheduler not running"))
+		return b.String()
+	}
+
+	events := m.scheduler.NextEvents()
+	if len(events) == 0 {
+		b.WriteString(inactiveControlStyle.Render("Nothing scheduled"))
+	}
+	if len(events) > maxEvents {
+		events = events[:maxEvents]
+	}
+	for _, e := range events {
+		b.WriteString(formatEvent(e, time.Now()))
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// formatEvent renders one event line, giving the day only when it isn't today
+func formatEvent(e schedule.Event, now time.Time) string {
+	at := e.Time.Local()
+	when := at.Format("15:04")
+	if y, m, d := now.Date(); at.Year() != y || at.Month() != m || at.Day() != d {
+		when = at.Format("Mon 15:04")
+	}
+
+	name := e.Name
+	if e.Kind == schedule.EventSun {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	line := fmt.Sprintf("%-9s %s", when, valueStyle.Render(name))
+	if e.Detail != "" {
+		line += inactiveControlStyle.Render(" - " + e.Detail)
+	}
+	return line
+}
@@ -0,0 +1,32 @@
+package tui
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// handleUndo puts the lights back as they were before the last change
+// The controls pick up the restored lights on the next refresh tick.
+func (m *Model) handleUndo() tea.Cmd {
+	if m.history == nil {
+		return nil
+	}
+
+	return func() tea.Msg {
+		if _, err := m.history.Undo(); err != nil {
+			return publishErrorMsg{err}
+		}
+		return publishSuccessMsg{}
+	}
+}
+
+// handleRedo makes the last undone change again
+func (m *Model) handleRedo() tea.Cmd {
+	if m.history == nil {
+		return nil
+	}
+
+	return func() tea.Msg {
+		if _, err := m.history.Redo(); err != nil {
+			return publishErrorMsg{err}
+		}
+		return publishSuccessMsg{}
+	}
+}
@@ -13,6 +13,16 @@ type KeyMap struct {
 	BigUp       key.Binding
 	BigDown     key.Binding
 	Toggle      key.Binding
+	NextEffect  key.Binding
+	StopEffect  key.Binding
+	Sequence    key.Binding
+	Pause       key.Binding
+	Stop        key.Binding
+	Events      key.Binding
+	Sleep       key.Binding
+	SleepLight  key.Binding
+	Undo        key.Binding
+	Redo        key.Binding
 	Quit        key.Binding
 }
 
@@ -55,6 +65,46 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("enter"),
 			key.WithHelp("enter", "toggle on/off"),
 		),
+		NextEffect: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", "next effect"),
+		),
+		StopEffect: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", "stop effect"),
+		),
+		Sequence: key.NewBinding(
+			key.WithKeys("n"),
+			key.WithHelp("n", "play next sequence"),
+		),
+		Pause: key.NewBinding(
+			key.WithKeys("p"),
+			key.WithHelp("p", "pause/resume sequence"),
+		),
+		Stop: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "stop sequence"),
+		),
+		Events: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "show/hide next events"),
+		),
+		Sleep: key.NewBinding(
+			key.WithKeys("z"),
+			key.WithHelp("z", "sleep timer for every light"),
+		),
+		SleepLight: key.NewBinding(
+			key.WithKeys("Z"),
+			key.WithHelp("Z", "sleep timer for this light"),
+		),
+		Undo: key.NewBinding(
+			key.WithKeys("u"),
+			key.WithHelp("u", "undo the last change"),
+		),
+		Redo: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "redo the last undone change"),
+		),
 		Quit: key.NewBinding(
 			key.WithKeys("esc", "ctrl+c"),
 			key.WithHelp("esc", "quit"),
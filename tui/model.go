@@ -5,6 +5,12 @@ import (
 	"github.com/kevin/office_lights/drivers/ledbar"
 	"github.com/kevin/office_lights/drivers/ledstrip"
 	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/history"
+	"github.com/kevin/office_lights/schedule"
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/sleeptimer"
+	"github.com/kevin/office_lights/storage"
 )
 
 // Section represents which light section is active
@@ -34,31 +40,55 @@ type Model struct {
 	barDriver   *ledbar.LEDBar
 	vl1Driver   *videolight.VideoLight
 	vl2Driver   *videolight.VideoLight
+	effects     *effects.Engine
+	player      *sequences.Player
+	sequences   storage.SequenceStore
+	scheduler   *schedule.Scheduler
+	sleepTimers *sleeptimer.Timers
+	history     *history.History
 
 	// UI state
-	width  int
-	height int
-	ready  bool
-	err    error
+	width      int
+	height     int
+	ready      bool
+	showEvents bool
+	err        error
+}
+
+// Dependencies are the lights and subsystems the TUI controls
+// The lights are needed; without any of the others, the keys for it do nothing.
+type Dependencies struct {
+	LEDStrip    *ledstrip.LEDStrip
+	LEDBar      *ledbar.LEDBar
+	VideoLight1 *videolight.VideoLight
+	VideoLight2 *videolight.VideoLight
+
+	Effects       *effects.Engine
+	Player        *sequences.Player
+	SequenceStore storage.SequenceStore
+	Scheduler     *schedule.Scheduler
+	SleepTimers   *sleeptimer.Timers
+	History       *history.History
 }
 
 // New creates a new TUI model
-func New(
-	strip *ledstrip.LEDStrip,
-	bar *ledbar.LEDBar,
-	vl1 *videolight.VideoLight,
-	vl2 *videolight.VideoLight,
-) Model {
+func New(deps Dependencies) Model {
 	return Model{
 		activeSection: SectionLEDStrip,
-		stripDriver:   strip,
-		barDriver:     bar,
-		vl1Driver:     vl1,
-		vl2Driver:     vl2,
-		ledStrip:      newLEDStripModel(strip),
-		ledBar:        newLEDBarModel(bar),
-		videoLight1:   newVideoLightModel(vl1, 1),
-		videoLight2:   newVideoLightModel(vl2, 2),
+		stripDriver:   deps.LEDStrip,
+		barDriver:     deps.LEDBar,
+		vl1Driver:     deps.VideoLight1,
+		vl2Driver:     deps.VideoLight2,
+		effects:       deps.Effects,
+		player:        deps.Player,
+		sequences:     deps.SequenceStore,
+		scheduler:     deps.Scheduler,
+		sleepTimers:   deps.SleepTimers,
+		history:       deps.History,
+		ledStrip:      newLEDStripModel(deps.LEDStrip),
+		ledBar:        newLEDBarModel(deps.LEDBar),
+		videoLight1:   newVideoLightModel(deps.VideoLight1, 1),
+		videoLight2:   newVideoLightModel(deps.VideoLight2, 2),
 	}
 }
 
@@ -0,0 +1,86 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kevin/office_lights/sequences"
+)
+
+// handleNextSequence plays the sequence after the one playing (or the first),
+// cycling through the library in name order
+func (m *Model) handleNextSequence() tea.Cmd {
+	if m.player == nil || m.sequences == nil {
+		return nil
+	}
+
+	return func() tea.Msg {
+		list, err := m.sequences.ListSequences()
+		if err != nil {
+			return publishErrorMsg{err}
+		}
+		if len(list) == 0 {
+			return publishErrorMsg{errors.New("no sequences saved")}
+		}
+
+		next := 0
+		status := m.player.Status()
+		for i, seq := range list {
+			if status.State != sequences.StateStopped && seq.ID == status.SequenceID {
+				next = (i + 1) % len(list)
+				break
+			}
+		}
+
+		seq := list[next]
+		if err := m.player.Play(&seq, seq.Loop); err != nil {
+			return publishErrorMsg{err}
+		}
+		return publishSuccessMsg{}
+	}
+}
+
+// handlePauseSequence pauses or resumes the playing sequence
+func (m *Model) handlePauseSequence() tea.Cmd {
+	if m.player == nil {
+		return nil
+	}
+
+	return func() tea.Msg {
+		if err := m.player.TogglePause(); err != nil {
+			return publishErrorMsg{err}
+		}
+		return publishSuccessMsg{}
+	}
+}
+
+// handleStopSequence stops the playing sequence
+func (m *Model) handleStopSequence() tea.Cmd {
+	if m.player == nil {
+		return nil
+	}
+
+	return func() tea.Msg {
+		m.player.Stop()
+		return publishSuccessMsg{}
+	}
+}
+
+// sequenceStatus summarises sequence playback for the help line
+func (m Model) sequenceStatus() string {
+	if m.player == nil {
+		return ""
+	}
+
+	status := m.player.Status()
+	if status.State == sequences.StateStopped {
+		return ""
+	}
+
+	state := "Playing"
+	if status.State == sequences.StatePaused {
+		state = "Paused"
+	}
+	return fmt.Sprintf("%s %s: %d/%d %.0f%%", state, status.Sequence, status.Keyframe, status.Keyframes, status.Progress*100)
+}
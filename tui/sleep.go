@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kevin/office_lights/sleeptimer"
+)
+
+// sleepTarget returns the sleep timer target for the lights in a section
+func (s Section) sleepTarget() string {
+	switch s {
+	case SectionLEDStrip:
+		return "ledStrip"
+	case SectionLEDBar:
+		return "ledBar"
+	case SectionVideoLight1:
+		return "videoLight1"
+	case SectionVideoLight2:
+		return "videoLight2"
+	}
+	return sleeptimer.TargetAll
+}
+
+// handleSleep steps a target's sleep timer through the presets, cancelling it after the last
+func (m *Model) handleSleep(target string) tea.Cmd {
+	if m.sleepTimers == nil {
+		return nil
+	}
+
+	return func() tea.Msg {
+		var remaining time.Duration
+		if status, ok := m.sleepTimers.Get(target); ok {
+			remaining = time.Duration(status.Remaining) * time.Millisecond
+		}
+
+		next := sleeptimer.NextPreset(remaining)
+		if next == 0 {
+			if err := m.sleepTimers.Cancel(target); err != nil {
+				return publishErrorMsg{err}
+			}
+			return publishSuccessMsg{}
+		}
+
+		if _, err := m.sleepTimers.Set(target, next, sleeptimer.DefaultFade); err != nil {
+			return publishErrorMsg{err}
+		}
+		return publishSuccessMsg{}
+	}
+}
+
+// sleepStatus counts down the sleep timers for the help line
+func (m Model) sleepStatus() string {
+	if m.sleepTimers == nil {
+		return ""
+	}
+
+	list := m.sleepTimers.List()
+	if len(list) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(list))
+	for _, status := range list {
+		part := fmt.Sprintf("%s %s", status.Target, formatCountdown(status.Remaining))
+		if status.Fading {
+			part += " fading"
+		}
+		parts = append(parts, part)
+	}
+	return "Sleep: " + strings.Join(parts, ", ")
+}
+
+// formatCountdown formats milliseconds as m:ss, rounding up so it reaches 0:00 as the lights go off
+func formatCountdown(ms int) string {
+	seconds := (ms + 999) / 1000
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
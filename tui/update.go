@@ -3,6 +3,7 @@ package tui
 import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/kevin/office_lights/sleeptimer"
 )
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -50,6 +51,46 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, keys.Toggle):
 			cmd = m.handleToggle()
 			return m, cmd
+
+		case key.Matches(msg, keys.NextEffect):
+			cmd = m.handleNextEffect()
+			return m, cmd
+
+		case key.Matches(msg, keys.StopEffect):
+			cmd = m.handleStopEffect()
+			return m, cmd
+
+		case key.Matches(msg, keys.Sequence):
+			cmd = m.handleNextSequence()
+			return m, cmd
+
+		case key.Matches(msg, keys.Pause):
+			cmd = m.handlePauseSequence()
+			return m, cmd
+
+		case key.Matches(msg, keys.Stop):
+			cmd = m.handleStopSequence()
+			return m, cmd
+
+		case key.Matches(msg, keys.Events):
+			m.handleToggleEvents()
+			return m, nil
+
+		case key.Matches(msg, keys.Sleep):
+			cmd = m.handleSleep(sleeptimer.TargetAll)
+			return m, cmd
+
+		case key.Matches(msg, keys.SleepLight):
+			cmd = m.handleSleep(m.activeSection.sleepTarget())
+			return m, cmd
+
+		case key.Matches(msg, keys.Undo):
+			cmd = m.handleUndo()
+			return m, cmd
+
+		case key.Matches(msg, keys.Redo):
+			cmd = m.handleRedo()
+			return m, cmd
 		}
 
 	case tea.WindowSizeMsg:
@@ -35,6 +35,12 @@ func (m Model) View() string {
 	bottomRow := lipgloss.JoinHorizontal(lipgloss.Top, vl1View, vl2View)
 	content := lipgloss.JoinVertical(lipgloss.Left, topRow, bottomRow)
 
+	// Upcoming schedule runs and sun events, when toggled on
+	if m.showEvents {
+		events := inactiveSectionStyle.Width(m.width - 6).Render(m.renderEvents())
+		content = lipgloss.JoinVertical(lipgloss.Left, content, events)
+	}
+
 	// Add help text at bottom
 	help := m.renderHelp()
 
@@ -63,7 +69,16 @@ func (m Model) renderSection(content string, isActive bool) string {
 }
 
 func (m Model) renderHelp() string {
-	help := "TAB: next section | ←→: select control | ↑↓: adjust (+1) | Shift+↑↓: adjust (+10) | Enter: toggle | ESC: quit"
+	help := "TAB: next section | ←→: select control | ↑↓: adjust (+1) | Shift+↑↓: adjust (+10) | Enter: toggle | e: next effect | x: stop effect | n/p/s: sequence play/pause/stop | t: next events | z/Z: sleep all/this light | u/r: undo/redo | ESC: quit"
+	if status := m.effectStatus(); status != "" {
+		help = status + " | " + help
+	}
+	if status := m.sequenceStatus(); status != "" {
+		help = status + " | " + help
+	}
+	if status := m.sleepStatus(); status != "" {
+		help = status + " | " + help
+	}
 	if m.err != nil {
 		help = "Error: " + m.err.Error() + " | " + help
 	}
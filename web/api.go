@@ -12,16 +12,6 @@ import (
 func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Enable CORS for development
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	switch r.Method {
 	case "GET":
 		s.handleGetState(w, r)
@@ -37,13 +27,14 @@ func (s *Server) handleGetState(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	state, err := BuildState(s.ledStrip, s.ledBar, s.videoLight1, s.videoLight2)
+	revision, state, err := s.stateRevision()
 	if err != nil {
 		log.Printf("Error building state: %v", err)
 		http.Error(w, fmt.Sprintf(`{"error":"Failed to read state: %v"}`, err), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", s.etag(revision))
 	if err := json.NewEncoder(w).Encode(state); err != nil {
 		log.Printf("Error encoding state: %v", err)
 		http.Error(w, `{"error":"Failed to encode state"}`, http.StatusInternalServerError)
@@ -52,10 +43,28 @@ func (s *Server) handleGetState(w http.ResponseWriter, r *http.Request) {
 }
 
 // handlePostState applies the provided state
+// With If-Match, the state is only applied if nothing has changed since the
+// client read the revision; otherwise the current state comes back with 412.
 func (s *Server) handlePostState(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	revision, current, err := s.stateRevision()
+	if err != nil {
+		log.Printf("Error building state: %v", err)
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to read state: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+	if !s.ifMatch(r, revision) {
+		log.Printf("Web: State changed since revision %s, now %d", r.Header.Get("If-Match"), revision)
+		w.Header().Set("ETag", s.etag(revision))
+		w.WriteHeader(http.StatusPreconditionFailed)
+		if err := json.NewEncoder(w).Encode(current); err != nil {
+			log.Printf("Error encoding state: %v", err)
+		}
+		return
+	}
+
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -80,21 +89,33 @@ func (s *Server) handlePostState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Apply state to drivers
-	if err := ApplyState(&state, s.ledStrip, s.ledBar, s.videoLight1, s.videoLight2); err != nil {
-		log.Printf("Error applying state: %v", err)
-		http.Error(w, fmt.Sprintf(`{"error":"Failed to apply state: %v"}`, err), http.StatusInternalServerError)
-		return
+	// Apply state to drivers, crossfading if a transition was requested
+	if state.Transition != nil && state.Transition.Duration > 0 {
+		transition, _ := state.Transition.Transition()
+		if err := s.transitions.Apply(state.SceneData(s.ledBar.GetBarID()), transition); err != nil {
+			log.Printf("Error starting transition: %v", err)
+			http.Error(w, fmt.Sprintf(`{"error":"Failed to apply state: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// A direct change cancels any running transition
+		s.transitions.Stop()
+		if err := ApplyState(&state, s.ledStrip, s.ledBar, s.videoLight1, s.videoLight2); err != nil {
+			log.Printf("Error applying state: %v", err)
+			http.Error(w, fmt.Sprintf(`{"error":"Failed to apply state: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// Return the updated state
-	updatedState, err := BuildState(s.ledStrip, s.ledBar, s.videoLight1, s.videoLight2)
+	revision, updatedState, err := s.stateRevision()
 	if err != nil {
 		log.Printf("Error building updated state: %v", err)
 		http.Error(w, `{"error":"State applied but failed to read back"}`, http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", s.etag(revision))
 	if err := json.NewEncoder(w).Encode(updatedState); err != nil {
 		log.Printf("Error encoding response: %v", err)
 		http.Error(w, `{"error":"Failed to encode response"}`, http.StatusInternalServerError)
@@ -103,10 +124,3 @@ func (s *Server) handlePostState(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Web: State updated successfully")
 }
-
-// handleHealth returns a simple health check response
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok"}`))
-}
@@ -0,0 +1,404 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what a token or user may do, each role allowing everything the ones below it do
+type Role int
+
+const (
+	RoleNone    Role = iota
+	RoleRead         // look at the lights and everything else
+	RoleControl      // change the lights, recall and save scenes, run effects, sequences and timers
+	RoleAdmin        // edit schedules and rules, delete and import scenes
+)
+
+// roleNames are the names roles are configured and reported by
+var roleNames = map[Role]string{
+	RoleRead:    "read",
+	RoleControl: "control",
+	RoleAdmin:   "admin",
+}
+
+// String returns the role's name
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+// MarshalJSON encodes the role by name
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// ParseRole parses a role name
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if strings.EqualFold(name, roleName) {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q (use read, control or admin)", name)
+}
+
+// DefaultSessionTTL is how long a web page login lasts unless configured otherwise
+const DefaultSessionTTL = 7 * 24 * time.Hour
+
+// sessionCookie names the cookie holding a web page login
+const sessionCookie = "office_lights_session"
+
+// Credential is an API token or a web page login
+type Credential struct {
+	Name   string // user name, or a label for a token in the logs
+	Secret string // the token or password
+	Role   Role
+}
+
+// ParseCredential parses "name:secret:role"
+// The secret may itself contain colons. Errors never include the secret.
+func ParseCredential(value string) (Credential, error) {
+	first := strings.Index(value, ":")
+	last := strings.LastIndex(value, ":")
+	if first <= 0 || last == first {
+		return Credential{}, fmt.Errorf("invalid credential (use name:secret:role)")
+	}
+
+	role, err := ParseRole(value[last+1:])
+	if err != nil {
+		return Credential{}, err
+	}
+	secret := value[first+1 : last]
+	if secret == "" {
+		return Credential{}, fmt.Errorf("credential %q has no secret", value[:first])
+	}
+	return Credential{Name: value[:first], Secret: secret, Role: role}, nil
+}
+
+// AuthConfig configures who may use the web server and which other sites may call it
+// With no tokens and no users, authentication is off and everyone is an admin.
+type AuthConfig struct {
+	Tokens      []Credential  // sent as "Authorization: Bearer <token>"
+	Users       []Credential  // log in to the web page with name and password
+	SessionTTL  time.Duration // how long a login lasts; DefaultSessionTTL if zero
+	CORSOrigins []string      // origins allowed to call the API from a browser, "*" for any
+}
+
+// Enabled reports whether any tokens or users are configured
+func (c AuthConfig) Enabled() bool {
+	return len(c.Tokens) > 0 || len(c.Users) > 0
+}
+
+// principal is who a request comes from
+type principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// session is a web page login
+type session struct {
+	principal
+	expires time.Time
+}
+
+// authenticator checks tokens and logins and keeps the sessions of logged-in users
+type authenticator struct {
+	config AuthConfig
+
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+// newAuthenticator creates an authenticator for a configuration
+func newAuthenticator(config AuthConfig) *authenticator {
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = DefaultSessionTTL
+	}
+	return &authenticator{config: config, sessions: make(map[string]session)}
+}
+
+// identify returns who a request comes from, by bearer token or session cookie, or nil if nobody
+func (a *authenticator) identify(r *http.Request) *principal {
+	if !a.config.Enabled() {
+		return &principal{Role: RoleAdmin}
+	}
+
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil
+		}
+		if c := match(a.config.Tokens, token); c != nil {
+			return &principal{Name: c.Name, Role: c.Role}
+		}
+		return nil
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[cookie.Value]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(s.expires) {
+		delete(a.sessions, cookie.Value)
+		return nil
+	}
+	return &s.principal
+}
+
+// login checks a user's password and starts a session, returning its ID
+func (a *authenticator) login(name, password string) (string, *principal, error) {
+	var user *Credential
+	for i := range a.config.Users {
+		if a.config.Users[i].Name == name {
+			user = &a.config.Users[i]
+		}
+	}
+	// Compare even for unknown users so the time taken doesn't give them away
+	secret := ""
+	if user != nil {
+		secret = user.Secret
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(password)) != 1 || user == nil {
+		return "", nil, fmt.Errorf("wrong user name or password")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for key, s := range a.sessions {
+		if now.After(s.expires) {
+			delete(a.sessions, key)
+		}
+	}
+	s := session{principal: principal{Name: user.Name, Role: user.Role}, expires: now.Add(a.config.SessionTTL)}
+	a.sessions[id] = s
+	return id, &s.principal, nil
+}
+
+// logout ends a session
+func (a *authenticator) logout(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, id)
+}
+
+// sessionCount returns how many users are logged in
+func (a *authenticator) sessionCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for _, s := range a.sessions {
+		if now.Before(s.expires) {
+			count++
+		}
+	}
+	return count
+}
+
+// match returns the credential with a secret, comparing in constant time
+func match(credentials []Credential, secret string) *Credential {
+	var found *Credential
+	for i := range credentials {
+		if subtle.ConstantTimeCompare([]byte(credentials[i].Secret), []byte(secret)) == 1 {
+			found = &credentials[i]
+		}
+	}
+	return found
+}
+
+// allowOrigin reports whether a browser on another site may call the API
+func (a *authenticator) allowOrigin(origin string) bool {
+	return slices.Contains(a.config.CORSOrigins, "*") || slices.Contains(a.config.CORSOrigins, origin)
+}
+
+// requiredRole returns the role a request needs
+func requiredRole(r *http.Request) Role {
+	path := r.URL.Path
+	switch {
+	case r.Method == "GET" || r.Method == "HEAD":
+		return RoleRead
+	case path == "/api/logout":
+		return RoleRead
+	case strings.HasPrefix(path, "/api/webhooks"):
+		return RoleAdmin
+	case strings.HasPrefix(path, "/api/schedules") || strings.HasPrefix(path, "/api/rules"):
+		// Running one now is just using it
+		if strings.HasSuffix(path, "/run") {
+			return RoleControl
+		}
+		return RoleAdmin
+	case path == "/api/scenes/import":
+		return RoleAdmin
+	case strings.HasPrefix(path, "/api/scenes/") && r.Method == "DELETE":
+		return RoleAdmin
+	default:
+		return RoleControl
+	}
+}
+
+// isPublic reports whether a path is served without logging in
+func isPublic(path string) bool {
+	return strings.HasPrefix(path, "/static/") || path == "/login" || path == "/api/login" || path == "/health" || path == "/api/openapi.json"
+}
+
+// authorize wraps the routes with CORS, authentication and role checks
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && s.auth.allowOrigin(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+			w.Header().Add("Vary", "Origin")
+		}
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if isPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		who := s.auth.identify(r)
+		if who == nil {
+			if r.URL.Path == "/" {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="office_lights"`)
+			http.Error(w, `{"error":"Authentication required"}`, http.StatusUnauthorized)
+			return
+		}
+
+		if need := requiredRole(r); who.Role < need {
+			log.Printf("Web: Refused %s %s to %s (%s, needs %s)", r.Method, r.URL.Path, who.Name, who.Role, need)
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, fmt.Sprintf("%s access needed", need)), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleLoginPage serves the login page
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	data, err := staticFiles.ReadFile("static/login.html")
+	if err != nil {
+		http.Error(w, "Failed to load page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+// loginRequest is a user name and password for the web page
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// handleLogin logs a user in, setting the session cookie (POST)
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	id, who, err := s.auth.login(req.Username, req.Password)
+	if err != nil {
+		log.Printf("Web: Failed login for %q from %s", req.Username, r.RemoteAddr)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(s.auth.config.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	log.Printf("Web: %s logged in (%s)", who.Name, who.Role)
+	s.writeSession(w, who)
+}
+
+// handleLogout ends the session of the user logged in to the web page (POST)
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.auth.logout(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// handleSession returns who the request comes from and their role (GET)
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeSession(w, s.auth.identify(r))
+}
+
+// writeSession writes who is logged in, and whether logins are needed at all, as JSON
+func (s *Server) writeSession(w http.ResponseWriter, who *principal) {
+	response := map[string]interface{}{
+		"auth": s.auth.config.Enabled(),
+		"name": who.Name,
+		"role": who.Role,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding session: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// handleCalendar returns the meeting lighting settings, the meeting under way and the upcoming meetings
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeCalendar(w)
+}
+
+// handleCalendarReload re-reads the calendar files without waiting for the next poll
+func (s *Server) handleCalendarReload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.calendar.Reload()
+	log.Println("Web: Reloaded calendar")
+	s.writeCalendar(w)
+}
+
+// writeCalendar writes the calendar status as JSON
+func (s *Server) writeCalendar(w http.ResponseWriter) {
+	if err := json.NewEncoder(w).Encode(s.calendar.Status()); err != nil {
+		log.Printf("Error encoding calendar status: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kevin/office_lights/circadian"
+	"github.com/kevin/office_lights/storage"
+)
+
+// previewStep is the spacing of the samples drawn on the web chart
+const previewStep = 15 * time.Minute
+
+// circadianPreviewRequest is an unsaved curve to preview
+type circadianPreviewRequest struct {
+	Curve []storage.CurvePoint `json:"curve"`
+}
+
+// handleCircadian returns (GET) or replaces (PUT) the circadian settings
+func (s *Server) handleCircadian(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeCircadian(w)
+	case "PUT":
+		var settings storage.CircadianSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := s.circadian.Configure(settings); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Web: Updated circadian settings (LED strip: %t, LED bar: %t)", settings.LEDStrip, settings.LEDBar)
+		s.writeCircadian(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCircadianPreview samples the saved curve (GET) or an unsaved one (POST) across the day
+func (s *Server) handleCircadianPreview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var points []storage.CurvePoint
+	switch r.Method {
+	case "GET":
+		points = s.circadian.Settings().Curve
+	case "POST":
+		var req circadianPreviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		points = req.Curve
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	curve, err := circadian.ParseCurve(points)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"samples": curve.Preview(previewStep),
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding circadian preview: %v", err)
+	}
+}
+
+// handleCircadianResume puts manually adjusted lights back on the curve
+func (s *Server) handleCircadianResume(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.circadian.Resume()
+	log.Println("Web: Resumed circadian mode")
+	s.writeCircadian(w)
+}
+
+// writeCircadian writes the circadian settings and status as JSON
+func (s *Server) writeCircadian(w http.ResponseWriter) {
+	if err := json.NewEncoder(w).Encode(s.circadianResponse()); err != nil {
+		log.Printf("Error encoding circadian settings: %v", err)
+	}
+}
+
+// circadianResponse is the circadian settings and status, as served by GET /api/circadian
+func (s *Server) circadianResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"settings": s.circadian.Settings(),
+		"status":   s.circadian.Status(),
+	}
+}
@@ -0,0 +1,389 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+)
+
+// errNoDevice reports a device resource path naming a light, section or LED that doesn't exist
+var errNoDevice = errors.New("no such device")
+
+// device is one light, or part of one, served as a REST resource
+//
+// value points at the resource's JSON representation, filled in with the
+// light's current state; PUT and PATCH decode the new representation into it
+// before validate and apply are called.
+type device struct {
+	name     string
+	value    interface{}
+	validate func() error
+	apply    func() error
+}
+
+// handleLEDStripDevice serves the LED strip as {"r", "g", "b"}
+func (s *Server) handleLEDStripDevice(w http.ResponseWriter, r *http.Request) {
+	s.serveDevice(w, r, func() (*device, error) {
+		if r.PathValue("id") != "0" {
+			return nil, errNoDevice
+		}
+
+		red, green, blue := s.ledStrip.GetColor()
+		state := &LEDStripState{R: red, G: green, B: blue}
+		return &device{
+			name:  "LED strip",
+			value: state,
+			validate: func() error {
+				return validateRGBW("LED strip", RGBW{R: state.R, G: state.G, B: state.B})
+			},
+			apply: func() error {
+				return s.ledStrip.SetColor(state.R, state.G, state.B)
+			},
+		}, nil
+	})
+}
+
+// handleLEDBarDevice serves the whole LED bar as {"section1", "section2"}
+func (s *Server) handleLEDBarDevice(w http.ResponseWriter, r *http.Request) {
+	s.serveDevice(w, r, func() (*device, error) {
+		if err := s.checkBarID(r); err != nil {
+			return nil, err
+		}
+
+		section1, err := lights.ReadBarSection(s.ledBar, 1)
+		if err != nil {
+			return nil, err
+		}
+		section2, err := lights.ReadBarSection(s.ledBar, 2)
+		if err != nil {
+			return nil, err
+		}
+		state := &LEDBarState{Section1: section1, Section2: section2}
+		return &device{
+			name:  "LED bar",
+			value: state,
+			validate: func() error {
+				if err := validateBarSection("section1", state.Section1); err != nil {
+					return err
+				}
+				return validateBarSection("section2", state.Section2)
+			},
+			apply: func() error {
+				if err := applyBarSection(s.ledBar, 1, state.Section1); err != nil {
+					return err
+				}
+				if err := applyBarSection(s.ledBar, 2, state.Section2); err != nil {
+					return err
+				}
+				return s.ledBar.Publish()
+			},
+		}, nil
+	})
+}
+
+// handleLEDBarSectionDevice serves one LED bar section as {"rgbw", "white"}
+func (s *Server) handleLEDBarSectionDevice(w http.ResponseWriter, r *http.Request) {
+	s.serveDevice(w, r, func() (*device, error) {
+		section, err := s.barSection(r)
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := lights.ReadBarSection(s.ledBar, section)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("section%d", section)
+		return &device{
+			name:  "LED bar " + name,
+			value: &state,
+			validate: func() error {
+				return validateBarSection(name, state)
+			},
+			apply: func() error {
+				if err := applyBarSection(s.ledBar, section, state); err != nil {
+					return err
+				}
+				return s.ledBar.Publish()
+			},
+		}, nil
+	})
+}
+
+// handleLEDBarRGBWDevice serves one RGBW LED of the LED bar as {"r", "g", "b", "w"}
+func (s *Server) handleLEDBarRGBWDevice(w http.ResponseWriter, r *http.Request) {
+	s.serveDevice(w, r, func() (*device, error) {
+		section, err := s.barSection(r)
+		if err != nil {
+			return nil, err
+		}
+		led, err := strconv.Atoi(r.PathValue("led"))
+		if err != nil {
+			return nil, errNoDevice
+		}
+
+		red, green, blue, white, err := s.ledBar.GetRGBW(section, led)
+		if err != nil {
+			return nil, errNoDevice
+		}
+		state := &RGBW{R: red, G: green, B: blue, W: white}
+		name := fmt.Sprintf("LED bar section%d RGBW[%d]", section, led)
+		return &device{
+			name:  name,
+			value: state,
+			validate: func() error {
+				return validateRGBW(name, *state)
+			},
+			apply: func() error {
+				return s.ledBar.SetRGBW(section, led, state.R, state.G, state.B, state.W)
+			},
+		}, nil
+	})
+}
+
+// handleLEDBarWhiteDevice serves one white LED of the LED bar as a number
+func (s *Server) handleLEDBarWhiteDevice(w http.ResponseWriter, r *http.Request) {
+	s.serveDevice(w, r, func() (*device, error) {
+		section, err := s.barSection(r)
+		if err != nil {
+			return nil, err
+		}
+		led, err := strconv.Atoi(r.PathValue("led"))
+		if err != nil {
+			return nil, errNoDevice
+		}
+
+		value, err := s.ledBar.GetWhite(section, led)
+		if err != nil {
+			return nil, errNoDevice
+		}
+		name := fmt.Sprintf("LED bar section%d white[%d]", section, led)
+		return &device{
+			name:  name,
+			value: &value,
+			validate: func() error {
+				if value < 0 || value > 255 {
+					return fmt.Errorf("%s out of range: %d", name, value)
+				}
+				return nil
+			},
+			apply: func() error {
+				return s.ledBar.SetWhite(section, led, value)
+			},
+		}, nil
+	})
+}
+
+// handleVideoLightDevice serves a video light as {"on", "brightness"}
+func (s *Server) handleVideoLightDevice(w http.ResponseWriter, r *http.Request) {
+	s.serveDevice(w, r, func() (*device, error) {
+		var light *videolight.VideoLight
+		for _, vl := range []*videolight.VideoLight{s.videoLight1, s.videoLight2} {
+			if r.PathValue("id") == strconv.Itoa(vl.GetLightID()) {
+				light = vl
+			}
+		}
+		if light == nil {
+			return nil, errNoDevice
+		}
+
+		on, brightness := light.GetState()
+		state := &VideoLightState{On: on, Brightness: brightness}
+		name := fmt.Sprintf("video light %d", light.GetLightID())
+		return &device{
+			name:  name,
+			value: state,
+			validate: func() error {
+				if state.Brightness < 0 || state.Brightness > 100 {
+					return fmt.Errorf("%s brightness out of range: %d", name, state.Brightness)
+				}
+				return nil
+			},
+			apply: func() error {
+				return light.SetState(state.On, state.Brightness)
+			},
+		}, nil
+	})
+}
+
+// checkBarID checks the request names the LED bar
+func (s *Server) checkBarID(r *http.Request) error {
+	if r.PathValue("id") != strconv.Itoa(s.ledBar.GetBarID()) {
+		return errNoDevice
+	}
+	return nil
+}
+
+// barSection returns the LED bar section a request names
+func (s *Server) barSection(r *http.Request) (int, error) {
+	if err := s.checkBarID(r); err != nil {
+		return 0, err
+	}
+	section, err := strconv.Atoi(r.PathValue("section"))
+	if err != nil || (section != 1 && section != 2) {
+		return 0, errNoDevice
+	}
+	return section, nil
+}
+
+// serveDevice reads (GET), replaces (PUT) or merge-patches (PATCH) a device resource
+//
+// An update that leaves the device as it was publishes nothing; one that
+// changes it publishes only that light and, like POST /api, cancels any
+// running transition. Responses carry the state revision as an ETag, and
+// updates with If-Match are refused with 412 and the current resource if the
+// state has changed since.
+func (s *Server) serveDevice(w http.ResponseWriter, r *http.Request, load func() (*device, error)) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := load()
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	revision, _, err := s.stateRevision()
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "Failed to read state: "+err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT", "PATCH":
+		if !s.ifMatch(r, revision) {
+			w.Header().Set("ETag", s.etag(revision))
+			w.WriteHeader(http.StatusPreconditionFailed)
+			if err := json.NewEncoder(w).Encode(d.value); err != nil {
+				log.Printf("Error encoding %s: %v", d.name, err)
+			}
+			return
+		}
+
+		before, err := json.Marshal(d.value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, `{"error":"Failed to read request body"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		if r.Method == "PATCH" {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+				http.Error(w, `{"error":"PATCH takes application/merge-patch+json"}`, http.StatusUnsupportedMediaType)
+				return
+			}
+			if body, err = mergePatch(before, body); err != nil {
+				http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Start from nothing so the new representation replaces the old one whole
+		reflect.ValueOf(d.value).Elem().SetZero()
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(d.value); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, "Invalid JSON: "+err.Error()), http.StatusBadRequest)
+			return
+		}
+		if err := d.validate(); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, "Validation failed: "+err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		after, err := json.Marshal(d.value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if !bytes.Equal(before, after) {
+			s.transitions.Stop()
+			if err := d.apply(); err != nil {
+				log.Printf("Error applying %s: %v", d.name, err)
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, "Failed to apply state: "+err.Error()), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Web: Updated %s", d.name)
+		}
+
+		// Read back what the light now holds
+		if d, err = load(); err != nil {
+			writeDeviceError(w, err)
+			return
+		}
+		if revision, _, err = s.stateRevision(); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, "Failed to read state: "+err.Error()), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("ETag", s.etag(revision))
+	if err := json.NewEncoder(w).Encode(d.value); err != nil {
+		log.Printf("Error encoding %s: %v", d.name, err)
+	}
+}
+
+// writeDeviceError maps a device resource error to an HTTP status
+func writeDeviceError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, errNoDevice) {
+		code = http.StatusNotFound
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
+
+// mergePatch applies a JSON merge patch (RFC 7396) to a JSON document
+func mergePatch(document, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(target, changes))
+}
+
+// mergeValue merges a decoded patch into a decoded target
+// Objects merge member by member, a null member removes it and anything else,
+// including an array, replaces the target whole.
+func mergeValue(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	merged, ok := target.(map[string]interface{})
+	if !ok {
+		merged = make(map[string]interface{})
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = mergeValue(merged[key], value)
+		}
+	}
+	return merged
+}
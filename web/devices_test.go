@@ -0,0 +1,131 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+)
+
+const mergePatchJSON = "application/merge-patch+json"
+
+func TestDeviceGet(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(10, 20, 30)
+
+	w := serve(s, "GET", "/api/ledstrip/0", "")
+	checkStatus(t, w, http.StatusOK)
+	var strip LEDStripState
+	decode(t, w, &strip)
+	if strip != (LEDStripState{R: 10, G: 20, B: 30}) {
+		t.Errorf("Expected 10,20,30, got %+v", strip)
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Error("Expected an ETag")
+	}
+
+	for _, path := range []string{
+		"/api/ledstrip/1",
+		"/api/ledbar/7",
+		"/api/ledbar/0/section/3",
+		"/api/ledbar/0/section/1/rgbw/6",
+		"/api/ledbar/0/section/1/white/x",
+		"/api/videolights/3",
+	} {
+		checkStatus(t, serve(s, "GET", path, ""), http.StatusNotFound)
+	}
+}
+
+func TestDevicePatchMerges(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(10, 20, 30)
+	s.videoLight1.SetState(true, 80)
+
+	w := serve(s, "PATCH", "/api/ledstrip/0", `{"g":100}`, "Content-Type", mergePatchJSON)
+	checkStatus(t, w, http.StatusOK)
+	var strip LEDStripState
+	decode(t, w, &strip)
+	if strip != (LEDStripState{R: 10, G: 100, B: 30}) {
+		t.Errorf("Expected only green to change, got %+v", strip)
+	}
+	if r, g, b := s.ledStrip.GetColor(); r != 10 || g != 100 || b != 30 {
+		t.Errorf("Expected the strip at 10,100,30, got %d,%d,%d", r, g, b)
+	}
+
+	w = serve(s, "PATCH", "/api/videolights/1", `{"brightness":40}`, "Content-Type", "application/json")
+	checkStatus(t, w, http.StatusOK)
+	if on, brightness := s.videoLight1.GetState(); !on || brightness != 40 {
+		t.Errorf("Expected video light 1 on at 40, got %v at %d", on, brightness)
+	}
+
+	w = serve(s, "PATCH", "/api/ledbar/0/section/2/rgbw/3", `{"w":255}`, "Content-Type", mergePatchJSON)
+	checkStatus(t, w, http.StatusOK)
+	if _, _, _, white, _ := s.ledBar.GetRGBW(2, 3); white != 255 {
+		t.Errorf("Expected RGBW LED 3 white at 255, got %d", white)
+	}
+
+	w = serve(s, "PATCH", "/api/ledbar/0/section/1/white/5", `128`, "Content-Type", mergePatchJSON)
+	checkStatus(t, w, http.StatusOK)
+	if value, _ := s.ledBar.GetWhite(1, 5); value != 128 {
+		t.Errorf("Expected white LED 5 at 128, got %d", value)
+	}
+}
+
+func TestDevicePutReplaces(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(10, 20, 30)
+
+	w := serve(s, "PUT", "/api/ledstrip/0", `{"r":5}`)
+	checkStatus(t, w, http.StatusOK)
+	var strip LEDStripState
+	decode(t, w, &strip)
+	if strip != (LEDStripState{R: 5}) {
+		t.Errorf("Expected missing members to be zeroed, got %+v", strip)
+	}
+}
+
+func TestDeviceUpdateErrors(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(10, 20, 30)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		header []string
+		want   int
+	}{
+		{"unknown member", "PUT", `{"r":1,"x":2}`, nil, http.StatusBadRequest},
+		{"out of range", "PATCH", `{"r":256}`, []string{"Content-Type", mergePatchJSON}, http.StatusBadRequest},
+		{"invalid JSON", "PATCH", `{"r":`, []string{"Content-Type", mergePatchJSON}, http.StatusBadRequest},
+		{"wrong media type", "PATCH", `{"r":1}`, []string{"Content-Type", "text/plain"}, http.StatusUnsupportedMediaType},
+		{"wrong method", "DELETE", "", nil, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkStatus(t, serve(s, tt.method, "/api/ledstrip/0", tt.body, tt.header...), tt.want)
+		})
+	}
+
+	if r, g, b := s.ledStrip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Expected refused updates to leave 10,20,30, got %d,%d,%d", r, g, b)
+	}
+}
+
+func TestDevicePublishesOnlyChanges(t *testing.T) {
+	s, mock := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(10, 20, 30)
+	mock.Clear()
+
+	// The same values publish nothing
+	checkStatus(t, serve(s, "PATCH", "/api/ledstrip/0", `{"r":10}`, "Content-Type", mergePatchJSON), http.StatusOK)
+	checkStatus(t, serve(s, "PUT", "/api/ledstrip/0", `{"r":10,"g":20,"b":30}`), http.StatusOK)
+	if mock.MessageCount() != 0 {
+		t.Errorf("Expected no messages for an unchanged device, got %d", mock.MessageCount())
+	}
+
+	// A change publishes that light alone
+	checkStatus(t, serve(s, "PATCH", "/api/ledstrip/0", `{"r":11}`, "Content-Type", mergePatchJSON), http.StatusOK)
+	messages := mock.GetMessages()
+	if len(messages) != 1 || messages[0].Topic != "test/strip" {
+		t.Errorf("Expected one message to test/strip, got %+v", messages)
+	}
+}
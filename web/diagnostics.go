@@ -0,0 +1,228 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// databaseCheckInterval is how long a database check is reused for, so
+// frequent health probes don't keep taking the database's write lock
+const databaseCheckInterval = 5 * time.Second
+
+// Health statuses, from best to worst
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded" // something optional, like the Stream Deck, is down
+	statusDown     = "down"     // something the lights can't work without is down
+)
+
+// StreamDeck reports whether the Stream Deck is attached
+type StreamDeck interface {
+	Attached() bool
+}
+
+// SetStreamDeck reports the Stream Deck's status in the health checks
+// deck is nil if the Stream Deck was wanted but couldn't be opened.
+func (s *Server) SetStreamDeck(deck StreamDeck) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.streamDeckEnabled = true
+	s.streamDeck = deck
+}
+
+// diagnostics is the system's state as reported by /api/diagnostics
+type diagnostics struct {
+	Status        string              `json:"status"`
+	StartedAt     time.Time           `json:"startedAt"`
+	Uptime        string              `json:"uptime"`
+	UptimeSeconds int64               `json:"uptimeSeconds"`
+	Build         buildInfo           `json:"build"`
+	MQTT          mqttDiagnostics     `json:"mqtt"`
+	Database      databaseDiagnostics `json:"database"`
+	StreamDeck    deckDiagnostics     `json:"streamDeck"`
+	Web           webDiagnostics      `json:"web"`
+}
+
+// buildInfo identifies the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// mqttDiagnostics describes the broker connection
+type mqttDiagnostics struct {
+	Status      string               `json:"status"`
+	Connected   bool                 `json:"connected"`
+	Reconnects  int                  `json:"reconnects"`
+	LastPublish map[string]time.Time `json:"lastPublish"` // by topic
+}
+
+// databaseDiagnostics describes the SQLite database
+type databaseDiagnostics struct {
+	Status        string    `json:"status"`
+	Writable      bool      `json:"writable"`
+	SchemaVersion int       `json:"schemaVersion"`
+	Error         string    `json:"error,omitempty"`
+	CheckedAt     time.Time `json:"checkedAt"`
+}
+
+// deckDiagnostics describes the Stream Deck
+type deckDiagnostics struct {
+	Status   string `json:"status"` // "disabled" if it wasn't asked for
+	Attached bool   `json:"attached"`
+}
+
+// webDiagnostics describes the web interface's clients
+type webDiagnostics struct {
+	EventClients int  `json:"eventClients"`
+	Sessions     int  `json:"sessions"`
+	Auth         bool `json:"auth"`
+}
+
+// handleHealth reports whether the system is working, with 503 if MQTT or the database is down
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	d := s.diagnose()
+	response := map[string]interface{}{
+		"status": d.Status,
+		"checks": map[string]string{
+			"mqtt":       d.MQTT.Status,
+			"database":   d.Database.Status,
+			"streamDeck": d.StreamDeck.Status,
+		},
+		"uptime":  d.Uptime,
+		"version": d.Build.Version,
+	}
+
+	if d.Status == statusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding health: %v", err)
+	}
+}
+
+// handleDiagnostics reports the state of everything the system depends on (GET)
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(s.diagnose()); err != nil {
+		log.Printf("Error encoding diagnostics: %v", err)
+	}
+}
+
+// diagnose checks MQTT, the database and the Stream Deck
+func (s *Server) diagnose() diagnostics {
+	uptime := time.Since(s.started)
+	d := diagnostics{
+		Status:        statusOK,
+		StartedAt:     s.started,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		Build:         readBuildInfo(),
+		MQTT:          s.diagnoseMQTT(),
+		Database:      s.diagnoseDatabase(),
+		StreamDeck:    s.diagnoseStreamDeck(),
+		Web: webDiagnostics{
+			EventClients: s.hub.Subscribers(),
+			Sessions:     s.auth.sessionCount(),
+			Auth:         s.auth.config.Enabled(),
+		},
+	}
+
+	switch {
+	case d.MQTT.Status == statusDown || d.Database.Status == statusDown:
+		d.Status = statusDown
+	case d.StreamDeck.Status == statusDown:
+		d.Status = statusDegraded
+	}
+	return d
+}
+
+// diagnoseMQTT reports the broker connection and when each topic was last published to
+func (s *Server) diagnoseMQTT() mqttDiagnostics {
+	d := mqttDiagnostics{Status: statusDown, LastPublish: s.metrics.LastPublished()}
+	if connection := s.metrics.Connection(); connection != nil {
+		d.Connected = connection.IsConnected()
+		d.Reconnects = connection.Reconnects()
+	}
+	if d.Connected {
+		d.Status = statusOK
+	}
+	return d
+}
+
+// diagnoseDatabase reports whether the database can be written and its schema
+// version, reusing a recent check
+func (s *Server) diagnoseDatabase() databaseDiagnostics {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	if time.Since(s.databaseCheck.CheckedAt) < databaseCheckInterval {
+		return s.databaseCheck
+	}
+
+	d := databaseDiagnostics{Status: statusOK, Writable: true, CheckedAt: time.Now()}
+	version, err := s.database.GetSchemaVersion()
+	if err == nil {
+		d.SchemaVersion = version
+		err = s.database.CheckWritable()
+	}
+	if err != nil {
+		log.Printf("Web: Database check failed: %v", err)
+		d.Status = statusDown
+		d.Writable = false
+		d.Error = err.Error()
+	}
+	s.databaseCheck = d
+	return d
+}
+
+// diagnoseStreamDeck reports whether the Stream Deck is attached, if it was asked for
+func (s *Server) diagnoseStreamDeck() deckDiagnostics {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	if !s.streamDeckEnabled {
+		return deckDiagnostics{Status: "disabled"}
+	}
+	if s.streamDeck == nil || !s.streamDeck.Attached() {
+		return deckDiagnostics{Status: statusDown}
+	}
+	return deckDiagnostics{Status: statusOK, Attached: true}
+}
+
+// readBuildInfo returns the module version and VCS details Go recorded in the binary
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: "unknown"}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Version = build.Main.Version
+	info.GoVersion = build.GoVersion
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// fakeConnection is an MQTT connection that is up or down as told
+type fakeConnection struct {
+	connected bool
+}
+
+func (c fakeConnection) IsConnected() bool { return c.connected }
+func (c fakeConnection) Reconnects() int   { return 2 }
+
+// brokenDatabase is a database that can't be read or written
+type brokenDatabase struct{}
+
+func (brokenDatabase) GetSchemaVersion() (int, error) { return 0, errors.New("disk I/O error") }
+func (brokenDatabase) CheckWritable() error           { return errors.New("disk I/O error") }
+
+// fakeDeck is a Stream Deck that is attached or not as told
+type fakeDeck struct {
+	attached bool
+}
+
+func (d fakeDeck) Attached() bool { return d.attached }
+
+// health is the body of a /health response
+type health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		connected bool
+		database  bool
+		deck      StreamDeck
+		code      int
+		status    string
+		checks    map[string]string
+	}{
+		{"all up", true, true, nil, http.StatusOK, statusOK,
+			map[string]string{"mqtt": statusOK, "database": statusOK, "streamDeck": "disabled"}},
+		{"MQTT down", false, true, nil, http.StatusServiceUnavailable, statusDown,
+			map[string]string{"mqtt": statusDown, "database": statusOK}},
+		{"database down", true, false, nil, http.StatusServiceUnavailable, statusDown,
+			map[string]string{"mqtt": statusOK, "database": statusDown}},
+		{"Stream Deck detached", true, true, fakeDeck{attached: false}, http.StatusOK, statusDegraded,
+			map[string]string{"streamDeck": statusDown}},
+		{"Stream Deck attached", true, true, fakeDeck{attached: true}, http.StatusOK, statusOK,
+			map[string]string{"streamDeck": statusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, testAuth)
+			s.metrics.WatchConnection(fakeConnection{connected: tt.connected})
+			if !tt.database {
+				s.database = brokenDatabase{}
+			}
+			if tt.deck != nil {
+				s.SetStreamDeck(tt.deck)
+			}
+
+			w := serve(s, "GET", "/health", "")
+			checkStatus(t, w, tt.code)
+			var got health
+			decode(t, w, &got)
+			if got.Status != tt.status {
+				t.Errorf("Expected status %q, got %q", tt.status, got.Status)
+			}
+			for check, want := range tt.checks {
+				if got.Checks[check] != want {
+					t.Errorf("Expected %s %q, got %q", check, want, got.Checks[check])
+				}
+			}
+		})
+	}
+}
+
+func TestHealthWithoutConnection(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+
+	w := serve(s, "GET", "/health", "")
+	checkStatus(t, w, http.StatusServiceUnavailable)
+	var got health
+	decode(t, w, &got)
+	if got.Checks["mqtt"] != statusDown {
+		t.Errorf("Expected MQTT down with no connection watched, got %q", got.Checks["mqtt"])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	s, _ := newTestServer(t, testAuth)
+	s.metrics.WatchConnection(fakeConnection{connected: true})
+
+	checkStatus(t, serve(s, "GET", "/api/diagnostics", ""), http.StatusUnauthorized)
+	checkStatus(t, serve(s, "POST", "/api/diagnostics", "", bearer("admin-token")...), http.StatusMethodNotAllowed)
+
+	w := serve(s, "GET", "/api/diagnostics", "", bearer("read-token")...)
+	checkStatus(t, w, http.StatusOK)
+	var d diagnostics
+	decode(t, w, &d)
+	if d.Status != statusOK || !d.MQTT.Connected || d.MQTT.Reconnects != 2 {
+		t.Errorf("Unexpected MQTT diagnostics %+v (status %q)", d.MQTT, d.Status)
+	}
+	if !d.Database.Writable || d.Database.SchemaVersion == 0 {
+		t.Errorf("Unexpected database diagnostics %+v", d.Database)
+	}
+	if !d.Web.Auth {
+		t.Error("Expected auth to be reported on")
+	}
+}
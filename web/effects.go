@@ -0,0 +1,116 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kevin/office_lights/effects"
+)
+
+// effectStartRequest names an effect, the device to run it on and its parameters
+type effectStartRequest struct {
+	Effect string         `json:"effect"`
+	Device string         `json:"device"`
+	Params effects.Params `json:"params,omitempty"`
+}
+
+// effectStopRequest names the device to stop; empty stops every effect
+type effectStopRequest struct {
+	Device string `json:"device"`
+}
+
+// handleEffects lists the available effects and the ones running
+func (s *Server) handleEffects(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeEffects(w)
+}
+
+// handleEffectStart starts an effect on a device
+func (s *Server) handleEffectStart(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req effectStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	device, err := effects.ParseDevice(req.Device)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := s.effects.Start(req.Effect, device, req.Params); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Web: Started %s on %s", req.Effect, device)
+	s.writeEffects(w)
+}
+
+// handleEffectStop stops the effect on a device, or every effect
+func (s *Server) handleEffectStop(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req effectStopRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Device == "" {
+		s.effects.StopAll()
+		log.Println("Web: Stopped all effects")
+	} else {
+		device, err := effects.ParseDevice(req.Device)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		s.effects.Stop(device)
+		log.Printf("Web: Stopped effect on %s", device)
+	}
+
+	s.writeEffects(w)
+}
+
+// writeEffects writes the effect definitions and running effects as JSON
+func (s *Server) writeEffects(w http.ResponseWriter) {
+	if err := json.NewEncoder(w).Encode(s.effectsResponse()); err != nil {
+		log.Printf("Error encoding effects: %v", err)
+	}
+}
+
+// effectsResponse is the available and running effects, as served by GET /api/effects
+func (s *Server) effectsResponse() map[string]interface{} {
+	running := s.effects.Running()
+	if running == nil {
+		running = []effects.Status{}
+	}
+
+	return map[string]interface{}{
+		"effects": effects.List(),
+		"running": running,
+	}
+}
@@ -0,0 +1,209 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Event stream timing
+const (
+	eventThrottle  = 100 * time.Millisecond // least time between light updates to one client
+	eventPoll      = time.Second            // how often the non-light sections are checked for changes
+	eventKeepalive = 15 * time.Second       // comment sent on an idle stream so proxies keep it open
+)
+
+// lightSections are the top-level keys of the light state, sent individually when they change
+var lightSections = []string{"ledStrip", "ledBar", "videoLight1", "videoLight2"}
+
+// eventStream tracks what one client has been sent, so only changes go out
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sent    map[string][]byte // last JSON sent per light section or event name
+}
+
+// handleEvents streams state changes as server-sent events (GET)
+//
+// The stream opens with a "state" event holding every light, then sends
+// "state" events holding only the lights that changed, each with the state's
+// revision. Effects, sequences, circadian, sleep, on-air, notification and
+// undo history status go out as events of those names whenever they change.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"Streaming not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Web: Failed to clear event stream deadline: %v", err)
+	}
+
+	changed, unsubscribe := s.hub.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w, flusher: flusher, sent: make(map[string][]byte)}
+	if err := s.sendLights(stream); err != nil {
+		log.Printf("Web: Event stream closed: %v", err)
+		return
+	}
+	if err := s.sendStatus(stream); err != nil {
+		log.Printf("Web: Event stream closed: %v", err)
+		return
+	}
+
+	poll := time.NewTicker(eventPoll)
+	defer poll.Stop()
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+
+	var lastLights time.Time
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-changed:
+			// Let a burst of changes, such as a fade, settle into one update
+			if wait := eventThrottle - time.Since(lastLights); wait > 0 {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-s.closing:
+					return
+				case <-time.After(wait):
+				}
+			}
+			lastLights = time.Now()
+			err = s.sendLights(stream)
+		case <-poll.C:
+			err = s.sendStatus(stream)
+		case <-keepalive.C:
+			err = stream.comment("keepalive")
+		}
+		if err != nil {
+			log.Printf("Web: Event stream closed: %v", err)
+			return
+		}
+	}
+}
+
+// sendLights sends a "state" event with the lights that changed since the last one
+// and the state's revision, the number at the end of the ETag of GET /api
+func (s *Server) sendLights(stream *eventStream) error {
+	s.mu.Lock()
+	revision, state, err := s.stateRevision()
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	delta := make(map[string]json.RawMessage)
+	for _, name := range lightSections {
+		if stream.changed(name, sections[name]) {
+			delta[name] = sections[name]
+		}
+	}
+	if len(delta) == 0 {
+		return nil
+	}
+	delta["revision"] = json.RawMessage(strconv.FormatUint(revision, 10))
+	return stream.send("state", delta)
+}
+
+// sendStatus sends an event for each non-light section that changed since it was last sent
+func (s *Server) sendStatus(stream *eventStream) error {
+	type event struct {
+		name     string
+		response interface{}
+	}
+	events := []event{{"effects", s.effectsResponse()}}
+	if sequences, err := s.sequencesResponse(); err != nil {
+		log.Printf("Error listing sequences: %v", err)
+	} else {
+		events = append(events, event{"sequences", sequences})
+	}
+	events = append(events,
+		event{"circadian", s.circadianResponse()},
+		event{"sleep", s.sleepResponse()},
+		event{"onair", s.onAirResponse()},
+		event{"notify", s.notifyResponse()},
+		event{"history", s.history.Status()},
+	)
+
+	for _, event := range events {
+		data, err := json.Marshal(event.response)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", event.name, err)
+		}
+		if !stream.changed(event.name, data) {
+			continue
+		}
+		if err := stream.send(event.name, json.RawMessage(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changed records data as sent under key, reporting whether it differs from what was sent before
+func (e *eventStream) changed(key string, data []byte) bool {
+	if bytes.Equal(e.sent[key], data) {
+		return false
+	}
+	e.sent[key] = data
+	return true
+}
+
+// send writes an event and flushes it to the client
+func (e *eventStream) send(event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event, err)
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// comment writes an SSE comment, which clients ignore, to keep the connection alive
+func (e *eventStream) comment(text string) error {
+	if _, err := fmt.Fprintf(e.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is one server-sent event
+type sseEvent struct {
+	name string
+	data map[string]json.RawMessage
+}
+
+// readEvents decodes the events of a stream onto a channel until it ends
+func readEvents(t *testing.T, resp *http.Response) <-chan sseEvent {
+	t.Helper()
+
+	out := make(chan sseEvent, 64)
+	go func() {
+		defer close(out)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		var name string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				var data map[string]json.RawMessage
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+					t.Errorf("Invalid %s event: %v", name, err)
+					return
+				}
+				out <- sseEvent{name: name, data: data}
+			}
+		}
+	}()
+	return out
+}
+
+// nextState waits for the next "state" event, failing the test after two seconds
+func nextState(t *testing.T, stream <-chan sseEvent) sseEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event, ok := <-stream:
+			if !ok {
+				t.Fatal("Event stream ended")
+			}
+			if event.name == "state" {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for a state event")
+		}
+	}
+}
+
+func TestEventStreamSendsDeltas(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/events failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", ct)
+	}
+	stream := readEvents(t, resp)
+
+	// The first state event holds every light
+	first := nextState(t, stream)
+	for _, section := range append(lightSections, "revision") {
+		if _, ok := first.data[section]; !ok {
+			t.Errorf("Initial state missing %q: %v", section, first.data)
+		}
+	}
+
+	// Later ones only hold what changed, with a newer revision
+	if err := s.ledStrip.SetColor(10, 20, 30); err != nil {
+		t.Fatalf("SetColor failed: %v", err)
+	}
+	delta := nextState(t, stream)
+	if len(delta.data) != 2 {
+		t.Errorf("Expected only ledStrip and revision, got %v", delta.data)
+	}
+	var strip LEDStripState
+	if err := json.Unmarshal(delta.data["ledStrip"], &strip); err != nil || strip != (LEDStripState{R: 10, G: 20, B: 30}) {
+		t.Errorf("Unexpected ledStrip delta: %s (%v)", delta.data["ledStrip"], err)
+	}
+
+	var before, after uint64
+	json.Unmarshal(first.data["revision"], &before)
+	json.Unmarshal(delta.data["revision"], &after)
+	if after <= before {
+		t.Errorf("Expected the revision to go up from %d, got %d", before, after)
+	}
+}
+
+func TestEventStreamMethod(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	checkStatus(t, serve(s, "POST", "/api/events", ""), http.StatusMethodNotAllowed)
+}
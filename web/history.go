@@ -0,0 +1,69 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kevin/office_lights/history"
+)
+
+// handleHistory returns how far the lights can be undone and redone (GET)
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(s.history.Status()); err != nil {
+		log.Printf("Error encoding history: %v", err)
+	}
+}
+
+// handleHistoryAction undoes or redoes the last edit to the lights (POST)
+func (s *Server) handleHistoryAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var status history.Status
+	var err error
+	action := r.PathValue("action")
+	switch action {
+	case "undo":
+		status, err = s.history.Undo()
+	case "redo":
+		status, err = s.history.Redo()
+	default:
+		http.Error(w, `{"error":"Unknown history action"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeHistoryError(w, err)
+		return
+	}
+
+	log.Printf("Web: History %s (%d to undo, %d to redo)", action, status.Undo, status.Redo)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Error encoding history: %v", err)
+	}
+}
+
+// writeHistoryError maps an undo or redo error to an HTTP status
+func writeHistoryError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, history.ErrNothingToUndo), errors.Is(err, history.ErrNothingToRedo):
+		code = http.StatusConflict
+	default:
+		log.Printf("Error changing history: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
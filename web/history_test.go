@@ -0,0 +1,52 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kevin/office_lights/history"
+)
+
+func TestHistoryUndoRedo(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+
+	// Nothing has been edited yet
+	checkStatus(t, serve(s, "POST", "/api/history/undo", ""), http.StatusConflict)
+	checkStatus(t, serve(s, "POST", "/api/history/redo", ""), http.StatusConflict)
+
+	// An edit that hasn't settled yet can still be undone
+	checkStatus(t, serve(s, "PUT", "/api/ledstrip/0", `{"r":10,"g":20,"b":30}`), http.StatusOK)
+	w := serve(s, "POST", "/api/history/undo", "")
+	checkStatus(t, w, http.StatusOK)
+	var status history.Status
+	decode(t, w, &status)
+	if status != (history.Status{Undo: 0, Redo: 1}) {
+		t.Errorf("Expected 0 to undo and 1 to redo, got %+v", status)
+	}
+	if r, g, b := s.ledStrip.GetColor(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("Expected the strip back off, got %d,%d,%d", r, g, b)
+	}
+	checkStatus(t, serve(s, "POST", "/api/history/undo", ""), http.StatusConflict)
+
+	w = serve(s, "POST", "/api/history/redo", "")
+	checkStatus(t, w, http.StatusOK)
+	if r, g, b := s.ledStrip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Expected the strip at 10,20,30 again, got %d,%d,%d", r, g, b)
+	}
+	checkStatus(t, serve(s, "POST", "/api/history/redo", ""), http.StatusConflict)
+
+	w = serve(s, "GET", "/api/history", "")
+	checkStatus(t, w, http.StatusOK)
+	decode(t, w, &status)
+	if status != (history.Status{Undo: 1, Redo: 0}) {
+		t.Errorf("Expected 1 to undo and 0 to redo, got %+v", status)
+	}
+}
+
+func TestHistoryRoutes(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+
+	checkStatus(t, serve(s, "POST", "/api/history/rewind", ""), http.StatusNotFound)
+	checkStatus(t, serve(s, "GET", "/api/history/undo", ""), http.StatusMethodNotAllowed)
+	checkStatus(t, serve(s, "POST", "/api/history", ""), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/metrics"
+)
+
+// handleMetrics serves the lights' current values and the system's counters for Prometheus
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := s.writeLightMetrics(&buf); err != nil {
+		log.Printf("Error reading lights for metrics: %v", err)
+		http.Error(w, "Failed to read lights", http.StatusInternalServerError)
+		return
+	}
+
+	s.metrics.SetClients("web_events", s.hub.Subscribers())
+	s.metrics.SetClients("web_sessions", s.auth.sessionCount())
+	if err := s.metrics.Write(&buf); err != nil {
+		http.Error(w, "Failed to write metrics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// writeLightMetrics writes the strip's channels, the bar sections' channel
+// averages and the video lights' state as gauges
+func (s *Server) writeLightMetrics(buf *bytes.Buffer) error {
+	r, g, b := s.ledStrip.GetColor()
+	metrics.WriteGauge(buf, "office_lights_ledstrip_value", "LED strip channel value (0-255).",
+		channelSample("r", r), channelSample("g", g), channelSample("b", b))
+
+	var bar []metrics.Sample
+	for section := 1; section <= 2; section++ {
+		state, err := lights.ReadBarSection(s.ledBar, section)
+		if err != nil {
+			return err
+		}
+
+		var sums [4]int
+		for _, led := range state.RGBW {
+			sums[0] += led.R
+			sums[1] += led.G
+			sums[2] += led.B
+			sums[3] += led.W
+		}
+		white := 0
+		for _, value := range state.White {
+			white += value
+		}
+
+		label := metrics.Label{Name: "section", Value: strconv.Itoa(section)}
+		for i, channel := range []string{"r", "g", "b", "w"} {
+			bar = append(bar, metrics.Sample{
+				Labels: []metrics.Label{label, {Name: "channel", Value: channel}},
+				Value:  float64(sums[i]) / float64(len(state.RGBW)),
+			})
+		}
+		bar = append(bar, metrics.Sample{
+			Labels: []metrics.Label{label, {Name: "channel", Value: "white"}},
+			Value:  float64(white) / float64(len(state.White)),
+		})
+	}
+	metrics.WriteGauge(buf, "office_lights_ledbar_average", "LED bar channel value averaged over a section's LEDs (0-255).", bar...)
+
+	var on, brightness []metrics.Sample
+	for _, light := range []*videolight.VideoLight{s.videoLight1, s.videoLight2} {
+		lightOn, lightBrightness := light.GetState()
+		labels := []metrics.Label{{Name: "light", Value: strconv.Itoa(light.GetLightID())}}
+		value := 0.0
+		if lightOn {
+			value = 1
+		}
+		on = append(on, metrics.Sample{Labels: labels, Value: value})
+		brightness = append(brightness, metrics.Sample{Labels: labels, Value: float64(lightBrightness)})
+	}
+	metrics.WriteGauge(buf, "office_lights_videolight_on", "Whether a video light is on.", on...)
+	metrics.WriteGauge(buf, "office_lights_videolight_brightness", "Video light brightness (0-100).", brightness...)
+	return nil
+}
+
+// channelSample is a sample labelled with a colour channel
+func channelSample(channel string, value int) metrics.Sample {
+	return metrics.Sample{Labels: []metrics.Label{{Name: "channel", Value: channel}}, Value: float64(value)}
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/kevin/office_lights/notify"
+)
+
+// handleNotify lists the notifications (GET), flashes one (POST) or clears them all (DELETE)
+func (s *Server) handleNotify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeNotifications(w, http.StatusOK)
+	case "POST":
+		var n notify.Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		id, err := s.notifier.Notify(n)
+		if err != nil {
+			writeNotifyError(w, err)
+			return
+		}
+
+		log.Printf("Web: Queued notification %d", id)
+		response := map[string]interface{}{
+			"id":            id,
+			"notifications": s.notifier.List(),
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("Error encoding notification: %v", err)
+		}
+	case "DELETE":
+		s.notifier.Clear()
+		log.Println("Web: Cleared notifications")
+		s.writeNotifications(w, http.StatusOK)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleNotification cancels a flashing or queued notification (DELETE)
+func (s *Server) handleNotification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "DELETE" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid notification ID"}`, http.StatusBadRequest)
+		return
+	}
+	if err := s.notifier.Cancel(id); err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+
+	log.Printf("Web: Cancelled notification %d", id)
+	s.writeNotifications(w, http.StatusOK)
+}
+
+// writeNotifyError maps a notification error to an HTTP status
+func writeNotifyError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, notify.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, notify.ErrInvalidNotification):
+		code = http.StatusBadRequest
+	case errors.Is(err, notify.ErrQueueFull):
+		code = http.StatusServiceUnavailable
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
+
+// writeNotifications writes the flashing and queued notifications as JSON
+func (s *Server) writeNotifications(w http.ResponseWriter, code int) {
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(s.notifyResponse()); err != nil {
+		log.Printf("Error encoding notifications: %v", err)
+	}
+}
+
+// notifyResponse is the flashing and queued notifications, as served by GET /api/notify
+func (s *Server) notifyResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"notifications": s.notifier.List(),
+	}
+}
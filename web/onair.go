@@ -0,0 +1,97 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/onair"
+	"github.com/kevin/office_lights/storage"
+)
+
+// handleOnAir returns (GET) or replaces (PUT) the on-air settings, including whether it is on
+func (s *Server) handleOnAir(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeOnAir(w)
+	case "PUT":
+		var settings storage.OnAirSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := s.onAir.Configure(settings); err != nil {
+			writeOnAirError(w, err)
+			return
+		}
+
+		log.Printf("Web: Updated on-air settings (on: %t)", settings.Active)
+		s.writeOnAir(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOnAirSwitch switches the indicator on, off or over (POST /api/onair/{on|off|toggle})
+func (s *Server) handleOnAirSwitch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	switch action := r.PathValue("action"); action {
+	case "on":
+		err = s.onAir.Set(true)
+	case "off":
+		err = s.onAir.Set(false)
+	case "toggle":
+		_, err = s.onAir.Toggle()
+	default:
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "Unknown action "+action+" (use on, off or toggle)"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeOnAirError(w, err)
+		return
+	}
+
+	log.Printf("Web: Switched on air %s (now on: %t)", r.PathValue("action"), s.onAir.Active())
+	s.writeOnAir(w)
+}
+
+// writeOnAirError maps an on-air error to an HTTP status
+func writeOnAirError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, onair.ErrInvalidSettings) {
+		code = http.StatusBadRequest
+	} else {
+		log.Printf("Error switching on-air indicator: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
+
+// writeOnAir writes the on-air settings and the lights it can take over as JSON
+func (s *Server) writeOnAir(w http.ResponseWriter) {
+	if err := json.NewEncoder(w).Encode(s.onAirResponse()); err != nil {
+		log.Printf("Error encoding on-air settings: %v", err)
+	}
+}
+
+// onAirResponse is the on-air settings and the lights it can take over, as served by GET /api/onair
+func (s *Server) onAirResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"settings": s.onAir.Settings(),
+		"lights":   lights.SelectionNames,
+		"minPulse": onair.MinPulse.Milliseconds(),
+	}
+}
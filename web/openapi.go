@@ -0,0 +1,24 @@
+package web
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes the state, device and scene endpoints as OpenAPI 3
+// The client package is written against it; keep the two in step.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves the OpenAPI document
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// stateRevision returns the revision of the light state, going up whenever the
+// state is seen to differ from the last time; the caller holds mu
+//
+// Revisions are worked out from the state itself rather than counted as lights
+// are published, so changes made anywhere (the TUI, the Stream Deck, MQTT,
+// automations) move it on, while notification flashes and other overrides,
+// which leave the state alone, don't.
+func (s *Server) stateRevision() (uint64, *State, error) {
+	state, err := BuildState(s.ledStrip, s.ledBar, s.videoLight1, s.videoLight2)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !bytes.Equal(data, s.revisionState) {
+		s.revision++
+		s.revisionState = data
+	}
+	return s.revision, state, nil
+}
+
+// etag formats a state revision as an ETag, prefixed with when the server
+// started so that tags from before a restart, when revisions count from zero
+// again, never match
+func (s *Server) etag(revision uint64) string {
+	return fmt.Sprintf(`"%s-%d"`, strconv.FormatInt(s.started.UnixNano(), 36), revision)
+}
+
+// ifMatch reports whether a request's If-Match header, if it has one, matches the revision
+func (s *Server) ifMatch(r *http.Request, revision uint64) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	want := s.etag(revision)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// If-Match compares strongly, so weak tags never match
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
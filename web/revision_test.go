@@ -0,0 +1,95 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeviceIfMatch(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+
+	read := serve(s, "GET", "/api/ledstrip/0", "")
+	checkStatus(t, read, http.StatusOK)
+	tag := read.Header().Get("ETag")
+
+	// An update against the current revision goes through and moves it on
+	w := serve(s, "PUT", "/api/ledstrip/0", `{"r":10,"g":20,"b":30}`, "If-Match", tag)
+	checkStatus(t, w, http.StatusOK)
+	newTag := w.Header().Get("ETag")
+	if newTag == tag {
+		t.Fatalf("Expected the ETag to change from %s", tag)
+	}
+
+	// One against the old revision is refused with the current resource
+	w = serve(s, "PUT", "/api/ledstrip/0", `{"r":1}`, "If-Match", tag)
+	checkStatus(t, w, http.StatusPreconditionFailed)
+	if got := w.Header().Get("ETag"); got != newTag {
+		t.Errorf("Expected ETag %s with the 412, got %s", newTag, got)
+	}
+	var strip LEDStripState
+	decode(t, w, &strip)
+	if strip != (LEDStripState{R: 10, G: 20, B: 30}) {
+		t.Errorf("Expected the current strip with the 412, got %+v", strip)
+	}
+	if r, _, _ := s.ledStrip.GetColor(); r != 10 {
+		t.Errorf("Expected the refused update to leave red at 10, got %d", r)
+	}
+
+	// Weak tags never match; "*" and a list holding the current tag do
+	checkStatus(t, serve(s, "PUT", "/api/ledstrip/0", `{"r":1}`, "If-Match", "W/"+newTag), http.StatusPreconditionFailed)
+	checkStatus(t, serve(s, "PATCH", "/api/ledstrip/0", `{"r":2}`, "Content-Type", mergePatchJSON, "If-Match", "*"), http.StatusOK)
+	w = serve(s, "GET", "/api/ledstrip/0", "")
+	checkStatus(t, serve(s, "PATCH", "/api/ledstrip/0", `{"r":3}`, "Content-Type", mergePatchJSON, "If-Match", tag+", "+w.Header().Get("ETag")), http.StatusOK)
+}
+
+func TestStateIfMatch(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+
+	read := serve(s, "GET", "/api", "")
+	checkStatus(t, read, http.StatusOK)
+	tag := read.Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("Expected an ETag")
+	}
+	var state State
+	decode(t, read, &state)
+
+	// A change made elsewhere moves the revision on
+	s.videoLight2.SetState(true, 50)
+
+	state.LEDStrip = LEDStripState{R: 10, G: 20, B: 30}
+	body, _ := json.Marshal(state)
+	w := serve(s, "POST", "/api", string(body), "If-Match", tag)
+	checkStatus(t, w, http.StatusPreconditionFailed)
+	var current State
+	decode(t, w, &current)
+	if !current.VideoLight2.On || current.VideoLight2.Brightness != 50 {
+		t.Errorf("Expected the current state with the 412, got %+v", current.VideoLight2)
+	}
+	if r, _, _ := s.ledStrip.GetColor(); r != 0 {
+		t.Errorf("Expected the refused state to leave the strip alone, got red %d", r)
+	}
+
+	// Retrying against the revision that came back goes through
+	w = serve(s, "POST", "/api", string(body), "If-Match", w.Header().Get("ETag"))
+	checkStatus(t, w, http.StatusOK)
+	if r, g, b := s.ledStrip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Expected the strip at 10,20,30, got %d,%d,%d", r, g, b)
+	}
+}
+
+func TestETagChangesOnRestart(t *testing.T) {
+	before, _ := newTestServer(t, AuthConfig{})
+	tag := serve(before, "GET", "/api", "").Header().Get("ETag")
+
+	// A restarted server counts revisions from the start again
+	after, _ := newTestServer(t, AuthConfig{})
+	after.started = before.started.Add(time.Second)
+	read := serve(after, "GET", "/api", "")
+	if got := read.Header().Get("ETag"); got == tag {
+		t.Fatalf("Expected a different ETag after a restart, got %s again", got)
+	}
+	checkStatus(t, serve(after, "PUT", "/api/ledstrip/0", `{"r":1}`, "If-Match", tag), http.StatusPreconditionFailed)
+}
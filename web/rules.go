@@ -0,0 +1,241 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// ruleResponse is a stored rule with when its time trigger fires next
+type ruleResponse struct {
+	storage.Rule
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// handleRules lists the rules (GET) or creates one (POST)
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeRules(w)
+	case "POST":
+		rule, ok := s.decodeRule(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := s.ruleStore.CreateRule(*rule)
+		if err != nil {
+			writeRuleError(w, err)
+			return
+		}
+
+		log.Printf("Web: Created rule %q", rule.Name)
+		s.reloadRules()
+		s.writeRule(w, id, http.StatusCreated)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRule returns (GET), replaces (PUT) or deletes (DELETE) a rule
+func (s *Server) handleRule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.writeRule(w, id, http.StatusOK)
+	case "PUT":
+		rule, ok := s.decodeRule(w, r)
+		if !ok {
+			return
+		}
+		rule.ID = id
+
+		if err := s.ruleStore.UpdateRule(*rule); err != nil {
+			writeRuleError(w, err)
+			return
+		}
+
+		log.Printf("Web: Updated rule %q", rule.Name)
+		s.reloadRules()
+		s.writeRule(w, id, http.StatusOK)
+	case "DELETE":
+		if err := s.ruleStore.DeleteRule(id); err != nil {
+			writeRuleError(w, err)
+			return
+		}
+
+		log.Printf("Web: Deleted rule %d", id)
+		s.reloadRules()
+		s.writeRules(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRuleRun runs a rule's actions now, whatever its trigger and conditions
+func (s *Server) handleRuleRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.rules.RunNow(id); err != nil {
+		if errors.Is(err, storage.ErrRuleNotFound) {
+			writeRuleError(w, err)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Web: Ran rule %d", id)
+	s.writeRule(w, id, http.StatusOK)
+}
+
+// handleHook fires the rules with a webhook trigger for the hook in the path
+// The request body, if any, is matched like an MQTT payload.
+func (s *Server) handleHook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to read body"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	hook := r.PathValue("hook")
+	listening, fired := s.rules.Webhook(hook, body)
+	if listening == 0 {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, fmt.Sprintf("no enabled rule listens for webhook %q", hook)), http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Web: Webhook %q fired %d of %d rules", hook, fired, listening)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"hook": hook, "listening": listening, "fired": fired}); err != nil {
+		log.Printf("Error encoding webhook result: %v", err)
+	}
+}
+
+// ruleID parses the rule ID from the request path, writing an error if it is invalid
+func ruleID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid rule ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeRule reads a rule from the request body and checks its trigger, conditions and actions
+// Rules are enabled unless the body says otherwise.
+func (s *Server) decodeRule(w http.ResponseWriter, r *http.Request) (*storage.Rule, bool) {
+	rule := storage.Rule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	if err := s.rules.Validate(rule); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+	return &rule, true
+}
+
+// reloadRules tells the rule engine the stored rules have changed
+func (s *Server) reloadRules() {
+	if err := s.rules.Reload(); err != nil {
+		log.Printf("Error reloading rules: %v", err)
+	}
+}
+
+// writeRuleError maps a rule store error to an HTTP status
+func writeRuleError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrRuleNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, storage.ErrRuleNameRequired):
+		code = http.StatusBadRequest
+	case errors.Is(err, storage.ErrRuleNameTaken):
+		code = http.StatusConflict
+	default:
+		log.Printf("Error saving rule: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
+
+// withNextFire adds when a rule's time trigger fires next
+func (s *Server) withNextFire(rule storage.Rule) ruleResponse {
+	response := ruleResponse{Rule: rule}
+	if next, ok := s.rules.NextFire(rule.ID); ok {
+		response.Next = &next
+	}
+	return response
+}
+
+// writeRule writes a single rule as JSON
+func (s *Server) writeRule(w http.ResponseWriter, id int, code int) {
+	rule, err := s.ruleStore.GetRule(id)
+	if err != nil {
+		log.Printf("Error loading rule: %v", err)
+		http.Error(w, `{"error":"Failed to load rule"}`, http.StatusInternalServerError)
+		return
+	}
+	if rule == nil {
+		http.Error(w, `{"error":"Rule not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(s.withNextFire(*rule)); err != nil {
+		log.Printf("Error encoding rule: %v", err)
+	}
+}
+
+// writeRules writes every rule as JSON
+func (s *Server) writeRules(w http.ResponseWriter) {
+	list, err := s.ruleStore.ListRules()
+	if err != nil {
+		log.Printf("Error listing rules: %v", err)
+		http.Error(w, `{"error":"Failed to list rules"}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]ruleResponse, len(list))
+	for i, rule := range list {
+		response[i] = s.withNextFire(rule)
+	}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"rules": response}); err != nil {
+		log.Printf("Error encoding rules: %v", err)
+	}
+}
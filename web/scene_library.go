@@ -0,0 +1,455 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
+)
+
+// errInvalidScene reports scene details that can't be saved, such as a malformed colour
+var errInvalidScene = errors.New("invalid scene")
+
+// sceneResponse is a library scene with its light state and a preview for swatches
+type sceneResponse struct {
+	ID          int                `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	BgColor     string             `json:"bgColor,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+	Devices     *storage.SceneData `json:"devices,omitempty"` // nil if nothing has been saved
+	Preview     scenePreview       `json:"preview"`
+}
+
+// scenePreview summarises what a scene sets each light to; lights it leaves alone are left out
+type scenePreview struct {
+	LEDStrip    string           `json:"ledStrip,omitempty"` // "#rrggbb"
+	Section1    *sectionPreview  `json:"section1,omitempty"`
+	Section2    *sectionPreview  `json:"section2,omitempty"`
+	VideoLight1 *VideoLightState `json:"videoLight1,omitempty"`
+	VideoLight2 *VideoLightState `json:"videoLight2,omitempty"`
+}
+
+// sectionPreview summarises an LED bar section
+type sectionPreview struct {
+	RGBW  []string `json:"rgbw"`  // each RGBW LED as "#rrggbb" with its white mixed in, "" if the scene leaves it alone
+	White *int     `json:"white"` // average of the white LEDs the scene sets, nil if none
+}
+
+// sceneRequest saves the current state as a new scene, or changes a scene's details
+// Fields left out of a PATCH are kept.
+type sceneRequest struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	BgColor     *string   `json:"bgColor"`
+	Tags        *[]string `json:"tags"`
+	Lights      []string  `json:"lights"` // lights to capture when saving, empty for every light
+}
+
+// sceneRecallRequest optionally overrides the default transition for a recall
+type sceneRecallRequest struct {
+	Transition *lights.TransitionSpec `json:"transition"`
+}
+
+// handleScenes lists the scene library (GET) or saves the current state as a new scene (POST)
+func (s *Server) handleScenes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeScenes(w)
+	case "POST":
+		s.saveCurrentScene(w, r, false)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// saveCurrentScene saves the current state of the requested lights as a new scene
+// A taken name is refused unless overwrite is set, in which case that scene's
+// lights are replaced and its other details kept.
+func (s *Server) saveCurrentScene(w http.ResponseWriter, r *http.Request, overwrite bool) {
+	var req sceneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	info := storage.SceneInfo{}
+	if err := req.applyTo(&info); err != nil {
+		writeSceneError(w, err)
+		return
+	}
+	sel := lights.SelectAll()
+	if len(req.Lights) > 0 {
+		var err error
+		if sel, err = lights.ParseSelection(req.Lights); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	data := s.transitions.Rig().Capture(sel)
+	s.mu.Unlock()
+
+	if overwrite {
+		existing, err := s.scenes.FindSceneByName(info.Name)
+		if err != nil {
+			writeSceneError(w, err)
+			return
+		}
+		if existing != nil {
+			if err := s.scenes.SaveScene(existing.ID, data); err != nil {
+				writeSceneError(w, err)
+				return
+			}
+			log.Printf("Web: Saved the current state over scene %q", info.Name)
+			s.writeScene(w, existing.ID, http.StatusOK)
+			return
+		}
+	}
+
+	id, err := s.scenes.CreateSceneWithData(info, data)
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+
+	log.Printf("Web: Saved the current state as scene %q", info.Name)
+	s.writeScene(w, id, http.StatusCreated)
+}
+
+// handleScene returns (GET), changes the name, colour, description or tags of (PATCH) or deletes (DELETE) a scene
+func (s *Server) handleScene(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := sceneID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.writeScene(w, id, http.StatusOK)
+	case "PATCH":
+		var req sceneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		info, err := s.scenes.GetScene(id)
+		if err != nil {
+			writeSceneError(w, err)
+			return
+		}
+		if info == nil {
+			writeSceneError(w, storage.ErrSceneNotFound)
+			return
+		}
+		if err := req.applyTo(info); err != nil {
+			writeSceneError(w, err)
+			return
+		}
+		if err := s.scenes.UpdateScene(*info); err != nil {
+			writeSceneError(w, err)
+			return
+		}
+
+		log.Printf("Web: Updated scene %q", info.Name)
+		s.writeScene(w, id, http.StatusOK)
+	case "DELETE":
+		info, err := s.scenes.GetScene(id)
+		if err != nil {
+			writeSceneError(w, err)
+			return
+		}
+		if info == nil {
+			writeSceneError(w, storage.ErrSceneNotFound)
+			return
+		}
+		if err := s.scenes.DeleteScene(id); err != nil {
+			writeSceneError(w, err)
+			return
+		}
+
+		log.Printf("Web: Deleted scene %q", info.Name)
+		s.writeScenes(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSceneRecall crossfades to a scene, over the default transition unless the body gives one
+func (s *Server) handleSceneRecall(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := sceneID(w, r)
+	if !ok {
+		return
+	}
+
+	var req sceneRecallRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to read request body"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	transition := s.transitions.Default()
+	if req.Transition != nil {
+		if transition, err = req.Transition.Transition(); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	info, err := s.scenes.GetScene(id)
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+	if info == nil {
+		writeSceneError(w, storage.ErrSceneNotFound)
+		return
+	}
+	data, err := s.scenes.LoadScene(id)
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+	if data == nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, fmt.Sprintf("scene %q has nothing saved", info.Name)), http.StatusConflict)
+		return
+	}
+
+	if err := s.transitions.Recall(id, info.Name, data, transition); err != nil {
+		log.Printf("Error recalling scene %q: %v", info.Name, err)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Web: Recalled scene %q", info.Name)
+	s.writeScene(w, id, http.StatusOK)
+}
+
+// sceneID parses the scene ID from the request path, writing an error if it is invalid
+func sceneID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid scene ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// applyTo copies the fields given in a request onto a scene's details
+func (req *sceneRequest) applyTo(info *storage.SceneInfo) error {
+	if req.Name != nil {
+		info.Name = *req.Name
+	}
+	if req.Description != nil {
+		info.Description = *req.Description
+	}
+	if req.Tags != nil {
+		info.Tags = *req.Tags
+	}
+	if req.BgColor != nil {
+		info.BgColor = ""
+		if *req.BgColor != "" {
+			color, err := lights.ParseColor(*req.BgColor)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidScene, err)
+			}
+			info.BgColor = fmt.Sprintf("#%02X%02X%02X", color[0], color[1], color[2])
+		}
+	}
+	if info.Name == "" {
+		return storage.ErrSceneNameRequired
+	}
+	return nil
+}
+
+// writeScenes writes every scene in the library as JSON
+func (s *Server) writeScenes(w http.ResponseWriter) {
+	infos, err := s.scenes.ListScenes()
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+
+	scenes := make([]sceneResponse, 0, len(infos))
+	for _, info := range infos {
+		scene, err := s.sceneResponse(info)
+		if err != nil {
+			writeSceneError(w, err)
+			return
+		}
+		scenes = append(scenes, scene)
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"scenes": scenes}); err != nil {
+		log.Printf("Error encoding scenes: %v", err)
+	}
+}
+
+// writeScene writes a scene as JSON
+func (s *Server) writeScene(w http.ResponseWriter, id int, code int) {
+	info, err := s.scenes.GetScene(id)
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+	if info == nil {
+		writeSceneError(w, storage.ErrSceneNotFound)
+		return
+	}
+
+	scene, err := s.sceneResponse(*info)
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(scene); err != nil {
+		log.Printf("Error encoding scene: %v", err)
+	}
+}
+
+// sceneResponse loads a scene's light state and previews it
+func (s *Server) sceneResponse(info storage.SceneInfo) (sceneResponse, error) {
+	data, err := s.scenes.LoadScene(info.ID)
+	if err != nil {
+		return sceneResponse{}, err
+	}
+
+	return sceneResponse{
+		ID:          info.ID,
+		Name:        info.Name,
+		Description: info.Description,
+		BgColor:     info.BgColor,
+		Tags:        info.Tags,
+		CreatedAt:   info.CreatedAt,
+		UpdatedAt:   info.UpdatedAt,
+		Devices:     data,
+		Preview:     previewScene(data, s.ledBar.GetBarID()),
+	}, nil
+}
+
+// previewScene summarises the lights a scene sets, for swatches
+func previewScene(data *storage.SceneData, barID int) scenePreview {
+	var preview scenePreview
+	if data == nil {
+		return preview
+	}
+
+	if data.LEDStrip != nil {
+		preview.LEDStrip = fmt.Sprintf("#%02x%02x%02x", data.LEDStrip.Red, data.LEDStrip.Green, data.LEDStrip.Blue)
+	}
+
+	channels := make(map[int]int)
+	for _, led := range data.LEDBarLEDs {
+		if led.LEDBarID == barID {
+			channels[led.ChannelNum] = led.Value
+		}
+	}
+	preview.Section1 = previewSection(channels, 1)
+	preview.Section2 = previewSection(channels, 2)
+
+	for _, vl := range data.VideoLights {
+		state := &VideoLightState{On: vl.On, Brightness: vl.Brightness}
+		switch vl.ID {
+		case 0:
+			preview.VideoLight1 = state
+		case 1:
+			preview.VideoLight2 = state
+		}
+	}
+
+	return preview
+}
+
+// previewSection summarises an LED bar section from a scene's channel values, nil if it sets none of them
+func previewSection(channels map[int]int, section int) *sectionPreview {
+	preview := &sectionPreview{RGBW: make([]string, 0, 6)}
+	found := false
+
+	rgbw := ledbar.RGBWChannels(section)
+	for i := 0; i+3 < len(rgbw); i += 4 {
+		var values [4]int
+		set := false
+		for j := range values {
+			if v, ok := channels[rgbw[i+j]]; ok {
+				values[j] = v
+				set = true
+			}
+		}
+		if !set {
+			preview.RGBW = append(preview.RGBW, "")
+			continue
+		}
+		found = true
+		preview.RGBW = append(preview.RGBW, fmt.Sprintf("#%02x%02x%02x",
+			min(255, values[0]+values[3]), min(255, values[1]+values[3]), min(255, values[2]+values[3])))
+	}
+
+	total, count := 0, 0
+	for _, channel := range ledbar.WhiteChannels(section) {
+		if v, ok := channels[channel]; ok {
+			total += v
+			count++
+		}
+	}
+	if count > 0 {
+		found = true
+		average := total / count
+		preview.White = &average
+	}
+
+	if !found {
+		return nil
+	}
+	return preview
+}
+
+// writeSceneError maps a scene library error to an HTTP status
+func writeSceneError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrSceneNotFound), errors.Is(err, storage.ErrInvalidShortcut):
+		code = http.StatusNotFound
+	case errors.Is(err, storage.ErrSceneNameRequired), errors.Is(err, errInvalidScene):
+		code = http.StatusBadRequest
+	case errors.Is(err, storage.ErrSceneNameTaken):
+		code = http.StatusConflict
+	default:
+		log.Printf("Error saving scene: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
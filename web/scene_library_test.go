@@ -0,0 +1,248 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/storage"
+)
+
+// createScene saves the current state as a scene through the API, returning it
+func createScene(t *testing.T, s *Server, body string) sceneResponse {
+	t.Helper()
+	w := serve(s, "POST", "/api/scenes", body)
+	checkStatus(t, w, http.StatusCreated)
+	var scene sceneResponse
+	decode(t, w, &scene)
+	return scene
+}
+
+func TestSceneCreate(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(255, 128, 0)
+
+	scene := createScene(t, s, `{"name":"Evening","bgColor":"#ff8800","lights":["ledStrip"]}`)
+	if scene.Name != "Evening" || scene.BgColor != "#FF8800" {
+		t.Errorf("Unexpected scene %+v", scene)
+	}
+	if scene.Devices == nil || scene.Devices.LEDStrip == nil || len(scene.Devices.VideoLights) != 0 {
+		t.Fatalf("Expected only the strip saved, got %+v", scene.Devices)
+	}
+	if scene.Preview.LEDStrip != "#ff8000" {
+		t.Errorf("Expected the strip previewed as #ff8000, got %q", scene.Preview.LEDStrip)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"taken name", `{"name":"Evening"}`, http.StatusConflict},
+		{"no name", `{"bgColor":"#ff8800"}`, http.StatusBadRequest},
+		{"bad colour", `{"name":"Night","bgColor":"not a colour"}`, http.StatusBadRequest},
+		{"unknown light", `{"name":"Night","lights":["lamp"]}`, http.StatusBadRequest},
+		{"invalid JSON", `{"name":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkStatus(t, serve(s, "POST", "/api/scenes", tt.body), tt.want)
+		})
+	}
+
+	// None of the refused requests left a scene behind
+	w := serve(s, "GET", "/api/scenes", "")
+	checkStatus(t, w, http.StatusOK)
+	var list struct {
+		Scenes []sceneResponse `json:"scenes"`
+	}
+	decode(t, w, &list)
+	if len(list.Scenes) != 1 || list.Scenes[0].ID != scene.ID {
+		t.Errorf("Expected only Evening in the library, got %+v", list.Scenes)
+	}
+}
+
+func TestSceneCapture(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(10, 20, 30)
+	scene := createScene(t, s, `{"name":"Evening","bgColor":"#ff8800"}`)
+
+	// Capturing over a taken name replaces its lights and keeps its details
+	s.ledStrip.SetColor(40, 50, 60)
+	w := serve(s, "POST", "/api/scenes/capture", `{"name":"Evening","lights":["ledStrip"]}`)
+	checkStatus(t, w, http.StatusOK)
+	var captured sceneResponse
+	decode(t, w, &captured)
+	if captured.ID != scene.ID || captured.BgColor != "#FF8800" {
+		t.Errorf("Expected scene %d overwritten with its colour kept, got %+v", scene.ID, captured)
+	}
+	if captured.Devices == nil || captured.Devices.LEDStrip == nil || captured.Devices.LEDStrip.Red != 40 || len(captured.Devices.LEDBarLEDs) != 0 {
+		t.Errorf("Expected only the strip at 40,50,60, got %+v", captured.Devices)
+	}
+
+	// A new name creates a scene
+	w = serve(s, "POST", "/api/scenes/capture", `{"name":"Night"}`)
+	checkStatus(t, w, http.StatusCreated)
+	checkStatus(t, serve(s, "GET", "/api/scenes/capture", ""), http.StatusMethodNotAllowed)
+}
+
+func TestSceneGetUpdate(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	scene := createScene(t, s, `{"name":"Evening","bgColor":"#ff8800"}`)
+	createScene(t, s, `{"name":"Night"}`)
+	path := fmt.Sprintf("/api/scenes/%d", scene.ID)
+
+	checkStatus(t, serve(s, "GET", path, ""), http.StatusOK)
+	checkStatus(t, serve(s, "GET", "/api/scenes/999", ""), http.StatusNotFound)
+	checkStatus(t, serve(s, "GET", "/api/scenes/x", ""), http.StatusBadRequest)
+
+	// Renaming keeps the colour, and a bad colour or taken name changes nothing
+	w := serve(s, "PATCH", path, `{"name":"Dusk","tags":["home"]}`)
+	checkStatus(t, w, http.StatusOK)
+	var updated sceneResponse
+	decode(t, w, &updated)
+	if updated.Name != "Dusk" || updated.BgColor != "#FF8800" || len(updated.Tags) != 1 {
+		t.Errorf("Unexpected scene after renaming %+v", updated)
+	}
+	checkStatus(t, serve(s, "PATCH", path, `{"bgColor":"#12"}`), http.StatusBadRequest)
+	checkStatus(t, serve(s, "PATCH", path, `{"name":"Night"}`), http.StatusConflict)
+	checkStatus(t, serve(s, "PATCH", path, `{"name":""}`), http.StatusBadRequest)
+	checkStatus(t, serve(s, "PATCH", "/api/scenes/999", `{"name":"Gone"}`), http.StatusNotFound)
+
+	w = serve(s, "PATCH", path, `{"bgColor":"#0080ff"}`)
+	checkStatus(t, w, http.StatusOK)
+	decode(t, w, &updated)
+	if updated.Name != "Dusk" || updated.BgColor != "#0080FF" {
+		t.Errorf("Expected only the colour to change, got %+v", updated)
+	}
+
+	w = serve(s, "PATCH", path, `{"bgColor":""}`)
+	checkStatus(t, w, http.StatusOK)
+	var cleared sceneResponse
+	decode(t, w, &cleared)
+	if cleared.BgColor != "" {
+		t.Errorf("Expected the colour cleared, got %q", cleared.BgColor)
+	}
+}
+
+func TestSceneRecall(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	s.ledStrip.SetColor(10, 20, 30)
+	s.videoLight1.SetState(true, 60)
+	scene := createScene(t, s, `{"name":"Evening","lights":["ledStrip"]}`)
+
+	s.ledStrip.SetColor(0, 0, 0)
+	s.videoLight1.SetState(false, 0)
+	checkStatus(t, serve(s, "POST", fmt.Sprintf("/api/scenes/%d/recall", scene.ID), ""), http.StatusOK)
+	if r, g, b := s.ledStrip.GetColor(); r != 10 || g != 20 || b != 30 {
+		t.Errorf("Expected the strip back at 10,20,30, got %d,%d,%d", r, g, b)
+	}
+	if on, _ := s.videoLight1.GetState(); on {
+		t.Error("Expected the recall to leave video light 1 alone")
+	}
+
+	// A scene with nothing saved can't be recalled
+	empty, err := s.scenes.CreateScene(storage.SceneInfo{Name: "Empty"})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+	checkStatus(t, serve(s, "POST", fmt.Sprintf("/api/scenes/%d/recall", empty), ""), http.StatusConflict)
+	checkStatus(t, serve(s, "POST", "/api/scenes/999/recall", ""), http.StatusNotFound)
+	checkStatus(t, serve(s, "POST", fmt.Sprintf("/api/scenes/%d/recall", scene.ID), `{"transition":{"duration":-1}}`), http.StatusBadRequest)
+	checkStatus(t, serve(s, "GET", fmt.Sprintf("/api/scenes/%d/recall", scene.ID), ""), http.StatusMethodNotAllowed)
+}
+
+func TestSceneDelete(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	scene := createScene(t, s, `{"name":"Evening"}`)
+	createScene(t, s, `{"name":"Night"}`)
+	path := fmt.Sprintf("/api/scenes/%d", scene.ID)
+
+	w := serve(s, "DELETE", path, "")
+	checkStatus(t, w, http.StatusOK)
+	var list struct {
+		Scenes []sceneResponse `json:"scenes"`
+	}
+	decode(t, w, &list)
+	if len(list.Scenes) != 1 || list.Scenes[0].Name != "Night" {
+		t.Errorf("Expected only Night left, got %+v", list.Scenes)
+	}
+	checkStatus(t, serve(s, "DELETE", path, ""), http.StatusNotFound)
+}
+
+func TestPreviewScene(t *testing.T) {
+	rgbw := ledbar.RGBWChannels(1)
+	white := ledbar.WhiteChannels(1)
+	data := &storage.SceneData{
+		LEDStrip: &storage.LEDStripState{Red: 255, Green: 128, Blue: 0},
+		LEDBarLEDs: []storage.LEDBarLEDState{
+			{LEDBarID: 0, ChannelNum: rgbw[0], Value: 100},
+			{LEDBarID: 0, ChannelNum: rgbw[3], Value: 200},
+			{LEDBarID: 0, ChannelNum: rgbw[5], Value: 16},
+			{LEDBarID: 0, ChannelNum: white[0], Value: 100},
+			{LEDBarID: 0, ChannelNum: white[1], Value: 50},
+			// Another bar's channels aren't this one's
+			{LEDBarID: 1, ChannelNum: ledbar.RGBWChannels(2)[0], Value: 255},
+		},
+		VideoLights: []storage.VideoLightState{{ID: 0, On: true, Brightness: 40}},
+	}
+
+	preview := previewScene(data, 0)
+	if preview.LEDStrip != "#ff8000" {
+		t.Errorf("Expected strip #ff8000, got %q", preview.LEDStrip)
+	}
+
+	section := preview.Section1
+	if section == nil || len(section.RGBW) != len(rgbw)/4 {
+		t.Fatalf("Expected a swatch for each RGBW LED of section 1, got %+v", section)
+	}
+	// White mixes into each colour, up to 255
+	if section.RGBW[0] != "#ffc8c8" {
+		t.Errorf("Expected RGBW LED 0 as #ffc8c8, got %q", section.RGBW[0])
+	}
+	if section.RGBW[1] != "#001000" {
+		t.Errorf("Expected RGBW LED 1 as #001000, got %q", section.RGBW[1])
+	}
+	for i, color := range section.RGBW[2:] {
+		if color != "" {
+			t.Errorf("Expected RGBW LED %d left out, got %q", i+2, color)
+		}
+	}
+	if section.White == nil || *section.White != 75 {
+		t.Errorf("Expected the white LEDs to average 75, got %v", section.White)
+	}
+
+	if preview.Section2 != nil {
+		t.Errorf("Expected section 2 left out, got %+v", preview.Section2)
+	}
+	if preview.VideoLight1 == nil || *preview.VideoLight1 != (VideoLightState{On: true, Brightness: 40}) {
+		t.Errorf("Expected video light 1 on at 40, got %+v", preview.VideoLight1)
+	}
+	if preview.VideoLight2 != nil {
+		t.Errorf("Expected video light 2 left out, got %+v", preview.VideoLight2)
+	}
+
+	if empty := previewScene(nil, 0); empty != (scenePreview{}) {
+		t.Errorf("Expected an empty preview for a scene with nothing saved, got %+v", empty)
+	}
+}
+
+func TestSceneImportRejectsBadScenes(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+
+	for _, scene := range []string{`{"name":"  "}`, `{"name":"Evening","bgColor":"orange"}`} {
+		w := serve(s, "POST", "/api/scenes/import", `{"version":1,"scenes":[`+scene+`]}`)
+		checkStatus(t, w, http.StatusBadRequest)
+	}
+
+	w := serve(s, "POST", "/api/scenes/import", `{"version":1,"scenes":[{"name":" Evening ","bgColor":"#ff8800"}]}`)
+	checkStatus(t, w, http.StatusOK)
+	info, err := s.scenes.FindSceneByName("Evening")
+	if err != nil {
+		t.Fatalf("Imported scene not found: %v", err)
+	}
+	if info.BgColor != "#FF8800" {
+		t.Errorf("Expected the colour normalized, got %q", info.BgColor)
+	}
+}
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// handleSceneExport returns one scene (?id= or ?name=) or all scenes as a portable JSON document
+func (s *Server) handleSceneExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ids []int
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid scene id"}`, http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if name := r.URL.Query().Get("name"); name != "" {
+		info, err := s.scenes.FindSceneByName(name)
+		if err != nil {
+			log.Printf("Error finding scene: %v", err)
+			http.Error(w, `{"error":"Failed to find scene"}`, http.StatusInternalServerError)
+			return
+		}
+		if info == nil {
+			http.Error(w, `{"error":"Scene not found"}`, http.StatusNotFound)
+			return
+		}
+		ids = append(ids, info.ID)
+	}
+
+	doc, err := storage.ExportScenes(s.scenes, ids...)
+	if errors.Is(err, storage.ErrSceneNotFound) {
+		http.Error(w, `{"error":"Scene not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrSceneNameRequired) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error exporting scenes: %v", err)
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to export scenes: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="scenes.json"`)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		log.Printf("Error encoding scenes: %v", err)
+	}
+}
+
+// handleSceneImport imports a scene document; ?conflict= selects skip, replace, rename or fail
+func (s *Server) handleSceneImport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	policy, err := storage.ParseConflictPolicy(r.URL.Query().Get("conflict"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		http.Error(w, `{"error":"Failed to read request body"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	doc, err := storage.ParseSceneDocument(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.scenes.ImportScenes(doc, policy)
+	if errors.Is(err, storage.ErrSceneNameTaken) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, storage.ErrSceneNameRequired) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error importing scenes: %v", err)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"results": results}); err != nil {
+		log.Printf("Error encoding import results: %v", err)
+	}
+
+	log.Printf("Web: Imported %d scenes", len(results))
+}
+
+// handleSceneCapture saves the current state of the selected lights into the
+// scene with the given name, creating it or overwriting its lights
+// It takes and returns the same as POST /api/scenes.
+func (s *Server) handleSceneCapture(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.saveCurrentScene(w, r, true)
+}
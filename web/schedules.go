@@ -0,0 +1,238 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// scheduleResponse is a stored schedule with its next run time
+type scheduleResponse struct {
+	storage.Schedule
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// handleSchedules lists the schedules (GET) or creates one (POST)
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeSchedules(w)
+	case "POST":
+		sched, ok := s.decodeSchedule(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := s.scheduleStore.CreateSchedule(*sched)
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+
+		log.Printf("Web: Created schedule %q", sched.Name)
+		s.reloadSchedules()
+		s.writeSchedule(w, id, http.StatusCreated)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSchedule returns (GET), replaces (PUT) or deletes (DELETE) a schedule
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.writeSchedule(w, id, http.StatusOK)
+	case "PUT":
+		sched, ok := s.decodeSchedule(w, r)
+		if !ok {
+			return
+		}
+		sched.ID = id
+
+		if err := s.scheduleStore.UpdateSchedule(*sched); err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+
+		log.Printf("Web: Updated schedule %q", sched.Name)
+		s.reloadSchedules()
+		s.writeSchedule(w, id, http.StatusOK)
+	case "DELETE":
+		if err := s.scheduleStore.DeleteSchedule(id); err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+
+		log.Printf("Web: Deleted schedule %d", id)
+		s.reloadSchedules()
+		s.writeSchedules(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScheduleRun runs a schedule's action now
+func (s *Server) handleScheduleRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.scheduler.RunNow(id); err != nil {
+		if errors.Is(err, storage.ErrScheduleNotFound) {
+			writeScheduleError(w, err)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Web: Ran schedule %d", id)
+	s.writeSchedule(w, id, http.StatusOK)
+}
+
+// handleScheduleUpcoming lists the next run of every enabled schedule, soonest first
+func (s *Server) handleScheduleUpcoming(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(s.scheduler.Upcoming()); err != nil {
+		log.Printf("Error encoding upcoming schedules: %v", err)
+	}
+}
+
+// handleNextEvents lists upcoming schedule runs and sun events, soonest first
+func (s *Server) handleNextEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"events": s.scheduler.NextEvents()}); err != nil {
+		log.Printf("Error encoding next events: %v", err)
+	}
+}
+
+// scheduleID parses the schedule ID from the request path, writing an error if it is invalid
+func scheduleID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid schedule ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeSchedule reads a schedule from the request body and checks its trigger and action
+// Schedules are enabled unless the body says otherwise.
+func (s *Server) decodeSchedule(w http.ResponseWriter, r *http.Request) (*storage.Schedule, bool) {
+	sched := storage.Schedule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	if err := s.scheduler.Validate(sched); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+	return &sched, true
+}
+
+// reloadSchedules tells the scheduler the stored schedules have changed
+func (s *Server) reloadSchedules() {
+	if err := s.scheduler.Reload(); err != nil {
+		log.Printf("Error reloading schedules: %v", err)
+	}
+}
+
+// writeScheduleError maps a schedule store error to an HTTP status
+func writeScheduleError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrScheduleNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, storage.ErrScheduleNameRequired):
+		code = http.StatusBadRequest
+	case errors.Is(err, storage.ErrScheduleNameTaken):
+		code = http.StatusConflict
+	default:
+		log.Printf("Error saving schedule: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
+
+// withNext adds a schedule's next run time
+func (s *Server) withNext(sched storage.Schedule) scheduleResponse {
+	response := scheduleResponse{Schedule: sched}
+	if next, ok := s.scheduler.NextRun(sched.ID); ok {
+		response.Next = &next
+	}
+	return response
+}
+
+// writeSchedule writes a single schedule as JSON
+func (s *Server) writeSchedule(w http.ResponseWriter, id int, code int) {
+	sched, err := s.scheduleStore.GetSchedule(id)
+	if err != nil {
+		log.Printf("Error loading schedule: %v", err)
+		http.Error(w, `{"error":"Failed to load schedule"}`, http.StatusInternalServerError)
+		return
+	}
+	if sched == nil {
+		http.Error(w, `{"error":"Schedule not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(s.withNext(*sched)); err != nil {
+		log.Printf("Error encoding schedule: %v", err)
+	}
+}
+
+// writeSchedules writes every schedule as JSON
+func (s *Server) writeSchedules(w http.ResponseWriter) {
+	list, err := s.scheduleStore.ListSchedules()
+	if err != nil {
+		log.Printf("Error listing schedules: %v", err)
+		http.Error(w, `{"error":"Failed to list schedules"}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]scheduleResponse, len(list))
+	for i, sched := range list {
+		response[i] = s.withNext(sched)
+	}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"schedules": response}); err != nil {
+		log.Printf("Error encoding schedules: %v", err)
+	}
+}
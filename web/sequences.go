@@ -0,0 +1,349 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/storage"
+)
+
+// sequenceKeyframeRequest captures the current state of the selected lights as a new keyframe
+type sequenceKeyframeRequest struct {
+	Lights []string `json:"lights"` // empty means every light
+	Fade   int      `json:"fade"`   // milliseconds
+	Hold   int      `json:"hold"`   // milliseconds
+	Easing string   `json:"easing"`
+}
+
+// sequencePlayRequest optionally overrides whether the sequence loops
+type sequencePlayRequest struct {
+	Loop *bool `json:"loop"`
+}
+
+// handleSequences lists the sequences (GET) or creates one (POST)
+func (s *Server) handleSequences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeSequences(w)
+	case "POST":
+		seq, ok := decodeSequence(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := s.sequenceStore.CreateSequence(*seq)
+		if err != nil {
+			writeSequenceError(w, err)
+			return
+		}
+
+		log.Printf("Web: Created sequence %q", seq.Name)
+		s.writeSequence(w, id, http.StatusCreated)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSequence returns (GET), replaces (PUT) or deletes (DELETE) a sequence
+func (s *Server) handleSequence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := sequenceID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.writeSequence(w, id, http.StatusOK)
+	case "PUT":
+		seq, ok := decodeSequence(w, r)
+		if !ok {
+			return
+		}
+		seq.ID = id
+
+		if err := s.sequenceStore.UpdateSequence(*seq); err != nil {
+			writeSequenceError(w, err)
+			return
+		}
+
+		log.Printf("Web: Updated sequence %q", seq.Name)
+		s.writeSequence(w, id, http.StatusOK)
+	case "DELETE":
+		if status := s.player.Status(); status.SequenceID == id {
+			s.player.Stop()
+		}
+		if err := s.sequenceStore.DeleteSequence(id); err != nil {
+			writeSequenceError(w, err)
+			return
+		}
+
+		log.Printf("Web: Deleted sequence %d", id)
+		s.writeSequences(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSequenceKeyframe appends the current state of the selected lights to a sequence
+func (s *Server) handleSequenceKeyframe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := sequenceID(w, r)
+	if !ok {
+		return
+	}
+
+	var req sequenceKeyframeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	sel := lights.SelectAll()
+	if len(req.Lights) > 0 {
+		var err error
+		sel, err = lights.ParseSelection(req.Lights)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	seq, err := s.sequenceStore.GetSequence(id)
+	if err != nil {
+		log.Printf("Error loading sequence: %v", err)
+		http.Error(w, `{"error":"Failed to load sequence"}`, http.StatusInternalServerError)
+		return
+	}
+	if seq == nil {
+		http.Error(w, `{"error":"Sequence not found"}`, http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	data := s.transitions.Rig().Capture(sel)
+	s.mu.Unlock()
+
+	seq.Keyframes = append(seq.Keyframes, storage.Keyframe{
+		Devices: data,
+		Fade:    req.Fade,
+		Hold:    req.Hold,
+		Easing:  req.Easing,
+	})
+	if err := sequences.Validate(seq); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := s.sequenceStore.UpdateSequence(*seq); err != nil {
+		writeSequenceError(w, err)
+		return
+	}
+
+	log.Printf("Web: Added keyframe %d to sequence %q", len(seq.Keyframes), seq.Name)
+	s.writeSequence(w, id, http.StatusOK)
+}
+
+// handleSequencePlay starts playing a sequence from the beginning
+func (s *Server) handleSequencePlay(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := sequenceID(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var req sequencePlayRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	seq, err := s.sequenceStore.GetSequence(id)
+	if err != nil {
+		log.Printf("Error loading sequence: %v", err)
+		http.Error(w, `{"error":"Failed to load sequence"}`, http.StatusInternalServerError)
+		return
+	}
+	if seq == nil {
+		http.Error(w, `{"error":"Sequence not found"}`, http.StatusNotFound)
+		return
+	}
+
+	loop := seq.Loop
+	if req.Loop != nil {
+		loop = *req.Loop
+	}
+	if err := s.player.Play(seq, loop); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Web: Playing sequence %q", seq.Name)
+	s.writeSequenceStatus(w)
+}
+
+// handleSequenceControl pauses, resumes or stops the playing sequence
+func (s *Server) handleSequenceControl(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	action := path.Base(r.URL.Path)
+	switch action {
+	case "pause":
+		err = s.player.Pause()
+	case "resume":
+		err = s.player.Resume()
+	case "toggle":
+		err = s.player.TogglePause()
+	case "stop":
+		s.player.Stop()
+	}
+	if errors.Is(err, sequences.ErrNotPlaying) {
+		http.Error(w, `{"error":"No sequence is playing"}`, http.StatusConflict)
+		return
+	}
+
+	log.Printf("Web: Sequence %s", action)
+	s.writeSequenceStatus(w)
+}
+
+// handleSequenceStatus reports playback progress
+func (s *Server) handleSequenceStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeSequenceStatus(w)
+}
+
+// sequenceID parses the sequence ID from the request path, writing an error if it is invalid
+func sequenceID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid sequence ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeSequence reads a sequence from the request body, checking any keyframes it has
+// A sequence may be created without keyframes and filled in with captures.
+func decodeSequence(w http.ResponseWriter, r *http.Request) (*storage.Sequence, bool) {
+	var seq storage.Sequence
+	if err := json.NewDecoder(r.Body).Decode(&seq); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	if len(seq.Keyframes) > 0 {
+		if err := sequences.Validate(&seq); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return &seq, true
+}
+
+// writeSequenceError maps a sequence store error to an HTTP status
+func writeSequenceError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrSequenceNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, storage.ErrSequenceNameRequired):
+		code = http.StatusBadRequest
+	case errors.Is(err, storage.ErrSequenceNameTaken):
+		code = http.StatusConflict
+	default:
+		log.Printf("Error saving sequence: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
+
+// writeSequence writes a single sequence as JSON
+func (s *Server) writeSequence(w http.ResponseWriter, id int, code int) {
+	seq, err := s.sequenceStore.GetSequence(id)
+	if err != nil {
+		log.Printf("Error loading sequence: %v", err)
+		http.Error(w, `{"error":"Failed to load sequence"}`, http.StatusInternalServerError)
+		return
+	}
+	if seq == nil {
+		http.Error(w, `{"error":"Sequence not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(seq); err != nil {
+		log.Printf("Error encoding sequence: %v", err)
+	}
+}
+
+// writeSequences writes every sequence and the playback status as JSON
+func (s *Server) writeSequences(w http.ResponseWriter) {
+	response, err := s.sequencesResponse()
+	if err != nil {
+		log.Printf("Error listing sequences: %v", err)
+		http.Error(w, `{"error":"Failed to list sequences"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding sequences: %v", err)
+	}
+}
+
+// sequencesResponse is every sequence and the playback status, as served by GET /api/sequences
+func (s *Server) sequencesResponse() (map[string]interface{}, error) {
+	list, err := s.sequenceStore.ListSequences()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"sequences": list,
+		"status":    s.player.Status(),
+	}, nil
+}
+
+// writeSequenceStatus writes the playback status as JSON
+func (s *Server) writeSequenceStatus(w http.ResponseWriter) {
+	if err := json.NewEncoder(w).Encode(s.player.Status()); err != nil {
+		log.Printf("Error encoding sequence status: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/kevin/office_lights/storage"
+)
+
+// shortcutResponse is a Stream Deck scene shortcut button and the scene it recalls
+type shortcutResponse struct {
+	Button  int    `json:"button"`         // 1 to storage.SceneShortcutSlots, left to right
+	SceneID *int   `json:"sceneId"`        // nil if unassigned
+	Name    string `json:"name,omitempty"` // the scene's name
+}
+
+// shortcutRequest assigns a scene to a shortcut button; a null sceneId unassigns it
+type shortcutRequest struct {
+	SceneID *int `json:"sceneId"`
+}
+
+// handleShortcuts lists the Stream Deck scene shortcut buttons (GET)
+func (s *Server) handleShortcuts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeShortcuts(w)
+}
+
+// handleShortcut assigns a library scene to (PUT) or unassigns (DELETE) a Stream Deck shortcut button
+func (s *Server) handleShortcut(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	button, err := strconv.Atoi(r.PathValue("button"))
+	if err != nil || button < 1 || button > storage.SceneShortcutSlots {
+		writeSceneError(w, storage.ErrInvalidShortcut)
+		return
+	}
+
+	var req shortcutRequest
+	switch r.Method {
+	case "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	case "DELETE":
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if req.SceneID == nil {
+		err = s.scenes.ClearSceneShortcut(button - 1)
+	} else {
+		err = s.scenes.SetSceneShortcut(button-1, *req.SceneID)
+	}
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+
+	if req.SceneID == nil {
+		log.Printf("Web: Unassigned shortcut button %d", button)
+	} else {
+		log.Printf("Web: Assigned scene %d to shortcut button %d", *req.SceneID, button)
+	}
+	s.writeShortcuts(w)
+}
+
+// writeShortcuts writes every shortcut button and its scene as JSON
+func (s *Server) writeShortcuts(w http.ResponseWriter) {
+	shortcuts := make([]shortcutResponse, 0, storage.SceneShortcutSlots)
+	for slot := 0; slot < storage.SceneShortcutSlots; slot++ {
+		shortcut := shortcutResponse{Button: slot + 1}
+		id, ok, err := s.scenes.GetSceneShortcut(slot)
+		if err != nil {
+			writeSceneError(w, err)
+			return
+		}
+		if ok {
+			name, err := s.scenes.GetSceneName(id)
+			if err != nil {
+				writeSceneError(w, err)
+				return
+			}
+			shortcut.SceneID = &id
+			shortcut.Name = name
+		}
+		shortcuts = append(shortcuts, shortcut)
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"shortcuts": shortcuts}); err != nil {
+		log.Printf("Error encoding shortcuts: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// shortcutList is the body of a shortcuts response
+type shortcutList struct {
+	Shortcuts []shortcutResponse `json:"shortcuts"`
+}
+
+func TestShortcuts(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	scene := createScene(t, s, `{"name":"Evening"}`)
+
+	w := serve(s, "GET", "/api/shortcuts", "")
+	checkStatus(t, w, http.StatusOK)
+	var list shortcutList
+	decode(t, w, &list)
+	if len(list.Shortcuts) != 4 {
+		t.Fatalf("Expected 4 shortcut buttons, got %+v", list.Shortcuts)
+	}
+	for i, shortcut := range list.Shortcuts {
+		if shortcut.Button != i+1 || shortcut.SceneID != nil {
+			t.Errorf("Expected button %d unassigned, got %+v", i+1, shortcut)
+		}
+	}
+
+	w = serve(s, "PUT", "/api/shortcuts/3", fmt.Sprintf(`{"sceneId":%d}`, scene.ID))
+	checkStatus(t, w, http.StatusOK)
+	list = shortcutList{}
+	decode(t, w, &list)
+	if got := list.Shortcuts[2]; got.SceneID == nil || *got.SceneID != scene.ID || got.Name != "Evening" {
+		t.Errorf("Expected button 3 assigned to Evening, got %+v", got)
+	}
+	if id, ok, _ := s.scenes.GetSceneShortcut(2); !ok || id != scene.ID {
+		t.Errorf("Expected shortcut slot 2 saved as scene %d, got %d, %v", scene.ID, id, ok)
+	}
+
+	// A null scene unassigns the button, as does DELETE
+	checkStatus(t, serve(s, "PUT", "/api/shortcuts/3", `{"sceneId":null}`), http.StatusOK)
+	if _, ok, _ := s.scenes.GetSceneShortcut(2); ok {
+		t.Error("Expected button 3 unassigned")
+	}
+	checkStatus(t, serve(s, "PUT", "/api/shortcuts/1", fmt.Sprintf(`{"sceneId":%d}`, scene.ID)), http.StatusOK)
+	checkStatus(t, serve(s, "DELETE", "/api/shortcuts/1", ""), http.StatusOK)
+	if _, ok, _ := s.scenes.GetSceneShortcut(0); ok {
+		t.Error("Expected button 1 unassigned")
+	}
+
+	checkStatus(t, serve(s, "PUT", "/api/shortcuts/1", `{"sceneId":999}`), http.StatusNotFound)
+	checkStatus(t, serve(s, "PUT", "/api/shortcuts/0", fmt.Sprintf(`{"sceneId":%d}`, scene.ID)), http.StatusNotFound)
+	checkStatus(t, serve(s, "PUT", "/api/shortcuts/5", fmt.Sprintf(`{"sceneId":%d}`, scene.ID)), http.StatusNotFound)
+	checkStatus(t, serve(s, "PUT", "/api/shortcuts/1", `{"sceneId":`), http.StatusBadRequest)
+	checkStatus(t, serve(s, "POST", "/api/shortcuts/1", ""), http.StatusMethodNotAllowed)
+	checkStatus(t, serve(s, "POST", "/api/shortcuts", ""), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kevin/office_lights/sleeptimer"
+)
+
+// sleepRequest sets a sleep timer
+type sleepRequest struct {
+	Target   string `json:"target"`   // "all" (the default) or a light name
+	Duration int    `json:"duration"` // milliseconds until the lights are off
+	Fade     int    `json:"fade"`     // milliseconds of fading before then
+}
+
+// handleSleep lists the sleep timers (GET) or sets one (POST)
+func (s *Server) handleSleep(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeSleepTimers(w)
+	case "POST":
+		var req sleepRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		if req.Target == "" {
+			req.Target = sleeptimer.TargetAll
+		}
+		d := time.Duration(req.Duration) * time.Millisecond
+		fade := time.Duration(req.Fade) * time.Millisecond
+		if _, err := s.sleepTimers.Set(req.Target, d, fade); err != nil {
+			writeSleepError(w, err)
+			return
+		}
+
+		log.Printf("Web: Set sleep timer for %s (%s)", req.Target, d)
+		s.writeSleepTimers(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSleepTarget returns (GET) or cancels (DELETE) the sleep timer for a target
+func (s *Server) handleSleepTarget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	target := r.PathValue("target")
+	switch r.Method {
+	case "GET":
+		status, ok := s.sleepTimers.Get(target)
+		if !ok {
+			http.Error(w, `{"error":"No sleep timer set"}`, http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("Error encoding sleep timer: %v", err)
+		}
+	case "DELETE":
+		if err := s.sleepTimers.Cancel(target); err != nil {
+			writeSleepError(w, err)
+			return
+		}
+
+		log.Printf("Web: Cancelled sleep timer for %s", target)
+		s.writeSleepTimers(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// writeSleepError maps a sleep timer error to an HTTP status
+func writeSleepError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, sleeptimer.ErrNoTimer):
+		code = http.StatusNotFound
+	case errors.Is(err, sleeptimer.ErrUnknownTarget), errors.Is(err, sleeptimer.ErrInvalidTimer):
+		code = http.StatusBadRequest
+	default:
+		log.Printf("Error saving sleep timer: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
+
+// writeSleepTimers writes the pending sleep timers and the targets they accept as JSON
+func (s *Server) writeSleepTimers(w http.ResponseWriter) {
+	if err := json.NewEncoder(w).Encode(s.sleepResponse()); err != nil {
+		log.Printf("Error encoding sleep timers: %v", err)
+	}
+}
+
+// sleepResponse is the pending sleep timers and their targets, as served by GET /api/sleep
+func (s *Server) sleepResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"timers":  s.sleepTimers.List(),
+		"targets": sleeptimer.Targets,
+	}
+}
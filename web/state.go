@@ -6,40 +6,18 @@ import (
 	"github.com/kevin/office_lights/drivers/ledbar"
 	"github.com/kevin/office_lights/drivers/ledstrip"
 	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/storage"
 )
 
-// RGBW represents a single RGBW LED
-type RGBW struct {
-	R int `json:"r"`
-	G int `json:"g"`
-	B int `json:"b"`
-	W int `json:"w"`
-}
-
-// LEDBarSection represents one section of the LED bar
-type LEDBarSection struct {
-	RGBW  []RGBW `json:"rgbw"`
-	White []int  `json:"white"`
-}
-
-// LEDBarState represents the complete LED bar state
-type LEDBarState struct {
-	Section1 LEDBarSection `json:"section1"`
-	Section2 LEDBarSection `json:"section2"`
-}
-
-// LEDStripState represents the LED strip state
-type LEDStripState struct {
-	R int `json:"r"`
-	G int `json:"g"`
-	B int `json:"b"`
-}
-
-// VideoLightState represents a video light state
-type VideoLightState struct {
-	On         bool `json:"on"`
-	Brightness int  `json:"brightness"`
-}
+// The light states are shared with webhooks, which show lights the same way
+type (
+	RGBW            = lights.RGBW
+	LEDBarSection   = lights.LEDBarSection
+	LEDBarState     = lights.LEDBarState
+	LEDStripState   = lights.LEDStripState
+	VideoLightState = lights.VideoLightState
+)
 
 // State represents the complete system state
 type State struct {
@@ -47,6 +25,9 @@ type State struct {
 	LEDBar      LEDBarState     `json:"ledBar"`
 	VideoLight1 VideoLightState `json:"videoLight1"`
 	VideoLight2 VideoLightState `json:"videoLight2"`
+
+	// Transition optionally crossfades to the new state (POST only)
+	Transition *lights.TransitionSpec `json:"transition,omitempty"`
 }
 
 // BuildState reads current state from all drivers
@@ -56,62 +37,17 @@ func BuildState(
 	vl1 *videolight.VideoLight,
 	vl2 *videolight.VideoLight,
 ) (*State, error) {
-	state := &State{}
-
-	// LED Strip
-	r, g, b := strip.GetColor()
-	state.LEDStrip = LEDStripState{R: r, G: g, B: b}
-
-	// LED Bar - initialize slices
-	state.LEDBar.Section1.RGBW = make([]RGBW, 6)
-	state.LEDBar.Section1.White = make([]int, 13)
-	state.LEDBar.Section2.RGBW = make([]RGBW, 6)
-	state.LEDBar.Section2.White = make([]int, 13)
-
-	// Section 1 RGBW
-	for i := 0; i < 6; i++ {
-		r, g, b, w, err := bar.GetRGBW(1, i)
-		if err != nil {
-			return nil, err
-		}
-		state.LEDBar.Section1.RGBW[i] = RGBW{R: r, G: g, B: b, W: w}
+	devices, err := lights.NewRig(strip, bar, vl1, vl2).ReadStates()
+	if err != nil {
+		return nil, err
 	}
 
-	// Section 1 White
-	for i := 0; i < 13; i++ {
-		val, err := bar.GetWhite(1, i)
-		if err != nil {
-			return nil, err
-		}
-		state.LEDBar.Section1.White[i] = val
-	}
-
-	// Section 2 RGBW
-	for i := 0; i < 6; i++ {
-		r, g, b, w, err := bar.GetRGBW(2, i)
-		if err != nil {
-			return nil, err
-		}
-		state.LEDBar.Section2.RGBW[i] = RGBW{R: r, G: g, B: b, W: w}
-	}
-
-	// Section 2 White
-	for i := 0; i < 13; i++ {
-		val, err := bar.GetWhite(2, i)
-		if err != nil {
-			return nil, err
-		}
-		state.LEDBar.Section2.White[i] = val
-	}
-
-	// Video Lights
-	on1, brightness1 := vl1.GetState()
-	state.VideoLight1 = VideoLightState{On: on1, Brightness: brightness1}
-
-	on2, brightness2 := vl2.GetState()
-	state.VideoLight2 = VideoLightState{On: on2, Brightness: brightness2}
-
-	return state, nil
+	return &State{
+		LEDStrip:    devices.LEDStrip,
+		LEDBar:      devices.LEDBar,
+		VideoLight1: devices.VideoLight1,
+		VideoLight2: devices.VideoLight2,
+	}, nil
 }
 
 // ApplyState applies state to all drivers
@@ -127,32 +63,12 @@ func ApplyState(
 		return fmt.Errorf("LED strip: %w", err)
 	}
 
-	// LED Bar Section 1 RGBW (use NoPublish to avoid multiple MQTT messages)
-	for i, rgbw := range state.LEDBar.Section1.RGBW {
-		if err := bar.SetRGBWNoPublish(1, i, rgbw.R, rgbw.G, rgbw.B, rgbw.W); err != nil {
-			return fmt.Errorf("LED bar section1 RGBW[%d]: %w", i, err)
-		}
-	}
-
-	// LED Bar Section 1 White
-	for i, val := range state.LEDBar.Section1.White {
-		if err := bar.SetWhiteNoPublish(1, i, val); err != nil {
-			return fmt.Errorf("LED bar section1 white[%d]: %w", i, err)
-		}
-	}
-
-	// LED Bar Section 2 RGBW
-	for i, rgbw := range state.LEDBar.Section2.RGBW {
-		if err := bar.SetRGBWNoPublish(2, i, rgbw.R, rgbw.G, rgbw.B, rgbw.W); err != nil {
-			return fmt.Errorf("LED bar section2 RGBW[%d]: %w", i, err)
-		}
+	// LED Bar (set without publishing to avoid multiple MQTT messages)
+	if err := applyBarSection(bar, 1, state.LEDBar.Section1); err != nil {
+		return err
 	}
-
-	// LED Bar Section 2 White
-	for i, val := range state.LEDBar.Section2.White {
-		if err := bar.SetWhiteNoPublish(2, i, val); err != nil {
-			return fmt.Errorf("LED bar section2 white[%d]: %w", i, err)
-		}
+	if err := applyBarSection(bar, 2, state.LEDBar.Section2); err != nil {
+		return err
 	}
 
 	// Publish LED bar state once after all changes
@@ -185,6 +101,57 @@ func ApplyState(
 	return nil
 }
 
+// applyBarSection sets the LEDs of one LED bar section without publishing
+func applyBarSection(bar *ledbar.LEDBar, section int, state LEDBarSection) error {
+	for i, rgbw := range state.RGBW {
+		if err := bar.SetRGBWNoPublish(section, i, rgbw.R, rgbw.G, rgbw.B, rgbw.W); err != nil {
+			return fmt.Errorf("LED bar section%d RGBW[%d]: %w", section, i, err)
+		}
+	}
+	for i, val := range state.White {
+		if err := bar.SetWhiteNoPublish(section, i, val); err != nil {
+			return fmt.Errorf("LED bar section%d white[%d]: %w", section, i, err)
+		}
+	}
+	return nil
+}
+
+// SceneData converts the state to scene data covering every light
+func (s *State) SceneData(barID int) *storage.SceneData {
+	data := &storage.SceneData{
+		LEDStrip: &storage.LEDStripState{Red: s.LEDStrip.R, Green: s.LEDStrip.G, Blue: s.LEDStrip.B},
+		VideoLights: []storage.VideoLightState{
+			{ID: 0, On: s.VideoLight1.On, Brightness: s.VideoLight1.Brightness},
+			{ID: 1, On: s.VideoLight2.On, Brightness: s.VideoLight2.Brightness},
+		},
+	}
+
+	addBarSection := func(section int, bar LEDBarSection) {
+		rgbwChannels := ledbar.RGBWChannels(section)
+		for i, rgbw := range bar.RGBW {
+			for j, value := range []int{rgbw.R, rgbw.G, rgbw.B, rgbw.W} {
+				data.LEDBarLEDs = append(data.LEDBarLEDs, storage.LEDBarLEDState{
+					LEDBarID:   barID,
+					ChannelNum: rgbwChannels[i*4+j],
+					Value:      value,
+				})
+			}
+		}
+		whiteChannels := ledbar.WhiteChannels(section)
+		for i, value := range bar.White {
+			data.LEDBarLEDs = append(data.LEDBarLEDs, storage.LEDBarLEDState{
+				LEDBarID:   barID,
+				ChannelNum: whiteChannels[i],
+				Value:      value,
+			})
+		}
+	}
+	addBarSection(1, s.LEDBar.Section1)
+	addBarSection(2, s.LEDBar.Section2)
+
+	return data
+}
+
 // Validate checks if state values are within valid ranges
 func (s *State) Validate() error {
 	// LED Strip
@@ -198,62 +165,66 @@ func (s *State) Validate() error {
 		return fmt.Errorf("LED strip B value out of range: %d", s.LEDStrip.B)
 	}
 
-	// LED Bar - validate RGBW values
-	validateRGBW := func(section string, rgbwList []RGBW) error {
-		if len(rgbwList) != 6 {
-			return fmt.Errorf("LED bar %s RGBW must have 6 elements, got %d", section, len(rgbwList))
-		}
-		for i, rgbw := range rgbwList {
-			if rgbw.R < 0 || rgbw.R > 255 {
-				return fmt.Errorf("LED bar %s RGBW[%d] R out of range: %d", section, i, rgbw.R)
-			}
-			if rgbw.G < 0 || rgbw.G > 255 {
-				return fmt.Errorf("LED bar %s RGBW[%d] G out of range: %d", section, i, rgbw.G)
-			}
-			if rgbw.B < 0 || rgbw.B > 255 {
-				return fmt.Errorf("LED bar %s RGBW[%d] B out of range: %d", section, i, rgbw.B)
-			}
-			if rgbw.W < 0 || rgbw.W > 255 {
-				return fmt.Errorf("LED bar %s RGBW[%d] W out of range: %d", section, i, rgbw.W)
-			}
-		}
-		return nil
-	}
-
-	if err := validateRGBW("section1", s.LEDBar.Section1.RGBW); err != nil {
+	// LED Bar
+	if err := validateBarSection("section1", s.LEDBar.Section1); err != nil {
 		return err
 	}
-	if err := validateRGBW("section2", s.LEDBar.Section2.RGBW); err != nil {
+	if err := validateBarSection("section2", s.LEDBar.Section2); err != nil {
 		return err
 	}
 
-	// LED Bar - validate white values
-	validateWhite := func(section string, white []int) error {
-		if len(white) != 13 {
-			return fmt.Errorf("LED bar %s white must have 13 elements, got %d", section, len(white))
-		}
-		for i, val := range white {
-			if val < 0 || val > 255 {
-				return fmt.Errorf("LED bar %s white[%d] out of range: %d", section, i, val)
-			}
+	// Video Lights
+	if s.VideoLight1.Brightness < 0 || s.VideoLight1.Brightness > 100 {
+		return fmt.Errorf("video light 1 brightness out of range: %d", s.VideoLight1.Brightness)
+	}
+	if s.VideoLight2.Brightness < 0 || s.VideoLight2.Brightness > 100 {
+		return fmt.Errorf("video light 2 brightness out of range: %d", s.VideoLight2.Brightness)
+	}
+
+	if s.Transition != nil {
+		if _, err := s.Transition.Transition(); err != nil {
+			return err
 		}
-		return nil
 	}
 
-	if err := validateWhite("section1", s.LEDBar.Section1.White); err != nil {
-		return err
+	return nil
+}
+
+// validateBarSection checks an LED bar section has every LED, each within range
+func validateBarSection(section string, state LEDBarSection) error {
+	if len(state.RGBW) != 6 {
+		return fmt.Errorf("LED bar %s RGBW must have 6 elements, got %d", section, len(state.RGBW))
 	}
-	if err := validateWhite("section2", s.LEDBar.Section2.White); err != nil {
-		return err
+	for i, rgbw := range state.RGBW {
+		if err := validateRGBW(fmt.Sprintf("LED bar %s RGBW[%d]", section, i), rgbw); err != nil {
+			return err
+		}
 	}
 
-	// Video Lights
-	if s.VideoLight1.Brightness < 0 || s.VideoLight1.Brightness > 100 {
-		return fmt.Errorf("video light 1 brightness out of range: %d", s.VideoLight1.Brightness)
+	if len(state.White) != 13 {
+		return fmt.Errorf("LED bar %s white must have 13 elements, got %d", section, len(state.White))
 	}
-	if s.VideoLight2.Brightness < 0 || s.VideoLight2.Brightness > 100 {
-		return fmt.Errorf("video light 2 brightness out of range: %d", s.VideoLight2.Brightness)
+	for i, val := range state.White {
+		if val < 0 || val > 255 {
+			return fmt.Errorf("LED bar %s white[%d] out of range: %d", section, i, val)
+		}
 	}
+	return nil
+}
 
+// validateRGBW checks each channel of an RGBW LED is within range
+func validateRGBW(name string, c RGBW) error {
+	if c.R < 0 || c.R > 255 {
+		return fmt.Errorf("%s R out of range: %d", name, c.R)
+	}
+	if c.G < 0 || c.G > 255 {
+		return fmt.Errorf("%s G out of range: %d", name, c.G)
+	}
+	if c.B < 0 || c.B > 255 {
+		return fmt.Errorf("%s B out of range: %d", name, c.B)
+	}
+	if c.W < 0 || c.W > 255 {
+		return fmt.Errorf("%s W out of range: %d", name, c.W)
+	}
 	return nil
 }
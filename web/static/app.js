@@ -1,18 +1,39 @@
 // State management
 let currentState = null;
+let serverState = null;
+let stateETag = null;
 let updateTimer = null;
-let pollTimer = null;
+let eventSource = null;
 let isUpdating = false;
+let missedState = false;
+let effectDefinitions = [];
+let sequenceList = [];
+let circadianSettings = null;
+let circadianPreviewTimer = null;
+let sleepTimers = [];
+let onAirSettings = null;
+let sceneLibrary = [];
+let session = null;
 
 // Debounce delay in milliseconds
 const DEBOUNCE_DELAY = 300;
-const POLL_INTERVAL = 3000;
+const MAX_CONFLICT_RETRIES = 3;
+const LIGHTS = ['ledStrip', 'ledBar', 'videoLight1', 'videoLight2'];
 
 // Initialize on page load
 document.addEventListener('DOMContentLoaded', () => {
     initializeEventListeners();
+    loadSession();
     loadInitialState();
-    startPolling();
+    loadEffects();
+    loadSequences();
+    loadCircadian();
+    loadSleepTimers();
+    loadOnAir();
+    openEventStream();
+    showPage();
+    window.addEventListener('hashchange', showPage);
+    setInterval(renderSleepTimers, 1000);
 });
 
 // Initialize all event listeners
@@ -49,35 +70,167 @@ function initializeEventListeners() {
     // Video Light 2
     document.getElementById('vl2-on').addEventListener('change', handleVideoLight2Change);
     document.getElementById('vl2-brightness').addEventListener('input', handleVideoLight2Change);
+
+    // Effects
+    document.getElementById('effect-device').addEventListener('change', updateEffectOptions);
+    document.getElementById('effect-name').addEventListener('change', updateEffectParams);
+    document.getElementById('effect-start').addEventListener('click', startEffect);
+    document.getElementById('effect-stop').addEventListener('click', () => stopEffect(document.getElementById('effect-device').value));
+    document.getElementById('effect-stop-all').addEventListener('click', () => stopEffect(''));
+
+    // Sequences
+    document.getElementById('sequence-name').addEventListener('change', updateSequenceDetails);
+    document.getElementById('sequence-play').addEventListener('click', playSequence);
+    document.getElementById('sequence-pause').addEventListener('click', () => postSequenceRequest('/api/sequences/toggle'));
+    document.getElementById('sequence-stop').addEventListener('click', () => postSequenceRequest('/api/sequences/stop'));
+    document.getElementById('sequence-create').addEventListener('click', createSequence);
+    document.getElementById('sequence-add-keyframe').addEventListener('click', addSequenceKeyframe);
+
+    // Circadian
+    document.getElementById('circadian-ledbar').addEventListener('change', saveCircadian);
+    document.getElementById('circadian-ledstrip').addEventListener('change', saveCircadian);
+    document.getElementById('circadian-resume').addEventListener('click', resumeCircadian);
+    document.getElementById('circadian-add-point').addEventListener('click', addCircadianPoint);
+    document.getElementById('circadian-save').addEventListener('click', saveCircadian);
+
+    // Sleep timer
+    document.getElementById('sleep-start').addEventListener('click', startSleepTimer);
+
+    // On air
+    document.getElementById('onair-active').addEventListener('change', () => {
+        const action = document.getElementById('onair-active').checked ? 'on' : 'off';
+        sendOnAirRequest(`/api/onair/${action}`, 'POST');
+    });
+    document.getElementById('onair-save').addEventListener('click', saveOnAir);
+
+    // Scenes
+    document.getElementById('scene-save').addEventListener('click', saveCurrentScene);
+
+    // Undo history
+    document.getElementById('history-undo').addEventListener('click', () => sendHistoryRequest('undo'));
+    document.getElementById('history-redo').addEventListener('click', () => sendHistoryRequest('redo'));
+    document.addEventListener('keydown', handleHistoryKey);
+
+    // Session
+    document.getElementById('logout').addEventListener('click', logout);
+}
+
+// Find out who is logged in, going to the login page if nobody is
+async function loadSession() {
+    try {
+        const response = await fetch('/api/session');
+        if (response.status === 401) {
+            window.location.href = '/login';
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+        }
+
+        session = await response.json();
+        const user = document.getElementById('session-user');
+        user.textContent = `${session.name} (${session.role})`;
+        user.style.display = session.auth ? '' : 'none';
+        document.getElementById('logout').style.display = session.auth ? '' : 'none';
+        if (sceneLibrary.length > 0) {
+            renderScenes();
+        }
+    } catch (error) {
+        console.error('Failed to load session:', error);
+    }
+}
+
+// Whether the logged-in user may do admin-only things, like deleting scenes
+function isAdmin() {
+    return !session || session.role === 'admin';
+}
+
+// End the session and go back to the login page
+async function logout() {
+    try {
+        await fetch('/api/logout', { method: 'POST' });
+    } finally {
+        window.location.href = '/login';
+    }
+}
+
+// Show the lights or the scenes page, following the URL's hash
+function showPage() {
+    const scenes = window.location.hash === '#scenes';
+    document.getElementById('lights-page').style.display = scenes ? 'none' : '';
+    document.getElementById('scenes-page').style.display = scenes ? '' : 'none';
+    document.getElementById('nav-lights').classList.toggle('active', !scenes);
+    document.getElementById('nav-scenes').classList.toggle('active', scenes);
+    if (scenes) {
+        loadScenes();
+    }
 }
 
 // Load initial state from server
 async function loadInitialState() {
     try {
         const response = await fetch('/api');
+        if (response.status === 401) {
+            window.location.href = '/login';
+            return;
+        }
         if (!response.ok) {
             throw new Error(`HTTP ${response.status}: ${response.statusText}`);
         }
 
         currentState = await response.json();
+        serverState = structuredClone(currentState);
+        stateETag = response.headers.get('ETag');
         updateUIFromState(currentState);
-        updateConnectionStatus(true);
         updateLastUpdateTime();
         hideError();
     } catch (error) {
         console.error('Failed to load initial state:', error);
         showError('Failed to connect to server: ' + error.message);
-        updateConnectionStatus(false);
     }
 }
 
-// Start polling for state updates
-function startPolling() {
-    pollTimer = setInterval(async () => {
-        if (!isUpdating) {
-            await loadInitialState();
-        }
-    }, POLL_INTERVAL);
+// Listen for changes pushed by the server; the browser reconnects by itself
+// if the stream drops, and the server starts each connection with everything
+function openEventStream() {
+    eventSource = new EventSource('/api/events');
+
+    eventSource.onopen = () => {
+        updateConnectionStatus(true);
+        hideError();
+    };
+    eventSource.onerror = () => {
+        updateConnectionStatus(false);
+        // The stream can't say why it failed, so check the login hasn't expired
+        loadSession();
+    };
+
+    eventSource.addEventListener('state', event => applyStateDelta(JSON.parse(event.data)));
+    eventSource.addEventListener('effects', event => updateEffectsUI(JSON.parse(event.data)));
+    eventSource.addEventListener('sequences', event => updateSequencesUI(JSON.parse(event.data)));
+    eventSource.addEventListener('circadian', event => updateCircadianUI(JSON.parse(event.data)));
+    eventSource.addEventListener('sleep', event => updateSleepTimers(JSON.parse(event.data)));
+    eventSource.addEventListener('onair', event => updateOnAirUI(JSON.parse(event.data)));
+    eventSource.addEventListener('history', event => updateHistoryUI(JSON.parse(event.data)));
+}
+
+// Merge the lights that changed into the current state and show them
+function applyStateDelta(delta) {
+    if (!currentState || isUpdating || updateTimer) {
+        // Don't move controls under the user; the POST is refused if this
+        // change conflicts, and the state is reloaded once it is done
+        missedState = true;
+        return;
+    }
+
+    const { revision, ...lights } = delta;
+    currentState = { ...currentState, ...lights };
+    serverState = structuredClone(currentState);
+    if (revision !== undefined) {
+        stateETag = `"${revision}"`;
+    }
+    updateUIFromState(currentState);
+    updateLastUpdateTime();
 }
 
 // Update UI controls from state
@@ -347,6 +500,7 @@ function debouncedUpdate() {
     }
 
     updateTimer = setTimeout(() => {
+        updateTimer = null;
         sendStateToServer();
     }, DEBOUNCE_DELAY);
 }
@@ -358,29 +512,916 @@ async function sendStateToServer() {
     isUpdating = true;
 
     try {
-        const response = await fetch('/api', {
+        for (let attempt = 0; ; attempt++) {
+            const headers = { 'Content-Type': 'application/json' };
+            if (stateETag) {
+                // Refused with 412 if the lights were changed elsewhere since we last heard
+                headers['If-Match'] = stateETag;
+            }
+            const response = await fetch('/api', {
+                method: 'POST',
+                headers: headers,
+                body: JSON.stringify(currentState),
+            });
+
+            if (response.status === 412 && attempt < MAX_CONFLICT_RETRIES) {
+                // Keep our edits, take everything else from the server and try again
+                const latestState = await response.json();
+                currentState = mergeStates(serverState, currentState, latestState);
+                serverState = latestState;
+                stateETag = response.headers.get('ETag');
+                updateUIFromState(currentState);
+                continue;
+            }
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+            }
+
+            currentState = await response.json();
+            serverState = structuredClone(currentState);
+            stateETag = response.headers.get('ETag');
+            break;
+        }
+
+        if (missedState && !updateTimer) {
+            missedState = false;
+            loadInitialState();
+        }
+        updateLastUpdateTime();
+        hideError();
+    } catch (error) {
+        console.error('Failed to update state:', error);
+        showError('Failed to update lights: ' + error.message);
+    } finally {
+        isUpdating = false;
+    }
+}
+
+// Merge our edits into the latest server state, light by light: lights we
+// changed since the server state we started from keep our values, and the
+// rest take the latest
+function mergeStates(base, local, latest) {
+    const merged = { ...latest };
+    for (const light of LIGHTS) {
+        if (base && JSON.stringify(local[light]) !== JSON.stringify(base[light])) {
+            merged[light] = local[light];
+        }
+    }
+    return merged;
+}
+
+// Load effect definitions and running effects from server
+async function loadEffects() {
+    try {
+        const response = await fetch('/api/effects');
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+        }
+        updateEffectsUI(await response.json());
+    } catch (error) {
+        console.error('Failed to load effects:', error);
+    }
+}
+
+// Update effect lists from a server response
+function updateEffectsUI(data) {
+    const firstLoad = effectDefinitions.length === 0;
+    effectDefinitions = data.effects;
+    if (firstLoad) {
+        updateEffectOptions();
+    }
+
+    const list = document.getElementById('effect-running');
+    list.innerHTML = '';
+    if (data.running.length === 0) {
+        list.innerHTML = '<li>No effects running</li>';
+        return;
+    }
+    for (const status of data.running) {
+        const item = document.createElement('li');
+        item.textContent = `${status.device}: ${status.effect}`;
+        list.appendChild(item);
+    }
+}
+
+// Fill the effect list with the effects the selected device supports
+function updateEffectOptions() {
+    const device = document.getElementById('effect-device').value;
+    const select = document.getElementById('effect-name');
+    select.innerHTML = '';
+    for (const effect of effectDefinitions) {
+        if (!effect.devices.includes(device)) continue;
+        const option = document.createElement('option');
+        option.value = effect.name;
+        option.textContent = effect.name;
+        select.appendChild(option);
+    }
+    updateEffectParams();
+}
+
+// Show a slider for each parameter of the selected effect
+function updateEffectParams() {
+    const effect = effectDefinitions.find(e => e.name === document.getElementById('effect-name').value);
+    const container = document.getElementById('effect-params');
+    container.innerHTML = '';
+    document.getElementById('effect-description').textContent = effect ? effect.description : '';
+    if (!effect) return;
+
+    for (const param of effect.params) {
+        const step = param.max - param.min <= 1 ? 0.05 : (param.max - param.min <= 10 ? 0.5 : 1);
+        const group = document.createElement('div');
+        group.className = 'control-group';
+        group.innerHTML = `
+            <label title="${param.description}">${param.name} <span class="value">${param.default}</span></label>
+            <input type="range" data-param="${param.name}" min="${param.min}" max="${param.max}" step="${step}" value="${param.default}">`;
+        const input = group.querySelector('input');
+        input.addEventListener('input', () => {
+            group.querySelector('.value').textContent = input.value;
+        });
+        container.appendChild(group);
+    }
+}
+
+// Start the selected effect with the chosen parameters
+async function startEffect() {
+    const params = {};
+    document.querySelectorAll('#effect-params input').forEach(input => {
+        params[input.dataset.param] = parseFloat(input.value);
+    });
+
+    await postEffectRequest('/api/effects/start', {
+        effect: document.getElementById('effect-name').value,
+        device: document.getElementById('effect-device').value,
+        params: params,
+    });
+}
+
+// Stop the effect on a device, or every effect when device is empty
+async function stopEffect(device) {
+    await postEffectRequest('/api/effects/stop', { device: device });
+}
+
+// Send an effect request and show the result
+async function postEffectRequest(url, body) {
+    try {
+        const response = await fetch(url, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
             },
-            body: JSON.stringify(currentState),
+            body: JSON.stringify(body),
         });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        updateEffectsUI(data);
+        hideError();
+    } catch (error) {
+        console.error('Effect request failed:', error);
+        showError('Effect request failed: ' + error.message);
+    }
+}
 
+// Load sequences and playback status from server
+async function loadSequences() {
+    try {
+        const response = await fetch('/api/sequences');
         if (!response.ok) {
             throw new Error(`HTTP ${response.status}: ${response.statusText}`);
         }
+        updateSequencesUI(await response.json());
+    } catch (error) {
+        console.error('Failed to load sequences:', error);
+    }
+}
 
-        const updatedState = await response.json();
-        currentState = updatedState;
-        updateConnectionStatus(true);
-        updateLastUpdateTime();
+// Update the sequence list and playback status from a server response
+function updateSequencesUI(data) {
+    sequenceList = data.sequences;
+
+    const select = document.getElementById('sequence-name');
+    const selected = select.value;
+    select.innerHTML = '';
+    for (const seq of sequenceList) {
+        const option = document.createElement('option');
+        option.value = seq.id;
+        option.textContent = seq.name;
+        select.appendChild(option);
+    }
+    if (sequenceList.some(seq => String(seq.id) === selected)) {
+        select.value = selected;
+    }
+    updateSequenceDetails();
+    updateSequenceStatus(data.status);
+}
+
+// Show the selected sequence's description and loop setting
+function updateSequenceDetails() {
+    const seq = selectedSequence();
+    const description = document.getElementById('sequence-description');
+    if (!seq) {
+        description.textContent = 'No sequences yet';
+        return;
+    }
+    const seconds = seq.keyframes.reduce((total, kf) => total + kf.fade + kf.hold, 0) / 1000;
+    description.textContent = `${seq.description ? seq.description + ' - ' : ''}${seq.keyframes.length} keyframes, ${formatDuration(seconds)}`;
+}
+
+// Show playback progress
+function updateSequenceStatus(status) {
+    const fill = document.getElementById('sequence-progress');
+    const text = document.getElementById('sequence-status');
+    const pause = document.getElementById('sequence-pause');
+
+    if (status.state === 'stopped') {
+        fill.style.width = '0%';
+        text.textContent = 'Stopped';
+        pause.textContent = 'Pause';
+        return;
+    }
+
+    fill.style.width = `${Math.round(status.progress * 100)}%`;
+    const state = status.state === 'paused' ? 'Paused' : 'Playing';
+    const loop = status.loop ? ` (pass ${status.iteration})` : '';
+    text.textContent = `${state} ${status.sequence}${loop}: keyframe ${status.keyframe}/${status.keyframes}, ` +
+        `${formatDuration(status.elapsed / 1000)} of ${formatDuration(status.duration / 1000)}`;
+    pause.textContent = status.state === 'paused' ? 'Resume' : 'Pause';
+}
+
+// Return the sequence chosen in the list
+function selectedSequence() {
+    const id = document.getElementById('sequence-name').value;
+    return sequenceList.find(seq => String(seq.id) === id);
+}
+
+// Play the selected sequence
+async function playSequence() {
+    const seq = selectedSequence();
+    if (!seq) return;
+    await postSequenceRequest(`/api/sequences/${seq.id}/play`, {
+        loop: document.getElementById('sequence-loop').checked,
+    });
+}
+
+// Create an empty sequence to record keyframes into
+async function createSequence() {
+    const name = document.getElementById('sequence-new-name').value.trim();
+    if (!name) {
+        showError('Sequence name is required');
+        return;
+    }
+    const seq = await postSequenceRequest('/api/sequences', { name: name, keyframes: [] });
+    if (seq) {
+        document.getElementById('sequence-new-name').value = '';
+        document.getElementById('sequence-name').value = seq.id;
+        updateSequenceDetails();
+    }
+}
+
+// Append the current light state to the selected sequence
+async function addSequenceKeyframe() {
+    const seq = selectedSequence();
+    if (!seq) {
+        showError('Create a sequence first');
+        return;
+    }
+    await postSequenceRequest(`/api/sequences/${seq.id}/keyframes`, {
+        fade: Math.round(parseFloat(document.getElementById('sequence-fade').value || '0') * 1000),
+        hold: Math.round(parseFloat(document.getElementById('sequence-hold').value || '0') * 1000),
+    });
+}
+
+// Send a sequence request, then refresh the card
+async function postSequenceRequest(url, body) {
+    try {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(body || {}),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        await loadSequences();
         hideError();
+        return data;
     } catch (error) {
-        console.error('Failed to update state:', error);
-        showError('Failed to update lights: ' + error.message);
-        updateConnectionStatus(false);
-    } finally {
-        isUpdating = false;
+        console.error('Sequence request failed:', error);
+        showError('Sequence request failed: ' + error.message);
+        return null;
+    }
+}
+
+// Load circadian settings and status from server
+async function loadCircadian() {
+    try {
+        const response = await fetch('/api/circadian');
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+        }
+        updateCircadianUI(await response.json());
+    } catch (error) {
+        console.error('Failed to load circadian settings:', error);
+    }
+}
+
+// Update the circadian card from a server response
+function updateCircadianUI(data) {
+    const firstLoad = circadianSettings === null;
+    circadianSettings = data.settings;
+    document.getElementById('circadian-ledbar').checked = data.settings.ledBar;
+    document.getElementById('circadian-ledstrip').checked = data.settings.ledStrip;
+
+    // Leave the point editor alone once loaded so polling doesn't undo edits
+    if (firstLoad) {
+        renderCircadianPoints(data.settings.curve);
+        previewCircadian();
+    }
+
+    const status = data.status;
+    const following = status.devices.filter(d => d.enabled && !d.paused).map(d => deviceLabel(d.device));
+    const paused = status.devices.filter(d => d.enabled && d.paused).map(d => deviceLabel(d.device));
+    let text = `Now ${status.kelvin}K at ${status.brightness}%`;
+    if (following.length > 0) {
+        text += ` - following: ${following.join(', ')}`;
+    }
+    if (paused.length > 0) {
+        text += ` - paused by a manual change: ${paused.join(', ')}`;
+    }
+    if (following.length === 0 && paused.length === 0) {
+        text += ' - no lights enabled';
+    }
+    document.getElementById('circadian-status').textContent = text;
+    document.getElementById('circadian-resume').disabled = paused.length === 0;
+}
+
+// Name a circadian device for display
+function deviceLabel(device) {
+    return device === 'ledBar' ? 'LED bar' : 'LED strip';
+}
+
+// Show a row of inputs for each curve point
+function renderCircadianPoints(curve) {
+    const container = document.getElementById('circadian-points');
+    container.innerHTML = '';
+    for (const point of curve) {
+        appendCircadianPoint(point);
+    }
+}
+
+// Add one editable curve point row
+function appendCircadianPoint(point) {
+    const row = document.createElement('div');
+    row.className = 'curve-point';
+    row.innerHTML = `
+        <input type="time" data-field="time" value="${point.time}">
+        <input type="number" data-field="kelvin" min="1000" max="10000" step="100" value="${point.kelvin}">
+        <input type="number" data-field="brightness" min="0" max="100" value="${point.brightness}">
+        <button title="Remove point">&times;</button>`;
+    row.querySelector('button').addEventListener('click', () => {
+        row.remove();
+        debouncedCircadianPreview();
+    });
+    row.querySelectorAll('input').forEach(input => input.addEventListener('input', debouncedCircadianPreview));
+    document.getElementById('circadian-points').appendChild(row);
+}
+
+// Add a new point after the last one
+function addCircadianPoint() {
+    const curve = readCircadianCurve();
+    const last = curve[curve.length - 1] || { time: '12:00', kelvin: 4000, brightness: 80 };
+    const [hours, minutes] = last.time.split(':').map(Number);
+    const time = `${String((hours + 1) % 24).padStart(2, '0')}:${String(minutes).padStart(2, '0')}`;
+    appendCircadianPoint({ time: time, kelvin: last.kelvin, brightness: last.brightness });
+    debouncedCircadianPreview();
+}
+
+// Read the curve from the point editor
+function readCircadianCurve() {
+    return Array.from(document.querySelectorAll('#circadian-points .curve-point')).map(row => ({
+        time: row.querySelector('[data-field="time"]').value,
+        kelvin: parseInt(row.querySelector('[data-field="kelvin"]').value, 10) || 0,
+        brightness: parseInt(row.querySelector('[data-field="brightness"]').value, 10) || 0,
+    }));
+}
+
+// Redraw the chart once editing pauses
+function debouncedCircadianPreview() {
+    clearTimeout(circadianPreviewTimer);
+    circadianPreviewTimer = setTimeout(previewCircadian, DEBOUNCE_DELAY);
+}
+
+// Sample the edited curve and draw it
+async function previewCircadian() {
+    try {
+        const response = await fetch('/api/circadian/preview', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ curve: readCircadianCurve() }),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        drawCircadianChart(data.samples);
+        hideError();
+    } catch (error) {
+        showError('Invalid curve: ' + error.message);
+    }
+}
+
+// Draw the colour across the day as a band, with brightness as a line over it
+function drawCircadianChart(samples) {
+    const canvas = document.getElementById('circadian-chart');
+    const ctx = canvas.getContext('2d');
+    const width = canvas.width;
+    const height = canvas.height;
+    const band = 16;
+    const step = width / samples.length;
+
+    ctx.clearRect(0, 0, width, height);
+    samples.forEach((sample, i) => {
+        ctx.fillStyle = sample.color;
+        ctx.fillRect(i * step, height - band, step + 1, band);
+    });
+
+    ctx.strokeStyle = '#4a9eff';
+    ctx.lineWidth = 2;
+    ctx.beginPath();
+    samples.forEach((sample, i) => {
+        const x = i * step + step / 2;
+        const y = (height - band - 4) * (1 - sample.brightness / 100) + 2;
+        if (i === 0) {
+            ctx.moveTo(x, y);
+        } else {
+            ctx.lineTo(x, y);
+        }
+    });
+    ctx.stroke();
+
+    // Mark the current time
+    const now = new Date();
+    const x = (now.getHours() * 60 + now.getMinutes()) / 1440 * width;
+    ctx.strokeStyle = '#888';
+    ctx.lineWidth = 1;
+    ctx.beginPath();
+    ctx.moveTo(x, 0);
+    ctx.lineTo(x, height);
+    ctx.stroke();
+}
+
+// Save which lights follow the curve and the edited curve
+async function saveCircadian() {
+    try {
+        const response = await fetch('/api/circadian', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                ledBar: document.getElementById('circadian-ledbar').checked,
+                ledStrip: document.getElementById('circadian-ledstrip').checked,
+                curve: readCircadianCurve(),
+            }),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        circadianSettings = null;
+        updateCircadianUI(data);
+        hideError();
+    } catch (error) {
+        console.error('Circadian request failed:', error);
+        showError('Circadian request failed: ' + error.message);
+    }
+}
+
+// Put manually adjusted lights back on the curve
+async function resumeCircadian() {
+    try {
+        const response = await fetch('/api/circadian/resume', { method: 'POST' });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        updateCircadianUI(data);
+        hideError();
+    } catch (error) {
+        console.error('Circadian request failed:', error);
+        showError('Circadian request failed: ' + error.message);
+    }
+}
+
+// Load the pending sleep timers from server
+async function loadSleepTimers() {
+    try {
+        const response = await fetch('/api/sleep');
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+        }
+        updateSleepTimers(await response.json());
+    } catch (error) {
+        console.error('Failed to load sleep timers:', error);
+    }
+}
+
+// Keep the timers from a server response, counting down from the local clock
+// so the countdown doesn't depend on the server's clock matching ours
+function updateSleepTimers(data) {
+    const now = Date.now();
+    sleepTimers = data.timers.map(timer => ({ ...timer, endsAt: now + timer.remaining }));
+    renderSleepTimers();
+}
+
+// Show each pending timer with its countdown and a cancel button
+function renderSleepTimers() {
+    const list = document.getElementById('sleep-timers');
+    list.innerHTML = '';
+    if (sleepTimers.length === 0) {
+        list.innerHTML = '<li>No sleep timers</li>';
+        return;
+    }
+
+    const now = Date.now();
+    for (const timer of sleepTimers) {
+        const remaining = Math.max(0, timer.endsAt - now);
+        const item = document.createElement('li');
+        const label = document.createElement('span');
+        const target = document.querySelector(`#sleep-target option[value="${timer.target}"]`);
+        const fading = timer.fading || remaining <= timer.fade ? ' (fading)' : '';
+        label.textContent = `${target ? target.textContent : timer.target}: off in ${formatDuration(Math.ceil(remaining / 1000))}${fading}`;
+        const cancel = document.createElement('button');
+        cancel.textContent = 'Cancel';
+        cancel.addEventListener('click', () => cancelSleepTimer(timer.target));
+        item.appendChild(label);
+        item.appendChild(cancel);
+        list.appendChild(item);
+    }
+}
+
+// Start a sleep timer for the chosen lights
+async function startSleepTimer() {
+    const minutes = parseFloat(document.getElementById('sleep-minutes').value || '0');
+    const fade = parseFloat(document.getElementById('sleep-fade').value || '0');
+    await sendSleepRequest('/api/sleep', 'POST', {
+        target: document.getElementById('sleep-target').value,
+        duration: Math.round(minutes * 60000),
+        fade: Math.round(fade * 60000),
+    });
+}
+
+// Cancel the sleep timer for a target
+async function cancelSleepTimer(target) {
+    await sendSleepRequest(`/api/sleep/${target}`, 'DELETE');
+}
+
+// Send a sleep timer request and show the result
+async function sendSleepRequest(url, method, body) {
+    try {
+        const options = { method: method };
+        if (body) {
+            options.headers = { 'Content-Type': 'application/json' };
+            options.body = JSON.stringify(body);
+        }
+        const response = await fetch(url, options);
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        updateSleepTimers(data);
+        hideError();
+    } catch (error) {
+        console.error('Sleep timer request failed:', error);
+        showError('Sleep timer request failed: ' + error.message);
+    }
+}
+
+// Load the on-air settings from server
+async function loadOnAir() {
+    try {
+        const response = await fetch('/api/onair');
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+        }
+        updateOnAirUI(await response.json());
+    } catch (error) {
+        console.error('Failed to load on-air settings:', error);
+    }
+}
+
+// Show the on-air state and settings
+function updateOnAirUI(data) {
+    onAirSettings = data.settings;
+    document.getElementById('onair-active').checked = onAirSettings.active;
+    document.getElementById('onair-card').classList.toggle('on-air', onAirSettings.active);
+    document.getElementById('onair-color').value = onAirSettings.color;
+    document.getElementById('onair-pulse').value = onAirSettings.pulse / 1000;
+    document.querySelectorAll('#onair-lights input').forEach(input => {
+        input.checked = onAirSettings.lights.includes(input.value);
+    });
+}
+
+// Save the chosen lights, colour and pulse, keeping the indicator on or off
+async function saveOnAir() {
+    const lights = Array.from(document.querySelectorAll('#onair-lights input:checked')).map(input => input.value);
+    const pulse = parseFloat(document.getElementById('onair-pulse').value || '0');
+    await sendOnAirRequest('/api/onair', 'PUT', {
+        active: document.getElementById('onair-active').checked,
+        lights: lights,
+        color: document.getElementById('onair-color').value,
+        pulse: Math.round(pulse * 1000),
+    });
+}
+
+// Send an on-air request and show the result
+async function sendOnAirRequest(url, method, body) {
+    try {
+        const options = { method: method };
+        if (body) {
+            options.headers = { 'Content-Type': 'application/json' };
+            options.body = JSON.stringify(body);
+        }
+        const response = await fetch(url, options);
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        updateOnAirUI(data);
+        hideError();
+    } catch (error) {
+        console.error('On-air request failed:', error);
+        showError('On-air request failed: ' + error.message);
+        if (onAirSettings) {
+            document.getElementById('onair-active').checked = onAirSettings.active;
+        }
+    }
+}
+
+// Enable the undo and redo buttons if there is something to undo or redo
+function updateHistoryUI(status) {
+    document.getElementById('history-undo').disabled = status.undo === 0;
+    document.getElementById('history-redo').disabled = status.redo === 0;
+}
+
+// Undo with Ctrl+Z and redo with Ctrl+Shift+Z or Ctrl+Y, unless typing in a text field
+function handleHistoryKey(event) {
+    if (!(event.ctrlKey || event.metaKey) || event.altKey) return;
+    const target = event.target;
+    if (target.isContentEditable || target.tagName === 'TEXTAREA' ||
+        (target.tagName === 'INPUT' && !['range', 'checkbox', 'color'].includes(target.type))) {
+        return;
+    }
+
+    const key = event.key.toLowerCase();
+    if (key === 'z') {
+        event.preventDefault();
+        sendHistoryRequest(event.shiftKey ? 'redo' : 'undo');
+    } else if (key === 'y') {
+        event.preventDefault();
+        sendHistoryRequest('redo');
+    }
+}
+
+// Undo or redo the last change to the lights; the lights come back through the event stream
+async function sendHistoryRequest(action) {
+    try {
+        const response = await fetch(`/api/history/${action}`, { method: 'POST' });
+        const data = await response.json();
+        if (response.status === 409) {
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        updateHistoryUI(data);
+        hideError();
+    } catch (error) {
+        console.error(`History ${action} failed:`, error);
+        showError(`Failed to ${action}: ` + error.message);
+    }
+}
+
+// Format seconds as m:ss
+function formatDuration(seconds) {
+    const total = Math.round(seconds);
+    const minutes = Math.floor(total / 60);
+    return `${minutes}:${String(total % 60).padStart(2, '0')}`;
+}
+
+// Load the scene library from server
+async function loadScenes() {
+    try {
+        const response = await fetch('/api/scenes');
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+        }
+        sceneLibrary = (await response.json()).scenes;
+        renderScenes();
+        await loadShortcuts();
+    } catch (error) {
+        console.error('Failed to load scenes:', error);
+    }
+}
+
+// Load the Stream Deck's scene shortcut buttons from server
+async function loadShortcuts() {
+    const response = await fetch('/api/shortcuts');
+    if (!response.ok) {
+        throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+    }
+    renderShortcuts((await response.json()).shortcuts);
+}
+
+// Show a scene picker for each shortcut button
+function renderShortcuts(shortcuts) {
+    const list = document.getElementById('shortcut-list');
+    list.innerHTML = '';
+
+    for (const shortcut of shortcuts) {
+        const label = document.createElement('label');
+        label.textContent = `Button ${shortcut.button}`;
+
+        const select = document.createElement('select');
+        const none = document.createElement('option');
+        none.value = '';
+        none.textContent = 'None';
+        select.appendChild(none);
+        for (const scene of sceneLibrary) {
+            const option = document.createElement('option');
+            option.value = scene.id;
+            option.textContent = scene.name;
+            select.appendChild(option);
+        }
+        select.value = shortcut.sceneId === null ? '' : String(shortcut.sceneId);
+        select.addEventListener('change', () => sendSceneRequest(`/api/shortcuts/${shortcut.button}`, 'PUT',
+            { sceneId: select.value === '' ? null : Number(select.value) }));
+
+        label.appendChild(select);
+        list.appendChild(label);
+    }
+}
+
+// Show a card for each scene with swatches previewing its lights
+function renderScenes() {
+    const list = document.getElementById('scene-list');
+    list.innerHTML = '';
+    if (sceneLibrary.length === 0) {
+        list.textContent = 'No scenes saved yet';
+        return;
+    }
+
+    for (const scene of sceneLibrary) {
+        const card = document.createElement('section');
+        card.className = 'card scene-card';
+        card.style.borderLeftColor = scene.bgColor || '#444';
+
+        const title = document.createElement('h3');
+        const name = document.createElement('span');
+        name.textContent = scene.name;
+        const color = document.createElement('input');
+        color.type = 'color';
+        color.value = (scene.bgColor || '#444444').toLowerCase();
+        color.title = 'Scene colour';
+        color.addEventListener('change', () => sendSceneRequest(`/api/scenes/${scene.id}`, 'PATCH', { bgColor: color.value }));
+        title.appendChild(name);
+        title.appendChild(color);
+        card.appendChild(title);
+
+        card.appendChild(renderScenePreview(scene.preview));
+
+        const buttons = document.createElement('div');
+        buttons.className = 'button-group';
+        buttons.appendChild(sceneButton('Recall', () => sendSceneRequest(`/api/scenes/${scene.id}/recall`, 'POST')));
+        buttons.appendChild(sceneButton('Rename', () => renameScene(scene)));
+        if (isAdmin()) {
+            buttons.appendChild(sceneButton('Delete', () => deleteScene(scene)));
+        }
+        card.appendChild(buttons);
+
+        list.appendChild(card);
+    }
+}
+
+// Build the swatches for a scene's strip, bar sections and video lights
+function renderScenePreview(preview) {
+    const container = document.createElement('div');
+    container.className = 'scene-preview';
+
+    const row = (label, ...children) => {
+        const div = document.createElement('div');
+        div.className = 'row';
+        const text = document.createElement('span');
+        text.textContent = label;
+        div.appendChild(text);
+        children.forEach(child => div.appendChild(child));
+        container.appendChild(div);
+    };
+    const swatch = (color, extraClass) => {
+        const span = document.createElement('span');
+        span.className = 'swatch' + (extraClass ? ' ' + extraClass : '');
+        if (color) {
+            span.style.backgroundColor = color;
+            span.title = color;
+        } else {
+            span.classList.add('unset');
+            span.title = 'Left as it is';
+        }
+        return span;
+    };
+    const level = (fraction, title) => {
+        const bar = document.createElement('span');
+        bar.className = 'level';
+        bar.title = title;
+        const fill = document.createElement('span');
+        fill.style.width = `${Math.round(fraction * 100)}%`;
+        bar.appendChild(fill);
+        return bar;
+    };
+
+    row('LED Strip', swatch(preview.ledStrip, 'strip'));
+    for (const [key, label] of [['section1', 'Bar 1'], ['section2', 'Bar 2']]) {
+        const section = preview[key];
+        if (!section) {
+            row(label, swatch(null, 'strip'));
+            continue;
+        }
+        const white = section.white === null ? [] : [level(section.white / 255, `White ${section.white}`)];
+        row(label, ...section.rgbw.map(color => swatch(color)), ...white);
+    }
+    for (const [key, label] of [['videoLight1', 'Video 1'], ['videoLight2', 'Video 2']]) {
+        const light = preview[key];
+        if (!light) {
+            row(label, swatch(null, 'strip'));
+        } else {
+            row(label, level(light.on ? light.brightness / 100 : 0, light.on ? `${light.brightness}%` : 'Off'));
+        }
+    }
+
+    return container;
+}
+
+// Create a button for a scene card
+function sceneButton(label, onClick) {
+    const button = document.createElement('button');
+    button.textContent = label;
+    button.addEventListener('click', onClick);
+    return button;
+}
+
+// Save the lights as they are now as a new scene
+async function saveCurrentScene() {
+    const name = document.getElementById('scene-new-name').value.trim();
+    if (!name) {
+        showError('Give the scene a name');
+        return;
+    }
+    if (await sendSceneRequest('/api/scenes', 'POST', { name: name, bgColor: document.getElementById('scene-new-color').value })) {
+        document.getElementById('scene-new-name').value = '';
+    }
+}
+
+// Ask for a new name for a scene
+async function renameScene(scene) {
+    const name = prompt('Scene name', scene.name);
+    if (name && name !== scene.name) {
+        await sendSceneRequest(`/api/scenes/${scene.id}`, 'PATCH', { name: name });
+    }
+}
+
+// Delete a scene once confirmed
+async function deleteScene(scene) {
+    if (confirm(`Delete scene "${scene.name}"?`)) {
+        await sendSceneRequest(`/api/scenes/${scene.id}`, 'DELETE');
+    }
+}
+
+// Send a scene request, then reload the library; returns whether it succeeded
+async function sendSceneRequest(url, method, body) {
+    try {
+        const options = { method: method };
+        if (body) {
+            options.headers = { 'Content-Type': 'application/json' };
+            options.body = JSON.stringify(body);
+        }
+        const response = await fetch(url, options);
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        hideError();
+        await loadScenes();
+        return true;
+    } catch (error) {
+        console.error('Scene request failed:', error);
+        showError('Scene request failed: ' + error.message);
+        return false;
     }
 }
 
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// selfSignedValidity is how long a generated certificate lasts
+const selfSignedValidity = 5 * 365 * 24 * time.Hour
+
+// certificate loads the configured certificate, generating a self-signed one if asked to
+//
+// A generated certificate is written to CertFile and KeyFile when they are set,
+// so browsers that have been told to trust it go on doing so after a restart;
+// without them it lives only as long as the server.
+func (c ListenConfig) certificate() (tls.Certificate, error) {
+	if c.CertFile != "" && c.KeyFile != "" {
+		_, err := os.Stat(c.CertFile)
+		if err == nil || !c.SelfSigned || !errors.Is(err, os.ErrNotExist) {
+			return tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		}
+	}
+
+	certPEM, keyPEM, err := selfSigned(c.Addr)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	if c.CertFile != "" && c.KeyFile != "" {
+		if err := os.WriteFile(c.KeyFile, keyPEM, 0600); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := os.WriteFile(c.CertFile, certPEM, 0644); err != nil {
+			return tls.Certificate{}, err
+		}
+		log.Printf("Web: Wrote self-signed certificate to %s", c.CertFile)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	log.Printf("Web: Using self-signed certificate, SHA-256 fingerprint %X", sha256.Sum256(cert.Certificate[0]))
+	return cert, nil
+}
+
+// selfSigned generates a certificate and key, PEM encoded, for localhost, this
+// machine's name and the address the server listens on
+func selfSigned(addr string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "office_lights", Organization: []string{"office_lights"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			if !ip.IsUnspecified() && !ip.IsLoopback() {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			}
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
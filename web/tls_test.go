@@ -0,0 +1,119 @@
+package web
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfSigned(t *testing.T) {
+	certPEM, keyPEM, err := selfSigned("192.168.1.20:8443")
+	if err != nil {
+		t.Fatalf("selfSigned failed: %v", err)
+	}
+	if block, _ := pem.Decode(keyPEM); block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatalf("Expected a PEM private key, got %q", keyPEM)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("Expected a PEM certificate, got %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Invalid certificate: %v", err)
+	}
+
+	// A server certificate, not one that can sign others
+	if cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign != 0 {
+		t.Error("Expected a certificate that can't sign others")
+	}
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("Expected digital signature key usage, got %v", cert.KeyUsage)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("Expected server auth extended key usage, got %v", cert.ExtKeyUsage)
+	}
+
+	// Trusted by itself, it is good for localhost and the address listened on
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	for _, name := range []string{"localhost", "127.0.0.1", "192.168.1.20"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("Certificate not valid for %s: %v", name, err)
+		}
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err == nil {
+		t.Error("Expected the certificate not to be valid for example.com")
+	}
+}
+
+func TestCertificateLoadsPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM, keyPEM, err := selfSigned(":8443")
+	if err != nil {
+		t.Fatalf("selfSigned failed: %v", err)
+	}
+	os.WriteFile(certFile, certPEM, 0644)
+	os.WriteFile(keyFile, keyPEM, 0600)
+
+	cert, err := ListenConfig{Addr: ":8443", CertFile: certFile, KeyFile: keyFile}.certificate()
+	if err != nil {
+		t.Fatalf("certificate failed: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if !bytes.Equal(cert.Certificate[0], block.Bytes) {
+		t.Error("Expected the certificate from the file")
+	}
+
+	// A missing pair is an error unless a self-signed one may be made
+	missing := ListenConfig{Addr: ":8443", CertFile: filepath.Join(dir, "none.pem"), KeyFile: filepath.Join(dir, "none-key.pem")}
+	if _, err := missing.certificate(); err == nil {
+		t.Error("Expected an error for a missing certificate")
+	}
+}
+
+func TestCertificateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	config := ListenConfig{
+		Addr:       ":8443",
+		CertFile:   filepath.Join(dir, "cert.pem"),
+		KeyFile:    filepath.Join(dir, "key.pem"),
+		SelfSigned: true,
+	}
+
+	// The first start generates a certificate and writes it out
+	first, err := config.certificate()
+	if err != nil {
+		t.Fatalf("certificate failed: %v", err)
+	}
+	info, err := os.Stat(config.KeyFile)
+	if err != nil {
+		t.Fatalf("Expected the key written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key readable only by its owner, got %v", info.Mode().Perm())
+	}
+
+	// Later ones load it again rather than make a new one
+	second, err := config.certificate()
+	if err != nil {
+		t.Fatalf("certificate failed: %v", err)
+	}
+	if !bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Error("Expected the written certificate to be reused")
+	}
+
+	// Without files a new one is made each time
+	memory, err := ListenConfig{Addr: ":8443", SelfSigned: true}.certificate()
+	if err != nil {
+		t.Fatalf("certificate failed: %v", err)
+	}
+	if bytes.Equal(memory.Certificate[0], first.Certificate[0]) {
+		t.Error("Expected a new certificate")
+	}
+}
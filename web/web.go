@@ -1,46 +1,183 @@
 package web
 
 import (
+	"context"
+	"crypto/tls"
 	"embed"
+	"errors"
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/kevin/office_lights/calendar"
+	"github.com/kevin/office_lights/circadian"
 	"github.com/kevin/office_lights/drivers/ledbar"
 	"github.com/kevin/office_lights/drivers/ledstrip"
 	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/history"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/metrics"
+	"github.com/kevin/office_lights/notify"
+	"github.com/kevin/office_lights/onair"
+	"github.com/kevin/office_lights/rules"
+	"github.com/kevin/office_lights/schedule"
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/sleeptimer"
+	"github.com/kevin/office_lights/storage"
+	"github.com/kevin/office_lights/webhooks"
 )
 
 //go:embed static/*
 var staticFiles embed.FS
 
+// Default timeouts for the web server
+const (
+	DefaultReadTimeout     = 15 * time.Second
+	DefaultWriteTimeout    = 30 * time.Second
+	DefaultIdleTimeout     = 2 * time.Minute
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// ListenConfig configures where and how the web server listens
+type ListenConfig struct {
+	Addr         string        // host:port, or :port for every interface
+	CertFile     string        // TLS certificate; HTTPS is served when this and KeyFile are set
+	KeyFile      string        // TLS private key
+	SelfSigned   bool          // serve HTTPS with a generated certificate if the files don't exist
+	ReadTimeout  time.Duration // for reading a whole request
+	WriteTimeout time.Duration // for writing a response, except the event stream
+	IdleTimeout  time.Duration // for keep-alive connections between requests
+}
+
+// TLS reports whether the server is to serve HTTPS
+func (c ListenConfig) TLS() bool {
+	return c.SelfSigned || (c.CertFile != "" && c.KeyFile != "")
+}
+
 // Server represents the web server
 type Server struct {
-	ledStrip    *ledstrip.LEDStrip
-	ledBar      *ledbar.LEDBar
-	videoLight1 *videolight.VideoLight
-	videoLight2 *videolight.VideoLight
-	httpServer  *http.Server
-	mu          sync.Mutex // Protect concurrent access
+	ledStrip      *ledstrip.LEDStrip
+	ledBar        *ledbar.LEDBar
+	videoLight1   *videolight.VideoLight
+	videoLight2   *videolight.VideoLight
+	scenes        storage.SceneStore
+	transitions   *lights.TransitionEngine
+	effects       *effects.Engine
+	sequenceStore storage.SequenceStore
+	player        *sequences.Player
+	scheduleStore storage.ScheduleStore
+	scheduler     *schedule.Scheduler
+	circadian     *circadian.Mode
+	sleepTimers   *sleeptimer.Timers
+	ruleStore     storage.RuleStore
+	rules         *rules.Engine
+	calendar      *calendar.Watcher
+	onAir         *onair.Indicator
+	notifier      *notify.Notifier
+	webhookStore  storage.WebhookStore
+	webhooks      *webhooks.Dispatcher
+	history       *history.History
+	database      storage.HealthStore
+	hub           *events.Hub
+	metrics       *metrics.Metrics
+	auth          *authenticator
+	closing       chan struct{} // closed on shutdown, to end event streams
+	closeOnce     sync.Once     // closes closing, as Shutdown may be called more than once
+	mu            sync.Mutex    // Protect concurrent access
+
+	// httpServer is set by Start, which runs on its own goroutine, and read by
+	// Shutdown and Stop; stopped makes a Start that loses the race return at once
+	httpMu     sync.Mutex
+	httpServer *http.Server
+	stopped    bool
+
+	// revision numbers the light state as last seen in revisionState, for ETags
+	revision      uint64
+	revisionState []byte
+
+	// Health checks
+	started           time.Time
+	healthMu          sync.Mutex
+	databaseCheck     databaseDiagnostics
+	streamDeck        StreamDeck
+	streamDeckEnabled bool
+}
+
+// Dependencies are the lights, stores and subsystems the web server works with
+//
+// The lights, Scenes, Transitions, History, Database and Hub are always needed.
+// The rest may be left nil when the routes that use them aren't called, as in
+// tests; the event stream needs Effects, Player, SequenceStore, Circadian,
+// SleepTimers, OnAir and Notifier.
+type Dependencies struct {
+	LEDStrip    *ledstrip.LEDStrip
+	LEDBar      *ledbar.LEDBar
+	VideoLight1 *videolight.VideoLight
+	VideoLight2 *videolight.VideoLight
+
+	Scenes        storage.SceneStore
+	SequenceStore storage.SequenceStore
+	ScheduleStore storage.ScheduleStore
+	RuleStore     storage.RuleStore
+	WebhookStore  storage.WebhookStore
+	Database      storage.HealthStore
+
+	Transitions *lights.TransitionEngine
+	Effects     *effects.Engine
+	Player      *sequences.Player
+	Scheduler   *schedule.Scheduler
+	Circadian   *circadian.Mode
+	SleepTimers *sleeptimer.Timers
+	Rules       *rules.Engine
+	Calendar    *calendar.Watcher
+	OnAir       *onair.Indicator
+	Notifier    *notify.Notifier
+	Webhooks    *webhooks.Dispatcher
+	History     *history.History
+	Hub         *events.Hub
+	Metrics     *metrics.Metrics
+
+	Auth AuthConfig
 }
 
 // NewServer creates a new web server
-func NewServer(
-	strip *ledstrip.LEDStrip,
-	bar *ledbar.LEDBar,
-	vl1 *videolight.VideoLight,
-	vl2 *videolight.VideoLight,
-) *Server {
+func NewServer(deps Dependencies) *Server {
 	return &Server{
-		ledStrip:    strip,
-		ledBar:      bar,
-		videoLight1: vl1,
-		videoLight2: vl2,
+		ledStrip:      deps.LEDStrip,
+		ledBar:        deps.LEDBar,
+		videoLight1:   deps.VideoLight1,
+		videoLight2:   deps.VideoLight2,
+		scenes:        deps.Scenes,
+		transitions:   deps.Transitions,
+		effects:       deps.Effects,
+		sequenceStore: deps.SequenceStore,
+		player:        deps.Player,
+		scheduleStore: deps.ScheduleStore,
+		scheduler:     deps.Scheduler,
+		circadian:     deps.Circadian,
+		sleepTimers:   deps.SleepTimers,
+		ruleStore:     deps.RuleStore,
+		rules:         deps.Rules,
+		calendar:      deps.Calendar,
+		onAir:         deps.OnAir,
+		notifier:      deps.Notifier,
+		webhookStore:  deps.WebhookStore,
+		webhooks:      deps.Webhooks,
+		history:       deps.History,
+		database:      deps.Database,
+		hub:           deps.Hub,
+		metrics:       deps.Metrics,
+		auth:          newAuthenticator(deps.Auth),
+		closing:       make(chan struct{}),
+		started:       time.Now(),
 	}
 }
 
-// Start starts the HTTP server
-func (s *Server) Start(port string) error {
+// Handler returns the routes, behind authentication
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Serve static files
@@ -48,28 +185,140 @@ func (s *Server) Start(port string) error {
 
 	// Serve index.html at root
 	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/login", s.handleLoginPage)
 
 	// API endpoints
 	mux.HandleFunc("/api", s.handleAPI)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	mux.HandleFunc("/api/login", s.handleLogin)
+	mux.HandleFunc("/api/logout", s.handleLogout)
+	mux.HandleFunc("/api/session", s.handleSession)
+	mux.HandleFunc("/api/ledstrip/{id}", s.handleLEDStripDevice)
+	mux.HandleFunc("/api/ledbar/{id}", s.handleLEDBarDevice)
+	mux.HandleFunc("/api/ledbar/{id}/section/{section}", s.handleLEDBarSectionDevice)
+	mux.HandleFunc("/api/ledbar/{id}/section/{section}/rgbw/{led}", s.handleLEDBarRGBWDevice)
+	mux.HandleFunc("/api/ledbar/{id}/section/{section}/white/{led}", s.handleLEDBarWhiteDevice)
+	mux.HandleFunc("/api/videolights/{id}", s.handleVideoLightDevice)
+	mux.HandleFunc("/api/scenes/export", s.handleSceneExport)
+	mux.HandleFunc("/api/scenes/import", s.handleSceneImport)
+	mux.HandleFunc("/api/scenes", s.handleScenes)
+	mux.HandleFunc("/api/scenes/capture", s.handleSceneCapture)
+	mux.HandleFunc("/api/scenes/{id}", s.handleScene)
+	mux.HandleFunc("/api/scenes/{id}/recall", s.handleSceneRecall)
+	mux.HandleFunc("/api/shortcuts", s.handleShortcuts)
+	mux.HandleFunc("/api/shortcuts/{button}", s.handleShortcut)
+	mux.HandleFunc("/api/effects", s.handleEffects)
+	mux.HandleFunc("/api/effects/start", s.handleEffectStart)
+	mux.HandleFunc("/api/effects/stop", s.handleEffectStop)
+	mux.HandleFunc("/api/sequences", s.handleSequences)
+	mux.HandleFunc("/api/sequences/status", s.handleSequenceStatus)
+	mux.HandleFunc("/api/sequences/pause", s.handleSequenceControl)
+	mux.HandleFunc("/api/sequences/resume", s.handleSequenceControl)
+	mux.HandleFunc("/api/sequences/toggle", s.handleSequenceControl)
+	mux.HandleFunc("/api/sequences/stop", s.handleSequenceControl)
+	mux.HandleFunc("/api/sequences/{id}", s.handleSequence)
+	mux.HandleFunc("/api/sequences/{id}/keyframes", s.handleSequenceKeyframe)
+	mux.HandleFunc("/api/sequences/{id}/play", s.handleSequencePlay)
+	mux.HandleFunc("/api/schedules", s.handleSchedules)
+	mux.HandleFunc("/api/schedules/upcoming", s.handleScheduleUpcoming)
+	mux.HandleFunc("/api/schedules/{id}", s.handleSchedule)
+	mux.HandleFunc("/api/schedules/{id}/run", s.handleScheduleRun)
+	mux.HandleFunc("/api/next-events", s.handleNextEvents)
+	mux.HandleFunc("/api/circadian", s.handleCircadian)
+	mux.HandleFunc("/api/circadian/preview", s.handleCircadianPreview)
+	mux.HandleFunc("/api/circadian/resume", s.handleCircadianResume)
+	mux.HandleFunc("/api/sleep", s.handleSleep)
+	mux.HandleFunc("/api/sleep/{target}", s.handleSleepTarget)
+	mux.HandleFunc("/api/rules", s.handleRules)
+	mux.HandleFunc("/api/rules/{id}", s.handleRule)
+	mux.HandleFunc("/api/rules/{id}/run", s.handleRuleRun)
+	mux.HandleFunc("/api/hooks/{hook}", s.handleHook)
+	mux.HandleFunc("/api/calendar", s.handleCalendar)
+	mux.HandleFunc("/api/calendar/reload", s.handleCalendarReload)
+	mux.HandleFunc("/api/onair", s.handleOnAir)
+	mux.HandleFunc("/api/onair/{action}", s.handleOnAirSwitch)
+	mux.HandleFunc("/api/notify", s.handleNotify)
+	mux.HandleFunc("/api/notify/{id}", s.handleNotification)
+	mux.HandleFunc("/api/webhooks", s.handleWebhooks)
+	mux.HandleFunc("/api/webhooks/{id}", s.handleWebhook)
+	mux.HandleFunc("/api/webhooks/{id}/deliveries", s.handleWebhookDeliveries)
+	mux.HandleFunc("/api/webhooks/{id}/test", s.handleWebhookTest)
+	mux.HandleFunc("/api/history", s.handleHistory)
+	mux.HandleFunc("/api/history/{action}", s.handleHistoryAction)
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/api/diagnostics", s.handleDiagnostics)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/api/openapi.json", s.handleOpenAPI)
 
-	s.httpServer = &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+	return s.authorize(mux)
+}
+
+// Start starts the HTTP server, returning once it has been shut down
+func (s *Server) Start(config ListenConfig) error {
+	server := &http.Server{
+		Addr:         config.Addr,
+		Handler:      s.Handler(),
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	}
+	server.RegisterOnShutdown(func() { s.closeOnce.Do(func() { close(s.closing) }) })
+
+	if config.TLS() {
+		cert, err := config.certificate()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	s.httpMu.Lock()
+	if s.stopped {
+		s.httpMu.Unlock()
+		return nil
+	}
+	s.httpServer = server
+	s.httpMu.Unlock()
+
+	var err error
+	if config.TLS() {
+		log.Printf("Web server starting on https://%s", config.Addr)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Web server starting on http://%s", config.Addr)
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
 	}
+	return err
+}
 
-	log.Printf("Web server starting on http://localhost:%s", port)
-	return s.httpServer.ListenAndServe()
+// Shutdown stops accepting requests and waits for those in flight to finish,
+// until the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	if server := s.stop(); server != nil {
+		return server.Shutdown(ctx)
+	}
+	return nil
 }
 
-// Stop gracefully stops the HTTP server
+// Stop stops the HTTP server at once, dropping requests in flight
 func (s *Server) Stop() error {
-	if s.httpServer != nil {
-		return s.httpServer.Close()
+	if server := s.stop(); server != nil {
+		return server.Close()
 	}
 	return nil
 }
 
+// stop keeps Start from serving if it hasn't yet and returns the HTTP server, if any
+func (s *Server) stop() *http.Server {
+	s.httpMu.Lock()
+	defer s.httpMu.Unlock()
+	s.stopped = true
+	return s.httpServer
+}
+
 // handleIndex serves the main HTML page
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	// Only serve index.html for the root path
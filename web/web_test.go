@@ -0,0 +1,219 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/circadian"
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/effects"
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/history"
+	"github.com/kevin/office_lights/lights"
+	"github.com/kevin/office_lights/metrics"
+	"github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/notify"
+	"github.com/kevin/office_lights/onair"
+	"github.com/kevin/office_lights/sequences"
+	"github.com/kevin/office_lights/sleeptimer"
+	"github.com/kevin/office_lights/storage"
+)
+
+// newTestServer creates a server with mock lights publishing through a hub, a
+// temporary database and everything the event stream reports on
+func newTestServer(t *testing.T, auth AuthConfig) (*Server, *mqtt.MockPublisher) {
+	t.Helper()
+
+	mock := mqtt.NewMockPublisher()
+	hub := events.NewHub(mock)
+	strip := ledstrip.NewLEDStrip(hub, "test/strip")
+	bar, err := ledbar.NewLEDBar(0, hub, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, hub, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, hub, "test/vl2")
+	rig := lights.NewRig(strip, bar, vl1, vl2)
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	transitions := lights.NewTransitionEngine(rig, clock.Real{})
+	effectsEngine := effects.NewEngine(rig, clock.Real{})
+	t.Cleanup(effectsEngine.StopAll)
+	player := sequences.NewPlayer(transitions, clock.Real{})
+	t.Cleanup(player.Stop)
+	undoHistory := history.NewHistory(transitions, db, clock.Real{}, history.DefaultLimit)
+	if err := undoHistory.Start(hub); err != nil {
+		t.Fatalf("Start history failed: %v", err)
+	}
+	t.Cleanup(undoHistory.Stop)
+
+	server := NewServer(Dependencies{
+		LEDStrip:      strip,
+		LEDBar:        bar,
+		VideoLight1:   vl1,
+		VideoLight2:   vl2,
+		Scenes:        db,
+		SequenceStore: db,
+		Database:      db,
+		Transitions:   transitions,
+		Effects:       effectsEngine,
+		Player:        player,
+		Circadian:     circadian.NewMode(rig, db, clock.Real{}, time.UTC),
+		SleepTimers:   sleeptimer.NewTimers(transitions, db, clock.Real{}),
+		OnAir:         onair.NewIndicator(rig, db, clock.Real{}),
+		Notifier:      notify.NewNotifier(rig, clock.Real{}),
+		History:       undoHistory,
+		Hub:           hub,
+		Metrics:       metrics.New(),
+		Auth:          auth,
+	})
+	mock.Clear()
+	return server, mock
+}
+
+// serve sends a request through the server's routes; header holds name and value pairs
+func serve(s *Server, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, path, reader)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	return w
+}
+
+// checkStatus fails the test if a response doesn't have the wanted status
+func checkStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("Expected status %d, got %d: %s", want, w.Code, w.Body.String())
+	}
+}
+
+// decode decodes a JSON response body into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestIndexServed(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+
+	w := serve(s, "GET", "/", "")
+	checkStatus(t, w, http.StatusOK)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected HTML, got %q", ct)
+	}
+	checkStatus(t, serve(s, "GET", "/nowhere", ""), http.StatusNotFound)
+}
+
+// freeAddr returns a local address nothing is listening on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestShutdownBeforeStart(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ListenConfig{Addr: freeAddr(t)}) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Start to return nil after Shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		s.Stop()
+		t.Fatal("Start served after Shutdown")
+	}
+}
+
+func TestShutdownEndsEventStreams(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	addr := freeAddr(t)
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ListenConfig{Addr: addr}) }()
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 100; i++ {
+		if resp, err = http.Get("http://" + addr + "/api/events"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /api/events failed: %v", err)
+	}
+	defer resp.Body.Close()
+	nextState(t, readEvents(t, resp))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected Shutdown to end the event stream, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected Start to return nil, got %v", err)
+	}
+}
+
+func TestShutdownTwice(t *testing.T) {
+	s, _ := newTestServer(t, AuthConfig{})
+	addr := freeAddr(t)
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ListenConfig{Addr: addr}) }()
+	for i := 0; i < 100; i++ {
+		if resp, err := http.Get("http://" + addr + "/"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown %d failed: %v", i+1, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected Start to return nil, got %v", err)
+	}
+	// The shutdown hooks run on their own goroutines; give a second close time to panic
+	time.Sleep(50 * time.Millisecond)
+}
@@ -0,0 +1,281 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/kevin/office_lights/storage"
+	"github.com/kevin/office_lights/webhooks"
+)
+
+// webhookResponse is a stored webhook with its secret hidden and its latest delivery attempt
+type webhookResponse struct {
+	storage.Webhook
+	HasSecret    bool                     `json:"hasSecret"`
+	LastDelivery *storage.WebhookDelivery `json:"lastDelivery,omitempty"`
+}
+
+// webhookRequest is a webhook as created or replaced through the API
+// A replacement without a secret keeps the old one; an empty secret removes it.
+type webhookRequest struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Secret  *string  `json:"secret"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// handleWebhooks lists the webhooks (GET) or registers one (POST)
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		s.writeWebhooks(w)
+	case "POST":
+		hook, ok := decodeWebhook(w, r, storage.Webhook{Enabled: true})
+		if !ok {
+			return
+		}
+
+		id, err := s.webhookStore.CreateWebhook(*hook)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+
+		log.Printf("Web: Created webhook %q", hook.Name)
+		s.writeWebhook(w, id, http.StatusCreated)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhook returns (GET), replaces (PUT) or deletes (DELETE) a webhook
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.writeWebhook(w, id, http.StatusOK)
+	case "PUT":
+		existing, err := s.webhookStore.GetWebhook(id)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		if existing == nil {
+			writeWebhookError(w, fmt.Errorf("%w: %d", storage.ErrWebhookNotFound, id))
+			return
+		}
+
+		hook, ok := decodeWebhook(w, r, storage.Webhook{ID: id, Secret: existing.Secret, Enabled: true})
+		if !ok {
+			return
+		}
+		if err := s.webhookStore.UpdateWebhook(*hook); err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+
+		log.Printf("Web: Updated webhook %q", hook.Name)
+		s.writeWebhook(w, id, http.StatusOK)
+	case "DELETE":
+		if err := s.webhookStore.DeleteWebhook(id); err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+
+		log.Printf("Web: Deleted webhook %d", id)
+		s.writeWebhooks(w)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhookDeliveries returns a webhook's delivery log, newest first
+// ?limit= caps the number of attempts returned.
+func (s *Server) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	limit := storage.WebhookDeliveryLogSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, `{"error":"Invalid limit"}`, http.StatusBadRequest)
+			return
+		}
+		limit = min(n, limit)
+	}
+
+	hook, err := s.webhookStore.GetWebhook(id)
+	if err == nil && hook == nil {
+		err = fmt.Errorf("%w: %d", storage.ErrWebhookNotFound, id)
+	}
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	deliveries, err := s.webhookStore.ListWebhookDeliveries(id, limit)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		log.Printf("Error encoding webhook deliveries: %v", err)
+	}
+}
+
+// handleWebhookTest sends a webhook a ping and returns how the attempt went
+func (s *Server) handleWebhookTest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := s.webhooks.Test(id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	log.Printf("Web: Pinged webhook %d (status %d)", id, delivery.Status)
+	if err := json.NewEncoder(w).Encode(delivery); err != nil {
+		log.Printf("Error encoding webhook delivery: %v", err)
+	}
+}
+
+// webhookID parses the webhook ID from the request path, writing an error if it is invalid
+func webhookID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid webhook ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeWebhook reads a webhook from the request body over the given defaults
+// and checks its URL and events
+func decodeWebhook(w http.ResponseWriter, r *http.Request, hook storage.Webhook) (*storage.Webhook, bool) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	hook.Name = req.Name
+	hook.URL = req.URL
+	hook.Events = req.Events
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+
+	if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, `{"error":"Webhook URL must be an absolute http or https URL"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	for _, event := range hook.Events {
+		if !webhooks.ValidEvent(event) {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, fmt.Sprintf("unknown webhook event %q", event)), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return &hook, true
+}
+
+// writeWebhooks writes every webhook
+func (s *Server) writeWebhooks(w http.ResponseWriter) {
+	hooks, err := s.webhookStore.ListWebhooks()
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response := make([]webhookResponse, 0, len(hooks))
+	for _, hook := range hooks {
+		response = append(response, s.webhookResponse(hook))
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding webhooks: %v", err)
+	}
+}
+
+// writeWebhook writes a stored webhook
+func (s *Server) writeWebhook(w http.ResponseWriter, id int, code int) {
+	hook, err := s.webhookStore.GetWebhook(id)
+	if err == nil && hook == nil {
+		err = fmt.Errorf("%w: %d", storage.ErrWebhookNotFound, id)
+	}
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(s.webhookResponse(*hook)); err != nil {
+		log.Printf("Error encoding webhook: %v", err)
+	}
+}
+
+// webhookResponse hides a webhook's secret and adds its latest delivery attempt
+func (s *Server) webhookResponse(hook storage.Webhook) webhookResponse {
+	response := webhookResponse{Webhook: hook, HasSecret: hook.Secret != ""}
+	response.Secret = ""
+
+	deliveries, err := s.webhookStore.ListWebhookDeliveries(hook.ID, 1)
+	if err != nil {
+		log.Printf("Error reading webhook %d deliveries: %v", hook.ID, err)
+	} else if len(deliveries) > 0 {
+		response.LastDelivery = &deliveries[0]
+	}
+	return response
+}
+
+// writeWebhookError maps a webhook store error to an HTTP status
+func writeWebhookError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrWebhookNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, storage.ErrWebhookNameRequired):
+		code = http.StatusBadRequest
+	case errors.Is(err, storage.ErrWebhookNameTaken):
+		code = http.StatusConflict
+	default:
+		log.Printf("Error saving webhook: %v", err)
+	}
+	http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), code)
+}
@@ -0,0 +1,127 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/lights"
+)
+
+// Settle is how long the lights must stay still before device changes are sent,
+// so a fade sends its end state rather than every step
+const Settle = 500 * time.Millisecond
+
+// MaxWait is the longest device changes are held back while the lights keep changing
+const MaxWait = 5 * time.Second
+
+// Devices names the lights in device.changed events, in the order changes are sent
+var Devices = []string{"ledStrip", "ledBar", "videoLight1", "videoLight2"}
+
+// DeviceChange is the data of a device.changed event
+type DeviceChange struct {
+	Device string          `json:"device"` // one of Devices
+	State  json.RawMessage `json:"state"`  // as the web API's /api shows the light
+}
+
+// SceneRecall is the data of a scene.recalled event
+type SceneRecall struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Connection is the data of an mqtt.connection event
+type Connection struct {
+	Connected bool `json:"connected"`
+}
+
+// SceneRecalled sends a scene.recalled event; it suits TransitionEngine.OnRecall
+func (d *Dispatcher) SceneRecalled(sceneID int, name string) {
+	d.Emit(EventSceneRecalled, SceneRecall{ID: sceneID, Name: name})
+}
+
+// ConnectionChanged sends an mqtt.connection event; it suits Client.OnConnectionChange
+func (d *Dispatcher) ConnectionChanged(connected bool) {
+	d.Emit(EventMQTTConnection, Connection{Connected: connected})
+}
+
+// WatchDevices sends a device.changed event for each light that changes,
+// until the dispatcher is stopped
+//
+// Changes are gathered until the lights have been still for Settle, or for at
+// most MaxWait, and each light is compared with what was last sent, so a light
+// that changes and changes back sends nothing.
+func (d *Dispatcher) WatchDevices(hub *events.Hub, rig *lights.Rig) {
+	if !d.track() {
+		return
+	}
+	changed, unsubscribe := hub.Subscribe()
+	last := snapshot(rig)
+
+	go func() {
+		defer d.wg.Done()
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-changed:
+			case <-d.ctx.Done():
+				return
+			}
+			if !d.settle(changed) {
+				return
+			}
+
+			current := snapshot(rig)
+			if current == nil {
+				continue
+			}
+			for _, device := range Devices {
+				if bytes.Equal(current[device], last[device]) {
+					continue
+				}
+				d.Emit(EventDeviceChanged, DeviceChange{Device: device, State: current[device]})
+			}
+			last = current
+		}
+	}()
+}
+
+// settle waits until no change has come for Settle, or MaxWait has passed,
+// returning false if the dispatcher is stopped meanwhile
+func (d *Dispatcher) settle(changed <-chan struct{}) bool {
+	deadline := d.clock.After(MaxWait)
+	for {
+		select {
+		case <-changed:
+		case <-d.clock.After(Settle):
+			return true
+		case <-deadline:
+			return true
+		case <-d.ctx.Done():
+			return false
+		}
+	}
+}
+
+// snapshot returns each light's state encoded as JSON, as the web API shows it
+func snapshot(rig *lights.Rig) map[string]json.RawMessage {
+	states, err := rig.ReadStates()
+	if err != nil {
+		log.Printf("Webhooks: Failed to read the lights: %v", err)
+		return nil
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		log.Printf("Webhooks: Failed to encode the lights: %v", err)
+		return nil
+	}
+	var encoded map[string]json.RawMessage
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		log.Printf("Webhooks: Failed to encode the lights: %v", err)
+		return nil
+	}
+	return encoded
+}
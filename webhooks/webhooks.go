@@ -0,0 +1,278 @@
+// Package webhooks sends a signed JSON POST to registered URLs when something happens to the lights
+//
+// Webhooks are kept in the database. Each event goes to every enabled webhook
+// that asks for it, as
+//
+//	{"id": "…", "event": "scene.recalled", "time": "2024-05-01T09:00:00Z", "data": {…}}
+//
+// with the event and delivery ID in the X-Lights-Event and X-Lights-Delivery
+// headers and, when the webhook has a secret, an HMAC-SHA256 of the body in
+// X-Lights-Signature. Failed deliveries are retried with backoff, and every
+// attempt is kept in the webhook's delivery log.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/storage"
+)
+
+// Events a webhook can ask for
+const (
+	EventDeviceChanged  = "device.changed"  // a light changed: {"device", "state"}
+	EventSceneRecalled  = "scene.recalled"  // a scene was recalled: {"id", "name"}
+	EventMQTTConnection = "mqtt.connection" // the broker connection came or went: {"connected"}
+)
+
+// EventPing is sent by Test, whatever events the webhook asks for
+const EventPing = "ping"
+
+// Events lists the events a webhook can ask for
+var Events = []string{EventDeviceChanged, EventSceneRecalled, EventMQTTConnection}
+
+// Backoff is how long to wait before each retry of a failed delivery
+// A delivery is given up once every retry has failed.
+var Backoff = []time.Duration{time.Second, 10 * time.Second, time.Minute, 5 * time.Minute}
+
+// Timeout is how long a webhook has to respond
+const Timeout = 10 * time.Second
+
+// ErrStopped reports an event sent after the dispatcher was stopped
+var ErrStopped = errors.New("webhook dispatcher stopped")
+
+// Payload is the body POSTed to a webhook
+type Payload struct {
+	ID    string      `json:"id"` // the delivery ID, the same for every attempt
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// Dispatcher delivers events to the webhooks in a store
+type Dispatcher struct {
+	store  storage.WebhookStore
+	clock  clock.Clock
+	client *http.Client
+
+	ctx    context.Context // cancelled by Stop
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+// NewDispatcher creates a dispatcher for the webhooks in a store
+func NewDispatcher(store storage.WebhookStore, clk clock.Clock) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		store:  store,
+		clock:  clk,
+		client: &http.Client{Timeout: Timeout},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Emit sends an event to every enabled webhook that asks for it
+// Delivery happens in the background, so Emit never waits on a webhook.
+func (d *Dispatcher) Emit(event string, data interface{}) {
+	hooks, err := d.store.ListWebhooks()
+	if err != nil {
+		log.Printf("Webhooks: Failed to list webhooks: %v", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !hook.Enabled || !wants(hook, event) {
+			continue
+		}
+		payload := Payload{ID: newID(), Event: event, Time: d.clock.Now().UTC(), Data: data}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Webhooks: Failed to encode %s: %v", event, err)
+			return
+		}
+		if !d.track() {
+			return
+		}
+		go func(hook storage.Webhook) {
+			defer d.wg.Done()
+			d.deliver(hook, payload, body)
+		}(hook)
+	}
+}
+
+// Test sends a ping to a webhook straight away, once, whether or not it is
+// enabled, and returns how the attempt went
+func (d *Dispatcher) Test(webhookID int) (*storage.WebhookDelivery, error) {
+	hook, err := d.store.GetWebhook(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if hook == nil {
+		return nil, fmt.Errorf("%w: %d", storage.ErrWebhookNotFound, webhookID)
+	}
+	if !d.track() {
+		return nil, ErrStopped
+	}
+	defer d.wg.Done()
+
+	payload := Payload{ID: newID(), Event: EventPing, Time: d.clock.Now().UTC(), Data: map[string]string{"webhook": hook.Name}}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	delivery, _ := d.attempt(*hook, payload, body, 1)
+	d.record(delivery)
+	return &delivery, nil
+}
+
+// Stop abandons retries and waits for deliveries under way to finish
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+}
+
+// track counts a delivery in, unless the dispatcher has stopped
+func (d *Dispatcher) track() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return false
+	}
+	d.wg.Add(1)
+	return true
+}
+
+// deliver sends a payload to a webhook, retrying until it is accepted, refused
+// for good or the retries run out
+func (d *Dispatcher) deliver(hook storage.Webhook, payload Payload, body []byte) {
+	for n := 1; ; n++ {
+		delivery, retry := d.attempt(hook, payload, body, n)
+		d.record(delivery)
+		if !retry {
+			return
+		}
+		if n > len(Backoff) {
+			log.Printf("Webhooks: Gave up delivering %s %s to %q after %d attempts", payload.Event, payload.ID, hook.Name, n)
+			return
+		}
+
+		select {
+		case <-d.clock.After(Backoff[n-1]):
+		case <-d.ctx.Done():
+			return
+		}
+
+		// Retry with the webhook as it is now, unless it has gone or been turned off
+		current, err := d.store.GetWebhook(hook.ID)
+		if err != nil {
+			log.Printf("Webhooks: Failed to reload webhook %d: %v", hook.ID, err)
+			return
+		}
+		if current == nil || !current.Enabled {
+			return
+		}
+		hook = *current
+	}
+}
+
+// attempt POSTs a payload to a webhook once, reporting whether it is worth trying again
+func (d *Dispatcher) attempt(hook storage.Webhook, payload Payload, body []byte, n int) (storage.WebhookDelivery, bool) {
+	delivery := storage.WebhookDelivery{
+		WebhookID: hook.ID,
+		Delivery:  payload.ID,
+		Event:     payload.Event,
+		Attempt:   n,
+		CreatedAt: d.clock.Now(),
+	}
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "office-lights-webhooks")
+	req.Header.Set("X-Lights-Event", payload.Event)
+	req.Header.Set("X-Lights-Delivery", payload.ID)
+	if hook.Secret != "" {
+		req.Header.Set("X-Lights-Signature", Sign(hook.Secret, body))
+	}
+
+	started := time.Now()
+	resp, err := d.client.Do(req)
+	delivery.Duration = int(time.Since(started).Milliseconds())
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, d.ctx.Err() == nil
+	}
+	defer resp.Body.Close()
+	// Read a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.Status = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return delivery, false
+	}
+	delivery.Error = resp.Status
+	// Server errors and rate limiting may pass; anything else won't
+	return delivery, resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// record adds an attempt to the delivery log
+func (d *Dispatcher) record(delivery storage.WebhookDelivery) {
+	if delivery.Error != "" {
+		log.Printf("Webhooks: Delivery %s of %s to webhook %d failed (attempt %d): %s",
+			delivery.Delivery, delivery.Event, delivery.WebhookID, delivery.Attempt, delivery.Error)
+	}
+	if err := d.store.AddWebhookDelivery(delivery); err != nil {
+		log.Printf("Webhooks: %v", err)
+	}
+}
+
+// Sign returns the X-Lights-Signature header value for a body: "sha256=" and
+// the hex HMAC-SHA256 of the body keyed with the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidEvent reports whether a webhook can ask for an event
+func ValidEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// wants reports whether a webhook asks for an event; one that names no events gets them all
+func wants(hook storage.Webhook, event string) bool {
+	return len(hook.Events) == 0 || slices.Contains(hook.Events, event)
+}
+
+// newID returns a random delivery ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
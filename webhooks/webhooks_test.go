@@ -0,0 +1,379 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevin/office_lights/clock"
+	"github.com/kevin/office_lights/drivers/ledbar"
+	"github.com/kevin/office_lights/drivers/ledstrip"
+	"github.com/kevin/office_lights/drivers/videolight"
+	"github.com/kevin/office_lights/events"
+	"github.com/kevin/office_lights/lights"
+	officemqtt "github.com/kevin/office_lights/mqtt"
+	"github.com/kevin/office_lights/storage"
+)
+
+// received is a request that reached the test receiver
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local webhook endpoint answering with a status per request
+type receiver struct {
+	*httptest.Server
+	requests chan received
+
+	mu       sync.Mutex
+	statuses []int // answered in turn, the last repeating; 200 if empty
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+	r := &receiver{requests: make(chan received, 16), statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status = r.statuses[0]
+			if len(r.statuses) > 1 {
+				r.statuses = r.statuses[1:]
+			}
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		r.requests <- received{header: req.Header, body: body}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// next waits for the next request to arrive
+func (r *receiver) next(t *testing.T) received {
+	t.Helper()
+	select {
+	case req := <-r.requests:
+		return req
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a webhook request")
+		return received{}
+	}
+}
+
+// none checks no request arrives for a moment
+func (r *receiver) none(t *testing.T) {
+	t.Helper()
+	select {
+	case req := <-r.requests:
+		t.Fatalf("Unexpected webhook request: %s", req.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// start is 9:00 on Monday 2 March 2026
+var start = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, *storage.Database, *clock.Fake) {
+	t.Helper()
+
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema failed: %v", err)
+	}
+
+	clk := clock.NewFake(start)
+	d := NewDispatcher(db, clk)
+	t.Cleanup(d.Stop)
+	return d, db, clk
+}
+
+func addWebhook(t *testing.T, db *storage.Database, hook storage.Webhook) int {
+	t.Helper()
+	id, err := db.CreateWebhook(hook)
+	if err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+	return id
+}
+
+// deliveries waits for a webhook's delivery log to reach n attempts, returning them oldest first
+func deliveries(t *testing.T, db *storage.Database, webhookID, n int) []storage.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		log, err := db.ListWebhookDeliveries(webhookID, 100)
+		if err != nil {
+			t.Fatalf("ListWebhookDeliveries failed: %v", err)
+		}
+		if len(log) >= n {
+			for i, j := 0, len(log)-1; i < j; i, j = i+1, j-1 {
+				log[i], log[j] = log[j], log[i]
+			}
+			return log
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d deliveries, got %d", n, len(log))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEmitSignsAndDelivers(t *testing.T) {
+	d, db, _ := newTestDispatcher(t)
+	rcv := newReceiver(t)
+
+	id := addWebhook(t, db, storage.Webhook{Name: "signed", URL: rcv.URL, Secret: "s3cret", Events: []string{EventSceneRecalled}, Enabled: true})
+	addWebhook(t, db, storage.Webhook{Name: "disabled", URL: rcv.URL, Enabled: false})
+	addWebhook(t, db, storage.Webhook{Name: "other event", URL: rcv.URL, Events: []string{EventDeviceChanged}, Enabled: true})
+
+	d.SceneRecalled(3, "Focus")
+
+	req := rcv.next(t)
+	rcv.none(t)
+
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := req.header.Get("X-Lights-Event"); got != EventSceneRecalled {
+		t.Errorf("X-Lights-Event = %q", got)
+	}
+	if got, want := req.header.Get("X-Lights-Signature"), Sign("s3cret", req.body); got != want {
+		t.Errorf("X-Lights-Signature = %q, want %q", got, want)
+	}
+
+	var payload struct {
+		ID    string      `json:"id"`
+		Event string      `json:"event"`
+		Time  time.Time   `json:"time"`
+		Data  SceneRecall `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("Invalid payload %s: %v", req.body, err)
+	}
+	if payload.Event != EventSceneRecalled || !payload.Time.Equal(start) || payload.Data != (SceneRecall{ID: 3, Name: "Focus"}) {
+		t.Errorf("Unexpected payload %s", req.body)
+	}
+	if payload.ID == "" || req.header.Get("X-Lights-Delivery") != payload.ID {
+		t.Errorf("Delivery ID %q doesn't match header %q", payload.ID, req.header.Get("X-Lights-Delivery"))
+	}
+
+	log := deliveries(t, db, id, 1)
+	if log[0].Status != http.StatusOK || log[0].Attempt != 1 || log[0].Error != "" || log[0].Delivery != payload.ID {
+		t.Errorf("Unexpected delivery log %+v", log[0])
+	}
+}
+
+func TestUnsignedWithoutSecret(t *testing.T) {
+	d, db, _ := newTestDispatcher(t)
+	rcv := newReceiver(t)
+	addWebhook(t, db, storage.Webhook{Name: "plain", URL: rcv.URL, Enabled: true})
+
+	d.ConnectionChanged(false)
+
+	req := rcv.next(t)
+	if req.header.Get("X-Lights-Signature") != "" {
+		t.Error("Expected no signature without a secret")
+	}
+	if got := req.header.Get("X-Lights-Event"); got != EventMQTTConnection {
+		t.Errorf("X-Lights-Event = %q", got)
+	}
+}
+
+func TestRetriesWithBackoff(t *testing.T) {
+	d, db, clk := newTestDispatcher(t)
+	rcv := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	id := addWebhook(t, db, storage.Webhook{Name: "flaky", URL: rcv.URL, Enabled: true})
+
+	d.ConnectionChanged(true)
+
+	first := rcv.next(t)
+	for _, wait := range Backoff[:2] {
+		clk.BlockUntil(1)
+		clk.Advance(wait - time.Millisecond)
+		rcv.none(t)
+		clk.Advance(time.Millisecond)
+		if retry := rcv.next(t); string(retry.body) != string(first.body) {
+			t.Errorf("Retry sent %s, want %s", retry.body, first.body)
+		}
+	}
+
+	log := deliveries(t, db, id, 3)
+	for i, want := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK} {
+		if log[i].Attempt != i+1 || log[i].Status != want || log[i].Delivery != log[0].Delivery {
+			t.Errorf("Attempt %d logged as %+v", i+1, log[i])
+		}
+	}
+	if clk.Waiters() != 0 {
+		t.Error("Expected no retry after success")
+	}
+}
+
+func TestClientErrorIsNotRetried(t *testing.T) {
+	d, db, clk := newTestDispatcher(t)
+	rcv := newReceiver(t, http.StatusNotFound)
+	id := addWebhook(t, db, storage.Webhook{Name: "gone", URL: rcv.URL, Enabled: true})
+
+	d.ConnectionChanged(true)
+	rcv.next(t)
+
+	log := deliveries(t, db, id, 1)
+	if log[0].Status != http.StatusNotFound || log[0].Error == "" {
+		t.Errorf("Unexpected delivery log %+v", log[0])
+	}
+	if clk.Waiters() != 0 {
+		t.Error("Expected a 404 not to be retried")
+	}
+}
+
+func TestGivesUpAfterBackoff(t *testing.T) {
+	d, db, clk := newTestDispatcher(t)
+	rcv := newReceiver(t, http.StatusInternalServerError)
+	id := addWebhook(t, db, storage.Webhook{Name: "down", URL: rcv.URL, Enabled: true})
+
+	d.ConnectionChanged(true)
+	rcv.next(t)
+	for _, wait := range Backoff {
+		clk.BlockUntil(1)
+		clk.Advance(wait)
+		rcv.next(t)
+	}
+
+	log := deliveries(t, db, id, len(Backoff)+1)
+	if last := log[len(log)-1]; last.Attempt != len(Backoff)+1 {
+		t.Errorf("Last attempt %d, want %d", last.Attempt, len(Backoff)+1)
+	}
+	rcv.none(t)
+	if clk.Waiters() != 0 {
+		t.Error("Expected no more retries")
+	}
+}
+
+func TestRetryStopsWhenDisabled(t *testing.T) {
+	d, db, clk := newTestDispatcher(t)
+	rcv := newReceiver(t, http.StatusBadGateway)
+	id := addWebhook(t, db, storage.Webhook{Name: "down", URL: rcv.URL, Enabled: true})
+
+	d.ConnectionChanged(true)
+	rcv.next(t)
+
+	hook, _ := db.GetWebhook(id)
+	hook.Enabled = false
+	if err := db.UpdateWebhook(*hook); err != nil {
+		t.Fatalf("UpdateWebhook failed: %v", err)
+	}
+	clk.BlockUntil(1)
+	clk.Advance(Backoff[0])
+	rcv.none(t)
+}
+
+func TestStopAbandonsRetries(t *testing.T) {
+	d, db, clk := newTestDispatcher(t)
+	rcv := newReceiver(t, http.StatusInternalServerError)
+	addWebhook(t, db, storage.Webhook{Name: "down", URL: rcv.URL, Enabled: true})
+
+	d.ConnectionChanged(true)
+	rcv.next(t)
+	clk.BlockUntil(1)
+
+	stopped := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop didn't return while a retry was waiting")
+	}
+
+	d.ConnectionChanged(false)
+	rcv.none(t)
+}
+
+func TestPing(t *testing.T) {
+	d, db, _ := newTestDispatcher(t)
+	rcv := newReceiver(t)
+	id := addWebhook(t, db, storage.Webhook{Name: "off", URL: rcv.URL, Secret: "k", Enabled: false})
+
+	delivery, err := d.Test(id)
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if delivery.Event != EventPing || delivery.Status != http.StatusOK {
+		t.Errorf("Unexpected delivery %+v", delivery)
+	}
+	req := rcv.next(t)
+	if req.header.Get("X-Lights-Signature") != Sign("k", req.body) {
+		t.Error("Expected the ping to be signed")
+	}
+
+	if _, err := d.Test(id + 1); err == nil {
+		t.Error("Expected an error pinging a missing webhook")
+	}
+}
+
+func TestWatchDevices(t *testing.T) {
+	d, db, clk := newTestDispatcher(t)
+	rcv := newReceiver(t)
+	addWebhook(t, db, storage.Webhook{Name: "devices", URL: rcv.URL, Events: []string{EventDeviceChanged}, Enabled: true})
+
+	hub := events.NewHub(officemqtt.NewMockPublisher())
+	bar, err := ledbar.NewLEDBar(0, hub, "test/bar")
+	if err != nil {
+		t.Fatalf("NewLEDBar failed: %v", err)
+	}
+	vl1, _ := videolight.NewVideoLight(1, hub, "test/vl1")
+	vl2, _ := videolight.NewVideoLight(2, hub, "test/vl2")
+	rig := lights.NewRig(ledstrip.NewLEDStrip(hub, "test/strip"), bar, vl1, vl2)
+
+	d.WatchDevices(hub, rig)
+
+	// A fade only sends where it ends up. The first change starts the MaxWait
+	// and Settle timers, and each later one adds a Settle timer as the last
+	// one's comes due.
+	for level := 10; level <= 50; level += 10 {
+		rig.Strip.SetColor(level, 0, 0)
+		if level == 10 {
+			clk.BlockUntil(2)
+		} else {
+			clk.BlockUntil(3)
+		}
+		clk.Advance(Settle / 2)
+	}
+	rcv.none(t)
+	clk.Advance(Settle)
+
+	var payload struct {
+		Data struct {
+			Device string         `json:"device"`
+			State  map[string]int `json:"state"`
+		} `json:"data"`
+	}
+	req := rcv.next(t)
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("Invalid payload %s: %v", req.body, err)
+	}
+	if payload.Data.Device != "ledStrip" || payload.Data.State["r"] != 50 {
+		t.Errorf("Unexpected change %s", req.body)
+	}
+	rcv.none(t)
+
+	// A light changed and changed back sends nothing
+	vl1.SetState(true, 40)
+	vl1.SetState(false, 0)
+	clk.BlockUntil(3)
+	clk.Advance(Settle)
+	rcv.none(t)
+}